@@ -25,6 +25,16 @@ import (
 func Main(app gopi.App, args []string) error {
 	frontend := app.UnitInstance("mutablehome/dvb/frontend").(home.DVBFrontend)
 	demux := app.UnitInstance("mutablehome/dvb/demux").(home.DVBDemux)
+	metrics := app.UnitInstance("mutablehome/metrics").(home.Metrics)
+
+	// Publish signal strength and section errors
+	for _, unit := range []interface{}{frontend, demux} {
+		if source, ok := unit.(home.MetricsSource); ok {
+			if err := metrics.AddSource(source); err != nil {
+				return err
+			}
+		}
+	}
 
 	// Obtain tuning parameters
 	key := app.Flags().GetString("dvb.name", gopi.FLAG_NS_DEFAULT)
@@ -18,7 +18,10 @@ import (
 	// Units
 	_ "github.com/djthorpe/gopi/v2/unit/bus"
 	_ "github.com/djthorpe/gopi/v2/unit/files"
+	_ "github.com/djthorpe/gopi/v2/unit/mdns"
 	_ "github.com/djthorpe/mutablehome/unit/dvb"
+	_ "github.com/djthorpe/mutablehome/unit/httpd"
+	_ "github.com/djthorpe/mutablehome/unit/metrics"
 )
 
 var (
@@ -31,7 +34,7 @@ var (
 // BOOTSTRAP
 
 func main() {
-	if app, err := app.NewCommandLineTool(Main, Events, "mutablehome/dvb/table", "mutablehome/dvb/frontend", "mutablehome/dvb/demux"); err != nil {
+	if app, err := app.NewCommandLineTool(Main, Events, "mutablehome/dvb/table", "mutablehome/dvb/frontend", "mutablehome/dvb/demux", "mutablehome/metrics"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	} else {
 		app.Flags().FlagString("dvb.name", "", "DVB Transmitter")
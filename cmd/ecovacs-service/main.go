@@ -0,0 +1,85 @@
+/*
+	Mutablehome Automation
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	// Frameworks
+	app "github.com/djthorpe/gopi-rpc/v2/app"
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+
+	// Units
+	_ "github.com/djthorpe/gopi-rpc/v2/unit/grpc"
+	_ "github.com/djthorpe/gopi/v2/unit/bus"
+	_ "github.com/djthorpe/gopi/v2/unit/logger"
+	_ "github.com/djthorpe/gopi/v2/unit/mdns"
+	_ "github.com/djthorpe/mutablehome/grpc/mutablehome"
+	_ "github.com/djthorpe/mutablehome/unit/httpd"
+	_ "github.com/djthorpe/mutablehome/unit/metrics"
+	_ "github.com/djthorpe/mutablehome/unit/store"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// MAIN
+
+func Main(app gopi.App, args []string) error {
+	// Don't allow any arguments
+	if len(args) != 0 {
+		return fmt.Errorf("Arguments provided but not required")
+	}
+
+	// Ecovacs node, state store, metrics and RPC service
+	node := app.UnitInstance("mutablehome/ecovacs/node").(ecovacs.Node)
+	store := app.UnitInstance("mutablehome/store").(mutablehome.Store)
+	metrics := app.UnitInstance("mutablehome/metrics").(mutablehome.Metrics)
+	service := app.UnitInstance("rpc/mutablehome/node").(mutablehome.RPCNodeService)
+
+	// Serve the node, record device state and publish metrics for
+	// the node and account
+	if err := service.SetNode(node); err != nil {
+		return err
+	} else if err := store.AddNode(node); err != nil {
+		return err
+	} else if err := service.SetStore(store); err != nil {
+		return err
+	} else if err := metrics.AddNode(node); err != nil {
+		return err
+	} else if source, ok := app.UnitInstance("ecovacs").(mutablehome.MetricsSource); ok {
+		if err := metrics.AddSource(source); err != nil {
+			return err
+		}
+	}
+
+	// Connect to devices
+	if err := node.Connect(); err != nil {
+		return err
+	}
+
+	// Wait until CTRL+C pressed
+	fmt.Println("Press CTRL+C to exit")
+	app.WaitForSignal(context.Background(), os.Interrupt)
+
+	// Disconnect from devices
+	return node.Disconnect()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BOOTSTRAP
+
+func main() {
+	if app, err := app.NewServer(Main, "rpc/mutablehome/node", "mutablehome/ecovacs/node", "mutablehome/store", "mutablehome/metrics", "register", "discovery"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		os.Exit(app.Run())
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	sim "github.com/djthorpe/mutablehome/unit/ecovacs/sim"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+func Main(app gopi.App, args []string) error {
+	addr := app.Flags().GetString("addr", gopi.FLAG_NS_DEFAULT)
+	xmpp := app.Flags().GetString("xmpp", gopi.FLAG_NS_DEFAULT)
+	mqtt := app.Flags().GetString("mqtt", gopi.FLAG_NS_DEFAULT)
+	if len(args) != 0 {
+		return gopi.ErrHelp
+	}
+
+	// Start simulator
+	backend, err := sim.New(addr, xmpp, mqtt)
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	// Add demo robots
+	if err := backend.AddRobot("E0000000000000000001", "Living Room"); err != nil {
+		return err
+	} else if err := backend.AddRobot("E0000000000000000002", "Bedroom"); err != nil {
+		return err
+	} else if err := backend.AddRobotWithClass("E0000000000000000003", "Kitchen", sim.DEFAULT_JSON_CLASS); err != nil {
+		return err
+	}
+
+	// Wait for CTRL+C
+	fmt.Println("Serving", backend)
+	fmt.Println("Connect with the following flags (any email and password):")
+	fmt.Println("  -ecovacs.country", sim.DEFAULT_COUNTRY, "-ecovacs.insecure \\")
+	fmt.Println("  -ecovacs.main", strconv.Quote(backend.MainURL()), "\\")
+	fmt.Println("  -ecovacs.user", strconv.Quote(backend.UserURL()), "\\")
+	fmt.Println("  -ecovacs.xmpp", strconv.Quote(backend.XMPPHost()), "\\")
+	fmt.Println("  -ecovacs.portal", strconv.Quote(backend.PortalURL()), "\\")
+	fmt.Println("  -ecovacs.mqtt", strconv.Quote(backend.MQTTHost()))
+	fmt.Println("Press CTRL+C to end")
+	app.WaitForSignal(context.Background(), os.Interrupt)
+
+	// Return success
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	// Frameworks
+	"github.com/djthorpe/gopi/v2/app"
+
+	// Units
+	_ "github.com/djthorpe/gopi/v2/unit/logger"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+func main() {
+	if app, err := app.NewCommandLineTool(Main, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		app.Flags().FlagString("addr", "127.0.0.1:8000", "HTTPS address")
+		app.Flags().FlagString("xmpp", "127.0.0.1:5223", "XMPP address")
+		app.Flags().FlagString("mqtt", "127.0.0.1:8883", "MQTT address")
+		os.Exit(app.Run())
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+	tablewriter "github.com/olekukonko/tablewriter"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+type Subcommand struct {
+	Name   string
+	Syntax string
+	Re     *regexp.Regexp
+	Func   func(gopi.App, mutablehome.EvovacsDevice, []string) error
+}
+
+const (
+	// Time to wait for a response from a device
+	RESPONSE_TIMEOUT = 10 * time.Second
+
+	// Events buffered while waiting for a response
+	RESPONSE_CAPACITY = 100
+)
+
+var (
+	Subcommands = []Subcommand{
+		Subcommand{"schedules", "schedules", regexp.MustCompile("^$"), ListSchedules},
+		Subcommand{"schedule", "schedule <name> <hh:mm> <days> <mode> [<suction>]", regexp.MustCompile("^(\\S+)\\s+(\\d{1,2}:\\d{2})\\s+(\\S+)\\s+(\\S+)\\s*(\\S*)$"), SetSchedule},
+		Subcommand{"unschedule", "unschedule <name>", regexp.MustCompile("^(\\S+)$"), DeleteSchedule},
+		Subcommand{"reset", "reset brush|sidebrush|filter", regexp.MustCompile("^(\\S+)$"), ResetLifeSpan},
+		Subcommand{"dnd", "dnd [on|off [<hh:mm> <hh:mm>]]", regexp.MustCompile("^(?:(on|off)(?:\\s+(\\d{1,2}:\\d{2})\\s+(\\d{1,2}:\\d{2}))?)?$"), SetDND},
+	}
+
+	// Responses receives events from devices when a subcommand is
+	// running, and is nil otherwise
+	Responses chan mutablehome.EcovacsEvent
+)
+
+/////////////////////////////////////////////////////////////////////
+
+func ExecuteSubcommand(app gopi.App, device mutablehome.EvovacsDevice, command string, args string) error {
+	for _, c := range Subcommands {
+		if c.Name == strings.ToLower(command) {
+			if args := c.Re.FindStringSubmatch(args); len(args) > 0 {
+				return c.Func(app, device, args[1:])
+			} else {
+				return fmt.Errorf("Syntax error: %s", c.Syntax)
+			}
+		}
+	}
+
+	// Return not found
+	return gopi.ErrNotFound.WithPrefix(command)
+}
+
+/////////////////////////////////////////////////////////////////////
+
+func ListSchedules(_ gopi.App, device mutablehome.EvovacsDevice, _ []string) error {
+	if _, err := device.GetSched(); err != nil {
+		return err
+	} else if evt, err := WaitForResponse(device, mutablehome.ECOVACS_EVENT_SCHEDULE); err != nil {
+		return err
+	} else {
+		PrintSchedules(evt.Value().([]mutablehome.EcovacsSchedule))
+	}
+
+	// Success
+	return nil
+}
+
+func SetSchedule(app gopi.App, device mutablehome.EvovacsDevice, args []string) error {
+	if schedule, err := ParseSchedule(ScheduleCommand{
+		Name:    args[0],
+		Time:    args[1],
+		Days:    args[2],
+		Mode:    args[3],
+		Suction: args[4],
+	}); err != nil {
+		return err
+	} else if _, err := device.SetSched(schedule); err != nil {
+		return err
+	}
+
+	// Schedules are fetched once the change is acknowledged
+	if evt, err := WaitForResponse(device, mutablehome.ECOVACS_EVENT_SCHEDULE); err != nil {
+		return err
+	} else {
+		PrintSchedules(evt.Value().([]mutablehome.EcovacsSchedule))
+	}
+
+	// Success
+	return nil
+}
+
+func DeleteSchedule(app gopi.App, device mutablehome.EvovacsDevice, args []string) error {
+	if _, err := device.DelSched(args[0]); err != nil {
+		return err
+	} else if evt, err := WaitForResponse(device, mutablehome.ECOVACS_EVENT_SCHEDULE); err != nil {
+		return err
+	} else {
+		PrintSchedules(evt.Value().([]mutablehome.EcovacsSchedule))
+	}
+
+	// Success
+	return nil
+}
+
+func SetDND(app gopi.App, device mutablehome.EvovacsDevice, args []string) error {
+	// Fetch current value
+	if _, err := device.GetBlockTime(); err != nil {
+		return err
+	}
+	evt, err := WaitForResponse(device, mutablehome.ECOVACS_EVENT_DND)
+	if err != nil {
+		return err
+	}
+
+	// Set new value
+	if args[0] != "" {
+		if dnd, err := ParseDND(evt.Value().(mutablehome.EcovacsDND), DNDCommand{
+			Enabled: args[0] == "on",
+			Start:   args[1],
+			End:     args[2],
+		}); err != nil {
+			return err
+		} else if _, err := device.SetBlockTime(dnd); err != nil {
+			return err
+		} else if evt, err = WaitForResponse(device, mutablehome.ECOVACS_EVENT_DND); err != nil {
+			return err
+		}
+	}
+
+	// Print value
+	dnd := evt.Value().(mutablehome.EcovacsDND)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Enabled", "Start", "End"})
+	table.Append([]string{fmt.Sprint(dnd.Enabled), ecovacs.FormatTimeOfDay(dnd.Start), ecovacs.FormatTimeOfDay(dnd.End)})
+	table.Render()
+
+	// Success
+	return nil
+}
+
+func ResetLifeSpan(app gopi.App, device mutablehome.EvovacsDevice, args []string) error {
+	part, err := ParsePart(args[0])
+	if err != nil {
+		return err
+	} else if _, err := device.ResetLifeSpan(part); err != nil {
+		return err
+	}
+
+	// Lifespans are fetched once the reset is acknowledged
+	for {
+		if evt, err := WaitForResponse(device, mutablehome.ECOVACS_EVENT_LIFESPAN); err != nil {
+			return err
+		} else if values := evt.Value().([]interface{}); values[0] == part {
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Part", "Lifespan"})
+			table.Append([]string{string(part), fmt.Sprintf("%.0f%%", float32(values[1].(uint))*100.0/float32(values[2].(uint)))})
+			table.Render()
+			return nil
+		}
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+
+func PrintSchedules(schedules []mutablehome.EcovacsSchedule) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Enabled", "Time", "Days", "Mode", "Suction"})
+	for _, schedule := range schedules {
+		table.Append([]string{
+			schedule.Name,
+			fmt.Sprint(schedule.Enabled),
+			ecovacs.FormatTimeOfDay(schedule.Time),
+			ecovacs.FormatWeekdays(schedule.Days),
+			string(schedule.Mode),
+			string(schedule.Suction),
+		})
+	}
+	table.Render()
+}
+
+// WaitForResponse waits for an event of a type from a device, or an
+// error event, and returns an error on timeout
+func WaitForResponse(device mutablehome.EvovacsDevice, t mutablehome.EcovacsEventType) (mutablehome.EcovacsEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RESPONSE_TIMEOUT)
+	defer cancel()
+	for {
+		select {
+		case evt := <-Responses:
+			if evt.Device().Id() != device.Id() {
+				continue
+			} else if evt.Type() == t {
+				return evt, nil
+			} else if evt.Type() == mutablehome.ECOVACS_EVENT_ERROR {
+				if value := evt.Value().(mutablehome.EcovacsError); value.Severity != mutablehome.ECOVACS_SEVERITY_NONE {
+					return nil, fmt.Errorf("%v (Error %v)", value.Description, value.Code)
+				}
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%v: %w", t, ctx.Err())
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/djthorpe/gopi/v2"
 	"github.com/djthorpe/mosquitto"
 	"github.com/djthorpe/mutablehome"
+	"github.com/djthorpe/mutablehome/unit/ecovacs"
 )
 
 /////////////////////////////////////////////////////////////////////
@@ -21,26 +22,92 @@ const (
 	MQTT_TOPIC_CLEANSTATE   = "%v/%v/cleanstate"
 	MQTT_TOPIC_CHARGESTATE  = "%v/%v/chargestate"
 	MQTT_TOPIC_LIFESPAN     = "%v/%v/lifespan"
+	MQTT_TOPIC_SCHEDULES    = "%v/%v/schedules"
+	MQTT_TOPIC_DND          = "%v/%v/dnd"
+	MQTT_TOPIC_ERROR        = "%v/%v/error"
+	MQTT_TOPIC_ALERT        = "%v/%v/alert"
 )
 
 var (
 	Events = []gopi.EventHandler{
 		gopi.EventHandler{Name: "ecovacs.Event", Handler: PrintEvovacsEvent},
 		gopi.EventHandler{Name: "ecovacs.Event", Handler: PublishEvovacsEvent},
+		gopi.EventHandler{Name: "ecovacs.Event", Handler: RenderEvovacsMap},
+		gopi.EventHandler{Name: "ecovacs.Event", Handler: ForwardEvovacsEvent},
 		gopi.EventHandler{Name: "mosquitto.Event", Handler: PrintMQTTEvent},
 		gopi.EventHandler{Name: "mosquitto.Event", Handler: SubscribeMQTTEvent},
 		gopi.EventHandler{Name: "mosquitto.Event", Handler: MessageMQTTEvent},
 	}
-	Header sync.Once
+	Header  sync.Once
+	Windows = &DNDWindows{dnd: make(map[string]mutablehome.EcovacsDND)}
 )
 
 /////////////////////////////////////////////////////////////////////
 
 type Command struct {
+	Mode     string           `json:"mode"`
+	Suction  string           `json:"suction"`
+	Schedule *ScheduleCommand `json:"schedule,omitempty"`
+	DND      *DNDCommand      `json:"dnd,omitempty"`
+	Reset    string           `json:"reset,omitempty"`
+}
+
+// ScheduleCommand adds, edits or deletes a schedule on the robot. Days
+// is a comma-separated list of days, or daily, weekdays, weekends or once
+type ScheduleCommand struct {
+	Name     string `json:"name"`
+	Time     string `json:"time"`
+	Days     string `json:"days"`
+	Mode     string `json:"mode"`
+	Suction  string `json:"suction"`
+	Disabled bool   `json:"disabled"`
+	Delete   bool   `json:"delete"`
+}
+
+// DNDCommand sets the do-not-disturb window, which keeps the existing
+// start and end times when they are empty
+type DNDCommand struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// Schedule and DND are published as JSON
+type Schedule struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Time    string `json:"time"`
+	Days    string `json:"days"`
 	Mode    string `json:"mode"`
 	Suction string `json:"suction"`
 }
 
+type DND struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// DNDWindows holds the last do-not-disturb window for each device
+type DNDWindows struct {
+	sync.Mutex
+	dnd map[string]mutablehome.EcovacsDND
+}
+
+/////////////////////////////////////////////////////////////////////
+
+func (this *DNDWindows) Set(id string, dnd mutablehome.EcovacsDND) {
+	this.Lock()
+	defer this.Unlock()
+	this.dnd[id] = dnd
+}
+
+func (this *DNDWindows) Get(id string) mutablehome.EcovacsDND {
+	this.Lock()
+	defer this.Unlock()
+	return this.dnd[id]
+}
+
 /////////////////////////////////////////////////////////////////////
 
 // Print event header
@@ -96,6 +163,9 @@ func MessageMQTTEvent(_ context.Context, app gopi.App, evt_ gopi.Event) {
 
 // Print Ecovacs event
 func PrintEvovacsEvent(_ context.Context, _ gopi.App, evt_ gopi.Event) {
+	if Responses != nil {
+		return
+	}
 	PrintHeader()
 	evt := evt_.(mutablehome.EcovacsEvent)
 
@@ -106,6 +176,9 @@ func PrintEvovacsEvent(_ context.Context, _ gopi.App, evt_ gopi.Event) {
 
 // Publish Ecovacs event to MQTT as influx line protocol format
 func PublishEvovacsEvent(_ context.Context, app gopi.App, evt_ gopi.Event) {
+	if Responses != nil {
+		return
+	}
 	mqtt := app.UnitInstance("mosquitto").(mosquitto.Client)
 	evt := evt_.(mutablehome.EcovacsEvent)
 	topic := app.Flags().GetString("topic", gopi.FLAG_NS_DEFAULT)
@@ -157,11 +230,14 @@ func PublishEvovacsEvent(_ context.Context, app gopi.App, evt_ gopi.Event) {
 		}
 	case mutablehome.ECOVACS_EVENT_ERROR:
 		measurement := topic
-		topic := fmt.Sprintf(MQTT_TOPIC_CLEANSTATE, topic, evt.Device().Id())
-		values := evt.Value().([]interface{})
+		topic := fmt.Sprintf(MQTT_TOPIC_ERROR, topic, evt.Device().Id())
+		value := evt.Value().(mutablehome.EcovacsError)
 		fields := map[string]interface{}{
-			"err_num":         values[0].(uint),
-			"err_description": values[1].(string),
+			"err_num":         value.Code,
+			"err_name":        value.Name,
+			"err_description": value.Description,
+			"severity":        strings.ToLower(strings.TrimPrefix(fmt.Sprint(value.Severity), "ECOVACS_SEVERITY_")),
+			"condition":       strings.ToLower(strings.TrimPrefix(fmt.Sprint(value.Condition), "ECOVACS_CONDITION_")),
 		}
 		if _, err := mqtt.PublishInflux(topic, measurement, fields, opts...); err != nil {
 			app.Log().Error(err)
@@ -177,6 +253,57 @@ func PublishEvovacsEvent(_ context.Context, app gopi.App, evt_ gopi.Event) {
 		if _, err := mqtt.PublishInflux(topic, measurement, fields, opts...); err != nil {
 			app.Log().Error(err)
 		}
+	case mutablehome.ECOVACS_EVENT_LOWLIFESPAN:
+		// Alert when a consumable part falls below the lifespan threshold
+		measurement := topic
+		topic := fmt.Sprintf(MQTT_TOPIC_ALERT, topic, evt.Device().Id())
+		values := evt.Value().([]interface{})
+		opts = append(opts, mosquitto.OptTag("part", fmt.Sprint(values[0].(mutablehome.EcovacsPart))))
+		fields := map[string]interface{}{
+			"lifespan": float32(values[1].(uint)) * 100.0 / float32(values[2].(uint)),
+		}
+		if _, err := mqtt.PublishInflux(topic, measurement, fields, opts...); err != nil {
+			app.Log().Error(err)
+		}
+	case mutablehome.ECOVACS_EVENT_SCHEDULE:
+		topic := fmt.Sprintf(MQTT_TOPIC_SCHEDULES, topic, evt.Device().Id())
+		schedules := []Schedule{}
+		for _, schedule := range evt.Value().([]mutablehome.EcovacsSchedule) {
+			schedules = append(schedules, Schedule{
+				Name:    schedule.Name,
+				Enabled: schedule.Enabled,
+				Time:    ecovacs.FormatTimeOfDay(schedule.Time),
+				Days:    ecovacs.FormatWeekdays(schedule.Days),
+				Mode:    string(schedule.Mode),
+				Suction: string(schedule.Suction),
+			})
+		}
+		if _, err := mqtt.PublishJSON(topic, schedules, opts[0]); err != nil {
+			app.Log().Error(err)
+		}
+	case mutablehome.ECOVACS_EVENT_DND:
+		topic := fmt.Sprintf(MQTT_TOPIC_DND, topic, evt.Device().Id())
+		dnd := evt.Value().(mutablehome.EcovacsDND)
+		Windows.Set(evt.Device().Id(), dnd)
+		value := DND{
+			Enabled: dnd.Enabled,
+			Start:   ecovacs.FormatTimeOfDay(dnd.Start),
+			End:     ecovacs.FormatTimeOfDay(dnd.End),
+		}
+		if _, err := mqtt.PublishJSON(topic, value, opts[0]); err != nil {
+			app.Log().Error(err)
+		}
+	}
+}
+
+// Forward Ecovacs events to a running subcommand
+func ForwardEvovacsEvent(_ context.Context, _ gopi.App, evt_ gopi.Event) {
+	if Responses == nil {
+		return
+	}
+	select {
+	case Responses <- evt_.(mutablehome.EcovacsEvent):
+	default:
 	}
 }
 
@@ -185,6 +312,17 @@ func Execute(app gopi.App, topic string, command Command) error {
 
 	if device := DeviceForTopic(ecovacs, topic); device == nil {
 		return gopi.ErrNotFound.WithPrefix(topic)
+	} else if command.Schedule != nil {
+		return ExecuteSchedule(device, *command.Schedule)
+	} else if command.DND != nil {
+		return ExecuteDND(device, *command.DND)
+	} else if command.Reset != "" {
+		if part, err := ParsePart(command.Reset); err != nil {
+			return err
+		} else {
+			_, err := device.ResetLifeSpan(part)
+			return err
+		}
 	} else if charge := ParseChargeCommand(command); charge {
 		_, err := device.Charge()
 		return err
@@ -196,6 +334,30 @@ func Execute(app gopi.App, topic string, command Command) error {
 	}
 }
 
+func ExecuteSchedule(device mutablehome.EvovacsDevice, command ScheduleCommand) error {
+	if command.Delete {
+		_, err := device.DelSched(command.Name)
+		return err
+	} else if schedule, err := ParseSchedule(command); err != nil {
+		return err
+	} else {
+		_, err := device.SetSched(schedule)
+		return err
+	}
+}
+
+func ExecuteDND(device mutablehome.EvovacsDevice, command DNDCommand) error {
+	// Use the last published window when start and end are not set
+	if dnd, err := ParseDND(Windows.Get(device.Id()), command); err != nil {
+		return err
+	} else if dnd.Start == dnd.End && dnd.Enabled {
+		return gopi.ErrBadParameter.WithPrefix("start, end")
+	} else {
+		_, err := device.SetBlockTime(dnd)
+		return err
+	}
+}
+
 func DeviceForTopic(ecovacs mutablehome.Ecovacs, topic string) mutablehome.EvovacsDevice {
 	if parts := strings.Split(topic, "/"); len(parts) < 2 {
 		return nil
@@ -256,3 +418,63 @@ func ParseCleanCommand(command Command) (mutablehome.EcovacsCleanMode, mutableho
 	// Success
 	return mode, suction, nil
 }
+
+func ParsePart(value string) (mutablehome.EcovacsPart, error) {
+	switch strings.ToUpper(value) {
+	case "BRUSH":
+		return mutablehome.ECOVACS_PART_BRUSH, nil
+	case "SIDEBRUSH":
+		return mutablehome.ECOVACS_PART_SIDEBRUSH, nil
+	case "FILTER", "DUSTCASEHEAP":
+		return mutablehome.ECOVACS_PART_DUSTFILTER, nil
+	default:
+		return "", gopi.ErrBadParameter.WithPrefix(value)
+	}
+}
+
+func ParseSchedule(command ScheduleCommand) (mutablehome.EcovacsSchedule, error) {
+	schedule := mutablehome.EcovacsSchedule{
+		Name:    command.Name,
+		Enabled: command.Disabled == false,
+	}
+	if schedule.Name == "" {
+		return schedule, gopi.ErrBadParameter.WithPrefix("name")
+	} else if time, err := ecovacs.ParseTimeOfDay(command.Time); err != nil {
+		return schedule, err
+	} else if days, err := ecovacs.ParseWeekdays(command.Days); err != nil {
+		return schedule, err
+	} else if mode, suction, err := ParseCleanCommand(Command{Mode: command.Mode, Suction: command.Suction}); err != nil {
+		return schedule, err
+	} else if mode == mutablehome.ECOVACS_CLEAN_STOP {
+		return schedule, gopi.ErrBadParameter.WithPrefix(command.Mode)
+	} else {
+		schedule.Time = time
+		schedule.Days = days
+		schedule.Mode = mode
+		schedule.Suction = suction
+	}
+
+	// Success
+	return schedule, nil
+}
+
+func ParseDND(dnd mutablehome.EcovacsDND, command DNDCommand) (mutablehome.EcovacsDND, error) {
+	dnd.Enabled = command.Enabled
+	if command.Start != "" {
+		if start, err := ecovacs.ParseTimeOfDay(command.Start); err != nil {
+			return dnd, err
+		} else {
+			dnd.Start = start
+		}
+	}
+	if command.End != "" {
+		if end, err := ecovacs.ParseTimeOfDay(command.End); err != nil {
+			return dnd, err
+		} else {
+			dnd.End = end
+		}
+	}
+
+	// Success
+	return dnd, nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi/v2"
@@ -17,6 +18,19 @@ import (
 func Main(app gopi.App, args []string) error {
 	ecovacs := app.UnitInstance("ecovacs").(mutablehome.Ecovacs)
 	mqtt := app.UnitInstance("mosquitto").(mosquitto.Client)
+	metrics := app.UnitInstance("mutablehome/metrics").(mutablehome.Metrics)
+
+	// Publish consumable lifespan and errors
+	if source, ok := ecovacs.(mutablehome.MetricsSource); ok {
+		if err := metrics.AddSource(source); err != nil {
+			return err
+		}
+	}
+
+	// Run a subcommand against a single device
+	if len(args) > 0 {
+		return RunSubcommand(app, args)
+	}
 
 	if err := ecovacs.Authenticate(); err != nil {
 		return err
@@ -33,6 +47,11 @@ func Main(app gopi.App, args []string) error {
 			if err := ecovacs.Connect(device); err != nil {
 				return err
 			}
+			if app.Flags().GetString("map", gopi.FLAG_NS_DEFAULT) != "" {
+				if err := RequestMap(device); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
@@ -43,3 +62,46 @@ func Main(app gopi.App, args []string) error {
 	// Return success
 	return nil
 }
+
+// RunSubcommand connects to a device, runs a subcommand and then
+// disconnects
+func RunSubcommand(app gopi.App, args []string) error {
+	ecovacs := app.UnitInstance("ecovacs").(mutablehome.Ecovacs)
+
+	if err := ecovacs.Authenticate(); err != nil {
+		return err
+	} else if device, err := DeviceForFlag(app, ecovacs); err != nil {
+		return err
+	} else {
+		Responses = make(chan mutablehome.EcovacsEvent, RESPONSE_CAPACITY)
+		if err := ecovacs.Connect(device); err != nil {
+			return err
+		}
+		defer ecovacs.Disconnect(device)
+		return ExecuteSubcommand(app, device, args[0], strings.Join(args[1:], " "))
+	}
+}
+
+// DeviceForFlag returns the device with the id or nickname set by the
+// -device flag, which can be omitted when there is a single device
+func DeviceForFlag(app gopi.App, ecovacs mutablehome.Ecovacs) (mutablehome.EvovacsDevice, error) {
+	name := app.Flags().GetString("device", gopi.FLAG_NS_DEFAULT)
+	if devices, err := ecovacs.Devices(); err != nil {
+		return nil, err
+	} else if len(devices) == 0 {
+		return nil, errors.New("No ecovacs devices found")
+	} else if name == "" && len(devices) == 1 {
+		return devices[0], nil
+	} else if name == "" {
+		return nil, fmt.Errorf("%w: Use -device to select one of %v devices", gopi.ErrBadParameter, len(devices))
+	} else {
+		for _, device := range devices {
+			if device.Id() == name || strings.EqualFold(device.Nickname(), name) {
+				return device, nil
+			}
+		}
+	}
+
+	// Return not found
+	return nil, gopi.ErrNotFound.WithPrefix(name)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	// Frameworks
+	"github.com/djthorpe/gopi/v2"
+	"github.com/djthorpe/mutablehome"
+	"github.com/djthorpe/mutablehome/unit/ecovacs"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+const (
+	// Pixels per map cell in rendered maps
+	MAP_SCALE = 4
+)
+
+/////////////////////////////////////////////////////////////////////
+
+// Positions holds the last robot and charger position for each device
+type Positions struct {
+	sync.Mutex
+	robot, charger map[string]mutablehome.EcovacsPosition
+}
+
+var (
+	MapPositions = &Positions{
+		robot:   make(map[string]mutablehome.EcovacsPosition),
+		charger: make(map[string]mutablehome.EcovacsPosition),
+	}
+)
+
+/////////////////////////////////////////////////////////////////////
+
+// RequestMap requests the map and positions for a device, so that
+// the map can be rendered once all pieces have been received
+func RequestMap(device mutablehome.EvovacsDevice) error {
+	if _, err := device.GetChargerPos(); err != nil {
+		return err
+	} else if _, err := device.GetPos(); err != nil {
+		return err
+	} else if _, err := device.GetMapM(); err != nil {
+		return err
+	}
+
+	// Success
+	return nil
+}
+
+// RenderEvovacsMap writes the map for a device as PNG when the map or
+// positions change, if the -map flag is set
+func RenderEvovacsMap(_ context.Context, app gopi.App, evt_ gopi.Event) {
+	evt := evt_.(mutablehome.EcovacsEvent)
+	folder := app.Flags().GetString("map", gopi.FLAG_NS_DEFAULT)
+	if folder == "" || Responses != nil {
+		return
+	}
+
+	switch evt.Type() {
+	case mutablehome.ECOVACS_EVENT_POSITION, mutablehome.ECOVACS_EVENT_CHARGERPOSITION:
+		if position, ok := evt.Value().(mutablehome.EcovacsPosition); ok {
+			MapPositions.Set(evt.Device().Id(), evt.Type(), position)
+		}
+	case mutablehome.ECOVACS_EVENT_MAP, mutablehome.ECOVACS_EVENT_MAPPIECE:
+		// Render when map metadata or pieces are received
+	default:
+		return
+	}
+
+	// Render the map once all pieces have been received
+	if m := evt.Device().Map(); m != nil && m.Complete() {
+		path := filepath.Join(folder, evt.Device().Id()+".png")
+		robot, charger := MapPositions.Get(evt.Device().Id())
+		if err := WriteMap(path, m, robot, charger); err != nil {
+			app.Log().Error(err)
+		}
+	}
+}
+
+// WriteMap writes a map to a temporary file which replaces the file
+// at path, so that readers never see a partial image
+func WriteMap(path string, m mutablehome.EcovacsMap, robot, charger *mutablehome.EcovacsPosition) error {
+	tmp := path + ".tmp"
+	if fh, err := os.Create(tmp); err != nil {
+		return err
+	} else if err := ecovacs.WriteMapPNG(fh, m, MAP_SCALE, robot, charger); err != nil {
+		fh.Close()
+		os.Remove(tmp)
+		return err
+	} else if err := fh.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	} else {
+		return os.Rename(tmp, path)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+
+func (this *Positions) Set(id string, t mutablehome.EcovacsEventType, position mutablehome.EcovacsPosition) {
+	this.Lock()
+	defer this.Unlock()
+	if t == mutablehome.ECOVACS_EVENT_CHARGERPOSITION {
+		this.charger[id] = position
+	} else {
+		this.robot[id] = position
+	}
+}
+
+// Get returns the robot and charger positions for a device, which are
+// nil if not known
+func (this *Positions) Get(id string) (*mutablehome.EcovacsPosition, *mutablehome.EcovacsPosition) {
+	this.Lock()
+	defer this.Unlock()
+	var robot, charger *mutablehome.EcovacsPosition
+	if position, exists := this.robot[id]; exists {
+		robot = &position
+	}
+	if position, exists := this.charger[id]; exists {
+		charger = &position
+	}
+	return robot, charger
+}
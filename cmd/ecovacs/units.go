@@ -10,18 +10,23 @@ import (
 	// Units
 	_ "github.com/djthorpe/gopi/v2/unit/bus"
 	_ "github.com/djthorpe/gopi/v2/unit/logger"
+	_ "github.com/djthorpe/gopi/v2/unit/mdns"
 	_ "github.com/djthorpe/mosquitto/unit/mosquitto"
 	_ "github.com/djthorpe/mutablehome/unit/ecovacs"
+	_ "github.com/djthorpe/mutablehome/unit/httpd"
+	_ "github.com/djthorpe/mutablehome/unit/metrics"
 )
 
 /////////////////////////////////////////////////////////////////////
 
 func main() {
-	if app, err := app.NewCommandLineTool(Main, Events, "ecovacs", "mosquitto"); err != nil {
+	if app, err := app.NewCommandLineTool(Main, Events, "ecovacs", "mosquitto", "mutablehome/metrics"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	} else {
 		app.Flags().FlagString("topic", "ecovacs", "Root ecovacs topic")
 		app.Flags().FlagInt("qos", 1, "MQTT quality of service")
+		app.Flags().FlagString("map", "", "Folder for map images, which are written as <device>.png")
+		app.Flags().FlagString("device", "", "Device id or nickname for subcommands")
 		os.Exit(app.Run())
 	}
 }
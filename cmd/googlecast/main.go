@@ -85,11 +85,19 @@ func ExecuteCommand(app gopi.App, devices []mutablehome.CastDevice, command stri
 func Main(app gopi.App, args []string) error {
 	// Return devices
 	cast := app.UnitInstance("googlecast").(mutablehome.Cast)
+	metrics := app.UnitInstance("mutablehome/metrics").(mutablehome.Metrics)
 	timeout := app.Flags().GetDuration("timeout", gopi.FLAG_NS_DEFAULT)
 	uuid := app.Flags().GetString("id", gopi.FLAG_NS_DEFAULT)
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	// Publish volume and message counters
+	if source, ok := cast.(mutablehome.MetricsSource); ok {
+		if err := metrics.AddSource(source); err != nil {
+			return err
+		}
+	}
+
 	// Filter devices and either display them with no arguments or
 	// execute a command otherwise
 	if devices, err := cast.Devices(ctx); err != nil {
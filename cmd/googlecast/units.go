@@ -13,12 +13,14 @@ import (
 	_ "github.com/djthorpe/gopi/v2/unit/logger"
 	_ "github.com/djthorpe/gopi/v2/unit/mdns"
 	_ "github.com/djthorpe/mutablehome/unit/googlecast"
+	_ "github.com/djthorpe/mutablehome/unit/httpd"
+	_ "github.com/djthorpe/mutablehome/unit/metrics"
 )
 
 /////////////////////////////////////////////////////////////////////
 
 func main() {
-	if app, err := app.NewCommandLineTool(Main, Events, "googlecast"); err != nil {
+	if app, err := app.NewCommandLineTool(Main, Events, "googlecast", "mutablehome/metrics"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	} else {
 		app.Flags().FlagDuration("timeout", 500*time.Millisecond, "Discovery timeout")
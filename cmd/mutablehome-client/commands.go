@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+	tablewriter "github.com/olekukonko/tablewriter"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+type Command struct {
+	Name   string
+	Syntax string
+	Re     *regexp.Regexp
+	Func   func(gopi.App, mutablehome.NodeStub, []string) error
+}
+
+var (
+	Commands = []Command{
+		Command{"metadata", "metadata", regexp.MustCompile("^$"), Metadata},
+		Command{"devices", "devices", regexp.MustCompile("^$"), Devices},
+		Command{"device", "device <id>", regexp.MustCompile("^(\\S+)$"), Device},
+		Command{"on", "on <id>", regexp.MustCompile("^(\\S+)$"), PowerOn},
+		Command{"off", "off <id>", regexp.MustCompile("^(\\S+)$"), PowerOff},
+		Command{"toggle", "toggle <id>", regexp.MustCompile("^(\\S+)$"), PowerToggle},
+		Command{"brightness", "brightness <id> <0-100> [<transition>]", regexp.MustCompile("^(\\S+)\\s+(\\d+)(?:\\s+(\\S+))?$"), Brightness},
+		Command{"history", "history <id> <trait> [<duration>]", regexp.MustCompile("^(\\S+)\\s+(\\S+)(?:\\s+(\\S+))?$"), History},
+		Command{"watch", "watch", regexp.MustCompile("^$"), Watch},
+	}
+)
+
+/////////////////////////////////////////////////////////////////////
+
+func ExecuteCommand(app gopi.App, stub mutablehome.NodeStub, command string, args string) error {
+	for _, c := range Commands {
+		if c.Name == strings.ToLower(command) {
+			if args := c.Re.FindStringSubmatch(args); len(args) > 0 {
+				if c.Func != nil {
+					return c.Func(app, stub, args[1:])
+				} else {
+					return nil
+				}
+			} else {
+				return fmt.Errorf("Syntax error: %s", c.Syntax)
+			}
+		}
+	}
+
+	// Return not found
+	return gopi.ErrNotFound.WithPrefix(command)
+}
+
+/////////////////////////////////////////////////////////////////////
+
+func Metadata(app gopi.App, stub mutablehome.NodeStub, _ []string) error {
+	metadata, err := stub.Metadata(context.Background())
+	if err != nil {
+		return err
+	} else if JSON(app) {
+		return OutputJSON(NewMetadata(metadata))
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Append([]string{"Id", metadata.Id()})
+	table.Append([]string{"Name", metadata.Name()})
+	table.Append([]string{"Uptime", fmt.Sprint(metadata.Uptime().Truncate(time.Second))})
+	table.Render()
+	return nil
+}
+
+func Devices(app gopi.App, stub mutablehome.NodeStub, _ []string) error {
+	if devices, err := stub.Devices(context.Background()); err != nil {
+		return err
+	} else if JSON(app) {
+		return OutputJSON(NewDevices(devices))
+	} else {
+		OutputDevices(devices...)
+		return nil
+	}
+}
+
+func Device(app gopi.App, stub mutablehome.NodeStub, args []string) error {
+	if device, err := stub.Device(context.Background(), args[0]); err != nil {
+		return err
+	} else {
+		return OutputDevice(app, device)
+	}
+}
+
+func PowerOn(app gopi.App, stub mutablehome.NodeStub, args []string) error {
+	if device, err := stub.SetPower(context.Background(), args[0], mutablehome.TRAIT_POWER_ON); err != nil {
+		return err
+	} else {
+		return OutputDevice(app, device)
+	}
+}
+
+func PowerOff(app gopi.App, stub mutablehome.NodeStub, args []string) error {
+	if device, err := stub.SetPower(context.Background(), args[0], mutablehome.TRAIT_POWER_OFF); err != nil {
+		return err
+	} else {
+		return OutputDevice(app, device)
+	}
+}
+
+func PowerToggle(app gopi.App, stub mutablehome.NodeStub, args []string) error {
+	if device, err := stub.SetPower(context.Background(), args[0], mutablehome.TRAIT_POWER_TOGGLE); err != nil {
+		return err
+	} else {
+		return OutputDevice(app, device)
+	}
+}
+
+func Brightness(app gopi.App, stub mutablehome.NodeStub, args []string) error {
+	transition := time.Duration(0)
+	value, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return err
+	} else if value > 100 {
+		return gopi.ErrBadParameter.WithPrefix("brightness")
+	} else if args[2] != "" {
+		if transition, err = time.ParseDuration(args[2]); err != nil {
+			return gopi.ErrBadParameter.WithPrefix("transition")
+		}
+	}
+
+	// Scale 0-100 to 0.0-1.0
+	if device, err := stub.SetBrightness(context.Background(), args[0], float32(value)/100, transition); err != nil {
+		return err
+	} else {
+		return OutputDevice(app, device)
+	}
+}
+
+// History returns values recorded for a device trait, for the last
+// 24 hours unless a duration is set
+func History(app gopi.App, stub mutablehome.NodeStub, args []string) error {
+	from := 24 * time.Hour
+	trait, err := ParseTrait(args[1])
+	if err != nil {
+		return err
+	} else if args[2] != "" {
+		if from, err = time.ParseDuration(args[2]); err != nil || from <= 0 {
+			return gopi.ErrBadParameter.WithPrefix("duration")
+		}
+	}
+
+	values, err := stub.History(context.Background(), args[0], trait, time.Now().Add(-from), time.Time{})
+	if err != nil {
+		return err
+	} else if JSON(app) {
+		return OutputJSON(NewValues(values))
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Time", "Trait", "Value"})
+	for _, value := range values {
+		row := []string{
+			value.Time().Local().Format(time.RFC3339),
+			strings.TrimPrefix(fmt.Sprint(value.Trait()), "TRAIT_"),
+			fmt.Sprintf("%.0f%%", value.Value()*100),
+		}
+		switch value.Trait() {
+		case mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_POWER_STANDBY, mutablehome.TRAIT_SENSOR_ACTIVITY:
+			// Value is not meaningful
+			row[2] = "-"
+		}
+		table.Append(row)
+	}
+	table.Render()
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+
+// JSON returns true if output should be JSON rather than a table
+func JSON(app gopi.App) bool {
+	return app.Flags().GetBool("json", gopi.FLAG_NS_DEFAULT)
+}
+
+// OutputDevice outputs a device returned from the remote node
+func OutputDevice(app gopi.App, device mutablehome.RemoteDevice) error {
+	if JSON(app) {
+		return OutputJSON(NewDevice(device))
+	} else {
+		OutputDevices(device)
+		return nil
+	}
+}
+
+// OutputDevices renders devices in a table
+func OutputDevices(devices ...mutablehome.RemoteDevice) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Id", "Name", "Traits", "Power", "Brightness", "Position", "Battery"})
+	for _, device := range devices {
+		table.Append([]string{
+			device.Id(),
+			device.Name(),
+			FormatTraits(device.Traits()),
+			FormatPower(device),
+			FormatLevel(device, mutablehome.TRAIT_LIGHT_BRIGHTNESS, device.Brightness()),
+			FormatLevel(device, mutablehome.TRAIT_COVER_POSITION, device.Position()),
+			FormatLevel(device, mutablehome.TRAIT_BATTERY_LEVEL, device.BatteryLevel()),
+		})
+	}
+	table.Render()
+}
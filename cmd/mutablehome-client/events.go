@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+var (
+	Header sync.Once
+	Format = "%-25v %-15v %-25v %s\n"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+func Watch(app gopi.App, stub mutablehome.NodeStub, _ []string) error {
+	var wg sync.WaitGroup
+
+	// Print events as they are emitted
+	evts := stub.Subscribe()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for evt := range evts {
+			PrintEvent(app, evt)
+		}
+	}()
+
+	// Stream events in the background, and cancel waiting if the
+	// stream ends
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- stub.StreamEvents(ctx, nil, nil)
+		cancel()
+	}()
+
+	// Wait for CTRL+C
+	fmt.Fprintln(os.Stderr, "Press CTRL+C to end")
+	app.WaitForSignal(ctx, os.Interrupt)
+
+	// Cancel streaming and wait for printing to end
+	cancel()
+	err := <-errs
+	stub.Unsubscribe(evts)
+	wg.Wait()
+
+	// Return any error from streaming
+	return err
+}
+
+/////////////////////////////////////////////////////////////////////
+
+// Print event header
+func PrintHeader() {
+	Header.Do(func() {
+		fmt.Printf(Format, "EVENT", "ID", "NAME", "VALUE")
+		fmt.Printf(Format, strings.Repeat("-", 25), strings.Repeat("-", 15), strings.Repeat("-", 25), strings.Repeat("-", 25))
+	})
+}
+
+// PrintEvent prints an event which has been emitted from the remote
+// node, as a line of JSON or a row of text
+func PrintEvent(app gopi.App, value interface{}) {
+	evt, ok := value.(mutablehome.RemoteEvent)
+	if ok == false {
+		return
+	}
+	if JSON(app) {
+		if data, err := json.Marshal(NewEvent(evt)); err == nil {
+			fmt.Println(string(data))
+		}
+		return
+	}
+	PrintHeader()
+	etype := strings.TrimPrefix(fmt.Sprint(evt.Type()), "EVENT_")
+	if device, ok := evt.Device().(mutablehome.RemoteDevice); ok == false {
+		fmt.Printf(Format, etype, evt.NodeId(), "", "")
+	} else {
+		value := FormatPower(device)
+		if HasTrait(device, mutablehome.TRAIT_LIGHT_BRIGHTNESS) {
+			value += " brightness=" + FormatLevel(device, mutablehome.TRAIT_LIGHT_BRIGHTNESS, device.Brightness())
+		}
+		if HasTrait(device, mutablehome.TRAIT_COVER_POSITION) {
+			value += " position=" + FormatLevel(device, mutablehome.TRAIT_COVER_POSITION, device.Position())
+		}
+		if HasTrait(device, mutablehome.TRAIT_BATTERY_LEVEL) {
+			value += " battery=" + FormatLevel(device, mutablehome.TRAIT_BATTERY_LEVEL, device.BatteryLevel())
+		}
+		if traits := evt.Traits(); len(traits) > 0 {
+			value += " changed=" + strings.Join(TraitNames(traits), ",")
+		}
+		fmt.Printf(Format, etype, device.Id(), device.Name(), value)
+	}
+}
@@ -13,56 +13,105 @@ import (
 	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	// Frameworks
-
 	gopi "github.com/djthorpe/gopi/v2"
 	app "github.com/djthorpe/gopi/v2/app"
 	mutablehome "github.com/djthorpe/mutablehome"
 
 	// Units
-	_ "github.com/djthorpe/gopi-rpc/v2/grpc/gaffer"
 	_ "github.com/djthorpe/gopi-rpc/v2/unit/grpc"
 	_ "github.com/djthorpe/gopi/v2/unit/logger"
 	_ "github.com/djthorpe/gopi/v2/unit/mdns"
 	_ "github.com/djthorpe/mutablehome/grpc/mutablehome"
 )
 
+////////////////////////////////////////////////////////////////////////////////
+// GLOBAL VARIABLES
+
+const (
+	MUTABLEHOME_MDNS_TIMEOUT = 2 * time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVICE DISCOVERY
+
+func Services(app gopi.App) ([]gopi.RPCServiceRecord, error) {
+	clientpool := app.UnitInstance("clientpool").(gopi.RPCClientPool)
+	ctx, cancel := context.WithTimeout(context.Background(), MUTABLEHOME_MDNS_TIMEOUT)
+	defer cancel()
+	return clientpool.Lookup(ctx, mutablehome.SERVICE_TYPE_NODE, 0)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // CONNECT
 
-func ConnectAddrPort(app gopi.App, addr, port string) (gopi.RPCClientConn, error) {
+func ConnectService(app gopi.App, service gopi.RPCServiceRecord) (gopi.RPCClientConn, error) {
 	clientpool := app.UnitInstance("clientpool").(gopi.RPCClientPool)
-	if port_, err := strconv.ParseInt(port, 10, 32); err != nil {
-		return nil, gopi.ErrBadParameter.WithPrefix("-addr")
-	} else if addr_ := net.ParseIP(addr); addr_ == nil {
+	return clientpool.Connect(service, gopi.RPC_FLAG_INET_V4|gopi.RPC_FLAG_INET_V6)
+}
+
+func ConnectHostPort(app gopi.App, host, port string) (gopi.RPCClientConn, error) {
+	if port_, err := strconv.ParseUint(port, 10, 16); err != nil {
 		return nil, gopi.ErrBadParameter.WithPrefix("-addr")
+	} else if addrs, err := net.LookupIP(host); err != nil {
+		return nil, err
 	} else {
-		return clientpool.ConnectAddr(addr_, uint16(port_))
+		return ConnectService(app, gopi.RPCServiceRecord{
+			Host:  host,
+			Port:  uint16(port_),
+			Addrs: addrs,
+		})
 	}
 }
 
-func ConnectStub(app gopi.App, addr string) (mutablehome.NodeStub, error) {
-	clientpool := app.UnitInstance("clientpool").(gopi.RPCClientPool)
-	if host, port, err := net.SplitHostPort(addr); err != nil {
+// ConnectName connects to a service discovered by mDNS, which matches
+// the name or host. When name is empty, exactly one service should
+// be discovered
+func ConnectName(app gopi.App, name string) (gopi.RPCClientConn, error) {
+	matched := make([]gopi.RPCServiceRecord, 0, 1)
+	if services, err := Services(app); err != nil {
 		return nil, err
-	} else if conn, err := ConnectAddrPort(app, host, port); err != nil {
-		return nil, err
-	} else if stub, ok := clientpool.CreateStub("mutablehome.Node", conn).(mutablehome.NodeStub); ok == false {
-		return nil, gopi.ErrInternalAppError.WithPrefix("CreateStub")
 	} else {
-		return stub, nil
+		for _, service := range services {
+			if name == "" || strings.EqualFold(service.Name, name) || strings.EqualFold(service.Host, name) {
+				matched = append(matched, service)
+			}
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("No mutablehome service found")
+	} else if len(matched) > 1 {
+		return nil, fmt.Errorf("More than one mutablehome service found, use -addr to select between them")
+	} else {
+		return ConnectService(app, matched[0])
 	}
 }
 
-////////////////////////////////////////////////////////////////////////////////
-// RUN COMMAND
+func ConnectStub(app gopi.App, addr string) (mutablehome.NodeStub, error) {
+	var conn gopi.RPCClientConn
+	var err error
 
-func Run(app gopi.App, stub mutablehome.NodeStub, args []string) (bool, error) {
-	fmt.Println("RUN", stub)
+	// Connect by host and port, or else by service name
+	if host, port, err_ := net.SplitHostPort(addr); err_ == nil {
+		conn, err = ConnectHostPort(app, host, port)
+	} else {
+		conn, err = ConnectName(app, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	// Success
-	return false, nil
+	// Create the stub
+	clientpool := app.UnitInstance("clientpool").(gopi.RPCClientPool)
+	if stub, ok := clientpool.CreateStub("mutablehome.Node", conn).(mutablehome.NodeStub); ok == false {
+		return nil, gopi.ErrInternalAppError.WithPrefix("CreateStub")
+	} else {
+		return stub, nil
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -70,30 +119,26 @@ func Run(app gopi.App, stub mutablehome.NodeStub, args []string) (bool, error) {
 
 func Main(app gopi.App, args []string) error {
 	addr := app.Flags().GetString("addr", gopi.FLAG_NS_DEFAULT)
-	if client, err := ConnectStub(app, addr); err != nil {
-		return err
-	} else if err := client.Ping(context.Background()); err != nil {
+	if stub, err := ConnectStub(app, addr); err != nil {
 		return err
-	} else if wait, err := Run(app, client, args); err != nil {
+	} else if err := stub.Ping(context.Background()); err != nil {
 		return err
-	} else if wait {
-		// Wait until CTRL+C pressed
-		fmt.Println("Press CTRL+C to exit")
-		app.WaitForSignal(context.Background(), os.Interrupt)
+	} else if len(args) == 0 {
+		return Devices(app, stub, nil)
+	} else {
+		return ExecuteCommand(app, stub, args[0], strings.Join(args[1:], " "))
 	}
-
-	// Return success
-	return nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // BOOTSTRAP
 
 func main() {
-	if app, err := app.NewCommandLineTool(Main, nil, "clientpool", "mutablehome.Node"); err != nil {
+	if app, err := app.NewCommandLineTool(Main, nil, "clientpool", "discovery", "mutablehome.Node"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	} else {
 		app.Flags().FlagString("addr", "", "Service address or name")
+		app.Flags().FlagBool("json", false, "Output JSON")
 
 		// Run and exit
 		os.Exit(app.Run())
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+type MetadataJSON struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Uptime string `json:"uptime"`
+}
+
+type DeviceJSON struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Traits     []string `json:"traits"`
+	Power      string   `json:"power,omitempty"`
+	Brightness *float32 `json:"brightness,omitempty"`
+	Position   *float32 `json:"position,omitempty"`
+	Battery    *float32 `json:"battery,omitempty"`
+}
+
+type EventJSON struct {
+	Type   string      `json:"type"`
+	Node   string      `json:"node,omitempty"`
+	Device *DeviceJSON `json:"device,omitempty"`
+	Traits []string    `json:"traits,omitempty"`
+}
+
+type ValueJSON struct {
+	Time  time.Time `json:"ts"`
+	Trait string    `json:"trait"`
+	Value float32   `json:"value"`
+}
+
+/////////////////////////////////////////////////////////////////////
+// NEW
+
+func NewMetadata(metadata mutablehome.NodeMetadata) MetadataJSON {
+	return MetadataJSON{
+		Id:     metadata.Id(),
+		Name:   metadata.Name(),
+		Uptime: fmt.Sprint(metadata.Uptime().Truncate(time.Second)),
+	}
+}
+
+func NewDevices(devices []mutablehome.RemoteDevice) []*DeviceJSON {
+	reply := make([]*DeviceJSON, len(devices))
+	for i, device := range devices {
+		reply[i] = NewDevice(device)
+	}
+	return reply
+}
+
+// NewDevice returns a device with values for the traits it has
+func NewDevice(device mutablehome.RemoteDevice) *DeviceJSON {
+	reply := &DeviceJSON{
+		Id:     device.Id(),
+		Name:   device.Name(),
+		Traits: TraitNames(device.Traits()),
+	}
+	if power := device.Power(); power != mutablehome.TRAIT_NONE {
+		reply.Power = strings.TrimPrefix(fmt.Sprint(power), "TRAIT_POWER_")
+	}
+	if HasTrait(device, mutablehome.TRAIT_LIGHT_BRIGHTNESS) {
+		value := device.Brightness()
+		reply.Brightness = &value
+	}
+	if HasTrait(device, mutablehome.TRAIT_COVER_POSITION) {
+		value := device.Position()
+		reply.Position = &value
+	}
+	if HasTrait(device, mutablehome.TRAIT_BATTERY_LEVEL) {
+		value := device.BatteryLevel()
+		reply.Battery = &value
+	}
+	return reply
+}
+
+func NewEvent(evt mutablehome.RemoteEvent) *EventJSON {
+	reply := &EventJSON{
+		Type:   strings.TrimPrefix(fmt.Sprint(evt.Type()), "EVENT_"),
+		Node:   evt.NodeId(),
+		Traits: TraitNames(evt.Traits()),
+	}
+	if device, ok := evt.Device().(mutablehome.RemoteDevice); ok {
+		reply.Device = NewDevice(device)
+	}
+	return reply
+}
+
+func NewValues(values []mutablehome.StoreValue) []*ValueJSON {
+	reply := make([]*ValueJSON, len(values))
+	for i, value := range values {
+		reply[i] = &ValueJSON{
+			Time:  value.Time(),
+			Trait: strings.TrimPrefix(fmt.Sprint(value.Trait()), "TRAIT_"),
+			Value: value.Value(),
+		}
+	}
+	return reply
+}
+
+/////////////////////////////////////////////////////////////////////
+// OUTPUT
+
+// OutputJSON writes a value as indented JSON
+func OutputJSON(value interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(value)
+}
+
+// HasTrait returns true if a device has a trait
+func HasTrait(device mutablehome.Device, trait mutablehome.TraitType) bool {
+	for _, t := range device.Traits() {
+		if t == trait {
+			return true
+		}
+	}
+	return false
+}
+
+// TraitNames returns traits without the TRAIT_ prefix
+func TraitNames(traits []mutablehome.TraitType) []string {
+	names := make([]string, len(traits))
+	for i, trait := range traits {
+		names[i] = strings.TrimPrefix(fmt.Sprint(trait), "TRAIT_")
+	}
+	return names
+}
+
+// ParseTrait returns a trait with or without the TRAIT_ prefix
+func ParseTrait(value string) (mutablehome.TraitType, error) {
+	for t := mutablehome.TRAIT_NONE; t <= mutablehome.TRAIT_MAX; t++ {
+		if strings.EqualFold(value, fmt.Sprint(t)) || strings.EqualFold("TRAIT_"+value, fmt.Sprint(t)) {
+			return t, nil
+		}
+	}
+	return mutablehome.TRAIT_NONE, gopi.ErrBadParameter.WithPrefix(value)
+}
+
+func FormatTraits(traits []mutablehome.TraitType) string {
+	return strings.Join(TraitNames(traits), ", ")
+}
+
+func FormatPower(device mutablehome.RemoteDevice) string {
+	if power := device.Power(); power == mutablehome.TRAIT_NONE {
+		return "-"
+	} else {
+		return strings.TrimPrefix(fmt.Sprint(power), "TRAIT_POWER_")
+	}
+}
+
+// FormatLevel returns a value between 0.0 and 1.0 as a percentage, or
+// a dash if the device doesn't have the trait
+func FormatLevel(device mutablehome.RemoteDevice, trait mutablehome.TraitType, value float32) string {
+	if HasTrait(device, trait) == false {
+		return "-"
+	} else {
+		return fmt.Sprintf("%.0f%%", value*100)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+	Mutablehome Automation
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	// Frameworks
+	app "github.com/djthorpe/gopi-rpc/v2/app"
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+	influxdb "github.com/djthorpe/mutablehome/sys/influxdb"
+
+	// Units
+	_ "github.com/djthorpe/gopi-rpc/v2/unit/grpc"
+	_ "github.com/djthorpe/gopi/v2/unit/bus"
+	_ "github.com/djthorpe/gopi/v2/unit/logger"
+	_ "github.com/djthorpe/gopi/v2/unit/mdns"
+	_ "github.com/djthorpe/mutablehome/grpc/mutablehome"
+	_ "github.com/djthorpe/mutablehome/unit/httpd"
+	_ "github.com/djthorpe/mutablehome/unit/hub"
+	_ "github.com/djthorpe/mutablehome/unit/metrics"
+	_ "github.com/djthorpe/mutablehome/unit/rules"
+	_ "github.com/djthorpe/mutablehome/unit/scheduler"
+	_ "github.com/djthorpe/mutablehome/unit/store"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// MAIN
+
+func Main(app gopi.App, args []string) error {
+	// Don't allow any arguments
+	if len(args) != 0 {
+		return fmt.Errorf("Arguments provided but not required")
+	}
+
+	// Hub, rules engine, scheduler, state store, metrics and RPC service
+	hub := app.UnitInstance("mutablehome/hub").(mutablehome.Hub)
+	rules := app.UnitInstance("mutablehome/rules").(mutablehome.Rules)
+	scheduler := app.UnitInstance("mutablehome/scheduler").(mutablehome.Scheduler)
+	store := app.UnitInstance("mutablehome/store").(mutablehome.Store)
+	metrics := app.UnitInstance("mutablehome/metrics").(mutablehome.Metrics)
+	service := app.UnitInstance("rpc/mutablehome/node").(mutablehome.RPCNodeService)
+
+	// Serve the hub, which connects to nodes as they are discovered,
+	// evaluate rules on events from the hub, run schedules on devices
+	// for the hub, record device state and publish metrics
+	if err := service.SetNode(hub); err != nil {
+		return err
+	} else if err := rules.AddNode(hub); err != nil {
+		return err
+	} else if err := scheduler.AddNode(hub); err != nil {
+		return err
+	} else if err := store.AddNode(hub); err != nil {
+		return err
+	} else if err := service.SetStore(store); err != nil {
+		return err
+	} else if err := metrics.AddNode(hub); err != nil {
+		return err
+	}
+
+	// Write device state to InfluxDB when a database or bucket is set
+	if exporter, err := NewInfluxDB(app); err != nil {
+		return err
+	} else if exporter != nil {
+		defer exporter.Close()
+		if err := exporter.AddNode(hub); err != nil {
+			return err
+		}
+	}
+
+	// Wait until CTRL+C pressed
+	fmt.Println("Press CTRL+C to exit")
+	app.WaitForSignal(context.Background(), os.Interrupt)
+
+	// Success
+	return nil
+}
+
+// NewInfluxDB returns an exporter for the -influxdb flags, or nil if
+// neither a database nor a bucket is set
+func NewInfluxDB(app gopi.App) (mutablehome.InfluxDB, error) {
+	config := influxdb.InfluxDB{
+		Addr:     app.Flags().GetString("influxdb.addr", gopi.FLAG_NS_DEFAULT),
+		Database: app.Flags().GetString("influxdb.db", gopi.FLAG_NS_DEFAULT),
+		Token:    app.Flags().GetString("influxdb.token", gopi.FLAG_NS_DEFAULT),
+		Org:      app.Flags().GetString("influxdb.org", gopi.FLAG_NS_DEFAULT),
+		Bucket:   app.Flags().GetString("influxdb.bucket", gopi.FLAG_NS_DEFAULT),
+	}
+	if config.Database == "" && config.Bucket == "" {
+		return nil, nil
+	} else if unit, err := gopi.New(config, app.Log().Clone(config.Name())); err != nil {
+		return nil, err
+	} else {
+		return unit.(mutablehome.InfluxDB), nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BOOTSTRAP
+
+func main() {
+	if app, err := app.NewServer(Main, "rpc/mutablehome/node", "mutablehome/hub", "mutablehome/rules", "mutablehome/scheduler", "mutablehome/store", "mutablehome/metrics", "register", "discovery"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		// -influxdb flags write device state to a database (1.x) or bucket (2.x)
+		app.Flags().FlagString("influxdb.addr", "http://localhost:8086/", "InfluxDB server address")
+		app.Flags().FlagString("influxdb.db", "", "InfluxDB database name (1.x)")
+		app.Flags().FlagString("influxdb.token", "", "InfluxDB token for authentication (2.x)")
+		app.Flags().FlagString("influxdb.org", "", "InfluxDB organization name (2.x)")
+		app.Flags().FlagString("influxdb.bucket", "", "InfluxDB bucket name (2.x)")
+		// Run and exit
+		os.Exit(app.Run())
+	}
+}
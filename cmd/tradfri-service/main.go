@@ -12,13 +12,14 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"sync"
+	"strconv"
 	"time"
 
 	// Frameworks
 	app "github.com/djthorpe/gopi-rpc/v2/app"
 	gopi "github.com/djthorpe/gopi/v2"
 	mutablehome "github.com/djthorpe/mutablehome"
+	tradfri "github.com/djthorpe/mutablehome/unit/tradfri"
 
 	// Units
 	_ "github.com/djthorpe/gopi-rpc/v2/unit/grpc"
@@ -26,7 +27,9 @@ import (
 	_ "github.com/djthorpe/gopi/v2/unit/logger"
 	_ "github.com/djthorpe/gopi/v2/unit/mdns"
 	_ "github.com/djthorpe/mutablehome/grpc/mutablehome"
-	_ "github.com/djthorpe/mutablehome/unit/tradfri"
+	_ "github.com/djthorpe/mutablehome/unit/httpd"
+	_ "github.com/djthorpe/mutablehome/unit/metrics"
+	_ "github.com/djthorpe/mutablehome/unit/store"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -48,46 +51,33 @@ func Services(app gopi.App) ([]gopi.RPCServiceRecord, error) {
 	return discovery.Lookup(ctx, TRADFRI_MDNS_SERVICE)
 }
 
-////////////////////////////////////////////////////////////////////////////////
-// OBSERVE DEVICES
-
-func ObserveDevices(app gopi.App, tradfri mutablehome.Ikea) (*sync.WaitGroup, []context.CancelFunc, error) {
-	wg := new(sync.WaitGroup)
-	if devices, err := tradfri.Devices(); err != nil {
-		return nil, nil, err
-	} else {
-		cancels := make([]context.CancelFunc, 0, len(devices))
-		for _, device := range devices {
-			ctx, cancel := context.WithCancel(context.Background())
-			wg.Add(1)
-			go func(device uint) {
-				if err := tradfri.ObserveDevice(ctx, device); err != nil && err != context.Canceled && err != context.DeadlineExceeded {
-					app.Log().Error(err)
-				}
-				wg.Done()
-			}(device)
-			cancels = append(cancels, cancel)
-		}
-		return wg, cancels, nil
-	}
-}
-
 ////////////////////////////////////////////////////////////////////////////////
 // CONNECT METHODS
 
-func ConnectService(app gopi.App, tradfri mutablehome.Ikea, service gopi.RPCServiceRecord) error {
-	if err := tradfri.Connect(service, gopi.RPC_FLAG_INET_V4|gopi.RPC_FLAG_INET_V6); err != nil {
+func ConnectService(app gopi.App, node tradfri.Node, service gopi.RPCServiceRecord) error {
+	if err := node.Connect(service, gopi.RPC_FLAG_INET_V4|gopi.RPC_FLAG_INET_V6); err != nil {
 		return err
 	} else {
 		return nil
 	}
 }
 
-func ConnectHostPort(_ gopi.App, tradfri mutablehome.Ikea, host, port string) error {
-	return gopi.ErrNotImplemented
+func ConnectHostPort(app gopi.App, node tradfri.Node, host, port string) error {
+	if port_, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return gopi.ErrBadParameter.WithPrefix("-addr")
+	} else if addrs, err := net.LookupIP(host); err != nil {
+		return err
+	} else {
+		return ConnectService(app, node, gopi.RPCServiceRecord{
+			Name:  app.Flags().GetString("tradfri.id", gopi.FLAG_NS_DEFAULT),
+			Host:  host,
+			Port:  uint16(port_),
+			Addrs: addrs,
+		})
+	}
 }
 
-func ConnectNameAddr(app gopi.App, tradfri mutablehome.Ikea, addr string) error {
+func ConnectNameAddr(app gopi.App, node tradfri.Node, addr string) error {
 	matched := make([]gopi.RPCServiceRecord, 0, 1)
 	if services, err := Services(app); err != nil {
 		return err
@@ -108,11 +98,11 @@ func ConnectNameAddr(app gopi.App, tradfri mutablehome.Ikea, addr string) error
 	} else if len(matched) > 1 {
 		return fmt.Errorf("More than one Tradfri gateway found, use -addr to select between them")
 	} else {
-		return ConnectService(app, tradfri, matched[0])
+		return ConnectService(app, node, matched[0])
 	}
 }
 
-func Connect(app gopi.App, tradfri mutablehome.Ikea) error {
+func Connect(app gopi.App, node tradfri.Node) error {
 	if services, err := Services(app); err != nil {
 		return err
 	} else if len(services) == 0 {
@@ -120,7 +110,7 @@ func Connect(app gopi.App, tradfri mutablehome.Ikea) error {
 	} else if len(services) > 1 {
 		return fmt.Errorf("More than one Tradfri gateway found, use -addr to select between them")
 	} else {
-		return ConnectService(app, tradfri, services[0])
+		return ConnectService(app, node, services[0])
 	}
 }
 
@@ -133,39 +123,44 @@ func Main(app gopi.App, args []string) error {
 		return fmt.Errorf("Arguments provided but not required")
 	}
 
-	// Tradfri unit
-	tradfri := app.UnitInstance("tradfri").(mutablehome.Ikea)
+	// Tradfri node, state store, metrics and RPC service
+	node := app.UnitInstance("mutablehome/tradfri/node").(tradfri.Node)
+	store := app.UnitInstance("mutablehome/store").(mutablehome.Store)
+	metrics := app.UnitInstance("mutablehome/metrics").(mutablehome.Metrics)
+	service := app.UnitInstance("rpc/mutablehome/node").(mutablehome.RPCNodeService)
+
+	// Serve the node, which observes devices once connected, record
+	// device state and publish metrics for the node and gateway
+	if err := service.SetNode(node); err != nil {
+		return err
+	} else if err := store.AddNode(node); err != nil {
+		return err
+	} else if err := service.SetStore(store); err != nil {
+		return err
+	} else if err := metrics.AddNode(node); err != nil {
+		return err
+	} else if gateway, ok := app.UnitInstance("mutablehome/tradfri/gateway").(mutablehome.MetricsSource); ok {
+		if err := metrics.AddSource(gateway); err != nil {
+			return err
+		}
+	}
 
 	// Connect to Tradfri
 	if addr := app.Flags().GetString("addr", gopi.FLAG_NS_DEFAULT); addr != "" {
 		if host, port, err := net.SplitHostPort(addr); err == nil {
-			if err := ConnectHostPort(app, tradfri, host, port); err != nil {
+			if err := ConnectHostPort(app, node, host, port); err != nil {
 				return err
 			}
-		} else if err := ConnectNameAddr(app, tradfri, addr); err != nil {
+		} else if err := ConnectNameAddr(app, node, addr); err != nil {
 			return err
 		}
-	} else if err := Connect(app, tradfri); err != nil {
+	} else if err := Connect(app, node); err != nil {
 		return err
 	}
 
-	// Observe all the devices so we can receive events from them
-	if wg, cancels, err := ObserveDevices(app, tradfri); err != nil {
-		return err
-	} else {
-		// Wait until CTRL+C pressed
-		fmt.Println("Press CTRL+C to exit")
-		app.WaitForSignal(context.Background(), os.Interrupt)
-
-		// Cancel observing devices and wait until done
-		for _, cancel := range cancels {
-			cancel()
-		}
-		wg.Wait()
-	}
-
-	// Disconnect
-	tradfri.Disconnect()
+	// Wait until CTRL+C pressed
+	fmt.Println("Press CTRL+C to exit")
+	app.WaitForSignal(context.Background(), os.Interrupt)
 
 	// Success
 	return nil
@@ -175,7 +170,7 @@ func Main(app gopi.App, args []string) error {
 // BOOTSTRAP
 
 func main() {
-	if app, err := app.NewServer(Main, "rpc/mutablehome/node", "mutablehome/node/tradfri", "register", "discovery"); err != nil {
+	if app, err := app.NewServer(Main, "rpc/mutablehome/node", "mutablehome/tradfri/node", "mutablehome/store", "mutablehome/metrics", "register", "discovery"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	} else {
 		// -addr is the address to a tradfri gateway
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	sim "github.com/djthorpe/mutablehome/unit/tradfri/sim"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+func Main(app gopi.App, args []string) error {
+	addr := app.Flags().GetString("addr", gopi.FLAG_NS_DEFAULT)
+	key := app.Flags().GetString("key", gopi.FLAG_NS_DEFAULT)
+	if len(args) != 0 {
+		return gopi.ErrHelp
+	} else if key == "" {
+		return gopi.ErrBadParameter.WithPrefix("-key")
+	}
+
+	// Start simulator
+	gateway, err := sim.New(addr, key)
+	if err != nil {
+		return err
+	}
+	defer gateway.Close()
+
+	// Add demo inventory
+	if err := Inventory(gateway); err != nil {
+		return err
+	}
+
+	// Wait for CTRL+C
+	fmt.Println("Serving", gateway)
+	fmt.Println("Press CTRL+C to end")
+	app.WaitForSignal(context.Background(), os.Interrupt)
+
+	// Return success
+	return nil
+}
+
+// Inventory adds lights, a plug, a blind and a remote in two rooms
+func Inventory(gateway *sim.Gateway) error {
+	devices := []string{
+		sim.Light(65536, "Ceiling", true, 200),
+		sim.Light(65537, "Floor Lamp", false, 100),
+		sim.Plug(65538, "Kettle", false),
+		sim.Light(65539, "Bedside", false, 50),
+		sim.Blind(65540, "Bedroom Blind", 0, 90),
+		sim.Remote(65541, "Remote", 60),
+		sim.Sensor(65542, "Hallway Sensor", 40),
+	}
+	for _, device := range devices {
+		if err := gateway.SetDevice(device); err != nil {
+			return err
+		}
+	}
+	if err := gateway.SetGroup(sim.Group(131073, "Living Room", 65536, 65537, 65538)); err != nil {
+		return err
+	} else if err := gateway.SetGroup(sim.Group(131074, "Bedroom", 65539, 65540)); err != nil {
+		return err
+	} else if err := gateway.SetScene(131073, sim.Scene(196608, "Relax", 80, 65536, 65537)); err != nil {
+		return err
+	} else if err := gateway.SetScene(131073, sim.Scene(196609, "Bright", 254, 65536, 65537)); err != nil {
+		return err
+	}
+
+	// Success
+	return nil
+}
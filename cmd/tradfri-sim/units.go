@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	// Frameworks
+	"github.com/djthorpe/gopi/v2/app"
+
+	// Units
+	_ "github.com/djthorpe/gopi/v2/unit/logger"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+func main() {
+	if app, err := app.NewCommandLineTool(Main, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		app.Flags().FlagString("addr", ":5684", "Simulator address")
+		app.Flags().FlagString("key", "", "Security code")
+		os.Exit(app.Run())
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+	tablewriter "github.com/olekukonko/tablewriter"
+)
+
+/////////////////////////////////////////////////////////////////////
+
+type Command struct {
+	Name   string
+	Syntax string
+	Re     *regexp.Regexp
+	Func   func(gopi.App, mutablehome.TradfriGateway, []string) error
+}
+
+const (
+	DEFAULT_PAIRING = time.Minute
+)
+
+var (
+	Commands = []Command{
+		Command{"devices", "devices", regexp.MustCompile("^$"), Devices},
+		Command{"groups", "groups", regexp.MustCompile("^$"), Groups},
+		Command{"scenes", "scenes", regexp.MustCompile("^$"), Scenes},
+		Command{"scene", "scene <scene>", regexp.MustCompile("^(\\d+)$"), ActivateScene},
+		Command{"on", "on <device|group>", regexp.MustCompile("^(\\d+)$"), PowerOn},
+		Command{"off", "off <device|group>", regexp.MustCompile("^(\\d+)$"), PowerOff},
+		Command{"brightness", "brightness <device|group> <0-100>", regexp.MustCompile("^(\\d+)\\s+(\\d+)$"), Brightness},
+		Command{"position", "position <blind> <0-100>", regexp.MustCompile("^(\\d+)\\s+(\\d+)$"), Position},
+		Command{"stop", "stop <blind>", regexp.MustCompile("^(\\d+)$"), Stop},
+		Command{"rename", "rename <device|group> <name>", regexp.MustCompile("^(\\d+)\\s+(.+)$"), Rename},
+		Command{"gateway", "gateway", regexp.MustCompile("^$"), Gateway},
+		Command{"reboot", "reboot", regexp.MustCompile("^$"), Reboot},
+		Command{"pair", "pair [<duration>]", regexp.MustCompile("^(\\S*)$"), Pair},
+		Command{"observe", "observe", regexp.MustCompile("^$"), Observe},
+	}
+)
+
+/////////////////////////////////////////////////////////////////////
+
+func ExecuteCommand(app gopi.App, tradfri mutablehome.TradfriGateway, command string, args string) error {
+	for _, c := range Commands {
+		if c.Name == strings.ToLower(command) {
+			if args := c.Re.FindStringSubmatch(args); len(args) > 0 {
+				if c.Func != nil {
+					return c.Func(app, tradfri, args[1:])
+				} else {
+					return nil
+				}
+			} else {
+				return fmt.Errorf("Syntax error: %s", c.Syntax)
+			}
+		}
+	}
+
+	// Return not found
+	return gopi.ErrNotFound.WithPrefix(command)
+}
+
+/////////////////////////////////////////////////////////////////////
+
+func Devices(_ gopi.App, tradfri mutablehome.TradfriGateway, _ []string) error {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Id", "Name", "Type", "Active", "Value"})
+	if devices, err := tradfri.Devices(); err != nil {
+		return err
+	} else {
+		for _, id := range devices {
+			if device, err := tradfri.Device(id); err != nil {
+				return err
+			} else {
+				value := ""
+				if lights := device.Lights(); len(lights) > 0 {
+					value = fmt.Sprint(lights)
+				} else if plugs := device.Plugs(); len(plugs) > 0 {
+					value = fmt.Sprint(plugs)
+				} else if blinds := device.Blinds(); len(blinds) > 0 {
+					value = fmt.Sprint(blinds)
+				}
+				if device.HasBattery() {
+					value = strings.TrimSpace(value + fmt.Sprintf(" battery=%v%%", device.BatteryLevel()))
+				}
+				table.Append([]string{
+					fmt.Sprint(device.Id()),
+					device.Name(),
+					strings.TrimPrefix(fmt.Sprint(device.Type()), "IKEA_DEVICE_TYPE_"),
+					fmt.Sprint(device.Active()),
+					value,
+				})
+			}
+		}
+	}
+	table.Render()
+	return nil
+}
+
+func Groups(_ gopi.App, tradfri mutablehome.TradfriGateway, _ []string) error {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Id", "Name", "Power", "Brightness", "Scene", "Devices"})
+	if groups, err := tradfri.Groups(); err != nil {
+		return err
+	} else {
+		for _, id := range groups {
+			if group, err := tradfri.Group(id); err != nil {
+				return err
+			} else {
+				members := make([]string, 0, len(group.Devices()))
+				for _, member := range group.Devices() {
+					if device, err := tradfri.Device(member); err != nil {
+						members = append(members, fmt.Sprint(member))
+					} else {
+						members = append(members, device.Name())
+					}
+				}
+				table.Append([]string{
+					fmt.Sprint(group.Id()),
+					group.Name(),
+					fmt.Sprint(group.Power()),
+					fmt.Sprint(group.Brightness()),
+					fmt.Sprint(group.Scene()),
+					strings.Join(members, ", "),
+				})
+			}
+		}
+	}
+	table.Render()
+	return nil
+}
+
+func Scenes(_ gopi.App, tradfri mutablehome.TradfriGateway, _ []string) error {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Id", "Name", "Group", "Devices"})
+	if scenes, err := AllScenes(tradfri); err != nil {
+		return err
+	} else {
+		for _, scene := range scenes {
+			table.Append([]string{
+				fmt.Sprint(scene.Id()),
+				scene.Name(),
+				fmt.Sprint(scene.Group()),
+				fmt.Sprint(len(scene.Devices())),
+			})
+		}
+	}
+	table.Render()
+	return nil
+}
+
+func ActivateScene(_ gopi.App, tradfri mutablehome.TradfriGateway, args []string) error {
+	if id, err := strconv.ParseUint(args[0], 10, 32); err != nil {
+		return gopi.ErrBadParameter.WithPrefix("scene")
+	} else if scenes, err := AllScenes(tradfri); err != nil {
+		return err
+	} else {
+		for _, scene := range scenes {
+			if scene.Id() == uint(id) {
+				return tradfri.Send(scene.Activate())
+			}
+		}
+		return gopi.ErrNotFound.WithPrefix("scene")
+	}
+}
+
+func PowerOn(_ gopi.App, tradfri mutablehome.TradfriGateway, args []string) error {
+	return SendLights(tradfri, args[0], func(light mutablehome.TradfriLight) mutablehome.TradfriCommand {
+		return light.SetPower(true)
+	}, func(group mutablehome.TradfriGroup) mutablehome.TradfriCommand {
+		return group.SetPower(true)
+	})
+}
+
+func PowerOff(_ gopi.App, tradfri mutablehome.TradfriGateway, args []string) error {
+	return SendLights(tradfri, args[0], func(light mutablehome.TradfriLight) mutablehome.TradfriCommand {
+		return light.SetPower(false)
+	}, func(group mutablehome.TradfriGroup) mutablehome.TradfriCommand {
+		return group.SetPower(false)
+	})
+}
+
+func Brightness(app gopi.App, tradfri mutablehome.TradfriGateway, args []string) error {
+	transition := app.Flags().GetDuration("transition", gopi.FLAG_NS_DEFAULT)
+	if value, err := strconv.ParseUint(args[1], 10, 32); err != nil {
+		return err
+	} else if value > 100 {
+		return gopi.ErrBadParameter.WithPrefix("brightness")
+	} else {
+		// Scale 0-100 to 00-FE
+		level := uint8(value * 0xFE / 100)
+		return SendLights(tradfri, args[0], func(light mutablehome.TradfriLight) mutablehome.TradfriCommand {
+			return light.SetBrightness(level, transition)
+		}, func(group mutablehome.TradfriGroup) mutablehome.TradfriCommand {
+			return group.SetBrightness(level, transition)
+		})
+	}
+}
+
+func Position(_ gopi.App, tradfri mutablehome.TradfriGateway, args []string) error {
+	if value, err := strconv.ParseUint(args[1], 10, 32); err != nil {
+		return err
+	} else if value > 100 {
+		return gopi.ErrBadParameter.WithPrefix("position")
+	} else {
+		return SendBlinds(tradfri, args[0], func(blind mutablehome.TradfriBlind) mutablehome.TradfriCommand {
+			return blind.SetPosition(uint8(value))
+		})
+	}
+}
+
+func Stop(_ gopi.App, tradfri mutablehome.TradfriGateway, args []string) error {
+	return SendBlinds(tradfri, args[0], func(blind mutablehome.TradfriBlind) mutablehome.TradfriCommand {
+		return blind.Stop()
+	})
+}
+
+func Rename(_ gopi.App, tradfri mutablehome.TradfriGateway, args []string) error {
+	name := strings.TrimSpace(args[1])
+	if id, err := strconv.ParseUint(args[0], 10, 32); err != nil {
+		return gopi.ErrBadParameter.WithPrefix("device")
+	} else if name == "" {
+		return gopi.ErrBadParameter.WithPrefix("name")
+	} else if device, err := tradfri.Device(uint(id)); errors.Is(err, gopi.ErrNotFound) {
+		if group, err := tradfri.Group(uint(id)); err != nil {
+			return err
+		} else {
+			return tradfri.Send(group.SetName(name))
+		}
+	} else if err != nil {
+		return err
+	} else {
+		return tradfri.Send(device.SetName(name))
+	}
+}
+
+func Gateway(_ gopi.App, tradfri mutablehome.TradfriGateway, _ []string) error {
+	table := tablewriter.NewWriter(os.Stdout)
+	if info, err := tradfri.Info(); err != nil {
+		return err
+	} else {
+		table.Append([]string{"Id", info.Id()})
+		table.Append([]string{"Version", info.Version()})
+		table.Append([]string{"NTP", info.NTP()})
+		table.Append([]string{"Time", info.Time().Format(time.RFC3339)})
+		table.Append([]string{"First Setup", info.FirstSetup().Format(time.RFC3339)})
+		table.Append([]string{"Pairing", fmt.Sprint(info.Pairing())})
+		if info.UpdateState() == 0 {
+			table.Append([]string{"Firmware Update", "None"})
+		} else {
+			table.Append([]string{"Firmware Update", fmt.Sprintf("State %v (%v%%)", info.UpdateState(), info.UpdateProgress())})
+		}
+	}
+	table.Render()
+	return nil
+}
+
+func Reboot(_ gopi.App, tradfri mutablehome.TradfriGateway, _ []string) error {
+	if err := tradfri.Reboot(); err != nil {
+		return err
+	}
+	fmt.Println("Gateway is rebooting")
+	return nil
+}
+
+func Pair(_ gopi.App, tradfri mutablehome.TradfriGateway, args []string) error {
+	duration := DEFAULT_PAIRING
+	if args[0] != "" {
+		if value, err := time.ParseDuration(args[0]); err != nil {
+			return gopi.ErrBadParameter.WithPrefix("duration")
+		} else {
+			duration = value
+		}
+	}
+	if err := tradfri.Pair(duration); err != nil {
+		return err
+	} else if duration == 0 {
+		fmt.Println("Pairing mode ended")
+	} else {
+		fmt.Println("Pairing mode enabled for", duration)
+	}
+	return nil
+}
+
+func Observe(app gopi.App, tradfri mutablehome.TradfriGateway, _ []string) error {
+	var wg sync.WaitGroup
+
+	devices, err := tradfri.Devices()
+	if err != nil {
+		return err
+	}
+
+	// Print devices as they are emitted
+	evts := tradfri.Subscribe()
+	go func() {
+		for evt := range evts {
+			PrintDevice(evt)
+		}
+	}()
+
+	// Observe devices in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, device := range devices {
+		wg.Add(1)
+		go func(device uint) {
+			defer wg.Done()
+			if err := tradfri.ObserveDevice(ctx, device); err != nil && err != context.Canceled {
+				app.Log().Error(err)
+			}
+		}(device)
+	}
+
+	// Wait for CTRL+C
+	fmt.Println("Press CTRL+C to end")
+	app.WaitForSignal(context.Background(), os.Interrupt)
+
+	// Cancel observing devices and wait for all goroutines to have ended
+	cancel()
+	wg.Wait()
+	tradfri.Unsubscribe(evts)
+
+	// Return success
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+
+// AllScenes returns scenes for all scene groups
+func AllScenes(tradfri mutablehome.TradfriGateway) ([]mutablehome.TradfriScene, error) {
+	scenes := make([]mutablehome.TradfriScene, 0)
+	if groups, err := tradfri.Scenes(); err != nil {
+		return nil, err
+	} else {
+		for _, group := range groups {
+			if ids, err := tradfri.GroupScenes(group); err != nil {
+				return nil, err
+			} else {
+				for _, id := range ids {
+					if scene, err := tradfri.Scene(group, id); err != nil {
+						return nil, err
+					} else {
+						scenes = append(scenes, scene)
+					}
+				}
+			}
+		}
+	}
+	return scenes, nil
+}
+
+// SendLights sends a command to every light on a device, or to a group
+func SendLights(tradfri mutablehome.TradfriGateway, id string, fn func(mutablehome.TradfriLight) mutablehome.TradfriCommand, gn func(mutablehome.TradfriGroup) mutablehome.TradfriCommand) error {
+	id_, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return gopi.ErrBadParameter.WithPrefix("device")
+	}
+	device, err := tradfri.Device(uint(id_))
+	if errors.Is(err, gopi.ErrNotFound) {
+		if group, err := tradfri.Group(uint(id_)); err != nil {
+			return err
+		} else {
+			return tradfri.Send(gn(group))
+		}
+	} else if err != nil {
+		return err
+	} else if lights := device.Lights(); len(lights) == 0 {
+		return gopi.ErrNotImplemented.WithPrefix(device.Name())
+	} else {
+		commands := make([]mutablehome.TradfriCommand, 0, len(lights))
+		for _, light := range lights {
+			commands = append(commands, fn(light))
+		}
+		return tradfri.Send(commands...)
+	}
+}
+
+// SendBlinds sends a command to every blind on a device
+func SendBlinds(tradfri mutablehome.TradfriGateway, id string, fn func(mutablehome.TradfriBlind) mutablehome.TradfriCommand) error {
+	if id_, err := strconv.ParseUint(id, 10, 32); err != nil {
+		return gopi.ErrBadParameter.WithPrefix("device")
+	} else if device, err := tradfri.Device(uint(id_)); err != nil {
+		return err
+	} else if blinds := device.Blinds(); len(blinds) == 0 {
+		return gopi.ErrNotImplemented.WithPrefix(device.Name())
+	} else {
+		commands := make([]mutablehome.TradfriCommand, 0, len(blinds))
+		for _, blind := range blinds {
+			commands = append(commands, fn(blind))
+		}
+		return tradfri.Send(commands...)
+	}
+}
@@ -4,10 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"os"
 	"regexp"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	// Frameworks
@@ -21,13 +20,12 @@ const (
 
 var (
 	reHostPort = regexp.MustCompile("^([^\\:]+)\\:(\\d+)$")
-	wg         sync.WaitGroup
 )
 
 /////////////////////////////////////////////////////////////////////
 
 func Main(app gopi.App, args []string) error {
-	tradfri := app.UnitInstance("tradfri").(mutablehome.Ikea)
+	tradfri := app.UnitInstance("mutablehome/tradfri/gateway").(mutablehome.TradfriGateway)
 
 	if services, err := Services(app); err != nil {
 		return err
@@ -39,26 +37,12 @@ func Main(app gopi.App, args []string) error {
 		return err
 	}
 
-	// Start observing devices
-	cancels, err := ObserveDevices(tradfri)
-	if err != nil {
-		return err
-	}
-
-	// Wait for CTRL+C
-	fmt.Println("Press CTRL+C to end")
-	app.WaitForSignal(context.Background(), os.Interrupt)
-
-	// Cancel observing devices
-	for _, cancel := range cancels {
-		cancel()
+	// Print out devices or execute a command
+	if len(args) == 0 {
+		return Devices(app, tradfri, nil)
+	} else {
+		return ExecuteCommand(app, tradfri, args[0], strings.Join(args[1:], " "))
 	}
-
-	// Wait for all goroutines to have ended
-	wg.Wait()
-
-	// Return success
-	return nil
 }
 
 func Services(app gopi.App) ([]gopi.RPCServiceRecord, error) {
@@ -71,7 +55,7 @@ func Services(app gopi.App) ([]gopi.RPCServiceRecord, error) {
 			return nil, err
 		} else {
 			return []gopi.RPCServiceRecord{
-				{Addrs: addrs, Port: uint16(port)},
+				{Name: app.Flags().GetString("tradfri.id", gopi.FLAG_NS_DEFAULT), Addrs: addrs, Port: uint16(port)},
 			}, nil
 		}
 	}
@@ -113,23 +97,3 @@ func LookupHost(host string) ([]net.IP, error) {
 		return addrs_, nil
 	}
 }
-
-func ObserveDevices(tradfri mutablehome.Ikea) ([]context.CancelFunc, error) {
-	if devices, err := tradfri.Devices(); err != nil {
-		return nil, err
-	} else {
-		cancels := make([]context.CancelFunc, 0, len(devices))
-		for _, device := range devices {
-			ctx, cancel := context.WithCancel(context.Background())
-			wg.Add(1)
-			go func(device uint) {
-				if err := tradfri.ObserveDevice(ctx, device); err != nil && err != context.Canceled && err != context.DeadlineExceeded {
-					fmt.Println("ObserveDevice:", err)
-				}
-				wg.Done()
-			}(device)
-			cancels = append(cancels, cancel)
-		}
-		return cancels, nil
-	}
-}
@@ -17,10 +17,11 @@ import (
 /////////////////////////////////////////////////////////////////////
 
 func main() {
-	if app, err := app.NewCommandLineTool(Main, Events, "tradfri", "discovery"); err != nil {
+	if app, err := app.NewCommandLineTool(Main, nil, "mutablehome/tradfri/gateway", "discovery"); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	} else {
 		app.Flags().FlagString("tradfri.addr", "", "Tradfri Gateway")
+		app.Flags().FlagDuration("transition", 0, "Light transition time")
 		os.Exit(app.Run())
 	}
 }
@@ -9,6 +9,8 @@ package mutablehome
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	// Frameworks
 	gopi2 "github.com/djthorpe/gopi/v2"
@@ -22,6 +24,9 @@ type (
 	EcovacsPart         string
 	EcovacsCleanMode    string
 	EcovacsCleanSuction string
+	EcovacsMapCell      uint8
+	EcovacsSeverity     uint
+	EcovacsCondition    uint
 )
 
 type Ecovacs interface {
@@ -53,9 +58,110 @@ type EvovacsDevice interface {
 	GetCleanState() (string, error)
 	GetVersion() (string, error)
 
+	// Fetch map, position and cleaning history from device, returns
+	// ReqId for the request
+	GetMapM() (string, error)
+	PullMP(uint) (string, error)
+	GetPos() (string, error)
+	GetChargerPos() (string, error)
+	GetCleanSum() (string, error)
+	GetCleanLogs(uint) (string, error)
+
+	// Fetch and change cleaning schedules and do-not-disturb, which
+	// are stored on the device. SetSched adds a schedule or replaces
+	// a schedule with the same name. Returns ReqId for the request
+	GetSched() (string, error)
+	SetSched(EcovacsSchedule) (string, error)
+	DelSched(string) (string, error)
+	GetBlockTime() (string, error)
+	SetBlockTime(EcovacsDND) (string, error)
+
 	// Command the device
 	Clean(EcovacsCleanMode, EcovacsCleanSuction) (string, error)
 	Charge() (string, error)
+
+	// Reset the lifespan of a consumable part after it has been
+	// replaced, returns ReqId for the request
+	ResetLifeSpan(EcovacsPart) (string, error)
+
+	// Map returns the map assembled from map pieces, or nil if
+	// no map has been received from the device
+	Map() EcovacsMap
+}
+
+// EcovacsMap is a grid of cells, with the origin in the
+// top left corner
+type EcovacsMap interface {
+	// Return map identifier
+	Id() string
+
+	// Return width and height in cells
+	Size() (uint, uint)
+
+	// Return the size of each cell in millimetres
+	Resolution() uint
+
+	// Return cell at x,y or ECOVACS_MAP_NONE if out of bounds
+	Cell(x, y uint) EcovacsMapCell
+
+	// Return the cell for a position
+	Point(EcovacsPosition) (int, int)
+
+	// Return true when all map pieces have been received
+	Complete() bool
+}
+
+// EcovacsPosition is a position in millimetres relative to the
+// centre of the map, with an angle in degrees
+type EcovacsPosition struct {
+	X, Y  int
+	Angle int
+}
+
+// EcovacsCleanSum is the cleaning total over the lifetime of a device
+type EcovacsCleanSum struct {
+	Area     uint // Square metres
+	Duration time.Duration
+	Count    uint
+}
+
+// EcovacsSchedule is a cleaning schedule, which is identified by name.
+// Time is the time of day, and the schedule repeats on Days or cleans
+// once if Days is empty
+type EcovacsSchedule struct {
+	Name    string
+	Enabled bool
+	Time    time.Duration
+	Days    []time.Weekday
+	Mode    EcovacsCleanMode
+	Suction EcovacsCleanSuction
+}
+
+// EcovacsDND is the do-not-disturb window, with Start and End as time
+// of day. The window spans midnight when End is before Start
+type EcovacsDND struct {
+	Enabled    bool
+	Start, End time.Duration
+}
+
+// EcovacsCleanLog is a single cleaning session
+type EcovacsCleanLog struct {
+	Start    time.Time
+	Duration time.Duration
+	Area     uint // Square metres
+	Mode     EcovacsCleanMode
+	Reason   string
+}
+
+// EcovacsError is an error reported by a device or returned in response
+// to a command. Condition is ECOVACS_CONDITION_NONE when the error has
+// been cleared
+type EcovacsError struct {
+	Code        uint
+	Name        string
+	Description string
+	Severity    EcovacsSeverity
+	Condition   EcovacsCondition
 }
 
 type EcovacsEvent interface {
@@ -76,6 +182,14 @@ const (
 	ECOVACS_EVENT_VERSION
 	ECOVACS_EVENT_LOG
 	ECOVACS_EVENT_ERROR
+	ECOVACS_EVENT_POSITION
+	ECOVACS_EVENT_CHARGERPOSITION
+	ECOVACS_EVENT_MAP
+	ECOVACS_EVENT_MAPPIECE
+	ECOVACS_EVENT_CLEANSUM
+	ECOVACS_EVENT_SCHEDULE
+	ECOVACS_EVENT_DND
+	ECOVACS_EVENT_LOWLIFESPAN
 )
 
 const (
@@ -97,6 +211,36 @@ const (
 	ECOVACS_SUCTION_STRONG   EcovacsCleanSuction = "strong"
 )
 
+const (
+	ECOVACS_SEVERITY_NONE     EcovacsSeverity = iota // Error has been cleared
+	ECOVACS_SEVERITY_INFO                            // Informational, no action required
+	ECOVACS_SEVERITY_WARNING                         // Action required soon
+	ECOVACS_SEVERITY_CRITICAL                        // Robot cannot continue
+)
+
+const (
+	ECOVACS_CONDITION_NONE       EcovacsCondition = iota
+	ECOVACS_CONDITION_STUCK                       // Robot is stuck
+	ECOVACS_CONDITION_LIFTED                      // Robot is off the floor
+	ECOVACS_CONDITION_BINFULL                     // Dust bin is full
+	ECOVACS_CONDITION_NOBIN                       // Dust bin is not installed
+	ECOVACS_CONDITION_WHEELJAM                    // Driving wheel is jammed
+	ECOVACS_CONDITION_BRUSHJAM                    // Main or side brush is tangled
+	ECOVACS_CONDITION_BATTERYLOW                  // Battery is low
+	ECOVACS_CONDITION_SENSOR                      // Sensor is dirty or has failed
+	ECOVACS_CONDITION_CONSUMABLE                  // Consumable part has expired
+	ECOVACS_CONDITION_HARDWARE                    // Other hardware failure
+	ECOVACS_CONDITION_REQUEST                     // Command failed or timed out
+	ECOVACS_CONDITION_OTHER
+)
+
+const (
+	ECOVACS_MAP_NONE EcovacsMapCell = iota
+	ECOVACS_MAP_FLOOR
+	ECOVACS_MAP_WALL
+	ECOVACS_MAP_CARPET
+)
+
 ////////////////////////////////////////////////////////////////////////////////
 // GLOBALS
 
@@ -127,7 +271,90 @@ func (v EcovacsEventType) String() string {
 		return "ECOVACS_EVENT_LOG"
 	case ECOVACS_EVENT_ERROR:
 		return "ECOVACS_EVENT_ERROR"
+	case ECOVACS_EVENT_POSITION:
+		return "ECOVACS_EVENT_POSITION"
+	case ECOVACS_EVENT_CHARGERPOSITION:
+		return "ECOVACS_EVENT_CHARGERPOSITION"
+	case ECOVACS_EVENT_MAP:
+		return "ECOVACS_EVENT_MAP"
+	case ECOVACS_EVENT_MAPPIECE:
+		return "ECOVACS_EVENT_MAPPIECE"
+	case ECOVACS_EVENT_CLEANSUM:
+		return "ECOVACS_EVENT_CLEANSUM"
+	case ECOVACS_EVENT_SCHEDULE:
+		return "ECOVACS_EVENT_SCHEDULE"
+	case ECOVACS_EVENT_DND:
+		return "ECOVACS_EVENT_DND"
+	case ECOVACS_EVENT_LOWLIFESPAN:
+		return "ECOVACS_EVENT_LOWLIFESPAN"
 	default:
 		return "[?? Invalid EcovacsEventType value]"
 	}
 }
+
+func (v EcovacsMapCell) String() string {
+	switch v {
+	case ECOVACS_MAP_NONE:
+		return "ECOVACS_MAP_NONE"
+	case ECOVACS_MAP_FLOOR:
+		return "ECOVACS_MAP_FLOOR"
+	case ECOVACS_MAP_WALL:
+		return "ECOVACS_MAP_WALL"
+	case ECOVACS_MAP_CARPET:
+		return "ECOVACS_MAP_CARPET"
+	default:
+		return "[?? Invalid EcovacsMapCell value]"
+	}
+}
+
+func (v EcovacsSeverity) String() string {
+	switch v {
+	case ECOVACS_SEVERITY_NONE:
+		return "ECOVACS_SEVERITY_NONE"
+	case ECOVACS_SEVERITY_INFO:
+		return "ECOVACS_SEVERITY_INFO"
+	case ECOVACS_SEVERITY_WARNING:
+		return "ECOVACS_SEVERITY_WARNING"
+	case ECOVACS_SEVERITY_CRITICAL:
+		return "ECOVACS_SEVERITY_CRITICAL"
+	default:
+		return "[?? Invalid EcovacsSeverity value]"
+	}
+}
+
+func (v EcovacsCondition) String() string {
+	switch v {
+	case ECOVACS_CONDITION_NONE:
+		return "ECOVACS_CONDITION_NONE"
+	case ECOVACS_CONDITION_STUCK:
+		return "ECOVACS_CONDITION_STUCK"
+	case ECOVACS_CONDITION_LIFTED:
+		return "ECOVACS_CONDITION_LIFTED"
+	case ECOVACS_CONDITION_BINFULL:
+		return "ECOVACS_CONDITION_BINFULL"
+	case ECOVACS_CONDITION_NOBIN:
+		return "ECOVACS_CONDITION_NOBIN"
+	case ECOVACS_CONDITION_WHEELJAM:
+		return "ECOVACS_CONDITION_WHEELJAM"
+	case ECOVACS_CONDITION_BRUSHJAM:
+		return "ECOVACS_CONDITION_BRUSHJAM"
+	case ECOVACS_CONDITION_BATTERYLOW:
+		return "ECOVACS_CONDITION_BATTERYLOW"
+	case ECOVACS_CONDITION_SENSOR:
+		return "ECOVACS_CONDITION_SENSOR"
+	case ECOVACS_CONDITION_CONSUMABLE:
+		return "ECOVACS_CONDITION_CONSUMABLE"
+	case ECOVACS_CONDITION_HARDWARE:
+		return "ECOVACS_CONDITION_HARDWARE"
+	case ECOVACS_CONDITION_REQUEST:
+		return "ECOVACS_CONDITION_REQUEST"
+	case ECOVACS_CONDITION_OTHER:
+		return "ECOVACS_CONDITION_OTHER"
+	default:
+		return "[?? Invalid EcovacsCondition value]"
+	}
+}
+
+func (e EcovacsError) String() string {
+	return fmt.Sprintf("<EcovacsError code=%v name=%q severity=%v condition=%v>", e.Code, e.Name, e.Severity, e.Condition)
+}
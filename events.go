@@ -0,0 +1,47 @@
+/*
+	Mutablehome Automation
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mutablehome
+
+////////////////////////////////////////////////////////////////////////////////
+// EVENT PROCESSING
+
+// NodeId returns the node id for an event, which is the remote node
+// for events from a hub, or else the node which emitted the event
+func NodeId(node Node, evt Event) string {
+	if remote, ok := evt.(RemoteEvent); ok && remote.NodeId() != "" {
+		return remote.NodeId()
+	} else if source := evt.Node(); source != nil {
+		return source.Id()
+	} else {
+		return node.Id()
+	}
+}
+
+// ProcessEvents calls fn for each event received on evts, which is a
+// subscription to node, until stop is closed. It then unsubscribes,
+// draining any pending events so that the node is not blocked
+func ProcessEvents(node Node, evts <-chan interface{}, stop <-chan struct{}, fn func(Event)) {
+FOR_LOOP:
+	for {
+		select {
+		case value, ok := <-evts:
+			if ok == false {
+				break FOR_LOOP
+			} else if evt, ok := value.(Event); ok {
+				fn(evt)
+			}
+		case <-stop:
+			break FOR_LOOP
+		}
+	}
+
+	// Unsubscribe and drain any events
+	go node.Unsubscribe(evts)
+	for range evts {
+	}
+}
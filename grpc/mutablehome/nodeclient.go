@@ -10,11 +10,14 @@ package mutablehome
 import (
 	"context"
 	"fmt"
+	"io"
+	"time"
 
 	// Frameworks
 	grpc "github.com/djthorpe/gopi-rpc/v2/unit/grpc"
 	gopi "github.com/djthorpe/gopi/v2"
 	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
 
 	// Protocol buffers
 	pb "github.com/djthorpe/mutablehome/protobuf/mutablehome"
@@ -30,6 +33,7 @@ type NodeClient struct {
 
 type client struct {
 	base.Unit
+	base.PubSub
 	conn   gopi.RPCClientConn
 	client pb.NodeClient
 }
@@ -69,6 +73,11 @@ func (this *client) Init(config NodeClient) error {
 }
 
 func (this *client) Close() error {
+	// Close pubsub
+	if err := this.PubSub.Close(); err != nil {
+		return err
+	}
+
 	return this.Unit.Close()
 }
 
@@ -92,3 +101,142 @@ func (this *client) Ping(ctx context.Context) error {
 		return nil
 	}
 }
+
+func (this *client) Metadata(ctx context.Context) (mutablehome.NodeMetadata, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.Metadata(ctx, &empty.Empty{}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufMetadataResponse(reply), nil
+	}
+}
+
+func (this *client) Devices(ctx context.Context) ([]mutablehome.RemoteDevice, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.Devices(ctx, &empty.Empty{}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufDevicesResponse(reply), nil
+	}
+}
+
+func (this *client) Device(ctx context.Context, id string) (mutablehome.RemoteDevice, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.Device(ctx, &pb.DeviceRequest{
+		Id: id,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufDevice(reply), nil
+	}
+}
+
+func (this *client) SetPower(ctx context.Context, id string, power mutablehome.TraitType) (mutablehome.RemoteDevice, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.SetPower(ctx, &pb.SetPowerRequest{
+		Id:    id,
+		Power: pb.TraitType(power),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufDevice(reply), nil
+	}
+}
+
+func (this *client) SetBrightness(ctx context.Context, id string, brightness float32, transition time.Duration) (mutablehome.RemoteDevice, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.SetBrightness(ctx, &pb.SetBrightnessRequest{
+		Id:         id,
+		Brightness: brightness,
+		Transition: toProtobufDuration(transition),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufDevice(reply), nil
+	}
+}
+
+func (this *client) SetPosition(ctx context.Context, id string, position float32) (mutablehome.RemoteDevice, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.SetPosition(ctx, &pb.SetPositionRequest{
+		Id:       id,
+		Position: position,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufDevice(reply), nil
+	}
+}
+
+func (this *client) Stop(ctx context.Context, id string) (mutablehome.RemoteDevice, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.Stop(ctx, &pb.DeviceRequest{
+		Id: id,
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufDevice(reply), nil
+	}
+}
+
+func (this *client) StreamEvents(ctx context.Context, devices []string, types []mutablehome.EventType) error {
+	// The connection is only locked while the stream is created, so that
+	// other calls can be made while events are received
+	this.conn.Lock()
+	stream, err := this.client.StreamEvents(ctx, toProtobufStreamEventsRequest(devices, types))
+	this.conn.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Receive events until the stream ends or the context is cancelled,
+	// ignoring empty messages
+	for {
+		if evt, err := stream.Recv(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			if grpc.IsErrCanceled(err) {
+				return nil
+			} else {
+				return err
+			}
+		} else if evt.Type != pb.EventType_EVENT_NONE {
+			this.Emit(fromProtobufEvent(this, evt))
+		}
+	}
+}
+
+func (this *client) LastValue(ctx context.Context, id string, trait mutablehome.TraitType) (mutablehome.StoreValue, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.LastValue(ctx, &pb.ValueRequest{
+		Device: id,
+		Trait:  pb.TraitType(trait),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufValue(reply), nil
+	}
+}
+
+func (this *client) History(ctx context.Context, id string, trait mutablehome.TraitType, from, to time.Time) ([]mutablehome.StoreValue, error) {
+	this.conn.Lock()
+	defer this.conn.Unlock()
+	if reply, err := this.client.History(ctx, &pb.HistoryRequest{
+		Device: id,
+		Trait:  pb.TraitType(trait),
+		From:   toProtobufTimestamp(from),
+		To:     toProtobufTimestamp(to),
+	}); err != nil {
+		return nil, err
+	} else {
+		return fromProtobufHistoryResponse(reply), nil
+	}
+}
@@ -9,6 +9,7 @@ package mutablehome
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -28,7 +29,7 @@ type nodedevices struct {
 	online  bool
 	node    mutablehome.Node
 	stop    chan struct{}
-	devices map[string]string
+	devices map[string]mutablehome.Device
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -43,7 +44,7 @@ func (this *nodedevices) Init(log gopi.Logger) error {
 	}
 
 	// Create devices
-	this.devices = make(map[string]string)
+	this.devices = make(map[string]mutablehome.Device)
 
 	// Create stop channel
 	this.stop = make(chan struct{})
@@ -53,13 +54,14 @@ func (this *nodedevices) Init(log gopi.Logger) error {
 }
 
 func (this *nodedevices) Close() error {
-	this.Mutex.Lock()
-	defer this.Mutex.Unlock()
-
-	// Send stop signal and wait for stop
+	// Send stop signal and wait for stop, without holding the lock
+	// since the background process takes it to process events
 	close(this.stop)
 	this.WaitGroup.Wait()
 
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
 	// Release resources
 	this.stop = nil
 	this.node = nil
@@ -80,9 +82,19 @@ func (this *nodedevices) SetNode(node mutablehome.Node) error {
 		return gopi.ErrBadParameter.WithPrefix("node")
 	} else {
 		this.node = node
-		go this.BackgroundProcess(this.node, this.stop)
 	}
 
+	// Add existing devices before subscribing to changes
+	for _, device := range node.Devices() {
+		if err := this.addDevice(device); err != nil {
+			this.Log.Error(fmt.Errorf("Ignoring: %v: %w", device, err))
+		}
+	}
+
+	// Process events in the background
+	this.WaitGroup.Add(1)
+	go this.BackgroundProcess(node, this.stop)
+
 	// Return success
 	return nil
 }
@@ -106,7 +118,6 @@ func (this *nodedevices) SetOnline(value bool) {
 // BACKGROUND PROCESS
 
 func (this *nodedevices) BackgroundProcess(node mutablehome.Node, stop <-chan struct{}) {
-	this.WaitGroup.Add(1)
 	defer this.WaitGroup.Done()
 
 	evts := node.Subscribe()
@@ -118,7 +129,10 @@ FOR_LOOP:
 				this.ProcessEvent(evt_)
 			}
 		case <-stop:
-			node.Unsubscribe(evts)
+			// Drain any pending events until unsubscribed
+			go node.Unsubscribe(evts)
+			for range evts {
+			}
 			break FOR_LOOP
 		}
 	}
@@ -135,9 +149,13 @@ func (this *nodedevices) ProcessEvent(evt mutablehome.Event) {
 			this.Log.Error(fmt.Errorf("Ignoring: %v: %w", evt.Type(), err))
 		}
 	case mutablehome.EVENT_DEVICE_REMOVED:
-		this.Log.Warn("Ignoring:", evt)
+		if err := this.RemoveDevice(evt.Device()); err != nil {
+			this.Log.Error(fmt.Errorf("Ignoring: %v: %w", evt.Type(), err))
+		}
 	case mutablehome.EVENT_DEVICE_METADATA_CHANGED, mutablehome.EVENT_DEVICE_TRAIT_CHANGED:
-		this.Log.Warn("Ignoring:", evt)
+		if err := this.UpdateDevice(evt.Device()); err != nil {
+			this.Log.Error(fmt.Errorf("Ignoring: %v: %w", evt.Type(), err))
+		}
 	default:
 		this.Log.Warn("Ignoring:", evt)
 	}
@@ -150,6 +168,74 @@ func (this *nodedevices) AddDevice(device mutablehome.Device) error {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
+	return this.addDevice(device)
+}
+
+func (this *nodedevices) RemoveDevice(device mutablehome.Device) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device == nil {
+		return gopi.ErrBadParameter.WithPrefix("Device")
+	} else if _, exists := this.devices[device.Id()]; exists == false {
+		return gopi.ErrNotFound.WithPrefix(device.Id())
+	} else {
+		delete(this.devices, device.Id())
+	}
+
+	// Success
+	return nil
+}
+
+func (this *nodedevices) UpdateDevice(device mutablehome.Device) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device == nil {
+		return gopi.ErrBadParameter.WithPrefix("Device")
+	} else if _, exists := this.devices[device.Id()]; exists == false {
+		return gopi.ErrNotFound.WithPrefix(device.Id())
+	} else {
+		this.devices[device.Id()] = device
+	}
+
+	// Success
+	return nil
+}
+
+// Devices returns devices which have been added, sorted by id
+func (this *nodedevices) Devices() []mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	devices := make([]mutablehome.Device, 0, len(this.devices))
+	for _, device := range this.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Id() < devices[j].Id()
+	})
+	return devices
+}
+
+// DeviceWithId returns a device which has been added, or nil
+func (this *nodedevices) DeviceWithId(id string) mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device, exists := this.devices[id]; exists {
+		return device
+	} else {
+		return nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// addDevice adds a device to the device map, and should be called
+// with the lock held
+func (this *nodedevices) addDevice(device mutablehome.Device) error {
 	if device == nil {
 		return gopi.ErrBadParameter.WithPrefix("Device")
 	}
@@ -162,7 +248,7 @@ func (this *nodedevices) AddDevice(device mutablehome.Device) error {
 	} else if name := strings.TrimSpace(device.Name()); name == "" {
 		return gopi.ErrBadParameter.WithPrefix("Name")
 	} else {
-		this.devices[id] = name
+		this.devices[id] = device
 	}
 
 	// Check capabilities for the device
@@ -175,13 +261,37 @@ func (this *nodedevices) AddDevice(device mutablehome.Device) error {
 			} else {
 				this.Log.Info("Device", device.Id(), "has", trait)
 			}
-		case mutablehome.TRAIT_LIGHT_BRIGHTNESS, mutablehome.TRAIT_LIGHT_COLOR, mutablehome.TRAIT_LIGHT_TEMPERATURE:
+		case mutablehome.TRAIT_LIGHT_BRIGHTNESS, mutablehome.TRAIT_LIGHT_COLOR, mutablehome.TRAIT_LIGHT_TEMPERATURE, mutablehome.TRAIT_LIGHT_TRANSITION:
 			// Device should conform to mutablehome.LightTrait
 			if _, ok := device.(mutablehome.LightTrait); ok == false {
 				this.Log.Warn("Device", device.Id(), "does not implement", trait)
 			} else {
 				this.Log.Info("Device", device.Id(), "has", trait)
 			}
+		case mutablehome.TRAIT_COVER_POSITION:
+			// Device should conform to mutablehome.CoverTrait
+			if _, ok := device.(mutablehome.CoverTrait); ok == false {
+				this.Log.Warn("Device", device.Id(), "does not implement", trait)
+			} else {
+				this.Log.Info("Device", device.Id(), "has", trait)
+			}
+		case mutablehome.TRAIT_BATTERY_LEVEL:
+			// Device should conform to mutablehome.BatteryTrait
+			if _, ok := device.(mutablehome.BatteryTrait); ok == false {
+				this.Log.Warn("Device", device.Id(), "does not implement", trait)
+			} else {
+				this.Log.Info("Device", device.Id(), "has", trait)
+			}
+		case mutablehome.TRAIT_VACUUM_CLEAN_MODE, mutablehome.TRAIT_VACUUM_SUCTION, mutablehome.TRAIT_VACUUM_CHARGE, mutablehome.TRAIT_VACUUM_LIFESPAN:
+			// Device should conform to mutablehome.VacuumTrait
+			if _, ok := device.(mutablehome.VacuumTrait); ok == false {
+				this.Log.Warn("Device", device.Id(), "does not implement", trait)
+			} else {
+				this.Log.Info("Device", device.Id(), "has", trait)
+			}
+		case mutablehome.TRAIT_SENSOR_ACTIVITY:
+			// Activity is reported through events only
+			this.Log.Info("Device", device.Id(), "has", trait)
 		default:
 			this.Log.Warn("Device", device.Id(), "ignoring trait", trait)
 		}
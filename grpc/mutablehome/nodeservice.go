@@ -10,6 +10,7 @@ package mutablehome
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	grpc "github.com/djthorpe/gopi-rpc/v2/unit/grpc"
 	gopi "github.com/djthorpe/gopi/v2"
 	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
 
 	// Protocol buffers
 	pb "github.com/djthorpe/mutablehome/protobuf/mutablehome"
@@ -33,10 +35,12 @@ type NodeService struct {
 
 type nodeservice struct {
 	base.Unit
+	base.PubSub
 	sync.Mutex
 	nodedevices
 
 	server gopi.RPCServer
+	store  mutablehome.Store
 	start  time.Time
 }
 
@@ -87,6 +91,12 @@ func (this *nodeservice) Close() error {
 
 	// Release resources
 	this.server = nil
+	this.store = nil
+
+	// Close pubsub
+	if err := this.PubSub.Close(); err != nil {
+		return err
+	}
 
 	return this.Unit.Close()
 }
@@ -102,7 +112,27 @@ func (this *nodeservice) String() string {
 // IMPLEMENTATION gopi.RPCService
 
 func (this *nodeservice) CancelRequests() error {
-	// Do not need to cancel
+	// Cancel any streaming requests
+	this.Emit(gopi.NullEvent)
+
+	// Return success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.RPCNodeService
+
+func (this *nodeservice) SetStore(store mutablehome.Store) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if store == nil || this.store != nil {
+		return gopi.ErrBadParameter.WithPrefix("store")
+	} else {
+		this.store = store
+	}
+
+	// Return success
 	return nil
 }
 
@@ -132,3 +162,213 @@ func (this *nodeservice) Metadata(context.Context, *empty.Empty) (*pb.MetadataRe
 		Uptime: ptypes.DurationProto(time.Now().Sub(this.start)),
 	}, nil
 }
+
+func (this *nodeservice) Devices(context.Context, *empty.Empty) (*pb.DevicesResponse, error) {
+	this.Unit.Log.Debug("<Devices>")
+
+	// Return devices
+	return toProtobufDevicesResponse(this.nodedevices.Devices()), nil
+}
+
+func (this *nodeservice) Device(_ context.Context, req *pb.DeviceRequest) (*pb.Device, error) {
+	this.Unit.Log.Debug("<Device id=", strconv.Quote(req.Id), ">")
+
+	if device := this.nodedevices.DeviceWithId(req.Id); device == nil {
+		return nil, gopi.ErrNotFound.WithPrefix(req.Id)
+	} else {
+		return toProtobufDevice(device), nil
+	}
+}
+
+func (this *nodeservice) SetPower(_ context.Context, req *pb.SetPowerRequest) (*pb.Device, error) {
+	this.Unit.Log.Debug("<SetPower id=", strconv.Quote(req.Id), " power=", req.Power, ">")
+
+	if device := this.nodedevices.DeviceWithId(req.Id); device == nil {
+		return nil, gopi.ErrNotFound.WithPrefix(req.Id)
+	} else if power, ok := device.(mutablehome.PowerTrait); ok == false {
+		return nil, gopi.ErrNotImplemented.WithPrefix("SetPower")
+	} else if err := power.SetPower(mutablehome.TraitType(req.Power)); err != nil {
+		return nil, err
+	} else {
+		return toProtobufDevice(device), nil
+	}
+}
+
+func (this *nodeservice) SetBrightness(_ context.Context, req *pb.SetBrightnessRequest) (*pb.Device, error) {
+	this.Unit.Log.Debug("<SetBrightness id=", strconv.Quote(req.Id), " brightness=", req.Brightness, ">")
+
+	if device := this.nodedevices.DeviceWithId(req.Id); device == nil {
+		return nil, gopi.ErrNotFound.WithPrefix(req.Id)
+	} else if light, ok := device.(mutablehome.LightTrait); ok == false {
+		return nil, gopi.ErrNotImplemented.WithPrefix("SetBrightness")
+	} else if req.Brightness < 0 || req.Brightness > 1 {
+		return nil, gopi.ErrBadParameter.WithPrefix("Brightness")
+	} else if transition, err := durationFromProto(req.Transition); err != nil {
+		return nil, err
+	} else if err := light.SetBrightness(req.Brightness, transition); err != nil {
+		return nil, err
+	} else {
+		return toProtobufDevice(device), nil
+	}
+}
+
+func (this *nodeservice) SetPosition(_ context.Context, req *pb.SetPositionRequest) (*pb.Device, error) {
+	this.Unit.Log.Debug("<SetPosition id=", strconv.Quote(req.Id), " position=", req.Position, ">")
+
+	if device := this.nodedevices.DeviceWithId(req.Id); device == nil {
+		return nil, gopi.ErrNotFound.WithPrefix(req.Id)
+	} else if cover, ok := device.(mutablehome.CoverTrait); ok == false {
+		return nil, gopi.ErrNotImplemented.WithPrefix("SetPosition")
+	} else if req.Position < 0 || req.Position > 1 {
+		return nil, gopi.ErrBadParameter.WithPrefix("Position")
+	} else if err := cover.SetPosition(req.Position); err != nil {
+		return nil, err
+	} else {
+		return toProtobufDevice(device), nil
+	}
+}
+
+func (this *nodeservice) Stop(_ context.Context, req *pb.DeviceRequest) (*pb.Device, error) {
+	this.Unit.Log.Debug("<Stop id=", strconv.Quote(req.Id), ">")
+
+	if device := this.nodedevices.DeviceWithId(req.Id); device == nil {
+		return nil, gopi.ErrNotFound.WithPrefix(req.Id)
+	} else if cover, ok := device.(mutablehome.CoverTrait); ok == false {
+		return nil, gopi.ErrNotImplemented.WithPrefix("Stop")
+	} else if err := cover.Stop(); err != nil {
+		return nil, err
+	} else {
+		return toProtobufDevice(device), nil
+	}
+}
+
+func (this *nodeservice) StreamEvents(req *pb.StreamEventsRequest, stream pb.Node_StreamEventsServer) error {
+	this.Unit.Log.Debug("<StreamEvents device=", req.Device, " type=", req.Type, ">")
+
+	// Check to make sure node is set
+	this.Mutex.Lock()
+	node := this.node
+	this.Mutex.Unlock()
+	if node == nil {
+		return gopi.ErrInternalAppError.WithPrefix("Missing node parameter")
+	}
+
+	// Subscribe to cancel and node events
+	cancel := this.Subscribe()
+	defer unsubscribe(this.Unsubscribe, cancel)
+	evts := node.Subscribe()
+	defer unsubscribe(node.Unsubscribe, evts)
+
+	// Send an empty message once a second to detect closed streams
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// Loop until the stream or service is cancelled
+	for {
+		select {
+		case evt := <-evts:
+			if evt_, ok := evt.(mutablehome.Event); ok == false {
+				continue
+			} else if matchEvent(evt_, req) == false {
+				continue
+			} else if err := stream.Send(toProtobufEvent(evt_)); err != nil {
+				this.Unit.Log.Error(err)
+				return err
+			}
+		case <-ticker.C:
+			if err := stream.Send(&pb.Event{}); err != nil {
+				if grpc.IsErrUnavailable(err) == false {
+					this.Unit.Log.Error(err)
+				}
+				return nil
+			}
+		case <-stream.Context().Done():
+			this.Unit.Log.Debug("StreamEvents: Context done")
+			return nil
+		case <-cancel:
+			this.Unit.Log.Debug("StreamEvents: Cancelled")
+			return nil
+		}
+	}
+}
+
+func (this *nodeservice) LastValue(_ context.Context, req *pb.ValueRequest) (*pb.Value, error) {
+	this.Unit.Log.Debug("<LastValue device=", strconv.Quote(req.Device), " trait=", req.Trait, ">")
+
+	// Check to make sure store is set
+	this.Mutex.Lock()
+	store := this.store
+	this.Mutex.Unlock()
+	if store == nil {
+		return nil, gopi.ErrNotImplemented.WithPrefix("LastValue")
+	}
+
+	// Return the last value
+	if value := store.Last(req.Device, mutablehome.TraitType(req.Trait)); value == nil {
+		return nil, gopi.ErrNotFound.WithPrefix(req.Device)
+	} else {
+		return toProtobufValue(value), nil
+	}
+}
+
+func (this *nodeservice) History(_ context.Context, req *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	this.Unit.Log.Debug("<History device=", strconv.Quote(req.Device), " trait=", req.Trait, ">")
+
+	// Check to make sure store is set
+	this.Mutex.Lock()
+	store := this.store
+	this.Mutex.Unlock()
+	if store == nil {
+		return nil, gopi.ErrNotImplemented.WithPrefix("History")
+	}
+
+	// Return values between two times
+	if from, err := timestampFromProto(req.From); err != nil {
+		return nil, gopi.ErrBadParameter.WithPrefix("From")
+	} else if to, err := timestampFromProto(req.To); err != nil {
+		return nil, gopi.ErrBadParameter.WithPrefix("To")
+	} else {
+		return toProtobufHistoryResponse(store.Between(req.Device, mutablehome.TraitType(req.Trait), from, to)), nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// matchEvent returns true if an event matches the device ids and
+// event types in a request, where empty fields match all events
+func matchEvent(evt mutablehome.Event, req *pb.StreamEventsRequest) bool {
+	if len(req.Type) > 0 {
+		match := false
+		for _, t := range req.Type {
+			if mutablehome.EventType(t) == evt.Type() {
+				match = true
+				break
+			}
+		}
+		if match == false {
+			return false
+		}
+	}
+	if len(req.Device) > 0 {
+		device := evt.Device()
+		if device == nil {
+			return false
+		}
+		for _, id := range req.Device {
+			if id == device.Id() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// unsubscribe drains a channel while unsubscribing, so that
+// an event which is being emitted does not block
+func unsubscribe(fn func(<-chan interface{}), ch <-chan interface{}) {
+	go fn(ch)
+	for range ch {
+	}
+}
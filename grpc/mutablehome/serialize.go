@@ -0,0 +1,394 @@
+/*
+	Mutablehome Automation
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mutablehome
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+
+	// Protocol buffers
+	pb "github.com/djthorpe/mutablehome/protobuf/mutablehome"
+	ptypes "github.com/golang/protobuf/ptypes"
+	duration "github.com/golang/protobuf/ptypes/duration"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TO PROTOBUF
+
+func toProtobufDevice(device mutablehome.Device) *pb.Device {
+	if device == nil {
+		return nil
+	}
+	reply := &pb.Device{
+		Id:     device.Id(),
+		Name:   device.Name(),
+		Traits: toProtobufTraits(device.Traits()),
+	}
+	if power, ok := device.(mutablehome.PowerTrait); ok {
+		reply.Power = pb.TraitType(power.Power())
+	}
+	if light, ok := device.(mutablehome.LightTrait); ok {
+		reply.Brightness = light.Brightness()
+	}
+	if cover, ok := device.(mutablehome.CoverTrait); ok {
+		reply.Position = cover.Position()
+	}
+	if battery, ok := device.(mutablehome.BatteryTrait); ok {
+		reply.Battery = battery.BatteryLevel()
+	}
+	if vacuum, ok := device.(mutablehome.VacuumTrait); ok {
+		reply.CleanMode = pb.VacuumMode(vacuum.CleanMode())
+		reply.Suction = pb.VacuumSuction(vacuum.Suction())
+		reply.Charging = vacuum.Charging()
+		reply.Lifespan = vacuum.LifeSpan()
+	}
+	return reply
+}
+
+func toProtobufDevicesResponse(devices []mutablehome.Device) *pb.DevicesResponse {
+	reply := make([]*pb.Device, len(devices))
+	for i, device := range devices {
+		reply[i] = toProtobufDevice(device)
+	}
+	return &pb.DevicesResponse{
+		Device: reply,
+	}
+}
+
+func toProtobufTraits(traits []mutablehome.TraitType) []pb.TraitType {
+	if traits == nil {
+		return nil
+	}
+	reply := make([]pb.TraitType, len(traits))
+	for i, trait := range traits {
+		reply[i] = pb.TraitType(trait)
+	}
+	return reply
+}
+
+func toProtobufDuration(value time.Duration) *duration.Duration {
+	if value == 0 {
+		return nil
+	}
+	return ptypes.DurationProto(value)
+}
+
+func toProtobufEvent(evt mutablehome.Event) *pb.Event {
+	if evt == nil {
+		return nil
+	}
+	reply := &pb.Event{
+		Type:   pb.EventType(evt.Type()),
+		Device: toProtobufDevice(evt.Device()),
+		Traits: toProtobufTraits(evt.Traits()),
+	}
+	if node := evt.Node(); node != nil {
+		reply.Node = node.Id()
+	}
+	return reply
+}
+
+func toProtobufStreamEventsRequest(devices []string, types []mutablehome.EventType) *pb.StreamEventsRequest {
+	reply := &pb.StreamEventsRequest{
+		Device: devices,
+	}
+	if types != nil {
+		reply.Type = make([]pb.EventType, len(types))
+		for i, t := range types {
+			reply.Type[i] = pb.EventType(t)
+		}
+	}
+	return reply
+}
+
+// toProtobufTimestamp returns nil for a zero time
+func toProtobufTimestamp(value time.Time) *timestamp.Timestamp {
+	if value.IsZero() {
+		return nil
+	} else if ts, err := ptypes.TimestampProto(value); err != nil {
+		return nil
+	} else {
+		return ts
+	}
+}
+
+func toProtobufValue(value mutablehome.StoreValue) *pb.Value {
+	if value == nil {
+		return nil
+	}
+	return &pb.Value{
+		Ts:    toProtobufTimestamp(value.Time()),
+		Trait: pb.TraitType(value.Trait()),
+		Value: value.Value(),
+	}
+}
+
+func toProtobufHistoryResponse(values []mutablehome.StoreValue) *pb.HistoryResponse {
+	reply := make([]*pb.Value, len(values))
+	for i, value := range values {
+		reply[i] = toProtobufValue(value)
+	}
+	return &pb.HistoryResponse{
+		Value: reply,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// FROM PROTOBUF
+
+// durationFromProto returns zero for a missing duration
+func durationFromProto(proto *duration.Duration) (time.Duration, error) {
+	if proto == nil {
+		return 0, nil
+	}
+	return ptypes.Duration(proto)
+}
+
+// timestampFromProto returns a zero time for a missing timestamp
+func timestampFromProto(proto *timestamp.Timestamp) (time.Time, error) {
+	if proto == nil {
+		return time.Time{}, nil
+	}
+	return ptypes.Timestamp(proto)
+}
+
+func fromProtobufValue(proto *pb.Value) mutablehome.StoreValue {
+	if proto == nil {
+		return nil
+	}
+	return &value{proto}
+}
+
+func fromProtobufHistoryResponse(proto *pb.HistoryResponse) []mutablehome.StoreValue {
+	if proto == nil {
+		return nil
+	}
+	values := make([]mutablehome.StoreValue, len(proto.Value))
+	for i, value := range proto.Value {
+		values[i] = fromProtobufValue(value)
+	}
+	return values
+}
+
+func fromProtobufMetadataResponse(proto *pb.MetadataResponse) mutablehome.NodeMetadata {
+	if proto == nil {
+		return nil
+	}
+	return &metadata{proto}
+}
+
+func fromProtobufDevicesResponse(proto *pb.DevicesResponse) []mutablehome.RemoteDevice {
+	if proto == nil {
+		return nil
+	}
+	devices := make([]mutablehome.RemoteDevice, len(proto.Device))
+	for i, device := range proto.Device {
+		devices[i] = fromProtobufDevice(device)
+	}
+	return devices
+}
+
+func fromProtobufDevice(proto *pb.Device) mutablehome.RemoteDevice {
+	if proto == nil {
+		return nil
+	}
+	return &device{proto}
+}
+
+func fromProtobufEvent(source gopi.Unit, proto *pb.Event) mutablehome.RemoteEvent {
+	if proto == nil {
+		return nil
+	}
+	return &event{source, proto}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NodeMetadata IMPLEMENTATION
+
+type metadata struct {
+	pb *pb.MetadataResponse
+}
+
+func (this *metadata) Id() string {
+	return this.pb.Id
+}
+
+func (this *metadata) Name() string {
+	return this.pb.Name
+}
+
+func (this *metadata) Uptime() time.Duration {
+	if uptime, err := durationFromProto(this.pb.Uptime); err != nil {
+		return 0
+	} else {
+		return uptime
+	}
+}
+
+func (this *metadata) String() string {
+	return "<mutablehome.Metadata id=" + strconv.Quote(this.Id()) + " name=" + strconv.Quote(this.Name()) + " uptime=" + fmt.Sprint(this.Uptime().Truncate(time.Second)) + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RemoteDevice IMPLEMENTATION
+
+type device struct {
+	pb *pb.Device
+}
+
+func (this *device) Id() string {
+	return this.pb.Id
+}
+
+func (this *device) Name() string {
+	return this.pb.Name
+}
+
+func (this *device) Traits() []mutablehome.TraitType {
+	traits := make([]mutablehome.TraitType, len(this.pb.Traits))
+	for i, trait := range this.pb.Traits {
+		traits[i] = mutablehome.TraitType(trait)
+	}
+	return traits
+}
+
+func (this *device) Power() mutablehome.TraitType {
+	return mutablehome.TraitType(this.pb.Power)
+}
+
+func (this *device) Brightness() float32 {
+	return this.pb.Brightness
+}
+
+func (this *device) Position() float32 {
+	return this.pb.Position
+}
+
+func (this *device) BatteryLevel() float32 {
+	return this.pb.Battery
+}
+
+func (this *device) CleanMode() mutablehome.VacuumMode {
+	return mutablehome.VacuumMode(this.pb.CleanMode)
+}
+
+func (this *device) Suction() mutablehome.VacuumSuction {
+	return mutablehome.VacuumSuction(this.pb.Suction)
+}
+
+func (this *device) Charging() bool {
+	return this.pb.Charging
+}
+
+func (this *device) LifeSpan() map[string]float32 {
+	return this.pb.Lifespan
+}
+
+func (this *device) String() string {
+	return "<mutablehome.Device id=" + strconv.Quote(this.Id()) + " name=" + strconv.Quote(this.Name()) + " traits=" + fmt.Sprint(this.Traits()) + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// StoreValue IMPLEMENTATION
+
+type value struct {
+	pb *pb.Value
+}
+
+func (this *value) Time() time.Time {
+	if ts, err := timestampFromProto(this.pb.Ts); err != nil {
+		return time.Time{}
+	} else {
+		return ts
+	}
+}
+
+func (this *value) Trait() mutablehome.TraitType {
+	return mutablehome.TraitType(this.pb.Trait)
+}
+
+func (this *value) Value() float32 {
+	return this.pb.Value
+}
+
+func (this *value) String() string {
+	return "<mutablehome.Value trait=" + fmt.Sprint(this.Trait()) + " value=" + fmt.Sprint(this.Value()) + " ts=" + this.Time().Format(time.RFC3339) + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RemoteEvent IMPLEMENTATION
+
+type event struct {
+	source gopi.Unit
+	pb     *pb.Event
+}
+
+func (*event) Name() string {
+	return "mutablehome.Event"
+}
+
+func (*event) NS() gopi.EventNS {
+	return gopi.EVENT_NS_DEFAULT
+}
+
+func (this *event) Source() gopi.Unit {
+	return this.source
+}
+
+func (this *event) Value() interface{} {
+	return this.Device()
+}
+
+func (this *event) Type() mutablehome.EventType {
+	return mutablehome.EventType(this.pb.Type)
+}
+
+func (*event) Node() mutablehome.Node {
+	return nil
+}
+
+func (this *event) NodeId() string {
+	return this.pb.Node
+}
+
+func (this *event) Device() mutablehome.Device {
+	if this.pb.Device == nil {
+		return nil
+	} else {
+		return fromProtobufDevice(this.pb.Device)
+	}
+}
+
+func (this *event) Traits() []mutablehome.TraitType {
+	traits := make([]mutablehome.TraitType, len(this.pb.Traits))
+	for i, trait := range this.pb.Traits {
+		traits[i] = mutablehome.TraitType(trait)
+	}
+	return traits
+}
+
+func (this *event) String() string {
+	str := "<" + this.Name()
+	str += " type=" + fmt.Sprint(this.Type())
+	if this.pb.Node != "" {
+		str += " node=" + strconv.Quote(this.pb.Node)
+	}
+	if device := this.Device(); device != nil {
+		str += " device=" + fmt.Sprint(device)
+	}
+	if len(this.pb.Traits) > 0 {
+		str += " traits=" + fmt.Sprint(this.Traits())
+	}
+	return str + ">"
+}
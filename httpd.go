@@ -9,6 +9,7 @@ package mutablehome
 
 import (
 	"context"
+	"net/http"
 	"net/url"
 
 	// Frameworks
@@ -24,6 +25,10 @@ type HttpServer interface {
 	// of the files being served
 	ServeStatic(string) (*url.URL, error)
 
+	// Serve requests for a path with a handler, returns the URL
+	// for the path
+	Handle(string, http.Handler) (*url.URL, error)
+
 	// Stop serving with context
 	Stop(context.Context) error
 
@@ -0,0 +1,30 @@
+/*
+	Mutablehome Automation: InfluxDB
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mutablehome
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// InfluxDB writes trait changes from nodes as points to an InfluxDB
+// server in batches, tagged with node and device ids. Points are
+// buffered while the server is unreachable
+type InfluxDB interface {
+	// AddNode writes points for events emitted by the node
+	AddNode(Node) error
+
+	// Flush writes buffered points to the server
+	Flush() error
+
+	// Implements gopi.Unit
+	gopi.Unit
+}
@@ -0,0 +1,77 @@
+/*
+	Mutablehome Automation: Metrics
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mutablehome
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type MetricType uint
+
+// Metric is a gauge or counter value, where metrics with the same
+// name are distinguished by their labels
+type Metric struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels map[string]string
+	Value  float64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// MetricsSource is implemented by units which publish operational
+// counters and gauges which are not device traits
+type MetricsSource interface {
+	// Metrics returns current values
+	Metrics() []Metric
+}
+
+// Metrics publishes trait values for devices and values from sources
+// in the Prometheus text format
+type Metrics interface {
+	// AddNode publishes trait values for devices of a node, labelled
+	// by node and device
+	AddNode(Node) error
+
+	// AddSource publishes values from a source
+	AddSource(MetricsSource) error
+
+	// Implements gopi.Unit
+	gopi.Unit
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	METRIC_NONE MetricType = iota
+	METRIC_GAUGE
+	METRIC_COUNTER
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (v MetricType) String() string {
+	switch v {
+	case METRIC_NONE:
+		return "METRIC_NONE"
+	case METRIC_GAUGE:
+		return "METRIC_GAUGE"
+	case METRIC_COUNTER:
+		return "METRIC_COUNTER"
+	default:
+		return "[?? Invalid MetricType value]"
+	}
+}
@@ -0,0 +1,28 @@
+/*
+	Mutablehome Automation: MQTT
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mutablehome
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// MQTTBridge publishes retained state for devices of nodes to an MQTT
+// broker with Home Assistant discovery config, an availability topic for
+// each node, and sets power and brightness from command topics
+type MQTTBridge interface {
+	// AddNode publishes state for devices of a node and subscribes
+	// to commands for them
+	AddNode(Node) error
+
+	// Implements gopi.Unit
+	gopi.Unit
+}
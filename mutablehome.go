@@ -9,6 +9,8 @@ package mutablehome
 
 import (
 	"context"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/djthorpe/gopi/v2"
@@ -18,8 +20,11 @@ import (
 // TYPES
 
 type (
-	EventType uint
-	TraitType uint
+	EventType     uint
+	TraitType     uint
+	DeviceClass   uint
+	VacuumMode    uint
+	VacuumSuction uint
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -33,6 +38,7 @@ type Node interface {
 	Id() string           // Unique Id for the node
 	Name() string         // Textual description of the node
 	Device(string) Device // Return device with Id
+	Devices() []Device    // Return all devices, sorted by Id
 }
 
 // Device is a device which can be observed or controlled
@@ -42,6 +48,14 @@ type Device interface {
 	Traits() []TraitType // Capabilities for the device
 }
 
+// ClassDevice is a device which declares its class, rather than the
+// class being inferred from its traits
+type ClassDevice interface {
+	Device
+
+	Class() DeviceClass // Return the class of device
+}
+
 // PowerTrait represents a device which can be switched on, off or toggled
 type PowerTrait interface {
 	Device
@@ -58,6 +72,43 @@ type LightTrait interface {
 	SetBrightness(float32, time.Duration) error // Set brightness between 0.0 and 1.0 and a transition time
 }
 
+// CoverTrait represents a device such as a blind which can be opened or closed
+type CoverTrait interface {
+	Device
+
+	Position() float32         // Return position between 0.0 (closed) and 1.0 (open)
+	SetPosition(float32) error // Set position between 0.0 (closed) and 1.0 (open)
+	Stop() error               // Stop movement
+}
+
+// BatteryTrait represents a device which is battery powered
+type BatteryTrait interface {
+	Device
+
+	BatteryLevel() float32 // Return battery level between 0.0 and 1.0
+}
+
+// VacuumTrait represents a robot vacuum cleaner which cleans in one
+// of several modes and returns to a dock to charge
+type VacuumTrait interface {
+	Device
+
+	CleanMode() VacuumMode                 // Return the clean mode, or NONE if unknown
+	Suction() VacuumSuction                // Return the suction power, or NONE if unknown
+	Clean(VacuumMode, VacuumSuction) error // Start cleaning, or stop cleaning with VACUUM_MODE_STOP
+	Charging() bool                        // Return true when docked and charging
+	Dock() error                           // Return to the dock and charge
+	LifeSpan() map[string]float32          // Return remaining lifespan of consumable parts between 0.0 and 1.0
+}
+
+// RemoteEvent is an event received from a remote node, where Node()
+// returns nil and Device() returns a RemoteDevice with the new values
+type RemoteEvent interface {
+	Event
+
+	NodeId() string // Return the unique ID for the remote node
+}
+
 // Event is emitted when a device changes or node is online or offline
 // of type mutablehome.Event
 type Event interface {
@@ -69,17 +120,98 @@ type Event interface {
 	Traits() []TraitType
 }
 
+// RPCNodeService serves a node to remote clients
+type RPCNodeService interface {
+	gopi.RPCService
+
+	// SetNode sets the node which is served
+	SetNode(Node) error
+
+	// SetStore sets the store which is queried for device history
+	SetStore(Store) error
+}
+
+// Hub is a node which aggregates the devices of remote nodes discovered
+// on the local network, where each device has an id node-id/device-id
+type Hub interface {
+	Node
+
+	Nodes() []string // Return unique IDs for connected remote nodes
+}
+
 // NodeStub represents a connection to a remote mutablehome node
 type NodeStub interface {
 	gopi.RPCClientStub
 
 	// Ping returns without error if the remote service is running
 	Ping(context.Context) error
+
+	// Metadata returns the id, name and uptime for the remote node
+	Metadata(context.Context) (NodeMetadata, error)
+
+	// Devices returns the devices for the remote node
+	Devices(context.Context) ([]RemoteDevice, error)
+
+	// Device returns a device by id
+	Device(context.Context, string) (RemoteDevice, error)
+
+	// SetPower sets power ON, OFF, STANDBY or TOGGLE for a device
+	SetPower(context.Context, string, TraitType) (RemoteDevice, error)
+
+	// SetBrightness sets brightness between 0.0 and 1.0 for a device
+	// with a transition time
+	SetBrightness(context.Context, string, float32, time.Duration) (RemoteDevice, error)
+
+	// SetPosition sets cover position between 0.0 (closed) and 1.0 (open)
+	// for a device
+	SetPosition(context.Context, string, float32) (RemoteDevice, error)
+
+	// Stop stops cover movement for a device
+	Stop(context.Context, string) (RemoteDevice, error)
+
+	// StreamEvents emits events from the remote node as RemoteEvent until
+	// the context is cancelled, optionally filtered by device id and event type
+	StreamEvents(context.Context, []string, []EventType) error
+
+	// Subscribe returns a channel for events emitted by StreamEvents
+	Subscribe() <-chan interface{}
+
+	// Unsubscribe from events emitted by StreamEvents
+	Unsubscribe(<-chan interface{})
+
+	// LastValue returns the last value recorded for a device trait
+	LastValue(context.Context, string, TraitType) (StoreValue, error)
+
+	// History returns values recorded for a device trait between
+	// two times, where a zero time is unbounded
+	History(context.Context, string, TraitType, time.Time, time.Time) ([]StoreValue, error)
+}
+
+// NodeMetadata describes a remote node
+type NodeMetadata interface {
+	Id() string            // Unique ID for the node
+	Name() string          // Name for the node
+	Uptime() time.Duration // How long the node has been running for
+}
+
+// RemoteDevice represents the state of a device on a remote node
+type RemoteDevice interface {
+	Device
+
+	Power() TraitType      // Return ON, OFF or STANDBY or NONE if unknown
+	Brightness() float32   // Return brightness between 0.0 and 1.0
+	Position() float32     // Return position between 0.0 (closed) and 1.0 (open)
+	BatteryLevel() float32 // Return battery level between 0.0 and 1.0
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // CONSTANTS
 
+const (
+	// Service type which nodes are registered as on the local network
+	SERVICE_TYPE_NODE = "_mutablehome._tcp"
+)
+
 const (
 	TRAIT_NONE TraitType = iota
 	TRAIT_POWER_ON
@@ -90,6 +222,42 @@ const (
 	TRAIT_LIGHT_TEMPERATURE
 	TRAIT_LIGHT_COLOR
 	TRAIT_LIGHT_TRANSITION
+	TRAIT_COVER_POSITION
+	TRAIT_BATTERY_LEVEL
+	TRAIT_SENSOR_ACTIVITY
+	TRAIT_VACUUM_CLEAN_MODE
+	TRAIT_VACUUM_SUCTION
+	TRAIT_VACUUM_CHARGE
+	TRAIT_VACUUM_LIFESPAN
+	TRAIT_MAX = TRAIT_VACUUM_LIFESPAN
+)
+
+const (
+	DEVICE_CLASS_NONE DeviceClass = iota
+	DEVICE_CLASS_LIGHT
+	DEVICE_CLASS_SWITCH
+	DEVICE_CLASS_COVER
+	DEVICE_CLASS_SENSOR
+	DEVICE_CLASS_VACUUM
+	DEVICE_CLASS_MEDIA_PLAYER
+	DEVICE_CLASS_MAX = DEVICE_CLASS_MEDIA_PLAYER
+)
+
+const (
+	VACUUM_MODE_NONE VacuumMode = iota
+	VACUUM_MODE_STOP
+	VACUUM_MODE_AUTO
+	VACUUM_MODE_BORDER
+	VACUUM_MODE_SPOT
+	VACUUM_MODE_ROOM
+	VACUUM_MODE_MAX = VACUUM_MODE_ROOM
+)
+
+const (
+	VACUUM_SUCTION_NONE VacuumSuction = iota
+	VACUUM_SUCTION_STANDARD
+	VACUUM_SUCTION_STRONG
+	VACUUM_SUCTION_MAX = VACUUM_SUCTION_STRONG
 )
 
 const (
@@ -100,8 +268,43 @@ const (
 	EVENT_DEVICE_REMOVED
 	EVENT_DEVICE_METADATA_CHANGED
 	EVENT_DEVICE_TRAIT_CHANGED
+	EVENT_MAX = EVENT_DEVICE_TRAIT_CHANGED
 )
 
+////////////////////////////////////////////////////////////////////////////////
+// TRAITS
+
+// HasTrait returns true if trait is in the list of traits
+func HasTrait(traits []TraitType, trait TraitType) bool {
+	for _, t := range traits {
+		if t == trait {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PARSE
+
+// ParsePower returns TRAIT_POWER_ON, OFF, STANDBY or TOGGLE for a value
+// with or without the TRAIT_POWER_ or POWER_ prefix, ignoring case
+func ParsePower(value string) (TraitType, error) {
+	name := strings.TrimPrefix(strings.ToUpper(value), "TRAIT_")
+	switch strings.TrimPrefix(name, "POWER_") {
+	case "ON":
+		return TRAIT_POWER_ON, nil
+	case "OFF":
+		return TRAIT_POWER_OFF, nil
+	case "STANDBY":
+		return TRAIT_POWER_STANDBY, nil
+	case "TOGGLE":
+		return TRAIT_POWER_TOGGLE, nil
+	default:
+		return TRAIT_NONE, gopi.ErrBadParameter.WithPrefix(strconv.Quote(value))
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
@@ -146,29 +349,74 @@ func (v TraitType) String() string {
 		return "TRAIT_LIGHT_COLOR"
 	case TRAIT_LIGHT_TRANSITION:
 		return "TRAIT_LIGHT_TRANSITION"
+	case TRAIT_COVER_POSITION:
+		return "TRAIT_COVER_POSITION"
+	case TRAIT_BATTERY_LEVEL:
+		return "TRAIT_BATTERY_LEVEL"
+	case TRAIT_SENSOR_ACTIVITY:
+		return "TRAIT_SENSOR_ACTIVITY"
+	case TRAIT_VACUUM_CLEAN_MODE:
+		return "TRAIT_VACUUM_CLEAN_MODE"
+	case TRAIT_VACUUM_SUCTION:
+		return "TRAIT_VACUUM_SUCTION"
+	case TRAIT_VACUUM_CHARGE:
+		return "TRAIT_VACUUM_CHARGE"
+	case TRAIT_VACUUM_LIFESPAN:
+		return "TRAIT_VACUUM_LIFESPAN"
 	default:
 		return "[?? Invalid TraitType value]"
 	}
 }
 
-////////////////////////////////////////////////////////////////////////////////
-// INFLUXDB (old code)
-
-type InfluxDB interface {
-	// Create a new resultset
-	NewResultSet(tags map[string]string) InfluxRS
-
-	// Write rows to the database
-	Write(InfluxRS) error
+func (v DeviceClass) String() string {
+	switch v {
+	case DEVICE_CLASS_NONE:
+		return "DEVICE_CLASS_NONE"
+	case DEVICE_CLASS_LIGHT:
+		return "DEVICE_CLASS_LIGHT"
+	case DEVICE_CLASS_SWITCH:
+		return "DEVICE_CLASS_SWITCH"
+	case DEVICE_CLASS_COVER:
+		return "DEVICE_CLASS_COVER"
+	case DEVICE_CLASS_SENSOR:
+		return "DEVICE_CLASS_SENSOR"
+	case DEVICE_CLASS_VACUUM:
+		return "DEVICE_CLASS_VACUUM"
+	case DEVICE_CLASS_MEDIA_PLAYER:
+		return "DEVICE_CLASS_MEDIA_PLAYER"
+	default:
+		return "[?? Invalid DeviceClass value]"
+	}
 }
 
-type InfluxRS interface {
-	// Remove all rows
-	RemoveAll()
-
-	// Add a new row of metrics for a measurement name
-	Add(string, map[string]interface{}) error
+func (v VacuumMode) String() string {
+	switch v {
+	case VACUUM_MODE_NONE:
+		return "VACUUM_MODE_NONE"
+	case VACUUM_MODE_STOP:
+		return "VACUUM_MODE_STOP"
+	case VACUUM_MODE_AUTO:
+		return "VACUUM_MODE_AUTO"
+	case VACUUM_MODE_BORDER:
+		return "VACUUM_MODE_BORDER"
+	case VACUUM_MODE_SPOT:
+		return "VACUUM_MODE_SPOT"
+	case VACUUM_MODE_ROOM:
+		return "VACUUM_MODE_ROOM"
+	default:
+		return "[?? Invalid VacuumMode value]"
+	}
+}
 
-	// Add a new row of metrics using timestamp for a measurement name
-	AddTS(string, map[string]interface{}, time.Time) error
+func (v VacuumSuction) String() string {
+	switch v {
+	case VACUUM_SUCTION_NONE:
+		return "VACUUM_SUCTION_NONE"
+	case VACUUM_SUCTION_STANDARD:
+		return "VACUUM_SUCTION_STANDARD"
+	case VACUUM_SUCTION_STRONG:
+		return "VACUUM_SUCTION_STRONG"
+	default:
+		return "[?? Invalid VacuumSuction value]"
+	}
 }
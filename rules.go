@@ -0,0 +1,37 @@
+/*
+	Mutablehome Automation: Rules
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mutablehome
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// Rules evaluates automation rules which are loaded from a file
+// when events are emitted by nodes, and performs actions on devices
+type Rules interface {
+	// AddNode evaluates rules on events from a node, and allows
+	// actions to be performed on devices for the node
+	AddNode(Node) error
+
+	// Reload rules from the file, keeping the existing rules
+	// if the file cannot be parsed
+	Reload() error
+
+	// Rules returns the names of the rules which are loaded
+	Rules() []string
+
+	// DryRun returns true if actions are logged but not performed
+	DryRun() bool
+
+	// Implements gopi.Unit
+	gopi.Unit
+}
@@ -0,0 +1,47 @@
+/*
+	Mutablehome Automation: Scheduler
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mutablehome
+
+import (
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// Scheduler performs actions on devices at fixed times, on cron
+// expressions or on solar events such as sunrise and sunset, and emits
+// a ScheduleEvent each time a schedule is run
+type Scheduler interface {
+	// AddNode allows actions to be performed on devices for the node
+	AddNode(Node) error
+
+	// Schedules returns the names of the schedules which are loaded
+	Schedules() []string
+
+	// Next returns the time a schedule will next run, or zero if it
+	// will not run again
+	Next(string) time.Time
+
+	// Run performs the actions for a schedule immediately
+	Run(string) error
+
+	// Implements gopi.PubSub
+	gopi.PubSub
+}
+
+// ScheduleEvent is emitted when a schedule is run
+type ScheduleEvent interface {
+	gopi.Event
+
+	Schedule() string // Name of the schedule
+	Time() time.Time  // Time the schedule was due to run
+}
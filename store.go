@@ -0,0 +1,57 @@
+/*
+	Mutablehome Automation: State Store
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mutablehome
+
+import (
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// INTERFACES
+
+// Store records the latest metadata and trait values for devices, and
+// a bounded history of values for each trait, in a local file so that
+// state is kept across restarts. Power is recorded as a single series
+// which can be queried with any power trait
+type Store interface {
+	// AddNode records state for devices as events are emitted by the node
+	AddNode(Node) error
+
+	// Devices returns the latest known state for all devices
+	Devices() []StoreDevice
+
+	// Device returns the latest known state for a device, or nil
+	Device(string) StoreDevice
+
+	// Last returns the last value recorded for a device trait, or nil
+	Last(string, TraitType) StoreValue
+
+	// Between returns values recorded for a device trait between two
+	// times, where a zero time is unbounded
+	Between(string, TraitType, time.Time, time.Time) []StoreValue
+
+	// Implements gopi.Unit
+	gopi.Unit
+}
+
+// StoreDevice is the latest known state for a device
+type StoreDevice interface {
+	RemoteDevice
+
+	Updated() time.Time // Time the device was last updated
+}
+
+// StoreValue is a value recorded for a device trait
+type StoreValue interface {
+	Time() time.Time  // Time the value was recorded
+	Trait() TraitType // Trait, which is ON, OFF or STANDBY for power
+	Value() float32   // Value between 0.0 and 1.0, or 1.0 for power on and activity
+}
@@ -1,48 +1,79 @@
+/*
+	Mutablehome Automation: InfluxDB
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
 package influxdb
 
 import (
-	// Frameworks
-
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
+	// Frameworks
 	gopi "github.com/djthorpe/gopi/v2"
 	base "github.com/djthorpe/gopi/v2/base"
-	"github.com/djthorpe/mutablehome"
-
-	// InfluxDB Client
-	_ "github.com/influxdata/influxdb1-client"
-	db "github.com/influxdata/influxdb1-client/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 // TYPES
 
+// InfluxDB writes to a database for InfluxDB 1.x, or to a bucket for
+// InfluxDB 2.x when Bucket is set
 type InfluxDB struct {
-	Addr       string
-	User       string
-	Password   string
-	Timeout    time.Duration
-	SkipVerify bool
-	Database   string
+	Addr        string        // Server address
+	User        string        // Username for 1.x
+	Password    string        // Password for 1.x
+	Database    string        // Database for 1.x
+	Token       string        // Token for 2.x
+	Org         string        // Organization for 2.x
+	Bucket      string        // Bucket for 2.x
+	Measurement string        // Measurement name
+	Timeout     time.Duration // Timeout for writes
+	SkipVerify  bool          // Skip https certificate verification
+	BatchSize   uint          // Maximum number of points in each write
+	Interval    time.Duration // Interval between writes
+	Buffer      string        // Path for buffering points while unreachable
+	MaxPoints   uint          // Maximum number of points buffered
 }
 
 type influxdb struct {
-	client   db.Client
-	database string
-
 	base.Unit
-}
+	sync.Mutex
+	sync.WaitGroup
 
-type resultset struct {
-	database string
-	tags     map[string]string
-	rows     db.BatchPoints
+	writer      *writer
+	measurement string
+	batchsize   int
+	interval    time.Duration
+	buffer      string
+	maxpoints   int
+	queue       []string
+	buffered    bool
+	nodes       map[string]bool
+	flush       sync.Mutex
+	full        chan struct{}
+	stop        chan struct{}
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	DEFAULT_MEASUREMENT = "mutablehome"
+	DEFAULT_BATCHSIZE   = 100
+	DEFAULT_INTERVAL    = 10 * time.Second
+	DEFAULT_MAXPOINTS   = 100000
+)
+
 ////////////////////////////////////////////////////////////////////////////////
 // IMPLEMENTATION gopi.Unit
 
-func (InfluxDB) Name() string { return "influxdb/v1" }
+func (InfluxDB) Name() string { return "mutablehome/influxdb" }
 
 func (config InfluxDB) New(log gopi.Logger) (gopi.Unit, error) {
 	this := new(influxdb)
@@ -56,121 +87,247 @@ func (config InfluxDB) New(log gopi.Logger) (gopi.Unit, error) {
 }
 
 func (this *influxdb) Init(config InfluxDB) error {
-	if client, err := db.NewHTTPClient(db.HTTPConfig{
-		Addr:               config.Addr,
-		Username:           config.User,
-		Password:           config.Password,
-		Timeout:            config.Timeout,
-		InsecureSkipVerify: config.SkipVerify,
-	}); err != nil {
+	// Create writer
+	if writer, err := NewWriter(config); err != nil {
 		return err
 	} else {
-		this.client = client
+		this.writer = writer
 	}
 
-	if config.Database == "" {
-		return gopi.ErrBadParameter.WithPrefix("database")
-	} else {
-		this.database = config.Database
+	// Set parameters
+	this.measurement = DEFAULT_MEASUREMENT
+	if config.Measurement != "" {
+		this.measurement = config.Measurement
+	}
+	this.batchsize = DEFAULT_BATCHSIZE
+	if config.BatchSize > 0 {
+		this.batchsize = int(config.BatchSize)
+	}
+	this.interval = DEFAULT_INTERVAL
+	if config.Interval > 0 {
+		this.interval = config.Interval
+	}
+	this.maxpoints = DEFAULT_MAXPOINTS
+	if config.MaxPoints > 0 {
+		this.maxpoints = int(config.MaxPoints)
 	}
 
-	// Ping client
-	if _, _, err := this.client.Ping(config.Timeout); err != nil {
-		return err
+	// Read points which were buffered before the last restart
+	this.buffer = config.Buffer
+	if this.buffer != "" {
+		if lines, err := readBuffer(this.buffer); err != nil {
+			return err
+		} else if len(lines) > 0 {
+			this.Log.Info("Read", len(lines), "buffered points from", strconv.Quote(this.buffer))
+			this.queue = lines
+			this.buffered = true
+		}
 	}
 
+	// Write points in the background
+	this.nodes = make(map[string]bool)
+	this.full = make(chan struct{}, 1)
+	this.stop = make(chan struct{})
+	this.WaitGroup.Add(1)
+	go this.BackgroundProcess(this.stop)
+
 	// Success
 	return nil
 }
 
 func (this *influxdb) Close() error {
+	// Stop background processes and wait for them to end
+	close(this.stop)
+	this.WaitGroup.Wait()
 
-	if this.client != nil {
-		this.client.Close()
+	// Write remaining points, which are buffered if the server
+	// is unreachable
+	if err := this.Flush(); err != nil {
+		this.Log.Warn(err)
 	}
 
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
 	// Release resources
-	this.client = nil
+	this.writer.Close()
+	this.writer = nil
+	this.queue = nil
+	this.nodes = nil
+	this.stop = nil
+	this.full = nil
 
-	// Return success
+	// Success
 	return this.Unit.Close()
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// IMPLEMENTATION mutablehome.InfluxDB
+// STRINGIFY
 
-// Create ResultSet object
-func (this *influxdb) NewResultSet(tags map[string]string) mutablehome.InfluxRS {
-	if len(tags) == 0 {
-		return nil
-	} else {
-		return &resultset{this.database, tags, nil}
+func (this *influxdb) String() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	str := "<" + this.Log.Name()
+	str += " writer=" + fmt.Sprint(this.writer)
+	str += " measurement=" + strconv.Quote(this.measurement)
+	str += " batchsize=" + fmt.Sprint(this.batchsize)
+	str += " interval=" + fmt.Sprint(this.interval)
+	if this.buffer != "" {
+		str += " buffer=" + strconv.Quote(this.buffer)
 	}
+	str += " queue=" + fmt.Sprint(len(this.queue))
+	return str + ">"
 }
 
-// Write ResultSet to database, empty points after written without error
-func (this *influxdb) Write(rs mutablehome.InfluxRS) error {
-	if rs_, ok := rs.(*resultset); ok == false {
-		return gopi.ErrBadParameter.WithPrefix("resultset")
-	} else if rs_.rows == nil {
-		return gopi.ErrNotFound.WithPrefix("resultset")
-	} else if err := this.client.Write(rs_.rows); err != nil {
-		return err
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.InfluxDB
+
+func (this *influxdb) AddNode(node mutablehome.Node) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if node == nil {
+		return gopi.ErrBadParameter.WithPrefix("node")
+	} else if _, exists := this.nodes[node.Id()]; exists {
+		return gopi.ErrDuplicateItem.WithPrefix(strconv.Quote(node.Id()))
 	} else {
-		rs.RemoveAll()
-		return nil
+		this.nodes[node.Id()] = true
 	}
-}
 
-// Empty fields from resultset (retaining tags)
-func (this *resultset) RemoveAll() {
-	this.rows = nil
+	// Write points for node events
+	this.WaitGroup.Add(1)
+	go this.EventProcess(node, node.Subscribe(), this.stop)
+
+	// Success
+	return nil
 }
 
-// Add data using InfluxDB timestamp
-func (this *resultset) Add(measurement string, fields map[string]interface{}) error {
-	// Create BatchPoints
-	if this.rows == nil {
-		if rows, err := db.NewBatchPoints(db.BatchPointsConfig{
-			Database: this.database,
-		}); err != nil {
-			return err
+// Flush writes queued points in batches. Points which are not written
+// remain queued, and are written to the buffer file so that they are
+// kept across restarts. The oldest points are dropped when more
+// than the maximum number of points are queued
+func (this *influxdb) Flush() error {
+	this.flush.Lock()
+	defer this.flush.Unlock()
+
+	this.Mutex.Lock()
+	lines := this.queue
+	this.Mutex.Unlock()
+
+	// Write batches until an error occurs
+	var result error
+	sent := 0
+	for sent < len(lines) {
+		end := sent + this.batchsize
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if err := this.writer.Write(lines[sent:end]); err == nil {
+			sent = end
+		} else if _, ok := err.(*rejected); ok {
+			this.Log.Error(fmt.Errorf("Dropped %v points: %w", end-sent, err))
+			sent = end
 		} else {
-			this.rows = rows
+			result = err
+			break
 		}
 	}
 
-	// Append points
-	if pt, err := db.NewPoint(measurement, this.tags, fields); err != nil {
-		return err
-	} else {
-		this.rows.AddPoint(pt)
+	// Remove written points from the queue
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.queue = this.queue[sent:]
+	if drop := len(this.queue) - this.maxpoints; drop > 0 {
+		this.Log.Warn("Dropped", drop, "buffered points")
+		this.queue = this.queue[drop:]
+	}
+	if len(this.queue) == 0 {
+		this.queue = nil
 	}
 
-	// Return success
-	return nil
+	// Update the buffer file when there are unwritten points, or when
+	// all buffered points have been written
+	if this.buffer != "" && (result != nil || this.buffered) {
+		if err := writeBuffer(this.buffer, this.queue); err != nil {
+			this.Log.Error(err)
+		} else {
+			this.buffered = len(this.queue) > 0
+		}
+	}
+
+	// Return any error
+	return result
 }
 
-// Add data with timestamp
-func (this *resultset) AddTS(measurement string, fields map[string]interface{}, timestamp time.Time) error {
-	// Create BatchPoints
-	if this.rows == nil {
-		if rows, err := db.NewBatchPoints(db.BatchPointsConfig{
-			Database: this.database,
-		}); err != nil {
-			return err
-		} else {
-			this.rows = rows
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND PROCESSES
+
+// BackgroundProcess writes queued points on an interval, or when
+// a batch of points is queued
+func (this *influxdb) BackgroundProcess(stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+
+	this.Log.Debug("Start of background process")
+	ticker := time.NewTicker(this.interval)
+	failed := false
+FOR_LOOP:
+	for {
+		select {
+		case <-ticker.C:
+			failed = this.flushWithLog(failed)
+		case <-this.full:
+			if failed == false {
+				failed = this.flushWithLog(failed)
+			}
+		case <-stop:
+			ticker.Stop()
+			break FOR_LOOP
 		}
 	}
+	this.Log.Debug("End of background process")
+}
 
-	// Append points
-	if pt, err := db.NewPoint(measurement, this.tags, fields, timestamp); err != nil {
-		return err
-	} else {
-		this.rows.AddPoint(pt)
+// EventProcess queues points for node events until the unit is
+// closed or the node stops emitting events
+func (this *influxdb) EventProcess(node mutablehome.Node, evts <-chan interface{}, stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+	mutablehome.ProcessEvents(node, evts, stop, func(evt mutablehome.Event) {
+		if line, err := NewPoint(this.measurement, mutablehome.NodeId(node, evt), evt, time.Now()); err != nil {
+			this.Log.Warn(err)
+		} else if line != "" {
+			this.add(line)
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// add queues a point and signals when a batch is queued
+func (this *influxdb) add(line string) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	this.queue = append(this.queue, line)
+	if len(this.queue) >= this.batchsize {
+		select {
+		case this.full <- struct{}{}:
+		default:
+		}
 	}
+}
 
-	// Return success
-	return nil
+// flushWithLog writes points and logs when the server becomes
+// unreachable or reachable again, and returns true if writing failed
+func (this *influxdb) flushWithLog(failed bool) bool {
+	if err := this.Flush(); err != nil {
+		if failed == false {
+			this.Log.Warn("Buffering points:", err)
+		}
+		return true
+	} else if failed {
+		this.Log.Info("Server is reachable")
+	}
+	return false
 }
@@ -0,0 +1,296 @@
+package influxdb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NODE, DEVICES AND EVENTS
+
+type node struct {
+	base.PubSub
+}
+
+func (*node) Id() string                       { return "node" }
+func (*node) Name() string                     { return "Node" }
+func (*node) Device(string) mutablehome.Device { return nil }
+func (*node) Devices() []mutablehome.Device    { return nil }
+
+type light struct {
+	id         string
+	name       string
+	power      mutablehome.TraitType
+	brightness float32
+}
+
+func (this *light) Id() string                                 { return this.id }
+func (this *light) Name() string                               { return this.name }
+func (this *light) Power() mutablehome.TraitType               { return this.power }
+func (this *light) SetPower(mutablehome.TraitType) error       { return gopi.ErrNotImplemented }
+func (this *light) Brightness() float32                        { return this.brightness }
+func (this *light) SetBrightness(float32, time.Duration) error { return gopi.ErrNotImplemented }
+func (this *light) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_LIGHT_BRIGHTNESS}
+}
+
+type event struct {
+	t      mutablehome.EventType
+	device mutablehome.Device
+	traits []mutablehome.TraitType
+}
+
+func (*event) Name() string                         { return "mutablehome.Event" }
+func (*event) NS() gopi.EventNS                     { return gopi.EVENT_NS_DEFAULT }
+func (*event) Source() gopi.Unit                    { return nil }
+func (this *event) Value() interface{}              { return this.device }
+func (this *event) Type() mutablehome.EventType     { return this.t }
+func (*event) Node() mutablehome.Node               { return nil }
+func (this *event) Device() mutablehome.Device      { return this.device }
+func (this *event) Traits() []mutablehome.TraitType { return this.traits }
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVER
+
+// server stands in for InfluxDB, and records each write
+type server struct {
+	sync.Mutex
+	*httptest.Server
+
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func NewServer() *server {
+	this := &server{status: http.StatusNoContent}
+	this.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		this.Lock()
+		defer this.Unlock()
+		body, _ := ioutil.ReadAll(req.Body)
+		if this.status == http.StatusNoContent {
+			this.requests = append(this.requests, req)
+			this.bodies = append(this.bodies, string(body))
+		}
+		w.WriteHeader(this.status)
+	}))
+	return this
+}
+
+func (this *server) SetStatus(status int) {
+	this.Lock()
+	defer this.Unlock()
+	this.status = status
+}
+
+func (this *server) Lines() []string {
+	this.Lock()
+	defer this.Unlock()
+	lines := []string{}
+	for _, body := range this.bodies {
+		lines = append(lines, strings.Split(strings.TrimSpace(body), "\n")...)
+	}
+	return lines
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_InfluxDB_000(t *testing.T) {
+	t.Log("Test_InfluxDB_000")
+}
+
+func Test_InfluxDB_001(t *testing.T) {
+	// Configurations which are not valid
+	for _, config := range []InfluxDB{
+		InfluxDB{},
+		InfluxDB{Addr: "http://localhost:8086/"},
+		InfluxDB{Addr: "localhost:8086", Database: "db"},
+		InfluxDB{Addr: "ftp://localhost/", Database: "db"},
+		InfluxDB{Addr: "http://localhost:8086/", Bucket: "bucket"},
+	} {
+		if _, err := NewWriter(config); err == nil {
+			t.Error("Expected error for", config)
+		}
+	}
+}
+
+func Test_InfluxDB_002(t *testing.T) {
+	// Points for events
+	ts := time.Unix(1600000000, 0)
+	lamp := &light{id: "lamp", name: "Desk Lamp", power: mutablehome.TRAIT_POWER_ON, brightness: 0.5}
+	if line, err := NewPoint("home", "node", &event{mutablehome.EVENT_DEVICE_ADDED, lamp, nil}, ts); err != nil {
+		t.Error(err)
+	} else if line != `home,device=lamp,name=Desk\ Lamp,node=node brightness=0.5,on=true,power="ON" 1600000000000000000` {
+		t.Error("Unexpected point", line)
+	}
+	if line, err := NewPoint("home", "node", &event{mutablehome.EVENT_DEVICE_TRAIT_CHANGED, lamp, []mutablehome.TraitType{mutablehome.TRAIT_LIGHT_BRIGHTNESS}}, ts); err != nil {
+		t.Error(err)
+	} else if line != `home,device=lamp,name=Desk\ Lamp,node=node brightness=0.5 1600000000000000000` {
+		t.Error("Unexpected point", line)
+	}
+	if line, err := NewPoint("home", "node", &event{mutablehome.EVENT_DEVICE_REMOVED, lamp, nil}, ts); err != nil {
+		t.Error(err)
+	} else if line != "" {
+		t.Error("Unexpected point", line)
+	}
+}
+
+func Test_InfluxDB_003(t *testing.T) {
+	// Events from a node are written to a 1.x database
+	server := NewServer()
+	defer server.Close()
+	config := InfluxDB{Addr: server.URL, Database: "home", User: "user", Password: "pass", Interval: time.Hour}
+	RunWithInfluxDB(t, config, func(influxdb *influxdb, t *testing.T) {
+		node := new(node)
+		if err := influxdb.AddNode(node); err != nil {
+			t.Fatal(err)
+		} else if err := influxdb.AddNode(node); err == nil {
+			t.Error("Expected error adding node twice")
+		}
+		lamp := &light{id: "lamp", name: "Lamp", power: mutablehome.TRAIT_POWER_OFF}
+		node.Emit(&event{mutablehome.EVENT_DEVICE_ADDED, lamp, nil})
+		WaitForQueue(t, influxdb, 1)
+		if err := influxdb.Flush(); err != nil {
+			t.Fatal(err)
+		} else if lines := server.Lines(); len(lines) != 1 {
+			t.Fatal("Unexpected lines", lines)
+		} else if strings.HasPrefix(lines[0], "mutablehome,device=lamp,name=Lamp,node=node ") == false {
+			t.Error("Unexpected line", lines[0])
+		}
+		req := server.requests[0]
+		if req.URL.Path != "/write" || req.URL.Query().Get("db") != "home" {
+			t.Error("Unexpected request", req.URL)
+		} else if user, pass, ok := req.BasicAuth(); ok == false || user != "user" || pass != "pass" {
+			t.Error("Unexpected authentication", user, pass)
+		}
+	})
+}
+
+func Test_InfluxDB_004(t *testing.T) {
+	// Points are written to a 2.x bucket in batches
+	server := NewServer()
+	defer server.Close()
+	config := InfluxDB{Addr: server.URL, Token: "token", Org: "org", Bucket: "bucket", BatchSize: 3, Interval: time.Hour}
+	RunWithInfluxDB(t, config, func(influxdb *influxdb, t *testing.T) {
+		for i := 0; i < 7; i++ {
+			influxdb.add("test value=1")
+		}
+		if err := influxdb.Flush(); err != nil {
+			t.Fatal(err)
+		} else if len(server.requests) != 3 {
+			t.Error("Unexpected number of writes", len(server.requests))
+		} else if lines := server.Lines(); len(lines) != 7 {
+			t.Error("Unexpected lines", lines)
+		}
+		req := server.requests[0]
+		if req.URL.Path != "/api/v2/write" || req.URL.Query().Get("org") != "org" || req.URL.Query().Get("bucket") != "bucket" {
+			t.Error("Unexpected request", req.URL)
+		} else if req.Header.Get("Authorization") != "Token token" {
+			t.Error("Unexpected authorization", req.Header.Get("Authorization"))
+		}
+	})
+}
+
+func Test_InfluxDB_005(t *testing.T) {
+	// Points are buffered to disk while the server is unavailable,
+	// and written when it is available again
+	server := NewServer()
+	defer server.Close()
+	tmp, err := ioutil.TempDir("", "influxdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "buffer")
+	config := InfluxDB{Addr: server.URL, Database: "home", Buffer: path, Interval: time.Hour}
+
+	server.SetStatus(http.StatusServiceUnavailable)
+	RunWithInfluxDB(t, config, func(influxdb *influxdb, t *testing.T) {
+		influxdb.add("test value=1")
+		influxdb.add("test value=2")
+		if err := influxdb.Flush(); err == nil {
+			t.Error("Expected error")
+		} else if lines, err := readBuffer(path); err != nil {
+			t.Error(err)
+		} else if len(lines) != 2 {
+			t.Error("Unexpected buffer", lines)
+		}
+		influxdb.add("test value=3")
+	})
+
+	// Points are read from the buffer on restart
+	server.SetStatus(http.StatusNoContent)
+	RunWithInfluxDB(t, config, func(influxdb *influxdb, t *testing.T) {
+		if err := influxdb.Flush(); err != nil {
+			t.Fatal(err)
+		} else if lines := server.Lines(); strings.Join(lines, ",") != "test value=1,test value=2,test value=3" {
+			t.Error("Unexpected lines", lines)
+		} else if _, err := os.Stat(path); os.IsNotExist(err) == false {
+			t.Error("Expected buffer to be removed")
+		}
+	})
+}
+
+func Test_InfluxDB_006(t *testing.T) {
+	// Points rejected by the server are dropped
+	server := NewServer()
+	defer server.Close()
+	config := InfluxDB{Addr: server.URL, Database: "home", Interval: time.Hour}
+	RunWithInfluxDB(t, config, func(influxdb *influxdb, t *testing.T) {
+		server.SetStatus(http.StatusBadRequest)
+		influxdb.add("test value=")
+		if err := influxdb.Flush(); err != nil {
+			t.Error(err)
+		} else if len(influxdb.queue) != 0 {
+			t.Error("Expected points to be dropped")
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RUN
+
+func RunWithInfluxDB(t *testing.T, config InfluxDB, main func(*influxdb, *testing.T)) {
+	t.Helper()
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(config, app.Log().Clone(config.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(unit.(*influxdb), t)
+	}, nil); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+// WaitForQueue waits until a number of points are queued
+func WaitForQueue(t *testing.T, influxdb *influxdb, count int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		influxdb.Mutex.Lock()
+		n := len(influxdb.queue)
+		influxdb.Mutex.Unlock()
+		if n >= count {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timeout waiting for points")
+}
@@ -10,21 +10,35 @@ func init() {
 		Name: InfluxDB{}.Name(),
 		Config: func(app gopi.App) error {
 			app.Flags().FlagString("influxdb.addr", "http://localhost:8086/", "Server address")
-			app.Flags().FlagString("influxdb.user", "", "Username for authentication")
-			app.Flags().FlagString("influxdb.password", "", "Password for authentication")
-			app.Flags().FlagString("influxdb.db", "", "Database name")
+			app.Flags().FlagString("influxdb.user", "", "Username for authentication (1.x)")
+			app.Flags().FlagString("influxdb.password", "", "Password for authentication (1.x)")
+			app.Flags().FlagString("influxdb.db", "", "Database name (1.x)")
+			app.Flags().FlagString("influxdb.token", "", "Token for authentication (2.x)")
+			app.Flags().FlagString("influxdb.org", "", "Organization name (2.x)")
+			app.Flags().FlagString("influxdb.bucket", "", "Bucket name (2.x)")
+			app.Flags().FlagString("influxdb.measurement", DEFAULT_MEASUREMENT, "Measurement name")
 			app.Flags().FlagDuration("influxdb.timeout", 0, "Timeout for influxdb writes")
 			app.Flags().FlagBool("influxdb.skipverify", false, "Skip https certificate verification")
+			app.Flags().FlagUint("influxdb.batch", DEFAULT_BATCHSIZE, "Maximum number of points in each write")
+			app.Flags().FlagDuration("influxdb.interval", DEFAULT_INTERVAL, "Interval between writes")
+			app.Flags().FlagString("influxdb.buffer", "", "File for buffering points while the server is unreachable")
 			return nil
 		},
 		New: func(app gopi.App) (gopi.Unit, error) {
 			return gopi.New(InfluxDB{
-				Addr:       app.Flags().GetString("influxdb.addr", gopi.FLAG_NS_DEFAULT),
-				User:       app.Flags().GetString("influxdb.user", gopi.FLAG_NS_DEFAULT),
-				Password:   app.Flags().GetString("influxdb.password", gopi.FLAG_NS_DEFAULT),
-				Database:   app.Flags().GetString("influxdb.db", gopi.FLAG_NS_DEFAULT),
-				Timeout:    app.Flags().GetDuration("influxdb.timeout", gopi.FLAG_NS_DEFAULT),
-				SkipVerify: app.Flags().GetBool("influxdb.skipverify", gopi.FLAG_NS_DEFAULT),
+				Addr:        app.Flags().GetString("influxdb.addr", gopi.FLAG_NS_DEFAULT),
+				User:        app.Flags().GetString("influxdb.user", gopi.FLAG_NS_DEFAULT),
+				Password:    app.Flags().GetString("influxdb.password", gopi.FLAG_NS_DEFAULT),
+				Database:    app.Flags().GetString("influxdb.db", gopi.FLAG_NS_DEFAULT),
+				Token:       app.Flags().GetString("influxdb.token", gopi.FLAG_NS_DEFAULT),
+				Org:         app.Flags().GetString("influxdb.org", gopi.FLAG_NS_DEFAULT),
+				Bucket:      app.Flags().GetString("influxdb.bucket", gopi.FLAG_NS_DEFAULT),
+				Measurement: app.Flags().GetString("influxdb.measurement", gopi.FLAG_NS_DEFAULT),
+				Timeout:     app.Flags().GetDuration("influxdb.timeout", gopi.FLAG_NS_DEFAULT),
+				SkipVerify:  app.Flags().GetBool("influxdb.skipverify", gopi.FLAG_NS_DEFAULT),
+				BatchSize:   app.Flags().GetUint("influxdb.batch", gopi.FLAG_NS_DEFAULT),
+				Interval:    app.Flags().GetDuration("influxdb.interval", gopi.FLAG_NS_DEFAULT),
+				Buffer:      app.Flags().GetString("influxdb.buffer", gopi.FLAG_NS_DEFAULT),
 			}, app.Log().Clone(InfluxDB{}.Name()))
 		},
 	})
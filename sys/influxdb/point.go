@@ -0,0 +1,91 @@
+/*
+	Mutablehome Automation: InfluxDB
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package influxdb
+
+import (
+	"strings"
+	"time"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+	models "github.com/influxdata/influxdb1-client/models"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// POINTS
+
+// NewPoint returns a point in line protocol for a device event, or an
+// empty string if there are no fields for the event. Fields are the
+// changed traits, or all traits when a device is added
+func NewPoint(measurement, node string, evt mutablehome.Event, ts time.Time) (string, error) {
+	device := evt.Device()
+	if device == nil {
+		return "", nil
+	}
+
+	// Determine traits to write
+	var traits []mutablehome.TraitType
+	switch evt.Type() {
+	case mutablehome.EVENT_DEVICE_ADDED:
+		traits = device.Traits()
+	case mutablehome.EVENT_DEVICE_TRAIT_CHANGED:
+		traits = evt.Traits()
+	default:
+		return "", nil
+	}
+
+	// Set fields
+	fields := make(models.Fields)
+	for _, trait := range traits {
+		switch trait {
+		case mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_POWER_STANDBY:
+			if power, ok := device.(mutablehome.PowerTrait); ok && power.Power() != mutablehome.TRAIT_NONE {
+				fields["power"] = strings.TrimPrefix(power.Power().String(), "TRAIT_POWER_")
+				fields["on"] = power.Power() == mutablehome.TRAIT_POWER_ON
+			}
+		case mutablehome.TRAIT_LIGHT_BRIGHTNESS:
+			if light, ok := device.(mutablehome.LightTrait); ok {
+				fields["brightness"] = float64(light.Brightness())
+			}
+		case mutablehome.TRAIT_COVER_POSITION:
+			if cover, ok := device.(mutablehome.CoverTrait); ok {
+				fields["position"] = float64(cover.Position())
+			}
+		case mutablehome.TRAIT_BATTERY_LEVEL:
+			if battery, ok := device.(mutablehome.BatteryTrait); ok {
+				fields["battery"] = float64(battery.BatteryLevel())
+			}
+		case mutablehome.TRAIT_SENSOR_ACTIVITY:
+			if evt.Type() == mutablehome.EVENT_DEVICE_TRAIT_CHANGED {
+				fields["activity"] = true
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	// Set tags, where empty tags are not written
+	tags := map[string]string{
+		"node":   node,
+		"device": device.Id(),
+		"name":   device.Name(),
+	}
+	for k, v := range tags {
+		if v == "" {
+			delete(tags, k)
+		}
+	}
+
+	// Return line protocol
+	if pt, err := models.NewPoint(measurement, models.NewTags(tags), fields, ts); err != nil {
+		return "", err
+	} else {
+		return pt.String(), nil
+	}
+}
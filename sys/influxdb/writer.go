@@ -0,0 +1,150 @@
+/*
+	Mutablehome Automation: InfluxDB
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package influxdb
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// writer writes points to InfluxDB 1.x with a database, or to
+// InfluxDB 2.x with a token, organization and bucket
+type writer struct {
+	client *http.Client
+	url    *url.URL
+	user   string
+	pass   string
+	token  string
+}
+
+// rejected is returned when the server rejects points as invalid,
+// which should not be written again
+type rejected struct {
+	status int
+	reason string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func NewWriter(config InfluxDB) (*writer, error) {
+	this := new(writer)
+
+	// Parse address
+	addr, err := url.Parse(config.Addr)
+	if err != nil || addr.Host == "" {
+		return nil, gopi.ErrBadParameter.WithPrefix("Addr")
+	} else if addr.Scheme != "http" && addr.Scheme != "https" {
+		return nil, gopi.ErrBadParameter.WithPrefix("Addr")
+	}
+
+	// Set path and query for the version
+	query := url.Values{}
+	query.Set("precision", "ns")
+	if config.Bucket != "" {
+		if config.Org == "" {
+			return nil, gopi.ErrBadParameter.WithPrefix("Org")
+		}
+		addr.Path = strings.TrimSuffix(addr.Path, "/") + "/api/v2/write"
+		query.Set("org", config.Org)
+		query.Set("bucket", config.Bucket)
+		this.token = config.Token
+	} else if config.Database != "" {
+		addr.Path = strings.TrimSuffix(addr.Path, "/") + "/write"
+		query.Set("db", config.Database)
+		this.user, this.pass = config.User, config.Password
+	} else {
+		return nil, gopi.ErrBadParameter.WithPrefix("Database or Bucket")
+	}
+	addr.RawQuery = query.Encode()
+	this.url = addr
+
+	// Create client
+	this.client = &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: config.SkipVerify},
+		},
+	}
+
+	// Success
+	return this, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *writer) String() string {
+	str := "<influxdb.writer url=" + this.url.String()
+	if this.token != "" {
+		str += " version=2"
+	} else {
+		str += " version=1"
+	}
+	return str + ">"
+}
+
+func (this *rejected) Error() string {
+	return fmt.Sprintf("%v: %v (%v)", gopi.ErrUnexpectedResponse, http.StatusText(this.status), strings.TrimSpace(this.reason))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Write sends lines to the server. A rejected error is returned when
+// the points are invalid, so that they are not retried. Other errors,
+// including authorization errors, mean the lines should be retried
+func (this *writer) Write(lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	req, err := http.NewRequest("POST", this.url.String(), strings.NewReader(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if this.token != "" {
+		req.Header.Set("Authorization", "Token "+this.token)
+	} else if this.user != "" {
+		req.SetBasicAuth(this.user, this.pass)
+	}
+
+	// Send request and check response
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge || resp.StatusCode == http.StatusUnprocessableEntity:
+		reason, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &rejected{resp.StatusCode, string(reason)}
+	default:
+		return gopi.ErrUnexpectedResponse.WithPrefix(resp.Status)
+	}
+}
+
+// Close releases idle connections
+func (this *writer) Close() {
+	this.client.CloseIdleConnections()
+}
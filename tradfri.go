@@ -8,6 +8,7 @@
 package mutablehome
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -20,14 +21,18 @@ import (
 
 type (
 	TradfriDeviceType uint
+	TradfriEventType  uint
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 // INTERFACES
 
-// TradfriGateway represents a connection to a gateway device
+// TradfriGateway represents a connection to a gateway device, and
+// emits TradfriDevice values when observed devices change. Once
+// connected, the connection is supervised and TradfriEventType values
+// are emitted when the gateway goes offline and comes back online
 type TradfriGateway interface {
-	gopi.Unit
+	gopi.PubSub
 
 	// Connect to gateway, using either IP4 or IP6
 	Connect(gopi.RPCServiceRecord, gopi.RPCFlag) error
@@ -39,22 +44,51 @@ type TradfriGateway interface {
 	Id() string
 	Version() string
 
-	// Return list of device, group and scene id's
+	// Return gateway settings and firmware status
+	Info() (TradfriGatewayInfo, error)
+
+	// Reboot the gateway
+	Reboot() error
+
+	// Pair enables pairing (commissioning) mode on the gateway for
+	// a duration, or ends pairing mode when the duration is zero
+	Pair(time.Duration) error
+
+	// Return list of device, group and scene group id's
 	Devices() ([]uint, error)
 	Groups() ([]uint, error)
 	Scenes() ([]uint, error)
 
-	/*
-		// Return details of a specific device, group or scene
-		Device(id uint) (TradfriDevice, error)
-		Group(id uint) (TradfriGroup, error)
+	// Return details of a specific device or group
+	Device(id uint) (TradfriDevice, error)
+	Group(id uint) (TradfriGroup, error)
+
+	// Return scene id's for a scene group, and details of a scene
+	GroupScenes(group uint) ([]uint, error)
+	Scene(group, id uint) (TradfriScene, error)
+
+	// Send one or more device, group or scene commands
+	Send(...TradfriCommand) error
+
+	// Observe device or group until the context is cancelled, emitting
+	// the device or group whenever the gateway reports a change
+	ObserveDevice(context.Context, uint) error
+	ObserveGroup(context.Context, uint) error
+}
 
-		// Send one or more device, group or scene commands
-		Send(...TradfriCommand) error
+// TradfriGatewayInfo represents gateway settings and firmware status
+type TradfriGatewayInfo interface {
+	Id() string
+	Version() string       // Firmware version
+	NTP() string           // Time server
+	Time() time.Time       // Current time on the gateway
+	FirstSetup() time.Time // Time the gateway was first set up
+	Pairing() bool         // Pairing (commissioning) mode is enabled
 
-		// Observe device
-		ObserveDevice(context.Context, uint) error
-	*/
+	// Firmware update state, which is zero when up to date, and
+	// progress between 0 and 100 when an update is downloading
+	UpdateState() uint
+	UpdateProgress() uint
 }
 
 // TradfriDevice represents a device such as a set of lights
@@ -67,6 +101,18 @@ type TradfriDevice interface {
 	Active() bool
 
 	Lights() []TradfriLight
+	Plugs() []TradfriPlug
+	Blinds() []TradfriBlind
+
+	// Battery powered devices return battery level between 0 and 100
+	HasBattery() bool
+	BatteryLevel() uint
+
+	// Rename the device
+	SetName(string) TradfriCommand
+
+	// Equals returns true if the device state is identical to another
+	Equals(TradfriDevice) bool
 }
 
 // TradfriLight represents a single light
@@ -78,6 +124,10 @@ type TradfriLight interface {
 	ColorXY() (uint16, uint16) // 0000 to FFFF
 	Temperature() uint16       // 250 to 454
 
+	// Capabilities
+	HasTemperature() bool // Bulb supports white spectrum
+	HasColor() bool       // Bulb supports color
+
 	// Set properties
 	SetPower(bool) TradfriCommand
 	SetBrightness(uint8, time.Duration) TradfriCommand       // 01 to FE
@@ -86,11 +136,57 @@ type TradfriLight interface {
 	SetColorHex(string, time.Duration) TradfriCommand
 }
 
+// TradfriPlug represents a single power outlet
+type TradfriPlug interface {
+	// Get properties
+	Power() bool
+
+	// Set properties
+	SetPower(bool) TradfriCommand
+}
+
+// TradfriBlind represents a single blind
+type TradfriBlind interface {
+	// Get properties
+	Position() uint8 // 0 (open) to 100 (closed)
+
+	// Set properties
+	SetPosition(uint8) TradfriCommand // 0 (open) to 100 (closed)
+	Stop() TradfriCommand
+}
+
 // TradfriGroup represents a group of devices
 type TradfriGroup interface {
 	Id() uint
 	Name() string
 	Devices() []uint
+
+	// Get properties
+	Power() bool
+	Brightness() uint8 // 00 to FE
+	Scene() uint       // Last activated scene
+
+	// Set properties for all devices in the group
+	SetPower(bool) TradfriCommand
+	SetBrightness(uint8, time.Duration) TradfriCommand // 01 to FE
+	SetScene(uint) TradfriCommand
+
+	// Rename the group
+	SetName(string) TradfriCommand
+
+	// Equals returns true if the group state is identical to another
+	Equals(TradfriGroup) bool
+}
+
+// TradfriScene represents a preset state (mood) for a group of devices
+type TradfriScene interface {
+	Id() uint
+	Name() string
+	Group() uint
+	Devices() []uint
+
+	// Activate the scene
+	Activate() TradfriCommand
 }
 
 // TradfriCommand represents a command to send to the gateway
@@ -116,6 +212,12 @@ const (
 	IKEA_DEVICE_TYPE_BLIND        TradfriDeviceType = 7
 )
 
+const (
+	IKEA_EVENT_NONE TradfriEventType = iota
+	IKEA_EVENT_GATEWAY_CONNECTED
+	IKEA_EVENT_GATEWAY_DISCONNECTED
+)
+
 ////////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
@@ -139,3 +241,16 @@ func (t TradfriDeviceType) String() string {
 		return "[?? Invalid TradfriDeviceType value]"
 	}
 }
+
+func (t TradfriEventType) String() string {
+	switch t {
+	case IKEA_EVENT_NONE:
+		return "IKEA_EVENT_NONE"
+	case IKEA_EVENT_GATEWAY_CONNECTED:
+		return "IKEA_EVENT_GATEWAY_CONNECTED"
+	case IKEA_EVENT_GATEWAY_DISCONNECTED:
+		return "IKEA_EVENT_GATEWAY_DISCONNECTED"
+	default:
+		return "[?? Invalid TradfriEventType value]"
+	}
+}
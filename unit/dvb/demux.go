@@ -8,8 +8,12 @@
 package dvb
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
+	"syscall"
 
 	// Frameworks
 	gopi "github.com/djthorpe/gopi/v2"
@@ -30,6 +34,9 @@ type Demux struct {
 }
 
 type demux struct {
+	// Counters are first for alignment of atomic operations
+	crcerrors uint64
+
 	adapter, demux uint
 	frontend       mutablehome.DVBFrontend
 	filepoll       gopi.FilePoll
@@ -67,6 +74,7 @@ func (this *demux) Init(config Demux) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return gopi.ErrBadParameter.WithPrefix("dvb.demux")
 	} else {
+		this.adapter = config.Adapter
 		this.demux = config.Demux
 	}
 
@@ -302,6 +310,19 @@ func (this *demux) streamFilterForFd(fd uintptr) *StreamFilter {
 	}
 }
 
+// Metrics returns the number of sections which failed the CRC check
+func (this *demux) Metrics() []mutablehome.Metric {
+	return []mutablehome.Metric{
+		mutablehome.Metric{
+			Name:   "mutablehome_dvb_section_crc_errors_total",
+			Help:   "Number of sections which failed the CRC check",
+			Type:   mutablehome.METRIC_COUNTER,
+			Labels: map[string]string{"adapter": fmt.Sprint(this.adapter), "demux": fmt.Sprint(this.demux)},
+			Value:  float64(atomic.LoadUint64(&this.crcerrors)),
+		},
+	}
+}
+
 func (this *demux) Read(fd uintptr, flags gopi.FilePollFlags) {
 	if flags&gopi.FILEPOLL_FLAG_READ == gopi.FILEPOLL_FLAG_READ {
 		if filter := this.streamFilterForFd(fd); filter != nil {
@@ -312,7 +333,12 @@ func (this *demux) Read(fd uintptr, flags gopi.FilePollFlags) {
 			}
 			return
 		} else if filter := this.sectionFilterForFd(fd); filter != nil {
-			if section, err := TSRead(fd); err != nil {
+			if section, err := TSRead(fd); errors.Is(err, syscall.EBADMSG) {
+				// Section was discarded by the demux
+				atomic.AddUint64(&this.crcerrors, 1)
+				this.Log.Debug("Section CRC error:", filter)
+				return
+			} else if err != nil {
 				this.Log.Warn("Section Read error:", err)
 				return
 			} else {
@@ -49,6 +49,7 @@ func NewSectionFilter(adapter, demux uint, pid uint16, tid home.DVBTableType) (*
 			dvb.DMXSectionFilter{
 				Pid:     pid,
 				Timeout: 0,
+				Flags:   dvb.DVB_DMX_FLAG_CHECK_CRC,
 			},
 		}
 		filter.DMXSectionFilter.Pattern.Filter[0] = uint8(tid)
@@ -252,6 +252,50 @@ func (this *frontend) SetPropertiesDVBT(properties mutablehome.DVBProperties) er
 	return nil
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// METRICS
+
+// Metrics returns the signal strength, which is in dBm when the
+// frontend reports decibels, or else between 0 and 1
+func (this *frontend) Metrics() []mutablehome.Metric {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if this.dev == nil {
+		return nil
+	}
+	stats, err := dvb.DVB_FEStats(this.dev.Fd())
+	if err != nil {
+		this.Log.Debug("Metrics:", err)
+		return nil
+	}
+	labels := map[string]string{"frontend": this.name}
+	switch stat := stats[dvb.DVB_FE_STAT_SIGNAL_STRENGTH]; stat.Scale {
+	case dvb.DVB_FE_SCALE_DECIBEL:
+		return []mutablehome.Metric{
+			mutablehome.Metric{
+				Name:   "mutablehome_dvb_signal_strength_dbm",
+				Help:   "Signal strength in dBm",
+				Type:   mutablehome.METRIC_GAUGE,
+				Labels: labels,
+				Value:  stat.Decibel(),
+			},
+		}
+	case dvb.DVB_FE_SCALE_RELATIVE:
+		return []mutablehome.Metric{
+			mutablehome.Metric{
+				Name:   "mutablehome_dvb_signal_strength",
+				Help:   "Signal strength between 0 and 1",
+				Type:   mutablehome.METRIC_GAUGE,
+				Labels: labels,
+				Value:  float64(stat.Value&0xFFFF) / 0xFFFF,
+			},
+		}
+	default:
+		return nil
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
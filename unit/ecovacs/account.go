@@ -0,0 +1,88 @@
+package ecovacs
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// EcovacsAccount is an account to sign in to in addition to the account
+// in the configuration
+type EcovacsAccount struct {
+	AccountId    string
+	PasswordHash string
+}
+
+// account holds the credential for an account, which is replaced when
+// the token is refreshed while devices are connected
+type account struct {
+	sync.Mutex
+	credential
+
+	passwordHash string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func newAccount(stored credential, passwordHash string) *account {
+	return &account{
+		credential:   stored,
+		passwordHash: passwordHash,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// METHODS
+
+// Credential returns the current credential
+func (this *account) Credential() credential {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.credential
+}
+
+// SetToken sets the user identifier and token issued on login, which
+// expires after lifetime
+func (this *account) SetToken(userId, token string, lifetime time.Duration) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.UserId = userId
+	this.Token = token
+	this.Expires = time.Now().Add(lifetime)
+}
+
+// ExpiresWithin returns true if there is a token which expires within
+// duration d
+func (this *account) ExpiresWithin(d time.Duration) bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.Token != "" && time.Until(this.Expires) < d
+}
+
+// IsValid returns true if there is a token which does not expire
+// within duration d
+func (this *account) IsValid(d time.Duration) bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.UserId != "" && this.Token != "" && time.Until(this.Expires) >= d
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *account) String() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	str := "<account id=" + strconv.Quote(this.AccountId)
+	if this.UserId != "" {
+		str += " uid=" + strconv.Quote(this.UserId)
+	}
+	if this.Expires.IsZero() == false {
+		str += " expires=" + this.Expires.Format(time.RFC3339)
+	}
+	return str + ">"
+}
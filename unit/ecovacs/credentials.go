@@ -0,0 +1,142 @@
+package ecovacs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// credentials are persisted between restarts so that tokens can be
+// re-used rather than logging in with account and password each time
+type credentials struct {
+	DeviceId string       `json:"device_id"`
+	Accounts []credential `json:"accounts"`
+}
+
+// credential is the token and resource issued to an account
+type credential struct {
+	AccountId string    `json:"account"`
+	UserId    string    `json:"uid,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	Resource  string    `json:"resource"`
+	Expires   time.Time `json:"expires"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	FILENAME_CREDENTIALS = "credentials.json"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// METHODS
+
+func (this *credentials) CreatePath(path string) (string, error) {
+	// If path is relative, then append user's home folder
+	if filepath.IsAbs(path) == false {
+		if home, err := os.UserHomeDir(); err != nil {
+			return "", err
+		} else {
+			path = filepath.Join(home, path)
+		}
+	}
+	// If path doesn't exist then try and create it
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.Mkdir(path, 0700); err != nil {
+			return path, err
+		}
+	}
+	// Make sure path is available
+	if stat, err := os.Stat(path); err != nil {
+		return path, err
+	} else if stat.IsDir() == false {
+		return path, fmt.Errorf("%w: Not a folder: %v", gopi.ErrBadParameter, path)
+	}
+	// Success
+	return path, nil
+}
+
+func (this *credentials) Read(path string) error {
+	filename := filepath.Join(path, FILENAME_CREDENTIALS)
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		// When file doesn't exist then just empty out values
+		this.DeviceId = ""
+		this.Accounts = nil
+		return nil
+	} else if fh, err := os.Open(filename); err != nil {
+		return err
+	} else {
+		defer fh.Close()
+		enc := json.NewDecoder(fh)
+		if err := enc.Decode(this); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// Write replaces the credentials file, which is only readable by the
+// current user since it contains tokens
+func (this *credentials) Write(path string) error {
+	filename := filepath.Join(path, FILENAME_CREDENTIALS)
+	if fh, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+		return err
+	} else {
+		defer fh.Close()
+		enc := json.NewEncoder(fh)
+		if err := enc.Encode(this); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// Credential returns the credential for an account, or an empty
+// credential if there is none
+func (this *credentials) Credential(accountId string) credential {
+	for _, credential := range this.Accounts {
+		if credential.AccountId == accountId {
+			return credential
+		}
+	}
+	return credential{AccountId: accountId}
+}
+
+func (this *credentials) String() string {
+	str := "<credentials"
+	if this.DeviceId != "" {
+		str += " device_id=" + strconv.Quote(this.DeviceId)
+	}
+	for _, credential := range this.Accounts {
+		str += " " + credential.String()
+	}
+	return str + ">"
+}
+
+func (this credential) String() string {
+	str := "<credential account=" + strconv.Quote(this.AccountId)
+	if this.UserId != "" {
+		str += " uid=" + strconv.Quote(this.UserId)
+	}
+	if this.Resource != "" {
+		str += " resource=" + strconv.Quote(this.Resource)
+	}
+	if this.Expires.IsZero() == false {
+		str += " expires=" + this.Expires.Format(time.RFC3339)
+	}
+	return str + ">"
+}
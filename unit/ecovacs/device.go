@@ -2,7 +2,9 @@ package ecovacs
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"strconv"
 	"sync"
 	"time"
@@ -24,10 +26,15 @@ type device struct {
 	Nickname_ string `json:"nick"`
 	Company   string `json:"company"`
 
-	source *ecovacs
-	stop   chan struct{}
+	source  *ecovacs
+	account *account
+	stop    chan struct{}
 
-	XMPPClient
+	// Map assembled from map pieces
+	current  *Map
+	mapMutex sync.RWMutex
+
+	Transport
 	DeviceState
 	sync.Mutex
 	sync.WaitGroup
@@ -41,6 +48,16 @@ const (
 	DELTA_OTHER_TTL    = 4 * time.Minute
 	DELTA_VERSION_TTL  = 6 * time.Hour
 	DELTA_LIFESPAN_TTL = 2 * time.Hour
+	DELTA_MAP_TTL      = 30 * time.Minute
+	DELTA_HISTORY_TTL  = time.Hour
+)
+
+const (
+	// Number of clean logs requested when logs expire
+	DEFAULT_CLEAN_LOGS = 10
+
+	// Consumable lifespan percentage below which an alert is emitted
+	DEFAULT_LIFESPAN_THRESHOLD = 10
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -50,23 +67,10 @@ func (this *device) Connect() error {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	if this.XMPPClient.IsConnected() {
+	if this.Transport == nil || this.Transport.IsConnected() {
 		return gopi.ErrInternalAppError.WithPrefix("Connect")
 	}
-	if server := CountryToXMPPServer(this.source.country); server == "" {
-		return gopi.ErrInternalAppError.WithPrefix("country")
-	} else if err := this.XMPPClient.NewClient(xmpp.Options{
-		Host:     fmt.Sprintf("%s:%d", server, ECOVACS_XMPP_PORT),
-		User:     fmt.Sprintf("%s@%s", this.source.userId, ECOVACS_REALM),
-		Password: fmt.Sprintf("0/%s/%s", this.source.resourceId, this.source.accessToken),
-		NoTLS:    true,
-		Session:  true,
-
-		Debug: this.source.Log.IsDebug(),
-		TLSConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	}, this.DeviceId_, this.Class); err != nil {
+	if err := this.connect(); err != nil {
 		return err
 	} else {
 		this.stop = make(chan struct{})
@@ -83,7 +87,7 @@ func (this *device) Disconnect() error {
 	defer this.Mutex.Unlock()
 
 	// If client is nil then no need to disconnect
-	if this.XMPPClient.IsConnected() == false {
+	if this.Transport == nil || this.Transport.IsConnected() == false {
 		return nil
 	}
 
@@ -91,7 +95,7 @@ func (this *device) Disconnect() error {
 	close(this.stop)
 
 	// close client
-	err := this.XMPPClient.Close()
+	err := this.Transport.Close()
 
 	// wait for termination of recv
 	this.WaitGroup.Wait()
@@ -114,6 +118,18 @@ func (this *device) Nickname() string {
 	return this.Nickname_
 }
 
+// Map returns the map assembled from map pieces, or nil if no map
+// metadata has been received
+func (this *device) Map() home.EcovacsMap {
+	this.mapMutex.RLock()
+	defer this.mapMutex.RUnlock()
+	if this.current == nil {
+		return nil
+	} else {
+		return this.current
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
@@ -131,7 +147,7 @@ func (this *device) recv() {
 	defer this.WaitGroup.Done()
 FOR_LOOP:
 	for {
-		if message, err := this.XMPPClient.Recv(); err != nil {
+		if message, err := this.Transport.Recv(); err != nil {
 			// We need to do this in a goroutine to prevent deadlock
 			go func() {
 				this.source.deviceError(this, err)
@@ -141,6 +157,17 @@ FOR_LOOP:
 			// End of cycle when no message returned
 			break FOR_LOOP
 		} else {
+			// Update map before the event is emitted
+			if err := this.updateMap(message); err != nil {
+				this.source.Log.Warn(this.DeviceId_, err)
+			}
+			// Fetch schedules, do-not-disturb or lifespans after they have been changed
+			if err := this.source.transportError(this, this.refresh(message)); err != nil {
+				this.source.Log.Warn(this.DeviceId_, err)
+			}
+			// Check for consumables falling below the threshold before
+			// the previous lifespan is replaced
+			low := this.lowLifeSpan(message)
 			// Create event from message
 			event := NewEvent(this.source, this, message)
 			if event.Type() == home.ECOVACS_EVENT_NONE {
@@ -150,6 +177,9 @@ FOR_LOOP:
 				// Emit messages but only if modified
 				this.source.bus.Emit(event)
 			}
+			if low {
+				this.source.bus.Emit(NewEventWithType(this.source, this, message, home.ECOVACS_EVENT_LOWLIFESPAN))
+			}
 		}
 	}
 }
@@ -157,29 +187,58 @@ FOR_LOOP:
 func (this *device) updateStatusForKey(key home.EcovacsEventType) error {
 	switch key {
 	case home.ECOVACS_EVENT_BATTERYLEVEL:
-		if _, err := this.XMPPClient.GetBatteryInfo(); err != nil {
+		if _, err := this.Transport.GetBatteryInfo(); err != nil {
 			return err
 		}
 	case home.ECOVACS_EVENT_CHARGESTATE:
-		if _, err := this.XMPPClient.GetChargeState(); err != nil {
+		if _, err := this.Transport.GetChargeState(); err != nil {
 			return err
 		}
 	case home.ECOVACS_EVENT_CLEANSTATE:
-		if _, err := this.XMPPClient.GetCleanState(); err != nil {
+		if _, err := this.Transport.GetCleanState(); err != nil {
 			return err
 		}
 	case home.ECOVACS_EVENT_LIFESPAN:
-		if _, err := this.XMPPClient.GetLifeSpan(home.ECOVACS_PART_BRUSH); err != nil {
+		if _, err := this.Transport.GetLifeSpan(home.ECOVACS_PART_BRUSH); err != nil {
 			return err
 		}
-		if _, err := this.XMPPClient.GetLifeSpan(home.ECOVACS_PART_DUSTFILTER); err != nil {
+		if _, err := this.Transport.GetLifeSpan(home.ECOVACS_PART_DUSTFILTER); err != nil {
 			return err
 		}
-		if _, err := this.XMPPClient.GetLifeSpan(home.ECOVACS_PART_SIDEBRUSH); err != nil {
+		if _, err := this.Transport.GetLifeSpan(home.ECOVACS_PART_SIDEBRUSH); err != nil {
 			return err
 		}
 	case home.ECOVACS_EVENT_VERSION:
-		if _, err := this.XMPPClient.GetVersion(); err != nil {
+		if _, err := this.Transport.GetVersion(); err != nil {
+			return err
+		}
+	case home.ECOVACS_EVENT_POSITION:
+		if _, err := this.Transport.GetPos(); err != nil {
+			return err
+		}
+	case home.ECOVACS_EVENT_CHARGERPOSITION:
+		if _, err := this.Transport.GetChargerPos(); err != nil {
+			return err
+		}
+	case home.ECOVACS_EVENT_MAP, home.ECOVACS_EVENT_MAPPIECE:
+		// Changed pieces are requested when map metadata is received
+		if _, err := this.Transport.GetMapM(); err != nil {
+			return err
+		}
+	case home.ECOVACS_EVENT_CLEANSUM:
+		if _, err := this.Transport.GetCleanSum(); err != nil {
+			return err
+		}
+	case home.ECOVACS_EVENT_LOG:
+		if _, err := this.Transport.GetCleanLogs(DEFAULT_CLEAN_LOGS); err != nil {
+			return err
+		}
+	case home.ECOVACS_EVENT_SCHEDULE:
+		if _, err := this.Transport.GetSched(); err != nil {
+			return err
+		}
+	case home.ECOVACS_EVENT_DND:
+		if _, err := this.Transport.GetBlockTime(); err != nil {
 			return err
 		}
 	default:
@@ -203,17 +262,26 @@ func (this *device) ping(stop <-chan struct{}) {
 	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_CLEANSTATE)
 	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_LIFESPAN)
 	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_VERSION)
+	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_POSITION)
+	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_CHARGERPOSITION)
+	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_MAP)
+	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_CLEANSUM)
+	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_SCHEDULE)
+	this.DeviceState.AddExpiredKey(home.ECOVACS_EVENT_DND)
 
 FOR_LOOP:
 	for {
 		select {
 		case <-ping_ticker.C:
-			if err := this.XMPPClient.Ping(); err != nil {
+			if err := this.source.transportError(this, this.Transport.Ping()); err != nil {
 				fmt.Println("PING ERROR", err)
 			}
 		case <-update_ticker.C:
 			if key := this.DeviceState.NextExpiredKey(); key != home.ECOVACS_EVENT_NONE {
-				if err := this.updateStatusForKey(key); err != nil {
+				if err := this.updateStatusForKey(key); errors.Is(err, gopi.ErrNotImplemented) {
+					// Ignore values which can't be requested from the device
+					continue
+				} else if err := this.source.transportError(this, err); err != nil {
 					fmt.Println("UPDATE ERROR", err)
 				}
 			}
@@ -225,12 +293,150 @@ FOR_LOOP:
 	}
 }
 
+// updateMap creates a new map when map metadata is received and requests
+// any pieces which have changed, and sets pieces as they are received
+func (this *device) updateMap(message *XMPPMessage) error {
+	switch message.Type() {
+	case home.ECOVACS_EVENT_MAP:
+		info, err := message.MapInfo()
+		if err != nil {
+			return err
+		}
+		this.mapMutex.Lock()
+		current, err := NewMap(info, this.current)
+		if err == nil {
+			this.current = current
+		}
+		this.mapMutex.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, piece := range current.Pieces() {
+			if _, err := this.Transport.PullMP(piece); err != nil {
+				return err
+			}
+		}
+	case home.ECOVACS_EVENT_MAPPIECE:
+		id, piece, data := message.MapPiece()
+		this.mapMutex.RLock()
+		current := this.current
+		this.mapMutex.RUnlock()
+		if current == nil || current.Id() != id {
+			// Ignore pieces for a map which has been replaced
+			return nil
+		} else if err := current.SetPiece(piece, data); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// refresh requests schedules, do-not-disturb or lifespans when a change
+// has been acknowledged, so that an event is emitted with the new values
+func (this *device) refresh(message *XMPPMessage) error {
+	if message.Ok() == false {
+		return nil
+	}
+	switch message.Request() {
+	case "SetSched", "DelSched":
+		if _, err := this.Transport.GetSched(); err != nil {
+			return err
+		}
+	case "SetBlockTime":
+		if _, err := this.Transport.GetBlockTime(); err != nil {
+			return err
+		}
+	case "ResetLifeSpan":
+		if err := this.updateStatusForKey(home.ECOVACS_EVENT_LIFESPAN); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// lowLifeSpan returns true when the lifespan of a part falls below the
+// threshold, or is below the threshold when first received
+func (this *device) lowLifeSpan(message *XMPPMessage) bool {
+	threshold := this.source.lifespanThreshold
+	if threshold == 0 || message.Type() != home.ECOVACS_EVENT_LIFESPAN {
+		return false
+	}
+	part, val, total := message.LifeSpan()
+	if total == 0 || float64(val)/float64(total) >= threshold {
+		return false
+	} else if previous, exists := this.DeviceState.LifeSpan(part); exists && previous < threshold {
+		return false
+	} else {
+		return true
+	}
+}
+
+// connect connects the transport for the device. The lock should be held
+func (this *device) connect() error {
+	credential := this.account.Credential()
+	switch transport := this.Transport.(type) {
+	case *XMPPClient:
+		return transport.NewClient(xmpp.Options{
+			Host:     this.source.xmppHost,
+			User:     fmt.Sprintf("%s@%s", credential.UserId, ECOVACS_REALM),
+			Password: fmt.Sprintf("0/%s/%s", credential.Resource, credential.Token),
+			NoTLS:    true,
+			Session:  true,
+
+			Debug:     this.source.Log.IsDebug(),
+			TLSConfig: this.tlsConfig(this.source.xmppHost),
+		}, this.DeviceId_, this.Class)
+	case *JSONClient:
+		if portalURL, err := this.source.portalURL(); err != nil {
+			return err
+		} else {
+			return transport.NewClient(JSONOptions{
+				PortalURL: portalURL.String(),
+				MQTTHost:  this.source.mqttHost,
+				UserId:    credential.UserId,
+				Resource:  credential.Resource,
+				Token:     credential.Token,
+				Client:    this.source.client,
+				TLSConfig: this.tlsConfig(this.source.mqttHost),
+			})
+		}
+	default:
+		return gopi.ErrInternalAppError.WithPrefix("Connect")
+	}
+}
+
+// tlsConfig returns the configuration for TLS connections to a host, which
+// does not verify the server certificate unless a configuration has been
+// provided
+func (this *device) tlsConfig(hostport string) *tls.Config {
+	if this.source.tlsConfig == nil {
+		return &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+	config := this.source.tlsConfig.Clone()
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(hostport); err == nil {
+			config.ServerName = host
+		}
+	}
+	return config
+}
+
 func ttlForType(type_ home.EcovacsEventType) time.Duration {
 	switch type_ {
 	case home.ECOVACS_EVENT_VERSION:
 		return DELTA_VERSION_TTL
 	case home.ECOVACS_EVENT_LIFESPAN:
 		return DELTA_LIFESPAN_TTL
+	case home.ECOVACS_EVENT_MAP, home.ECOVACS_EVENT_MAPPIECE:
+		return DELTA_MAP_TTL
+	case home.ECOVACS_EVENT_CLEANSUM, home.ECOVACS_EVENT_LOG, home.ECOVACS_EVENT_SCHEDULE, home.ECOVACS_EVENT_DND:
+		return DELTA_HISTORY_TTL
 	default:
 		return DELTA_OTHER_TTL
 	}
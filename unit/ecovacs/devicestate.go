@@ -119,6 +119,39 @@ func (this *DeviceState) NextExpiredKey() home.EcovacsEventType {
 	return expired_keys[i]
 }
 
+// LifeSpans returns the remaining lifespan between 0.0 and 1.0 for
+// each part which has not expired
+func (this *DeviceState) LifeSpans() map[home.EcovacsPart]float64 {
+	this.RWMutex.RLock()
+	defer this.RWMutex.RUnlock()
+
+	lifespans := make(map[home.EcovacsPart]float64)
+	for k, v := range this.values {
+		if v.Type() != home.ECOVACS_EVENT_LIFESPAN || this.exists(k) == false {
+			continue
+		} else if part, val, total := v.LifeSpan(); total > 0 {
+			lifespans[part] = float64(val) / float64(total)
+		}
+	}
+	return lifespans
+}
+
+// LifeSpan returns the last remaining lifespan between 0.0 and 1.0 for
+// a part, including expired values, and false if no value exists
+func (this *DeviceState) LifeSpan(part home.EcovacsPart) (float64, bool) {
+	this.RWMutex.RLock()
+	defer this.RWMutex.RUnlock()
+
+	for _, v := range this.values {
+		if v.Type() != home.ECOVACS_EVENT_LIFESPAN {
+			continue
+		} else if p, val, total := v.LifeSpan(); p == part && total > 0 {
+			return float64(val) / float64(total), true
+		}
+	}
+	return 0, false
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
@@ -150,10 +183,14 @@ func (this *DeviceState) exists(key string) bool {
 func mapKey(value *XMPPMessage) string {
 	valueType := value.Type()
 	prefix := strings.TrimPrefix(fmt.Sprint(valueType), "ECOVACS_EVENT_")
-	if valueType == home.ECOVACS_EVENT_LIFESPAN {
+	switch valueType {
+	case home.ECOVACS_EVENT_LIFESPAN:
 		part, _, _ := value.LifeSpan()
 		return prefix + "_" + strings.ToUpper(fmt.Sprint(part))
-	} else {
+	case home.ECOVACS_EVENT_MAPPIECE:
+		_, piece, _ := value.MapPiece()
+		return prefix + "_" + fmt.Sprint(piece)
+	default:
 		return prefix
 	}
 }
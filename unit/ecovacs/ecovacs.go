@@ -3,15 +3,19 @@ package ecovacs
 import (
 	"bytes"
 	"crypto/rsa"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	// Frameworks
@@ -28,20 +32,63 @@ type Ecovacs struct {
 	AccountId    string
 	PasswordHash string
 	Bus          gopi.Bus
+
+	// MainURL and UserURL override MAIN_URL_FORMAT and USER_URL_FORMAT
+	// and XMPPHost overrides the XMPP server for the country, as host:port
+	MainURL  string
+	UserURL  string
+	XMPPHost string
+
+	// PortalURL overrides PORTAL_URL_FORMAT and MQTTHost overrides the
+	// MQTT broker as host:port, for devices which use JSON commands
+	PortalURL string
+	MQTTHost  string
+
+	// TLSConfig is used for HTTPS and XMPP connections when not nil
+	TLSConfig *tls.Config
+
+	// LifeSpanThreshold is the remaining lifespan between 0 and 1 below
+	// which ECOVACS_EVENT_LOWLIFESPAN is emitted, or zero to disable
+	LifeSpanThreshold float64
+
+	// Accounts are signed in to in addition to AccountId, so that devices
+	// registered under several accounts are available
+	Accounts []EcovacsAccount
+
+	// Path is the folder for the credentials file, which is relative to
+	// the home folder when not absolute, or empty to login on every start.
+	// TokenLifetime is the time for which a token is valid after login, or
+	// zero for DEFAULT_TOKEN_LIFETIME
+	Path          string
+	TokenLifetime time.Duration
+
+	// PublicKey encrypts account and password on login when not nil
+	PublicKey *rsa.PublicKey
 }
 
 type ecovacs struct {
+	// Counters are first for alignment of atomic operations
+	xmpperrors, mqtterrors uint64
+
 	country, continent, lang, timezone string
-	accountId, passwordHash            string
-	deviceId, resourceId               string
+	mainFormat, userFormat, xmppHost   string
+	portalFormat, mqttHost             string
+	tlsConfig                          *tls.Config
+	lifespanThreshold                  float64
+	deviceId                           string
+	accounts                           []*account
+	path                               string
+	lifetime                           time.Duration
 	publicKey                          *rsa.PublicKey
 	client                             *http.Client
 	meta                               url.Values
-	userId, accessToken                string
 	devices                            []home.EvovacsDevice
 	bus                                gopi.Bus
+	stop                               chan struct{}
 
 	base.Unit
+	sync.Mutex
+	sync.WaitGroup
 }
 
 type Response struct {
@@ -98,6 +145,16 @@ const (
 	ECOVACS_XMPP_PORT = 5223
 )
 
+const (
+	// Time for which a token is valid after login
+	DEFAULT_TOKEN_LIFETIME = 7 * 24 * time.Hour
+
+	// Tokens are refreshed when less than a quarter of the lifetime
+	// remains, which is checked eight times per lifetime
+	TOKEN_REFRESH_DIVISOR = 4
+	TOKEN_CHECK_DIVISOR   = 8
+)
+
 ////////////////////////////////////////////////////////////////////////////////
 // IMPLEMENTATION gopi.Unit
 
@@ -139,31 +196,120 @@ func (this *ecovacs) Init(config Ecovacs) error {
 	// Set timezone
 	this.timezone = "GMT"
 
-	// Check account, password
-	if accountId := strings.TrimSpace(config.AccountId); accountId == "" {
-		return gopi.ErrBadParameter.WithPrefix("ecovacs.email")
-	} else {
-		this.accountId = accountId
+	// Read stored credentials
+	var stored credentials
+	if path := strings.TrimSpace(config.Path); path != "" {
+		if path, err := stored.CreatePath(path); err != nil {
+			return err
+		} else if err := stored.Read(path); err != nil {
+			return err
+		} else {
+			this.path = path
+		}
 	}
-	if passwordHash := strings.TrimSpace(config.PasswordHash); passwordHash == "" {
-		return gopi.ErrBadParameter.WithPrefix("ecovacs.password")
+
+	// Set deviceId, which is kept with stored tokens
+	if stored.DeviceId != "" {
+		this.deviceId = stored.DeviceId
 	} else {
-		this.passwordHash = passwordHash
+		this.deviceId = MD5String(time.Now().String())
+	}
+
+	// Check accounts and passwords, and set resource for each account
+	accounts := config.Accounts
+	if config.AccountId != "" || config.PasswordHash != "" || len(accounts) == 0 {
+		accounts = append([]EcovacsAccount{{config.AccountId, config.PasswordHash}}, accounts...)
+	}
+	for _, account := range accounts {
+		accountId, passwordHash := strings.TrimSpace(account.AccountId), strings.TrimSpace(account.PasswordHash)
+		if accountId == "" {
+			return gopi.ErrBadParameter.WithPrefix("ecovacs.email")
+		} else if passwordHash == "" {
+			return gopi.ErrBadParameter.WithPrefix("ecovacs.password")
+		} else if this.account(accountId) != nil {
+			return gopi.ErrDuplicateItem.WithPrefix(accountId)
+		}
+		credential := stored.Credential(accountId)
+		if credential.Resource == "" {
+			credential.Resource = MD5String(this.deviceId + accountId)[0:8]
+		}
+		this.accounts = append(this.accounts, newAccount(credential, passwordHash))
 	}
 
-	// Set deviceId and resouceId
-	this.deviceId = MD5String(time.Now().String())
-	this.resourceId = this.deviceId[0:8]
+	// Set token lifetime
+	if config.TokenLifetime < 0 {
+		return gopi.ErrBadParameter.WithPrefix("TokenLifetime")
+	} else if config.TokenLifetime == 0 {
+		this.lifetime = DEFAULT_TOKEN_LIFETIME
+	} else {
+		this.lifetime = config.TokenLifetime
+	}
 
 	// Load public key
-	if key, err := DecodePublicKey(); err != nil {
+	if config.PublicKey != nil {
+		this.publicKey = config.PublicKey
+	} else if key, err := DecodePublicKey(); err != nil {
 		return err
 	} else {
 		this.publicKey = key
 	}
 
+	// Set endpoints, which default to the Ecovacs servers
+	if mainURL := strings.TrimSpace(config.MainURL); mainURL != "" {
+		this.mainFormat = mainURL
+	} else {
+		this.mainFormat = MAIN_URL_FORMAT
+	}
+	if userURL := strings.TrimSpace(config.UserURL); userURL != "" {
+		this.userFormat = userURL
+	} else {
+		this.userFormat = USER_URL_FORMAT
+	}
+	if xmppHost := strings.TrimSpace(config.XMPPHost); xmppHost != "" {
+		if _, _, err := net.SplitHostPort(xmppHost); err != nil {
+			return gopi.ErrBadParameter.WithPrefix("ecovacs.xmpp")
+		} else {
+			this.xmppHost = xmppHost
+		}
+	} else if server := CountryToXMPPServer(this.country); server == "" {
+		return gopi.ErrBadParameter.WithPrefix("ecovacs.country")
+	} else {
+		this.xmppHost = fmt.Sprintf("%s:%d", server, ECOVACS_XMPP_PORT)
+	}
+
+	if portalURL := strings.TrimSpace(config.PortalURL); portalURL != "" {
+		this.portalFormat = portalURL
+	} else {
+		this.portalFormat = PORTAL_URL_FORMAT
+	}
+	if mqttHost := strings.TrimSpace(config.MQTTHost); mqttHost != "" {
+		if _, _, err := net.SplitHostPort(mqttHost); err != nil {
+			return gopi.ErrBadParameter.WithPrefix("ecovacs.mqtt")
+		} else {
+			this.mqttHost = mqttHost
+		}
+	} else {
+		this.mqttHost = fmt.Sprintf(MQTT_HOST_FORMAT+":%d", this.continent, ECOVACS_MQTT_PORT)
+	}
+
+	// Set lifespan threshold
+	if config.LifeSpanThreshold < 0 || config.LifeSpanThreshold > 1 {
+		return gopi.ErrBadParameter.WithPrefix("ecovacs.lifespan")
+	} else {
+		this.lifespanThreshold = config.LifeSpanThreshold
+	}
+
 	// Set HTTP client
-	this.client = &http.Client{}
+	if config.TLSConfig != nil {
+		this.tlsConfig = config.TLSConfig.Clone()
+		this.client = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: this.tlsConfig,
+			},
+		}
+	} else {
+		this.client = &http.Client{}
+	}
 
 	// Set signing metadata
 	this.meta = url.Values{
@@ -176,15 +322,24 @@ func (this *ecovacs) Init(config Ecovacs) error {
 		"deviceType": []string{"1"},
 	}
 
+	// Refresh tokens in the background
+	this.stop = make(chan struct{})
+	this.WaitGroup.Add(1)
+	go this.refresh(this.stop)
+
 	// Success
 	return nil
 }
 
 func (this *ecovacs) Close() error {
+	// Stop refreshing tokens
+	close(this.stop)
+	this.WaitGroup.Wait()
+
 	// Close devices
 	err := gopi.NewCompoundError()
-	for _, d := range this.devices {
-		err.Add(d.(*device).Disconnect())
+	for _, device := range this.deviceList() {
+		err.Add(device.Disconnect())
 	}
 	if err.ErrorOrSelf() != nil {
 		return err.ErrorOrSelf()
@@ -192,9 +347,11 @@ func (this *ecovacs) Close() error {
 
 	// Release resources
 	this.publicKey = nil
+	this.tlsConfig = nil
 	this.client = nil
 	this.meta = nil
 	this.devices = nil
+	this.accounts = nil
 	this.bus = nil
 
 	// Return success
@@ -204,98 +361,127 @@ func (this *ecovacs) Close() error {
 ////////////////////////////////////////////////////////////////////////////////
 // IMPLEMENTATION mutablehome.Ecovacs
 
+// Authenticate logs in to each account, unless there is a stored token
+// which is accepted and does not need to be refreshed
 func (this *ecovacs) Authenticate() error {
-	var token AccessToken
-	var authCode AuthCode
-
-	if account, err := Encrypt(this.publicKey, this.accountId); err != nil {
-		return err
-	} else if password, err := Encrypt(this.publicKey, this.passwordHash); err != nil {
-		return err
-	} else if uri, err := this.mainURL("/user/login"); err != nil {
-		return err
-	} else if status, response, err := this.callMain(uri, url.Values{
-		"account":  []string{account},
-		"password": []string{password},
-	}); err != nil {
-		return err
-	} else if status != http.StatusOK {
-		return gopi.ErrUnexpectedResponse.WithPrefix(http.StatusText(status))
-	} else if err := json.Unmarshal(response, &token); err != nil {
-		return err
-	} else if token.Code == "1005" {
-		return home.ErrAuthenticationError
-	} else if token.Code != "0000" {
-		return gopi.ErrUnexpectedResponse.WithPrefix(token.Code)
-	} else if uri, err := this.mainURL("/user/getAuthCode"); err != nil {
-		return err
-	} else if status, response, err := this.callMain(uri, url.Values{
-		"uid":         []string{token.Data.UserId},
-		"accessToken": []string{token.Data.AccessToken},
-	}); err != nil {
-		return err
-	} else if status != http.StatusOK {
-		return gopi.ErrUnexpectedResponse.WithPrefix(http.StatusText(status))
-	} else if err := json.Unmarshal(response, &authCode); err != nil {
-		return err
-	} else if token.Code != "0000" {
-		return gopi.ErrUnexpectedResponse.WithPrefix(token.Code)
-	} else if response, err := this.callUserLogin(token, authCode); err != nil {
-		return err
-	} else {
-		this.accessToken = response.Token
-		if response.UserId != token.Data.UserId {
-			this.userId = response.UserId
-		} else {
-			this.userId = token.Data.UserId
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	for _, account := range this.accounts {
+		if account.IsValid(this.lifetime / TOKEN_REFRESH_DIVISOR) {
+			if _, err := this.callDevices(account); err == nil {
+				this.Log.Debug("Authenticate:", account, "(using stored token)")
+				continue
+			} else {
+				this.Log.Debug("Authenticate:", account, err, "(logging in)")
+			}
+		}
+		if err := this.login(account); err != nil {
+			return err
 		}
 	}
 
-	// Authentication success
-	return nil
+	// Store tokens
+	return this.writeCredentials()
 }
 
 func (this *ecovacs) Devices() ([]home.EvovacsDevice, error) {
-	if this.userId == "" || this.accessToken == "" {
-		return nil, gopi.ErrInternalAppError
-	} else if this.devices == nil {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	for _, account := range this.accounts {
+		if credential := account.Credential(); credential.UserId == "" || credential.Token == "" {
+			return nil, gopi.ErrInternalAppError
+		}
+	}
+	if this.devices == nil {
 		this.devices = make([]home.EvovacsDevice, 0, 1)
 	}
 
+	// Devices shared between accounts use the first account
 	if len(this.devices) == 0 {
-		if devices, err := this.callDevices(); err != nil {
-			return nil, err
-		} else {
-			for _, device := range devices {
-				device.source = this
-				this.devices = append(this.devices, device)
+		for _, account := range this.accounts {
+			if devices, err := this.callDevices(account); err != nil {
+				return nil, err
+			} else {
+				for _, device := range devices {
+					if this.device(device.DeviceId_) != nil {
+						continue
+					}
+					device.source = this
+					device.account = account
+					device.Transport = NewTransport(device.DeviceId_, device.Class, device.Resource)
+					this.devices = append(this.devices, device)
+				}
 			}
 		}
 	}
 
-	return this.devices, nil
+	// Return a copy so that callers can range over devices while
+	// they are being appended
+	devices := make([]home.EvovacsDevice, len(this.devices))
+	copy(devices, this.devices)
+	return devices, nil
 }
 
 // Connect to a device to start reading messages
 func (this *ecovacs) Connect(d home.EvovacsDevice) error {
-	for _, e := range this.devices {
-		if d == e {
-			this.Log.Debug("Connect:", d)
-			return d.(*device).Connect()
-		}
+	if device := this.member(d); device == nil {
+		return gopi.ErrNotFound.WithPrefix("Connect")
+	} else {
+		this.Log.Debug("Connect:", d)
+		return device.Connect()
 	}
-	return gopi.ErrNotFound.WithPrefix("Connect")
 }
 
 // Disconnect from a device to stop updating
 func (this *ecovacs) Disconnect(d home.EvovacsDevice) error {
-	for _, e := range this.devices {
-		if d == e {
-			this.Log.Debug("Disconect:", d)
-			return d.(*device).Disconnect()
+	if device := this.member(d); device == nil {
+		return gopi.ErrNotFound.WithPrefix("Disconnect")
+	} else {
+		this.Log.Debug("Disconect:", d)
+		return device.Disconnect()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// METRICS
+
+// Metrics returns the remaining lifespan of consumable parts for each
+// device, and the number of errors for each transport
+func (this *ecovacs) Metrics() []home.Metric {
+	metrics := []home.Metric{}
+	for _, device := range this.deviceList() {
+		for part, value := range device.DeviceState.LifeSpans() {
+			metrics = append(metrics, home.Metric{
+				Name: "mutablehome_ecovacs_lifespan",
+				Help: "Remaining lifespan of a consumable part between 0 and 1",
+				Type: home.METRIC_GAUGE,
+				Labels: map[string]string{
+					"device": device.Id(),
+					"name":   device.Nickname(),
+					"part":   strings.ToLower(string(part)),
+				},
+				Value: value,
+			})
 		}
 	}
-	return gopi.ErrNotFound.WithPrefix("Disconnect")
+	for _, transport := range []struct {
+		name   string
+		errors *uint64
+	}{
+		{"xmpp", &this.xmpperrors},
+		{"mqtt", &this.mqtterrors},
+	} {
+		metrics = append(metrics, home.Metric{
+			Name:   "mutablehome_ecovacs_errors_total",
+			Help:   "Number of errors communicating with devices",
+			Type:   home.METRIC_COUNTER,
+			Labels: map[string]string{"transport": transport.name},
+			Value:  float64(atomic.LoadUint64(transport.errors)),
+		})
+	}
+	return metrics
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -307,8 +493,7 @@ func (this *ecovacs) String() string {
 		" continent=" + strconv.Quote(this.continent) +
 		" lang=" + strconv.Quote(this.lang) +
 		" timezone=" + strconv.Quote(this.timezone) +
-		" accountId=" + strconv.Quote(this.accountId) +
-		" passwordHash=" + strconv.Quote(this.passwordHash) +
+		" accounts=" + fmt.Sprint(this.accounts) +
 		" devices=" + fmt.Sprint(this.Devices()) +
 		">"
 }
@@ -327,7 +512,7 @@ func (this *ecovacs) mainURL(path string) (*url.URL, error) {
 	if path != "" && strings.HasPrefix(path, "/") == false {
 		return nil, fmt.Errorf("Invalid path")
 	}
-	if templ, err := template.New("MAIN_URL_FORMAT").Parse(MAIN_URL_FORMAT); err != nil {
+	if templ, err := template.New("MAIN_URL_FORMAT").Parse(this.mainFormat); err != nil {
 		return nil, err
 	} else if err := templ.Execute(&buf, data); err != nil {
 		return nil, err
@@ -343,7 +528,23 @@ func (this *ecovacs) userURL() (*url.URL, error) {
 	data := map[string]string{
 		"continent": this.continent,
 	}
-	if templ, err := template.New("USER_URL_FORMAT").Parse(USER_URL_FORMAT); err != nil {
+	if templ, err := template.New("USER_URL_FORMAT").Parse(this.userFormat); err != nil {
+		return nil, err
+	} else if err := templ.Execute(&buf, data); err != nil {
+		return nil, err
+	} else if url, err := url.Parse(buf.String()); err != nil {
+		return nil, err
+	} else {
+		return url, nil
+	}
+}
+
+func (this *ecovacs) portalURL() (*url.URL, error) {
+	var buf bytes.Buffer
+	data := map[string]string{
+		"continent": this.continent,
+	}
+	if templ, err := template.New("PORTAL_URL_FORMAT").Parse(this.portalFormat); err != nil {
 		return nil, err
 	} else if err := templ.Execute(&buf, data); err != nil {
 		return nil, err
@@ -354,21 +555,164 @@ func (this *ecovacs) userURL() (*url.URL, error) {
 	}
 }
 
-func (this *ecovacs) callDevices() ([]*device, error) {
+// login logs in to an account with account and password, and sets the
+// token issued
+func (this *ecovacs) login(account *account) error {
+	var token AccessToken
+	var authCode AuthCode
+
+	if accountId, err := Encrypt(this.publicKey, account.AccountId); err != nil {
+		return err
+	} else if password, err := Encrypt(this.publicKey, account.passwordHash); err != nil {
+		return err
+	} else if uri, err := this.mainURL("/user/login"); err != nil {
+		return err
+	} else if status, response, err := this.callMain(uri, url.Values{
+		"account":  []string{accountId},
+		"password": []string{password},
+	}); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return gopi.ErrUnexpectedResponse.WithPrefix(http.StatusText(status))
+	} else if err := json.Unmarshal(response, &token); err != nil {
+		return err
+	} else if token.Code == "1005" {
+		return home.ErrAuthenticationError
+	} else if token.Code != "0000" {
+		return gopi.ErrUnexpectedResponse.WithPrefix(token.Code)
+	} else if uri, err := this.mainURL("/user/getAuthCode"); err != nil {
+		return err
+	} else if status, response, err := this.callMain(uri, url.Values{
+		"uid":         []string{token.Data.UserId},
+		"accessToken": []string{token.Data.AccessToken},
+	}); err != nil {
+		return err
+	} else if status != http.StatusOK {
+		return gopi.ErrUnexpectedResponse.WithPrefix(http.StatusText(status))
+	} else if err := json.Unmarshal(response, &authCode); err != nil {
+		return err
+	} else if authCode.Code != "0000" {
+		return gopi.ErrUnexpectedResponse.WithPrefix(authCode.Code)
+	} else if response, err := this.callUserLogin(account, token, authCode); err != nil {
+		return err
+	} else {
+		if response.UserId != token.Data.UserId {
+			account.SetToken(response.UserId, response.Token, this.lifetime)
+		} else {
+			account.SetToken(token.Data.UserId, response.Token, this.lifetime)
+		}
+	}
+
+	// Authentication success
+	return nil
+}
+
+// refresh logs in to accounts with tokens which are about to expire
+// until stop is closed. Connected devices continue to use the previous
+// token until they reconnect
+func (this *ecovacs) refresh(stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+	ticker := time.NewTicker(this.lifetime / TOKEN_CHECK_DIVISOR)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			this.Mutex.Lock()
+			for _, account := range this.accounts {
+				if account.ExpiresWithin(this.lifetime/TOKEN_REFRESH_DIVISOR) == false {
+					continue
+				} else if err := this.login(account); err != nil {
+					this.Log.Warn("Refresh:", account, err)
+				} else if err := this.writeCredentials(); err != nil {
+					this.Log.Warn("Refresh:", err)
+				} else {
+					this.Log.Debug("Refresh:", account)
+				}
+			}
+			this.Mutex.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// writeCredentials stores the tokens for all accounts when there is a
+// path for the credentials file. The lock should be held
+func (this *ecovacs) writeCredentials() error {
+	if this.path == "" {
+		return nil
+	}
+	stored := credentials{DeviceId: this.deviceId}
+	for _, account := range this.accounts {
+		stored.Accounts = append(stored.Accounts, account.Credential())
+	}
+	return stored.Write(this.path)
+}
+
+// account returns an account by account identifier, or nil
+func (this *ecovacs) account(accountId string) *account {
+	for _, account := range this.accounts {
+		if account.AccountId == accountId {
+			return account
+		}
+	}
+	return nil
+}
+
+// member returns a device which was returned by Devices, or nil
+func (this *ecovacs) member(d home.EvovacsDevice) *device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	for _, e := range this.devices {
+		if d == e {
+			if device, ok := e.(*device); ok {
+				return device
+			}
+		}
+	}
+	return nil
+}
+
+// deviceList returns a copy of the devices returned by Devices
+func (this *ecovacs) deviceList() []*device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	devices := make([]*device, 0, len(this.devices))
+	for _, d := range this.devices {
+		if device, ok := d.(*device); ok {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// device returns a device by device identifier, or nil. The lock
+// should be held
+func (this *ecovacs) device(deviceId string) *device {
+	for _, d := range this.devices {
+		if d.Id() == deviceId {
+			return d.(*device)
+		}
+	}
+	return nil
+}
+
+func (this *ecovacs) callDevices(account *account) ([]*device, error) {
 	var devices DevicesResponse
+	credential := account.Credential()
 	if data, err := this.callUser("GetDeviceList", map[string]interface{}{
-		"userid": this.userId,
+		"userid": credential.UserId,
 		"auth": map[string]string{
 			"with":     "users",
-			"userid":   this.userId,
+			"userid":   credential.UserId,
 			"realm":    ECOVACS_REALM,
-			"token":    this.accessToken,
-			"resource": this.resourceId,
+			"token":    credential.Token,
+			"resource": credential.Resource,
 		},
 	}); err != nil {
 		return nil, err
 	} else if err := json.Unmarshal(data, &devices); err != nil {
-		return nil, nil
+		return nil, err
 	} else if devices.Result != "ok" && devices.ErrorMessage != "" {
 		return nil, gopi.ErrUnexpectedResponse.WithPrefix(devices.ErrorMessage)
 	} else if devices.Result != "ok" {
@@ -378,11 +722,11 @@ func (this *ecovacs) callDevices() ([]*device, error) {
 	}
 }
 
-func (this *ecovacs) callUserLogin(token AccessToken, auth AuthCode) (*LoginResponse, error) {
+func (this *ecovacs) callUserLogin(account *account, token AccessToken, auth AuthCode) (*LoginResponse, error) {
 	var login LoginResponse
 	if data, err := this.callUser("loginByItToken", map[string]interface{}{
 		"country":  strings.ToUpper(token.Data.Country),
-		"resource": this.resourceId,
+		"resource": account.Credential().Resource,
 		"realm":    ECOVACS_REALM,
 		"userId":   token.Data.UserId,
 		"token":    auth.Data.AuthCode,
@@ -474,7 +818,21 @@ func (this *ecovacs) signParams(params url.Values) url.Values {
 	return params
 }
 
+// transportError counts an error communicating with a device and
+// returns the error
+func (this *ecovacs) transportError(d *device, err error) error {
+	if err == nil {
+		return nil
+	} else if _, ok := d.Transport.(*JSONClient); ok {
+		atomic.AddUint64(&this.mqtterrors, 1)
+	} else {
+		atomic.AddUint64(&this.xmpperrors, 1)
+	}
+	return err
+}
+
 func (this *ecovacs) deviceError(d *device, err error) {
+	this.transportError(d, err)
 	this.Log.Error(fmt.Errorf("%v: %w", d.Address(), err))
 
 	// Disconnect and then reconnect when any device error occurs
@@ -0,0 +1,1215 @@
+package ecovacs_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	mutablehome "github.com/djthorpe/mutablehome"
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+	sim "github.com/djthorpe/mutablehome/unit/ecovacs/sim"
+	xmpp "github.com/mattn/go-xmpp"
+
+	// Units
+	_ "github.com/djthorpe/gopi/v2/unit/bus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Test_Ecovacs_000(t *testing.T) {
+	t.Log("Test_Ecovacs_000")
+}
+
+func Test_Ecovacs_001(t *testing.T) {
+	// Parse responses and reports
+	tests := []struct {
+		query string
+		typ   mutablehome.EcovacsEventType
+	}{
+		{`<query xmlns="com:ctl"><ctl ret="ok"><battery power="080"/></ctl></query>`, mutablehome.ECOVACS_EVENT_BATTERYLEVEL},
+		{`<query xmlns="com:ctl"><ctl td="CleanReport"><clean type="auto" speed="strong"/></ctl></query>`, mutablehome.ECOVACS_EVENT_CLEANSTATE},
+		{`<query xmlns="com:ctl"><ctl ret="ok"><charge type="SlotCharging"/></ctl></query>`, mutablehome.ECOVACS_EVENT_CHARGESTATE},
+		{`<query xmlns="com:ctl"><ctl ret="ok" type="Brush" val="25" total="100"/></query>`, mutablehome.ECOVACS_EVENT_LIFESPAN},
+		{`<query xmlns="com:ctl"><ctl ret="ok"><ver name="FW">0.13.5</ver></ctl></query>`, mutablehome.ECOVACS_EVENT_VERSION},
+		{`<query xmlns="com:ctl"><ctl ret="fail" errno="101"/></query>`, mutablehome.ECOVACS_EVENT_ERROR},
+		{`<query xmlns="com:ctl"><ctl ret="ok"/></query>`, mutablehome.ECOVACS_EVENT_NONE},
+	}
+	for _, test := range tests {
+		if message, err := ecovacs.Parse(xmpp.IQ{ID: "1", Type: "set", Query: []byte(test.query)}); err != nil {
+			t.Error(err)
+		} else if message == nil {
+			t.Error("Expected message for", test.query)
+		} else if message.Type() != test.typ {
+			t.Error("Unexpected type", message.Type(), "for", test.query)
+		} else if message.Id() != "1" {
+			t.Error("Unexpected id", message.Id())
+		}
+	}
+
+	// Values
+	if message, err := ecovacs.Parse(xmpp.IQ{Type: "set", Query: []byte(tests[0].query)}); err != nil {
+		t.Error(err)
+	} else if message.BatteryLevel() != 80 {
+		t.Error("Unexpected battery level", message.BatteryLevel())
+	}
+	if message, err := ecovacs.Parse(xmpp.IQ{Type: "set", Query: []byte(tests[1].query)}); err != nil {
+		t.Error(err)
+	} else if mode, suction := message.CleanState(); mode != mutablehome.ECOVACS_CLEAN_AUTO || suction != mutablehome.ECOVACS_SUCTION_STRONG {
+		t.Error("Unexpected clean state", mode, suction)
+	}
+	if message, err := ecovacs.Parse(xmpp.IQ{Type: "set", Query: []byte(tests[5].query)}); err != nil {
+		t.Error(err)
+	} else if errno, msg := message.Error(); errno != 101 || msg != "BatteryLow" {
+		t.Error("Unexpected error", errno, msg)
+	}
+
+	// Results and empty queries are ignored
+	if message, err := ecovacs.Parse(xmpp.IQ{Type: "result", Query: []byte(tests[0].query)}); err != nil || message != nil {
+		t.Error("Expected result to be ignored", message, err)
+	} else if message, err := ecovacs.Parse(xmpp.IQ{Type: "set"}); err != nil || message != nil {
+		t.Error("Expected empty query to be ignored", message, err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Test_Ecovacs_002(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		if _, err := account.Devices(); err == nil {
+			t.Error("Expected error listing devices before authentication")
+		}
+		if err := account.Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		if devices, err := account.Devices(); err != nil {
+			t.Error(err)
+		} else if len(devices) != 2 {
+			t.Error("Unexpected devices", devices)
+		} else if devices[0].Id() != SIM_ROBOT || devices[0].Nickname() != "Deebot" {
+			t.Error("Unexpected device", devices[0])
+		} else if devices[0].Address() != SIM_ROBOT+"@ls1ok3.ecorobot.net/atom" {
+			t.Error("Unexpected address", devices[0].Address())
+		}
+	})
+}
+
+func Test_Ecovacs_003(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		backend.SetAuthError(true)
+		if err := account.Authenticate(); err != mutablehome.ErrAuthenticationError {
+			t.Error("Expected authentication error, got", err)
+		}
+		backend.SetAuthError(false)
+		if err := account.Authenticate(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func Test_Ecovacs_004(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		events := make(chan mutablehome.EcovacsEvent, 100)
+		if err := app.Bus().NewHandler(gopi.EventHandler{
+			Name: "ecovacs.Event",
+			Handler: func(_ context.Context, _ gopi.App, evt gopi.Event) {
+				events <- evt.(mutablehome.EcovacsEvent)
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := account.Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		devices, err := account.Devices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		device := devices[0]
+		if err := account.Connect(device); err != nil {
+			t.Fatal(err)
+		}
+
+		// Request battery level
+		if _, err := device.GetBatteryInfo(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_BATTERYLEVEL); evt == nil {
+			t.Error("Expected battery level event")
+		} else if evt.Value() != uint(100) || evt.Device() != device {
+			t.Error("Unexpected event", evt.Value(), evt.Device())
+		}
+
+		// Start cleaning, which is reported
+		if _, err := device.Clean(mutablehome.ECOVACS_CLEAN_AUTO, mutablehome.ECOVACS_SUCTION_STRONG); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_CLEANSTATE); evt == nil {
+			t.Error("Expected clean state event")
+		} else if value := evt.Value().([]interface{}); value[0] != mutablehome.ECOVACS_CLEAN_AUTO || value[1] != mutablehome.ECOVACS_SUCTION_STRONG {
+			t.Error("Unexpected clean state", value)
+		}
+
+		// Lifespan
+		if _, err := device.GetLifeSpan(mutablehome.ECOVACS_PART_BRUSH); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_LIFESPAN); evt == nil {
+			t.Error("Expected lifespan event")
+		} else if value := evt.Value().([]interface{}); value[0] != mutablehome.ECOVACS_PART_BRUSH || value[1] != uint(90) {
+			t.Error("Unexpected lifespan", value)
+		}
+
+		// Reports from the robot
+		if err := backend.SetBatteryLevel(SIM_ROBOT, 42); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_BATTERYLEVEL); evt == nil {
+			t.Error("Expected battery level event")
+		} else if evt.Value() != uint(42) {
+			t.Error("Unexpected battery level", evt.Value())
+		}
+
+		// Check requests received by the robot
+		if requests := backend.Requests(SIM_ROBOT); len(requests) != 3 {
+			t.Error("Unexpected requests", requests)
+		} else if requests[0] != "GetBatteryInfo" || requests[1] != "Clean" || requests[2] != "GetLifeSpan" {
+			t.Error("Unexpected requests", requests)
+		}
+
+		if err := account.Disconnect(device); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func Test_Ecovacs_005(t *testing.T) {
+	// Map piece compressed by the reference encoder, which includes matches
+	if data, err := base64.StdEncoding.DecodeString(MAP_PIECE); err != nil {
+		t.Fatal(err)
+	} else if cells, err := ecovacs.DecompressLZMA(data); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(cells, MapPiece()) {
+		t.Error("Unexpected map piece")
+	} else if _, err := ecovacs.DecompressLZMA(data[:len(data)/2]); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+
+	// Assemble a map with one non-empty piece
+	m, err := ecovacs.NewMap(ecovacs.MapInfo{
+		Id: "1", PieceWidth: 100, PieceHeight: 100, Rows: 2, Columns: 2, Resolution: 50,
+		CRC: []uint32{MAP_PIECE_EMPTY, MAP_PIECE_EMPTY, MAP_PIECE_EMPTY, MAP_PIECE_CRC},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if pieces := m.Pieces(); len(pieces) != 1 || pieces[0] != 3 || m.Complete() {
+		t.Error("Unexpected pieces", pieces)
+	}
+	data, _ := base64.StdEncoding.DecodeString(MAP_PIECE)
+	if err := m.SetPiece(3, data); err != nil {
+		t.Error(err)
+	} else if m.Complete() == false {
+		t.Error("Expected complete map")
+	} else if w, h := m.Size(); w != 200 || h != 200 {
+		t.Error("Unexpected size", w, h)
+	} else if cell := m.Cell(110, 110); cell != mutablehome.ECOVACS_MAP_WALL {
+		t.Error("Unexpected cell", cell)
+	} else if cell := m.Cell(140, 150); cell != mutablehome.ECOVACS_MAP_CARPET {
+		t.Error("Unexpected cell", cell)
+	} else if cell := m.Cell(50, 50); cell != mutablehome.ECOVACS_MAP_NONE {
+		t.Error("Unexpected cell", cell)
+	} else if x, y := m.Point(mutablehome.EcovacsPosition{X: 1000, Y: -500}); x != 120 || y != 90 {
+		t.Error("Unexpected point", x, y)
+	}
+
+	// Pieces are retained when the checksum doesn't change
+	if m2, err := ecovacs.NewMap(ecovacs.MapInfo{
+		Id: "1", PieceWidth: 100, PieceHeight: 100, Rows: 2, Columns: 2, Resolution: 50,
+		CRC: []uint32{MAP_PIECE_EMPTY, MAP_PIECE_EMPTY, MAP_PIECE_EMPTY, MAP_PIECE_CRC},
+	}, m); err != nil {
+		t.Error(err)
+	} else if m2.Complete() == false || m2.Cell(110, 110) != mutablehome.ECOVACS_MAP_WALL {
+		t.Error("Expected pieces to be retained")
+	}
+
+	// Render the explored area with a margin
+	robot := mutablehome.EcovacsPosition{X: 1000, Y: 1000}
+	if img, err := ecovacs.NewMapImage(m, 2, &robot, nil); err != nil {
+		t.Error(err)
+	} else if size := img.Bounds().Size(); size.X != (80+8)*2 || size.Y != (80+8)*2 {
+		t.Error("Unexpected image size", size)
+	} else if c := img.RGBAAt(4*2, 4*2); c != ecovacs.MAP_COLOR_WALL {
+		t.Error("Unexpected color", c)
+	} else if c := img.RGBAAt((120-106)*2, (120-106)*2); c != ecovacs.MAP_COLOR_ROBOT {
+		t.Error("Unexpected color", c)
+	}
+}
+
+func Test_Ecovacs_006(t *testing.T) {
+	// Reports and responses for map, position and clean history
+	tests := []struct {
+		query string
+		typ   mutablehome.EcovacsEventType
+	}{
+		{`<query xmlns="com:ctl"><ctl td="Pos" t="p" p="-116,49" a="-46" valid="1"/></query>`, mutablehome.ECOVACS_EVENT_POSITION},
+		{`<query xmlns="com:ctl"><ctl td="ChargerPos" p="0,-1400" a="90"/></query>`, mutablehome.ECOVACS_EVENT_CHARGERPOSITION},
+		{`<query xmlns="com:ctl"><ctl ret="ok" i="7" w="100" h="100" r="1" c="2" p="50" m="1295764014,3152320308"/></query>`, mutablehome.ECOVACS_EVENT_MAP},
+		{`<query xmlns="com:ctl"><ctl ret="ok" i="7" pid="1" p="` + MAP_PIECE + `"/></query>`, mutablehome.ECOVACS_EVENT_MAPPIECE},
+		{`<query xmlns="com:ctl"><ctl ret="ok"><CleanSt a="10" s="1577836800" l="1080" t="auto" f="a"/></ctl></query>`, mutablehome.ECOVACS_EVENT_LOG},
+	}
+	messages := make([]*ecovacs.XMPPMessage, len(tests))
+	for i, test := range tests {
+		if message, err := ecovacs.Parse(xmpp.IQ{ID: "1", Type: "set", Query: []byte(test.query)}); err != nil {
+			t.Error(err)
+		} else if message.Type() != test.typ {
+			t.Error("Unexpected type", message.Type(), "for", test.query)
+		} else {
+			messages[i] = message
+		}
+	}
+	if position := messages[0].Value(); position != (mutablehome.EcovacsPosition{X: -116, Y: 49, Angle: -46}) {
+		t.Error("Unexpected position", position)
+	}
+	if info, err := messages[2].MapInfo(); err != nil {
+		t.Error(err)
+	} else if info.Id != "7" || info.Rows != 1 || info.Columns != 2 || info.Resolution != 50 || len(info.CRC) != 2 || info.CRC[1] != MAP_PIECE_CRC {
+		t.Error("Unexpected map info", info)
+	}
+	if id, piece, data := messages[3].MapPiece(); id != "7" || piece != 1 || len(data) == 0 {
+		t.Error("Unexpected map piece", id, piece)
+	}
+	if logs := messages[4].CleanLogs(); len(logs) != 1 {
+		t.Error("Unexpected logs", logs)
+	} else if logs[0].Area != 10 || logs[0].Duration != 18*time.Minute || logs[0].Mode != mutablehome.ECOVACS_CLEAN_AUTO || logs[0].Start.Unix() != 1577836800 {
+		t.Error("Unexpected log", logs[0])
+	}
+
+	// Responses without a command name are typed from the request
+	query := []byte(`<query xmlns="com:ctl"><ctl ret="ok" a="22" l="2280" c="2"/></query>`)
+	if message, err := ecovacs.Parse(xmpp.IQ{ID: "2", Type: "set", Query: query}); err != nil {
+		t.Error(err)
+	} else if message.Type() != mutablehome.ECOVACS_EVENT_NONE {
+		t.Error("Unexpected type", message.Type())
+	} else if message.SetRequest("GetCleanSum"); message.Type() != mutablehome.ECOVACS_EVENT_CLEANSUM {
+		t.Error("Unexpected type", message.Type())
+	} else if sum := message.Value(); sum != (mutablehome.EcovacsCleanSum{Area: 22, Duration: 38 * time.Minute, Count: 2}) {
+		t.Error("Unexpected clean sum", sum)
+	}
+}
+
+func Test_Ecovacs_007(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		events := make(chan mutablehome.EcovacsEvent, 100)
+		if err := app.Bus().NewHandler(gopi.EventHandler{
+			Name: "ecovacs.Event",
+			Handler: func(_ context.Context, _ gopi.App, evt gopi.Event) {
+				events <- evt.(mutablehome.EcovacsEvent)
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := account.Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		devices, err := account.Devices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		device := devices[0]
+		if err := account.Connect(device); err != nil {
+			t.Fatal(err)
+		}
+		defer account.Disconnect(device)
+
+		// Charger position
+		var charger mutablehome.EcovacsPosition
+		if _, err := device.GetChargerPos(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_CHARGERPOSITION); evt == nil {
+			t.Error("Expected charger position event")
+		} else if charger = evt.Value().(mutablehome.EcovacsPosition); charger.Y != -1400 {
+			t.Error("Unexpected charger position", charger)
+		}
+
+		// Robot position is reported
+		if err := backend.SetPosition(SIM_ROBOT, 500, 250, 180); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_POSITION); evt == nil {
+			t.Error("Expected position event")
+		} else if value := evt.Value(); value != (mutablehome.EcovacsPosition{X: 500, Y: 250, Angle: 180}) {
+			t.Error("Unexpected position", value)
+		}
+
+		// Map metadata causes pieces to be pulled
+		if device.Map() != nil {
+			t.Error("Expected no map before GetMapM")
+		}
+		if _, err := device.GetMapM(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_MAP); evt == nil {
+			t.Error("Expected map event")
+		} else if m := WaitForMap(device, 400, 400, mutablehome.ECOVACS_MAP_FLOOR); m == nil {
+			t.Error("Expected complete map")
+		} else if x, y := m.Point(charger); m.Cell(uint(x), uint(y)) != mutablehome.ECOVACS_MAP_FLOOR || m.Cell(uint(x), uint(y-2)) != mutablehome.ECOVACS_MAP_WALL {
+			t.Error("Unexpected charger cell", x, y)
+		} else {
+			var buf bytes.Buffer
+			robot := mutablehome.EcovacsPosition{X: 500, Y: 250}
+			if err := ecovacs.WriteMapPNG(&buf, m, 1, &robot, &charger); err != nil {
+				t.Error(err)
+			} else if img, err := png.Decode(&buf); err != nil {
+				t.Error(err)
+			} else if size := img.Bounds().Size(); size.X != 80+8 || size.Y != 60+8 {
+				t.Error("Unexpected image size", size)
+			}
+		}
+
+		// Only changed pieces are pulled again
+		if err := backend.SetCell(SIM_ROBOT, 401, 401, 2); err != nil {
+			t.Error(err)
+		} else if _, err := device.GetMapM(); err != nil {
+			t.Error(err)
+		} else if m := WaitForMap(device, 401, 401, mutablehome.ECOVACS_MAP_WALL); m == nil {
+			t.Error("Expected updated map")
+		}
+		pulled := 0
+		for _, request := range backend.Requests(SIM_ROBOT) {
+			if request == "PullMP" {
+				pulled++
+			}
+		}
+		if pulled != 4+1 {
+			t.Error("Unexpected number of pieces pulled", pulled)
+		}
+
+		// Clean history
+		if _, err := device.GetCleanSum(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_CLEANSUM); evt == nil {
+			t.Error("Expected clean sum event")
+		} else if sum := evt.Value().(mutablehome.EcovacsCleanSum); sum.Count != 2 || sum.Area != 22 {
+			t.Error("Unexpected clean sum", sum)
+		}
+		if _, err := device.GetCleanLogs(1); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_LOG); evt == nil {
+			t.Error("Expected clean logs event")
+		} else if logs := evt.Value().([]mutablehome.EcovacsCleanLog); len(logs) != 1 || logs[0].Area != 10 {
+			t.Error("Unexpected clean logs", logs)
+		}
+	})
+}
+
+func Test_Ecovacs_008(t *testing.T) {
+	// Time of day
+	if value, err := ecovacs.ParseTimeOfDay("9:05"); err != nil {
+		t.Error(err)
+	} else if value != 9*time.Hour+5*time.Minute || ecovacs.FormatTimeOfDay(value) != "09:05" {
+		t.Error("Unexpected time of day", value)
+	}
+	for _, value := range []string{"", "24:00", "12:60", "12", "noon"} {
+		if _, err := ecovacs.ParseTimeOfDay(value); err == nil {
+			t.Error("Expected error for", value)
+		}
+	}
+
+	// Weekdays
+	tests := []struct {
+		value, days string
+	}{
+		{"once", "once"},
+		{"", "once"},
+		{"weekdays", "mon,tue,wed,thu,fri"},
+		{"weekends", "sun,sat"},
+		{"Friday, mon,tues", "mon,tue,fri"},
+		{"daily", "sun,mon,tue,wed,thu,fri,sat"},
+	}
+	for _, test := range tests {
+		if days, err := ecovacs.ParseWeekdays(test.value); err != nil {
+			t.Error(err)
+		} else if value := ecovacs.FormatWeekdays(days); value != test.days {
+			t.Error("Unexpected days", value, "for", test.value)
+		}
+	}
+	for _, value := range []string{"mo", "monx", "someday"} {
+		if _, err := ecovacs.ParseWeekdays(value); err == nil {
+			t.Error("Expected error for", value)
+		}
+	}
+
+	// Schedules and do-not-disturb
+	query := `<query xmlns="com:ctl"><ctl ret="ok"><s n="weekday" o="1" h="9" m="30" r="0111110"><ctl td="Clean"><clean type="auto" speed="strong"/></ctl></s><s n="once" o="0" h="18" m="0" r="0000000"><ctl td="Clean"><clean type="border" speed="standard"/></ctl></s></ctl></query>`
+	if message, err := ecovacs.Parse(xmpp.IQ{ID: "1", Type: "set", Query: []byte(query)}); err != nil {
+		t.Error(err)
+	} else if message.Type() != mutablehome.ECOVACS_EVENT_SCHEDULE {
+		t.Error("Unexpected type", message.Type())
+	} else if schedules := message.Schedules(); len(schedules) != 2 {
+		t.Error("Unexpected schedules", schedules)
+	} else if s := schedules[0]; s.Name != "weekday" || s.Enabled == false || s.Time != 9*time.Hour+30*time.Minute || ecovacs.FormatWeekdays(s.Days) != "mon,tue,wed,thu,fri" || s.Mode != mutablehome.ECOVACS_CLEAN_AUTO || s.Suction != mutablehome.ECOVACS_SUCTION_STRONG {
+		t.Error("Unexpected schedule", s)
+	} else if s := schedules[1]; s.Enabled || len(s.Days) != 0 || s.Mode != mutablehome.ECOVACS_CLEAN_BORDER {
+		t.Error("Unexpected schedule", s)
+	}
+	query = `<query xmlns="com:ctl"><ctl ret="ok" o="1" s="22:00" e="07:30"/></query>`
+	if message, err := ecovacs.Parse(xmpp.IQ{ID: "2", Type: "set", Query: []byte(query)}); err != nil {
+		t.Error(err)
+	} else if message.SetRequest("GetBlockTime"); message.Type() != mutablehome.ECOVACS_EVENT_DND {
+		t.Error("Unexpected type", message.Type())
+	} else if dnd := message.Value(); dnd != (mutablehome.EcovacsDND{Enabled: true, Start: 22 * time.Hour, End: 7*time.Hour + 30*time.Minute}) {
+		t.Error("Unexpected do-not-disturb", dnd)
+	}
+}
+
+func Test_Ecovacs_009(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		events := make(chan mutablehome.EcovacsEvent, 100)
+		if err := app.Bus().NewHandler(gopi.EventHandler{
+			Name: "ecovacs.Event",
+			Handler: func(_ context.Context, _ gopi.App, evt gopi.Event) {
+				events <- evt.(mutablehome.EcovacsEvent)
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := account.Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		devices, err := account.Devices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		device := devices[0]
+		if err := account.Connect(device); err != nil {
+			t.Fatal(err)
+		}
+		defer account.Disconnect(device)
+
+		// No schedules to begin with
+		if _, err := device.GetSched(); err != nil {
+			t.Error(err)
+		} else if schedules := WaitForSchedules(events); schedules == nil || len(schedules) != 0 {
+			t.Error("Unexpected schedules", schedules)
+		}
+
+		// Add a schedule, which results in schedules being fetched
+		weekdays, _ := ecovacs.ParseWeekdays("weekdays")
+		schedule := mutablehome.EcovacsSchedule{
+			Name: "morning", Enabled: true, Time: 9 * time.Hour, Days: weekdays,
+			Mode: mutablehome.ECOVACS_CLEAN_AUTO,
+		}
+		if _, err := device.SetSched(schedule); err != nil {
+			t.Error(err)
+		} else if schedules := WaitForSchedules(events); len(schedules) != 1 {
+			t.Error("Unexpected schedules", schedules)
+		} else if s := schedules[0]; s.Name != "morning" || s.Time != 9*time.Hour || len(s.Days) != 5 || s.Suction != mutablehome.ECOVACS_SUCTION_STANDARD {
+			t.Error("Unexpected schedule", s)
+		}
+
+		// Edit the schedule and add another
+		schedule.Time = 10*time.Hour + 15*time.Minute
+		if _, err := device.SetSched(schedule); err != nil {
+			t.Error(err)
+		} else if schedules := WaitForSchedules(events); len(schedules) != 1 || schedules[0].Time != schedule.Time {
+			t.Error("Unexpected schedules", schedules)
+		}
+		if _, err := device.SetSched(mutablehome.EcovacsSchedule{Name: "evening", Time: 18 * time.Hour, Mode: mutablehome.ECOVACS_CLEAN_BORDER}); err != nil {
+			t.Error(err)
+		} else if schedules := WaitForSchedules(events); len(schedules) != 2 || schedules[1].Name != "evening" || schedules[1].Enabled {
+			t.Error("Unexpected schedules", schedules)
+		}
+
+		// Delete a schedule, and an unknown schedule results in an error
+		if _, err := device.DelSched("morning"); err != nil {
+			t.Error(err)
+		} else if schedules := WaitForSchedules(events); len(schedules) != 1 || schedules[0].Name != "evening" {
+			t.Error("Unexpected schedules", schedules)
+		}
+		if _, err := device.DelSched("morning"); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_ERROR); evt == nil {
+			t.Error("Expected error event")
+		}
+		if _, err := device.SetSched(mutablehome.EcovacsSchedule{Name: "bad"}); err == nil {
+			t.Error("Expected error for schedule without mode")
+		}
+
+		// Do-not-disturb
+		if _, err := device.GetBlockTime(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_DND); evt == nil {
+			t.Error("Expected do-not-disturb event")
+		} else if dnd := evt.Value().(mutablehome.EcovacsDND); dnd.Enabled || dnd.Start != 22*time.Hour || dnd.End != 8*time.Hour {
+			t.Error("Unexpected do-not-disturb", dnd)
+		}
+		dnd := mutablehome.EcovacsDND{Enabled: true, Start: 21*time.Hour + 30*time.Minute, End: 7 * time.Hour}
+		if _, err := device.SetBlockTime(dnd); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_DND); evt == nil {
+			t.Error("Expected do-not-disturb event")
+		} else if evt.Value() != dnd {
+			t.Error("Unexpected do-not-disturb", evt.Value())
+		}
+	})
+}
+
+func Test_Ecovacs_010(t *testing.T) {
+	// Error reports and responses
+	tests := []struct {
+		query     string
+		code      uint
+		name      string
+		severity  mutablehome.EcovacsSeverity
+		condition mutablehome.EcovacsCondition
+	}{
+		{`<query xmlns="com:ctl"><ctl td="error" errs="105"/></query>`, 105, "Stuck", mutablehome.ECOVACS_SEVERITY_CRITICAL, mutablehome.ECOVACS_CONDITION_STUCK},
+		{`<query xmlns="com:ctl"><ctl td="error" errs="102,103"/></query>`, 102, "HostHang", mutablehome.ECOVACS_SEVERITY_CRITICAL, mutablehome.ECOVACS_CONDITION_LIFTED},
+		{`<query xmlns="com:ctl"><ctl td="error" errno="114"/></query>`, 114, "DustCaseFilled", mutablehome.ECOVACS_SEVERITY_CRITICAL, mutablehome.ECOVACS_CONDITION_BINFULL},
+		{`<query xmlns="com:ctl"><ctl td="error" errs="103"/></query>`, 103, "WheelAbnormal", mutablehome.ECOVACS_SEVERITY_CRITICAL, mutablehome.ECOVACS_CONDITION_WHEELJAM},
+		{`<query xmlns="com:ctl"><ctl ret="fail" errno="101"/></query>`, 101, "BatteryLow", mutablehome.ECOVACS_SEVERITY_WARNING, mutablehome.ECOVACS_CONDITION_BATTERYLOW},
+		{`<query xmlns="com:ctl"><ctl td="error" errs="100"/></query>`, 100, "NoError", mutablehome.ECOVACS_SEVERITY_NONE, mutablehome.ECOVACS_CONDITION_NONE},
+		{`<query xmlns="com:ctl"><ctl ret="fail" errno="999" error="Unknown"/></query>`, 999, "Unknown", mutablehome.ECOVACS_SEVERITY_WARNING, mutablehome.ECOVACS_CONDITION_OTHER},
+	}
+	for _, test := range tests {
+		if message, err := ecovacs.Parse(xmpp.IQ{Type: "set", Query: []byte(test.query)}); err != nil {
+			t.Error(err)
+		} else if message.Type() != mutablehome.ECOVACS_EVENT_ERROR {
+			t.Error("Unexpected type", message.Type(), "for", test.query)
+		} else if value, ok := message.Value().(mutablehome.EcovacsError); ok == false {
+			t.Error("Unexpected value", message.Value())
+		} else if value.Code != test.code || value.Name != test.name {
+			t.Error("Unexpected error", value)
+		} else if value.Severity != test.severity || value.Condition != test.condition {
+			t.Error("Unexpected severity or condition", value)
+		} else if value.Description == "" {
+			t.Error("Expected description", value)
+		}
+	}
+
+	// Unknown codes without a name
+	if err := ecovacs.ErrorForCode(42, ""); err.Name != "Error042" || err.Condition != mutablehome.ECOVACS_CONDITION_OTHER {
+		t.Error("Unexpected error", err)
+	}
+}
+
+func Test_Ecovacs_011(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		events := make(chan mutablehome.EcovacsEvent, 100)
+		if err := app.Bus().NewHandler(gopi.EventHandler{
+			Name: "ecovacs.Event",
+			Handler: func(_ context.Context, _ gopi.App, evt gopi.Event) {
+				events <- evt.(mutablehome.EcovacsEvent)
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := account.Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		devices, err := account.Devices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		device := devices[0]
+		if err := account.Connect(device); err != nil {
+			t.Fatal(err)
+		}
+		defer account.Disconnect(device)
+
+		// Lifespan is above the threshold
+		if _, err := device.GetLifeSpan(mutablehome.ECOVACS_PART_BRUSH); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_LIFESPAN); evt == nil {
+			t.Error("Expected lifespan event")
+		}
+
+		// Error reported by the robot, and then cleared
+		if err := backend.SetError(SIM_ROBOT, 105); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_ERROR); evt == nil {
+			t.Error("Expected error event")
+		} else if value := evt.Value().(mutablehome.EcovacsError); value.Condition != mutablehome.ECOVACS_CONDITION_STUCK {
+			t.Error("Unexpected error", value)
+		}
+		if err := backend.SetError(SIM_ROBOT, 100); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_ERROR); evt == nil {
+			t.Error("Expected error event")
+		} else if value := evt.Value().(mutablehome.EcovacsError); value.Severity != mutablehome.ECOVACS_SEVERITY_NONE {
+			t.Error("Unexpected error", value)
+		}
+
+		// Lifespan falls below the threshold
+		if err := backend.SetLifeSpan(SIM_ROBOT, "Brush", 5); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_LOWLIFESPAN); evt == nil {
+			t.Error("Expected low lifespan event")
+		} else if value := evt.Value().([]interface{}); value[0] != mutablehome.ECOVACS_PART_BRUSH || value[1] != uint(5) {
+			t.Error("Unexpected lifespan", value)
+		}
+
+		// Reset the lifespan, which results in lifespans being fetched
+		if _, err := device.ResetLifeSpan(mutablehome.ECOVACS_PART_BRUSH); err != nil {
+			t.Error(err)
+		} else if evt := WaitForLifeSpan(events, mutablehome.ECOVACS_PART_BRUSH, 100); evt == nil {
+			t.Error("Expected lifespan event")
+		}
+		if _, err := device.ResetLifeSpan(""); err == nil {
+			t.Error("Expected error for empty part")
+		}
+
+		// Falling below the threshold again results in another alert,
+		// but not when the lifespan is already below the threshold
+		if err := backend.SetLifeSpan(SIM_ROBOT, "Brush", 8); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_LOWLIFESPAN); evt == nil {
+			t.Error("Expected low lifespan event")
+		}
+		if err := backend.SetLifeSpan(SIM_ROBOT, "Brush", 7); err != nil {
+			t.Error(err)
+		} else if evt := WaitForLifeSpan(events, mutablehome.ECOVACS_PART_BRUSH, 7); evt == nil {
+			t.Error("Expected lifespan event")
+		}
+		timeout := time.After(100 * time.Millisecond)
+	FOR_LOOP:
+		for {
+			select {
+			case evt := <-events:
+				if evt.Type() == mutablehome.ECOVACS_EVENT_LOWLIFESPAN {
+					t.Error("Unexpected low lifespan event", evt)
+				}
+			case <-timeout:
+				break FOR_LOOP
+			}
+		}
+	})
+}
+
+func Test_Ecovacs_012(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		events := make(chan mutablehome.EcovacsEvent, 100)
+		if err := app.Bus().NewHandler(gopi.EventHandler{
+			Name: "ecovacs.Event",
+			Handler: func(_ context.Context, _ gopi.App, evt gopi.Event) {
+				events <- evt.(mutablehome.EcovacsEvent)
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Robot which accepts JSON commands
+		if err := backend.AddRobotWithClass(SIM_JSON, "Ozmo", sim.DEFAULT_JSON_CLASS); err != nil {
+			t.Fatal(err)
+		} else if err := account.Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		devices, err := account.Devices()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var device mutablehome.EvovacsDevice
+		for _, d := range devices {
+			if d.Id() == SIM_JSON {
+				device = d
+			}
+		}
+		if device == nil {
+			t.Fatal("Device not found", SIM_JSON)
+		} else if err := account.Connect(device); err != nil {
+			t.Fatal(err)
+		}
+		defer account.Disconnect(device)
+
+		// Responses
+		if _, err := device.GetBatteryInfo(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_BATTERYLEVEL); evt == nil {
+			t.Error("Expected battery event")
+		} else if evt.Device().Id() != SIM_JSON || evt.Value() != uint(100) {
+			t.Error("Unexpected battery event", evt)
+		}
+		if _, err := device.GetChargeState(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_CHARGESTATE); evt == nil || evt.Value() != "slotcharging" {
+			t.Error("Unexpected charge state", evt)
+		}
+		if _, err := device.GetLifeSpan(mutablehome.ECOVACS_PART_SIDEBRUSH); err != nil {
+			t.Error(err)
+		} else if evt := WaitForLifeSpan(events, mutablehome.ECOVACS_PART_SIDEBRUSH, 80); evt == nil {
+			t.Error("Expected lifespan event")
+		}
+		if _, err := device.GetChargerPos(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_CHARGERPOSITION); evt == nil {
+			t.Error("Expected charger position event")
+		} else if pos := evt.Value().(mutablehome.EcovacsPosition); pos.Angle != 90 {
+			t.Error("Unexpected charger position", pos)
+		}
+		if _, err := device.GetVersion(); errors.Is(err, gopi.ErrNotImplemented) == false {
+			t.Error("Expected ErrNotImplemented, got", err)
+		}
+
+		// Commands, which result in reports
+		if _, err := device.Clean(mutablehome.ECOVACS_CLEAN_ROOM, mutablehome.ECOVACS_SUCTION_STRONG); err != nil {
+			t.Error(err)
+		} else if evt := WaitForCleanState(events, mutablehome.ECOVACS_CLEAN_ROOM, mutablehome.ECOVACS_SUCTION_STRONG); evt == nil {
+			t.Error("Expected clean state event")
+		}
+		if _, err := device.Charge(); err != nil {
+			t.Error(err)
+		} else if evt := WaitForValue(events, mutablehome.ECOVACS_EVENT_CHARGESTATE, "going"); evt == nil {
+			t.Error("Expected charge state event")
+		}
+
+		// Reports
+		if err := backend.SetBatteryLevel(SIM_JSON, 50); err != nil {
+			t.Error(err)
+		} else if evt := WaitForValue(events, mutablehome.ECOVACS_EVENT_BATTERYLEVEL, uint(50)); evt == nil {
+			t.Error("Expected battery event")
+		}
+		if err := backend.SetPosition(SIM_JSON, 100, -200, 45); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_POSITION); evt == nil {
+			t.Error("Expected position event")
+		} else if pos := evt.Value().(mutablehome.EcovacsPosition); pos.X != 100 || pos.Y != -200 || pos.Angle != 45 {
+			t.Error("Unexpected position", pos)
+		}
+		if err := backend.SetError(SIM_JSON, 105); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_ERROR); evt == nil {
+			t.Error("Expected error event")
+		} else if value := evt.Value().(mutablehome.EcovacsError); value.Condition != mutablehome.ECOVACS_CONDITION_STUCK {
+			t.Error("Unexpected error", value)
+		}
+
+		// Schedules, do-not-disturb and lifespans are fetched after changes
+		if _, err := device.SetSched(mutablehome.EcovacsSchedule{Name: "evening", Enabled: true, Time: 18 * time.Hour, Mode: mutablehome.ECOVACS_CLEAN_AUTO}); err != nil {
+			t.Error(err)
+		} else if schedules := WaitForSchedules(events); len(schedules) != 1 || schedules[0].Name != "evening" || schedules[0].Time != 18*time.Hour {
+			t.Error("Unexpected schedules", schedules)
+		}
+		dnd := mutablehome.EcovacsDND{Enabled: true, Start: 21 * time.Hour, End: 7 * time.Hour}
+		if _, err := device.SetBlockTime(dnd); err != nil {
+			t.Error(err)
+		} else if evt := WaitForValue(events, mutablehome.ECOVACS_EVENT_DND, dnd); evt == nil {
+			t.Error("Expected do-not-disturb event")
+		}
+		if _, err := device.ResetLifeSpan(mutablehome.ECOVACS_PART_SIDEBRUSH); err != nil {
+			t.Error(err)
+		} else if evt := WaitForLifeSpan(events, mutablehome.ECOVACS_PART_SIDEBRUSH, 100); evt == nil {
+			t.Error("Expected lifespan event")
+		}
+
+		// Failed command results in an error event
+		if _, err := device.DelSched("morning"); err != nil {
+			t.Error(err)
+		} else if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_ERROR); evt == nil {
+			t.Error("Expected error event")
+		}
+
+		// Map is assembled from pieces
+		if _, err := device.GetMapM(); err != nil {
+			t.Error(err)
+		} else if m := WaitForMap(device, 400, 400, mutablehome.ECOVACS_MAP_FLOOR); m == nil {
+			t.Error("Expected complete map")
+		}
+
+		// Commands were sent as JSON
+		requests := strings.Join(backend.Requests(SIM_JSON), ",")
+		for _, name := range []string{"getBattery", "setSpeed", "clean", "setSched", "getSched", "getMinorMap"} {
+			if strings.Contains(requests, name) == false {
+				t.Error("Expected request", name, "in", requests)
+			}
+		}
+	})
+}
+
+func Test_Ecovacs_013(t *testing.T) {
+	// MQTT packets
+	var buf bytes.Buffer
+	body := ecovacs.AppendMQTTString(nil, "iot/atr/onBattery/E0001/yna5xi/atom/j")
+	body = append(body, bytes.Repeat([]byte("x"), 200)...)
+	if err := (&ecovacs.MQTTPacket{Type: ecovacs.MQTT_PUBLISH, Flags: 2, Body: body}).Write(&buf); err != nil {
+		t.Fatal(err)
+	} else if buf.Bytes()[0] != 0x32 || buf.Bytes()[1] != 0xEF || buf.Bytes()[2] != 0x01 {
+		t.Errorf("Unexpected header % X", buf.Bytes()[0:3])
+	}
+	if packet, err := ecovacs.ReadMQTTPacket(bufio.NewReader(&buf)); err != nil {
+		t.Error(err)
+	} else if packet.Type != ecovacs.MQTT_PUBLISH || packet.Flags != 2 || bytes.Equal(packet.Body, body) == false {
+		t.Error("Unexpected packet", packet)
+	} else if topic, rest, err := ecovacs.ReadMQTTString(packet.Body); err != nil {
+		t.Error(err)
+	} else if topic != "iot/atr/onBattery/E0001/yna5xi/atom/j" || len(rest) != 200 {
+		t.Error("Unexpected topic", topic)
+	}
+	if _, _, err := ecovacs.ReadMQTTString([]byte{0, 5, 'a'}); err == nil {
+		t.Error("Expected error for short string")
+	}
+
+	// Device classes
+	if ecovacs.IsJSONClass("yna5xi") == false || ecovacs.IsJSONClass(sim.DEFAULT_CLASS) {
+		t.Error("Unexpected IsJSONClass")
+	}
+}
+
+func Test_Ecovacs_014(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		// Move one robot to another account
+		if err := backend.AddAccount("other@mutablehome", "secret"); err != nil {
+			t.Fatal(err)
+		} else if err := backend.SetOwner(SIM_OTHER, "other@mutablehome"); err != nil {
+			t.Fatal(err)
+		}
+		if err := account.Authenticate(); err != nil {
+			t.Fatal(err)
+		} else if devices, err := account.Devices(); err != nil {
+			t.Error(err)
+		} else if len(devices) != 1 || devices[0].Id() != SIM_ROBOT {
+			t.Error("Unexpected devices", devices)
+		}
+
+		// Devices for both accounts are visible
+		config := Config(app, backend)
+		config.Accounts = []ecovacs.EcovacsAccount{
+			{AccountId: "other@mutablehome", PasswordHash: ecovacs.MD5String("secret")},
+		}
+		unit, err := gopi.New(config, app.Log().Clone(ecovacs.Ecovacs{}.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		both := unit.(mutablehome.Ecovacs)
+		if err := both.Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		devices, err := both.Devices()
+		if err != nil {
+			t.Fatal(err)
+		} else if len(devices) != 2 || devices[0].Id() != SIM_ROBOT || devices[1].Id() != SIM_OTHER {
+			t.Fatal("Unexpected devices", devices)
+		}
+		for _, device := range devices {
+			if err := both.Connect(device); err != nil {
+				t.Error(device.Id(), err)
+			} else if err := both.Disconnect(device); err != nil {
+				t.Error(device.Id(), err)
+			}
+		}
+
+		// Incorrect password for the other account
+		config.Accounts[0].PasswordHash = ecovacs.MD5String("incorrect")
+		if unit, err := gopi.New(config, app.Log().Clone(ecovacs.Ecovacs{}.Name())); err != nil {
+			t.Error(err)
+		} else {
+			if err := unit.(mutablehome.Ecovacs).Authenticate(); err != mutablehome.ErrAuthenticationError {
+				t.Error("Expected authentication error, got", err)
+			}
+			unit.Close()
+		}
+
+		// Duplicate account
+		config.Accounts[0].AccountId = config.AccountId
+		if _, err := gopi.New(config, app.Log().Clone(ecovacs.Ecovacs{}.Name())); errors.Is(err, gopi.ErrDuplicateItem) == false {
+			t.Error("Expected duplicate account error, got", err)
+		}
+	})
+}
+
+func Test_Ecovacs_015(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, _ mutablehome.Ecovacs) {
+		path, err := ioutil.TempDir("", "ecovacs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(path)
+		config := Config(app, backend)
+		config.Path = path
+
+		// Authenticate with the credentials file and return the number
+		// of logins with account and password
+		authenticate := func() uint {
+			t.Helper()
+			if unit, err := gopi.New(config, app.Log().Clone(ecovacs.Ecovacs{}.Name())); err != nil {
+				t.Fatal(err)
+			} else {
+				defer unit.Close()
+				if err := unit.(mutablehome.Ecovacs).Authenticate(); err != nil {
+					t.Error(err)
+				} else if devices, err := unit.(mutablehome.Ecovacs).Devices(); err != nil {
+					t.Error(err)
+				} else if len(devices) != 2 {
+					t.Error("Unexpected devices", devices)
+				}
+			}
+			return backend.Logins()
+		}
+
+		// Token is stored and re-used after restart
+		if logins := authenticate(); logins != 1 {
+			t.Error("Unexpected logins", logins)
+		} else if token := ReadToken(path, config.AccountId); token == "" {
+			t.Error("Expected stored token")
+		} else if logins := authenticate(); logins != 1 {
+			t.Error("Unexpected logins", logins)
+		} else if ReadToken(path, config.AccountId) != token {
+			t.Error("Unexpected change to stored token")
+		}
+
+		// Revoked token results in login
+		backend.ExpireTokens()
+		if logins := authenticate(); logins != 2 {
+			t.Error("Unexpected logins", logins)
+		}
+
+		// Token is refreshed before it expires
+		config.TokenLifetime = time.Second
+		os.Remove(filepath.Join(path, ecovacs.FILENAME_CREDENTIALS))
+		unit, err := gopi.New(config, app.Log().Clone(ecovacs.Ecovacs{}.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		if err := unit.(mutablehome.Ecovacs).Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		token := ReadToken(path, config.AccountId)
+		time.Sleep(2 * time.Second)
+		if logins := backend.Logins(); logins < 4 {
+			t.Error("Unexpected logins", logins)
+		} else if refreshed := ReadToken(path, config.AccountId); refreshed == "" || refreshed == token {
+			t.Error("Expected refreshed token")
+		} else if devices, err := unit.(mutablehome.Ecovacs).Devices(); err != nil {
+			t.Error(err)
+		} else if err := unit.(mutablehome.Ecovacs).Connect(devices[0]); err != nil {
+			t.Error(err)
+		} else if err := unit.(mutablehome.Ecovacs).Disconnect(devices[0]); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func Test_Ecovacs_016(t *testing.T) {
+	RunWithBackend(t, func(app gopi.App, t *testing.T, backend *sim.Backend, account mutablehome.Ecovacs) {
+		source, ok := account.(mutablehome.MetricsSource)
+		if ok == false {
+			t.Fatal("Expected metrics source")
+		} else if err := account.Authenticate(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Scrape metrics while devices are listed
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				source.Metrics()
+			}
+		}()
+		if _, err := account.Devices(); err != nil {
+			t.Error(err)
+		}
+		<-done
+
+		// Errors are counted for each transport
+		transports := map[string]bool{}
+		for _, metric := range source.Metrics() {
+			if metric.Name == "mutablehome_ecovacs_errors_total" {
+				transports[metric.Labels["transport"]] = true
+			}
+		}
+		if len(transports) != 2 || transports["xmpp"] == false || transports["mqtt"] == false {
+			t.Error("Unexpected error counters", transports)
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// A 100x100 map piece with a wall, floor and carpet, compressed by
+	// the LZMA reference encoder
+	MAP_PIECE       = "XQAAgAAQJwAAAABv/f//o7dpke2r+0LGRej57ervqUcgdkbBZuR3WNh8gDwLt/zw3VyN6snegLKrTnxfX4yDazJXGyslJUoMS98lWEKL//+GyKgA"
+	MAP_PIECE_CRC   = 3152320308
+	MAP_PIECE_EMPTY = 1295764014
+)
+
+const (
+	SIM_ROBOT = "E0000000000000001234"
+	SIM_OTHER = "E0000000000000005678"
+	SIM_JSON  = "E0000000000000009012"
+	TIMEOUT   = 5 * time.Second
+)
+
+// RunWithBackend runs a test tool with a backend which has two robots, and
+// an ecovacs unit which uses the backend endpoints
+func RunWithBackend(t *testing.T, main func(gopi.App, *testing.T, *sim.Backend, mutablehome.Ecovacs)) {
+	t.Helper()
+	backend, err := sim.New("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	if err := backend.AddRobot(SIM_ROBOT, "Deebot"); err != nil {
+		t.Fatal(err)
+	} else if err := backend.AddRobot(SIM_OTHER, "Other"); err != nil {
+		t.Fatal(err)
+	}
+
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(Config(app, backend), app.Log().Clone(ecovacs.Ecovacs{}.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(app, t, backend, unit.(mutablehome.Ecovacs))
+	}, nil, "bus"); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+// Config returns the configuration for an account on the backend
+func Config(app gopi.App, backend *sim.Backend) ecovacs.Ecovacs {
+	return ecovacs.Ecovacs{
+		Country:           sim.DEFAULT_COUNTRY,
+		AccountId:         "test@mutablehome",
+		PasswordHash:      ecovacs.MD5String("password"),
+		MainURL:           backend.MainURL(),
+		UserURL:           backend.UserURL(),
+		XMPPHost:          backend.XMPPHost(),
+		PortalURL:         backend.PortalURL(),
+		MQTTHost:          backend.MQTTHost(),
+		TLSConfig:         backend.TLSConfig(),
+		PublicKey:         backend.PublicKey(),
+		LifeSpanThreshold: 0.1,
+		Bus:               app.Bus(),
+	}
+}
+
+// ReadToken returns the token stored for an account in the credentials
+// file, or an empty string
+func ReadToken(path, accountId string) string {
+	var credentials struct {
+		Accounts []struct {
+			AccountId string `json:"account"`
+			Token     string `json:"token"`
+		} `json:"accounts"`
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(path, ecovacs.FILENAME_CREDENTIALS)); err != nil {
+		return ""
+	} else if err := json.Unmarshal(data, &credentials); err != nil {
+		return ""
+	}
+	for _, account := range credentials.Accounts {
+		if account.AccountId == accountId {
+			return account.Token
+		}
+	}
+	return ""
+}
+
+// WaitForEvent returns the next event of a type, or nil on timeout
+func WaitForEvent(events <-chan mutablehome.EcovacsEvent, typ mutablehome.EcovacsEventType) mutablehome.EcovacsEvent {
+	timeout := time.After(TIMEOUT)
+	for {
+		select {
+		case evt := <-events:
+			if evt.Type() == typ {
+				return evt
+			}
+		case <-timeout:
+			return nil
+		}
+	}
+}
+
+// WaitForSchedules returns the schedules from the next schedule event,
+// or nil on timeout
+func WaitForSchedules(events <-chan mutablehome.EcovacsEvent) []mutablehome.EcovacsSchedule {
+	if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_SCHEDULE); evt == nil {
+		return nil
+	} else {
+		return evt.Value().([]mutablehome.EcovacsSchedule)
+	}
+}
+
+// WaitForLifeSpan returns the next lifespan event for a part with a
+// value, or nil on timeout. Events are emitted concurrently, so events
+// with other values are skipped
+func WaitForLifeSpan(events <-chan mutablehome.EcovacsEvent, part mutablehome.EcovacsPart, val uint) mutablehome.EcovacsEvent {
+	for {
+		if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_LIFESPAN); evt == nil {
+			return nil
+		} else if value := evt.Value().([]interface{}); value[0] == part && value[1] == val {
+			return evt
+		}
+	}
+}
+
+// WaitForValue returns the next event of a type with a value, or nil
+// on timeout
+func WaitForValue(events <-chan mutablehome.EcovacsEvent, typ mutablehome.EcovacsEventType, value interface{}) mutablehome.EcovacsEvent {
+	for {
+		if evt := WaitForEvent(events, typ); evt == nil {
+			return nil
+		} else if evt.Value() == value {
+			return evt
+		}
+	}
+}
+
+// WaitForCleanState returns the next clean state event with a mode and
+// suction, or nil on timeout
+func WaitForCleanState(events <-chan mutablehome.EcovacsEvent, mode mutablehome.EcovacsCleanMode, suction mutablehome.EcovacsCleanSuction) mutablehome.EcovacsEvent {
+	for {
+		if evt := WaitForEvent(events, mutablehome.ECOVACS_EVENT_CLEANSTATE); evt == nil {
+			return nil
+		} else if value := evt.Value().([]interface{}); value[0] == mode && value[1] == suction {
+			return evt
+		}
+	}
+}
+
+// WaitForMap returns the map for a device once it is complete and the
+// cell at x,y has a value, or nil on timeout
+func WaitForMap(device mutablehome.EvovacsDevice, x, y uint, cell mutablehome.EcovacsMapCell) mutablehome.EcovacsMap {
+	timeout := time.Now().Add(TIMEOUT)
+	for time.Now().Before(timeout) {
+		if m := device.Map(); m != nil && m.Complete() && m.Cell(x, y) == cell {
+			return m
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// MapPiece returns the uncompressed cells for MAP_PIECE
+func MapPiece() []byte {
+	cells := make([]byte, 100*100)
+	for y := 10; y < 90; y++ {
+		for x := 10; x < 90; x++ {
+			switch {
+			case x == 10 || y == 10 || x == 89 || y == 89:
+				cells[y*100+x] = byte(mutablehome.ECOVACS_MAP_WALL)
+			case x >= 30 && x < 50 && y >= 40 && y < 60:
+				cells[y*100+x] = byte(mutablehome.ECOVACS_MAP_CARPET)
+			default:
+				cells[y*100+x] = byte(mutablehome.ECOVACS_MAP_FLOOR)
+			}
+		}
+	}
+	return cells
+}
@@ -0,0 +1,87 @@
+package ecovacs
+
+import (
+	"fmt"
+
+	// Frameworks
+	home "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type errorCode struct {
+	name, description string
+	severity          home.EcovacsSeverity
+	condition         home.EcovacsCondition
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// errorCodes is the catalogue of error codes reported by devices, or
+// returned in response to commands
+var errorCodes = map[uint]errorCode{
+	0:   {"NoError", "Robot is operational", home.ECOVACS_SEVERITY_NONE, home.ECOVACS_CONDITION_NONE},
+	100: {"NoError", "Robot is operational", home.ECOVACS_SEVERITY_NONE, home.ECOVACS_CONDITION_NONE},
+	101: {"BatteryLow", "Battery is low", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_BATTERYLOW},
+	102: {"HostHang", "Robot is off the floor", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_LIFTED},
+	103: {"WheelAbnormal", "Driving wheel is jammed", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_WHEELJAM},
+	104: {"DownSensorAbnormal", "Anti-drop sensors are dirty", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_SENSOR},
+	105: {"Stuck", "Robot is stuck", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_STUCK},
+	106: {"SideBrushExhausted", "Side brushes have expired", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_CONSUMABLE},
+	107: {"DustCaseHeapExhausted", "Dust bin filter has expired", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_CONSUMABLE},
+	108: {"SideAbnormal", "Side brushes are tangled", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_BRUSHJAM},
+	109: {"RollAbnormal", "Main brush is tangled", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_BRUSHJAM},
+	110: {"NoDustBox", "Dust bin is not installed", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_NOBIN},
+	111: {"BumpAbnormal", "Bump sensor is stuck", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_SENSOR},
+	112: {"LDS", "Laser distance sensor has failed", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_SENSOR},
+	113: {"MainBrushExhausted", "Main brush has expired", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_CONSUMABLE},
+	114: {"DustCaseFilled", "Dust bin is full", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_BINFULL},
+	115: {"BatteryError", "Battery has failed", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_HARDWARE},
+	116: {"ForwardLookingError", "Forward-looking sensor has failed", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_SENSOR},
+	117: {"GyroscopeError", "Gyroscope has failed", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_SENSOR},
+	118: {"StrainerBlock", "Strainer is blocked", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_HARDWARE},
+	119: {"FanError", "Suction fan has failed", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_HARDWARE},
+	120: {"WaterBoxError", "Water tank has failed", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_HARDWARE},
+	201: {"AirFilterUninstall", "Air filter is not installed", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_HARDWARE},
+	202: {"UltrasonicComponentAbnormal", "Ultrasonic sensor has failed", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_SENSOR},
+	203: {"SmallWheelError", "Front wheel is jammed", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_WHEELJAM},
+	204: {"WheelHang", "Driving wheel is off the floor", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_LIFTED},
+	205: {"IonSterilizeExhausted", "Sterilizer has expired", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_CONSUMABLE},
+	206: {"IonSterilizeAbnormal", "Sterilizer is abnormal", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_HARDWARE},
+	207: {"IonSterilizeFault", "Sterilizer has failed", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_HARDWARE},
+	312: {"PleaseChargeMe", "Battery is empty", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_BATTERYLOW},
+	404: {"RecipientUnavailable", "Robot is not connected", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_REQUEST},
+	500: {"RequestTimeout", "Robot did not respond", home.ECOVACS_SEVERITY_WARNING, home.ECOVACS_CONDITION_REQUEST},
+	601: {"ClosedAIVISideAbnormal", "Side brushes are tangled", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_BRUSHJAM},
+	602: {"ClosedAIVIRollAbnormal", "Main brush is tangled", home.ECOVACS_SEVERITY_CRITICAL, home.ECOVACS_CONDITION_BRUSHJAM},
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// ErrorForCode returns the catalogue entry for an error code. Codes
+// which are not in the catalogue are returned with the name, or a name
+// derived from the code when name is empty
+func ErrorForCode(code uint, name string) home.EcovacsError {
+	if err, exists := errorCodes[code]; exists {
+		return home.EcovacsError{
+			Code:        code,
+			Name:        err.name,
+			Description: err.description,
+			Severity:    err.severity,
+			Condition:   err.condition,
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("Error%03d", code)
+	}
+	return home.EcovacsError{
+		Code:        code,
+		Name:        name,
+		Description: name,
+		Severity:    home.ECOVACS_SEVERITY_WARNING,
+		Condition:   home.ECOVACS_CONDITION_OTHER,
+	}
+}
@@ -12,9 +12,10 @@ import (
 // TYPES
 
 type EcovacsEvent struct {
-	source  home.Ecovacs
-	device  home.EvovacsDevice
-	message *XMPPMessage
+	source    home.Ecovacs
+	device    home.EvovacsDevice
+	message   *XMPPMessage
+	eventType home.EcovacsEventType
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -28,6 +29,17 @@ func NewEvent(source home.Ecovacs, device home.EvovacsDevice, message *XMPPMessa
 	}
 }
 
+// NewEventWithType returns an event with a different type from the
+// message, but with the same value
+func NewEventWithType(source home.Ecovacs, device home.EvovacsDevice, message *XMPPMessage, eventType home.EcovacsEventType) *EcovacsEvent {
+	return &EcovacsEvent{
+		source:    source,
+		device:    device,
+		message:   message,
+		eventType: eventType,
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // IMPLEMENTATION gopi.Event
 
@@ -51,7 +63,11 @@ func (this *EcovacsEvent) Value() interface{} {
 // IMPLEMENTATION mutablehome.EcovacsEvent
 
 func (this *EcovacsEvent) Type() home.EcovacsEventType {
-	return this.message.Type()
+	if this.eventType != home.ECOVACS_EVENT_NONE {
+		return this.eventType
+	} else {
+		return this.message.Type()
+	}
 }
 
 func (this *EcovacsEvent) Device() home.EvovacsDevice {
@@ -0,0 +1,141 @@
+package ecovacs
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	home "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// Cells around the explored area which are included in an image
+	MAP_IMAGE_MARGIN = 4
+)
+
+var (
+	MAP_COLOR_NONE    = color.RGBA{0x00, 0x00, 0x00, 0x00}
+	MAP_COLOR_FLOOR   = color.RGBA{0xBA, 0xDA, 0xFF, 0xFF}
+	MAP_COLOR_WALL    = color.RGBA{0x4E, 0x96, 0xE2, 0xFF}
+	MAP_COLOR_CARPET  = color.RGBA{0xD9, 0xC8, 0xA0, 0xFF}
+	MAP_COLOR_ROBOT   = color.RGBA{0xE0, 0x30, 0x30, 0xFF}
+	MAP_COLOR_CHARGER = color.RGBA{0x30, 0xB0, 0x30, 0xFF}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// RENDER
+
+// NewMapImage renders the explored area of a map, with each cell drawn
+// as scale x scale pixels. The robot and charger positions are drawn
+// when not nil
+func NewMapImage(m home.EcovacsMap, scale uint, robot, charger *home.EcovacsPosition) (*image.RGBA, error) {
+	if m == nil {
+		return nil, gopi.ErrBadParameter.WithPrefix("map")
+	} else if scale == 0 {
+		return nil, gopi.ErrBadParameter.WithPrefix("scale")
+	}
+
+	// Determine the explored area
+	bounds := mapBounds(m)
+	for _, position := range []*home.EcovacsPosition{robot, charger} {
+		if position != nil {
+			x, y := m.Point(*position)
+			bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	bounds = bounds.Inset(-MAP_IMAGE_MARGIN)
+
+	// Draw cells
+	s := int(scale)
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx()*s, bounds.Dy()*s))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := MAP_COLOR_NONE
+			if x >= 0 && y >= 0 {
+				c = mapColor(m.Cell(uint(x), uint(y)))
+			}
+			fill(img, scaleRect(image.Rect(x-bounds.Min.X, y-bounds.Min.Y, x-bounds.Min.X+1, y-bounds.Min.Y+1), s), c)
+		}
+	}
+
+	// Draw charger and then robot as a marker three cells wide
+	for _, marker := range []struct {
+		position *home.EcovacsPosition
+		color    color.RGBA
+	}{
+		{charger, MAP_COLOR_CHARGER},
+		{robot, MAP_COLOR_ROBOT},
+	} {
+		if marker.position != nil {
+			x, y := m.Point(*marker.position)
+			x, y = x-bounds.Min.X, y-bounds.Min.Y
+			fill(img, scaleRect(image.Rect(x-1, y-1, x+2, y+2), s), marker.color)
+		}
+	}
+
+	// Return success
+	return img, nil
+}
+
+// WriteMapPNG renders a map as PNG
+func WriteMapPNG(w io.Writer, m home.EcovacsMap, scale uint, robot, charger *home.EcovacsPosition) error {
+	if img, err := NewMapImage(m, scale, robot, charger); err != nil {
+		return err
+	} else {
+		return png.Encode(w, img)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// mapBounds returns the rectangle which contains all explored cells, or
+// the whole map if no cells have been explored
+func mapBounds(m home.EcovacsMap) image.Rectangle {
+	w, h := m.Size()
+	bounds := image.Rectangle{}
+	for y := uint(0); y < h; y++ {
+		for x := uint(0); x < w; x++ {
+			if m.Cell(x, y) != home.ECOVACS_MAP_NONE {
+				bounds = bounds.Union(image.Rect(int(x), int(y), int(x)+1, int(y)+1))
+			}
+		}
+	}
+	if bounds.Empty() {
+		return image.Rect(0, 0, int(w), int(h))
+	} else {
+		return bounds
+	}
+}
+
+func mapColor(cell home.EcovacsMapCell) color.RGBA {
+	switch cell {
+	case home.ECOVACS_MAP_FLOOR:
+		return MAP_COLOR_FLOOR
+	case home.ECOVACS_MAP_WALL:
+		return MAP_COLOR_WALL
+	case home.ECOVACS_MAP_CARPET:
+		return MAP_COLOR_CARPET
+	default:
+		return MAP_COLOR_NONE
+	}
+}
+
+func scaleRect(r image.Rectangle, s int) image.Rectangle {
+	return image.Rect(r.Min.X*s, r.Min.Y*s, r.Max.X*s, r.Max.Y*s)
+}
+
+func fill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
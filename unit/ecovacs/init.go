@@ -1,27 +1,108 @@
 package ecovacs
 
 import (
+	"crypto/tls"
+	"strings"
+
 	// Frameworks
 	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+	node "github.com/djthorpe/mutablehome/unit/ecovacs/node"
 )
 
+////////////////////////////////////////////////////////////////////////////////
+
+type Node interface {
+	mutablehome.Node
+
+	// Connect to account and devices
+	Connect() error
+
+	// Disconnect from devices
+	Disconnect() error
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
 func init() {
 	gopi.UnitRegister(gopi.UnitConfig{
 		Name:     Ecovacs{}.Name(),
 		Requires: []string{"bus"},
 		Config: func(app gopi.App) error {
 			app.Flags().FlagString("ecovacs.country", "au", "Ecovacs Country Code")
-			app.Flags().FlagString("ecovacs.email", "", "Ecovacs Account Email")
-			app.Flags().FlagString("ecovacs.password", "", "Ecovacs Account Password")
+			app.Flags().FlagString("ecovacs.email", "", "Ecovacs Account Email (comma-separated for several accounts)")
+			app.Flags().FlagString("ecovacs.password", "", "Ecovacs Account Password (comma-separated for several accounts)")
+			app.Flags().FlagString("ecovacs.state", ".ecovacs", "Credentials storage path")
+			app.Flags().FlagString("ecovacs.main", "", "Ecovacs API URL format")
+			app.Flags().FlagString("ecovacs.user", "", "Ecovacs user URL format")
+			app.Flags().FlagString("ecovacs.xmpp", "", "Ecovacs XMPP server address (host:port)")
+			app.Flags().FlagString("ecovacs.portal", "", "Ecovacs portal URL format for JSON devices")
+			app.Flags().FlagString("ecovacs.mqtt", "", "Ecovacs MQTT broker address for JSON devices (host:port)")
+			app.Flags().FlagBool("ecovacs.insecure", false, "Skip verification of Ecovacs server certificates")
+			app.Flags().FlagUint("ecovacs.lifespan", DEFAULT_LIFESPAN_THRESHOLD, "Consumable lifespan percentage which raises an alert, or zero to disable")
 			return nil
 		},
 		New: func(app gopi.App) (gopi.Unit, error) {
+			var config *tls.Config
+			if app.Flags().GetBool("ecovacs.insecure", gopi.FLAG_NS_DEFAULT) {
+				config = &tls.Config{InsecureSkipVerify: true}
+			}
+			accounts, err := accountsForFlags(app.Flags().GetString("ecovacs.email", gopi.FLAG_NS_DEFAULT), app.Flags().GetString("ecovacs.password", gopi.FLAG_NS_DEFAULT))
+			if err != nil {
+				return nil, err
+			}
 			return gopi.New(Ecovacs{
-				Country:      app.Flags().GetString("ecovacs.country", gopi.FLAG_NS_DEFAULT),
-				AccountId:    app.Flags().GetString("ecovacs.email", gopi.FLAG_NS_DEFAULT),
-				PasswordHash: MD5String(app.Flags().GetString("ecovacs.password", gopi.FLAG_NS_DEFAULT)),
-				Bus:          app.Bus(),
+				Country:           app.Flags().GetString("ecovacs.country", gopi.FLAG_NS_DEFAULT),
+				Accounts:          accounts,
+				Path:              app.Flags().GetString("ecovacs.state", gopi.FLAG_NS_DEFAULT),
+				MainURL:           app.Flags().GetString("ecovacs.main", gopi.FLAG_NS_DEFAULT),
+				UserURL:           app.Flags().GetString("ecovacs.user", gopi.FLAG_NS_DEFAULT),
+				XMPPHost:          app.Flags().GetString("ecovacs.xmpp", gopi.FLAG_NS_DEFAULT),
+				PortalURL:         app.Flags().GetString("ecovacs.portal", gopi.FLAG_NS_DEFAULT),
+				MQTTHost:          app.Flags().GetString("ecovacs.mqtt", gopi.FLAG_NS_DEFAULT),
+				TLSConfig:         config,
+				LifeSpanThreshold: float64(app.Flags().GetUint("ecovacs.lifespan", gopi.FLAG_NS_DEFAULT)) / 100.0,
+				Bus:               app.Bus(),
 			}, app.Log().Clone(Ecovacs{}.Name()))
 		},
 	})
+
+	// Node Connector
+	gopi.UnitRegister(gopi.UnitConfig{
+		Name:     node.Node{}.Name(),
+		Requires: []string{"bus", Ecovacs{}.Name()},
+		Config: func(app gopi.App) error {
+			app.Flags().FlagString("ecovacs.node", node.DEFAULT_ID, "Ecovacs node identifier")
+			return nil
+		},
+		New: func(app gopi.App) (gopi.Unit, error) {
+			return gopi.New(node.Node{
+				Id:      app.Flags().GetString("ecovacs.node", gopi.FLAG_NS_DEFAULT),
+				Ecovacs: app.UnitInstance(Ecovacs{}.Name()).(mutablehome.Ecovacs),
+				Bus:     app.Bus(),
+			}, app.Log().Clone(node.Node{}.Name()))
+		},
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// accountsForFlags returns an account for each comma-separated email and
+// password, which need to be given in the same order
+func accountsForFlags(emails, passwords string) ([]EcovacsAccount, error) {
+	if strings.TrimSpace(emails) == "" {
+		return nil, nil
+	}
+	accountIds, passwordList := strings.Split(emails, ","), strings.Split(passwords, ",")
+	if len(accountIds) != len(passwordList) {
+		return nil, gopi.ErrBadParameter.WithPrefix("ecovacs.password")
+	}
+	accounts := make([]EcovacsAccount, len(accountIds))
+	for i := range accountIds {
+		accounts[i] = EcovacsAccount{
+			AccountId:    strings.TrimSpace(accountIds[i]),
+			PasswordHash: MD5String(passwordList[i]),
+		}
+	}
+	return accounts, nil
 }
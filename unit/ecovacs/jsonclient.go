@@ -0,0 +1,681 @@
+package ecovacs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	home "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// JSONClient sends JSON commands to a device through the portal and
+// receives reports from the MQTT broker, for devices which don't
+// speak XMPP
+type JSONClient struct {
+	DeviceId string
+	Class    string
+	Resource string
+
+	opts   JSONOptions
+	conn   net.Conn
+	cancel context.CancelFunc
+	ctx    context.Context
+	stop   chan struct{}
+	recv   chan jsonResult
+
+	// Values cached from previous messages, since clean state and speed
+	// are separate commands and map pieces require the map identifier
+	state jsonState
+
+	RequestId
+	sync.Mutex
+	sync.WaitGroup
+}
+
+// JSONOptions are the endpoints and credentials used to connect
+type JSONOptions struct {
+	PortalURL string
+	MQTTHost  string
+	UserId    string
+	Resource  string
+	Token     string
+	Client    *http.Client
+	TLSConfig *tls.Config
+}
+
+// JSONRequest is the body of a command sent through the portal
+type JSONRequest struct {
+	CmdName     string            `json:"cmdName"`
+	Payload     JSONPayload       `json:"payload"`
+	PayloadType string            `json:"payloadType"`
+	Td          string            `json:"td"`
+	ToId        string            `json:"toId"`
+	ToRes       string            `json:"toRes"`
+	ToType      string            `json:"toType"`
+	Auth        map[string]string `json:"auth"`
+}
+
+// JSONPayload is the payload of a command, response or report
+type JSONPayload struct {
+	Header map[string]interface{} `json:"header"`
+	Body   struct {
+		Code uint            `json:"code"`
+		Msg  string          `json:"msg,omitempty"`
+		Data json.RawMessage `json:"data,omitempty"`
+	} `json:"body"`
+}
+
+// JSONResponse is returned by the portal
+type JSONResponse struct {
+	Ret   string      `json:"ret"`
+	ErrNo uint        `json:"errno,omitempty"`
+	Error string      `json:"error,omitempty"`
+	Resp  JSONPayload `json:"resp"`
+}
+
+type jsonCommand struct {
+	name string
+	data interface{}
+}
+
+type jsonResult struct {
+	message *XMPPMessage
+	err     error
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	PORTAL_URL_FORMAT = "https://portal-{{.continent}}.ecouser.net/api/iot/devmanager.do"
+	MQTT_HOST_FORMAT  = "mq-%s.ecouser.net"
+	ECOVACS_MQTT_PORT = 8883
+)
+
+const (
+	// Keepalive for the MQTT connection, which should be longer than
+	// the ping interval
+	MQTT_KEEPALIVE = 60 * time.Second
+
+	// Time allowed to connect and subscribe
+	MQTT_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+	// Messages which can be buffered before they are received
+	JSON_RECV_CAPACITY = 100
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW CLIENT / CLOSE
+
+// NewClient connects to the MQTT broker and subscribes to reports from
+// the device
+func (this *JSONClient) NewClient(opts JSONOptions) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if this.conn != nil {
+		return gopi.ErrOutOfOrder.WithPrefix("NewClient")
+	} else if opts.Client == nil {
+		return gopi.ErrBadParameter.WithPrefix("Client")
+	} else if _, err := url.Parse(opts.PortalURL); err != nil {
+		return err
+	}
+
+	// Connect and subscribe
+	dialer := &net.Dialer{Timeout: MQTT_HANDSHAKE_TIMEOUT}
+	conn, err := tls.DialWithDialer(dialer, "tcp", opts.MQTTHost, opts.TLSConfig)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(MQTT_HANDSHAKE_TIMEOUT))
+	if err := this.connect(conn, reader, opts); err != nil {
+		conn.Close()
+		return err
+	} else if err := this.subscribe(conn, reader); err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	// Set state
+	this.opts = opts
+	this.conn = conn
+	this.ctx, this.cancel = context.WithCancel(context.Background())
+	this.stop = make(chan struct{})
+	this.recv = make(chan jsonResult, JSON_RECV_CAPACITY)
+	this.state = jsonState{}
+
+	// Read reports in the background
+	this.WaitGroup.Add(1)
+	go this.read(conn, reader, this.stop, this.recv)
+
+	// Return success
+	return nil
+}
+
+func (this *JSONClient) Close() error {
+	this.Mutex.Lock()
+	if this.conn == nil {
+		this.Mutex.Unlock()
+		return nil
+	}
+	close(this.stop)
+	this.cancel()
+	(&MQTTPacket{Type: MQTT_DISCONNECT}).Write(this.conn)
+	err := this.conn.Close()
+	this.conn = nil
+	this.Mutex.Unlock()
+
+	// Wait for reads and commands to end
+	this.WaitGroup.Wait()
+
+	// Return any error
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PROPERTIES
+
+func (this *JSONClient) IsConnected() bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.conn != nil
+}
+
+func (this *JSONClient) Address() string {
+	return fmt.Sprintf("%s@%s.ecorobot.net/%s", this.DeviceId, this.Class, this.Resource)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RECEIVE
+
+// Recv returns the next response or report, or nil when the client
+// has been closed
+func (this *JSONClient) Recv() (*XMPPMessage, error) {
+	this.Mutex.Lock()
+	recv, stop := this.recv, this.stop
+	this.Mutex.Unlock()
+
+	if recv == nil {
+		return nil, nil
+	}
+	select {
+	case result := <-recv:
+		return result.message, result.err
+	case <-stop:
+		return nil, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SEND COMMANDS
+
+func (this *JSONClient) Ping() error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if this.conn == nil {
+		return gopi.ErrInternalAppError.WithPrefix("Ping")
+	} else {
+		return (&MQTTPacket{Type: MQTT_PINGREQ}).Write(this.conn)
+	}
+}
+
+func (this *JSONClient) Clean(mode home.EcovacsCleanMode, suction home.EcovacsCleanSuction) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	commands := []jsonCommand{}
+	if suction != "" {
+		if speed, exists := jsonSpeedForSuction(suction); exists == false {
+			return "", gopi.ErrBadParameter.WithPrefix("suction")
+		} else {
+			commands = append(commands, jsonCommand{"setSpeed", map[string]int{"speed": speed}})
+		}
+	}
+	if mode == home.ECOVACS_CLEAN_STOP {
+		commands = append(commands, jsonCommand{"clean", map[string]string{"act": "stop"}})
+	} else if mode != "" {
+		commands = append(commands, jsonCommand{"clean", map[string]string{"act": "start", "type": jsonTypeForMode(mode)}})
+	} else {
+		return "", gopi.ErrBadParameter.WithPrefix("mode")
+	}
+	return this.send("Clean", commands...)
+}
+
+func (this *JSONClient) Charge() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("Charge", jsonCommand{"charge", map[string]string{"act": "go"}})
+}
+
+func (this *JSONClient) GetBatteryInfo() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetBatteryInfo", jsonCommand{"getBattery", nil})
+}
+
+func (this *JSONClient) GetLifeSpan(part home.EcovacsPart) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if name, exists := jsonParts[part]; exists == false {
+		return "", gopi.ErrBadParameter.WithPrefix("GetLifeSpan")
+	} else {
+		return this.send("GetLifeSpan", jsonCommand{"getLifeSpan", []string{name}})
+	}
+}
+
+// ResetLifeSpan resets the lifespan of a part after it has been replaced
+func (this *JSONClient) ResetLifeSpan(part home.EcovacsPart) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if name, exists := jsonParts[part]; exists == false {
+		return "", gopi.ErrBadParameter.WithPrefix("ResetLifeSpan")
+	} else {
+		return this.send("ResetLifeSpan", jsonCommand{"resetLifeSpan", map[string]string{"type": name}})
+	}
+}
+
+func (this *JSONClient) GetChargeState() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetChargeState", jsonCommand{"getChargeState", nil})
+}
+
+// GetCleanState requests the suction and then the clean state, which are
+// reported together
+func (this *JSONClient) GetCleanState() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetCleanState", jsonCommand{"getSpeed", nil}, jsonCommand{"getCleanInfo", nil})
+}
+
+// GetVersion is not implemented, since the firmware version is not
+// returned by a command
+func (this *JSONClient) GetVersion() (string, error) {
+	return "", gopi.ErrNotImplemented.WithPrefix("GetVersion")
+}
+
+func (this *JSONClient) GetMapM() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetMapM", jsonCommand{"getMajorMap", nil})
+}
+
+// PullMP requests a piece of the map most recently received
+func (this *JSONClient) PullMP(piece uint) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if mapId := this.state.MapId(); mapId == "" {
+		return "", gopi.ErrOutOfOrder.WithPrefix("PullMP")
+	} else {
+		return this.send("PullMP", jsonCommand{"getMinorMap", map[string]interface{}{
+			"mid":        mapId,
+			"type":       "ol",
+			"pieceIndex": piece,
+		}})
+	}
+}
+
+func (this *JSONClient) GetPos() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetPos", jsonCommand{"getPos", []string{"deebotPos"}})
+}
+
+func (this *JSONClient) GetChargerPos() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetChargerPos", jsonCommand{"getPos", []string{"chargePos"}})
+}
+
+func (this *JSONClient) GetCleanSum() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetCleanSum", jsonCommand{"getTotalStats", nil})
+}
+
+// GetCleanLogs is not implemented, since cleaning history is not
+// returned by a command
+func (this *JSONClient) GetCleanLogs(count uint) (string, error) {
+	return "", gopi.ErrNotImplemented.WithPrefix("GetCleanLogs")
+}
+
+func (this *JSONClient) GetSched() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetSched", jsonCommand{"getSched", nil})
+}
+
+func (this *JSONClient) SetSched(schedule home.EcovacsSchedule) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if err := checkSchedule(schedule); err != nil {
+		return "", err
+	} else {
+		return this.send("SetSched", jsonCommand{"setSched", jsonForSchedule(schedule)})
+	}
+}
+
+func (this *JSONClient) DelSched(name string) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if name == "" {
+		return "", gopi.ErrBadParameter.WithPrefix("name")
+	} else {
+		return this.send("DelSched", jsonCommand{"delSched", map[string]string{"name": name}})
+	}
+}
+
+func (this *JSONClient) GetBlockTime() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.send("GetBlockTime", jsonCommand{"getBlock", nil})
+}
+
+func (this *JSONClient) SetBlockTime(dnd home.EcovacsDND) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	enabled := 0
+	if dnd.Enabled {
+		enabled = 1
+	}
+	return this.send("SetBlockTime", jsonCommand{"setBlock", map[string]interface{}{
+		"enable": enabled,
+		"start":  FormatTimeOfDay(dnd.Start),
+		"end":    FormatTimeOfDay(dnd.End),
+	}})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// send posts commands to the portal in the background, in order, and
+// delivers responses to Recv. Commands after a failure are not sent.
+// The lock should be held
+func (this *JSONClient) send(td string, commands ...jsonCommand) (string, error) {
+	if this.conn == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix(td)
+	}
+	reqId := this.RequestId.Next()
+	ctx, stop, recv := this.ctx, this.stop, this.recv
+	this.WaitGroup.Add(1)
+	go func() {
+		defer this.WaitGroup.Done()
+		for _, command := range commands {
+			messages, err := this.post(ctx, reqId, td, command)
+			for _, message := range messages {
+				select {
+				case recv <- jsonResult{message: message}:
+				case <-stop:
+					return
+				}
+			}
+			if err != nil || len(messages) == 0 || messages[0].Control.ErrorNo != 0 {
+				return
+			}
+		}
+	}()
+	return reqId, nil
+}
+
+// post sends a command to the portal and returns the response as messages,
+// or a failure message when the command could not be completed
+func (this *JSONClient) post(ctx context.Context, reqId, td string, command jsonCommand) ([]*XMPPMessage, error) {
+	var response JSONResponse
+
+	ctl, err := func() ([]string, error) {
+		if body, err := this.request(command); err != nil {
+			return nil, err
+		} else if uri, err := this.portalURL(); err != nil {
+			return nil, err
+		} else if req, err := http.NewRequest("POST", uri, bytes.NewReader(body)); err != nil {
+			return nil, err
+		} else {
+			req.Header.Add("Content-Type", "application/json")
+			if resp, err := this.opts.Client.Do(req.WithContext(ctx)); err != nil {
+				return nil, err
+			} else {
+				defer resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					return nil, gopi.ErrUnexpectedResponse.WithPrefix(http.StatusText(resp.StatusCode))
+				} else if data, err := ioutil.ReadAll(resp.Body); err != nil {
+					return nil, err
+				} else if err := json.Unmarshal(data, &response); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if response.Ret != "ok" {
+			return []string{jsonFailure(response.ErrNo, response.Error)}, nil
+		} else if body := response.Resp.Body; body.Code != 0 {
+			return []string{jsonFailure(body.Code, body.Msg)}, nil
+		} else if ctl, err := this.state.Normalise(command.name, body.Data); err != nil {
+			return nil, err
+		} else if len(ctl) == 0 {
+			return []string{`<ctl ret="ok"/>`}, nil
+		} else {
+			return ctl, nil
+		}
+	}()
+
+	// Cancelled requests are not reported
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	} else if err != nil {
+		ctl = []string{jsonFailure(500, err.Error())}
+	}
+
+	// Create messages for the request
+	messages := make([]*XMPPMessage, 0, len(ctl))
+	for _, data := range ctl {
+		if message, err := jsonMessage(data, reqId); err != nil {
+			return messages, err
+		} else {
+			message.SetRequest(td)
+			messages = append(messages, message)
+		}
+	}
+	return messages, err
+}
+
+// request returns the body for a command
+func (this *JSONClient) request(command jsonCommand) ([]byte, error) {
+	request := JSONRequest{
+		CmdName:     command.name,
+		PayloadType: "j",
+		Td:          "q",
+		ToId:        this.DeviceId,
+		ToRes:       this.Resource,
+		ToType:      this.Class,
+		Auth: map[string]string{
+			"with":     "users",
+			"userid":   this.opts.UserId,
+			"realm":    ECOVACS_REALM,
+			"token":    this.opts.Token,
+			"resource": this.opts.Resource,
+		},
+	}
+	request.Payload.Header = map[string]interface{}{
+		"pri": "1",
+		"ts":  fmt.Sprint(time.Now().UnixNano() / int64(time.Millisecond)),
+		"tzm": 0,
+		"ver": "0.0.50",
+	}
+	if command.data != nil {
+		if data, err := json.Marshal(command.data); err != nil {
+			return nil, err
+		} else {
+			request.Payload.Body.Data = data
+		}
+	}
+	return json.Marshal(request)
+}
+
+func (this *JSONClient) portalURL() (string, error) {
+	if uri, err := url.Parse(this.opts.PortalURL); err != nil {
+		return "", err
+	} else {
+		query := uri.Query()
+		query.Set("mid", this.Class)
+		query.Set("did", this.DeviceId)
+		query.Set("td", "q")
+		query.Set("u", this.opts.UserId)
+		uri.RawQuery = query.Encode()
+		return uri.String(), nil
+	}
+}
+
+// topic returns the topic filter for reports from the device
+func (this *JSONClient) topic() string {
+	return fmt.Sprintf("iot/atr/+/%s/%s/%s/j", this.DeviceId, this.Class, this.Resource)
+}
+
+// connect sends CONNECT and waits for CONNACK
+func (this *JSONClient) connect(conn net.Conn, reader *bufio.Reader, opts JSONOptions) error {
+	body := AppendMQTTString(nil, "MQTT")
+	body = append(body, 4, 0xC2)
+	body = AppendMQTTUint16(body, uint16(MQTT_KEEPALIVE/time.Second))
+	body = AppendMQTTString(body, fmt.Sprintf("%s@ecouser/%s", opts.UserId, opts.Resource))
+	body = AppendMQTTString(body, opts.UserId)
+	body = AppendMQTTString(body, opts.Token)
+	if err := (&MQTTPacket{Type: MQTT_CONNECT, Body: body}).Write(conn); err != nil {
+		return err
+	} else if packet, err := ReadMQTTPacket(reader); err != nil {
+		return err
+	} else if packet.Type != MQTT_CONNACK || len(packet.Body) != 2 {
+		return gopi.ErrUnexpectedResponse.WithPrefix("CONNACK")
+	} else if code := packet.Body[1]; code == 4 || code == 5 {
+		return home.ErrAuthenticationError
+	} else if code != 0 {
+		return gopi.ErrUnexpectedResponse.WithPrefix(fmt.Sprint("CONNACK ", code))
+	}
+
+	// Success
+	return nil
+}
+
+// subscribe sends SUBSCRIBE for reports and waits for SUBACK
+func (this *JSONClient) subscribe(conn net.Conn, reader *bufio.Reader) error {
+	body := AppendMQTTUint16(nil, 1)
+	body = AppendMQTTString(body, this.topic())
+	body = append(body, 0)
+	if err := (&MQTTPacket{Type: MQTT_SUBSCRIBE, Flags: 2, Body: body}).Write(conn); err != nil {
+		return err
+	} else if packet, err := ReadMQTTPacket(reader); err != nil {
+		return err
+	} else if packet.Type != MQTT_SUBACK || len(packet.Body) != 3 || packet.Body[2] == 0x80 {
+		return gopi.ErrUnexpectedResponse.WithPrefix("SUBACK")
+	}
+
+	// Success
+	return nil
+}
+
+// read receives reports until the connection is closed, and delivers
+// them to Recv
+func (this *JSONClient) read(conn net.Conn, reader *bufio.Reader, stop <-chan struct{}, recv chan<- jsonResult) {
+	defer this.WaitGroup.Done()
+	for {
+		messages, err := this.readPacket(conn, reader)
+		if err != nil {
+			select {
+			case <-stop:
+				// Error due to close, don't report
+			default:
+				select {
+				case recv <- jsonResult{err: err}:
+				case <-stop:
+				}
+			}
+			return
+		}
+		for _, message := range messages {
+			select {
+			case recv <- jsonResult{message: message}:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// readPacket reads a packet and returns messages for a report
+func (this *JSONClient) readPacket(conn net.Conn, reader *bufio.Reader) ([]*XMPPMessage, error) {
+	packet, err := ReadMQTTPacket(reader)
+	if err != nil {
+		return nil, err
+	} else if packet.Type != MQTT_PUBLISH {
+		return nil, nil
+	}
+	topic, body, err := ReadMQTTString(packet.Body)
+	if err != nil {
+		return nil, err
+	}
+	if qos := (packet.Flags >> 1) & 0x03; qos > 0 {
+		packetId, rest, err := ReadMQTTUint16(body)
+		if err != nil {
+			return nil, err
+		}
+		body = rest
+		this.Mutex.Lock()
+		err = (&MQTTPacket{Type: MQTT_PUBACK, Body: AppendMQTTUint16(nil, packetId)}).Write(conn)
+		this.Mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Topic is iot/atr/<name>/<did>/<class>/<resource>/j
+	var payload JSONPayload
+	if fields := strings.Split(topic, "/"); len(fields) != 7 || fields[3] != this.DeviceId {
+		return nil, nil
+	} else if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	} else if ctl, err := this.state.Normalise(fields[2], payload.Body.Data); err != nil {
+		return nil, err
+	} else {
+		messages := make([]*XMPPMessage, 0, len(ctl))
+		for _, data := range ctl {
+			if message, err := jsonMessage(data, ""); err != nil {
+				return nil, err
+			} else {
+				messages = append(messages, message)
+			}
+		}
+		return messages, nil
+	}
+}
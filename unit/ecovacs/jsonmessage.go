@@ -0,0 +1,343 @@
+package ecovacs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// Frameworks
+	home "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// jsonState normalises JSON responses and reports into ctl elements, and
+// caches values which are needed to do so
+type jsonState struct {
+	clean, speed, mapId string
+	charging            bool
+	sync.Mutex
+}
+
+type jsonPosition struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	A int `json:"a"`
+}
+
+type jsonSchedule struct {
+	Name   string `json:"name"`
+	Enable uint   `json:"enable"`
+	Hour   uint   `json:"hour"`
+	Minute uint   `json:"minute"`
+	Repeat string `json:"repeat"`
+	Type   string `json:"type"`
+	Speed  string `json:"speed,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	// Part names for JSON commands
+	jsonParts = map[home.EcovacsPart]string{
+		home.ECOVACS_PART_BRUSH:      "brush",
+		home.ECOVACS_PART_SIDEBRUSH:  "sideBrush",
+		home.ECOVACS_PART_DUSTFILTER: "heap",
+	}
+
+	// Suction for each speed value
+	jsonSpeeds = map[int]home.EcovacsCleanSuction{
+		1000: "quiet",
+		0:    home.ECOVACS_SUCTION_STANDARD,
+		1:    home.ECOVACS_SUCTION_STRONG,
+		2:    "max",
+	}
+
+	// Clean types which differ from the clean mode
+	jsonCleanTypes = map[home.EcovacsCleanMode]string{
+		home.ECOVACS_CLEAN_ROOM: "singleRoom",
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NORMALISE
+
+// Normalise returns ctl elements for a JSON response or report, where
+// name is the command (getBattery) or report (onBattery) name. Responses
+// to commands which change the device and unknown reports return no
+// elements
+func (this *jsonState) Normalise(name string, data json.RawMessage) ([]string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	switch strings.TrimPrefix(strings.TrimPrefix(name, "get"), "on") {
+	case "Battery":
+		var value struct {
+			Value uint `json:"value"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf(`<ctl td="BatteryInfo"><battery power="%03d"/></ctl>`, value.Value)}, nil
+	case "ChargeState":
+		var value struct {
+			IsCharging uint `json:"isCharging"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		this.charging = value.IsCharging != 0
+		return []string{this.chargeState()}, nil
+	case "CleanInfo":
+		var value struct {
+			State      string `json:"state"`
+			CleanState struct {
+				Type string `json:"type"`
+			} `json:"cleanState"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		ctl := []string{}
+		switch value.State {
+		case "clean":
+			this.clean = string(jsonModeForType(value.CleanState.Type))
+		case "goCharging":
+			this.clean = string(home.ECOVACS_CLEAN_STOP)
+			this.charging = false
+			ctl = append(ctl, `<ctl td="ChargeState"><charge type="Going"/></ctl>`)
+		default:
+			this.clean = string(home.ECOVACS_CLEAN_STOP)
+		}
+		if this.speed != "" {
+			ctl = append(ctl, this.cleanState())
+		}
+		return ctl, nil
+	case "Speed":
+		var value struct {
+			Speed int `json:"speed"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		} else if suction, exists := jsonSpeeds[value.Speed]; exists {
+			this.speed = string(suction)
+		} else {
+			this.speed = fmt.Sprint(value.Speed)
+		}
+		if this.clean != "" {
+			return []string{this.cleanState()}, nil
+		} else {
+			return nil, nil
+		}
+	case "LifeSpan":
+		var values []struct {
+			Type  string `json:"type"`
+			Left  uint   `json:"left"`
+			Total uint   `json:"total"`
+		}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+		ctl := make([]string, 0, len(values))
+		for _, value := range values {
+			if part := jsonPartForName(value.Type); part != "" {
+				ctl = append(ctl, fmt.Sprintf(`<ctl td="LifeSpan" type="%s" val="%d" total="%d"/>`, escapeXML(string(part)), value.Left, value.Total))
+			}
+		}
+		return ctl, nil
+	case "Pos":
+		var value struct {
+			DeebotPos *jsonPosition  `json:"deebotPos"`
+			ChargePos []jsonPosition `json:"chargePos"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		ctl := []string{}
+		if pos := value.DeebotPos; pos != nil {
+			ctl = append(ctl, fmt.Sprintf(`<ctl td="Pos" t="p" p="%d,%d" a="%d" valid="1"/>`, pos.X, pos.Y, pos.A))
+		}
+		if len(value.ChargePos) > 0 {
+			pos := value.ChargePos[0]
+			ctl = append(ctl, fmt.Sprintf(`<ctl td="ChargerPos" p="%d,%d" a="%d"/>`, pos.X, pos.Y, pos.A))
+		}
+		return ctl, nil
+	case "MajorMap":
+		var value struct {
+			Mid         string `json:"mid"`
+			PieceWidth  uint   `json:"pieceWidth"`
+			PieceHeight uint   `json:"pieceHeight"`
+			CellWidth   uint   `json:"cellWidth"`
+			CellHeight  uint   `json:"cellHeight"`
+			Pixel       uint   `json:"pixel"`
+			Value       string `json:"value"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		this.mapId = value.Mid
+		return []string{fmt.Sprintf(`<ctl td="MapM" i="%s" w="%d" h="%d" r="%d" c="%d" p="%d" m="%s"/>`,
+			escapeXML(value.Mid), value.PieceWidth, value.PieceHeight, value.CellHeight, value.CellWidth, value.Pixel, escapeXML(value.Value))}, nil
+	case "MinorMap":
+		var value struct {
+			Mid        string `json:"mid"`
+			PieceIndex uint   `json:"pieceIndex"`
+			PieceValue string `json:"pieceValue"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf(`<ctl td="MapP" i="%s" pid="%d" p="%s"/>`, escapeXML(value.Mid), value.PieceIndex, escapeXML(value.PieceValue))}, nil
+	case "TotalStats":
+		var value struct {
+			Area  uint `json:"area"`
+			Time  uint `json:"time"`
+			Count uint `json:"count"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf(`<ctl td="CleanSum" a="%d" l="%d" c="%d"/>`, value.Area, value.Time, value.Count)}, nil
+	case "Sched":
+		var values []jsonSchedule
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+		var body strings.Builder
+		for _, value := range values {
+			fmt.Fprintf(&body, `<s n="%s" o="%d" h="%d" m="%d" r="%s"><ctl td="Clean"><clean type="%s" speed="%s"/></ctl></s>`,
+				escapeXML(value.Name), value.Enable, value.Hour, value.Minute, escapeXML(value.Repeat), escapeXML(string(jsonModeForType(value.Type))), escapeXML(value.Speed))
+		}
+		return []string{`<ctl td="Sched">` + body.String() + `</ctl>`}, nil
+	case "Block":
+		var value struct {
+			Enable uint   `json:"enable"`
+			Start  string `json:"start"`
+			End    string `json:"end"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf(`<ctl td="BlockTime" o="%d" s="%s" e="%s"/>`, value.Enable, escapeXML(value.Start), escapeXML(value.End))}, nil
+	case "Error":
+		var value struct {
+			Code []uint `json:"code"`
+		}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		} else if len(value.Code) == 0 {
+			return nil, nil
+		}
+		codes := make([]string, 0, len(value.Code))
+		for _, code := range value.Code {
+			codes = append(codes, fmt.Sprint(code))
+		}
+		return []string{fmt.Sprintf(`<ctl td="error" errs="%s"/>`, strings.Join(codes, ","))}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// MapId returns the identifier of the map most recently received
+func (this *jsonState) MapId() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.mapId
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// chargeState returns the charge state. The lock should be held
+func (this *jsonState) chargeState() string {
+	if this.charging {
+		return `<ctl td="ChargeState"><charge type="SlotCharging"/></ctl>`
+	} else {
+		return `<ctl td="ChargeState"><charge type="Idle"/></ctl>`
+	}
+}
+
+// cleanState returns the clean mode and suction. The lock should be held
+func (this *jsonState) cleanState() string {
+	return fmt.Sprintf(`<ctl td="CleanReport"><clean type="%s" speed="%s"/></ctl>`, escapeXML(this.clean), escapeXML(this.speed))
+}
+
+// jsonMessage returns a message for a ctl element, wrapped in a query
+// element as it would be received over XMPP
+func jsonMessage(ctl, id string) (*XMPPMessage, error) {
+	return NewXMPPMessage([]byte(`<query xmlns="com:ctl">`+ctl+`</query>`), id)
+}
+
+// jsonFailure returns a failed response
+func jsonFailure(errno uint, message string) string {
+	return fmt.Sprintf(`<ctl ret="fail" errno="%d" error="%s"/>`, errno, escapeXML(message))
+}
+
+// jsonPartForName returns the part for a JSON part name, or an empty
+// string if the part is unknown
+func jsonPartForName(name string) home.EcovacsPart {
+	for part, value := range jsonParts {
+		if value == name {
+			return part
+		}
+	}
+	return ""
+}
+
+// jsonSpeedForSuction returns the speed value for suction
+func jsonSpeedForSuction(suction home.EcovacsCleanSuction) (int, bool) {
+	for speed, value := range jsonSpeeds {
+		if value == home.EcovacsCleanSuction(strings.ToLower(string(suction))) {
+			return speed, true
+		}
+	}
+	return 0, false
+}
+
+// jsonTypeForMode returns the clean type for a clean mode
+func jsonTypeForMode(mode home.EcovacsCleanMode) string {
+	if value, exists := jsonCleanTypes[mode]; exists {
+		return value
+	} else {
+		return string(mode)
+	}
+}
+
+// jsonModeForType returns the clean mode for a clean type
+func jsonModeForType(value string) home.EcovacsCleanMode {
+	for mode, other := range jsonCleanTypes {
+		if other == value {
+			return mode
+		}
+	}
+	if value == "" {
+		return home.ECOVACS_CLEAN_AUTO
+	} else {
+		return home.EcovacsCleanMode(strings.ToLower(value))
+	}
+}
+
+// jsonForSchedule returns a schedule for the setSched command
+func jsonForSchedule(schedule home.EcovacsSchedule) jsonSchedule {
+	enable := uint(0)
+	if schedule.Enabled {
+		enable = 1
+	}
+	suction := schedule.Suction
+	if suction == "" {
+		suction = home.ECOVACS_SUCTION_STANDARD
+	}
+	return jsonSchedule{
+		Name:   schedule.Name,
+		Enable: enable,
+		Hour:   uint(schedule.Time / time.Hour),
+		Minute: uint((schedule.Time % time.Hour) / time.Minute),
+		Repeat: repeatForWeekdays(schedule.Days),
+		Type:   jsonTypeForMode(schedule.Mode),
+		Speed:  string(suction),
+	}
+}
@@ -0,0 +1,361 @@
+package ecovacs
+
+import (
+	"encoding/binary"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// lzmaDecoder decodes a raw LZMA stream into a buffer of known size,
+// following the reference decoder in the LZMA SDK. The output buffer
+// is used as the dictionary
+type lzmaDecoder struct {
+	lc, lp, pb uint
+	dictSize   uint32
+
+	// Range decoder
+	in           []byte
+	overrun      bool
+	code, range_ uint32
+
+	// Output
+	out []byte
+
+	// Probabilities
+	literal    []uint16
+	isMatch    [LZMA_STATES << LZMA_POSBITS_MAX]uint16
+	isRep      [LZMA_STATES]uint16
+	isRepG0    [LZMA_STATES]uint16
+	isRepG1    [LZMA_STATES]uint16
+	isRepG2    [LZMA_STATES]uint16
+	isRep0Long [LZMA_STATES << LZMA_POSBITS_MAX]uint16
+	posSlot    [LZMA_LENSTATES][1 << 6]uint16
+	posSpecial [1 + LZMA_FULL_DISTANCES - LZMA_END_POS_MODEL]uint16
+	align      [1 << LZMA_ALIGN_BITS]uint16
+	length     lzmaLenDecoder
+	repLength  lzmaLenDecoder
+}
+
+type lzmaLenDecoder struct {
+	choice, choice2 uint16
+	low, mid        [1 << LZMA_POSBITS_MAX][1 << 3]uint16
+	high            [1 << 8]uint16
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	LZMA_STATES         = 12
+	LZMA_POSBITS_MAX    = 4
+	LZMA_LENSTATES      = 4
+	LZMA_ALIGN_BITS     = 4
+	LZMA_END_POS_MODEL  = 14
+	LZMA_FULL_DISTANCES = 1 << (LZMA_END_POS_MODEL >> 1)
+	LZMA_MATCH_MIN_LEN  = 2
+	LZMA_PROB_INIT      = 1 << 10
+	LZMA_TOP_VALUE      = 1 << 24
+)
+
+const (
+	// Header for compressed map pieces, which is five bytes of properties
+	// followed by the uncompressed size as a 32-bit value
+	LZMA_HEADER_SIZE = 9
+	// Upper limit on the uncompressed size
+	LZMA_MAX_SIZE = 1 << 24
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// DECOMPRESS
+
+// DecompressLZMA decompresses a map piece, which is LZMA compressed with
+// a nine byte header rather than the thirteen byte header of .lzma files
+func DecompressLZMA(data []byte) ([]byte, error) {
+	if len(data) < LZMA_HEADER_SIZE {
+		return nil, gopi.ErrBadParameter.WithPrefix("DecompressLZMA")
+	}
+	props := uint(data[0])
+	if props >= 9*5*5 {
+		return nil, gopi.ErrBadParameter.WithPrefix("DecompressLZMA")
+	}
+	size := binary.LittleEndian.Uint32(data[5:9])
+	if size > LZMA_MAX_SIZE {
+		return nil, gopi.ErrBadParameter.WithPrefix("DecompressLZMA")
+	}
+	decoder := &lzmaDecoder{
+		lc:       props % 9,
+		lp:       (props / 9) % 5,
+		pb:       props / 45,
+		dictSize: binary.LittleEndian.Uint32(data[1:5]),
+		in:       data[LZMA_HEADER_SIZE:],
+		out:      make([]byte, 0, size),
+	}
+	if err := decoder.decode(int(size)); err != nil {
+		return nil, err
+	} else {
+		return decoder.out, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *lzmaDecoder) decode(size int) error {
+	this.init()
+
+	// Initialize range decoder, first byte is always zero
+	if len(this.in) < 5 || this.in[0] != 0 {
+		return gopi.ErrUnexpectedResponse.WithPrefix("DecompressLZMA")
+	}
+	this.code = binary.BigEndian.Uint32(this.in[1:5])
+	this.range_ = 0xFFFFFFFF
+	this.in = this.in[5:]
+
+	state := uint(0)
+	rep0, rep1, rep2, rep3 := uint32(0), uint32(0), uint32(0), uint32(0)
+	pbMask := uint(1)<<this.pb - 1
+	for len(this.out) < size {
+		if this.overrun {
+			// Read past the end of the compressed data
+			return gopi.ErrUnexpectedResponse.WithPrefix("DecompressLZMA")
+		}
+		posState := uint(len(this.out)) & pbMask
+		if this.bit(&this.isMatch[state<<LZMA_POSBITS_MAX+posState]) == 0 {
+			this.literal_(state, rep0)
+			state = literalState(state)
+			continue
+		}
+
+		var length uint
+		if this.bit(&this.isRep[state]) != 0 {
+			if len(this.out) == 0 {
+				return gopi.ErrUnexpectedResponse.WithPrefix("DecompressLZMA")
+			}
+			if this.bit(&this.isRepG0[state]) == 0 {
+				if this.bit(&this.isRep0Long[state<<LZMA_POSBITS_MAX+posState]) == 0 {
+					// Short rep, copy a single byte
+					if state < 7 {
+						state = 9
+					} else {
+						state = 11
+					}
+					if int(rep0) >= len(this.out) {
+						return gopi.ErrUnexpectedResponse.WithPrefix("DecompressLZMA")
+					}
+					this.out = append(this.out, this.out[len(this.out)-int(rep0)-1])
+					continue
+				}
+			} else {
+				var dist uint32
+				if this.bit(&this.isRepG1[state]) == 0 {
+					dist = rep1
+				} else {
+					if this.bit(&this.isRepG2[state]) == 0 {
+						dist = rep2
+					} else {
+						dist = rep3
+						rep3 = rep2
+					}
+					rep2 = rep1
+				}
+				rep1 = rep0
+				rep0 = dist
+			}
+			length = this.repLength.decode(this, posState)
+			if state < 7 {
+				state = 8
+			} else {
+				state = 11
+			}
+		} else {
+			rep3, rep2, rep1 = rep2, rep1, rep0
+			length = this.length.decode(this, posState)
+			if state < 7 {
+				state = 7
+			} else {
+				state = 10
+			}
+			rep0 = this.distance(length)
+			if rep0 == 0xFFFFFFFF {
+				// End marker before the expected size
+				return gopi.ErrUnexpectedResponse.WithPrefix("DecompressLZMA")
+			}
+		}
+
+		// Copy match from the dictionary
+		length += LZMA_MATCH_MIN_LEN
+		if int(rep0) >= len(this.out) || rep0 >= this.dictSize && this.dictSize > 0 {
+			return gopi.ErrUnexpectedResponse.WithPrefix("DecompressLZMA")
+		}
+		for i := uint(0); i < length && len(this.out) < size; i++ {
+			this.out = append(this.out, this.out[len(this.out)-int(rep0)-1])
+		}
+	}
+	if this.overrun {
+		return gopi.ErrUnexpectedResponse.WithPrefix("DecompressLZMA")
+	}
+
+	// Success
+	return nil
+}
+
+func (this *lzmaDecoder) init() {
+	this.literal = make([]uint16, 0x300<<(this.lc+this.lp))
+	probs := [][]uint16{
+		this.literal, this.isMatch[:], this.isRep[:], this.isRepG0[:], this.isRepG1[:],
+		this.isRepG2[:], this.isRep0Long[:], this.posSpecial[:], this.align[:],
+		this.length.high[:], this.repLength.high[:],
+	}
+	for i := range this.posSlot {
+		probs = append(probs, this.posSlot[i][:])
+	}
+	for i := range this.length.low {
+		probs = append(probs, this.length.low[i][:], this.length.mid[i][:])
+		probs = append(probs, this.repLength.low[i][:], this.repLength.mid[i][:])
+	}
+	for _, prob := range probs {
+		for i := range prob {
+			prob[i] = LZMA_PROB_INIT
+		}
+	}
+	this.length.choice, this.length.choice2 = LZMA_PROB_INIT, LZMA_PROB_INIT
+	this.repLength.choice, this.repLength.choice2 = LZMA_PROB_INIT, LZMA_PROB_INIT
+}
+
+// literal_ decodes a literal byte, using the byte at rep0 as a match
+// byte after a match
+func (this *lzmaDecoder) literal_(state uint, rep0 uint32) {
+	prevByte := uint(0)
+	if len(this.out) > 0 {
+		prevByte = uint(this.out[len(this.out)-1])
+	}
+	litState := ((uint(len(this.out)) & (1<<this.lp - 1)) << this.lc) + (prevByte >> (8 - this.lc))
+	probs := this.literal[0x300*litState:]
+
+	symbol := uint(1)
+	if state >= 7 && int(rep0) < len(this.out) {
+		matchByte := uint(this.out[len(this.out)-int(rep0)-1])
+		for symbol < 0x100 {
+			matchBit := (matchByte >> 7) & 1
+			matchByte <<= 1
+			bit := this.bit(&probs[((1+matchBit)<<8)+symbol])
+			symbol = symbol<<1 | bit
+			if matchBit != bit {
+				break
+			}
+		}
+	}
+	for symbol < 0x100 {
+		symbol = symbol<<1 | this.bit(&probs[symbol])
+	}
+	this.out = append(this.out, byte(symbol-0x100))
+}
+
+// distance decodes the distance for a match of length
+func (this *lzmaDecoder) distance(length uint) uint32 {
+	lenState := length
+	if lenState > LZMA_LENSTATES-1 {
+		lenState = LZMA_LENSTATES - 1
+	}
+	posSlot := this.tree(this.posSlot[lenState][:], 6)
+	if posSlot < 4 {
+		return uint32(posSlot)
+	}
+	numDirectBits := (posSlot >> 1) - 1
+	dist := uint32(2|(posSlot&1)) << numDirectBits
+	if posSlot < LZMA_END_POS_MODEL {
+		dist += uint32(this.reverse(this.posSpecial[dist-uint32(posSlot):], numDirectBits))
+	} else {
+		dist += this.direct(numDirectBits-LZMA_ALIGN_BITS) << LZMA_ALIGN_BITS
+		dist += uint32(this.reverse(this.align[:], LZMA_ALIGN_BITS))
+	}
+	return dist
+}
+
+func (this *lzmaLenDecoder) decode(decoder *lzmaDecoder, posState uint) uint {
+	if decoder.bit(&this.choice) == 0 {
+		return decoder.tree(this.low[posState][:], 3)
+	} else if decoder.bit(&this.choice2) == 0 {
+		return 8 + decoder.tree(this.mid[posState][:], 3)
+	} else {
+		return 16 + decoder.tree(this.high[:], 8)
+	}
+}
+
+// bit decodes a single bit and updates the probability
+func (this *lzmaDecoder) bit(prob *uint16) uint {
+	var bit uint
+	bound := (this.range_ >> 11) * uint32(*prob)
+	if this.code < bound {
+		*prob += ((1 << 11) - *prob) >> 5
+		this.range_ = bound
+	} else {
+		*prob -= *prob >> 5
+		this.code -= bound
+		this.range_ -= bound
+		bit = 1
+	}
+	this.normalize()
+	return bit
+}
+
+// direct decodes bits with a fixed probability of one half
+func (this *lzmaDecoder) direct(bits uint) uint32 {
+	result := uint32(0)
+	for ; bits > 0; bits-- {
+		this.range_ >>= 1
+		this.code -= this.range_
+		t := 0 - (this.code >> 31)
+		this.code += this.range_ & t
+		this.normalize()
+		result = result<<1 + t + 1
+	}
+	return result
+}
+
+func (this *lzmaDecoder) tree(probs []uint16, bits uint) uint {
+	m := uint(1)
+	for i := uint(0); i < bits; i++ {
+		m = m<<1 + this.bit(&probs[m])
+	}
+	return m - 1<<bits
+}
+
+func (this *lzmaDecoder) reverse(probs []uint16, bits uint) uint {
+	m, symbol := uint(1), uint(0)
+	for i := uint(0); i < bits; i++ {
+		bit := this.bit(&probs[m])
+		m = m<<1 + bit
+		symbol |= bit << i
+	}
+	return symbol
+}
+
+func (this *lzmaDecoder) normalize() {
+	if this.range_ < LZMA_TOP_VALUE {
+		this.range_ <<= 8
+		this.code <<= 8
+		if len(this.in) > 0 {
+			this.code |= uint32(this.in[0])
+			this.in = this.in[1:]
+		} else {
+			this.overrun = true
+		}
+	}
+}
+
+// literalState returns the state after a literal
+func literalState(state uint) uint {
+	switch {
+	case state < 4:
+		return 0
+	case state < 10:
+		return state - 3
+	default:
+		return state - 6
+	}
+}
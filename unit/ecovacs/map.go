@@ -0,0 +1,220 @@
+package ecovacs
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	home "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// MapInfo is the map metadata returned by GetMapM. The map is divided
+// into Rows x Columns pieces, each of which is PieceWidth x PieceHeight
+// cells, and CRC contains the checksum of each uncompressed piece
+type MapInfo struct {
+	Id                      string
+	PieceWidth, PieceHeight uint
+	Rows, Columns           uint
+	Resolution              uint // Millimetres per cell
+	CRC                     []uint32
+}
+
+// Map is assembled from map pieces. Pieces are numbered in row order
+// and the cells within each piece are also in row order
+type Map struct {
+	sync.RWMutex
+
+	info   MapInfo
+	empty  uint32
+	loaded []bool
+	cells  []home.EcovacsMapCell
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+// NewMap returns an empty map for map metadata. Pieces with the same
+// checksum as an existing map are copied from it, so that only changed
+// pieces need to be requested
+func NewMap(info MapInfo, existing *Map) (*Map, error) {
+	if info.PieceWidth == 0 || info.PieceHeight == 0 || info.Resolution == 0 {
+		return nil, gopi.ErrBadParameter.WithPrefix("info")
+	} else if info.Rows == 0 || info.Columns == 0 || uint(len(info.CRC)) != info.Rows*info.Columns {
+		return nil, gopi.ErrBadParameter.WithPrefix("info")
+	}
+
+	this := new(Map)
+	this.info = info
+	this.empty = crc32.ChecksumIEEE(make([]byte, info.PieceWidth*info.PieceHeight))
+	this.loaded = make([]bool, len(info.CRC))
+	this.cells = make([]home.EcovacsMapCell, info.PieceWidth*info.PieceHeight*uint(len(info.CRC)))
+
+	// Empty pieces don't need to be requested
+	for piece, crc := range info.CRC {
+		if crc == this.empty {
+			this.loaded[piece] = true
+		}
+	}
+
+	// Copy pieces from an existing map with the same layout
+	if existing != nil {
+		existing.RLock()
+		defer existing.RUnlock()
+		if existing.info.Id == info.Id && existing.sameLayout(info) {
+			for piece, crc := range info.CRC {
+				if crc != this.empty && existing.loaded[piece] && existing.info.CRC[piece] == crc {
+					this.copyPiece(existing, uint(piece))
+					this.loaded[piece] = true
+				}
+			}
+		}
+	}
+
+	// Success
+	return this, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PROPERTIES
+
+func (this *Map) Id() string {
+	this.RLock()
+	defer this.RUnlock()
+	return this.info.Id
+}
+
+// Size returns the width and height of the map in cells
+func (this *Map) Size() (uint, uint) {
+	this.RLock()
+	defer this.RUnlock()
+	return this.width(), this.height()
+}
+
+// Resolution returns the size of each cell in millimetres
+func (this *Map) Resolution() uint {
+	this.RLock()
+	defer this.RUnlock()
+	return this.info.Resolution
+}
+
+// Cell returns the cell at x,y or ECOVACS_MAP_NONE if out of bounds
+func (this *Map) Cell(x, y uint) home.EcovacsMapCell {
+	this.RLock()
+	defer this.RUnlock()
+	if x >= this.width() || y >= this.height() {
+		return home.ECOVACS_MAP_NONE
+	} else {
+		return this.cells[y*this.width()+x]
+	}
+}
+
+// Point returns the cell for a position, where positions are relative
+// to the centre of the map
+func (this *Map) Point(position home.EcovacsPosition) (int, int) {
+	this.RLock()
+	defer this.RUnlock()
+	resolution := int(this.info.Resolution)
+	return int(this.width())/2 + position.X/resolution, int(this.height())/2 + position.Y/resolution
+}
+
+// Complete returns true when all pieces have been set
+func (this *Map) Complete() bool {
+	this.RLock()
+	defer this.RUnlock()
+	for _, loaded := range this.loaded {
+		if loaded == false {
+			return false
+		}
+	}
+	return true
+}
+
+// Pieces returns the pieces which have not been set
+func (this *Map) Pieces() []uint {
+	this.RLock()
+	defer this.RUnlock()
+	pieces := make([]uint, 0, len(this.loaded))
+	for piece, loaded := range this.loaded {
+		if loaded == false {
+			pieces = append(pieces, uint(piece))
+		}
+	}
+	return pieces
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SET PIECES
+
+// SetPiece sets the cells for a piece from compressed data, which is
+// returned by PullMP
+func (this *Map) SetPiece(piece uint, data []byte) error {
+	this.Lock()
+	defer this.Unlock()
+
+	if piece >= uint(len(this.loaded)) {
+		return gopi.ErrBadParameter.WithPrefix("piece")
+	} else if cells, err := DecompressLZMA(data); err != nil {
+		return err
+	} else if uint(len(cells)) != this.info.PieceWidth*this.info.PieceHeight {
+		return gopi.ErrUnexpectedResponse.WithPrefix(fmt.Sprint("SetPiece: ", piece))
+	} else {
+		x0, y0 := this.origin(piece)
+		for y := uint(0); y < this.info.PieceHeight; y++ {
+			for x := uint(0); x < this.info.PieceWidth; x++ {
+				this.cells[(y0+y)*this.width()+x0+x] = home.EcovacsMapCell(cells[y*this.info.PieceWidth+x])
+			}
+		}
+		this.loaded[piece] = true
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *Map) String() string {
+	w, h := this.Size()
+	return "<ecovacs.Map" +
+		" id=" + strconv.Quote(this.Id()) +
+		fmt.Sprintf(" size={%v,%v} resolution=%vmm pieces=%v complete=%v", w, h, this.Resolution(), len(this.info.CRC), this.Complete()) +
+		">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *Map) width() uint {
+	return this.info.PieceWidth * this.info.Columns
+}
+
+func (this *Map) height() uint {
+	return this.info.PieceHeight * this.info.Rows
+}
+
+// origin returns the top left cell for a piece
+func (this *Map) origin(piece uint) (uint, uint) {
+	row, column := piece/this.info.Columns, piece%this.info.Columns
+	return column * this.info.PieceWidth, row * this.info.PieceHeight
+}
+
+// copyPiece copies the cells for a piece from a map with the same layout
+func (this *Map) copyPiece(other *Map, piece uint) {
+	x0, y0 := this.origin(piece)
+	for y := y0; y < y0+this.info.PieceHeight; y++ {
+		i := y*this.width() + x0
+		copy(this.cells[i:i+this.info.PieceWidth], other.cells[i:i+this.info.PieceWidth])
+	}
+}
+
+func (this *Map) sameLayout(info MapInfo) bool {
+	return this.info.PieceWidth == info.PieceWidth && this.info.PieceHeight == info.PieceHeight &&
+		this.info.Rows == info.Rows && this.info.Columns == info.Columns
+}
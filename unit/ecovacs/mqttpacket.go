@@ -0,0 +1,127 @@
+package ecovacs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// MQTTPacket is a control packet for MQTT 3.1.1, with the packet type and
+// flags from the fixed header and the variable header and payload as body
+type MQTTPacket struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	MQTT_CONNECT    = 1
+	MQTT_CONNACK    = 2
+	MQTT_PUBLISH    = 3
+	MQTT_PUBACK     = 4
+	MQTT_SUBSCRIBE  = 8
+	MQTT_SUBACK     = 9
+	MQTT_PINGREQ    = 12
+	MQTT_PINGRESP   = 13
+	MQTT_DISCONNECT = 14
+)
+
+const (
+	// Maximum packet length which can be encoded in the fixed header
+	MQTT_MAX_LENGTH = 268435455
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// READ AND WRITE
+
+// ReadMQTTPacket reads a control packet
+func ReadMQTTPacket(r *bufio.Reader) (*MQTTPacket, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, gopi.ErrUnexpectedResponse.WithPrefix("ReadMQTTPacket")
+		} else if b, err := r.ReadByte(); err != nil {
+			return nil, err
+		} else {
+			length += int(b&0x7F) * multiplier
+			multiplier *= 128
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+	packet := &MQTTPacket{Type: header >> 4, Flags: header & 0x0F, Body: make([]byte, length)}
+	if _, err := io.ReadFull(r, packet.Body); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// Write writes the control packet
+func (this *MQTTPacket) Write(w io.Writer) error {
+	length := len(this.Body)
+	if length > MQTT_MAX_LENGTH {
+		return gopi.ErrBadParameter.WithPrefix("MQTTPacket")
+	}
+	data := make([]byte, 0, length+5)
+	data = append(data, this.Type<<4|this.Flags&0x0F)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		data = append(data, b)
+		if length == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(data, this.Body...))
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// ENCODE AND DECODE
+
+// AppendMQTTString appends a length-prefixed string
+func AppendMQTTString(data []byte, value string) []byte {
+	return append(AppendMQTTUint16(data, uint16(len(value))), value...)
+}
+
+// AppendMQTTUint16 appends a big-endian uint16
+func AppendMQTTUint16(data []byte, value uint16) []byte {
+	return append(data, byte(value>>8), byte(value))
+}
+
+// ReadMQTTString returns a length-prefixed string and the remaining data
+func ReadMQTTString(data []byte) (string, []byte, error) {
+	if value, data, err := ReadMQTTUint16(data); err != nil {
+		return "", nil, err
+	} else if len(data) < int(value) {
+		return "", nil, gopi.ErrUnexpectedResponse.WithPrefix("ReadMQTTString")
+	} else {
+		return string(data[:value]), data[value:], nil
+	}
+}
+
+// ReadMQTTUint16 returns a big-endian uint16 and the remaining data
+func ReadMQTTUint16(data []byte) (uint16, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, gopi.ErrUnexpectedResponse.WithPrefix("ReadMQTTUint16")
+	} else {
+		return binary.BigEndian.Uint16(data), data[2:], nil
+	}
+}
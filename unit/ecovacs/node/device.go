@@ -0,0 +1,377 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package node
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// device represents an ecovacs robot, and implements
+// mutablehome.PowerTrait, mutablehome.BatteryTrait and
+// mutablehome.VacuumTrait
+type device struct {
+	sync.Mutex
+
+	device   mutablehome.EvovacsDevice
+	battery  float32
+	mode     mutablehome.VacuumMode
+	suction  mutablehome.VacuumSuction
+	charge   string
+	lifespan map[string]float32
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBAL VARIABLES
+
+var (
+	// Consumable parts which are requested on refresh
+	parts = []mutablehome.EcovacsPart{
+		mutablehome.ECOVACS_PART_BRUSH,
+		mutablehome.ECOVACS_PART_SIDEBRUSH,
+		mutablehome.ECOVACS_PART_DUSTFILTER,
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func NewDevice(value mutablehome.EvovacsDevice) *device {
+	this := new(device)
+	this.device = value
+	this.lifespan = make(map[string]float32)
+	return this
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.Device
+
+func (this *device) Id() string {
+	return this.device.Id()
+}
+
+func (this *device) Name() string {
+	if name := this.device.Nickname(); name != "" {
+		return name
+	} else {
+		return this.device.Id()
+	}
+}
+
+func (this *device) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{
+		mutablehome.TRAIT_POWER_ON,
+		mutablehome.TRAIT_POWER_OFF,
+		mutablehome.TRAIT_POWER_STANDBY,
+		mutablehome.TRAIT_POWER_TOGGLE,
+		mutablehome.TRAIT_BATTERY_LEVEL,
+		mutablehome.TRAIT_VACUUM_CLEAN_MODE,
+		mutablehome.TRAIT_VACUUM_SUCTION,
+		mutablehome.TRAIT_VACUUM_CHARGE,
+		mutablehome.TRAIT_VACUUM_LIFESPAN,
+	}
+}
+
+func (this *device) Class() mutablehome.DeviceClass {
+	return mutablehome.DEVICE_CLASS_VACUUM
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.PowerTrait
+
+// Power returns ON when cleaning, OFF when returning to the dock or
+// charging and STANDBY when stopped
+func (this *device) Power() mutablehome.TraitType {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.power()
+}
+
+// SetPower starts cleaning when ON, returns to the dock when OFF
+// and stops cleaning when STANDBY
+func (this *device) SetPower(value mutablehome.TraitType) error {
+	switch value {
+	case mutablehome.TRAIT_POWER_ON:
+		return this.Clean(mutablehome.VACUUM_MODE_AUTO, mutablehome.VACUUM_SUCTION_NONE)
+	case mutablehome.TRAIT_POWER_OFF:
+		return this.Dock()
+	case mutablehome.TRAIT_POWER_STANDBY:
+		return this.Clean(mutablehome.VACUUM_MODE_STOP, mutablehome.VACUUM_SUCTION_NONE)
+	case mutablehome.TRAIT_POWER_TOGGLE:
+		if this.Power() == mutablehome.TRAIT_POWER_ON {
+			return this.Dock()
+		} else {
+			return this.Clean(mutablehome.VACUUM_MODE_AUTO, mutablehome.VACUUM_SUCTION_NONE)
+		}
+	default:
+		return gopi.ErrBadParameter.WithPrefix(fmt.Sprint(value))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.BatteryTrait
+
+func (this *device) BatteryLevel() float32 {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.battery
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.VacuumTrait
+
+func (this *device) CleanMode() mutablehome.VacuumMode {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.mode
+}
+
+func (this *device) Suction() mutablehome.VacuumSuction {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.suction
+}
+
+func (this *device) Charging() bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.charging()
+}
+
+func (this *device) LifeSpan() map[string]float32 {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	lifespan := make(map[string]float32, len(this.lifespan))
+	for part, value := range this.lifespan {
+		lifespan[part] = value
+	}
+	return lifespan
+}
+
+// Clean starts cleaning with a mode and suction, where the current
+// suction is used when suction is NONE, and then requests the clean state
+func (this *device) Clean(mode mutablehome.VacuumMode, suction mutablehome.VacuumSuction) error {
+	if suction == mutablehome.VACUUM_SUCTION_NONE {
+		if suction = this.Suction(); suction == mutablehome.VACUUM_SUCTION_NONE {
+			suction = mutablehome.VACUUM_SUCTION_STANDARD
+		}
+	}
+	if mode_, err := ecovacsMode(mode); err != nil {
+		return err
+	} else if suction_, err := ecovacsSuction(suction); err != nil {
+		return err
+	} else if _, err := this.device.Clean(mode_, suction_); err != nil {
+		return err
+	} else if _, err := this.device.GetCleanState(); err != nil {
+		return err
+	}
+
+	// Success
+	return nil
+}
+
+// Dock returns to the dock and then requests the charge state
+func (this *device) Dock() error {
+	if _, err := this.device.Charge(); err != nil {
+		return err
+	} else if _, err := this.device.GetChargeState(); err != nil {
+		return err
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Refresh requests battery level, charge and clean state and the
+// lifespan of consumable parts from the device
+func (this *device) Refresh() error {
+	if _, err := this.device.GetBatteryInfo(); err != nil {
+		return err
+	} else if _, err := this.device.GetChargeState(); err != nil {
+		return err
+	} else if _, err := this.device.GetCleanState(); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := this.device.GetLifeSpan(part); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// Set updates state from the value of an ecovacs event and returns
+// the traits which have changed
+func (this *device) Set(t mutablehome.EcovacsEventType, value interface{}) []mutablehome.TraitType {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	power := this.power()
+	traits := make([]mutablehome.TraitType, 0, 3)
+	switch t {
+	case mutablehome.ECOVACS_EVENT_BATTERYLEVEL:
+		if level, ok := value.(uint); ok {
+			if battery := float32(level) / 100; battery != this.battery {
+				this.battery = battery
+				traits = append(traits, mutablehome.TRAIT_BATTERY_LEVEL)
+			}
+		}
+	case mutablehome.ECOVACS_EVENT_CLEANSTATE:
+		if values, ok := value.([]interface{}); ok && len(values) == 2 {
+			if mode, ok := values[0].(mutablehome.EcovacsCleanMode); ok && vacuumMode(mode) != this.mode {
+				this.mode = vacuumMode(mode)
+				traits = append(traits, mutablehome.TRAIT_VACUUM_CLEAN_MODE)
+			}
+			if suction, ok := values[1].(mutablehome.EcovacsCleanSuction); ok && vacuumSuction(suction) != this.suction {
+				this.suction = vacuumSuction(suction)
+				traits = append(traits, mutablehome.TRAIT_VACUUM_SUCTION)
+			}
+		}
+	case mutablehome.ECOVACS_EVENT_CHARGESTATE:
+		if charge, ok := value.(string); ok && strings.ToLower(charge) != this.charge {
+			this.charge = strings.ToLower(charge)
+			traits = append(traits, mutablehome.TRAIT_VACUUM_CHARGE)
+		}
+	case mutablehome.ECOVACS_EVENT_LIFESPAN:
+		if values, ok := value.([]interface{}); ok && len(values) == 3 {
+			part, _ := values[0].(mutablehome.EcovacsPart)
+			val, _ := values[1].(uint)
+			total, _ := values[2].(uint)
+			if key := strings.ToLower(string(part)); key != "" && total > 0 {
+				if lifespan := float32(val) / float32(total); lifespan != this.lifespan[key] {
+					this.lifespan[key] = lifespan
+					traits = append(traits, mutablehome.TRAIT_VACUUM_LIFESPAN)
+				}
+			}
+		}
+	}
+
+	// Power is derived from clean and charge state
+	if other := this.power(); other != power && other != mutablehome.TRAIT_NONE {
+		traits = append([]mutablehome.TraitType{other}, traits...)
+	}
+
+	return traits
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *device) String() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	str := "<ecovacs.Device" +
+		" id=" + strconv.Quote(this.device.Id()) +
+		" name=" + strconv.Quote(this.device.Nickname())
+	if this.mode != mutablehome.VACUUM_MODE_NONE {
+		str += " mode=" + fmt.Sprint(this.mode)
+	}
+	if this.suction != mutablehome.VACUUM_SUCTION_NONE {
+		str += " suction=" + fmt.Sprint(this.suction)
+	}
+	if this.charge != "" {
+		str += " charge=" + strconv.Quote(this.charge)
+	}
+	return str + " battery=" + fmt.Sprint(this.battery) + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// charging returns true when docked and charging. The lock should be held
+func (this *device) charging() bool {
+	return this.charge == "slotcharging" || this.charge == "wirecharging"
+}
+
+// power returns the power state. The lock should be held
+func (this *device) power() mutablehome.TraitType {
+	switch {
+	case this.charging(), this.charge == "going":
+		return mutablehome.TRAIT_POWER_OFF
+	case this.mode == mutablehome.VACUUM_MODE_STOP:
+		return mutablehome.TRAIT_POWER_STANDBY
+	case this.mode != mutablehome.VACUUM_MODE_NONE:
+		return mutablehome.TRAIT_POWER_ON
+	case this.charge == "idle":
+		return mutablehome.TRAIT_POWER_STANDBY
+	default:
+		return mutablehome.TRAIT_NONE
+	}
+}
+
+func vacuumMode(mode mutablehome.EcovacsCleanMode) mutablehome.VacuumMode {
+	switch mode {
+	case mutablehome.ECOVACS_CLEAN_STOP:
+		return mutablehome.VACUUM_MODE_STOP
+	case mutablehome.ECOVACS_CLEAN_AUTO:
+		return mutablehome.VACUUM_MODE_AUTO
+	case mutablehome.ECOVACS_CLEAN_BORDER:
+		return mutablehome.VACUUM_MODE_BORDER
+	case mutablehome.ECOVACS_CLEAN_SPOT:
+		return mutablehome.VACUUM_MODE_SPOT
+	case mutablehome.ECOVACS_CLEAN_ROOM:
+		return mutablehome.VACUUM_MODE_ROOM
+	default:
+		return mutablehome.VACUUM_MODE_NONE
+	}
+}
+
+func ecovacsMode(mode mutablehome.VacuumMode) (mutablehome.EcovacsCleanMode, error) {
+	switch mode {
+	case mutablehome.VACUUM_MODE_STOP:
+		return mutablehome.ECOVACS_CLEAN_STOP, nil
+	case mutablehome.VACUUM_MODE_AUTO:
+		return mutablehome.ECOVACS_CLEAN_AUTO, nil
+	case mutablehome.VACUUM_MODE_BORDER:
+		return mutablehome.ECOVACS_CLEAN_BORDER, nil
+	case mutablehome.VACUUM_MODE_SPOT:
+		return mutablehome.ECOVACS_CLEAN_SPOT, nil
+	case mutablehome.VACUUM_MODE_ROOM:
+		return mutablehome.ECOVACS_CLEAN_ROOM, nil
+	default:
+		return "", gopi.ErrBadParameter.WithPrefix(fmt.Sprint(mode))
+	}
+}
+
+func vacuumSuction(suction mutablehome.EcovacsCleanSuction) mutablehome.VacuumSuction {
+	switch suction {
+	case mutablehome.ECOVACS_SUCTION_STANDARD:
+		return mutablehome.VACUUM_SUCTION_STANDARD
+	case mutablehome.ECOVACS_SUCTION_STRONG:
+		return mutablehome.VACUUM_SUCTION_STRONG
+	default:
+		return mutablehome.VACUUM_SUCTION_NONE
+	}
+}
+
+func ecovacsSuction(suction mutablehome.VacuumSuction) (mutablehome.EcovacsCleanSuction, error) {
+	switch suction {
+	case mutablehome.VACUUM_SUCTION_STANDARD:
+		return mutablehome.ECOVACS_SUCTION_STANDARD, nil
+	case mutablehome.VACUUM_SUCTION_STRONG:
+		return mutablehome.ECOVACS_SUCTION_STRONG, nil
+	default:
+		return "", gopi.ErrBadParameter.WithPrefix(fmt.Sprint(suction))
+	}
+}
@@ -0,0 +1,258 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type node struct {
+	base.Unit
+	base.PubSub
+	sync.Mutex
+
+	id        string
+	ecovacs   mutablehome.Ecovacs
+	connected bool
+	devices   map[string]*device
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	DEFAULT_ID = "ecovacs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (this *node) Init(config Node) error {
+	// Set up ecovacs
+	if config.Ecovacs == nil {
+		return gopi.ErrBadParameter.WithPrefix("ecovacs")
+	} else {
+		this.ecovacs = config.Ecovacs
+	}
+
+	// Set node identifier
+	if config.Id == "" {
+		this.id = DEFAULT_ID
+	} else {
+		this.id = config.Id
+	}
+
+	// Receive events from devices
+	if config.Bus != nil {
+		if err := config.Bus.NewHandler(gopi.EventHandler{
+			Name:    "ecovacs.Event",
+			Handler: this.EventHandler,
+		}); err != nil {
+			return err
+		}
+	}
+
+	this.devices = make(map[string]*device)
+
+	// Success
+	return nil
+}
+
+func (this *node) Close() error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Unsubscribe any listeners
+	if err := this.PubSub.Close(); err != nil {
+		return err
+	}
+
+	// Release resources
+	this.devices = nil
+	this.ecovacs = nil
+
+	// Success
+	return this.Unit.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *node) String() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return "<" + this.Log.Name() +
+		" id=" + strconv.Quote(this.id) +
+		" connected=" + fmt.Sprint(this.connected) +
+		" devices=" + fmt.Sprint(len(this.devices)) +
+		">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONNECT AND DISCONNECT
+
+// Connect authenticates, adds devices for the account and starts
+// reading messages from them
+func (this *node) Connect() error {
+	this.Mutex.Lock()
+	if this.connected {
+		this.Mutex.Unlock()
+		return gopi.ErrOutOfOrder.WithPrefix("Connect")
+	}
+	devices, err := this.devicesForAccount()
+	if err != nil {
+		this.Mutex.Unlock()
+		return err
+	}
+	evts := make([]mutablehome.Event, 0, len(devices))
+	for _, device := range devices {
+		if _, exists := this.devices[device.Id()]; exists == false {
+			this.devices[device.Id()] = device
+			evts = append(evts, this.NewDeviceEvent(mutablehome.EVENT_DEVICE_ADDED, device))
+		}
+	}
+	this.connected = true
+	this.Mutex.Unlock()
+
+	// Emit events without holding the lock
+	for _, evt := range evts {
+		this.Emit(evt)
+	}
+
+	// Connect devices and request their state
+	for _, device := range devices {
+		if err := this.ecovacs.Connect(device.device); err != nil {
+			return err
+		} else if err := device.Refresh(); err != nil {
+			this.Log.Warn(device.Id(), err)
+		}
+	}
+	this.Emit(this.NewNodeEvent(mutablehome.EVENT_NODE_ONLINE))
+
+	// Success
+	return nil
+}
+
+// Disconnect stops reading messages from devices
+func (this *node) Disconnect() error {
+	this.Mutex.Lock()
+	devices := make([]*device, 0, len(this.devices))
+	for _, device := range this.devices {
+		devices = append(devices, device)
+	}
+	this.connected = false
+	this.Mutex.Unlock()
+
+	errs := gopi.NewCompoundError()
+	for _, device := range devices {
+		errs.Add(this.ecovacs.Disconnect(device.device))
+	}
+	this.Emit(this.NewNodeEvent(mutablehome.EVENT_NODE_OFFLINE))
+	return errs.ErrorOrSelf()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.Node
+
+func (this *node) Id() string {
+	return this.id
+}
+
+func (this *node) Name() string {
+	return "Ecovacs Deebot"
+}
+
+func (this *node) Device(id string) mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device, exists := this.devices[id]; exists == false {
+		return nil
+	} else {
+		return device
+	}
+}
+
+func (this *node) Devices() []mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	devices := make([]mutablehome.Device, 0, len(this.devices))
+	for _, device := range this.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Id() < devices[j].Id()
+	})
+	return devices
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EVENT HANDLERS
+
+// EventHandler receives events from devices on the bus
+func (this *node) EventHandler(_ context.Context, _ gopi.App, evt gopi.Event) {
+	if evt_, ok := evt.(mutablehome.EcovacsEvent); ok {
+		if evt := this.ProcessEvent(evt_); evt != nil {
+			this.Emit(evt)
+		}
+	}
+}
+
+// ProcessEvent updates the state of a device from an ecovacs event
+// and returns an event to emit if traits have changed, or nil
+func (this *node) ProcessEvent(evt mutablehome.EcovacsEvent) mutablehome.Event {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if evt.Device() == nil {
+		return nil
+	} else if device, exists := this.devices[evt.Device().Id()]; exists == false {
+		return nil
+	} else if traits := device.Set(evt.Type(), evt.Value()); len(traits) == 0 {
+		return nil
+	} else {
+		return this.NewDeviceEvent(mutablehome.EVENT_DEVICE_TRAIT_CHANGED, device, traits...)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// devicesForAccount authenticates and returns devices for the account,
+// reusing existing devices. The lock should be held by the caller
+func (this *node) devicesForAccount() ([]*device, error) {
+	if err := this.ecovacs.Authenticate(); err != nil {
+		return nil, err
+	} else if devices, err := this.ecovacs.Devices(); err != nil {
+		return nil, err
+	} else {
+		result := make([]*device, 0, len(devices))
+		for _, d := range devices {
+			if device, exists := this.devices[d.Id()]; exists {
+				result = append(result, device)
+			} else {
+				result = append(result, NewDevice(d))
+			}
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,231 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// ACCOUNT, DEVICES AND EVENTS
+
+type account struct {
+	devices   []mutablehome.EvovacsDevice
+	connected []mutablehome.EvovacsDevice
+}
+
+func (this *account) Authenticate() error                           { return nil }
+func (this *account) Devices() ([]mutablehome.EvovacsDevice, error) { return this.devices, nil }
+func (this *account) Connect(d mutablehome.EvovacsDevice) error {
+	this.connected = append(this.connected, d)
+	return nil
+}
+func (this *account) Disconnect(mutablehome.EvovacsDevice) error { return nil }
+func (this *account) Close() error                               { return nil }
+func (this *account) String() string                             { return "<account>" }
+
+type robot struct {
+	sync.Mutex
+	id       string
+	requests []string
+}
+
+func (this *robot) request(value string) (string, error) {
+	this.Lock()
+	defer this.Unlock()
+	this.requests = append(this.requests, value)
+	return value, nil
+}
+
+func (this *robot) Address() string  { return this.id + "@ls1ok3.ecorobot.net/atom" }
+func (this *robot) Nickname() string { return "Deebot" }
+func (this *robot) Id() string       { return this.id }
+func (this *robot) GetBatteryInfo() (string, error) {
+	return this.request("battery")
+}
+func (this *robot) GetLifeSpan(part mutablehome.EcovacsPart) (string, error) {
+	return this.request("lifespan " + string(part))
+}
+func (this *robot) GetChargeState() (string, error) { return this.request("chargestate") }
+func (this *robot) GetCleanState() (string, error)  { return this.request("cleanstate") }
+func (this *robot) GetVersion() (string, error)     { return this.request("version") }
+func (this *robot) Clean(mode mutablehome.EcovacsCleanMode, suction mutablehome.EcovacsCleanSuction) (string, error) {
+	return this.request("clean " + string(mode) + " " + string(suction))
+}
+func (this *robot) Charge() (string, error) { return this.request("charge") }
+func (this *robot) ResetLifeSpan(part mutablehome.EcovacsPart) (string, error) {
+	return this.request("reset " + string(part))
+}
+func (this *robot) GetMapM() (string, error) { return this.request("map") }
+func (this *robot) PullMP(piece uint) (string, error) {
+	return this.request("mappiece " + fmt.Sprint(piece))
+}
+func (this *robot) GetPos() (string, error)        { return this.request("position") }
+func (this *robot) GetChargerPos() (string, error) { return this.request("chargerposition") }
+func (this *robot) GetCleanSum() (string, error)   { return this.request("cleansum") }
+func (this *robot) GetCleanLogs(count uint) (string, error) {
+	return this.request("cleanlogs " + fmt.Sprint(count))
+}
+func (this *robot) Map() mutablehome.EcovacsMap { return nil }
+func (this *robot) GetSched() (string, error)   { return this.request("schedules") }
+func (this *robot) SetSched(schedule mutablehome.EcovacsSchedule) (string, error) {
+	return this.request("schedule " + schedule.Name)
+}
+func (this *robot) DelSched(name string) (string, error) { return this.request("unschedule " + name) }
+func (this *robot) GetBlockTime() (string, error)        { return this.request("dnd") }
+func (this *robot) SetBlockTime(dnd mutablehome.EcovacsDND) (string, error) {
+	return this.request("dnd " + fmt.Sprint(dnd.Enabled))
+}
+
+type ecovacsEvent struct {
+	t      mutablehome.EcovacsEventType
+	device mutablehome.EvovacsDevice
+	value  interface{}
+}
+
+func (*ecovacsEvent) Name() string                            { return "ecovacs.Event" }
+func (*ecovacsEvent) NS() gopi.EventNS                        { return gopi.EVENT_NS_DEFAULT }
+func (*ecovacsEvent) Source() gopi.Unit                       { return nil }
+func (*ecovacsEvent) Id() string                              { return "" }
+func (this *ecovacsEvent) Value() interface{}                 { return this.value }
+func (this *ecovacsEvent) Type() mutablehome.EcovacsEventType { return this.t }
+func (this *ecovacsEvent) Device() mutablehome.EvovacsDevice  { return this.device }
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Node_000(t *testing.T) {
+	t.Log("Test_Node_000")
+}
+
+func Test_Node_001(t *testing.T) {
+	for mode := mutablehome.VACUUM_MODE_STOP; mode <= mutablehome.VACUUM_MODE_MAX; mode++ {
+		if mode_, err := ecovacsMode(mode); err != nil {
+			t.Error(err)
+		} else if vacuumMode(mode_) != mode {
+			t.Error("Unexpected round trip value for", mode)
+		}
+	}
+	for suction := mutablehome.VACUUM_SUCTION_STANDARD; suction <= mutablehome.VACUUM_SUCTION_MAX; suction++ {
+		if suction_, err := ecovacsSuction(suction); err != nil {
+			t.Error(err)
+		} else if vacuumSuction(suction_) != suction {
+			t.Error("Unexpected round trip value for", suction)
+		}
+	}
+	if _, err := ecovacsMode(mutablehome.VACUUM_MODE_NONE); err == nil {
+		t.Error("Expected error for VACUUM_MODE_NONE")
+	}
+}
+
+func Test_Node_002(t *testing.T) {
+	// Power is derived from clean and charge state
+	device := NewDevice(&robot{id: "E0001"})
+	if device.Power() != mutablehome.TRAIT_NONE {
+		t.Error("Unexpected power", device.Power())
+	}
+	clean := []interface{}{mutablehome.ECOVACS_CLEAN_AUTO, mutablehome.ECOVACS_SUCTION_STRONG}
+	if traits := device.Set(mutablehome.ECOVACS_EVENT_CLEANSTATE, clean); len(traits) != 3 {
+		t.Error("Unexpected traits", traits)
+	} else if traits[0] != mutablehome.TRAIT_POWER_ON || traits[1] != mutablehome.TRAIT_VACUUM_CLEAN_MODE || traits[2] != mutablehome.TRAIT_VACUUM_SUCTION {
+		t.Error("Unexpected traits", traits)
+	} else if device.CleanMode() != mutablehome.VACUUM_MODE_AUTO || device.Suction() != mutablehome.VACUUM_SUCTION_STRONG {
+		t.Error("Unexpected state", device)
+	}
+	if traits := device.Set(mutablehome.ECOVACS_EVENT_CLEANSTATE, clean); len(traits) != 0 {
+		t.Error("Unexpected traits", traits)
+	}
+	if traits := device.Set(mutablehome.ECOVACS_EVENT_CHARGESTATE, "SlotCharging"); len(traits) != 2 || traits[0] != mutablehome.TRAIT_POWER_OFF {
+		t.Error("Unexpected traits", traits)
+	} else if device.Charging() == false {
+		t.Error("Expected charging")
+	}
+	if traits := device.Set(mutablehome.ECOVACS_EVENT_BATTERYLEVEL, uint(80)); len(traits) != 1 || device.BatteryLevel() != 0.8 {
+		t.Error("Unexpected traits", traits)
+	}
+	lifespan := []interface{}{mutablehome.ECOVACS_PART_BRUSH, uint(25), uint(100)}
+	if traits := device.Set(mutablehome.ECOVACS_EVENT_LIFESPAN, lifespan); len(traits) != 1 || traits[0] != mutablehome.TRAIT_VACUUM_LIFESPAN {
+		t.Error("Unexpected traits", traits)
+	} else if device.LifeSpan()["brush"] != 0.25 {
+		t.Error("Unexpected lifespan", device.LifeSpan())
+	}
+}
+
+func Test_Node_003(t *testing.T) {
+	// Devices are added on connect and commands map onto clean and charge
+	robot := &robot{id: "E0001"}
+	account := &account{devices: []mutablehome.EvovacsDevice{robot}}
+	RunWithNode(t, Node{Ecovacs: account}, func(node *node, t *testing.T) {
+		evts := node.Subscribe()
+		received := make(chan []mutablehome.Event)
+		go func() {
+			result := []mutablehome.Event{}
+			for evt := range evts {
+				result = append(result, evt.(mutablehome.Event))
+			}
+			received <- result
+		}()
+
+		if err := node.Connect(); err != nil {
+			t.Fatal(err)
+		} else if err := node.Connect(); err == nil {
+			t.Error("Expected error connecting twice")
+		} else if len(account.connected) != 1 {
+			t.Error("Unexpected connected devices", account.connected)
+		}
+		device := node.Device("E0001")
+		if device == nil {
+			t.Fatal("Missing device")
+		} else if node.Device("E0002") != nil {
+			t.Error("Unexpected device")
+		} else if _, ok := device.(mutablehome.VacuumTrait); ok == false {
+			t.Error("Expected VacuumTrait")
+		}
+		if evt := node.ProcessEvent(&ecovacsEvent{mutablehome.ECOVACS_EVENT_BATTERYLEVEL, robot, uint(50)}); evt == nil {
+			t.Error("Expected event")
+		} else if evt.Type() != mutablehome.EVENT_DEVICE_TRAIT_CHANGED || evt.Device() != device {
+			t.Error("Unexpected event", evt)
+		}
+
+		// Commands
+		robot.requests = nil
+		if err := device.(mutablehome.PowerTrait).SetPower(mutablehome.TRAIT_POWER_ON); err != nil {
+			t.Error(err)
+		} else if err := device.(mutablehome.PowerTrait).SetPower(mutablehome.TRAIT_POWER_OFF); err != nil {
+			t.Error(err)
+		} else if len(robot.requests) != 4 || robot.requests[0] != "clean auto standard" || robot.requests[2] != "charge" {
+			t.Error("Unexpected requests", robot.requests)
+		}
+
+		node.Unsubscribe(evts)
+		if result := <-received; len(result) != 2 {
+			t.Error("Unexpected events", result)
+		} else if result[0].Type() != mutablehome.EVENT_DEVICE_ADDED || result[1].Type() != mutablehome.EVENT_NODE_ONLINE {
+			t.Error("Unexpected events", result)
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RUN
+
+func RunWithNode(t *testing.T, config Node, main func(*node, *testing.T)) {
+	t.Helper()
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(config, app.Log().Clone(config.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(unit.(*node), t)
+	}, nil); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
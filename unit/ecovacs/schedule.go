@@ -0,0 +1,157 @@
+package ecovacs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	home "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	reTimeOfDay = regexp.MustCompile("^(\\d{1,2}):(\\d{2})$")
+	weekdays    = map[string]time.Weekday{
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TIME OF DAY
+
+// ParseTimeOfDay parses HH:MM as a duration since midnight
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	if match := reTimeOfDay.FindStringSubmatch(strings.TrimSpace(value)); match == nil {
+		return 0, gopi.ErrBadParameter.WithPrefix(value)
+	} else if hour, _ := strconv.ParseUint(match[1], 10, 32); hour > 23 {
+		return 0, gopi.ErrBadParameter.WithPrefix(value)
+	} else if minute, _ := strconv.ParseUint(match[2], 10, 32); minute > 59 {
+		return 0, gopi.ErrBadParameter.WithPrefix(value)
+	} else {
+		return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+	}
+}
+
+// FormatTimeOfDay returns a duration since midnight as HH:MM
+func FormatTimeOfDay(value time.Duration) string {
+	value = value.Truncate(time.Minute) % (24 * time.Hour)
+	return fmt.Sprintf("%02d:%02d", value/time.Hour, (value%time.Hour)/time.Minute)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// WEEKDAYS
+
+// ParseWeekdays parses a comma-separated list of days (mon, tuesday, ...)
+// or one of daily, weekdays, weekends or once. Days are returned in order
+// from Sunday
+func ParseWeekdays(value string) ([]time.Weekday, error) {
+	days := make(map[time.Weekday]bool)
+	for _, field := range strings.Split(strings.ToLower(value), ",") {
+		switch field = strings.TrimSpace(field); field {
+		case "", "once":
+			continue
+		case "daily":
+			for _, day := range weekdays {
+				days[day] = true
+			}
+		case "weekdays":
+			for day := time.Monday; day <= time.Friday; day++ {
+				days[day] = true
+			}
+		case "weekends":
+			days[time.Saturday] = true
+			days[time.Sunday] = true
+		default:
+			if len(field) < 3 {
+				return nil, gopi.ErrBadParameter.WithPrefix(field)
+			} else if day, exists := weekdays[field[:3]]; exists == false {
+				return nil, gopi.ErrBadParameter.WithPrefix(field)
+			} else if strings.HasPrefix(strings.ToLower(day.String()), field) == false {
+				return nil, gopi.ErrBadParameter.WithPrefix(field)
+			} else {
+				days[day] = true
+			}
+		}
+	}
+	result := make([]time.Weekday, 0, len(days))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if days[day] {
+			result = append(result, day)
+		}
+	}
+	return result, nil
+}
+
+// FormatWeekdays returns days as a comma-separated list, or "once"
+// when there are no days
+func FormatWeekdays(days []time.Weekday) string {
+	if len(days) == 0 {
+		return "once"
+	}
+	fields := make([]string, 0, len(days))
+	for _, day := range days {
+		fields = append(fields, strings.ToLower(day.String()[:3]))
+	}
+	return strings.Join(fields, ",")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// repeatForWeekdays returns the repeat attribute for a schedule, which
+// is seven digits from Sunday, with 1 indicating the schedule repeats
+func repeatForWeekdays(days []time.Weekday) string {
+	repeat := []byte("0000000")
+	for _, day := range days {
+		if day >= time.Sunday && day <= time.Saturday {
+			repeat[day] = '1'
+		}
+	}
+	return string(repeat)
+}
+
+// weekdaysForRepeat returns the days for a repeat attribute
+func weekdaysForRepeat(repeat string) []time.Weekday {
+	days := make([]time.Weekday, 0, 7)
+	for i := 0; i < len(repeat) && i < 7; i++ {
+		if repeat[i] == '1' {
+			days = append(days, time.Weekday(i))
+		}
+	}
+	return days
+}
+
+// checkSchedule returns an error if a schedule can't be stored on a device
+func checkSchedule(schedule home.EcovacsSchedule) error {
+	if schedule.Name == "" {
+		return gopi.ErrBadParameter.WithPrefix("Name")
+	} else if schedule.Time < 0 || schedule.Time >= 24*time.Hour {
+		return gopi.ErrBadParameter.WithPrefix("Time")
+	} else if schedule.Mode == "" || schedule.Mode == home.ECOVACS_CLEAN_STOP {
+		return gopi.ErrBadParameter.WithPrefix("Mode")
+	} else {
+		return nil
+	}
+}
+
+// scheduleXML returns the s element for a schedule
+func scheduleXML(schedule home.EcovacsSchedule) string {
+	enabled := 0
+	if schedule.Enabled {
+		enabled = 1
+	}
+	suction := schedule.Suction
+	if suction == "" {
+		suction = home.ECOVACS_SUCTION_STANDARD
+	}
+	hour, minute := schedule.Time/time.Hour, (schedule.Time%time.Hour)/time.Minute
+	return fmt.Sprintf(`<s n="%s" o="%d" h="%d" m="%d" r="%s"><ctl td="Clean"><clean type="%s" speed="%s"/></ctl></s>`,
+		escapeXML(schedule.Name), enabled, hour, minute, repeatForWeekdays(schedule.Days), escapeXML(string(schedule.Mode)), escapeXML(string(suction)))
+}
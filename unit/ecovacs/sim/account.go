@@ -0,0 +1,164 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// account holds the credentials issued to a user. The default account
+// has an empty email and is used for any login which does not match an
+// account added with AddAccount
+type account struct {
+	email, userId, passwordHash string
+
+	// Issued credentials
+	accessToken, authCode string
+	resource, token       string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// Size of the key which encrypts account and password on login
+	KEY_BITS = 1024
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// ACCOUNTS
+
+// PublicKey returns the key which clients should use to encrypt account
+// and password on login, in place of ecovacs.PUBLIC_KEY. Logins which
+// cannot be decrypted use the default account
+func (this *Backend) PublicKey() *rsa.PublicKey {
+	return &this.key.PublicKey
+}
+
+// AddAccount adds an account with email and password, which has no
+// robots until SetOwner is called
+func (this *Backend) AddAccount(email, password string) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if email == "" {
+		return gopi.ErrBadParameter.WithPrefix("email")
+	} else if _, exists := this.accounts[email]; exists {
+		return gopi.ErrDuplicateItem.WithPrefix(email)
+	} else {
+		this.accounts[email] = newAccount(email, ecovacs.MD5String(password))
+	}
+
+	// Success
+	return nil
+}
+
+// SetOwner moves a robot to the account with email, or to the default
+// account when email is empty. GetDeviceList returns only the robots
+// owned by an account
+func (this *Backend) SetOwner(id, email string) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if robot, exists := this.robots[id]; exists == false {
+		return gopi.ErrNotFound.WithPrefix(id)
+	} else if _, exists := this.accounts[email]; exists == false {
+		return gopi.ErrNotFound.WithPrefix(email)
+	} else {
+		robot.owner = email
+	}
+
+	// Success
+	return nil
+}
+
+// ExpireTokens revokes the credentials issued to all accounts, so that
+// clients need to login again
+func (this *Backend) ExpireTokens() {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	for _, account := range this.accounts {
+		account.accessToken, account.authCode, account.token = "", "", ""
+	}
+}
+
+// Logins returns the number of successful logins with account and
+// password
+func (this *Backend) Logins() uint {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.logins
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func newAccount(email, passwordHash string) *account {
+	return &account{
+		email:        email,
+		userId:       "sim" + newToken(TOKEN_LENGTH/2),
+		passwordHash: passwordHash,
+	}
+}
+
+// login returns the account for the encrypted account and password
+// parameters, or nil if the password is incorrect. The lock should
+// be held
+func (this *Backend) login(email, password string) *account {
+	if email, err := decrypt(this.key, email); err != nil || email == "" {
+		return this.accounts[""]
+	} else if account, exists := this.accounts[email]; exists == false {
+		return this.accounts[""]
+	} else if passwordHash, err := decrypt(this.key, password); err != nil || passwordHash != account.passwordHash {
+		return nil
+	} else {
+		return account
+	}
+}
+
+// accountForUser returns the account with user identifier, or nil. The
+// lock should be held
+func (this *Backend) accountForUser(userId string) *account {
+	for _, account := range this.accounts {
+		if account.userId == userId {
+			return account
+		}
+	}
+	return nil
+}
+
+// accountForToken returns the account with user identifier and the token
+// issued by loginByItToken, or nil. The lock should be held
+func (this *Backend) accountForToken(userId, token string) *account {
+	if account := this.accountForUser(userId); account == nil || account.token == "" || account.token != token {
+		return nil
+	} else {
+		return account
+	}
+}
+
+// decrypt returns the plaintext for a parameter encrypted with
+// ecovacs.Encrypt
+func decrypt(key *rsa.PrivateKey, value string) (string, error) {
+	if data, err := base64.StdEncoding.DecodeString(value); err != nil {
+		return "", err
+	} else if data, err := rsa.DecryptPKCS1v15(rand.Reader, key, data); err != nil {
+		return "", err
+	} else {
+		return string(data), nil
+	}
+}
@@ -0,0 +1,235 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	// Modules
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type mainResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"msg"`
+	Timestamp int64       `json:"time"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+type userRequest struct {
+	Todo     string `json:"todo"`
+	UserId   string `json:"userId"`
+	Token    string `json:"token"`
+	Resource string `json:"resource"`
+	Auth     struct {
+		UserId   string `json:"userid"`
+		Token    string `json:"token"`
+		Resource string `json:"resource"`
+	} `json:"auth"`
+}
+
+type userDevice struct {
+	DeviceId string `json:"did"`
+	Name     string `json:"name"`
+	Class    string `json:"class"`
+	Resource string `json:"resource"`
+	Nickname string `json:"nick"`
+	Company  string `json:"company"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	CODE_OK        = "0000"
+	CODE_SIGNATURE = "0001"
+	CODE_TOKEN     = "0002"
+	CODE_AUTH      = "1005"
+)
+
+const (
+	PATH_MAIN = "/v1/private/"
+	PATH_USER = "/user.do"
+)
+
+var (
+	// Path segments before the endpoint path in MAIN_URL_FORMAT
+	mainKeys = []string{"country", "lang", "deviceId", "appCode", "appVersion", "channel", "deviceType"}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// HANDLERS
+
+func (this *Backend) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PATH_MAIN, this.handleMain)
+	mux.HandleFunc(PATH_USER, this.handleUser)
+	mux.HandleFunc(PATH_PORTAL, this.handlePortal)
+	return mux
+}
+
+// handleMain responds to /user/login and /user/getAuthCode, which
+// are signed with the client key
+func (this *Backend) handleMain(w http.ResponseWriter, req *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(req.URL.Path, PATH_MAIN), "/")
+	if req.Method != http.MethodGet || len(segments) <= len(mainKeys) {
+		http.NotFound(w, req)
+		return
+	}
+
+	// Check signature
+	meta := url.Values{}
+	for i, key := range mainKeys {
+		meta.Set(key, segments[i])
+	}
+	query := req.URL.Query()
+	if verify(meta, query) == false {
+		writeJSON(w, mainResponse{Code: CODE_SIGNATURE, Message: "Invalid signature"})
+		return
+	}
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	switch "/" + strings.Join(segments[len(mainKeys):], "/") {
+	case "/user/login":
+		if this.authError || query.Get("account") == "" || query.Get("password") == "" {
+			writeJSON(w, mainResponse{Code: CODE_AUTH, Message: "Incorrect account or password"})
+		} else if account := this.login(query.Get("account"), query.Get("password")); account == nil {
+			writeJSON(w, mainResponse{Code: CODE_AUTH, Message: "Incorrect account or password"})
+		} else {
+			this.logins++
+			account.accessToken = newToken(TOKEN_LENGTH)
+			writeJSON(w, mainResponse{Code: CODE_OK, Message: "OK", Data: map[string]string{
+				"uid":         account.userId,
+				"username":    account.userId,
+				"email":       account.email,
+				"country":     meta.Get("country"),
+				"accessToken": account.accessToken,
+			}})
+		}
+	case "/user/getAuthCode":
+		if account := this.accountForUser(query.Get("uid")); account == nil || account.accessToken == "" || query.Get("accessToken") != account.accessToken {
+			writeJSON(w, mainResponse{Code: CODE_TOKEN, Message: "Invalid access token"})
+		} else {
+			account.authCode = newToken(TOKEN_LENGTH)
+			writeJSON(w, mainResponse{Code: CODE_OK, Message: "OK", Data: map[string]string{
+				"authCode":   account.authCode,
+				"ecovacsUid": account.userId,
+			}})
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// handleUser responds to loginByItToken and GetDeviceList requests
+func (this *Backend) handleUser(w http.ResponseWriter, req *http.Request) {
+	var request userRequest
+	if req.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	} else if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	switch request.Todo {
+	case "loginByItToken":
+		if account := this.accountForUser(request.UserId); account == nil || account.authCode == "" || request.Token != account.authCode {
+			writeJSON(w, userFailure(3, "Invalid auth code"))
+		} else if request.Resource == "" {
+			writeJSON(w, userFailure(4, "Missing resource"))
+		} else {
+			account.authCode = ""
+			account.resource = request.Resource
+			account.token = newToken(TOKEN_LENGTH)
+			writeJSON(w, map[string]interface{}{
+				"result":   "ok",
+				"userId":   account.userId,
+				"resource": account.resource,
+				"token":    account.token,
+				"last":     time.Now().Unix(),
+			})
+		}
+	case "GetDeviceList":
+		if account := this.accountForToken(request.Auth.UserId, request.Auth.Token); account == nil {
+			writeJSON(w, userFailure(3, "Invalid token"))
+		} else {
+			devices := make([]userDevice, 0, len(this.robots))
+			for _, robot := range this.robots {
+				if robot.owner == account.email {
+					devices = append(devices, robot.Device())
+				}
+			}
+			sort.Slice(devices, func(i, j int) bool {
+				return devices[i].DeviceId < devices[j].DeviceId
+			})
+			writeJSON(w, map[string]interface{}{
+				"result":  "ok",
+				"devices": devices,
+			})
+		}
+	default:
+		writeJSON(w, userFailure(1, fmt.Sprintf("Unsupported todo: %q", request.Todo)))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// verify checks authSign against the parameters and the metadata from
+// the path, in the same way the client signs the request
+func verify(meta, query url.Values) bool {
+	sign := url.Values{}
+	for key := range query {
+		if key != "authAppkey" && key != "authSign" {
+			sign.Set(key, query.Get(key))
+		}
+	}
+	for key := range meta {
+		sign.Set(key, meta.Get(key))
+	}
+	text := ecovacs.CLIENT_KEY
+	for _, key := range ecovacs.SortedKeys(sign) {
+		text += fmt.Sprintf("%s=%s", key, sign.Get(key))
+	}
+	text += ecovacs.SECRET
+	return query.Get("authAppkey") == ecovacs.CLIENT_KEY && query.Get("authSign") == ecovacs.MD5String(text)
+}
+
+func userFailure(errno uint, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"result": "fail",
+		"errno":  errno,
+		"error":  message,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	if response, ok := value.(mainResponse); ok && response.Timestamp == 0 {
+		response.Timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+		value = response
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,441 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strings"
+	"time"
+
+	// Modules
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type jsonPosition struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	A int `json:"a"`
+}
+
+type jsonSchedule struct {
+	Name   string `json:"name"`
+	Enable uint   `json:"enable"`
+	Hour   uint   `json:"hour"`
+	Minute uint   `json:"minute"`
+	Repeat string `json:"repeat"`
+	Type   string `json:"type"`
+	Speed  string `json:"speed,omitempty"`
+}
+
+type jsonLifeSpan struct {
+	Type  string `json:"type"`
+	Left  uint   `json:"left"`
+	Total uint   `json:"total"`
+}
+
+// jsonArgs are the arguments for any JSON command
+type jsonArgs struct {
+	Act        string          `json:"act"`
+	Type       string          `json:"type"`
+	Speed      json.RawMessage `json:"speed"`
+	Mid        string          `json:"mid"`
+	PieceIndex uint            `json:"pieceIndex"`
+	Name       string          `json:"name"`
+	Enable     uint            `json:"enable"`
+	Start      string          `json:"start"`
+	End        string          `json:"end"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	PATH_PORTAL = "/api/iot/devmanager.do"
+)
+
+const (
+	// Error numbers returned by the portal
+	ERRNO_AUTH        = 3
+	ERRNO_UNAVAILABLE = 404
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	// Part names for JSON commands
+	jsonParts = map[string]string{
+		"brush":     "Brush",
+		"sideBrush": "SideBrush",
+		"heap":      "DustCaseHeap",
+	}
+
+	// Speed values for each suction
+	jsonSpeeds = map[string]int{
+		"quiet":    1000,
+		"standard": 0,
+		"strong":   1,
+		"max":      2,
+	}
+
+	// Clean types which differ from the clean mode
+	jsonTypes = map[string]string{
+		"singleroom": "singleRoom",
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// HANDLERS
+
+// handlePortal forwards a JSON command to a robot, and returns the
+// response from the robot
+func (this *Backend) handlePortal(w http.ResponseWriter, req *http.Request) {
+	var request ecovacs.JSONRequest
+	if req.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	} else if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	this.Mutex.Lock()
+	account := this.accountForToken(request.Auth["userid"], request.Auth["token"])
+	robot := this.robots[request.ToId]
+	owned := account != nil && robot != nil && robot.owner == account.email
+	this.Mutex.Unlock()
+
+	if account == nil {
+		writeJSON(w, ecovacs.JSONResponse{Ret: "fail", ErrNo: ERRNO_AUTH, Error: "auth error"})
+		return
+	} else if owned == false || robot.json == false {
+		writeJSON(w, ecovacs.JSONResponse{Ret: "fail", ErrNo: ERRNO_UNAVAILABLE, Error: "RecipientUnavailable"})
+		return
+	}
+
+	// Run command
+	response := ecovacs.JSONResponse{Ret: "ok"}
+	response.Resp.Header = jsonHeader()
+	code, msg, result, reports := robot.JSONCommand(request.CmdName, request.Payload.Body.Data)
+	response.Resp.Body.Code, response.Resp.Body.Msg = code, msg
+	if result != nil {
+		if data, err := json.Marshal(result); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else {
+			response.Resp.Body.Data = data
+		}
+	}
+	writeJSON(w, response)
+
+	// Publish reports
+	this.report(robot, reports)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// COMMANDS
+
+// JSONCommand handles a JSON command and returns the code, message and
+// data for the response, and any reports which should be published as
+// a result
+func (this *robot) JSONCommand(name string, data json.RawMessage) (uint, string, interface{}, []string) {
+	var args jsonArgs
+	var parts []string
+	if len(data) == 0 {
+		// No arguments
+	} else if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &parts); err != nil {
+			return ERRNO_BADREQUEST, "BadRequest", nil, nil
+		}
+	} else if err := json.Unmarshal(data, &args); err != nil {
+		return ERRNO_BADREQUEST, "BadRequest", nil, nil
+	}
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	this.requests = append(this.requests, name)
+	switch name {
+	case "getBattery":
+		isLow := 0
+		if this.battery < 20 {
+			isLow = 1
+		}
+		return 0, "ok", map[string]uint{"value": this.battery, "isLow": uint(isLow)}, nil
+	case "getChargeState":
+		return 0, "ok", this.jsonChargeState(), nil
+	case "getCleanInfo":
+		return 0, "ok", this.jsonCleanInfo(), nil
+	case "getSpeed":
+		return 0, "ok", map[string]int{"speed": jsonSpeeds[this.speed]}, nil
+	case "setSpeed":
+		var value int
+		if err := json.Unmarshal(args.Speed, &value); err != nil {
+			return ERRNO_BADREQUEST, "BadSpeed", nil, nil
+		}
+		for suction, speed := range jsonSpeeds {
+			if speed == value {
+				this.speed = suction
+				return 0, "ok", nil, []string{this.cleanState("CleanReport")}
+			}
+		}
+		return ERRNO_BADREQUEST, "BadSpeed", nil, nil
+	case "getLifeSpan":
+		result := make([]jsonLifeSpan, 0, len(parts))
+		for _, name := range parts {
+			if part, exists := jsonParts[name]; exists == false {
+				return ERRNO_BADREQUEST, "UnknownPart", nil, nil
+			} else {
+				result = append(result, jsonLifeSpan{name, this.lifespan[part], 100})
+			}
+		}
+		return 0, "ok", result, nil
+	case "resetLifeSpan":
+		if part, exists := jsonParts[args.Type]; exists == false {
+			return ERRNO_BADREQUEST, "UnknownPart", nil, nil
+		} else {
+			this.lifespan[part] = 100
+			return 0, "ok", nil, nil
+		}
+	case "clean":
+		switch args.Act {
+		case "start":
+			if args.Type == "" {
+				return ERRNO_BADREQUEST, "BadRequest", nil, nil
+			}
+			this.clean = jsonModeForType(args.Type)
+			this.charge = CHARGE_IDLE
+		case "stop":
+			this.clean = CLEAN_STOP
+		default:
+			return ERRNO_BADREQUEST, "BadRequest", nil, nil
+		}
+		return 0, "ok", nil, []string{this.cleanState("CleanReport"), this.chargeState("ChargeState")}
+	case "charge":
+		if args.Act != "go" {
+			return ERRNO_BADREQUEST, "BadRequest", nil, nil
+		}
+		this.clean = CLEAN_STOP
+		this.charge = CHARGE_GOING
+		return 0, "ok", nil, []string{this.chargeState("ChargeState")}
+	case "getMajorMap":
+		crcs := make([]string, 0, MAP_PIECES*MAP_PIECES)
+		for pid := 0; pid < MAP_PIECES*MAP_PIECES; pid++ {
+			crcs = append(crcs, fmt.Sprint(crc32.ChecksumIEEE(this.piece(pid))))
+		}
+		return 0, "ok", map[string]interface{}{
+			"mid":         this.mapId,
+			"pieceWidth":  MAP_PIECE_SIZE,
+			"pieceHeight": MAP_PIECE_SIZE,
+			"cellWidth":   MAP_PIECES,
+			"cellHeight":  MAP_PIECES,
+			"pixel":       MAP_RESOLUTION,
+			"value":       strings.Join(crcs, ","),
+		}, nil
+	case "getMinorMap":
+		if args.Mid != this.mapId || args.PieceIndex >= MAP_PIECES*MAP_PIECES {
+			return ERRNO_BADREQUEST, "BadPiece", nil, nil
+		}
+		return 0, "ok", map[string]interface{}{
+			"mid":        this.mapId,
+			"type":       "ol",
+			"pieceIndex": args.PieceIndex,
+			"pieceValue": base64.StdEncoding.EncodeToString(compress(this.piece(int(args.PieceIndex)))),
+		}, nil
+	case "getPos":
+		result := make(map[string]interface{})
+		for _, name := range parts {
+			switch name {
+			case "deebotPos":
+				result[name] = jsonPosition{this.position.x, this.position.y, this.position.angle}
+			case "chargePos":
+				result[name] = []jsonPosition{{this.charger.x, this.charger.y, this.charger.angle}}
+			default:
+				return ERRNO_BADREQUEST, "BadRequest", nil, nil
+			}
+		}
+		return 0, "ok", result, nil
+	case "getTotalStats":
+		return 0, "ok", map[string]uint{"area": this.area, "time": this.seconds, "count": uint(len(this.logs))}, nil
+	case "getSched":
+		result := make([]jsonSchedule, 0, len(this.schedules))
+		for _, s := range this.schedules {
+			result = append(result, jsonSchedule{s.Name, s.Enabled, s.Hour, s.Minute, s.Repeat, jsonTypeForMode(s.Ctl.Clean.Type), s.Ctl.Clean.Speed})
+		}
+		return 0, "ok", result, nil
+	case "setSched":
+		var value jsonSchedule
+		if err := json.Unmarshal(data, &value); err != nil {
+			return ERRNO_BADREQUEST, "BadSchedule", nil, nil
+		}
+		s := schedule{Name: value.Name, Enabled: value.Enable, Hour: value.Hour, Minute: value.Minute, Repeat: value.Repeat}
+		s.Ctl.Td = "Clean"
+		s.Ctl.Clean.Type = jsonModeForType(value.Type)
+		s.Ctl.Clean.Speed = value.Speed
+		if s.Name == "" || s.Hour > 23 || s.Minute > 59 || reRepeat.MatchString(s.Repeat) == false || value.Type == "" {
+			return ERRNO_BADREQUEST, "BadSchedule", nil, nil
+		} else if i := this.schedule(s.Name); i >= 0 {
+			this.schedules[i] = s
+		} else {
+			this.schedules = append(this.schedules, s)
+		}
+		return 0, "ok", nil, nil
+	case "delSched":
+		if i := this.schedule(args.Name); i < 0 {
+			return ERRNO_NOTFOUND, "NotFound", nil, nil
+		} else {
+			this.schedules = append(this.schedules[:i], this.schedules[i+1:]...)
+		}
+		return 0, "ok", nil, nil
+	case "getBlock":
+		return 0, "ok", map[string]interface{}{"enable": this.dnd.enabled, "start": this.dnd.start, "end": this.dnd.end}, nil
+	case "setBlock":
+		if args.Enable > 1 || reTime.MatchString(args.Start) == false || reTime.MatchString(args.End) == false {
+			return ERRNO_BADREQUEST, "BadBlockTime", nil, nil
+		} else {
+			this.dnd = dnd{args.Enable, args.Start, args.End}
+		}
+		return 0, "ok", nil, nil
+	default:
+		return ERRNO_UNKNOWN, "UnknownCommand", nil, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// jsonChargeState returns the charge state. The lock should be held
+func (this *robot) jsonChargeState() interface{} {
+	isCharging := 0
+	if this.charge == CHARGE_SLOT {
+		isCharging = 1
+	}
+	return map[string]interface{}{"isCharging": isCharging, "mode": "slot"}
+}
+
+// jsonCleanInfo returns the clean state. The lock should be held
+func (this *robot) jsonCleanInfo() interface{} {
+	switch {
+	case this.charge == CHARGE_GOING:
+		return map[string]interface{}{"trigger": "app", "state": "goCharging"}
+	case this.clean == CLEAN_STOP:
+		return map[string]interface{}{"trigger": "app", "state": "idle"}
+	default:
+		return map[string]interface{}{"trigger": "app", "state": "clean", "cleanState": map[string]string{
+			"type":        jsonTypeForMode(this.clean),
+			"motionState": "working",
+		}}
+	}
+}
+
+// jsonReports returns the JSON reports for a ctl report
+func jsonReports(report string) []jsonEvent {
+	var ctl struct {
+		Td      string `xml:"td,attr"`
+		Type    string `xml:"type,attr"`
+		Val     uint   `xml:"val,attr"`
+		Total   uint   `xml:"total,attr"`
+		P       string `xml:"p,attr"`
+		A       int    `xml:"a,attr"`
+		Errs    string `xml:"errs,attr"`
+		Battery struct {
+			Power uint `xml:"power,attr"`
+		} `xml:"battery"`
+		Charge struct {
+			Type string `xml:"type,attr"`
+		} `xml:"charge"`
+		Clean struct {
+			Type  string `xml:"type,attr"`
+			Speed string `xml:"speed,attr"`
+		} `xml:"clean"`
+	}
+	if err := xml.Unmarshal([]byte(report), &ctl); err != nil {
+		return nil
+	}
+	switch ctl.Td {
+	case "BatteryInfo":
+		return []jsonEvent{{"onBattery", map[string]uint{"value": ctl.Battery.Power}}}
+	case "ChargeState":
+		switch ctl.Charge.Type {
+		case CHARGE_GOING:
+			return []jsonEvent{{"onCleanInfo", map[string]string{"trigger": "app", "state": "goCharging"}}}
+		case CHARGE_SLOT:
+			return []jsonEvent{{"onChargeState", map[string]interface{}{"isCharging": 1, "mode": "slot"}}}
+		default:
+			return []jsonEvent{{"onChargeState", map[string]interface{}{"isCharging": 0, "mode": "slot"}}}
+		}
+	case "CleanReport":
+		info := map[string]interface{}{"trigger": "app", "state": "idle"}
+		if ctl.Clean.Type != CLEAN_STOP {
+			info["state"] = "clean"
+			info["cleanState"] = map[string]string{"type": jsonTypeForMode(ctl.Clean.Type), "motionState": "working"}
+		}
+		return []jsonEvent{
+			{"onSpeed", map[string]int{"speed": jsonSpeeds[ctl.Clean.Speed]}},
+			{"onCleanInfo", info},
+		}
+	case "Pos":
+		var x, y int
+		fmt.Sscanf(ctl.P, "%d,%d", &x, &y)
+		return []jsonEvent{{"onPos", map[string]interface{}{"deebotPos": jsonPosition{x, y, ctl.A}}}}
+	case "LifeSpan":
+		for name, part := range jsonParts {
+			if part == ctl.Type {
+				return []jsonEvent{{"onLifeSpan", []jsonLifeSpan{{name, ctl.Val, ctl.Total}}}}
+			}
+		}
+	case "error":
+		var codes []uint
+		for _, field := range strings.Split(ctl.Errs, ",") {
+			var code uint
+			if _, err := fmt.Sscan(field, &code); err == nil {
+				codes = append(codes, code)
+			}
+		}
+		return []jsonEvent{{"onError", map[string][]uint{"code": codes}}}
+	}
+	return nil
+}
+
+// jsonHeader returns the header for a response or report
+func jsonHeader() map[string]interface{} {
+	return map[string]interface{}{
+		"pri":   1,
+		"tzm":   0,
+		"ts":    fmt.Sprint(time.Now().UnixNano() / int64(time.Millisecond)),
+		"ver":   "0.0.1",
+		"fwVer": DEFAULT_VERSION,
+	}
+}
+
+// jsonTypeForMode returns the clean type for a clean mode
+func jsonTypeForMode(mode string) string {
+	if value, exists := jsonTypes[mode]; exists {
+		return value
+	} else {
+		return mode
+	}
+}
+
+// jsonModeForType returns the clean mode for a clean type
+func jsonModeForType(value string) string {
+	for mode, other := range jsonTypes {
+		if other == value {
+			return mode
+		}
+	}
+	return strings.ToLower(value)
+}
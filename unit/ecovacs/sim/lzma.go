@@ -0,0 +1,114 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"encoding/binary"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// encoder is an LZMA range encoder which only encodes literals. The
+// output is valid LZMA, although it compresses less well than an
+// encoder which finds matches
+type encoder struct {
+	low       uint64
+	range_    uint32
+	cache     byte
+	cacheSize uint
+	out       []byte
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// Properties lc=3 lp=0 pb=2, which are the LZMA defaults
+	LZMA_PROPS     = (2*5+0)*9 + 3
+	LZMA_LC        = 3
+	LZMA_PB        = 2
+	LZMA_DICT_SIZE = 1 << 16
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// COMPRESS
+
+// compress returns data as LZMA with the header used for map pieces,
+// which is the properties, dictionary size and uncompressed size
+func compress(data []byte) []byte {
+	header := make([]byte, 9)
+	header[0] = LZMA_PROPS
+	binary.LittleEndian.PutUint32(header[1:5], LZMA_DICT_SIZE)
+	binary.LittleEndian.PutUint32(header[5:9], uint32(len(data)))
+
+	e := &encoder{range_: 0xFFFFFFFF, cacheSize: 1, out: header}
+	isMatch := make([]uint16, 1<<LZMA_PB)
+	literal := make([]uint16, 0x300<<LZMA_LC)
+	for _, probs := range [][]uint16{isMatch, literal} {
+		for i := range probs {
+			probs[i] = 1 << 10
+		}
+	}
+
+	// State is always zero since only literals are encoded
+	prevByte := byte(0)
+	for pos, b := range data {
+		e.bit(&isMatch[pos&(1<<LZMA_PB-1)], 0)
+		probs := literal[0x300*int(prevByte>>(8-LZMA_LC)):]
+		symbol := uint(1)
+		for i := 7; i >= 0; i-- {
+			bit := uint(b>>uint(i)) & 1
+			e.bit(&probs[symbol], bit)
+			symbol = symbol<<1 | bit
+		}
+		prevByte = b
+	}
+
+	// Flush
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.out
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *encoder) bit(prob *uint16, bit uint) {
+	bound := (this.range_ >> 11) * uint32(*prob)
+	if bit == 0 {
+		this.range_ = bound
+		*prob += ((1 << 11) - *prob) >> 5
+	} else {
+		this.low += uint64(bound)
+		this.range_ -= bound
+		*prob -= *prob >> 5
+	}
+	for this.range_ < 1<<24 {
+		this.range_ <<= 8
+		this.shiftLow()
+	}
+}
+
+func (this *encoder) shiftLow() {
+	if uint32(this.low) < 0xFF000000 || this.low>>32 != 0 {
+		carry := byte(this.low >> 32)
+		temp := this.cache
+		for {
+			this.out = append(this.out, temp+carry)
+			temp = 0xFF
+			if this.cacheSize--; this.cacheSize == 0 {
+				break
+			}
+		}
+		this.cache = byte(this.low >> 24)
+	}
+	this.cacheSize++
+	this.low = uint64(uint32(this.low) << 8)
+}
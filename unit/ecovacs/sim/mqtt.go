@@ -0,0 +1,267 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// client is a connection to the MQTT broker
+type client struct {
+	sync.Mutex
+
+	backend *Backend
+	conn    net.Conn
+	filters []string
+}
+
+// jsonEvent is a report from a robot which accepts JSON commands
+type jsonEvent struct {
+	name string
+	data interface{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// CONNACK return codes
+	CONNACK_ACCEPTED    = 0
+	CONNACK_BADPROTOCOL = 1
+	CONNACK_BADAUTH     = 4
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// ACCEPT
+
+func (this *Backend) mqttAcceptLoop() {
+	defer this.WaitGroup.Done()
+	for {
+		conn, err := this.mqtt.Accept()
+		if err != nil {
+			// Listener has been closed
+			return
+		}
+		this.Mutex.Lock()
+		if this.clients == nil {
+			this.Mutex.Unlock()
+			conn.Close()
+			return
+		}
+		client := &client{backend: this, conn: conn}
+		this.clients[client] = true
+		this.WaitGroup.Add(1)
+		this.Mutex.Unlock()
+
+		go func() {
+			defer this.WaitGroup.Done()
+			client.Run()
+			client.Close()
+			this.Mutex.Lock()
+			defer this.Mutex.Unlock()
+			if this.clients != nil {
+				delete(this.clients, client)
+			}
+		}()
+	}
+}
+
+// publish sends a report from a robot to clients which have subscribed
+// to the topic
+func (this *Backend) publish(robot *robot, event jsonEvent) {
+	this.Mutex.Lock()
+	clients := make([]*client, 0, len(this.clients))
+	for client := range this.clients {
+		clients = append(clients, client)
+	}
+	this.Mutex.Unlock()
+
+	topic := fmt.Sprintf("iot/atr/%s/%s/%s/%s/j", event.name, robot.id, robot.class, DEFAULT_RESOURCE)
+	payload, err := json.Marshal(map[string]interface{}{
+		"header": jsonHeader(),
+		"body": map[string]interface{}{
+			"data": event.data,
+		},
+	})
+	if err != nil {
+		return
+	}
+	for _, client := range clients {
+		client.Publish(topic, payload)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CLIENT
+
+// Run authenticates the client with the user identifier and token
+// issued by loginByItToken, then responds to packets until the client
+// disconnects
+func (this *client) Run() error {
+	reader := bufio.NewReader(this.conn)
+	this.conn.SetReadDeadline(time.Now().Add(HANDSHAKE_TIMEOUT))
+	if err := this.connect(reader); err != nil {
+		return err
+	}
+	this.conn.SetReadDeadline(time.Time{})
+	for {
+		packet, err := ecovacs.ReadMQTTPacket(reader)
+		if err != nil {
+			return err
+		}
+		switch packet.Type {
+		case ecovacs.MQTT_SUBSCRIBE:
+			if err := this.subscribe(packet); err != nil {
+				return err
+			}
+		case ecovacs.MQTT_PINGREQ:
+			if err := this.write(&ecovacs.MQTTPacket{Type: ecovacs.MQTT_PINGRESP}); err != nil {
+				return err
+			}
+		case ecovacs.MQTT_DISCONNECT:
+			return nil
+		case ecovacs.MQTT_PUBACK:
+			continue
+		default:
+			return gopi.ErrUnexpectedResponse.WithPrefix(fmt.Sprint("Packet ", packet.Type))
+		}
+	}
+}
+
+// Publish sends a message with QoS 0 if the client has subscribed to the
+// topic
+func (this *client) Publish(topic string, payload []byte) error {
+	this.Mutex.Lock()
+	filters := this.filters
+	this.Mutex.Unlock()
+	for _, filter := range filters {
+		if matchTopic(filter, topic) {
+			return this.write(&ecovacs.MQTTPacket{
+				Type: ecovacs.MQTT_PUBLISH,
+				Body: append(ecovacs.AppendMQTTString(nil, topic), payload...),
+			})
+		}
+	}
+	return nil
+}
+
+func (this *client) Close() error {
+	return this.conn.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// connect reads CONNECT and checks the credentials
+func (this *client) connect(reader *bufio.Reader) error {
+	packet, err := ecovacs.ReadMQTTPacket(reader)
+	if err != nil {
+		return err
+	} else if packet.Type != ecovacs.MQTT_CONNECT {
+		return gopi.ErrUnexpectedResponse.WithPrefix("CONNECT")
+	}
+
+	// Protocol name, level, flags and keepalive precede the payload
+	protocol, body, err := ecovacs.ReadMQTTString(packet.Body)
+	if err != nil {
+		return err
+	} else if protocol != "MQTT" || len(body) < 4 || body[0] != 4 {
+		return this.connack(CONNACK_BADPROTOCOL)
+	}
+	flags, body := body[1], body[4:]
+	_, body, err = ecovacs.ReadMQTTString(body)
+	if err != nil {
+		return err
+	}
+	var user, password string
+	if flags&0x80 != 0 {
+		if user, body, err = ecovacs.ReadMQTTString(body); err != nil {
+			return err
+		}
+	}
+	if flags&0x40 != 0 {
+		if password, _, err = ecovacs.ReadMQTTString(body); err != nil {
+			return err
+		}
+	}
+
+	// Check credentials
+	this.backend.Mutex.Lock()
+	authenticated := this.backend.accountForToken(user, password) != nil
+	this.backend.Mutex.Unlock()
+	if authenticated == false {
+		this.connack(CONNACK_BADAUTH)
+		return gopi.ErrUnexpectedResponse.WithPrefix("Authentication failed")
+	} else {
+		return this.connack(CONNACK_ACCEPTED)
+	}
+}
+
+func (this *client) connack(code byte) error {
+	return this.write(&ecovacs.MQTTPacket{Type: ecovacs.MQTT_CONNACK, Body: []byte{0, code}})
+}
+
+// subscribe adds topic filters and grants QoS 0 for each
+func (this *client) subscribe(packet *ecovacs.MQTTPacket) error {
+	packetId, body, err := ecovacs.ReadMQTTUint16(packet.Body)
+	if err != nil {
+		return err
+	}
+	granted := ecovacs.AppendMQTTUint16(nil, packetId)
+	for len(body) > 0 {
+		var filter string
+		if filter, body, err = ecovacs.ReadMQTTString(body); err != nil {
+			return err
+		} else if len(body) == 0 {
+			return gopi.ErrUnexpectedResponse.WithPrefix("SUBSCRIBE")
+		} else {
+			body = body[1:]
+		}
+		this.Mutex.Lock()
+		this.filters = append(this.filters, filter)
+		this.Mutex.Unlock()
+		granted = append(granted, 0)
+	}
+	return this.write(&ecovacs.MQTTPacket{Type: ecovacs.MQTT_SUBACK, Body: granted})
+}
+
+func (this *client) write(packet *ecovacs.MQTTPacket) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+	return packet.Write(this.conn)
+}
+
+// matchTopic returns true if a topic matches a filter with single-level
+// (+) and multi-level (#) wildcards
+func matchTopic(filter, topic string) bool {
+	filters, topics := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filters {
+		if level == "#" {
+			return true
+		} else if i >= len(topics) {
+			return false
+		} else if level != "+" && level != topics[i] {
+			return false
+		}
+	}
+	return len(filters) == len(topics)
+}
@@ -0,0 +1,484 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Modules
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type robot struct {
+	sync.Mutex
+
+	id, class, nickname string
+	json                bool
+	battery             uint
+	charge              string
+	clean, speed        string
+	lifespan            map[string]uint
+	version             string
+	requests            []string
+
+	// Email of the account which owns the robot, which is guarded by
+	// the backend lock
+	owner string
+
+	// Map and positions in millimetres from the centre of the map
+	mapId         string
+	cells         []byte
+	position      position
+	charger       position
+	area, seconds uint
+	logs          []cleanLog
+
+	// Schedules in order of creation and do-not-disturb
+	schedules []schedule
+	dnd       dnd
+}
+
+type schedule struct {
+	XMLName xml.Name `xml:"s"`
+	Name    string   `xml:"n,attr"`
+	Enabled uint     `xml:"o,attr"`
+	Hour    uint     `xml:"h,attr"`
+	Minute  uint     `xml:"m,attr"`
+	Repeat  string   `xml:"r,attr"`
+	Ctl     struct {
+		Td    string `xml:"td,attr"`
+		Clean struct {
+			Type  string `xml:"type,attr"`
+			Speed string `xml:"speed,attr"`
+		} `xml:"clean"`
+	} `xml:"ctl"`
+}
+
+type dnd struct {
+	enabled    uint
+	start, end string
+}
+
+type position struct {
+	x, y, angle int
+}
+
+type cleanLog struct {
+	start         time.Time
+	area, seconds uint
+	mode, reason  string
+}
+
+// control is a ctl element received from a client
+type control struct {
+	XMLName xml.Name `xml:"ctl"`
+	Td      string   `xml:"td,attr"`
+	Type    string   `xml:"type,attr"`
+	Name    string   `xml:"name,attr"`
+	Pid     string   `xml:"pid,attr"`
+	Count   string   `xml:"count,attr"`
+	O       string   `xml:"o,attr"`
+	S       string   `xml:"s,attr"`
+	E       string   `xml:"e,attr"`
+	Sched   schedule `xml:"s"`
+	Clean   struct {
+		Type  string `xml:"type,attr"`
+		Speed string `xml:"speed,attr"`
+	} `xml:"clean"`
+	Charge struct {
+		Type string `xml:"type,attr"`
+	} `xml:"charge"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	CHARGE_SLOT  = "SlotCharging"
+	CHARGE_GOING = "Going"
+	CHARGE_IDLE  = "Idle"
+	CLEAN_STOP   = "stop"
+	SPEED_NORMAL = "standard"
+)
+
+const (
+	// Error numbers returned in a ctl response
+	ERRNO_BADREQUEST = 5
+	ERRNO_UNKNOWN    = 6
+	ERRNO_NOTFOUND   = 7
+)
+
+const (
+	// Map layout, which is 8 x 8 pieces of 100 x 100 cells with each
+	// cell 50mm square
+	MAP_PIECE_SIZE = 100
+	MAP_PIECES     = 8
+	MAP_RESOLUTION = 50
+	MAP_SIZE       = MAP_PIECE_SIZE * MAP_PIECES
+)
+
+const (
+	// Map cell values
+	CELL_NONE  = 0
+	CELL_FLOOR = 1
+	CELL_WALL  = 2
+)
+
+const (
+	// Room dimensions in millimetres, centred on the map
+	ROOM_WIDTH  = 4000
+	ROOM_HEIGHT = 3000
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	reRepeat = regexp.MustCompile("^[01]{7}$")
+	reTime   = regexp.MustCompile("^([01]\\d|2[0-3]):[0-5]\\d$")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func newRobot(id, class, nickname string) *robot {
+	this := &robot{
+		id:       id,
+		class:    class,
+		nickname: nickname,
+		json:     ecovacs.IsJSONClass(class),
+		battery:  100,
+		charge:   CHARGE_SLOT,
+		clean:    CLEAN_STOP,
+		speed:    SPEED_NORMAL,
+		version:  DEFAULT_VERSION,
+		lifespan: map[string]uint{
+			"Brush":        90,
+			"SideBrush":    80,
+			"DustCaseHeap": 70,
+		},
+		mapId:   newToken(4),
+		cells:   newRoom(ROOM_WIDTH, ROOM_HEIGHT),
+		charger: position{0, -ROOM_HEIGHT/2 + 2*MAP_RESOLUTION, 90},
+		dnd:     dnd{0, "22:00", "08:00"},
+	}
+	this.position = this.charger
+
+	// Add cleaning history for the last two days
+	now := time.Now().Truncate(time.Hour)
+	this.addLog(cleanLog{now.Add(-48 * time.Hour), 12, 20 * 60, "auto", "a"})
+	this.addLog(cleanLog{now.Add(-24 * time.Hour), 10, 18 * 60, "auto", "a"})
+
+	// Return robot
+	return this
+}
+
+// newRoom returns map cells for a rectangular room of width and height
+// in millimetres, with a wall around the floor
+func newRoom(width, height int) []byte {
+	cells := make([]byte, MAP_SIZE*MAP_SIZE)
+	x0, y0 := MAP_SIZE/2-width/MAP_RESOLUTION/2, MAP_SIZE/2-height/MAP_RESOLUTION/2
+	x1, y1 := x0+width/MAP_RESOLUTION, y0+height/MAP_RESOLUTION
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			if x == x0 || y == y0 || x == x1-1 || y == y1-1 {
+				cells[y*MAP_SIZE+x] = CELL_WALL
+			} else {
+				cells[y*MAP_SIZE+x] = CELL_FLOOR
+			}
+		}
+	}
+	return cells
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PROPERTIES
+
+// Address returns the JID for the robot
+func (this *robot) Address() string {
+	return fmt.Sprintf("%s@%s.ecorobot.net/%s", this.id, this.class, DEFAULT_RESOURCE)
+}
+
+// Device returns the robot as returned by GetDeviceList
+func (this *robot) Device() userDevice {
+	device := userDevice{
+		DeviceId: this.id,
+		Name:     this.id,
+		Class:    this.class,
+		Resource: DEFAULT_RESOURCE,
+		Nickname: this.nickname,
+		Company:  DEFAULT_COMPANY,
+	}
+	if this.json {
+		device.Company = DEFAULT_JSON_COMPANY
+	}
+	return device
+}
+
+// Requests returns the commands received, in order
+func (this *robot) Requests() []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	requests := make([]string, len(this.requests))
+	copy(requests, this.requests)
+	return requests
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SET STATE
+
+// SetBatteryLevel sets the battery level and returns the report
+func (this *robot) SetBatteryLevel(level uint) []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.battery = level
+	return []string{this.batteryInfo("BatteryInfo")}
+}
+
+// SetChargeState sets the charge state and returns the report
+func (this *robot) SetChargeState(state string) []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.charge = state
+	return []string{this.chargeState("ChargeState")}
+}
+
+// SetPosition sets the robot position and angle and returns the report
+func (this *robot) SetPosition(x, y, angle int) []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.position = position{x, y, angle}
+	return []string{fmt.Sprintf(`<ctl td="Pos" t="p" p="%d,%d" a="%d" valid="1"/>`, x, y, angle)}
+}
+
+// SetLifeSpan sets the remaining lifespan of a part and returns the report
+func (this *robot) SetLifeSpan(part string, value uint) []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.lifespan[part] = value
+	return []string{fmt.Sprintf(`<ctl td="LifeSpan" type="%s" val="%d" total="100"/>`, escape(part), value)}
+}
+
+// SetError returns the report for an error code, where 100 indicates
+// the error has been cleared
+func (this *robot) SetError(code uint) []string {
+	return []string{fmt.Sprintf(`<ctl td="error" errs="%d"/>`, code)}
+}
+
+// SetCell sets the value of a map cell, which changes the checksum
+// for the piece which contains it
+func (this *robot) SetCell(x, y uint, value byte) bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	if x >= MAP_SIZE || y >= MAP_SIZE {
+		return false
+	} else {
+		this.cells[y*MAP_SIZE+x] = value
+		return true
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// COMMANDS
+
+// Command handles a ctl element and returns the response, and any
+// reports which should be sent to all sessions as a result
+func (this *robot) Command(data []byte) (string, []string) {
+	var ctl control
+	if err := xml.Unmarshal(data, &ctl); err != nil {
+		return failure(ERRNO_BADREQUEST, "BadRequest"), nil
+	}
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	this.requests = append(this.requests, ctl.Td)
+	switch ctl.Td {
+	case "GetBatteryInfo":
+		return this.batteryInfo(""), nil
+	case "GetChargeState":
+		return this.chargeState(""), nil
+	case "GetCleanState":
+		return this.cleanState(""), nil
+	case "GetLifeSpan":
+		if value, exists := this.lifespan[ctl.Type]; exists {
+			return fmt.Sprintf(`<ctl ret="ok" type="%s" val="%d" total="100"/>`, escape(ctl.Type), value), nil
+		} else {
+			return failure(ERRNO_BADREQUEST, "UnknownPart"), nil
+		}
+	case "ResetLifeSpan":
+		if _, exists := this.lifespan[ctl.Type]; exists {
+			this.lifespan[ctl.Type] = 100
+			return `<ctl ret="ok"/>`, nil
+		} else {
+			return failure(ERRNO_BADREQUEST, "UnknownPart"), nil
+		}
+	case "GetVersion":
+		return fmt.Sprintf(`<ctl ret="ok"><ver name="%s">%s</ver></ctl>`, escape(ctl.Name), escape(this.version)), nil
+	case "Clean":
+		if ctl.Clean.Type == "" {
+			return failure(ERRNO_BADREQUEST, "BadRequest"), nil
+		}
+		this.clean = strings.ToLower(ctl.Clean.Type)
+		if ctl.Clean.Speed != "" {
+			this.speed = strings.ToLower(ctl.Clean.Speed)
+		}
+		if this.clean != CLEAN_STOP {
+			this.charge = CHARGE_IDLE
+		}
+		return `<ctl ret="ok"/>`, []string{this.cleanState("CleanReport"), this.chargeState("ChargeState")}
+	case "Charge":
+		this.clean = CLEAN_STOP
+		this.charge = CHARGE_GOING
+		return `<ctl ret="ok"/>`, []string{this.cleanState("CleanReport"), this.chargeState("ChargeState")}
+	case "GetMapM":
+		crcs := make([]string, 0, MAP_PIECES*MAP_PIECES)
+		for pid := 0; pid < MAP_PIECES*MAP_PIECES; pid++ {
+			crcs = append(crcs, fmt.Sprint(crc32.ChecksumIEEE(this.piece(pid))))
+		}
+		return fmt.Sprintf(`<ctl ret="ok" i="%s" w="%d" h="%d" r="%d" c="%d" p="%d" m="%s"/>`,
+			this.mapId, MAP_PIECE_SIZE, MAP_PIECE_SIZE, MAP_PIECES, MAP_PIECES, MAP_RESOLUTION, strings.Join(crcs, ",")), nil
+	case "PullMP":
+		if pid, err := strconv.ParseUint(ctl.Pid, 10, 32); err != nil || pid >= MAP_PIECES*MAP_PIECES {
+			return failure(ERRNO_BADREQUEST, "BadPiece"), nil
+		} else {
+			data := base64.StdEncoding.EncodeToString(compress(this.piece(int(pid))))
+			return fmt.Sprintf(`<ctl ret="ok" i="%s" pid="%d" p="%s"/>`, this.mapId, pid, data), nil
+		}
+	case "GetPos":
+		return fmt.Sprintf(`<ctl ret="ok" t="p" p="%d,%d" a="%d" valid="1"/>`, this.position.x, this.position.y, this.position.angle), nil
+	case "GetChargerPos":
+		return fmt.Sprintf(`<ctl ret="ok" p="%d,%d" a="%d"/>`, this.charger.x, this.charger.y, this.charger.angle), nil
+	case "GetCleanSum":
+		return fmt.Sprintf(`<ctl ret="ok" a="%d" l="%d" c="%d"/>`, this.area, this.seconds, len(this.logs)), nil
+	case "GetCleanLogs":
+		count, err := strconv.ParseUint(ctl.Count, 10, 32)
+		if err != nil {
+			return failure(ERRNO_BADREQUEST, "BadCount"), nil
+		}
+		var body strings.Builder
+		for i := len(this.logs) - 1; i >= 0 && count > 0; i, count = i-1, count-1 {
+			log := this.logs[i]
+			fmt.Fprintf(&body, `<CleanSt a="%d" s="%d" l="%d" t="%s" f="%s"/>`, log.area, log.start.Unix(), log.seconds, escape(log.mode), escape(log.reason))
+		}
+		return `<ctl ret="ok">` + body.String() + `</ctl>`, nil
+	case "GetSched":
+		var body strings.Builder
+		for _, s := range this.schedules {
+			if data, err := xml.Marshal(s); err == nil {
+				body.Write(data)
+			}
+		}
+		return `<ctl ret="ok">` + body.String() + `</ctl>`, nil
+	case "SetSched":
+		if s := ctl.Sched; s.Name == "" || s.Hour > 23 || s.Minute > 59 || reRepeat.MatchString(s.Repeat) == false || s.Ctl.Clean.Type == "" {
+			return failure(ERRNO_BADREQUEST, "BadSchedule"), nil
+		} else if i := this.schedule(s.Name); i >= 0 {
+			this.schedules[i] = s
+		} else {
+			this.schedules = append(this.schedules, s)
+		}
+		return `<ctl ret="ok"/>`, nil
+	case "DelSched":
+		if i := this.schedule(ctl.Sched.Name); i < 0 {
+			return failure(ERRNO_NOTFOUND, "NotFound"), nil
+		} else {
+			this.schedules = append(this.schedules[:i], this.schedules[i+1:]...)
+		}
+		return `<ctl ret="ok"/>`, nil
+	case "GetBlockTime":
+		return fmt.Sprintf(`<ctl ret="ok" o="%d" s="%s" e="%s"/>`, this.dnd.enabled, this.dnd.start, this.dnd.end), nil
+	case "SetBlockTime":
+		if enabled, err := strconv.ParseUint(ctl.O, 10, 32); err != nil || enabled > 1 {
+			return failure(ERRNO_BADREQUEST, "BadBlockTime"), nil
+		} else if reTime.MatchString(ctl.S) == false || reTime.MatchString(ctl.E) == false {
+			return failure(ERRNO_BADREQUEST, "BadBlockTime"), nil
+		} else {
+			this.dnd = dnd{uint(enabled), ctl.S, ctl.E}
+		}
+		return `<ctl ret="ok"/>`, nil
+	default:
+		return failure(ERRNO_UNKNOWN, "UnknownCommand"), nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// batteryInfo returns the battery level as a response when td is empty
+// or otherwise a report. The lock should be held
+func (this *robot) batteryInfo(td string) string {
+	return ctl(td, fmt.Sprintf(`<battery power="%03d"/>`, this.battery))
+}
+
+// chargeState returns the charge state. The lock should be held
+func (this *robot) chargeState(td string) string {
+	return ctl(td, fmt.Sprintf(`<charge type="%s"/>`, escape(this.charge)))
+}
+
+// cleanState returns the clean mode and suction. The lock should be held
+func (this *robot) cleanState(td string) string {
+	return ctl(td, fmt.Sprintf(`<clean type="%s" speed="%s"/>`, escape(this.clean), escape(this.speed)))
+}
+
+// piece returns the cells for a map piece. The lock should be held
+func (this *robot) piece(pid int) []byte {
+	data := make([]byte, 0, MAP_PIECE_SIZE*MAP_PIECE_SIZE)
+	x0, y0 := (pid%MAP_PIECES)*MAP_PIECE_SIZE, (pid/MAP_PIECES)*MAP_PIECE_SIZE
+	for y := y0; y < y0+MAP_PIECE_SIZE; y++ {
+		data = append(data, this.cells[y*MAP_SIZE+x0:y*MAP_SIZE+x0+MAP_PIECE_SIZE]...)
+	}
+	return data
+}
+
+// schedule returns the index of a schedule or -1. The lock should be held
+func (this *robot) schedule(name string) int {
+	for i, schedule := range this.schedules {
+		if schedule.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// addLog appends a cleaning session and adds it to the totals. The
+// lock should be held
+func (this *robot) addLog(log cleanLog) {
+	this.logs = append(this.logs, log)
+	this.area += log.area
+	this.seconds += log.seconds
+}
+
+func ctl(td, body string) string {
+	if td == "" {
+		return `<ctl ret="ok">` + body + `</ctl>`
+	} else {
+		return `<ctl td="` + td + `">` + body + `</ctl>`
+	}
+}
+
+func failure(errno uint, message string) string {
+	return fmt.Sprintf(`<ctl ret="fail" errno="%d" error="%s"/>`, errno, escape(message))
+}
+
+func escape(value string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
@@ -0,0 +1,427 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+// Package sim implements an in-process Ecovacs backend, with the HTTPS
+// login and device list endpoints, an XMPP server which speaks the
+// IQ ctl protocol, and the portal and MQTT broker used by robots which
+// accept JSON commands, so that accounts and robots can be exercised on
+// localhost without any Ecovacs hardware or cloud account
+package sim
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Backend struct {
+	sync.Mutex
+	sync.WaitGroup
+
+	config    *tls.Config
+	roots     *x509.CertPool
+	key       *rsa.PrivateKey
+	server    *http.Server
+	listener  net.Listener
+	xmpp      net.Listener
+	mqtt      net.Listener
+	robots    map[string]*robot
+	sessions  map[*session]bool
+	clients   map[*client]bool
+	accounts  map[string]*account
+	logins    uint
+	authError bool
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	DEFAULT_ADDR     = "127.0.0.1:0"
+	DEFAULT_COUNTRY  = "gb"
+	DEFAULT_VERSION  = "0.13.5"
+	DEFAULT_CLASS    = "ls1ok3"
+	DEFAULT_RESOURCE = "atom"
+	DEFAULT_COMPANY  = "eco-legacy"
+
+	// Class and company for robots which accept JSON commands
+	DEFAULT_JSON_CLASS   = "yna5xi"
+	DEFAULT_JSON_COMPANY = "eco-ng"
+	TOKEN_LENGTH         = 16
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+// New returns a backend with HTTPS endpoints on httpAddr, an XMPP server
+// on xmppAddr and an MQTT broker on mqttAddr. When any address is empty,
+// a random port on the loopback interface is used. A self-signed
+// certificate is issued for all servers
+func New(httpAddr, xmppAddr, mqttAddr string) (*Backend, error) {
+	this := new(Backend)
+	if httpAddr == "" {
+		httpAddr = DEFAULT_ADDR
+	}
+	if xmppAddr == "" {
+		xmppAddr = DEFAULT_ADDR
+	}
+	if mqttAddr == "" {
+		mqttAddr = DEFAULT_ADDR
+	}
+
+	this.robots = make(map[string]*robot)
+	this.sessions = make(map[*session]bool)
+	this.clients = make(map[*client]bool)
+	this.accounts = map[string]*account{
+		"": newAccount("", ""),
+	}
+
+	// Create login key and certificate
+	if key, err := rsa.GenerateKey(rand.Reader, KEY_BITS); err != nil {
+		return nil, err
+	} else {
+		this.key = key
+	}
+	if cert, roots, err := newCertificate(); err != nil {
+		return nil, err
+	} else {
+		this.roots = roots
+		this.config = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+
+	// Create listeners
+	if listener, err := net.Listen("tcp", httpAddr); err != nil {
+		return nil, err
+	} else if xmpp, err := net.Listen("tcp", xmppAddr); err != nil {
+		listener.Close()
+		return nil, err
+	} else if mqtt, err := net.Listen("tcp", mqttAddr); err != nil {
+		listener.Close()
+		xmpp.Close()
+		return nil, err
+	} else {
+		this.listener = listener
+		this.xmpp = xmpp
+		this.mqtt = tls.NewListener(mqtt, this.config)
+	}
+
+	// Serve HTTPS, XMPP and MQTT in the background
+	this.server = &http.Server{
+		Handler:   this.handler(),
+		TLSConfig: this.config,
+	}
+	this.WaitGroup.Add(3)
+	go func() {
+		defer this.WaitGroup.Done()
+		this.server.ServeTLS(this.listener, "", "")
+	}()
+	go this.acceptLoop()
+	go this.mqttAcceptLoop()
+
+	// Success
+	return this, nil
+}
+
+// Close closes the servers and any client sessions, and releases
+// resources
+func (this *Backend) Close() error {
+	this.Mutex.Lock()
+	if this.sessions == nil {
+		this.Mutex.Unlock()
+		return gopi.ErrOutOfOrder
+	}
+	sessions, clients := this.sessions, this.clients
+	this.sessions, this.clients = nil, nil
+	this.Mutex.Unlock()
+
+	// Close servers, sessions and clients, and wait for them to end
+	err := gopi.NewCompoundError()
+	err.Add(this.server.Close())
+	err.Add(this.xmpp.Close())
+	err.Add(this.mqtt.Close())
+	for session := range sessions {
+		session.Close()
+	}
+	for client := range clients {
+		client.Close()
+	}
+	this.WaitGroup.Wait()
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Release resources
+	this.robots = nil
+	this.server = nil
+
+	// Return any errors
+	return err.ErrorOrSelf()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PROPERTIES
+
+// MainURL returns the URL format for the login endpoints, which can be
+// used in place of MAIN_URL_FORMAT
+func (this *Backend) MainURL() string {
+	return "https://" + this.listener.Addr().String() +
+		"/v1/private/{{.country}}/{{.lang}}/{{.deviceId}}/{{.appCode}}/{{.appVersion}}/{{.channel}}/{{.deviceType}}{{.path}}"
+}
+
+// UserURL returns the URL format for the user endpoint, which can be
+// used in place of USER_URL_FORMAT
+func (this *Backend) UserURL() string {
+	return "https://" + this.listener.Addr().String() + "/user.do"
+}
+
+// XMPPHost returns the address of the XMPP server as host:port
+func (this *Backend) XMPPHost() string {
+	return this.xmpp.Addr().String()
+}
+
+// PortalURL returns the URL format for commands to robots which accept
+// JSON commands, which can be used in place of PORTAL_URL_FORMAT
+func (this *Backend) PortalURL() string {
+	return "https://" + this.listener.Addr().String() + PATH_PORTAL
+}
+
+// MQTTHost returns the address of the MQTT broker as host:port
+func (this *Backend) MQTTHost() string {
+	return this.mqtt.Addr().String()
+}
+
+// TLSConfig returns a client configuration which trusts the
+// certificate presented by the backend
+func (this *Backend) TLSConfig() *tls.Config {
+	return &tls.Config{
+		RootCAs: this.roots,
+	}
+}
+
+// UserId returns the user identifier which is issued on login to the
+// default account
+func (this *Backend) UserId() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.accounts[""].userId
+}
+
+// SetAuthError causes subsequent logins to fail with an
+// authentication error when true
+func (this *Backend) SetAuthError(value bool) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.authError = value
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// ROBOTS
+
+// AddRobot adds a robot with device identifier and nickname, which is
+// docked and charging with a full battery
+func (this *Backend) AddRobot(id, nickname string) error {
+	return this.AddRobotWithClass(id, nickname, DEFAULT_CLASS)
+}
+
+// AddRobotWithClass adds a robot with a device class. Robots with a class
+// for which ecovacs.IsJSONClass returns true accept JSON commands through
+// the portal and report through the MQTT broker, and others use XMPP
+func (this *Backend) AddRobotWithClass(id, nickname, class string) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if id == "" {
+		return gopi.ErrBadParameter.WithPrefix("id")
+	} else if class == "" {
+		return gopi.ErrBadParameter.WithPrefix("class")
+	} else if _, exists := this.robots[id]; exists {
+		return gopi.ErrDuplicateItem.WithPrefix(id)
+	} else {
+		this.robots[id] = newRobot(id, class, nickname)
+	}
+
+	// Success
+	return nil
+}
+
+// Robots returns the device identifiers for all robots, sorted
+func (this *Backend) Robots() []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	ids := make([]string, 0, len(this.robots))
+	for id := range this.robots {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Requests returns the commands which a robot has received, in order
+func (this *Backend) Requests(id string) []string {
+	if robot := this.robot(id); robot == nil {
+		return nil
+	} else {
+		return robot.Requests()
+	}
+}
+
+// SetBatteryLevel sets the battery level for a robot between 0 and 100
+// and reports it to connected clients
+func (this *Backend) SetBatteryLevel(id string, level uint) error {
+	if robot := this.robot(id); robot == nil {
+		return gopi.ErrNotFound.WithPrefix(id)
+	} else if level > 100 {
+		return gopi.ErrBadParameter.WithPrefix("level")
+	} else {
+		this.report(robot, robot.SetBatteryLevel(level))
+	}
+
+	// Success
+	return nil
+}
+
+// SetChargeState sets the charge state for a robot (for example,
+// SlotCharging, Going or Idle) and reports it to connected clients
+func (this *Backend) SetChargeState(id, state string) error {
+	if robot := this.robot(id); robot == nil {
+		return gopi.ErrNotFound.WithPrefix(id)
+	} else if state == "" {
+		return gopi.ErrBadParameter.WithPrefix("state")
+	} else {
+		this.report(robot, robot.SetChargeState(state))
+	}
+
+	// Success
+	return nil
+}
+
+// SetPosition sets the position of a robot in millimetres from the
+// centre of the map, and reports it to connected clients
+func (this *Backend) SetPosition(id string, x, y, angle int) error {
+	if robot := this.robot(id); robot == nil {
+		return gopi.ErrNotFound.WithPrefix(id)
+	} else {
+		this.report(robot, robot.SetPosition(x, y, angle))
+	}
+
+	// Success
+	return nil
+}
+
+// SetLifeSpan sets the remaining lifespan of a part for a robot between
+// 0 and 100 and reports it to connected clients
+func (this *Backend) SetLifeSpan(id, part string, value uint) error {
+	if robot := this.robot(id); robot == nil {
+		return gopi.ErrNotFound.WithPrefix(id)
+	} else if part == "" {
+		return gopi.ErrBadParameter.WithPrefix("part")
+	} else if value > 100 {
+		return gopi.ErrBadParameter.WithPrefix("value")
+	} else {
+		this.report(robot, robot.SetLifeSpan(part, value))
+	}
+
+	// Success
+	return nil
+}
+
+// SetError reports an error code for a robot to connected clients, where
+// 100 indicates the error has been cleared
+func (this *Backend) SetError(id string, code uint) error {
+	if robot := this.robot(id); robot == nil {
+		return gopi.ErrNotFound.WithPrefix(id)
+	} else {
+		this.report(robot, robot.SetError(code))
+	}
+
+	// Success
+	return nil
+}
+
+// SetCell sets a map cell for a robot, where x and y are between zero
+// and MAP_SIZE. Clients see the change on the next GetMapM request
+func (this *Backend) SetCell(id string, x, y uint, value byte) error {
+	if robot := this.robot(id); robot == nil {
+		return gopi.ErrNotFound.WithPrefix(id)
+	} else if robot.SetCell(x, y, value) == false {
+		return gopi.ErrBadParameter.WithPrefix("x,y")
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *Backend) String() string {
+	str := "<ecovacs.Simulator"
+	str += " https=" + strconv.Quote(this.listener.Addr().String())
+	str += " xmpp=" + strconv.Quote(this.XMPPHost())
+	str += " mqtt=" + strconv.Quote(this.MQTTHost())
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	str += fmt.Sprintf(" robots=%v sessions=%v clients=%v", len(this.robots), len(this.sessions), len(this.clients))
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *Backend) robot(id string) *robot {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	if robot, exists := this.robots[id]; exists {
+		return robot
+	} else {
+		return nil
+	}
+}
+
+// report sends reports from a robot to all authenticated sessions, or
+// publishes them to MQTT clients for robots which accept JSON commands
+func (this *Backend) report(robot *robot, reports []string) {
+	if robot.json {
+		for _, report := range reports {
+			for _, event := range jsonReports(report) {
+				this.publish(robot, event)
+			}
+		}
+		return
+	}
+
+	this.Mutex.Lock()
+	sessions := make([]*session, 0, len(this.sessions))
+	for session, bound := range this.sessions {
+		if bound {
+			sessions = append(sessions, session)
+		}
+	}
+	this.Mutex.Unlock()
+
+	for _, session := range sessions {
+		for _, report := range reports {
+			session.Report(robot, report)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+/*
+	Mutablehome Automation: Ecovacs
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	home "github.com/djthorpe/mutablehome"
+	ecovacs "github.com/djthorpe/mutablehome/unit/ecovacs"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type session struct {
+	sync.Mutex
+
+	backend *Backend
+	conn    net.Conn
+	decoder *xml.Decoder
+	jid     string
+}
+
+// stanza is an iq element received from a client
+type stanza struct {
+	XMLName xml.Name  `xml:"iq"`
+	Id      string    `xml:"id,attr"`
+	Type    string    `xml:"type,attr"`
+	From    string    `xml:"from,attr"`
+	To      string    `xml:"to,attr"`
+	Bind    *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	Session *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-session session"`
+	Ping    *struct{} `xml:"urn:xmpp:ping ping"`
+	Query   *struct {
+		InnerXML []byte `xml:",innerxml"`
+	} `xml:"com:ctl query"`
+}
+
+type auth struct {
+	XMLName   xml.Name `xml:"auth"`
+	Mechanism string   `xml:"mechanism,attr"`
+	Value     string   `xml:",chardata"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	NS_STREAM  = "http://etherx.jabber.org/streams"
+	NS_TLS     = "urn:ietf:params:xml:ns:xmpp-tls"
+	NS_SASL    = "urn:ietf:params:xml:ns:xmpp-sasl"
+	NS_BIND    = "urn:ietf:params:xml:ns:xmpp-bind"
+	NS_SESSION = "urn:ietf:params:xml:ns:xmpp-session"
+)
+
+const (
+	HANDSHAKE_TIMEOUT = 5 * time.Second
+	WRITE_TIMEOUT     = 5 * time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// ACCEPT
+
+func (this *Backend) acceptLoop() {
+	defer this.WaitGroup.Done()
+	for {
+		conn, err := this.xmpp.Accept()
+		if err != nil {
+			// Listener has been closed
+			return
+		}
+		this.Mutex.Lock()
+		if this.sessions == nil {
+			this.Mutex.Unlock()
+			conn.Close()
+			return
+		}
+		session := &session{backend: this, conn: conn}
+		this.sessions[session] = false
+		this.WaitGroup.Add(1)
+		this.Mutex.Unlock()
+
+		go func() {
+			defer this.WaitGroup.Done()
+			session.Run()
+			session.Close()
+			this.Mutex.Lock()
+			defer this.Mutex.Unlock()
+			if this.sessions != nil {
+				delete(this.sessions, session)
+			}
+		}()
+	}
+}
+
+// authenticate returns the JID for a user and password, or an empty string
+// if the credentials were not issued by loginByItToken
+func (this *Backend) authenticate(user, password string) string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if account := this.accountForUser(user); account == nil || account.token == "" {
+		return ""
+	} else if password != fmt.Sprintf("0/%s/%s", account.resource, account.token) {
+		return ""
+	} else {
+		return fmt.Sprintf("%s@%s/%s", account.userId, ecovacs.ECOVACS_REALM, account.resource)
+	}
+}
+
+// authenticated marks a session so that it receives reports
+func (this *Backend) authenticated(session *session) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	if _, exists := this.sessions[session]; exists {
+		this.sessions[session] = true
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SESSION
+
+// Run negotiates STARTTLS and SASL PLAIN authentication, then responds
+// to iq stanzas until the client closes the stream
+func (this *session) Run() error {
+	if err := this.negotiate(); err != nil {
+		return err
+	}
+	for {
+		start, err := this.next()
+		if err != nil {
+			return err
+		} else if start.Name.Local != "iq" {
+			if err := this.decoder.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		var iq stanza
+		if err := this.decoder.DecodeElement(&iq, &start); err != nil {
+			return err
+		} else if err := this.handle(iq); err != nil {
+			return err
+		}
+	}
+}
+
+// Report sends a report from a robot, if the session is authenticated
+func (this *session) Report(robot *robot, report string) error {
+	this.Mutex.Lock()
+	jid := this.jid
+	this.Mutex.Unlock()
+	if jid == "" {
+		return gopi.ErrOutOfOrder
+	} else {
+		return this.write(`<iq type="set" id="%s" from="%s" to="%s"><query xmlns="com:ctl">%s</query></iq>`,
+			newToken(4), escape(robot.Address()), escape(jid), report)
+	}
+}
+
+func (this *session) Close() error {
+	this.Mutex.Lock()
+	conn := this.conn
+	this.Mutex.Unlock()
+	return conn.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *session) negotiate() error {
+	this.conn.SetReadDeadline(time.Now().Add(HANDSHAKE_TIMEOUT))
+	defer this.conn.SetReadDeadline(time.Time{})
+
+	// Require STARTTLS
+	this.decoder = xml.NewDecoder(this.conn)
+	if err := this.stream(`<starttls xmlns="` + NS_TLS + `"><required/></starttls>`); err != nil {
+		return err
+	} else if start, err := this.next(); err != nil {
+		return err
+	} else if start.Name.Space != NS_TLS || start.Name.Local != "starttls" {
+		return gopi.ErrUnexpectedResponse.WithPrefix(start.Name.Local)
+	} else if err := this.decoder.Skip(); err != nil {
+		return err
+	} else if err := this.write(`<proceed xmlns="%s"/>`, NS_TLS); err != nil {
+		return err
+	}
+	conn := tls.Server(this.conn, this.backend.config)
+	if err := conn.Handshake(); err != nil {
+		return err
+	} else {
+		this.Mutex.Lock()
+		this.conn = conn
+		this.Mutex.Unlock()
+	}
+
+	// Authenticate with SASL PLAIN
+	var auth auth
+	this.decoder = xml.NewDecoder(this.conn)
+	if err := this.stream(`<mechanisms xmlns="` + NS_SASL + `"><mechanism>PLAIN</mechanism></mechanisms>`); err != nil {
+		return err
+	} else if start, err := this.next(); err != nil {
+		return err
+	} else if start.Name.Space != NS_SASL || start.Name.Local != "auth" {
+		return gopi.ErrUnexpectedResponse.WithPrefix(start.Name.Local)
+	} else if err := this.decoder.DecodeElement(&auth, &start); err != nil {
+		return err
+	} else if jid := this.plain(auth); jid == "" {
+		this.write(`<failure xmlns="%s"><not-authorized/></failure>`, NS_SASL)
+		return home.ErrAuthenticationError
+	} else if err := this.write(`<success xmlns="%s"/>`, NS_SASL); err != nil {
+		return err
+	} else {
+		this.Mutex.Lock()
+		this.jid = jid
+		this.Mutex.Unlock()
+	}
+
+	// Restart the stream to offer resource binding
+	return this.stream(`<bind xmlns="` + NS_BIND + `"/><session xmlns="` + NS_SESSION + `"/>`)
+}
+
+// stream waits for the client to open a stream, then opens the server
+// stream and sends features
+func (this *session) stream(features string) error {
+	if start, err := this.next(); err != nil {
+		return err
+	} else if start.Name.Space != NS_STREAM || start.Name.Local != "stream" {
+		return gopi.ErrUnexpectedResponse.WithPrefix(start.Name.Local)
+	} else {
+		return this.write(`<?xml version="1.0"?><stream:stream xmlns="jabber:client" xmlns:stream="%s" id="%s" from="%s" version="1.0"><stream:features>%s</stream:features>`,
+			NS_STREAM, newToken(4), ecovacs.ECOVACS_REALM, features)
+	}
+}
+
+// plain returns the JID for PLAIN credentials, or an empty string
+func (this *session) plain(auth auth) string {
+	if auth.Mechanism != "PLAIN" {
+		return ""
+	} else if data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(auth.Value)); err != nil {
+		return ""
+	} else if fields := strings.Split(string(data), "\x00"); len(fields) != 3 {
+		return ""
+	} else {
+		return this.backend.authenticate(fields[1], fields[2])
+	}
+}
+
+func (this *session) handle(iq stanza) error {
+	this.Mutex.Lock()
+	jid := this.jid
+	this.Mutex.Unlock()
+
+	switch {
+	case iq.Bind != nil:
+		this.backend.authenticated(this)
+		return this.write(`<iq type="result" id="%s"><bind xmlns="%s"><jid>%s</jid></bind></iq>`, escape(iq.Id), NS_BIND, escape(jid))
+	case iq.Session != nil, iq.Ping != nil:
+		return this.write(`<iq type="result" id="%s" from="%s" to="%s"/>`, escape(iq.Id), escape(iq.To), escape(jid))
+	case iq.Query != nil && iq.Type == "set":
+		robot := this.backend.robot(strings.SplitN(iq.To, "@", 2)[0])
+		if robot == nil || robot.json {
+			return this.write(`<iq type="error" id="%s" from="%s" to="%s"/>`, escape(iq.Id), escape(iq.To), escape(jid))
+		}
+		response, reports := robot.Command(iq.Query.InnerXML)
+		if err := this.write(`<iq type="result" id="%s" from="%s" to="%s"/>`, escape(iq.Id), escape(iq.To), escape(jid)); err != nil {
+			return err
+		} else if err := this.write(`<iq type="set" id="%s" from="%s" to="%s"><query xmlns="com:ctl">%s</query></iq>`, escape(iq.Id), escape(iq.To), escape(jid), response); err != nil {
+			return err
+		}
+		this.backend.report(robot, reports)
+		return nil
+	default:
+		return this.write(`<iq type="error" id="%s" to="%s"/>`, escape(iq.Id), escape(jid))
+	}
+}
+
+// next returns the next start element, or an error when the client
+// ends the stream
+func (this *session) next() (xml.StartElement, error) {
+	for {
+		token, err := this.decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			return token, nil
+		case xml.EndElement:
+			if token.Name.Space == NS_STREAM && token.Name.Local == "stream" {
+				return xml.StartElement{}, gopi.ErrOutOfOrder.WithPrefix("Stream closed")
+			}
+		}
+	}
+}
+
+func (this *session) write(format string, args ...interface{}) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+	_, err := fmt.Fprintf(this.conn, format, args...)
+	return err
+}
@@ -0,0 +1,80 @@
+package ecovacs
+
+import (
+	"strings"
+
+	// Frameworks
+	home "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Transport sends commands to a device and receives responses and
+// reports, which are normalised into XMPPMessage whichever protocol
+// the device speaks
+type Transport interface {
+	IsConnected() bool
+	Address() string
+	Close() error
+	Ping() error
+	Recv() (*XMPPMessage, error)
+
+	GetBatteryInfo() (string, error)
+	GetLifeSpan(home.EcovacsPart) (string, error)
+	ResetLifeSpan(home.EcovacsPart) (string, error)
+	GetChargeState() (string, error)
+	GetCleanState() (string, error)
+	GetVersion() (string, error)
+	GetMapM() (string, error)
+	PullMP(uint) (string, error)
+	GetPos() (string, error)
+	GetChargerPos() (string, error)
+	GetCleanSum() (string, error)
+	GetCleanLogs(uint) (string, error)
+	GetSched() (string, error)
+	SetSched(home.EcovacsSchedule) (string, error)
+	DelSched(string) (string, error)
+	GetBlockTime() (string, error)
+	SetBlockTime(home.EcovacsDND) (string, error)
+	Clean(home.EcovacsCleanMode, home.EcovacsCleanSuction) (string, error)
+	Charge() (string, error)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// jsonClasses are the device classes which use MQTT and JSON commands
+// rather than XMPP, which includes OZMO 9xx, T8 and later models
+var jsonClasses = map[string]string{
+	"yna5xi": "DEEBOT OZMO 950",
+	"vi829v": "DEEBOT OZMO 920",
+	"h18jkh": "DEEBOT OZMO T8",
+	"fqxoiu": "DEEBOT OZMO T8+",
+	"x5d34r": "DEEBOT OZMO T8 AIVI",
+	"55aiho": "DEEBOT OZMO T8 Plus",
+	"jtmf04": "DEEBOT T8 Max",
+	"bs40nz": "DEEBOT T8 AIVI+",
+	"b742vd": "DEEBOT N8",
+	"9s1s80": "DEEBOT T9",
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// IsJSONClass returns true if devices of a class use MQTT and JSON
+// commands rather than XMPP
+func IsJSONClass(class string) bool {
+	_, exists := jsonClasses[strings.ToLower(class)]
+	return exists
+}
+
+// NewTransport returns the transport for a device of a class, which
+// is not connected
+func NewTransport(deviceId, class, resource string) Transport {
+	if IsJSONClass(class) {
+		return &JSONClient{DeviceId: deviceId, Class: class, Resource: resource}
+	} else {
+		return &XMPPClient{DeviceId: deviceId, Class: class}
+	}
+}
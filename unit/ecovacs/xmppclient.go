@@ -1,6 +1,7 @@
 package ecovacs
 
 import (
+	"encoding/xml"
 	"fmt"
 	"strings"
 	"sync"
@@ -19,10 +20,22 @@ type XMPPClient struct {
 	DeviceId string
 	Class    string
 
+	// Commands for requests which have not been answered, keyed
+	// by request id
+	requests map[string]string
+
 	RequestId
 	sync.Mutex
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// Maximum number of unanswered requests which are remembered
+	MAX_PENDING_REQUESTS = 256
+)
+
 ////////////////////////////////////////////////////////////////////////////////
 // NEW CLIENT / CLOSE
 
@@ -123,6 +136,21 @@ func (this *XMPPClient) GetLifeSpan(part home.EcovacsPart) (string, error) {
 	}
 }
 
+// ResetLifeSpan resets the lifespan of a part after it has been replaced
+func (this *XMPPClient) ResetLifeSpan(part home.EcovacsPart) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := fmt.Sprintf(`<ctl td="ResetLifeSpan" type="%s"></ctl>`, escapeXML(string(part)))
+	if part == "" {
+		return "", gopi.ErrBadParameter.WithPrefix("ResetLifeSpan")
+	} else if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("ResetLifeSpan")
+	} else {
+		return this.send(command)
+	}
+}
+
 func (this *XMPPClient) GetChargeState() (string, error) {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
@@ -159,17 +187,191 @@ func (this *XMPPClient) GetVersion() (string, error) {
 	}
 }
 
+func (this *XMPPClient) GetMapM() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := `<ctl td="GetMapM"></ctl>`
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("GetMapM")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) PullMP(piece uint) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := fmt.Sprintf(`<ctl td="PullMP" pid="%d"></ctl>`, piece)
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("PullMP")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) GetPos() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := `<ctl td="GetPos"></ctl>`
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("GetPos")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) GetChargerPos() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := `<ctl td="GetChargerPos"></ctl>`
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("GetChargerPos")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) GetCleanSum() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := `<ctl td="GetCleanSum"></ctl>`
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("GetCleanSum")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) GetCleanLogs(count uint) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := fmt.Sprintf(`<ctl td="GetCleanLogs" count="%d"></ctl>`, count)
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("GetCleanLogs")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) GetSched() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := `<ctl td="GetSched"></ctl>`
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("GetSched")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) SetSched(schedule home.EcovacsSchedule) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if err := checkSchedule(schedule); err != nil {
+		return "", err
+	}
+	command := `<ctl td="SetSched">` + scheduleXML(schedule) + `</ctl>`
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("SetSched")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) DelSched(name string) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if name == "" {
+		return "", gopi.ErrBadParameter.WithPrefix("name")
+	}
+	command := fmt.Sprintf(`<ctl td="DelSched"><s n="%s"/></ctl>`, escapeXML(name))
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("DelSched")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) GetBlockTime() (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	command := `<ctl td="GetBlockTime"></ctl>`
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("GetBlockTime")
+	} else {
+		return this.send(command)
+	}
+}
+
+func (this *XMPPClient) SetBlockTime(dnd home.EcovacsDND) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	enabled := 0
+	if dnd.Enabled {
+		enabled = 1
+	}
+	command := fmt.Sprintf(`<ctl td="SetBlockTime" o="%d" s="%s" e="%s"></ctl>`, enabled, FormatTimeOfDay(dnd.Start), FormatTimeOfDay(dnd.End))
+	if this.Client == nil {
+		return "", gopi.ErrInternalAppError.WithPrefix("SetBlockTime")
+	} else {
+		return this.send(command)
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
+// send sends a command and records the command name against the request
+// id, since responses from the device don't always include it. The lock
+// should be held
 func (this *XMPPClient) send(command string) (string, error) {
-	return this.Client.RawInformationQuery(this.Client.JID(), this.Address(), this.RequestId.Next(), xmpp.IQTypeSet, "com:ctl", command)
+	reqId := this.RequestId.Next()
+	if this.requests == nil || len(this.requests) >= MAX_PENDING_REQUESTS {
+		this.requests = make(map[string]string)
+	}
+	if td := commandName(command); td != "" {
+		this.requests[reqId] = td
+	}
+	return this.Client.RawInformationQuery(this.Client.JID(), this.Address(), reqId, xmpp.IQTypeSet, "com:ctl", command)
+}
+
+// request returns and removes the command name for a request id, or
+// returns an empty string if the request id is unknown
+func (this *XMPPClient) request(reqId string) string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if td, exists := this.requests[reqId]; exists {
+		delete(this.requests, reqId)
+		return td
+	} else {
+		return ""
+	}
 }
 
 func (this *XMPPClient) Recv() (*XMPPMessage, error) {
+	// Client is nil when closed before receiving
+	this.Mutex.Lock()
+	client := this.Client
+	this.Mutex.Unlock()
+	if client == nil {
+		return nil, nil
+	}
+
 	for {
 		// Receive a message from XMPP
-		stanza, err := this.Client.Recv()
+		stanza, err := client.Recv()
 
 		// Deal with "closed network connection" error, which is
 		// due to us closing the intenet connection and we don't need
@@ -191,6 +393,7 @@ func (this *XMPPClient) Recv() (*XMPPMessage, error) {
 			if message, err := Parse(v); err != nil {
 				fmt.Println("PARSE ERROR", err, string(v.Query))
 			} else if message != nil {
+				message.SetRequest(this.request(v.ID))
 				return message, nil
 			}
 		}
@@ -204,3 +407,21 @@ func Parse(in xmpp.IQ) (*XMPPMessage, error) {
 		return NewXMPPMessage(in.Query, in.ID)
 	}
 }
+
+// commandName returns the td attribute of a ctl command
+func commandName(command string) string {
+	var ctl struct {
+		Td string `xml:"td,attr"`
+	}
+	if err := xml.Unmarshal([]byte(command), &ctl); err != nil {
+		return ""
+	} else {
+		return ctl.Td
+	}
+}
+
+func escapeXML(value string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
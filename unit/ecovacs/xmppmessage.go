@@ -1,12 +1,15 @@
 package ecovacs
 
 import (
+	"encoding/base64"
 	"encoding/xml"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
 	home "github.com/djthorpe/mutablehome"
 )
 
@@ -20,13 +23,54 @@ type XMPPMessage struct {
 
 	// Data structure
 	Control struct {
+		Td      string `xml:"td,attr"`
 		Id      string `xml:"id,attr"`
 		Ret     string `xml:"ret,attr"`
 		ErrorNo uint   `xml:"errno,attr"`
 		Error   string `xml:"error,attr"`
+		Errs    string `xml:"errs,attr"`
 		Type    string `xml:"type,attr"`
 		Val     uint   `xml:"val,attr"`
 		Total   uint   `xml:"total,attr"`
+
+		// Map, position and clean summary attributes, which are
+		// interpreted depending on the command
+		I     string `xml:"i,attr"`
+		W     uint   `xml:"w,attr"`
+		H     uint   `xml:"h,attr"`
+		R     uint   `xml:"r,attr"`
+		C     uint   `xml:"c,attr"`
+		P     string `xml:"p,attr"`
+		M     string `xml:"m,attr"`
+		Pid   string `xml:"pid,attr"`
+		A     int    `xml:"a,attr"`
+		L     uint   `xml:"l,attr"`
+		T     string `xml:"t,attr"`
+		Valid string `xml:"valid,attr"`
+		O     uint   `xml:"o,attr"`
+		S     string `xml:"s,attr"`
+		E     string `xml:"e,attr"`
+		Sched []struct {
+			N   string `xml:"n,attr"`
+			O   uint   `xml:"o,attr"`
+			H   uint   `xml:"h,attr"`
+			M   uint   `xml:"m,attr"`
+			R   string `xml:"r,attr"`
+			Ctl struct {
+				Clean struct {
+					Type  string `xml:"type,attr"`
+					Speed string `xml:"speed,attr"`
+				} `xml:"clean"`
+			} `xml:"ctl"`
+		} `xml:"s"`
+		CleanSt []struct {
+			A uint   `xml:"a,attr"`
+			S int64  `xml:"s,attr"`
+			L uint   `xml:"l,attr"`
+			T string `xml:"t,attr"`
+			F string `xml:"f,attr"`
+		} `xml:"CleanSt"`
+
 		Battery struct {
 			Power uint `xml:"power,attr"`
 		} `xml:"battery"`
@@ -49,6 +93,9 @@ type XMPPMessage struct {
 	// The message ID
 	id string
 
+	// The command which the message is a response to
+	request string
+
 	// Cache type
 	messageType home.EcovacsEventType
 }
@@ -77,8 +124,24 @@ func (this *XMPPMessage) Type() home.EcovacsEventType {
 	if this.messageType != home.ECOVACS_EVENT_NONE {
 		return this.messageType
 	}
-	// Set cached version
+	// Set cached version from the command or report name
+	if messageType := typeForCommand(this.Control.Td); messageType != home.ECOVACS_EVENT_NONE && this.Control.ErrorNo == 0 {
+		this.messageType = messageType
+		return this.messageType
+	} else if messageType := typeForCommand(this.request); messageType != home.ECOVACS_EVENT_NONE && this.Control.ErrorNo == 0 {
+		this.messageType = messageType
+		return this.messageType
+	}
+	// Set cached version from the message contents
 	switch {
+	case this.Control.M != "":
+		this.messageType = home.ECOVACS_EVENT_MAP
+	case this.Control.Pid != "":
+		this.messageType = home.ECOVACS_EVENT_MAPPIECE
+	case len(this.Control.CleanSt) > 0:
+		this.messageType = home.ECOVACS_EVENT_LOG
+	case len(this.Control.Sched) > 0:
+		this.messageType = home.ECOVACS_EVENT_SCHEDULE
 	case this.Control.Battery.Power > 0:
 		this.messageType = home.ECOVACS_EVENT_BATTERYLEVEL
 	case this.Control.Clean.Type != "":
@@ -112,8 +175,22 @@ func (this *XMPPMessage) Value() interface{} {
 	case home.ECOVACS_EVENT_VERSION:
 		return this.Version()
 	case home.ECOVACS_EVENT_ERROR:
-		errNum, msg := this.Error()
-		return []interface{}{errNum, msg}
+		return this.DeviceError()
+	case home.ECOVACS_EVENT_POSITION, home.ECOVACS_EVENT_CHARGERPOSITION:
+		return this.Position()
+	case home.ECOVACS_EVENT_MAP:
+		return this.Control.I
+	case home.ECOVACS_EVENT_MAPPIECE:
+		id, piece, _ := this.MapPiece()
+		return []interface{}{id, piece}
+	case home.ECOVACS_EVENT_CLEANSUM:
+		return this.CleanSum()
+	case home.ECOVACS_EVENT_LOG:
+		return this.CleanLogs()
+	case home.ECOVACS_EVENT_SCHEDULE:
+		return this.Schedules()
+	case home.ECOVACS_EVENT_DND:
+		return this.DND()
 	default:
 		return this.data
 	}
@@ -124,37 +201,52 @@ func (this *XMPPMessage) Id() string {
 	return this.id
 }
 
+// Request returns the command which the message is a response to, or
+// an empty string if the message is a report or the command is unknown
+func (this *XMPPMessage) Request() string {
+	return this.request
+}
+
+// Ok returns true if the message is a successful response
+func (this *XMPPMessage) Ok() bool {
+	return this.Control.Ret == "ok"
+}
+
 func (this *XMPPMessage) BatteryLevel() uint {
 	return this.Control.Battery.Power
 }
 
 func (this *XMPPMessage) Error() (uint, string) {
-	return this.Control.ErrorNo, this.ErrorMsg()
+	return this.ErrorCode(), this.ErrorMsg()
+}
+
+// ErrorCode returns the errno attribute for a failed response, or the
+// first code in the errs attribute for an error report
+func (this *XMPPMessage) ErrorCode() uint {
+	if this.Control.ErrorNo != 0 {
+		return this.Control.ErrorNo
+	} else if errs := strings.SplitN(this.Control.Errs, ",", 2); errs[0] != "" {
+		code, _ := strconv.ParseUint(strings.TrimSpace(errs[0]), 10, 32)
+		return uint(code)
+	} else {
+		return 0
+	}
 }
 
 func (this *XMPPMessage) ErrorMsg() string {
 	if this.Control.Error != "" {
 		return this.Control.Error
 	} else {
-		switch this.Control.ErrorNo {
-		case 100:
-			return "NoError"
-		case 101:
-			return "BatteryLow"
-		case 102:
-			return "HostHang"
-		case 103:
-			return "WheelAbnormal"
-		case 104:
-			return "DownSensorAbnormal"
-		case 110:
-			return "NoDustBox"
-		default:
-			return fmt.Sprintf("Error%03d", this.Control.ErrorNo)
-		}
+		return ErrorForCode(this.ErrorCode(), "").Name
 	}
 }
 
+// DeviceError returns the catalogue entry for the error code, with
+// severity and the condition which caused it
+func (this *XMPPMessage) DeviceError() home.EcovacsError {
+	return ErrorForCode(this.ErrorCode(), this.Control.Error)
+}
+
 func (this *XMPPMessage) ChargeState() string {
 	return strings.ToLower(this.Control.Charge.Type)
 }
@@ -171,6 +263,141 @@ func (this *XMPPMessage) Version() string {
 	return this.Control.Version.Value
 }
 
+// Position returns the position of the robot or charger. The position
+// is returned as x,y in the p attribute and the angle in the a attribute
+func (this *XMPPMessage) Position() home.EcovacsPosition {
+	position := home.EcovacsPosition{Angle: this.Control.A}
+	if xy := strings.SplitN(this.Control.P, ",", 2); len(xy) == 2 {
+		position.X, _ = strconv.Atoi(strings.TrimSpace(xy[0]))
+		position.Y, _ = strconv.Atoi(strings.TrimSpace(xy[1]))
+	}
+	return position
+}
+
+// MapInfo returns the map metadata from a GetMapM response
+func (this *XMPPMessage) MapInfo() (MapInfo, error) {
+	info := MapInfo{
+		Id:          this.Control.I,
+		PieceWidth:  this.Control.W,
+		PieceHeight: this.Control.H,
+		Rows:        this.Control.R,
+		Columns:     this.Control.C,
+	}
+	if resolution, err := strconv.ParseUint(this.Control.P, 10, 32); err != nil {
+		return info, gopi.ErrUnexpectedResponse.WithPrefix("p")
+	} else {
+		info.Resolution = uint(resolution)
+	}
+	for _, field := range strings.Split(this.Control.M, ",") {
+		if crc, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32); err != nil {
+			return info, gopi.ErrUnexpectedResponse.WithPrefix("m")
+		} else {
+			info.CRC = append(info.CRC, uint32(crc))
+		}
+	}
+	if info.PieceWidth == 0 || info.PieceHeight == 0 || info.Resolution == 0 {
+		return info, gopi.ErrUnexpectedResponse.WithPrefix("GetMapM")
+	} else if uint(len(info.CRC)) != info.Rows*info.Columns {
+		return info, gopi.ErrUnexpectedResponse.WithPrefix("GetMapM")
+	}
+	return info, nil
+}
+
+// MapPiece returns the map identifier, piece number and compressed
+// data from a PullMP response
+func (this *XMPPMessage) MapPiece() (string, uint, []byte) {
+	piece, _ := strconv.ParseUint(this.Control.Pid, 10, 32)
+	data, _ := base64.StdEncoding.DecodeString(this.Control.P)
+	return this.Control.I, uint(piece), data
+}
+
+// CleanSum returns the total area, duration and count of cleans
+func (this *XMPPMessage) CleanSum() home.EcovacsCleanSum {
+	return home.EcovacsCleanSum{
+		Area:     uint(this.Control.A),
+		Duration: time.Duration(this.Control.L) * time.Second,
+		Count:    this.Control.C,
+	}
+}
+
+// CleanLogs returns cleaning sessions, most recent first
+func (this *XMPPMessage) CleanLogs() []home.EcovacsCleanLog {
+	logs := make([]home.EcovacsCleanLog, 0, len(this.Control.CleanSt))
+	for _, log := range this.Control.CleanSt {
+		logs = append(logs, home.EcovacsCleanLog{
+			Start:    time.Unix(log.S, 0),
+			Duration: time.Duration(log.L) * time.Second,
+			Area:     log.A,
+			Mode:     home.EcovacsCleanMode(strings.ToLower(log.T)),
+			Reason:   log.F,
+		})
+	}
+	return logs
+}
+
+// Schedules returns the cleaning schedules stored on the device
+func (this *XMPPMessage) Schedules() []home.EcovacsSchedule {
+	schedules := make([]home.EcovacsSchedule, 0, len(this.Control.Sched))
+	for _, s := range this.Control.Sched {
+		schedules = append(schedules, home.EcovacsSchedule{
+			Name:    s.N,
+			Enabled: s.O != 0,
+			Time:    time.Duration(s.H)*time.Hour + time.Duration(s.M)*time.Minute,
+			Days:    weekdaysForRepeat(s.R),
+			Mode:    home.EcovacsCleanMode(strings.ToLower(s.Ctl.Clean.Type)),
+			Suction: home.EcovacsCleanSuction(strings.ToLower(s.Ctl.Clean.Speed)),
+		})
+	}
+	return schedules
+}
+
+// DND returns the do-not-disturb window
+func (this *XMPPMessage) DND() home.EcovacsDND {
+	dnd := home.EcovacsDND{Enabled: this.Control.O != 0}
+	dnd.Start, _ = ParseTimeOfDay(this.Control.S)
+	dnd.End, _ = ParseTimeOfDay(this.Control.E)
+	return dnd
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SET PROPERTIES
+
+// SetRequest sets the command which the message is a response to, which
+// is used to determine the type of message
+func (this *XMPPMessage) SetRequest(td string) {
+	this.request = td
+	this.messageType = home.ECOVACS_EVENT_NONE
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// typeForCommand returns the message type for a command or report name
+func typeForCommand(td string) home.EcovacsEventType {
+	switch td {
+	case "GetPos", "Pos":
+		return home.ECOVACS_EVENT_POSITION
+	case "GetChargerPos", "ChargerPos":
+		return home.ECOVACS_EVENT_CHARGERPOSITION
+	case "GetMapM", "MapM":
+		return home.ECOVACS_EVENT_MAP
+	case "PullMP", "MapP":
+		return home.ECOVACS_EVENT_MAPPIECE
+	case "GetCleanSum", "CleanSum":
+		return home.ECOVACS_EVENT_CLEANSUM
+	case "GetCleanLogs", "CleanLogs":
+		return home.ECOVACS_EVENT_LOG
+	case "GetSched", "Sched":
+		return home.ECOVACS_EVENT_SCHEDULE
+	case "GetBlockTime", "BlockTime":
+		return home.ECOVACS_EVENT_DND
+	case "error":
+		return home.ECOVACS_EVENT_ERROR
+	default:
+		return home.ECOVACS_EVENT_NONE
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
@@ -198,6 +425,13 @@ func (this *XMPPMessage) Equals(other *XMPPMessage) bool {
 	if this.Type() != other.Type() {
 		return false
 	}
+	// Map messages match when the map or piece data is the same
+	switch this.Type() {
+	case home.ECOVACS_EVENT_MAP:
+		return this.Control.I == other.Control.I && this.Control.M == other.Control.M
+	case home.ECOVACS_EVENT_MAPPIECE:
+		return this.Control.I == other.Control.I && this.Control.Pid == other.Control.Pid && this.Control.P == other.Control.P
+	}
 	// Try and match values which are either uint, string or array
 	value := this.Value()
 	switch value.(type) {
@@ -213,6 +447,14 @@ func (this *XMPPMessage) Equals(other *XMPPMessage) bool {
 		} else {
 			return false
 		}
+	case home.EcovacsPosition:
+		return other.Value().(home.EcovacsPosition) == value
+	case home.EcovacsCleanSum:
+		return other.Value().(home.EcovacsCleanSum) == value
+	case home.EcovacsDND:
+		return other.Value().(home.EcovacsDND) == value
+	case home.EcovacsError:
+		return other.Value().(home.EcovacsError) == value
 	case []interface{}:
 		thisValues := this.Value().([]interface{})
 		otherValues := other.Value().([]interface{})
@@ -131,6 +131,18 @@ func (this *cast) Devices(ctx context.Context) ([]iface.CastDevice, error) {
 	return devices, nil
 }
 
+// Metrics returns the volume and message counters for each device
+func (this *cast) Metrics() []iface.Metric {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	metrics := []iface.Metric{}
+	for _, device := range this.devices {
+		metrics = append(metrics, device.metrics(this.Log.Name())...)
+	}
+	return metrics
+}
+
 func (this *cast) Connect(d iface.CastDevice, flags gopi.RPCFlag) error {
 	// Check parameters
 	if d == nil {
@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	// Frameworks
@@ -37,6 +38,10 @@ type Device struct {
 }
 
 type device struct {
+	// Counters are first for alignment of atomic operations
+	sent     uint64
+	received uint64
+
 	service gopi.RPCServiceRecord
 	txt     map[string]string
 	stop    chan struct{}
@@ -380,7 +385,7 @@ FOR_LOOP:
 					this.Log.Error(err)
 				} else if bytes_read != int(length) {
 					this.Log.Error(fmt.Errorf("Received different number of bytes %v read, expected %v", bytes_read, length))
-				} else if data, err := this.channel.decode(payload); err != nil {
+				} else if data, err := this.decode(payload); err != nil {
 					this.Log.Error(err)
 				} else if err := this.send(data); err != nil {
 					this.Log.Error(err)
@@ -398,10 +403,53 @@ func (this *device) send(data []byte) error {
 	} else if _, err := this.conn.Write(data); err != nil {
 		return err
 	} else {
+		atomic.AddUint64(&this.sent, 1)
 		return nil
 	}
 }
 
+// decode counts a received message and returns any reply
+func (this *device) decode(payload []byte) ([]byte, error) {
+	atomic.AddUint64(&this.received, 1)
+	return this.channel.decode(payload)
+}
+
+// metrics returns the volume and the number of messages sent
+// and received
+func (this *device) metrics(node string) []iface.Metric {
+	labels := map[string]string{
+		"node":   node,
+		"device": this.Id(),
+		"name":   this.Name(),
+	}
+	metrics := []iface.Metric{
+		iface.Metric{
+			Name:   "mutablehome_cast_messages_sent_total",
+			Help:   "Number of messages sent to a cast device",
+			Type:   iface.METRIC_COUNTER,
+			Labels: labels,
+			Value:  float64(atomic.LoadUint64(&this.sent)),
+		},
+		iface.Metric{
+			Name:   "mutablehome_cast_messages_received_total",
+			Help:   "Number of messages received from a cast device",
+			Type:   iface.METRIC_COUNTER,
+			Labels: labels,
+			Value:  float64(atomic.LoadUint64(&this.received)),
+		},
+	}
+	if volume := this.Volume(); volume != nil {
+		metrics = append(metrics, iface.Metric{
+			Name:   "mutablehome_cast_volume",
+			Help:   "Volume of a cast device between 0 and 1",
+			Type:   iface.METRIC_GAUGE,
+			Labels: labels,
+			Value:  float64(volume.Level()),
+		})
+	}
+	return metrics
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // GET PROPERTIES
 
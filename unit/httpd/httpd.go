@@ -9,6 +9,7 @@ package httpd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -16,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 
 	// Frameworks
@@ -36,6 +38,8 @@ type Httpd struct {
 type httpd struct {
 	log      gopi.Logger
 	server   *http.Server
+	mux      *http.ServeMux
+	paths    map[string]bool
 	iface    net.Interface
 	host     string
 	port     uint
@@ -117,6 +121,10 @@ func (this *httpd) Init(config Httpd) error {
 		this.register = config.Register
 	}
 
+	// Create handlers
+	this.mux = http.NewServeMux()
+	this.paths = make(map[string]bool)
+
 	// Return success
 	return nil
 }
@@ -174,9 +182,6 @@ func (this *httpd) BaseURL() string {
 }
 
 func (this *httpd) ServeStatic(folder string) (*url.URL, error) {
-	this.Mutex.Lock()
-	defer this.Mutex.Unlock()
-
 	// Check folder
 	if stat, err := os.Stat(folder); err != nil {
 		return nil, err
@@ -186,44 +191,46 @@ func (this *httpd) ServeStatic(folder string) (*url.URL, error) {
 		folder = filepath.Clean(folder)
 	}
 
-	// Make URL and serve
-	if url, err := url.Parse(this.BaseURL()); err != nil {
-		return nil, err
-	} else if this.server != nil {
+	// Serve files from the root path
+	if url, err := this.Handle("/", http.FileServer(http.Dir(folder))); errors.Is(err, gopi.ErrDuplicateItem) {
 		return nil, gopi.ErrOutOfOrder
 	} else {
-		this.server = &http.Server{}
-		this.server.Handler = http.FileServer(http.Dir(folder))
-		this.server.Addr = this.HostPort()
-
-		// Create a context for registration
-		ctx, cancel := context.WithCancel(context.Background())
-
-		// Serve files, cancel registration when done
-		go func(cancel context.CancelFunc) {
-			this.WaitGroup.Add(1)
-			defer this.WaitGroup.Done()
-			this.server.ListenAndServe()
-			cancel()
-		}(cancel)
-
-		// Register service
-		go func() {
-			this.WaitGroup.Add(1)
-			defer this.WaitGroup.Done()
-			this.register.Register(ctx, gopi.RPCServiceRecord{
-				Name:    this.host,
-				Service: SERVICE_TYPE_HTTP,
-				Port:    uint16(this.port),
-				Host:    this.host,
-				Addrs:   this.addrs,
-			})
-		}()
-
-		return url, nil
+		return url, err
 	}
 }
 
+func (this *httpd) Handle(path string, handler http.Handler) (*url.URL, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Check parameters
+	if handler == nil {
+		return nil, gopi.ErrBadParameter.WithPrefix("handler")
+	} else if strings.HasPrefix(path, "/") == false {
+		return nil, gopi.ErrBadParameter.WithPrefix(path)
+	} else if _, exists := this.paths[path]; exists {
+		return nil, gopi.ErrDuplicateItem.WithPrefix(path)
+	}
+
+	// Make URL for path
+	base, err := url.Parse(this.BaseURL())
+	if err != nil {
+		return nil, err
+	}
+
+	// Start server and add handler
+	if this.server == nil {
+		if err := this.serve(); err != nil {
+			return nil, err
+		}
+	}
+	this.mux.Handle(path, handler)
+	this.paths[path] = true
+
+	// Return URL for path
+	return base.ResolveReference(&url.URL{Path: path}), nil
+}
+
 func (this *httpd) Stop(ctx context.Context) error {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
@@ -240,6 +247,45 @@ func (this *httpd) Stop(ctx context.Context) error {
 ////////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
+// serve starts the server and registers the service, and the
+// registration is cancelled when the server ends. Requests are
+// accepted once serve returns
+func (this *httpd) serve() error {
+	listener, err := net.Listen("tcp", this.HostPort())
+	if err != nil {
+		return err
+	}
+	this.server = &http.Server{}
+	this.server.Handler = this.mux
+	this.server.Addr = this.HostPort()
+
+	// Create a context for registration
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Serve requests, cancel registration when done
+	this.WaitGroup.Add(2)
+	go func(cancel context.CancelFunc) {
+		defer this.WaitGroup.Done()
+		this.server.Serve(listener)
+		cancel()
+	}(cancel)
+
+	// Register service
+	go func() {
+		defer this.WaitGroup.Done()
+		this.register.Register(ctx, gopi.RPCServiceRecord{
+			Name:    this.host,
+			Service: SERVICE_TYPE_HTTP,
+			Port:    uint16(this.port),
+			Host:    this.host,
+			Addrs:   this.addrs,
+		})
+	}()
+
+	// Success
+	return nil
+}
+
 func unusedPort() (uint, error) {
 	if addr, err := net.ResolveTCPAddr("tcp", ":0"); err != nil {
 		return 0, err
@@ -50,3 +50,34 @@ func Main_Test_Http_001(app gopi.App, t *testing.T) {
 		t.Log(response)
 	}
 }
+
+func Test_Http_002(t *testing.T) {
+	if app, err := app.NewTestTool(t, Main_Test_Http_002, nil, "httpd"); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+func Main_Test_Http_002(app gopi.App, t *testing.T) {
+	httpd := app.UnitInstance("httpd").(mutablehome.HttpServer)
+	client := http.Client{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	if _, err := httpd.Handle("test", handler); err == nil {
+		t.Error("Expected error for path without leading slash")
+	} else if url, err := httpd.Handle("/test", handler); err != nil {
+		t.Error(err)
+	} else if _, err := httpd.Handle("/test", handler); err == nil {
+		t.Error("Expected error for duplicate path")
+	} else if response, err := client.Get(url.String()); err != nil {
+		t.Error(err)
+	} else if response.StatusCode != http.StatusOK {
+		t.Error("Unexpected status", response.Status)
+	} else {
+		response.Body.Close()
+		t.Log(url)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+	Mutablehome Automation: Hub
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package hub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// remote is a connection to a remote node
+type remote struct {
+	id      string
+	name    string
+	service string
+	conn    gopi.RPCClientConn
+	stub    mutablehome.NodeStub
+}
+
+// device is a device on a remote node, which forwards changes
+// to the remote node and retains the last known state. Vacuums are
+// not controlled through the hub, since the remote node API has no
+// clean or dock methods, so they are re-exported without vacuum state
+type device struct {
+	sync.Mutex
+
+	remote *remote
+	state  mutablehome.RemoteDevice
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func NewDevice(remote *remote, state mutablehome.RemoteDevice) *device {
+	return &device{remote: remote, state: state}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// REMOTE IMPLEMENTATION
+
+// Key returns the device id within the hub namespace
+func (this *remote) Key(id string) string {
+	return this.id + "/" + id
+}
+
+func (this *remote) String() string {
+	return "<remote id=" + strconv.Quote(this.id) + " name=" + strconv.Quote(this.name) + " service=" + strconv.Quote(this.service) + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// DEVICE IMPLEMENTATION
+
+func (this *device) Id() string {
+	return this.remote.Key(this.State().Id())
+}
+
+func (this *device) Name() string {
+	return this.State().Name()
+}
+
+func (this *device) Traits() []mutablehome.TraitType {
+	return this.State().Traits()
+}
+
+func (this *device) Power() mutablehome.TraitType {
+	return this.State().Power()
+}
+
+func (this *device) Brightness() float32 {
+	return this.State().Brightness()
+}
+
+func (this *device) Position() float32 {
+	return this.State().Position()
+}
+
+func (this *device) BatteryLevel() float32 {
+	return this.State().BatteryLevel()
+}
+
+func (this *device) SetPower(value mutablehome.TraitType) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if state, err := this.remote.stub.SetPower(ctx, this.State().Id(), value); err != nil {
+		return err
+	} else {
+		this.SetState(state)
+	}
+	return nil
+}
+
+func (this *device) SetBrightness(value float32, transition time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if state, err := this.remote.stub.SetBrightness(ctx, this.State().Id(), value, transition); err != nil {
+		return err
+	} else {
+		this.SetState(state)
+	}
+	return nil
+}
+
+func (this *device) SetPosition(value float32) error {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if state, err := this.remote.stub.SetPosition(ctx, this.State().Id(), value); err != nil {
+		return err
+	} else {
+		this.SetState(state)
+	}
+	return nil
+}
+
+func (this *device) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if state, err := this.remote.stub.Stop(ctx, this.State().Id()); err != nil {
+		return err
+	} else {
+		this.SetState(state)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STATE
+
+// State returns the last known state of the device
+func (this *device) State() mutablehome.RemoteDevice {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.state
+}
+
+// SetState updates the last known state of the device
+func (this *device) SetState(state mutablehome.RemoteDevice) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	if state != nil {
+		this.state = state
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *device) String() string {
+	str := "<hub.Device"
+	str += " id=" + strconv.Quote(this.Id())
+	str += " name=" + strconv.Quote(this.Name())
+	str += " traits=" + fmt.Sprint(this.Traits())
+	return str + ">"
+}
@@ -0,0 +1,83 @@
+/*
+	Mutablehome Automation: Hub
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package hub
+
+import (
+	"fmt"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type event struct {
+	Type_   mutablehome.EventType
+	Source_ mutablehome.Node
+	Device_ mutablehome.Device
+	Traits_ []mutablehome.TraitType
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func (this *hub) NewDeviceEvent(t mutablehome.EventType, d mutablehome.Device, traits ...mutablehome.TraitType) mutablehome.Event {
+	return &event{t, this, d, traits}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (*event) Name() string {
+	return "mutablehome.Event"
+}
+
+func (*event) NS() gopi.EventNS {
+	return gopi.EVENT_NS_DEFAULT
+}
+
+func (this *event) Source() gopi.Unit {
+	return this.Source_
+}
+
+func (this *event) Value() interface{} {
+	return this.Device_
+}
+
+func (this *event) Type() mutablehome.EventType {
+	return this.Type_
+}
+
+func (this *event) Node() mutablehome.Node {
+	return this.Source_
+}
+
+func (this *event) Device() mutablehome.Device {
+	return this.Device_
+}
+
+func (this *event) Traits() []mutablehome.TraitType {
+	return this.Traits_
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *event) String() string {
+	str := "<" + this.Name()
+	str += " type=" + fmt.Sprint(this.Type_)
+	if this.Device_ != nil {
+		str += " device=" + fmt.Sprint(this.Device_)
+	}
+	if len(this.Traits_) > 0 {
+		str += " traits=" + fmt.Sprint(this.Traits_)
+	}
+	return str + ">"
+}
@@ -0,0 +1,439 @@
+/*
+	Mutablehome Automation: Hub
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package hub
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type hub struct {
+	base.Unit
+	base.PubSub
+	sync.Mutex
+	sync.WaitGroup
+
+	id         string
+	interval   time.Duration
+	clientpool gopi.RPCClientPool
+	stop       chan struct{}
+	ignore     map[string]bool
+	nodes      map[string]*remote
+	devices    map[string]*device
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// Stub name for remote nodes
+	NODE_STUB = "mutablehome.Node"
+
+	// Discover nodes regularly, nodes which are removed are
+	// detected when the event stream ends
+	DISCOVERY_INTERVAL = 30 * time.Second
+	DISCOVERY_TIMEOUT  = 2 * time.Second
+
+	// Timeout for requests to remote nodes
+	REQUEST_TIMEOUT = 5 * time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (this *hub) Init(config Hub) error {
+	// Set client pool
+	if config.ClientPool == nil {
+		return gopi.ErrBadParameter.WithPrefix("ClientPool")
+	} else {
+		this.clientpool = config.ClientPool
+	}
+
+	// Set id, which defaults to the hostname
+	if config.Id != "" {
+		this.id = config.Id
+	} else if hostname, err := os.Hostname(); err != nil {
+		return err
+	} else {
+		this.id = hostname
+	}
+
+	// Set discovery interval
+	if config.Interval > 0 {
+		this.interval = config.Interval
+	} else {
+		this.interval = DISCOVERY_INTERVAL
+	}
+
+	// Create stop signal and maps
+	this.stop = make(chan struct{})
+	this.ignore = make(map[string]bool)
+	this.nodes = make(map[string]*remote)
+	this.devices = make(map[string]*device)
+
+	// Discover nodes in the background
+	this.WaitGroup.Add(1)
+	go this.BackgroundProcess(this.stop)
+
+	// Success
+	return nil
+}
+
+func (this *hub) Close() error {
+	// Close stop channel and wait for background processes to end,
+	// which disconnects from remote nodes
+	close(this.stop)
+	this.WaitGroup.Wait()
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Unsubscribe any listeners
+	if err := this.PubSub.Close(); err != nil {
+		return err
+	}
+
+	// Release resources
+	this.clientpool = nil
+	this.ignore = nil
+	this.nodes = nil
+	this.devices = nil
+	this.stop = nil
+
+	// Success
+	return this.Unit.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *hub) String() string {
+	str := "<" + this.Log.Name()
+	str += " id=" + strconv.Quote(this.id)
+	str += " interval=" + fmt.Sprint(this.interval)
+	str += " nodes=" + fmt.Sprint(this.Nodes())
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.Hub
+
+func (this *hub) Id() string {
+	return this.id
+}
+
+func (this *hub) Name() string {
+	return "Mutablehome Hub"
+}
+
+func (this *hub) Device(key string) mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device, exists := this.devices[key]; exists == false {
+		return nil
+	} else {
+		return device
+	}
+}
+
+func (this *hub) Devices() []mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	devices := make([]mutablehome.Device, 0, len(this.devices))
+	for _, device := range this.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Id() < devices[j].Id()
+	})
+	return devices
+}
+
+func (this *hub) Nodes() []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	nodes := make([]string, 0, len(this.nodes))
+	for id := range this.nodes {
+		nodes = append(nodes, id)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND PROCESS
+
+// BackgroundProcess regularly discovers remote nodes and connects
+// to any which are not yet connected
+func (this *hub) BackgroundProcess(stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+
+	this.Log.Debug("Start of background process")
+	ticker := time.NewTimer(500 * time.Millisecond)
+FOR_LOOP:
+	for {
+		select {
+		case <-ticker.C:
+			if err := this.Discover(stop); err != nil {
+				this.Log.Error(err)
+			}
+			ticker.Reset(this.interval)
+		case <-stop:
+			ticker.Stop()
+			break FOR_LOOP
+		}
+	}
+	this.Log.Debug("End of background process")
+}
+
+// StreamProcess receives events from a remote node and emits them
+// with devices in the hub namespace, until the stream ends or the
+// hub is closed. The remote node is then disconnected
+func (this *hub) StreamProcess(remote *remote, stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+
+	// Stream events in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	evts := remote.stub.Subscribe()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- remote.stub.StreamEvents(ctx, nil, nil)
+	}()
+
+	stopped := false
+FOR_LOOP:
+	for {
+		select {
+		case value := <-evts:
+			if evt, ok := value.(mutablehome.RemoteEvent); ok && stopped == false {
+				for _, evt := range this.ProcessEvent(remote, evt) {
+					this.Emit(evt)
+				}
+			}
+		case err := <-errs:
+			if err != nil && stopped == false {
+				this.Log.Warn(remote.id+":", err)
+			}
+			break FOR_LOOP
+		case <-stop:
+			// Cancel streaming, and drain events until the stream ends
+			stopped = true
+			stop = nil
+			cancel()
+		}
+	}
+
+	// Remove the remote node and its devices
+	remote.stub.Unsubscribe(evts)
+	for _, evt := range this.RemoveNode(remote) {
+		if stopped == false {
+			this.Emit(evt)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NODES
+
+// Discover looks up remote nodes on the network, and connects
+// to those which are not connected
+func (this *hub) Discover(stop <-chan struct{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DISCOVERY_TIMEOUT)
+	defer cancel()
+
+	records, err := this.clientpool.Lookup(ctx, mutablehome.SERVICE_TYPE_NODE, 0)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if this.isConnected(record.Name) {
+			continue
+		} else if err := this.AddNode(record, stop); err != nil {
+			this.Log.Warn(strconv.Quote(record.Name)+":", err)
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// AddNode connects to a remote node, adds devices and starts
+// streaming events
+func (this *hub) AddNode(record gopi.RPCServiceRecord, stop <-chan struct{}) error {
+	conn, err := this.clientpool.Connect(record, gopi.RPC_FLAG_INET_V4|gopi.RPC_FLAG_INET_V6)
+	if err != nil {
+		return err
+	}
+	stub, ok := this.clientpool.CreateStub(NODE_STUB, conn).(mutablehome.NodeStub)
+	if ok == false {
+		this.clientpool.Disconnect(conn)
+		return gopi.ErrInternalAppError.WithPrefix("CreateStub")
+	}
+
+	// Get metadata and devices for the node
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	metadata, err := stub.Metadata(ctx)
+	if err != nil {
+		this.disconnect(conn, stub)
+		return err
+	}
+	devices, err := stub.Devices(ctx)
+	if err != nil {
+		this.disconnect(conn, stub)
+		return err
+	}
+
+	// Add node and devices
+	remote := &remote{metadata.Id(), metadata.Name(), record.Name, conn, stub}
+	evts := make([]mutablehome.Event, 0, len(devices))
+	this.Mutex.Lock()
+	if remote.id == this.id {
+		// Ignore services for this hub
+		this.ignore[record.Name] = true
+		this.Mutex.Unlock()
+		this.disconnect(conn, stub)
+		return nil
+	} else if _, exists := this.nodes[remote.id]; exists {
+		// Node is already connected through another service
+		this.Mutex.Unlock()
+		this.disconnect(conn, stub)
+		return nil
+	} else {
+		this.nodes[remote.id] = remote
+		for _, state := range devices {
+			device := NewDevice(remote, state)
+			this.devices[device.Id()] = device
+			evts = append(evts, this.NewDeviceEvent(mutablehome.EVENT_DEVICE_ADDED, device))
+		}
+	}
+	this.Mutex.Unlock()
+
+	this.Log.Info("Connected:", remote)
+
+	// Emit device added events
+	for _, evt := range evts {
+		this.Emit(evt)
+	}
+
+	// Stream events from the remote node
+	this.WaitGroup.Add(1)
+	go this.StreamProcess(remote, stop)
+
+	// Success
+	return nil
+}
+
+// RemoveNode removes a remote node and its devices, disconnects from
+// the node and returns device removed events
+func (this *hub) RemoveNode(remote *remote) []mutablehome.Event {
+	evts := []mutablehome.Event{}
+
+	this.Mutex.Lock()
+	delete(this.nodes, remote.id)
+	for key, device := range this.devices {
+		if device.remote == remote {
+			delete(this.devices, key)
+			evts = append(evts, this.NewDeviceEvent(mutablehome.EVENT_DEVICE_REMOVED, device))
+		}
+	}
+	this.Mutex.Unlock()
+
+	this.Log.Info("Disconnected:", remote)
+	this.disconnect(remote.conn, remote.stub)
+
+	return evts
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EVENTS
+
+// ProcessEvent updates devices from a remote node event and returns
+// events for the hub
+func (this *hub) ProcessEvent(remote *remote, evt mutablehome.RemoteEvent) []mutablehome.Event {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	switch evt.Type() {
+	case mutablehome.EVENT_NODE_ONLINE:
+		this.Log.Info(remote.id + ": Online")
+	case mutablehome.EVENT_NODE_OFFLINE:
+		this.Log.Info(remote.id + ": Offline")
+	case mutablehome.EVENT_DEVICE_ADDED, mutablehome.EVENT_DEVICE_METADATA_CHANGED, mutablehome.EVENT_DEVICE_TRAIT_CHANGED:
+		if state, ok := evt.Device().(mutablehome.RemoteDevice); ok == false {
+			break
+		} else if device, exists := this.devices[remote.Key(state.Id())]; exists == false {
+			device := NewDevice(remote, state)
+			this.devices[device.Id()] = device
+			return []mutablehome.Event{this.NewDeviceEvent(mutablehome.EVENT_DEVICE_ADDED, device)}
+		} else if evt.Type() == mutablehome.EVENT_DEVICE_ADDED {
+			device.SetState(state)
+			return []mutablehome.Event{this.NewDeviceEvent(mutablehome.EVENT_DEVICE_METADATA_CHANGED, device)}
+		} else {
+			device.SetState(state)
+			return []mutablehome.Event{this.NewDeviceEvent(evt.Type(), device, evt.Traits()...)}
+		}
+	case mutablehome.EVENT_DEVICE_REMOVED:
+		if state := evt.Device(); state == nil {
+			break
+		} else if device, exists := this.devices[remote.Key(state.Id())]; exists {
+			delete(this.devices, device.Id())
+			return []mutablehome.Event{this.NewDeviceEvent(mutablehome.EVENT_DEVICE_REMOVED, device)}
+		}
+	default:
+		this.Log.Warn("Ignoring:", evt)
+	}
+
+	// No events to emit
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// isConnected returns true if a service is connected or ignored
+func (this *hub) isConnected(service string) bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if this.ignore[service] {
+		return true
+	}
+	for _, remote := range this.nodes {
+		if remote.service == service {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *hub) disconnect(conn gopi.RPCClientConn, stub mutablehome.NodeStub) {
+	if err := stub.Close(); err != nil {
+		this.Log.Warn(err)
+	}
+	if err := this.clientpool.Disconnect(conn); err != nil {
+		this.Log.Warn(err)
+	}
+}
@@ -0,0 +1,415 @@
+package hub_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+	hub "github.com/djthorpe/mutablehome/unit/hub"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// REMOTE DEVICES AND EVENTS
+
+type device struct {
+	id, name   string
+	power      mutablehome.TraitType
+	brightness float32
+	position   float32
+}
+
+func (this *device) Id() string                   { return this.id }
+func (this *device) Name() string                 { return this.name }
+func (this *device) Power() mutablehome.TraitType { return this.power }
+func (this *device) Brightness() float32          { return this.brightness }
+func (this *device) Position() float32            { return this.position }
+func (this *device) BatteryLevel() float32        { return 0 }
+func (this *device) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_LIGHT_BRIGHTNESS}
+}
+
+type event struct {
+	t      mutablehome.EventType
+	node   string
+	device mutablehome.RemoteDevice
+	traits []mutablehome.TraitType
+}
+
+func (*event) Name() string                         { return "mutablehome.Event" }
+func (*event) NS() gopi.EventNS                     { return gopi.EVENT_NS_DEFAULT }
+func (*event) Source() gopi.Unit                    { return nil }
+func (this *event) Value() interface{}              { return this.device }
+func (this *event) Type() mutablehome.EventType     { return this.t }
+func (*event) Node() mutablehome.Node               { return nil }
+func (this *event) NodeId() string                  { return this.node }
+func (this *event) Device() mutablehome.Device      { return this.device }
+func (this *event) Traits() []mutablehome.TraitType { return this.traits }
+
+////////////////////////////////////////////////////////////////////////////////
+// REMOTE NODES
+
+type metadata struct {
+	id string
+}
+
+func (this metadata) Id() string            { return this.id }
+func (this metadata) Name() string          { return "Node " + this.id }
+func (this metadata) Uptime() time.Duration { return time.Second }
+
+type stub struct {
+	base.PubSub
+	sync.Mutex
+
+	id      string
+	devices []*device
+	events  chan mutablehome.RemoteEvent
+	end     chan error
+}
+
+func NewStub(id string, devices ...*device) *stub {
+	return &stub{id: id, devices: devices, events: make(chan mutablehome.RemoteEvent), end: make(chan error)}
+}
+
+func (this *stub) Conn() gopi.RPCClientConn { return nil }
+func (this *stub) Close() error             { return this.PubSub.Close() }
+func (this *stub) String() string           { return "<stub id=" + this.id + ">" }
+func (this *stub) Ping(context.Context) error {
+	return nil
+}
+
+func (this *stub) Metadata(context.Context) (mutablehome.NodeMetadata, error) {
+	return metadata{this.id}, nil
+}
+
+func (this *stub) Devices(context.Context) ([]mutablehome.RemoteDevice, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	devices := make([]mutablehome.RemoteDevice, len(this.devices))
+	for i, device := range this.devices {
+		copy := *device
+		devices[i] = &copy
+	}
+	return devices, nil
+}
+
+func (this *stub) Device(_ context.Context, id string) (mutablehome.RemoteDevice, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	for _, device := range this.devices {
+		if device.id == id {
+			copy := *device
+			return &copy, nil
+		}
+	}
+	return nil, gopi.ErrNotFound.WithPrefix(id)
+}
+
+func (this *stub) SetPower(ctx context.Context, id string, power mutablehome.TraitType) (mutablehome.RemoteDevice, error) {
+	this.Mutex.Lock()
+	for _, device := range this.devices {
+		if device.id == id {
+			device.power = power
+		}
+	}
+	this.Mutex.Unlock()
+	return this.Device(ctx, id)
+}
+
+func (this *stub) SetBrightness(ctx context.Context, id string, brightness float32, _ time.Duration) (mutablehome.RemoteDevice, error) {
+	this.Mutex.Lock()
+	for _, device := range this.devices {
+		if device.id == id {
+			device.brightness = brightness
+		}
+	}
+	this.Mutex.Unlock()
+	return this.Device(ctx, id)
+}
+
+func (this *stub) SetPosition(ctx context.Context, id string, position float32) (mutablehome.RemoteDevice, error) {
+	this.Mutex.Lock()
+	for _, device := range this.devices {
+		if device.id == id {
+			device.position = position
+		}
+	}
+	this.Mutex.Unlock()
+	return this.Device(ctx, id)
+}
+
+func (this *stub) Stop(ctx context.Context, id string) (mutablehome.RemoteDevice, error) {
+	return this.Device(ctx, id)
+}
+
+func (this *stub) StreamEvents(ctx context.Context, _ []string, _ []mutablehome.EventType) error {
+	for {
+		select {
+		case evt := <-this.events:
+			this.Emit(evt)
+		case err := <-this.end:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (this *stub) LastValue(context.Context, string, mutablehome.TraitType) (mutablehome.StoreValue, error) {
+	return nil, gopi.ErrNotImplemented
+}
+
+func (this *stub) History(context.Context, string, mutablehome.TraitType, time.Time, time.Time) ([]mutablehome.StoreValue, error) {
+	return nil, gopi.ErrNotImplemented
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CLIENT POOL
+
+type conn struct {
+	base.Unit
+	sync.Mutex
+	name string
+}
+
+func (this *conn) Addr() string                { return this.name }
+func (this *conn) Services() ([]string, error) { return []string{"mutablehome.Node"}, nil }
+
+type clientpool struct {
+	base.Unit
+	sync.Mutex
+	stubs map[string]*stub
+}
+
+func NewClientPool(stubs map[string]*stub) *clientpool {
+	return &clientpool{stubs: stubs}
+}
+
+// Remove stops a stub from being discovered
+func (this *clientpool) Remove(name string) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	delete(this.stubs, name)
+}
+
+func (this *clientpool) Lookup(_ context.Context, service string, _ uint) ([]gopi.RPCServiceRecord, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	records := []gopi.RPCServiceRecord{}
+	for name := range this.stubs {
+		records = append(records, gopi.RPCServiceRecord{Name: name, Service: service})
+	}
+	return records, nil
+}
+
+func (this *clientpool) Connect(record gopi.RPCServiceRecord, _ gopi.RPCFlag) (gopi.RPCClientConn, error) {
+	return &conn{name: record.Name}, nil
+}
+
+func (this *clientpool) ConnectAddr(net.IP, uint16) (gopi.RPCClientConn, error) {
+	return nil, gopi.ErrNotImplemented
+}
+
+func (this *clientpool) ConnectFifo(string) (gopi.RPCClientConn, error) {
+	return nil, gopi.ErrNotImplemented
+}
+
+func (this *clientpool) Disconnect(conn gopi.RPCClientConn) error {
+	return nil
+}
+
+func (this *clientpool) CreateStub(name string, conn gopi.RPCClientConn) gopi.RPCClientStub {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.stubs[conn.Addr()]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Hub_000(t *testing.T) {
+	t.Log("Test_Hub_000")
+}
+
+func Test_Hub_001(t *testing.T) {
+	RunWithHub(t, NewClientPool(map[string]*stub{}), func(app gopi.App, hub mutablehome.Hub, t *testing.T) {
+		if hub.Id() != "hub" {
+			t.Error("Unexpected id", hub.Id())
+		}
+		if nodes := hub.Nodes(); len(nodes) != 0 {
+			t.Error("Unexpected nodes", nodes)
+		}
+		t.Log(hub)
+	})
+}
+
+func Test_Hub_002(t *testing.T) {
+	stubs := map[string]*stub{
+		"a":    NewStub("a", &device{id: "1", name: "Lamp"}, &device{id: "2", name: "Plug"}),
+		"b":    NewStub("b", &device{id: "1", name: "Light"}),
+		"self": NewStub("hub"),
+	}
+	RunWithHub(t, NewClientPool(stubs), func(app gopi.App, hub mutablehome.Hub, t *testing.T) {
+		evts := hub.Subscribe()
+		defer hub.Unsubscribe(evts)
+
+		// Wait for devices to be added
+		added := WaitForEvents(t, evts, mutablehome.EVENT_DEVICE_ADDED, 3)
+		if len(added) != 3 {
+			t.Fatal("Unexpected added devices", added)
+		}
+		if nodes := hub.Nodes(); len(nodes) != 2 || nodes[0] != "a" || nodes[1] != "b" {
+			t.Error("Unexpected nodes", nodes)
+		}
+		for _, key := range []string{"a/1", "a/2", "b/1"} {
+			if device := hub.Device(key); device == nil {
+				t.Error("Missing device", key)
+			} else if device.Id() != key {
+				t.Error("Unexpected device id", device.Id())
+			}
+		}
+		if device := hub.Device("1"); device != nil {
+			t.Error("Unexpected device", device)
+		}
+	})
+}
+
+func Test_Hub_003(t *testing.T) {
+	stubs := map[string]*stub{
+		"a": NewStub("a", &device{id: "1", name: "Lamp", power: mutablehome.TRAIT_POWER_OFF}),
+	}
+	RunWithHub(t, NewClientPool(stubs), func(app gopi.App, hub mutablehome.Hub, t *testing.T) {
+		evts := hub.Subscribe()
+		defer hub.Unsubscribe(evts)
+
+		if added := WaitForEvents(t, evts, mutablehome.EVENT_DEVICE_ADDED, 1); len(added) != 1 {
+			t.Fatal("Unexpected added devices", added)
+		}
+
+		// Set power and brightness through the hub
+		if power, ok := hub.Device("a/1").(mutablehome.PowerTrait); ok == false {
+			t.Fatal("Expected PowerTrait")
+		} else if err := power.SetPower(mutablehome.TRAIT_POWER_ON); err != nil {
+			t.Error(err)
+		} else if power.Power() != mutablehome.TRAIT_POWER_ON {
+			t.Error("Unexpected power", power.Power())
+		}
+		if light, ok := hub.Device("a/1").(mutablehome.LightTrait); ok == false {
+			t.Fatal("Expected LightTrait")
+		} else if err := light.SetBrightness(0.5, 0); err != nil {
+			t.Error(err)
+		} else if light.Brightness() != 0.5 {
+			t.Error("Unexpected brightness", light.Brightness())
+		}
+		if cover, ok := hub.Device("a/1").(mutablehome.CoverTrait); ok == false {
+			t.Fatal("Expected CoverTrait")
+		} else if err := cover.SetPosition(1); err != nil {
+			t.Error(err)
+		} else if cover.Position() != 1 {
+			t.Error("Unexpected position", cover.Position())
+		} else if err := cover.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func Test_Hub_004(t *testing.T) {
+	a := NewStub("a", &device{id: "1", name: "Lamp"})
+	clientpool := NewClientPool(map[string]*stub{"a": a})
+	RunWithHub(t, clientpool, func(app gopi.App, hub mutablehome.Hub, t *testing.T) {
+		evts := hub.Subscribe()
+		defer hub.Unsubscribe(evts)
+
+		if added := WaitForEvents(t, evts, mutablehome.EVENT_DEVICE_ADDED, 1); len(added) != 1 {
+			t.Fatal("Unexpected added devices", added)
+		}
+
+		// Remote trait changed is emitted in the hub namespace
+		go func() {
+			a.events <- &event{mutablehome.EVENT_DEVICE_TRAIT_CHANGED, "a", &device{id: "1", name: "Lamp", power: mutablehome.TRAIT_POWER_ON}, []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON}}
+		}()
+		if changed := WaitForEvents(t, evts, mutablehome.EVENT_DEVICE_TRAIT_CHANGED, 1); len(changed) != 1 {
+			t.Fatal("Unexpected changed devices", changed)
+		} else if changed[0].Device().Id() != "a/1" {
+			t.Error("Unexpected device", changed[0].Device())
+		} else if traits := changed[0].Traits(); len(traits) != 1 || traits[0] != mutablehome.TRAIT_POWER_ON {
+			t.Error("Unexpected traits", traits)
+		} else if changed[0].Node() != hub {
+			t.Error("Unexpected node", changed[0].Node())
+		} else if power := changed[0].Device().(mutablehome.PowerTrait).Power(); power != mutablehome.TRAIT_POWER_ON {
+			t.Error("Unexpected power", power)
+		}
+
+		// Remote device added is emitted
+		go func() {
+			a.events <- &event{mutablehome.EVENT_DEVICE_ADDED, "a", &device{id: "2", name: "Plug"}, nil}
+		}()
+		if added := WaitForEvents(t, evts, mutablehome.EVENT_DEVICE_ADDED, 1); len(added) != 1 {
+			t.Fatal("Unexpected added devices", added)
+		} else if added[0].Device().Id() != "a/2" {
+			t.Error("Unexpected device", added[0].Device())
+		}
+
+		// When the stream ends, the node and devices are removed
+		clientpool.Remove("a")
+		go func() {
+			a.end <- gopi.ErrUnexpectedResponse
+		}()
+		if removed := WaitForEvents(t, evts, mutablehome.EVENT_DEVICE_REMOVED, 2); len(removed) != 2 {
+			t.Fatal("Unexpected removed devices", removed)
+		} else if nodes := hub.Nodes(); len(nodes) != 0 {
+			t.Error("Unexpected nodes", nodes)
+		} else if device := hub.Device("a/1"); device != nil {
+			t.Error("Unexpected device", device)
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func RunWithHub(t *testing.T, clientpool *clientpool, main func(gopi.App, mutablehome.Hub, *testing.T)) {
+	t.Helper()
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(hub.Hub{
+			Id:         "hub",
+			Interval:   100 * time.Millisecond,
+			ClientPool: clientpool,
+		}, app.Log().Clone(hub.Hub{}.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(app, unit.(mutablehome.Hub), t)
+	}, nil); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+// WaitForEvents returns when a number of events of a type have been
+// received, or after a timeout
+func WaitForEvents(t *testing.T, evts <-chan interface{}, eventType mutablehome.EventType, count int) []mutablehome.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	matched := []mutablehome.Event{}
+	for len(matched) < count {
+		select {
+		case value := <-evts:
+			if evt, ok := value.(mutablehome.Event); ok && evt.Type() == eventType {
+				matched = append(matched, evt)
+			}
+		case <-timeout:
+			t.Error("Timeout waiting for", eventType)
+			return matched
+		}
+	}
+	return matched
+}
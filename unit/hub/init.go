@@ -0,0 +1,35 @@
+/*
+	Mutablehome Automation: Hub
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package hub
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	// Hub aggregates remote nodes
+	gopi.UnitRegister(gopi.UnitConfig{
+		Name:     Hub{}.Name(),
+		Requires: []string{"clientpool"},
+		Config: func(app gopi.App) error {
+			app.Flags().FlagString("hub.id", "", "Unique identifier")
+			app.Flags().FlagDuration("hub.interval", 0, "Node discovery interval")
+			return nil
+		},
+		New: func(app gopi.App) (gopi.Unit, error) {
+			return gopi.New(Hub{
+				Id:         app.Flags().GetString("hub.id", gopi.FLAG_NS_DEFAULT),
+				Interval:   app.Flags().GetDuration("hub.interval", gopi.FLAG_NS_DEFAULT),
+				ClientPool: app.UnitInstance("clientpool").(gopi.RPCClientPool),
+			}, app.Log().Clone(Hub{}.Name()))
+		},
+	})
+}
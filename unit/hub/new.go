@@ -0,0 +1,40 @@
+/*
+	Mutablehome Automation: Hub
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package hub
+
+import (
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Hub struct {
+	Id         string
+	Interval   time.Duration
+	ClientPool gopi.RPCClientPool
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (Hub) Name() string { return "mutablehome/hub" }
+
+func (config Hub) New(log gopi.Logger) (gopi.Unit, error) {
+	this := new(hub)
+	if err := this.Unit.Init(log); err != nil {
+		return nil, err
+	}
+	if err := this.Init(config); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
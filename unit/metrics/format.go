@@ -0,0 +1,103 @@
+/*
+	Mutablehome Automation: Metrics
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TEXT FORMAT
+
+// writeMetrics writes metrics in the Prometheus text format, where
+// metrics are grouped by name and sorted by name and labels
+func writeMetrics(w io.Writer, metrics []mutablehome.Metric) error {
+	// Group metrics by name
+	groups := make(map[string][]mutablehome.Metric)
+	names := []string{}
+	for _, metric := range metrics {
+		if metric.Name == "" {
+			continue
+		} else if _, exists := groups[metric.Name]; exists == false {
+			names = append(names, metric.Name)
+		}
+		groups[metric.Name] = append(groups[metric.Name], metric)
+	}
+	sort.Strings(names)
+
+	// Write each group with help and type from the first metric
+	buf := bufio.NewWriter(w)
+	for _, name := range names {
+		group := groups[name]
+		if help := group[0].Help; help != "" {
+			buf.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+		}
+		switch group[0].Type {
+		case mutablehome.METRIC_GAUGE:
+			buf.WriteString("# TYPE " + name + " gauge\n")
+		case mutablehome.METRIC_COUNTER:
+			buf.WriteString("# TYPE " + name + " counter\n")
+		}
+		lines := make([]string, len(group))
+		for i, metric := range group {
+			lines[i] = name + formatLabels(metric.Labels) + " " + formatValue(metric.Value) + "\n"
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			buf.WriteString(line)
+		}
+	}
+	return buf.Flush()
+}
+
+// formatLabels returns labels sorted by name, or an empty string
+// if there are no labels
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=\"" + escapeLabel(labels[k]) + "\""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(value)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"").Replace(value)
+}
@@ -0,0 +1,34 @@
+/*
+	Mutablehome Automation: Metrics
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package metrics
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	// Prometheus metrics
+	gopi.UnitRegister(gopi.UnitConfig{
+		Name:     Metrics{}.Name(),
+		Requires: []string{"httpd"},
+		Config: func(app gopi.App) error {
+			app.Flags().FlagString("metrics.path", DEFAULT_PATH, "Path for metrics")
+			return nil
+		},
+		New: func(app gopi.App) (gopi.Unit, error) {
+			return gopi.New(Metrics{
+				Server: app.UnitInstance("httpd").(mutablehome.HttpServer),
+				Path:   app.Flags().GetString("metrics.path", gopi.FLAG_NS_DEFAULT),
+			}, app.Log().Clone(Metrics{}.Name()))
+		},
+	})
+}
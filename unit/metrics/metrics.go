@@ -0,0 +1,286 @@
+/*
+	Mutablehome Automation: Metrics
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type metrics struct {
+	base.Unit
+	sync.Mutex
+	sync.WaitGroup
+
+	path    string
+	devices map[string]*device
+	nodes   map[string]bool
+	sources []mutablehome.MetricsSource
+	stop    chan struct{}
+}
+
+// device holds the trait values for a device
+type device struct {
+	node, id, name string
+	values         map[string]float64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	DEFAULT_PATH = "/metrics"
+
+	// Content type for the Prometheus text format
+	CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+const (
+	METRIC_POWER      = "mutablehome_device_power"
+	METRIC_BRIGHTNESS = "mutablehome_device_brightness"
+	METRIC_POSITION   = "mutablehome_device_position"
+	METRIC_BATTERY    = "mutablehome_device_battery_level"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBAL VARIABLES
+
+var (
+	help = map[string]string{
+		METRIC_POWER:      "Power state of a device, 1 when on and 0 when off or in standby",
+		METRIC_BRIGHTNESS: "Brightness of a light between 0 and 1",
+		METRIC_POSITION:   "Position of a cover between 0 (closed) and 1 (open)",
+		METRIC_BATTERY:    "Battery level of a device between 0 and 1",
+	}
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (this *metrics) Init(config Metrics) error {
+	this.path = DEFAULT_PATH
+	if config.Path != "" {
+		this.path = config.Path
+	}
+	this.devices = make(map[string]*device)
+	this.nodes = make(map[string]bool)
+	this.stop = make(chan struct{})
+
+	// Serve metrics
+	if config.Server != nil {
+		if url, err := config.Server.Handle(this.path, this); err != nil {
+			return err
+		} else {
+			this.Log.Info("Serving metrics on", url)
+		}
+	}
+
+	// Success
+	return nil
+}
+
+func (this *metrics) Close() error {
+	// Stop event processes and wait for them to end
+	close(this.stop)
+	this.WaitGroup.Wait()
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Release resources
+	this.devices = nil
+	this.nodes = nil
+	this.sources = nil
+	this.stop = nil
+
+	// Success
+	return this.Unit.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *metrics) String() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return "<" + this.Log.Name() +
+		" path=" + strconv.Quote(this.path) +
+		" devices=" + fmt.Sprint(len(this.devices)) +
+		" sources=" + fmt.Sprint(len(this.sources)) +
+		">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.Metrics
+
+func (this *metrics) AddNode(node mutablehome.Node) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if node == nil {
+		return gopi.ErrBadParameter.WithPrefix("node")
+	} else if _, exists := this.nodes[node.Id()]; exists {
+		return gopi.ErrDuplicateItem.WithPrefix(strconv.Quote(node.Id()))
+	} else {
+		this.nodes[node.Id()] = true
+	}
+
+	// Update trait values for node events
+	this.WaitGroup.Add(1)
+	go this.EventProcess(node, node.Subscribe(), this.stop)
+
+	// Success
+	return nil
+}
+
+func (this *metrics) AddSource(source mutablehome.MetricsSource) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if source == nil {
+		return gopi.ErrBadParameter.WithPrefix("source")
+	}
+	for _, other := range this.sources {
+		if other == source {
+			return gopi.ErrDuplicateItem.WithPrefix("source")
+		}
+	}
+	this.sources = append(this.sources, source)
+
+	// Success
+	return nil
+}
+
+// Metrics returns trait values for devices and values from sources
+func (this *metrics) Metrics() []mutablehome.Metric {
+	this.Mutex.Lock()
+	sources := this.sources
+	metrics := make([]mutablehome.Metric, 0, len(this.devices)*2)
+	for _, device := range this.devices {
+		for name, value := range device.values {
+			metrics = append(metrics, mutablehome.Metric{
+				Name:   name,
+				Help:   help[name],
+				Type:   mutablehome.METRIC_GAUGE,
+				Labels: device.labels(),
+				Value:  value,
+			})
+		}
+	}
+	this.Mutex.Unlock()
+
+	// Read values from sources without holding the lock
+	for _, source := range sources {
+		metrics = append(metrics, source.Metrics()...)
+	}
+
+	// Return metrics
+	return metrics
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION http.Handler
+
+func (this *metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	if req.Method == http.MethodHead {
+		return
+	}
+	if err := writeMetrics(w, this.Metrics()); err != nil {
+		this.Log.Debug("ServeHTTP:", err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND PROCESSES
+
+// EventProcess updates trait values for node events until the unit is
+// closed or the node stops emitting events
+func (this *metrics) EventProcess(node mutablehome.Node, evts <-chan interface{}, stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+	mutablehome.ProcessEvents(node, evts, stop, func(evt mutablehome.Event) {
+		this.ProcessEvent(mutablehome.NodeId(node, evt), evt)
+	})
+}
+
+// ProcessEvent updates or removes trait values for a device
+func (this *metrics) ProcessEvent(node string, evt mutablehome.Event) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if evt.Device() == nil {
+		return
+	}
+	key := node + "/" + evt.Device().Id()
+	switch evt.Type() {
+	case mutablehome.EVENT_DEVICE_ADDED, mutablehome.EVENT_DEVICE_TRAIT_CHANGED:
+		this.devices[key] = NewDevice(node, evt.Device())
+	case mutablehome.EVENT_DEVICE_REMOVED:
+		delete(this.devices, key)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// DEVICE
+
+// NewDevice returns the trait values for a device
+func NewDevice(node string, d mutablehome.Device) *device {
+	this := &device{node, d.Id(), d.Name(), make(map[string]float64)}
+	for _, trait := range d.Traits() {
+		switch trait {
+		case mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_POWER_STANDBY:
+			if power, ok := d.(mutablehome.PowerTrait); ok {
+				switch power.Power() {
+				case mutablehome.TRAIT_POWER_ON:
+					this.values[METRIC_POWER] = 1
+				case mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_POWER_STANDBY:
+					this.values[METRIC_POWER] = 0
+				}
+			}
+		case mutablehome.TRAIT_LIGHT_BRIGHTNESS:
+			if light, ok := d.(mutablehome.LightTrait); ok {
+				this.values[METRIC_BRIGHTNESS] = float64(light.Brightness())
+			}
+		case mutablehome.TRAIT_COVER_POSITION:
+			if cover, ok := d.(mutablehome.CoverTrait); ok {
+				this.values[METRIC_POSITION] = float64(cover.Position())
+			}
+		case mutablehome.TRAIT_BATTERY_LEVEL:
+			if battery, ok := d.(mutablehome.BatteryTrait); ok {
+				this.values[METRIC_BATTERY] = float64(battery.BatteryLevel())
+			}
+		}
+	}
+	return this
+}
+
+func (this *device) labels() map[string]string {
+	labels := map[string]string{
+		"node":   this.node,
+		"device": this.id,
+	}
+	if this.name != "" {
+		labels["name"] = this.name
+	}
+	return labels
+}
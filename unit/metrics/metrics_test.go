@@ -0,0 +1,198 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NODE, DEVICES, EVENTS AND SOURCES
+
+type node struct {
+	base.PubSub
+}
+
+func (*node) Id() string                       { return "node" }
+func (*node) Name() string                     { return "Node" }
+func (*node) Device(string) mutablehome.Device { return nil }
+func (*node) Devices() []mutablehome.Device    { return nil }
+
+type light struct {
+	id         string
+	name       string
+	power      mutablehome.TraitType
+	brightness float32
+}
+
+func (this *light) Id() string                                 { return this.id }
+func (this *light) Name() string                               { return this.name }
+func (this *light) Power() mutablehome.TraitType               { return this.power }
+func (this *light) SetPower(mutablehome.TraitType) error       { return gopi.ErrNotImplemented }
+func (this *light) Brightness() float32                        { return this.brightness }
+func (this *light) SetBrightness(float32, time.Duration) error { return gopi.ErrNotImplemented }
+func (this *light) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_LIGHT_BRIGHTNESS}
+}
+
+type event struct {
+	t      mutablehome.EventType
+	device mutablehome.Device
+}
+
+func (*event) Name() string                     { return "mutablehome.Event" }
+func (*event) NS() gopi.EventNS                 { return gopi.EVENT_NS_DEFAULT }
+func (*event) Source() gopi.Unit                { return nil }
+func (this *event) Value() interface{}          { return this.device }
+func (this *event) Type() mutablehome.EventType { return this.t }
+func (*event) Node() mutablehome.Node           { return nil }
+func (this *event) Device() mutablehome.Device  { return this.device }
+func (*event) Traits() []mutablehome.TraitType  { return nil }
+
+type source struct {
+	count float64
+}
+
+func (this *source) Metrics() []mutablehome.Metric {
+	return []mutablehome.Metric{
+		mutablehome.Metric{
+			Name:   "test_errors_total",
+			Help:   "Number of errors",
+			Type:   mutablehome.METRIC_COUNTER,
+			Labels: map[string]string{"name": "a \"quoted\" value"},
+			Value:  this.count,
+		},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Metrics_000(t *testing.T) {
+	t.Log("Test_Metrics_000")
+}
+
+func Test_Metrics_001(t *testing.T) {
+	// Metrics are written grouped and sorted by name, then by labels
+	var buf strings.Builder
+	if err := writeMetrics(&buf, []mutablehome.Metric{
+		mutablehome.Metric{Name: "b", Type: mutablehome.METRIC_GAUGE, Labels: map[string]string{"x": "2"}, Value: 0.5},
+		mutablehome.Metric{Name: "a", Help: "Help\nText", Type: mutablehome.METRIC_COUNTER, Value: 3},
+		mutablehome.Metric{Name: "b", Type: mutablehome.METRIC_GAUGE, Labels: map[string]string{"y": "1", "x": "1"}, Value: 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		`# HELP a Help\nText`,
+		`# TYPE a counter`,
+		`a 3`,
+		`# TYPE b gauge`,
+		`b{x="1",y="1"} 1`,
+		`b{x="2"} 0.5`,
+	}, "\n") + "\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%v", buf.String())
+	}
+}
+
+func Test_Metrics_002(t *testing.T) {
+	// Trait values are updated from node events
+	RunWithMetrics(t, Metrics{}, func(metrics *metrics, t *testing.T) {
+		node := new(node)
+		if err := metrics.AddNode(node); err != nil {
+			t.Fatal(err)
+		} else if err := metrics.AddNode(node); err == nil {
+			t.Error("Expected error adding node twice")
+		}
+		lamp := &light{id: "lamp", name: "Lamp", power: mutablehome.TRAIT_POWER_ON, brightness: 0.25}
+		node.Emit(&event{mutablehome.EVENT_DEVICE_ADDED, lamp})
+		values := WaitForMetrics(t, metrics, 2)
+		if values[METRIC_POWER] != 1 || values[METRIC_BRIGHTNESS] != 0.25 {
+			t.Error("Unexpected values", values)
+		}
+		for _, metric := range metrics.Metrics() {
+			if metric.Labels["node"] != "node" || metric.Labels["device"] != "lamp" || metric.Labels["name"] != "Lamp" {
+				t.Error("Unexpected labels", metric.Labels)
+			}
+		}
+		node.Emit(&event{mutablehome.EVENT_DEVICE_REMOVED, lamp})
+		WaitForMetrics(t, metrics, 0)
+	})
+}
+
+func Test_Metrics_003(t *testing.T) {
+	// Values from sources are served with trait values
+	RunWithMetrics(t, Metrics{}, func(metrics *metrics, t *testing.T) {
+		source := &source{count: 42}
+		if err := metrics.AddSource(source); err != nil {
+			t.Fatal(err)
+		} else if err := metrics.AddSource(source); err == nil {
+			t.Error("Expected error adding source twice")
+		}
+		metrics.ProcessEvent("node", &event{mutablehome.EVENT_DEVICE_TRAIT_CHANGED, &light{id: "lamp", power: mutablehome.TRAIT_POWER_OFF}})
+
+		w := httptest.NewRecorder()
+		metrics.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := w.Body.String()
+		if w.Code != http.StatusOK {
+			t.Error("Unexpected status", w.Code)
+		} else if strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") == false {
+			t.Error("Unexpected content type", w.Header().Get("Content-Type"))
+		} else if strings.Contains(body, `test_errors_total{name="a \"quoted\" value"} 42`+"\n") == false {
+			t.Error("Missing source value:", body)
+		} else if strings.Contains(body, `mutablehome_device_power{device="lamp",node="node"} 0`+"\n") == false {
+			t.Error("Missing power value:", body)
+		}
+
+		w = httptest.NewRecorder()
+		metrics.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Error("Unexpected status", w.Code)
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RUN
+
+func RunWithMetrics(t *testing.T, config Metrics, main func(*metrics, *testing.T)) {
+	t.Helper()
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(config, app.Log().Clone(config.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(unit.(*metrics), t)
+	}, nil); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+// WaitForMetrics waits until a number of trait values are published
+// and returns them by name
+func WaitForMetrics(t *testing.T, metrics *metrics, count int) map[string]float64 {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if values := metrics.Metrics(); len(values) == count {
+			result := make(map[string]float64, len(values))
+			for _, value := range values {
+				result[value.Name] = value.Value
+			}
+			return result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timeout waiting for metrics")
+	return nil
+}
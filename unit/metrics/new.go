@@ -0,0 +1,42 @@
+/*
+	Mutablehome Automation: Metrics
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+// Package metrics publishes trait values for devices as gauges labelled
+// by node and device, and counters and gauges from metrics sources,
+// in the Prometheus text format. Trait values are updated as nodes
+// emit events, and values from sources are read on each request.
+package metrics
+
+import (
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Metrics struct {
+	Server mutablehome.HttpServer // Server for metrics, or nil
+	Path   string                 // Path for metrics on the server
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (Metrics) Name() string { return "mutablehome/metrics" }
+
+func (config Metrics) New(log gopi.Logger) (gopi.Unit, error) {
+	this := new(metrics)
+	if err := this.Unit.Init(log); err != nil {
+		return nil, err
+	}
+	if err := this.Init(config); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
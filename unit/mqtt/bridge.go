@@ -0,0 +1,443 @@
+/*
+	Mutablehome Automation: MQTT
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	base "github.com/djthorpe/gopi/v2/base"
+	mosquitto "github.com/djthorpe/mosquitto"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type bridge struct {
+	base.Unit
+	sync.Mutex
+	sync.WaitGroup
+
+	client    mosquitto.Client
+	topic     string
+	discovery string
+	qos       int
+	connected bool
+	nodes     map[string]mutablehome.Node
+	online    map[string]bool
+	devices   map[string]*device
+	stop      chan struct{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	DEFAULT_TOPIC     = "mutablehome"
+	DEFAULT_DISCOVERY = "homeassistant"
+	DEFAULT_QOS       = 1
+)
+
+const (
+	PAYLOAD_ONLINE  = "online"
+	PAYLOAD_OFFLINE = "offline"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (this *bridge) Init(config Bridge) error {
+	if config.Client == nil {
+		return gopi.ErrBadParameter.WithPrefix("Client")
+	} else {
+		this.client = config.Client
+	}
+	if topic := strings.Trim(config.Topic, "/"); topic == "" {
+		this.topic = DEFAULT_TOPIC
+	} else if strings.ContainsAny(topic, "+#") {
+		return gopi.ErrBadParameter.WithPrefix("Topic")
+	} else {
+		this.topic = topic
+	}
+	if discovery := strings.Trim(config.Discovery, "/"); strings.ContainsAny(discovery, "+#") {
+		return gopi.ErrBadParameter.WithPrefix("Discovery")
+	} else {
+		this.discovery = discovery
+	}
+	if config.QOS < 0 || config.QOS > 2 {
+		return gopi.ErrBadParameter.WithPrefix("QOS")
+	} else {
+		this.qos = config.QOS
+	}
+
+	this.nodes = make(map[string]mutablehome.Node)
+	this.online = make(map[string]bool)
+	this.devices = make(map[string]*device)
+	this.stop = make(chan struct{})
+
+	// Receive connect, disconnect and message events from the client
+	if config.Bus != nil {
+		if err := config.Bus.NewHandler(gopi.EventHandler{
+			Name:    "mosquitto.Event",
+			Handler: this.EventHandler,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+func (this *bridge) Close() error {
+	// Stop event processes and wait for them to end
+	close(this.stop)
+	this.WaitGroup.Wait()
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Mark nodes as unavailable
+	for node := range this.online {
+		if err := this.publish(this.availabilityTopic(node), []byte(PAYLOAD_OFFLINE)); err != nil {
+			this.Log.Error(err)
+		}
+	}
+
+	// Release resources
+	this.client = nil
+	this.nodes = nil
+	this.online = nil
+	this.devices = nil
+	this.stop = nil
+
+	// Success
+	return this.Unit.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *bridge) String() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	str := "<" + this.Log.Name() +
+		" topic=" + strconv.Quote(this.topic)
+	if this.discovery != "" {
+		str += " discovery=" + strconv.Quote(this.discovery)
+	}
+	return str +
+		" qos=" + fmt.Sprint(this.qos) +
+		" connected=" + fmt.Sprint(this.connected) +
+		" nodes=" + fmt.Sprint(len(this.nodes)) +
+		" devices=" + fmt.Sprint(len(this.devices)) +
+		">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.MQTTBridge
+
+func (this *bridge) AddNode(node mutablehome.Node) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if node == nil {
+		return gopi.ErrBadParameter.WithPrefix("node")
+	} else if _, exists := this.nodes[node.Id()]; exists {
+		return gopi.ErrDuplicateItem.WithPrefix(strconv.Quote(node.Id()))
+	} else {
+		this.nodes[node.Id()] = node
+	}
+
+	// Mark node as available
+	if err := this.setAvailable(node.Id(), true); err != nil {
+		this.Log.Error(err)
+	}
+
+	// Publish state for node events
+	this.WaitGroup.Add(1)
+	go this.EventProcess(node, node.Subscribe(), this.stop)
+
+	// Success
+	return nil
+}
+
+// Command sets the state of a device from the payload of a message on
+// the command topic for the device
+func (this *bridge) Command(topic string, data []byte) error {
+	this.Mutex.Lock()
+	device, exists := this.devices[this.commandPath(topic)]
+	this.Mutex.Unlock()
+
+	// Execute the command without holding the lock, as the node
+	// emits events for the change
+	if exists == false {
+		return gopi.ErrNotFound.WithPrefix(topic)
+	} else if cmd, err := parseCommand(data); err != nil {
+		return err
+	} else if target := device.node.Device(device.id); target == nil {
+		return gopi.ErrNotFound.WithPrefix(strconv.Quote(device.id))
+	} else {
+		return cmd.Execute(target, device.class)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EVENT HANDLERS
+
+// EventHandler receives events from the client on the bus
+func (this *bridge) EventHandler(_ context.Context, _ gopi.App, evt gopi.Event) {
+	if evt_, ok := evt.(mosquitto.Event); ok {
+		this.ProcessClientEvent(evt_)
+	}
+}
+
+// ProcessClientEvent subscribes to commands and publishes availability,
+// discovery config and state when the client connects, and executes
+// commands as messages are received
+func (this *bridge) ProcessClientEvent(evt mosquitto.Event) {
+	switch evt.Type() {
+	case mosquitto.MOSQ_FLAG_EVENT_CONNECT:
+		if evt.ReturnCode() != 0 {
+			return
+		}
+		this.Mutex.Lock()
+		defer this.Mutex.Unlock()
+		if this.stop == nil || evt.Source() != gopi.Unit(this.client) {
+			return
+		}
+		this.connected = true
+		if _, err := this.client.Subscribe(this.topic+"/+/+/set", mosquitto.OptQOS(this.qos)); err != nil {
+			this.Log.Error(err)
+		}
+		if err := this.publishAll(); err != nil {
+			this.Log.Error(err)
+		}
+	case mosquitto.MOSQ_FLAG_EVENT_DISCONNECT:
+		this.Mutex.Lock()
+		defer this.Mutex.Unlock()
+		if evt.Source() == gopi.Unit(this.client) {
+			this.connected = false
+		}
+	case mosquitto.MOSQ_FLAG_EVENT_MESSAGE:
+		if this.commandPath(evt.Topic()) == "" {
+			return
+		} else if err := this.Command(evt.Topic(), evt.Data()); err != nil {
+			this.Log.Error(fmt.Errorf("%v: %w", evt.Topic(), err))
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND PROCESSES
+
+// EventProcess publishes state for node events until the unit is
+// closed or the node stops emitting events
+func (this *bridge) EventProcess(node mutablehome.Node, evts <-chan interface{}, stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+	mutablehome.ProcessEvents(node, evts, stop, func(evt mutablehome.Event) {
+		if err := this.ProcessEvent(node, evt); err != nil {
+			this.Log.Error(err)
+		}
+	})
+}
+
+// ProcessEvent publishes availability, discovery config and state
+// for a node event
+func (this *bridge) ProcessEvent(node mutablehome.Node, evt mutablehome.Event) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	id := mutablehome.NodeId(node, evt)
+	switch evt.Type() {
+	case mutablehome.EVENT_NODE_ONLINE:
+		return this.setAvailable(id, true)
+	case mutablehome.EVENT_NODE_OFFLINE:
+		return this.setAvailable(id, false)
+	case mutablehome.EVENT_DEVICE_ADDED, mutablehome.EVENT_DEVICE_METADATA_CHANGED, mutablehome.EVENT_DEVICE_TRAIT_CHANGED:
+		if evt.Device() == nil {
+			return nil
+		} else if device := NewDevice(node, id, evt.Device()); device.class == mutablehome.DEVICE_CLASS_NONE {
+			return nil
+		} else {
+			return this.addDevice(device)
+		}
+	case mutablehome.EVENT_DEVICE_REMOVED:
+		if evt.Device() == nil {
+			return nil
+		} else {
+			return this.removeDevice(devicePath(id, evt.Device().Id()))
+		}
+	default:
+		return nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *bridge) addDevice(device *device) error {
+	// Make node available when devices are added
+	if this.online[device.nodeId] == false {
+		if err := this.setAvailable(device.nodeId, true); err != nil {
+			return err
+		}
+	}
+
+	// Publish discovery config when the device is new or changed
+	other, exists := this.devices[device.path]
+	this.devices[device.path] = device
+	if config, err := json.Marshal(this.config(device)); err != nil {
+		return err
+	} else if exists == false || string(other.config) != string(config) {
+		device.config = config
+		if err := this.publishConfig(device); err != nil {
+			return err
+		}
+	} else {
+		device.config = other.config
+	}
+
+	// Publish state
+	return this.publishState(device)
+}
+
+func (this *bridge) removeDevice(path string) error {
+	device, exists := this.devices[path]
+	if exists == false {
+		return nil
+	} else {
+		delete(this.devices, path)
+	}
+
+	// Empty retained messages remove the device
+	if err := this.publish(this.stateTopic(device), nil); err != nil {
+		return err
+	} else if topic := this.configTopic(device); topic != "" {
+		return this.publish(topic, nil)
+	} else {
+		return nil
+	}
+}
+
+func (this *bridge) setAvailable(node string, available bool) error {
+	if available {
+		this.online[node] = true
+		return this.publish(this.availabilityTopic(node), []byte(PAYLOAD_ONLINE))
+	} else {
+		delete(this.online, node)
+		return this.publish(this.availabilityTopic(node), []byte(PAYLOAD_OFFLINE))
+	}
+}
+
+// publishAll publishes availability, discovery config and state for
+// all nodes and devices, when the client connects
+func (this *bridge) publishAll() error {
+	for node := range this.online {
+		if err := this.publish(this.availabilityTopic(node), []byte(PAYLOAD_ONLINE)); err != nil {
+			return err
+		}
+	}
+	for _, device := range this.devices {
+		if err := this.publishConfig(device); err != nil {
+			return err
+		} else if err := this.publishState(device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *bridge) publishConfig(device *device) error {
+	if topic := this.configTopic(device); topic == "" {
+		return nil
+	} else {
+		return this.publish(topic, device.config)
+	}
+}
+
+func (this *bridge) publishState(device *device) error {
+	if state, err := json.Marshal(device.state); err != nil {
+		return err
+	} else {
+		return this.publish(this.stateTopic(device), state)
+	}
+}
+
+// publish sends a retained message, or does nothing if the client
+// is not connected, as all messages are published on connect
+func (this *bridge) publish(topic string, data []byte) error {
+	if this.connected == false {
+		return nil
+	} else if _, err := this.client.Publish(topic, data, mosquitto.OptQOS(this.qos), mosquitto.OptRetain(true)); err != nil {
+		return fmt.Errorf("%v: %w", topic, err)
+	} else {
+		return nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// TOPICS
+
+func (this *bridge) availabilityTopic(node string) string {
+	return this.topic + "/" + segment(node) + "/availability"
+}
+
+func (this *bridge) stateTopic(device *device) string {
+	return this.topic + "/" + device.path + "/state"
+}
+
+func (this *bridge) commandTopic(device *device) string {
+	return this.topic + "/" + device.path + "/set"
+}
+
+// configTopic returns the discovery topic for a device, or empty
+// if discovery is disabled
+func (this *bridge) configTopic(device *device) string {
+	if this.discovery == "" {
+		return ""
+	} else {
+		return this.discovery + "/" + component(device.class) + "/" + device.path + "/config"
+	}
+}
+
+// commandPath returns the device path for a command topic, or empty
+// if the topic is not a command topic
+func (this *bridge) commandPath(topic string) string {
+	if strings.HasPrefix(topic, this.topic+"/") == false || strings.HasSuffix(topic, "/set") == false {
+		return ""
+	} else if path := strings.TrimSuffix(strings.TrimPrefix(topic, this.topic+"/"), "/set"); strings.Count(path, "/") != 1 {
+		return ""
+	} else {
+		return path
+	}
+}
+
+// segment returns a value which can be used as a single topic level
+// and as a Home Assistant object id
+func segment(value string) string {
+	if value == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
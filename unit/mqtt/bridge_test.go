@@ -0,0 +1,326 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	base "github.com/djthorpe/gopi/v2/base"
+	mosquitto "github.com/djthorpe/mosquitto"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CLIENT, NODE, DEVICES AND EVENTS
+
+type client struct {
+	sync.Mutex
+	topics   []string
+	messages map[string][]byte
+	retained map[string]bool
+}
+
+func (this *client) Connect(...mosquitto.Opt) error { return nil }
+func (this *client) Disconnect() error              { return nil }
+func (this *client) Subscribe(topic string, _ ...mosquitto.Opt) (int, error) {
+	this.Lock()
+	defer this.Unlock()
+	this.topics = append(this.topics, topic)
+	return len(this.topics), nil
+}
+func (this *client) Unsubscribe(string) (int, error) { return 0, gopi.ErrNotImplemented }
+func (this *client) Publish(topic string, data []byte, opts ...mosquitto.Opt) (int, error) {
+	this.Lock()
+	defer this.Unlock()
+	if this.messages == nil {
+		this.messages = make(map[string][]byte)
+		this.retained = make(map[string]bool)
+	}
+	this.messages[topic] = data
+	this.retained[topic] = false
+	for _, opt := range opts {
+		if opt.Type == mosquitto.MOSQ_OPTION_RETAIN {
+			this.retained[topic] = opt.Bool
+		}
+	}
+	return len(this.messages), nil
+}
+func (this *client) PublishJSON(string, interface{}, ...mosquitto.Opt) (int, error) {
+	return 0, gopi.ErrNotImplemented
+}
+func (this *client) PublishInflux(string, string, map[string]interface{}, ...mosquitto.Opt) (int, error) {
+	return 0, gopi.ErrNotImplemented
+}
+func (this *client) WaitFor(context.Context, int) (mosquitto.Event, error) {
+	return nil, gopi.ErrNotImplemented
+}
+func (this *client) Close() error   { return nil }
+func (this *client) String() string { return "<client>" }
+
+// Message returns a published message and whether it was retained
+func (this *client) Message(topic string) ([]byte, bool, bool) {
+	this.Lock()
+	defer this.Unlock()
+	data, exists := this.messages[topic]
+	return data, this.retained[topic], exists
+}
+
+type message struct {
+	source gopi.Unit
+	t      mosquitto.Flags
+	topic  string
+	data   []byte
+}
+
+func (this *message) ReturnCode() int       { return 0 }
+func (this *message) Id() int               { return 0 }
+func (this *message) Type() mosquitto.Flags { return this.t }
+func (this *message) Topic() string         { return this.topic }
+func (this *message) Data() []byte          { return this.data }
+func (this *message) Source() gopi.Unit     { return this.source }
+func (*message) Name() string               { return "mosquitto.Event" }
+func (*message) NS() gopi.EventNS           { return gopi.EVENT_NS_DEFAULT }
+func (this *message) Value() interface{}    { return this.data }
+
+type node struct {
+	base.PubSub
+	devices map[string]mutablehome.Device
+}
+
+func (*node) Id() string                               { return "node" }
+func (*node) Name() string                             { return "Node" }
+func (this *node) Device(id string) mutablehome.Device { return this.devices[id] }
+func (this *node) Devices() []mutablehome.Device       { return nil }
+
+type light struct {
+	id         string
+	power      mutablehome.TraitType
+	brightness float32
+}
+
+func (this *light) Id() string                   { return this.id }
+func (this *light) Name() string                 { return "Lamp" }
+func (this *light) Power() mutablehome.TraitType { return this.power }
+func (this *light) Brightness() float32          { return this.brightness }
+func (this *light) SetPower(value mutablehome.TraitType) error {
+	if value == mutablehome.TRAIT_POWER_TOGGLE && this.power == mutablehome.TRAIT_POWER_ON {
+		value = mutablehome.TRAIT_POWER_OFF
+	} else if value == mutablehome.TRAIT_POWER_TOGGLE {
+		value = mutablehome.TRAIT_POWER_ON
+	}
+	this.power = value
+	return nil
+}
+func (this *light) SetBrightness(value float32, _ time.Duration) error {
+	this.brightness = value
+	return nil
+}
+func (this *light) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_LIGHT_BRIGHTNESS}
+}
+
+type vacuum struct {
+	light
+}
+
+func (*vacuum) Class() mutablehome.DeviceClass { return mutablehome.DEVICE_CLASS_VACUUM }
+func (*vacuum) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_POWER_STANDBY}
+}
+
+type event struct {
+	t      mutablehome.EventType
+	device mutablehome.Device
+}
+
+func (*event) Name() string                     { return "mutablehome.Event" }
+func (*event) NS() gopi.EventNS                 { return gopi.EVENT_NS_DEFAULT }
+func (*event) Source() gopi.Unit                { return nil }
+func (this *event) Value() interface{}          { return this.device }
+func (this *event) Type() mutablehome.EventType { return this.t }
+func (*event) Node() mutablehome.Node           { return nil }
+func (this *event) Device() mutablehome.Device  { return this.device }
+func (*event) Traits() []mutablehome.TraitType  { return nil }
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Bridge_000(t *testing.T) {
+	t.Log("Test_Bridge_000")
+}
+
+func Test_Bridge_001(t *testing.T) {
+	// Commands are JSON objects or plain states
+	if cmd, err := parseCommand([]byte(`{"state":"on","brightness":128,"transition":0.5}`)); err != nil {
+		t.Error(err)
+	} else if cmd.State != "ON" || *cmd.Brightness != 128 || cmd.transition() != 500*time.Millisecond {
+		t.Error("Unexpected command", cmd)
+	}
+	if cmd, err := parseCommand([]byte(" toggle\n")); err != nil {
+		t.Error(err)
+	} else if cmd.State != "TOGGLE" {
+		t.Error("Unexpected command", cmd)
+	}
+	for _, data := range []string{"", "{}", `{"brightness":256}`, `{"position":-1}`, "{"} {
+		if _, err := parseCommand([]byte(data)); err == nil {
+			t.Error("Expected error for", data)
+		}
+	}
+	if path := devicePath("a", "a/b c"); path != "a/b_c" {
+		t.Error("Unexpected path", path)
+	}
+	if segment("+/#") != "___" || segment("") != "_" {
+		t.Error("Unexpected segment")
+	}
+}
+
+func Test_Bridge_002(t *testing.T) {
+	// State, availability and discovery are published as retained
+	// messages once the client connects
+	client := new(client)
+	RunWithBridge(t, Bridge{Client: client, Discovery: DEFAULT_DISCOVERY}, func(bridge *bridge, t *testing.T) {
+		node := &node{devices: make(map[string]mutablehome.Device)}
+		if err := bridge.AddNode(node); err != nil {
+			t.Fatal(err)
+		} else if err := bridge.AddNode(node); err == nil {
+			t.Error("Expected error adding node twice")
+		}
+		lamp := &light{id: "lamp", power: mutablehome.TRAIT_POWER_ON, brightness: 0.25}
+		node.devices[lamp.id] = lamp
+		node.Emit(&event{mutablehome.EVENT_DEVICE_ADDED, lamp})
+		if _, _, exists := client.Message("mutablehome/node/availability"); exists {
+			t.Error("Unexpected publish before connect")
+		}
+
+		bridge.ProcessClientEvent(&message{source: client, t: mosquitto.MOSQ_FLAG_EVENT_CONNECT})
+		if len(client.topics) != 1 || client.topics[0] != "mutablehome/+/+/set" {
+			t.Error("Unexpected subscriptions", client.topics)
+		}
+		if data, retained, _ := client.Message("mutablehome/node/availability"); string(data) != PAYLOAD_ONLINE || retained == false {
+			t.Error("Unexpected availability", string(data), retained)
+		}
+		if state := WaitForMessage(t, client, "mutablehome/node/lamp/state"); state["state"] != "ON" || state["brightness"] != float64(64) {
+			t.Error("Unexpected state", state)
+		}
+		config := WaitForMessage(t, client, "homeassistant/light/node/lamp/config")
+		if config["schema"] != "json" || config["command_topic"] != "mutablehome/node/lamp/set" || config["unique_id"] != "mutablehome_node_lamp" {
+			t.Error("Unexpected config", config)
+		} else if config["availability_topic"] != "mutablehome/node/availability" {
+			t.Error("Unexpected config", config)
+		}
+
+		// Vacuums use vacuum states
+		robot := &vacuum{light{id: "robot", power: mutablehome.TRAIT_POWER_STANDBY}}
+		node.Emit(&event{mutablehome.EVENT_DEVICE_ADDED, robot})
+		if state := WaitForMessage(t, client, "mutablehome/node/robot/state"); state["state"] != "paused" {
+			t.Error("Unexpected state", state)
+		}
+		if config := WaitForMessage(t, client, "homeassistant/vacuum/node/robot/config"); config["schema"] != "state" {
+			t.Error("Unexpected config", config)
+		}
+	})
+}
+
+func Test_Bridge_003(t *testing.T) {
+	// Commands set power and brightness
+	client := new(client)
+	RunWithBridge(t, Bridge{Client: client}, func(bridge *bridge, t *testing.T) {
+		node := &node{devices: make(map[string]mutablehome.Device)}
+		lamp := &light{id: "lamp", power: mutablehome.TRAIT_POWER_OFF}
+		node.devices[lamp.id] = lamp
+		if err := bridge.AddNode(node); err != nil {
+			t.Fatal(err)
+		} else if err := bridge.ProcessEvent(node, &event{mutablehome.EVENT_DEVICE_ADDED, lamp}); err != nil {
+			t.Fatal(err)
+		}
+		if err := bridge.Command("mutablehome/node/lamp/set", []byte(`{"state":"ON","brightness":255}`)); err != nil {
+			t.Error(err)
+		} else if lamp.power != mutablehome.TRAIT_POWER_ON || lamp.brightness != 1 {
+			t.Error("Unexpected state", lamp)
+		}
+		if err := bridge.Command("mutablehome/node/lamp/set", []byte("TOGGLE")); err != nil {
+			t.Error(err)
+		} else if lamp.power != mutablehome.TRAIT_POWER_OFF {
+			t.Error("Unexpected power", lamp.power)
+		}
+		if err := bridge.Command("mutablehome/node/lamp/set", []byte("OPEN")); err == nil {
+			t.Error("Expected error for OPEN")
+		}
+		if err := bridge.Command("mutablehome/node/other/set", []byte("ON")); err == nil {
+			t.Error("Expected error for missing device")
+		}
+		if bridge.commandPath("mutablehome/node/lamp/state") != "" || bridge.commandPath("other/node/lamp/set") != "" {
+			t.Error("Unexpected command path")
+		}
+	})
+}
+
+func Test_Bridge_004(t *testing.T) {
+	// Removed devices and closed bridges clear retained state
+	client := new(client)
+	RunWithBridge(t, Bridge{Client: client, Topic: "home/", Discovery: "ha"}, func(bridge *bridge, t *testing.T) {
+		bridge.ProcessClientEvent(&message{source: client, t: mosquitto.MOSQ_FLAG_EVENT_CONNECT})
+		node := &node{}
+		lamp := &light{id: "lamp"}
+		if err := bridge.AddNode(node); err != nil {
+			t.Fatal(err)
+		} else if err := bridge.ProcessEvent(node, &event{mutablehome.EVENT_DEVICE_ADDED, lamp}); err != nil {
+			t.Fatal(err)
+		} else if _, _, exists := client.Message("ha/light/node/lamp/config"); exists == false {
+			t.Error("Missing config")
+		} else if err := bridge.ProcessEvent(node, &event{mutablehome.EVENT_DEVICE_REMOVED, lamp}); err != nil {
+			t.Fatal(err)
+		}
+		if data, retained, _ := client.Message("ha/light/node/lamp/config"); len(data) != 0 || retained == false {
+			t.Error("Expected empty retained config")
+		}
+		if data, _, _ := client.Message("home/node/lamp/state"); len(data) != 0 {
+			t.Error("Expected empty state")
+		}
+	})
+	if data, retained, _ := client.Message("home/node/availability"); string(data) != PAYLOAD_OFFLINE || retained == false {
+		t.Error("Unexpected availability", string(data), retained)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RUN
+
+func RunWithBridge(t *testing.T, config Bridge, main func(*bridge, *testing.T)) {
+	t.Helper()
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(config, app.Log().Clone(config.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(unit.(*bridge), t)
+	}, nil); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+// WaitForMessage waits until a JSON message is published on a topic
+// and returns it
+func WaitForMessage(t *testing.T, client *client, topic string) map[string]interface{} {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if data, _, exists := client.Message(topic); exists {
+			result := make(map[string]interface{})
+			if err := json.Unmarshal(data, &result); err != nil {
+				t.Fatal(err)
+			}
+			return result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timeout waiting for", topic)
+	return nil
+}
@@ -0,0 +1,143 @@
+/*
+	Mutablehome Automation: MQTT
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// command is received on the command topic for a device, either as a
+// JSON object or a plain state such as ON, OFF or TOGGLE
+type command struct {
+	State      string   `json:"state"`
+	Brightness *float64 `json:"brightness"` // Between 0 and 255
+	Position   *float64 `json:"position"`   // Between 0 and 100
+	Transition float64  `json:"transition"` // In seconds
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PARSE
+
+func parseCommand(data []byte) (*command, error) {
+	this := new(command)
+	if data = bytes.TrimSpace(data); len(data) == 0 {
+		return nil, gopi.ErrBadParameter.WithPrefix("command")
+	} else if data[0] == '{' {
+		if err := json.Unmarshal(data, this); err != nil {
+			return nil, err
+		}
+	} else {
+		this.State = string(data)
+	}
+	this.State = strings.ToUpper(strings.TrimSpace(this.State))
+	if this.State == "" && this.Brightness == nil && this.Position == nil {
+		return nil, gopi.ErrBadParameter.WithPrefix("command")
+	} else if this.Brightness != nil && (*this.Brightness < 0 || *this.Brightness > 255) {
+		return nil, gopi.ErrBadParameter.WithPrefix("brightness")
+	} else if this.Position != nil && (*this.Position < 0 || *this.Position > 100) {
+		return nil, gopi.ErrBadParameter.WithPrefix("position")
+	}
+	return this, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EXECUTE
+
+// Execute sets power, brightness or position for a device, where the
+// state depends on the class of device
+func (this *command) Execute(device mutablehome.Device, class mutablehome.DeviceClass) error {
+	if this.State != "" {
+		if err := this.executeState(device, class); err != nil {
+			return err
+		}
+	}
+	if this.Brightness != nil && this.State != "OFF" {
+		if light, ok := device.(mutablehome.LightTrait); ok == false {
+			return gopi.ErrNotImplemented.WithPrefix("SetBrightness")
+		} else if err := light.SetBrightness(float32(*this.Brightness/255), this.transition()); err != nil {
+			return err
+		}
+	}
+	if this.Position != nil {
+		if cover, ok := device.(mutablehome.CoverTrait); ok == false {
+			return gopi.ErrNotImplemented.WithPrefix("SetPosition")
+		} else if err := cover.SetPosition(float32(*this.Position / 100)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *command) executeState(device mutablehome.Device, class mutablehome.DeviceClass) error {
+	// Covers are opened, closed or stopped
+	if class == mutablehome.DEVICE_CLASS_COVER {
+		if cover, ok := device.(mutablehome.CoverTrait); ok == false {
+			return gopi.ErrNotImplemented.WithPrefix("SetPosition")
+		} else {
+			switch this.State {
+			case "OPEN":
+				return cover.SetPosition(1)
+			case "CLOSE":
+				return cover.SetPosition(0)
+			case "STOP":
+				return cover.Stop()
+			default:
+				return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.State))
+			}
+		}
+	}
+
+	// Other devices are switched on, off or into standby
+	power := mutablehome.TRAIT_NONE
+	switch this.State {
+	case "ON":
+		power = mutablehome.TRAIT_POWER_ON
+	case "OFF":
+		power = mutablehome.TRAIT_POWER_OFF
+	case "STANDBY":
+		power = mutablehome.TRAIT_POWER_STANDBY
+	case "TOGGLE":
+		power = mutablehome.TRAIT_POWER_TOGGLE
+	}
+	if class == mutablehome.DEVICE_CLASS_VACUUM {
+		switch this.State {
+		case "START":
+			power = mutablehome.TRAIT_POWER_ON
+		case "STOP", "RETURN_TO_BASE":
+			power = mutablehome.TRAIT_POWER_OFF
+		case "PAUSE":
+			power = mutablehome.TRAIT_POWER_STANDBY
+		}
+	}
+	if power == mutablehome.TRAIT_NONE {
+		return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.State))
+	} else if device_, ok := device.(mutablehome.PowerTrait); ok == false {
+		return gopi.ErrNotImplemented.WithPrefix("SetPower")
+	} else {
+		return device_.SetPower(power)
+	}
+}
+
+func (this *command) transition() time.Duration {
+	if this.Transition <= 0 {
+		return 0
+	} else {
+		return time.Duration(this.Transition * float64(time.Second))
+	}
+}
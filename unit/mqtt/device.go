@@ -0,0 +1,125 @@
+/*
+	Mutablehome Automation: MQTT
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mqtt
+
+import (
+	"math"
+	"strings"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// device holds the state of a device when it was last changed
+type device struct {
+	node       mutablehome.Node // Node which receives commands
+	nodeId, id string           // Node for availability and device id
+	path, name string           // Topic path and name
+	class      mutablehome.DeviceClass
+	traits     map[mutablehome.TraitType]bool
+	state      map[string]interface{}
+	config     []byte
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+// NewDevice returns the state of a device on a node
+func NewDevice(node mutablehome.Node, nodeId string, d mutablehome.Device) *device {
+	this := new(device)
+	this.node = node
+	this.nodeId = nodeId
+	this.id = d.Id()
+	this.path = devicePath(nodeId, d.Id())
+	this.name = d.Name()
+	if this.name == "" {
+		this.name = d.Id()
+	}
+	this.traits = make(map[mutablehome.TraitType]bool)
+	for _, trait := range d.Traits() {
+		this.traits[trait] = true
+	}
+	this.class = this.classOf(d)
+	this.state = this.stateOf(d)
+	return this
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// classOf returns the declared class for a device, or infers the
+// class from the traits
+func (this *device) classOf(d mutablehome.Device) mutablehome.DeviceClass {
+	if class, ok := d.(mutablehome.ClassDevice); ok {
+		return class.Class()
+	} else if this.traits[mutablehome.TRAIT_COVER_POSITION] {
+		return mutablehome.DEVICE_CLASS_COVER
+	} else if this.traits[mutablehome.TRAIT_LIGHT_BRIGHTNESS] {
+		return mutablehome.DEVICE_CLASS_LIGHT
+	} else if this.hasPower() {
+		return mutablehome.DEVICE_CLASS_SWITCH
+	} else if this.traits[mutablehome.TRAIT_BATTERY_LEVEL] {
+		return mutablehome.DEVICE_CLASS_SENSOR
+	} else {
+		return mutablehome.DEVICE_CLASS_NONE
+	}
+}
+
+// stateOf returns the state payload for a device, where power is ON or
+// OFF except for vacuums, which use Home Assistant vacuum states
+func (this *device) stateOf(d mutablehome.Device) map[string]interface{} {
+	state := make(map[string]interface{})
+	if power, ok := d.(mutablehome.PowerTrait); ok && this.hasPower() {
+		switch power.Power() {
+		case mutablehome.TRAIT_POWER_ON:
+			state["state"] = "ON"
+			if this.class == mutablehome.DEVICE_CLASS_VACUUM {
+				state["state"] = "cleaning"
+			}
+		case mutablehome.TRAIT_POWER_OFF:
+			state["state"] = "OFF"
+			if this.class == mutablehome.DEVICE_CLASS_VACUUM {
+				state["state"] = "docked"
+			}
+		case mutablehome.TRAIT_POWER_STANDBY:
+			state["state"] = "OFF"
+			if this.class == mutablehome.DEVICE_CLASS_VACUUM {
+				state["state"] = "paused"
+			}
+		}
+	}
+	if light, ok := d.(mutablehome.LightTrait); ok && this.traits[mutablehome.TRAIT_LIGHT_BRIGHTNESS] {
+		state["brightness"] = scale(light.Brightness(), 255)
+	}
+	if cover, ok := d.(mutablehome.CoverTrait); ok && this.traits[mutablehome.TRAIT_COVER_POSITION] {
+		state["position"] = scale(cover.Position(), 100)
+	}
+	if battery, ok := d.(mutablehome.BatteryTrait); ok && this.traits[mutablehome.TRAIT_BATTERY_LEVEL] {
+		state["battery_level"] = scale(battery.BatteryLevel(), 100)
+	}
+	return state
+}
+
+func (this *device) hasPower() bool {
+	return this.traits[mutablehome.TRAIT_POWER_ON] || this.traits[mutablehome.TRAIT_POWER_OFF] || this.traits[mutablehome.TRAIT_POWER_STANDBY]
+}
+
+// devicePath returns the topic path for a device, where the node id
+// prefix is removed from devices of remote nodes
+func devicePath(node, id string) string {
+	return segment(node) + "/" + segment(strings.TrimPrefix(id, node+"/"))
+}
+
+// scale returns a value between 0.0 and 1.0 as an integer between
+// zero and max
+func scale(value float32, max float64) int {
+	return int(math.Round(math.Max(0, math.Min(1, float64(value))) * max))
+}
@@ -0,0 +1,91 @@
+/*
+	Mutablehome Automation: MQTT
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mqtt
+
+import (
+	"strings"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// HOME ASSISTANT DISCOVERY
+
+// component returns the Home Assistant component for a class of device.
+// There is no MQTT media player component, so media players are switches
+func component(class mutablehome.DeviceClass) string {
+	switch class {
+	case mutablehome.DEVICE_CLASS_LIGHT:
+		return "light"
+	case mutablehome.DEVICE_CLASS_SWITCH, mutablehome.DEVICE_CLASS_MEDIA_PLAYER:
+		return "switch"
+	case mutablehome.DEVICE_CLASS_COVER:
+		return "cover"
+	case mutablehome.DEVICE_CLASS_SENSOR:
+		return "sensor"
+	case mutablehome.DEVICE_CLASS_VACUUM:
+		return "vacuum"
+	default:
+		return ""
+	}
+}
+
+// config returns the Home Assistant discovery config for a device
+func (this *bridge) config(device *device) map[string]interface{} {
+	id := "mutablehome_" + strings.Replace(device.path, "/", "_", -1)
+	config := map[string]interface{}{
+		"name":               device.name,
+		"unique_id":          id,
+		"availability_topic": this.availabilityTopic(device.nodeId),
+		"state_topic":        this.stateTopic(device),
+		"device": map[string]interface{}{
+			"identifiers": []string{id},
+			"name":        device.name,
+		},
+	}
+	switch device.class {
+	case mutablehome.DEVICE_CLASS_LIGHT:
+		config["schema"] = "json"
+		config["command_topic"] = this.commandTopic(device)
+		config["brightness"] = device.traits[mutablehome.TRAIT_LIGHT_BRIGHTNESS]
+		config["brightness_scale"] = 255
+	case mutablehome.DEVICE_CLASS_SWITCH, mutablehome.DEVICE_CLASS_MEDIA_PLAYER:
+		config["command_topic"] = this.commandTopic(device)
+		config["value_template"] = "{{ value_json.state }}"
+		config["payload_on"] = "ON"
+		config["payload_off"] = "OFF"
+		if device.class == mutablehome.DEVICE_CLASS_MEDIA_PLAYER {
+			config["icon"] = "mdi:speaker"
+		}
+	case mutablehome.DEVICE_CLASS_COVER:
+		// Covers report position rather than open or closed state
+		delete(config, "state_topic")
+		config["command_topic"] = this.commandTopic(device)
+		config["payload_open"] = "OPEN"
+		config["payload_close"] = "CLOSE"
+		config["payload_stop"] = "STOP"
+		config["position_topic"] = this.stateTopic(device)
+		config["position_template"] = "{{ value_json.position }}"
+		config["set_position_topic"] = this.commandTopic(device)
+		config["set_position_template"] = `{"position": {{ position }}}`
+	case mutablehome.DEVICE_CLASS_SENSOR:
+		config["device_class"] = "battery"
+		config["unit_of_measurement"] = "%"
+		config["value_template"] = "{{ value_json.battery_level }}"
+	case mutablehome.DEVICE_CLASS_VACUUM:
+		features := []string{"start", "stop", "pause", "return_home", "status"}
+		if device.traits[mutablehome.TRAIT_BATTERY_LEVEL] {
+			features = append(features, "battery")
+		}
+		config["schema"] = "state"
+		config["command_topic"] = this.commandTopic(device)
+		config["supported_features"] = features
+	}
+	return config
+}
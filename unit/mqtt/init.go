@@ -0,0 +1,39 @@
+/*
+	Mutablehome Automation: MQTT
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package mqtt
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+	mosquitto "github.com/djthorpe/mosquitto"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	// MQTT bridge
+	gopi.UnitRegister(gopi.UnitConfig{
+		Name:     Bridge{}.Name(),
+		Requires: []string{"bus", "mosquitto"},
+		Config: func(app gopi.App) error {
+			app.Flags().FlagString("mqtt.topic", DEFAULT_TOPIC, "Root topic for device state and commands")
+			app.Flags().FlagString("mqtt.discovery", DEFAULT_DISCOVERY, "Root topic for Home Assistant discovery, or empty")
+			app.Flags().FlagInt("mqtt.qos", DEFAULT_QOS, "Quality of service for bridged messages")
+			return nil
+		},
+		New: func(app gopi.App) (gopi.Unit, error) {
+			return gopi.New(Bridge{
+				Client:    app.UnitInstance("mosquitto").(mosquitto.Client),
+				Bus:       app.Bus(),
+				Topic:     app.Flags().GetString("mqtt.topic", gopi.FLAG_NS_DEFAULT),
+				Discovery: app.Flags().GetString("mqtt.discovery", gopi.FLAG_NS_DEFAULT),
+				QOS:       app.Flags().GetInt("mqtt.qos", gopi.FLAG_NS_DEFAULT),
+			}, app.Log().Clone(Bridge{}.Name()))
+		},
+	})
+}
@@ -0,0 +1,47 @@
+/*
+	Mutablehome Automation: MQTT
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+// Package mqtt bridges devices of nodes to an MQTT broker. The state of
+// each device is published as a retained JSON message, commands to set
+// power and brightness are received on a topic for each device, and
+// Home Assistant discovery config is published so devices appear
+// without further configuration. Each node has an availability topic
+// which is "online" while the node is bridged and "offline" otherwise.
+package mqtt
+
+import (
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	mosquitto "github.com/djthorpe/mosquitto"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Bridge struct {
+	Client    mosquitto.Client // Client for the broker
+	Bus       gopi.Bus         // Bus on which client events are emitted, or nil
+	Topic     string           // Root topic for state and commands
+	Discovery string           // Root topic for discovery config, or empty
+	QOS       int              // Quality of service for messages
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (Bridge) Name() string { return "mutablehome/mqtt" }
+
+func (config Bridge) New(log gopi.Logger) (gopi.Unit, error) {
+	this := new(bridge)
+	if err := this.Unit.Init(log); err != nil {
+		return nil, err
+	}
+	if err := this.Init(config); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
@@ -0,0 +1,33 @@
+/*
+	Mutablehome Automation: Rules
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package rules
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	// Rules engine
+	gopi.UnitRegister(gopi.UnitConfig{
+		Name: Rules{}.Name(),
+		Config: func(app gopi.App) error {
+			app.Flags().FlagString("rules.path", "", "Rules file")
+			app.Flags().FlagBool("rules.dryrun", false, "Log rule actions without performing them")
+			return nil
+		},
+		New: func(app gopi.App) (gopi.Unit, error) {
+			return gopi.New(Rules{
+				Path:   app.Flags().GetString("rules.path", gopi.FLAG_NS_DEFAULT),
+				DryRun: app.Flags().GetBool("rules.dryrun", gopi.FLAG_NS_DEFAULT),
+			}, app.Log().Clone(Rules{}.Name()))
+		},
+	})
+}
@@ -0,0 +1,56 @@
+/*
+	Mutablehome Automation: Rules
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+// Package rules implements an automation engine, which evaluates rules
+// loaded from a JSON file when nodes emit events. A rule is triggered
+// when any of its triggers match an event, and performs its actions when
+// all of its conditions are satisfied. For example:
+//
+//	{
+//	  "rules": [{
+//	    "name": "hall",
+//	    "triggers": [{ "device": "65537", "trait": "SENSOR_ACTIVITY" }],
+//	    "conditions": [{ "after": "18:00", "before": "06:00" }],
+//	    "actions": [
+//	      { "device": "65538", "power": "ON", "brightness": 0.8 },
+//	      { "device": "65538", "power": "OFF", "delay": "5m" }
+//	    ]
+//	  }]
+//	}
+//
+// Triggers match EVENT_DEVICE_TRAIT_CHANGED events unless another
+// event is set.
+package rules
+
+import (
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Rules struct {
+	Path   string
+	DryRun bool
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (Rules) Name() string { return "mutablehome/rules" }
+
+func (config Rules) New(log gopi.Logger) (gopi.Unit, error) {
+	this := new(rules)
+	if err := this.Unit.Init(log); err != nil {
+		return nil, err
+	}
+	if err := this.Init(config); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
@@ -0,0 +1,433 @@
+/*
+	Mutablehome Automation: Rules
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// file is the JSON representation of a rules file
+type file struct {
+	Rules []*rule `json:"rules"`
+}
+
+type rule struct {
+	Name       string       `json:"name"`
+	Triggers   []*trigger   `json:"triggers"`
+	Conditions []*condition `json:"conditions,omitempty"`
+	Actions    []*action    `json:"actions"`
+}
+
+// state matches the state of a device, where power is matched if set,
+// and the value of a trait is compared with thresholds if set
+type state struct {
+	Node   string   `json:"node,omitempty"`
+	Device string   `json:"device,omitempty"`
+	Trait  string   `json:"trait,omitempty"`
+	Power  string   `json:"power,omitempty"`
+	Above  *float32 `json:"above,omitempty"`
+	Below  *float32 `json:"below,omitempty"`
+
+	trait mutablehome.TraitType
+	power mutablehome.TraitType
+}
+
+// trigger matches an event
+type trigger struct {
+	state
+	Event string `json:"event,omitempty"`
+
+	event mutablehome.EventType
+}
+
+// condition matches the time of day, where after and before are
+// in 24-hour format HH:MM, or the state of another device
+type condition struct {
+	state
+	After  string `json:"after,omitempty"`
+	Before string `json:"before,omitempty"`
+
+	after, before int
+}
+
+// action sets power or brightness for a device, with an optional delay
+type action struct {
+	Node       string   `json:"node,omitempty"`
+	Device     string   `json:"device"`
+	Power      string   `json:"power,omitempty"`
+	Brightness *float32 `json:"brightness,omitempty"`
+	Transition string   `json:"transition,omitempty"`
+	Delay      string   `json:"delay,omitempty"`
+
+	power      mutablehome.TraitType
+	transition time.Duration
+	delay      time.Duration
+}
+
+// lookupFunc returns a device for a node and device id, or nil
+type lookupFunc func(node, device string) mutablehome.Device
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	TIME_FORMAT = "15:04"
+	MINUTES_DAY = 24 * 60
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// READ RULES
+
+// readRules returns validated rules from a file
+func readRules(path string) ([]*rule, error) {
+	var rules file
+	if fh, err := os.Open(path); err != nil {
+		return nil, err
+	} else {
+		defer fh.Close()
+		dec := json.NewDecoder(fh)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rules); err != nil {
+			return nil, fmt.Errorf("%w: %v: %v", gopi.ErrBadParameter, path, err)
+		}
+	}
+
+	// Validate rules and check for unique names
+	names := make(map[string]bool, len(rules.Rules))
+	for _, rule := range rules.Rules {
+		if rule == nil {
+			return nil, gopi.ErrBadParameter.WithPrefix("rule")
+		} else if err := rule.Validate(); err != nil {
+			return nil, err
+		} else if _, exists := names[rule.Name]; exists {
+			return nil, gopi.ErrDuplicateItem.WithPrefix(strconv.Quote(rule.Name))
+		} else {
+			names[rule.Name] = true
+		}
+	}
+
+	// Success
+	return rules.Rules, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// VALIDATE
+
+func (this *rule) Validate() error {
+	if this.Name = strings.TrimSpace(this.Name); this.Name == "" {
+		return gopi.ErrBadParameter.WithPrefix("name")
+	} else if len(this.Triggers) == 0 {
+		return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": triggers")
+	} else if len(this.Actions) == 0 {
+		return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": actions")
+	}
+	for _, trigger := range this.Triggers {
+		if trigger == nil {
+			return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": trigger")
+		} else if err := trigger.Validate(); err != nil {
+			return fmt.Errorf("%v: trigger: %w", strconv.Quote(this.Name), err)
+		}
+	}
+	for _, condition := range this.Conditions {
+		if condition == nil {
+			return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": condition")
+		} else if err := condition.Validate(); err != nil {
+			return fmt.Errorf("%v: condition: %w", strconv.Quote(this.Name), err)
+		}
+	}
+	for _, action := range this.Actions {
+		if action == nil {
+			return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": action")
+		} else if err := action.Validate(); err != nil {
+			return fmt.Errorf("%v: action: %w", strconv.Quote(this.Name), err)
+		}
+	}
+
+	// Success
+	return nil
+}
+
+func (this *state) Validate() error {
+	if this.Trait != "" {
+		if trait, err := parseTraitType(this.Trait); err != nil {
+			return err
+		} else {
+			this.trait = trait
+		}
+	}
+	if this.Power != "" {
+		if power, err := mutablehome.ParsePower(this.Power); err != nil {
+			return err
+		} else if power == mutablehome.TRAIT_POWER_TOGGLE {
+			return gopi.ErrBadParameter.WithPrefix("power")
+		} else {
+			this.power = power
+		}
+	}
+	if this.Above != nil || this.Below != nil {
+		switch this.trait {
+		case mutablehome.TRAIT_LIGHT_BRIGHTNESS, mutablehome.TRAIT_COVER_POSITION, mutablehome.TRAIT_BATTERY_LEVEL:
+			break
+		default:
+			return gopi.ErrBadParameter.WithPrefix("trait")
+		}
+	}
+
+	// Success
+	return nil
+}
+
+func (this *trigger) Validate() error {
+	if err := this.state.Validate(); err != nil {
+		return err
+	} else if this.Event == "" {
+		this.event = mutablehome.EVENT_DEVICE_TRAIT_CHANGED
+	} else if event, err := parseEventType(this.Event); err != nil {
+		return err
+	} else {
+		this.event = event
+	}
+
+	// Success
+	return nil
+}
+
+func (this *condition) Validate() error {
+	if err := this.state.Validate(); err != nil {
+		return err
+	} else if this.Device == "" && (this.Power != "" || this.Trait != "") {
+		return gopi.ErrBadParameter.WithPrefix("device")
+	} else if this.Device != "" && this.Power == "" && this.Above == nil && this.Below == nil {
+		return gopi.ErrBadParameter.WithPrefix("power")
+	}
+	if after, err := parseTimeOfDay(this.After); err != nil {
+		return gopi.ErrBadParameter.WithPrefix("after")
+	} else if before, err := parseTimeOfDay(this.Before); err != nil {
+		return gopi.ErrBadParameter.WithPrefix("before")
+	} else {
+		this.after, this.before = after, before
+	}
+
+	// Success
+	return nil
+}
+
+func (this *action) Validate() error {
+	if this.Device == "" {
+		return gopi.ErrBadParameter.WithPrefix("device")
+	} else if this.Power == "" && this.Brightness == nil {
+		return gopi.ErrBadParameter.WithPrefix("power")
+	}
+	if this.Power != "" {
+		if power, err := mutablehome.ParsePower(this.Power); err != nil {
+			return err
+		} else {
+			this.power = power
+		}
+	}
+	if this.Brightness != nil && (*this.Brightness < 0 || *this.Brightness > 1) {
+		return gopi.ErrBadParameter.WithPrefix("brightness")
+	}
+	if this.Transition != "" {
+		if transition, err := time.ParseDuration(this.Transition); err != nil || transition < 0 {
+			return gopi.ErrBadParameter.WithPrefix("transition")
+		} else {
+			this.transition = transition
+		}
+	}
+	if this.Delay != "" {
+		if delay, err := time.ParseDuration(this.Delay); err != nil || delay < 0 {
+			return gopi.ErrBadParameter.WithPrefix("delay")
+		} else {
+			this.delay = delay
+		}
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// MATCH
+
+// Triggered returns true if any trigger matches an event
+func (this *rule) Triggered(evt mutablehome.Event) bool {
+	for _, trigger := range this.Triggers {
+		if trigger.Matches(evt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Satisfied returns true if all conditions are satisfied
+func (this *rule) Satisfied(now time.Time, lookup lookupFunc) bool {
+	for _, condition := range this.Conditions {
+		if condition.Matches(now, lookup) == false {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *trigger) Matches(evt mutablehome.Event) bool {
+	device := evt.Device()
+	if evt.Type() != this.event {
+		return false
+	} else if this.Node != "" && (evt.Node() == nil || evt.Node().Id() != this.Node) {
+		return false
+	} else if this.Device != "" && (device == nil || device.Id() != this.Device) {
+		return false
+	} else if this.Trait != "" && mutablehome.HasTrait(evt.Traits(), this.trait) == false {
+		return false
+	} else if this.Power != "" || this.Above != nil || this.Below != nil {
+		return device != nil && this.state.Matches(device)
+	} else {
+		return true
+	}
+}
+
+func (this *condition) Matches(now time.Time, lookup lookupFunc) bool {
+	if this.InTimeOfDay(now) == false {
+		return false
+	} else if this.Device == "" {
+		return true
+	} else if device := lookup(this.Node, this.Device); device == nil {
+		return false
+	} else {
+		return this.state.Matches(device)
+	}
+}
+
+// Matches returns true if the power and trait value for a device
+// match the state
+func (this *state) Matches(device mutablehome.Device) bool {
+	if this.Power != "" {
+		if power, ok := device.(mutablehome.PowerTrait); ok == false || power.Power() != this.power {
+			return false
+		}
+	}
+	if this.Above != nil || this.Below != nil {
+		if value, ok := traitValue(device, this.trait); ok == false {
+			return false
+		} else if this.Above != nil && value <= *this.Above {
+			return false
+		} else if this.Below != nil && value >= *this.Below {
+			return false
+		}
+	}
+	return true
+}
+
+// InTimeOfDay returns true if the time is between after and before,
+// which can span midnight
+func (this *condition) InTimeOfDay(now time.Time) bool {
+	minutes := now.Hour()*60 + now.Minute()
+	switch {
+	case this.after < 0 && this.before < 0:
+		return true
+	case this.after < 0:
+		return minutes < this.before
+	case this.before < 0:
+		return minutes >= this.after
+	case this.after <= this.before:
+		return minutes >= this.after && minutes < this.before
+	default:
+		return minutes >= this.after || minutes < this.before
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *action) String() string {
+	str := "<action"
+	if this.Node != "" {
+		str += " node=" + strconv.Quote(this.Node)
+	}
+	str += " device=" + strconv.Quote(this.Device)
+	if this.Power != "" {
+		str += " power=" + fmt.Sprint(this.power)
+	}
+	if this.Brightness != nil {
+		str += " brightness=" + fmt.Sprint(*this.Brightness)
+	}
+	if this.transition > 0 {
+		str += " transition=" + fmt.Sprint(this.transition)
+	}
+	if this.delay > 0 {
+		str += " delay=" + fmt.Sprint(this.delay)
+	}
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// parseEventType returns an event type with or without the EVENT_ prefix
+func parseEventType(value string) (mutablehome.EventType, error) {
+	for t := mutablehome.EVENT_NONE; t <= mutablehome.EVENT_MAX; t++ {
+		if strings.EqualFold(value, fmt.Sprint(t)) || strings.EqualFold("EVENT_"+value, fmt.Sprint(t)) {
+			return t, nil
+		}
+	}
+	return mutablehome.EVENT_NONE, gopi.ErrBadParameter.WithPrefix(strconv.Quote(value))
+}
+
+// parseTraitType returns a trait with or without the TRAIT_ prefix
+func parseTraitType(value string) (mutablehome.TraitType, error) {
+	for t := mutablehome.TRAIT_NONE; t <= mutablehome.TRAIT_MAX; t++ {
+		if strings.EqualFold(value, fmt.Sprint(t)) || strings.EqualFold("TRAIT_"+value, fmt.Sprint(t)) {
+			return t, nil
+		}
+	}
+	return mutablehome.TRAIT_NONE, gopi.ErrBadParameter.WithPrefix(strconv.Quote(value))
+}
+
+// parseTimeOfDay returns minutes since midnight, or -1 for an empty value
+func parseTimeOfDay(value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	} else if t, err := time.Parse(TIME_FORMAT, value); err != nil {
+		return -1, err
+	} else {
+		return (t.Hour()*60 + t.Minute()) % MINUTES_DAY, nil
+	}
+}
+
+// traitValue returns the value of a brightness, position or battery
+// level trait for a device
+func traitValue(device mutablehome.Device, trait mutablehome.TraitType) (float32, bool) {
+	switch trait {
+	case mutablehome.TRAIT_LIGHT_BRIGHTNESS:
+		if light, ok := device.(mutablehome.LightTrait); ok {
+			return light.Brightness(), true
+		}
+	case mutablehome.TRAIT_COVER_POSITION:
+		if cover, ok := device.(mutablehome.CoverTrait); ok {
+			return cover.Position(), true
+		}
+	case mutablehome.TRAIT_BATTERY_LEVEL:
+		if battery, ok := device.(mutablehome.BatteryTrait); ok {
+			return battery.BatteryLevel(), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,338 @@
+/*
+	Mutablehome Automation: Rules
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package rules
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type rules struct {
+	base.Unit
+	sync.Mutex
+	sync.WaitGroup
+
+	path    string
+	dryrun  bool
+	modtime time.Time
+	rules   []*rule
+	nodes   map[string]mutablehome.Node
+	stop    chan struct{}
+	cancel  chan struct{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// Interval for checking the rules file for changes
+	RELOAD_INTERVAL = 5 * time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (this *rules) Init(config Rules) error {
+	this.path = config.Path
+	this.dryrun = config.DryRun
+	this.nodes = make(map[string]mutablehome.Node)
+	this.stop = make(chan struct{})
+	this.cancel = make(chan struct{})
+
+	// Load rules and reload in the background when the file changes
+	if this.path != "" {
+		if err := this.Reload(); err != nil {
+			return err
+		}
+		this.WaitGroup.Add(1)
+		go this.BackgroundProcess(this.stop)
+	}
+
+	// Success
+	return nil
+}
+
+func (this *rules) Close() error {
+	// Stop background processes and delayed actions, and wait
+	// for them to end
+	close(this.stop)
+	this.WaitGroup.Wait()
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Release resources
+	this.rules = nil
+	this.nodes = nil
+	this.stop = nil
+	this.cancel = nil
+
+	// Success
+	return this.Unit.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *rules) String() string {
+	str := "<" + this.Log.Name()
+	if this.path != "" {
+		str += " path=" + strconv.Quote(this.path)
+	}
+	str += " rules=" + fmt.Sprint(this.Rules())
+	if this.dryrun {
+		str += " dryrun=true"
+	}
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.Rules
+
+func (this *rules) AddNode(node mutablehome.Node) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if node == nil {
+		return gopi.ErrBadParameter.WithPrefix("node")
+	} else if _, exists := this.nodes[node.Id()]; exists {
+		return gopi.ErrDuplicateItem.WithPrefix(strconv.Quote(node.Id()))
+	} else {
+		this.nodes[node.Id()] = node
+	}
+
+	// Evaluate rules on node events
+	this.WaitGroup.Add(1)
+	go this.EventProcess(node, node.Subscribe(), this.stop)
+
+	// Success
+	return nil
+}
+
+func (this *rules) Reload() error {
+	if this.path == "" {
+		return gopi.ErrBadParameter.WithPrefix("path")
+	}
+	stat, err := os.Stat(this.path)
+	if err != nil {
+		return err
+	}
+	rules, err := readRules(this.path)
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Keep existing rules when the file cannot be parsed, and don't
+	// reload again until the file is modified
+	this.modtime = stat.ModTime()
+	if err != nil {
+		return err
+	}
+
+	// Cancel delayed actions from existing rules
+	close(this.cancel)
+	this.cancel = make(chan struct{})
+
+	// Replace rules
+	this.rules = rules
+	this.Log.Info("Loaded", len(rules), "rules from", strconv.Quote(this.path))
+
+	// Success
+	return nil
+}
+
+func (this *rules) Rules() []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	names := make([]string, len(this.rules))
+	for i, rule := range this.rules {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+func (this *rules) DryRun() bool {
+	return this.dryrun
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND PROCESS
+
+// BackgroundProcess reloads rules when the modification time of the
+// file changes. Existing rules are kept when the file cannot be parsed
+func (this *rules) BackgroundProcess(stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+
+	this.Log.Debug("Start of background process")
+	ticker := time.NewTicker(RELOAD_INTERVAL)
+FOR_LOOP:
+	for {
+		select {
+		case <-ticker.C:
+			if this.isModified() {
+				if err := this.Reload(); err != nil {
+					this.Log.Error(err)
+				}
+			}
+		case <-stop:
+			ticker.Stop()
+			break FOR_LOOP
+		}
+	}
+	this.Log.Debug("End of background process")
+}
+
+// EventProcess evaluates rules on events from a node until the
+// rules engine is closed or the node stops emitting events
+func (this *rules) EventProcess(node mutablehome.Node, evts <-chan interface{}, stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+	mutablehome.ProcessEvents(node, evts, stop, func(evt mutablehome.Event) {
+		this.ProcessEvent(evt)
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EVALUATE RULES
+
+// ProcessEvent performs the actions for rules which are triggered by
+// an event and for which all conditions are satisfied
+func (this *rules) ProcessEvent(evt mutablehome.Event) {
+	this.Mutex.Lock()
+	rules, cancel := this.rules, this.cancel
+	this.Mutex.Unlock()
+
+	now := time.Now()
+	for _, rule := range rules {
+		if rule.Triggered(evt) == false {
+			continue
+		} else if rule.Satisfied(now, this.lookup) == false {
+			this.Log.Debug(strconv.Quote(rule.Name)+": Conditions not satisfied:", evt)
+			continue
+		}
+		this.Log.Debug(strconv.Quote(rule.Name)+": Triggered:", evt)
+		for _, action := range rule.Actions {
+			this.Schedule(rule, action, cancel)
+		}
+	}
+}
+
+// Schedule performs an action, after a delay if set. When in dry-run
+// mode the action is logged instead
+func (this *rules) Schedule(rule *rule, action *action, cancel <-chan struct{}) {
+	if this.dryrun {
+		this.Log.Info("Dry run:", strconv.Quote(rule.Name), action)
+		return
+	} else if action.delay == 0 {
+		// Perform the action in the background so that a slow device
+		// does not hold up events emitted by the node
+		this.WaitGroup.Add(1)
+		go func() {
+			defer this.WaitGroup.Done()
+			this.perform(rule, action)
+		}()
+		return
+	}
+
+	// Perform the action after a delay, unless the rules are reloaded
+	// or the rules engine is closed
+	this.WaitGroup.Add(1)
+	go func(stop <-chan struct{}) {
+		defer this.WaitGroup.Done()
+		timer := time.NewTimer(action.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			this.perform(rule, action)
+		case <-cancel:
+			this.Log.Debug(strconv.Quote(rule.Name)+": Cancelled:", action)
+		case <-stop:
+			break
+		}
+	}(this.stop)
+}
+
+// Perform sets power and brightness for the device in an action
+func (this *rules) Perform(action *action) error {
+	device := this.lookup(action.Node, action.Device)
+	if device == nil {
+		return gopi.ErrNotFound.WithPrefix(strconv.Quote(action.Device))
+	}
+	if action.Power != "" {
+		if power, ok := device.(mutablehome.PowerTrait); ok == false {
+			return gopi.ErrNotImplemented.WithPrefix("SetPower")
+		} else if err := power.SetPower(action.power); err != nil {
+			return err
+		}
+	}
+	if action.Brightness != nil {
+		if light, ok := device.(mutablehome.LightTrait); ok == false {
+			return gopi.ErrNotImplemented.WithPrefix("SetBrightness")
+		} else if err := light.SetBrightness(*action.Brightness, action.transition); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *rules) perform(rule *rule, action *action) {
+	if err := this.Perform(action); err != nil {
+		this.Log.Error(fmt.Errorf("%v: %w", strconv.Quote(rule.Name), err))
+	} else {
+		this.Log.Info(strconv.Quote(rule.Name)+":", action)
+	}
+}
+
+// lookup returns a device from a node, or from any node when the
+// node is not set
+func (this *rules) lookup(node, device string) mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if node != "" {
+		if node, exists := this.nodes[node]; exists {
+			return node.Device(device)
+		}
+		return nil
+	}
+	for _, node := range this.nodes {
+		if device := node.Device(device); device != nil {
+			return device
+		}
+	}
+	return nil
+}
+
+// isModified returns true if the rules file has been modified
+// since the rules were loaded
+func (this *rules) isModified() bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if stat, err := os.Stat(this.path); err != nil {
+		return false
+	} else {
+		return stat.ModTime().Equal(this.modtime) == false
+	}
+}
@@ -0,0 +1,317 @@
+package rules_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+	rules "github.com/djthorpe/mutablehome/unit/rules"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NODE, DEVICES AND EVENTS
+
+type node struct {
+	base.PubSub
+	devices map[string]*device
+}
+
+func (*node) Id() string                               { return "node" }
+func (*node) Name() string                             { return "Node" }
+func (this *node) Device(id string) mutablehome.Device { return this.devices[id] }
+func (this *node) Devices() []mutablehome.Device       { return nil }
+
+type device struct {
+	sync.Mutex
+	id         string
+	power      mutablehome.TraitType
+	brightness float32
+	block      chan struct{}
+}
+
+func (this *device) Id() string   { return this.id }
+func (this *device) Name() string { return "Device " + this.id }
+func (this *device) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_LIGHT_BRIGHTNESS}
+}
+
+func (this *device) Power() mutablehome.TraitType {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.power
+}
+
+func (this *device) SetPower(power mutablehome.TraitType) error {
+	// Wait until unblocked, to simulate a slow device
+	if this.block != nil {
+		<-this.block
+	}
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.power = power
+	return nil
+}
+
+func (this *device) Brightness() float32 {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.brightness
+}
+
+func (this *device) SetBrightness(value float32, _ time.Duration) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.brightness = value
+	return nil
+}
+
+type event struct {
+	t      mutablehome.EventType
+	device mutablehome.Device
+	traits []mutablehome.TraitType
+}
+
+func (*event) Name() string                         { return "mutablehome.Event" }
+func (*event) NS() gopi.EventNS                     { return gopi.EVENT_NS_DEFAULT }
+func (*event) Source() gopi.Unit                    { return nil }
+func (this *event) Value() interface{}              { return this.device }
+func (this *event) Type() mutablehome.EventType     { return this.t }
+func (*event) Node() mutablehome.Node               { return nil }
+func (this *event) Device() mutablehome.Device      { return this.device }
+func (this *event) Traits() []mutablehome.TraitType { return this.traits }
+
+func NewNode() *node {
+	return &node{devices: map[string]*device{
+		"sensor": &device{id: "sensor", power: mutablehome.TRAIT_POWER_ON},
+		"lamp":   &device{id: "lamp", power: mutablehome.TRAIT_POWER_OFF},
+	}}
+}
+
+func (this *node) Activity() {
+	this.Emit(&event{mutablehome.EVENT_DEVICE_TRAIT_CHANGED, this.devices["sensor"], []mutablehome.TraitType{mutablehome.TRAIT_SENSOR_ACTIVITY}})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RULES
+
+const (
+	RULES_LAMP = `{ "rules": [{
+		"name": "lamp",
+		"triggers": [{ "device": "sensor", "trait": "SENSOR_ACTIVITY" }],
+		"conditions": [{ "after": "00:00" }, { "device": "lamp", "power": "OFF" }],
+		"actions": [{ "device": "lamp", "power": "ON", "brightness": 0.5 }]
+	}]}`
+	RULES_DELAY = `{ "rules": [{
+		"name": "delay",
+		"triggers": [{ "event": "DEVICE_TRAIT_CHANGED", "device": "sensor" }],
+		"actions": [{ "device": "lamp", "power": "on", "delay": "200ms" }]
+	}]}`
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Rules_000(t *testing.T) {
+	t.Log("Test_Rules_000")
+}
+
+func Test_Rules_001(t *testing.T) {
+	for i, data := range []string{
+		`{ "rules": [{ "triggers": [{}], "actions": [{ "device": "lamp", "power": "ON" }] }] }`,
+		`{ "rules": [{ "name": "a", "actions": [{ "device": "lamp", "power": "ON" }] }] }`,
+		`{ "rules": [{ "name": "a", "triggers": [{}] }] }`,
+		`{ "rules": [{ "name": "a", "triggers": [{ "trait": "XX" }], "actions": [{ "device": "lamp", "power": "ON" }] }] }`,
+		`{ "rules": [{ "name": "a", "triggers": [{ "event": "XX" }], "actions": [{ "device": "lamp", "power": "ON" }] }] }`,
+		`{ "rules": [{ "name": "a", "triggers": [{}], "actions": [{ "device": "lamp" }] }] }`,
+		`{ "rules": [{ "name": "a", "triggers": [{}], "actions": [{ "device": "lamp", "brightness": 2 }] }] }`,
+		`{ "rules": [{ "name": "a", "triggers": [{}], "actions": [{ "device": "lamp", "power": "ON", "delay": "x" }] }] }`,
+		`{ "rules": [{ "name": "a", "triggers": [{}], "conditions": [{ "after": "25:00" }], "actions": [{ "device": "lamp", "power": "ON" }] }] }`,
+		`{ "rules": [{ "name": "a", "triggers": [{}], "actions": [{ "device": "lamp", "power": "ON" }] }, { "name": "a", "triggers": [{}], "actions": [{ "device": "lamp", "power": "OFF" }] }] }`,
+		`{ "rules": [{ "name": "a", "unknown": true }] }`,
+	} {
+		path := WriteRules(t, data)
+		defer os.Remove(path)
+		if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+			if _, err := gopi.New(rules.Rules{Path: path}, app.Log()); err == nil {
+				t.Error(i, "Expected error for", data)
+			} else {
+				t.Log(i, err)
+			}
+		}, nil); err != nil {
+			t.Error(err)
+		} else if returnCode := app.Run(); returnCode != 0 {
+			t.Error("Unexpected return code", returnCode)
+		}
+	}
+}
+
+func Test_Rules_002(t *testing.T) {
+	node := NewNode()
+	path := WriteRules(t, RULES_LAMP)
+	defer os.Remove(path)
+	RunWithRules(t, rules.Rules{Path: path}, func(app gopi.App, rules mutablehome.Rules, t *testing.T) {
+		if names := rules.Rules(); len(names) != 1 || names[0] != "lamp" {
+			t.Error("Unexpected rules", names)
+		} else if err := rules.AddNode(node); err != nil {
+			t.Fatal(err)
+		} else if err := rules.AddNode(node); err == nil {
+			t.Error("Expected error adding node twice")
+		}
+
+		// Activity turns on the lamp
+		node.Activity()
+		lamp := node.devices["lamp"]
+		if WaitFor(func() bool { return lamp.Power() == mutablehome.TRAIT_POWER_ON && lamp.Brightness() == 0.5 }) == false {
+			t.Error("Unexpected lamp state", lamp.Power(), lamp.Brightness())
+		}
+
+		// When the lamp is on, the condition is not satisfied
+		lamp.SetBrightness(0.1, 0)
+		node.Activity()
+		time.Sleep(100 * time.Millisecond)
+		if lamp.Brightness() != 0.1 {
+			t.Error("Unexpected brightness", lamp.Brightness())
+		}
+		t.Log(rules)
+	})
+}
+
+func Test_Rules_003(t *testing.T) {
+	node := NewNode()
+	path := WriteRules(t, RULES_LAMP)
+	defer os.Remove(path)
+	RunWithRules(t, rules.Rules{Path: path, DryRun: true}, func(app gopi.App, rules mutablehome.Rules, t *testing.T) {
+		if rules.DryRun() == false {
+			t.Error("Expected dry run")
+		} else if err := rules.AddNode(node); err != nil {
+			t.Fatal(err)
+		}
+
+		// Actions are not performed in dry-run mode
+		node.Activity()
+		time.Sleep(100 * time.Millisecond)
+		if lamp := node.devices["lamp"]; lamp.Power() != mutablehome.TRAIT_POWER_OFF {
+			t.Error("Unexpected power", lamp.Power())
+		}
+	})
+}
+
+func Test_Rules_004(t *testing.T) {
+	node := NewNode()
+	path := WriteRules(t, RULES_DELAY)
+	defer os.Remove(path)
+	RunWithRules(t, rules.Rules{Path: path}, func(app gopi.App, rules mutablehome.Rules, t *testing.T) {
+		if err := rules.AddNode(node); err != nil {
+			t.Fatal(err)
+		}
+
+		// Reloading rules cancels delayed actions
+		node.Activity()
+		if err := ioutil.WriteFile(path, []byte(RULES_LAMP), 0644); err != nil {
+			t.Fatal(err)
+		} else if err := rules.Reload(); err != nil {
+			t.Fatal(err)
+		} else if names := rules.Rules(); len(names) != 1 || names[0] != "lamp" {
+			t.Error("Unexpected rules", names)
+		}
+		time.Sleep(400 * time.Millisecond)
+		if lamp := node.devices["lamp"]; lamp.Power() != mutablehome.TRAIT_POWER_OFF {
+			t.Error("Unexpected power", lamp.Power())
+		}
+
+		// Existing rules are kept when the file cannot be parsed
+		if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		} else if err := rules.Reload(); err == nil {
+			t.Error("Expected error from reload")
+		} else if names := rules.Rules(); len(names) != 1 || names[0] != "lamp" {
+			t.Error("Unexpected rules", names)
+		}
+	})
+}
+
+func Test_Rules_005(t *testing.T) {
+	node := NewNode()
+	lamp := node.devices["lamp"]
+	lamp.block = make(chan struct{})
+	path := WriteRules(t, RULES_LAMP)
+	defer os.Remove(path)
+	RunWithRules(t, rules.Rules{Path: path}, func(app gopi.App, rules mutablehome.Rules, t *testing.T) {
+		if err := rules.AddNode(node); err != nil {
+			t.Fatal(err)
+		}
+
+		// A slow device does not hold up events from the node
+		node.Activity()
+		done := make(chan struct{})
+		go func() {
+			node.Activity()
+			close(done)
+		}()
+		select {
+		case <-done:
+			break
+		case <-time.After(time.Second):
+			t.Error("Timeout emitting event")
+		}
+
+		// Actions are performed when the device is unblocked
+		close(lamp.block)
+		if WaitFor(func() bool { return lamp.Power() == mutablehome.TRAIT_POWER_ON }) == false {
+			t.Error("Unexpected power", lamp.Power())
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func RunWithRules(t *testing.T, config rules.Rules, main func(gopi.App, mutablehome.Rules, *testing.T)) {
+	t.Helper()
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(config, app.Log().Clone(config.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(app, unit.(mutablehome.Rules), t)
+	}, nil); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+// WriteRules writes rules to a temporary file and returns the path
+func WriteRules(t *testing.T, data string) string {
+	t.Helper()
+	fh, err := ioutil.TempFile("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	if _, err := fh.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	return fh.Name()
+}
+
+// WaitFor returns true when a condition is met, or false after a timeout
+func WaitFor(fn func() bool) bool {
+	timeout := time.After(5 * time.Second)
+	for fn() == false {
+		select {
+		case <-timeout:
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+/*
+	Mutablehome Automation: Scheduler
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package scheduler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// cron is a parsed cron expression with five fields: minute, hour,
+// day of month, month and day of week. Each field is a bitset of
+// values which match
+type cron struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type cronField struct {
+	min, max uint
+	names    []string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	cronMinute = cronField{0, 59, nil}
+	cronHour   = cronField{0, 23, nil}
+	cronDom    = cronField{1, 31, nil}
+	cronMonth  = cronField{1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	cronDow    = cronField{0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+const (
+	// Maximum number of years to search for the next time
+	CRON_MAX_YEARS = 5
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+// parseCron returns a cron expression from five fields separated by
+// whitespace, or a macro such as @daily. Fields can contain
+// wildcards, ranges, steps and lists, and month and day of week
+// fields can contain three-letter names
+func parseCron(spec string) (*cron, error) {
+	this := &cron{spec: spec}
+	if macro, exists := cronMacros[strings.ToLower(strings.TrimSpace(spec))]; exists {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.spec))
+	}
+	var err error
+	if this.minute, err = cronMinute.parse(fields[0]); err != nil {
+		return nil, err
+	} else if this.hour, err = cronHour.parse(fields[1]); err != nil {
+		return nil, err
+	} else if this.dom, err = cronDom.parse(fields[2]); err != nil {
+		return nil, err
+	} else if this.month, err = cronMonth.parse(fields[3]); err != nil {
+		return nil, err
+	} else if this.dow, err = cronDow.parse(fields[4]); err != nil {
+		return nil, err
+	}
+
+	// Sunday is 0 or 7
+	if this.dow&(1<<7) != 0 {
+		this.dow |= 1 << 0
+	}
+
+	// When both day of month and day of week are restricted, either
+	// can match
+	this.domAny = strings.HasPrefix(fields[2], "*")
+	this.dowAny = strings.HasPrefix(fields[4], "*")
+
+	// Success
+	return this, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *cron) String() string {
+	return "<cron " + strconv.Quote(this.spec) + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Next returns the first time after t which matches the expression,
+// in the location of t, or zero if there is no time which matches
+func (this *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(CRON_MAX_YEARS, 0, 0)
+	for t.Before(limit) {
+		if this.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		} else if this.matchDay(t) == false {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		} else if this.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		} else if this.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+		} else {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *cron) matchDay(t time.Time) bool {
+	dom := this.dom&(1<<uint(t.Day())) != 0
+	dow := this.dow&(1<<uint(t.Weekday())) != 0
+	if this.domAny || this.dowAny {
+		return dom && dow
+	} else {
+		return dom || dow
+	}
+}
+
+// parse returns a bitset for a field which is a comma-separated list
+// of values, ranges and steps
+func (this cronField) parse(field string) (uint64, error) {
+	bits := uint64(0)
+	for _, part := range strings.Split(field, ",") {
+		min, max, step := this.min, this.max, uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			if value, err := strconv.ParseUint(part[i+1:], 10, 8); err != nil || value == 0 {
+				return 0, gopi.ErrBadParameter.WithPrefix(strconv.Quote(field))
+			} else {
+				step, part = uint(value), part[:i]
+			}
+		}
+		if part == "*" {
+			// All values
+		} else if i := strings.Index(part, "-"); i >= 0 {
+			var err error
+			if min, err = this.value(part[:i]); err != nil {
+				return 0, gopi.ErrBadParameter.WithPrefix(strconv.Quote(field))
+			} else if max, err = this.value(part[i+1:]); err != nil || max < min {
+				return 0, gopi.ErrBadParameter.WithPrefix(strconv.Quote(field))
+			}
+		} else if value, err := this.value(part); err != nil {
+			return 0, gopi.ErrBadParameter.WithPrefix(strconv.Quote(field))
+		} else if step > 1 {
+			min = value
+		} else {
+			min, max = value, value
+		}
+		for value := min; value <= max; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// value returns a number or name for a field
+func (this cronField) value(value string) (uint, error) {
+	for i, name := range this.names {
+		if strings.EqualFold(name, value) {
+			return this.min + uint(i), nil
+		}
+	}
+	if value, err := strconv.ParseUint(value, 10, 8); err != nil {
+		return 0, err
+	} else if uint(value) < this.min || uint(value) > this.max {
+		return 0, gopi.ErrBadParameter
+	} else {
+		return uint(value), nil
+	}
+}
@@ -0,0 +1,69 @@
+/*
+	Mutablehome Automation: Scheduler
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package scheduler
+
+import (
+	"strconv"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type event struct {
+	Source_   gopi.Unit
+	Schedule_ string
+	Time_     time.Time
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func (this *scheduler) NewScheduleEvent(schedule string, ts time.Time) *event {
+	return &event{this, schedule, ts}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (*event) Name() string {
+	return "mutablehome.ScheduleEvent"
+}
+
+func (*event) NS() gopi.EventNS {
+	return gopi.EVENT_NS_DEFAULT
+}
+
+func (this *event) Source() gopi.Unit {
+	return this.Source_
+}
+
+func (this *event) Value() interface{} {
+	return this.Schedule_
+}
+
+func (this *event) Schedule() string {
+	return this.Schedule_
+}
+
+func (this *event) Time() time.Time {
+	return this.Time_
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *event) String() string {
+	str := "<" + this.Name()
+	str += " schedule=" + strconv.Quote(this.Schedule_)
+	str += " time=" + this.Time_.Format(time.RFC3339)
+	return str + ">"
+}
@@ -0,0 +1,35 @@
+/*
+	Mutablehome Automation: Scheduler
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package scheduler
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	// Scheduler
+	gopi.UnitRegister(gopi.UnitConfig{
+		Name: Scheduler{}.Name(),
+		Config: func(app gopi.App) error {
+			app.Flags().FlagString("scheduler.path", "", "Schedules file")
+			app.Flags().FlagFloat64("scheduler.lat", 0, "Latitude for solar events")
+			app.Flags().FlagFloat64("scheduler.lng", 0, "Longitude for solar events")
+			return nil
+		},
+		New: func(app gopi.App) (gopi.Unit, error) {
+			return gopi.New(Scheduler{
+				Path:      app.Flags().GetString("scheduler.path", gopi.FLAG_NS_DEFAULT),
+				Latitude:  app.Flags().GetFloat64("scheduler.lat", gopi.FLAG_NS_DEFAULT),
+				Longitude: app.Flags().GetFloat64("scheduler.lng", gopi.FLAG_NS_DEFAULT),
+			}, app.Log().Clone(Scheduler{}.Name()))
+		},
+	})
+}
@@ -0,0 +1,56 @@
+/*
+	Mutablehome Automation: Scheduler
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+// Package scheduler performs actions on devices on a schedule loaded
+// from a JSON file. A schedule runs either on a cron expression or at
+// a time of day, which can be a fixed time or a solar event (sunrise,
+// sunset, dawn or dusk) with an offset. Dawn and dusk are civil
+// twilight. Solar events are calculated locally from the latitude and
+// longitude, so no network access is required. For example:
+//
+//	{
+//	  "schedules": [{
+//	    "name": "porch-on",
+//	    "at": "dusk-15m",
+//	    "actions": [{ "device": "65538", "power": "ON", "brightness": 0.6 }]
+//	  },{
+//	    "name": "porch-off",
+//	    "cron": "30 23 * * mon-fri",
+//	    "actions": [{ "device": "65538", "power": "OFF" }]
+//	  }]
+//	}
+package scheduler
+
+import (
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Scheduler struct {
+	Path      string
+	Latitude  float64
+	Longitude float64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (Scheduler) Name() string { return "mutablehome/scheduler" }
+
+func (config Scheduler) New(log gopi.Logger) (gopi.Unit, error) {
+	this := new(scheduler)
+	if err := this.Unit.Init(log); err != nil {
+		return nil, err
+	}
+	if err := this.Init(config); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
@@ -0,0 +1,276 @@
+/*
+	Mutablehome Automation: Scheduler
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// file is the JSON representation of a schedules file
+type file struct {
+	Schedules []*schedule `json:"schedules"`
+}
+
+// schedule runs actions on a cron expression or at a time of day
+type schedule struct {
+	Name    string    `json:"name"`
+	Cron    string    `json:"cron,omitempty"`
+	At      string    `json:"at,omitempty"`
+	Actions []*action `json:"actions"`
+
+	when when
+	next time.Time
+}
+
+// action sets power or brightness for a device
+type action struct {
+	Node       string   `json:"node,omitempty"`
+	Device     string   `json:"device"`
+	Power      string   `json:"power,omitempty"`
+	Brightness *float32 `json:"brightness,omitempty"`
+	Transition string   `json:"transition,omitempty"`
+
+	power      mutablehome.TraitType
+	transition time.Duration
+}
+
+// when returns the next time after t, or zero
+type when interface {
+	Next(t time.Time) time.Time
+}
+
+// at is a fixed time of day or a solar event, with an offset
+type at struct {
+	spec     string
+	event    solarEvent
+	minutes  int
+	offset   time.Duration
+	location *location
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	TIME_FORMAT = "15:04"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// READ SCHEDULES
+
+// readSchedules returns validated schedules from a file. The location
+// is required for schedules with solar events, and can be nil
+func readSchedules(path string, location *location) ([]*schedule, error) {
+	var schedules file
+	if fh, err := os.Open(path); err != nil {
+		return nil, err
+	} else {
+		defer fh.Close()
+		dec := json.NewDecoder(fh)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&schedules); err != nil {
+			return nil, fmt.Errorf("%w: %v: %v", gopi.ErrBadParameter, path, err)
+		}
+	}
+
+	// Validate schedules and check for unique names
+	names := make(map[string]bool, len(schedules.Schedules))
+	for _, schedule := range schedules.Schedules {
+		if schedule == nil {
+			return nil, gopi.ErrBadParameter.WithPrefix("schedule")
+		} else if err := schedule.Validate(location); err != nil {
+			return nil, err
+		} else if _, exists := names[schedule.Name]; exists {
+			return nil, gopi.ErrDuplicateItem.WithPrefix(strconv.Quote(schedule.Name))
+		} else {
+			names[schedule.Name] = true
+		}
+	}
+
+	// Success
+	return schedules.Schedules, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// VALIDATE
+
+func (this *schedule) Validate(location *location) error {
+	if this.Name = strings.TrimSpace(this.Name); this.Name == "" {
+		return gopi.ErrBadParameter.WithPrefix("name")
+	} else if len(this.Actions) == 0 {
+		return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": actions")
+	}
+	switch {
+	case this.Cron != "" && this.At != "":
+		return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": cron and at")
+	case this.Cron != "":
+		if cron, err := parseCron(this.Cron); err != nil {
+			return fmt.Errorf("%v: cron: %w", strconv.Quote(this.Name), err)
+		} else {
+			this.when = cron
+		}
+	case this.At != "":
+		if at, err := parseAt(this.At, location); err != nil {
+			return fmt.Errorf("%v: at: %w", strconv.Quote(this.Name), err)
+		} else {
+			this.when = at
+		}
+	default:
+		return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": cron or at")
+	}
+	for _, action := range this.Actions {
+		if action == nil {
+			return gopi.ErrBadParameter.WithPrefix(strconv.Quote(this.Name) + ": action")
+		} else if err := action.Validate(); err != nil {
+			return fmt.Errorf("%v: action: %w", strconv.Quote(this.Name), err)
+		}
+	}
+
+	// Success
+	return nil
+}
+
+func (this *action) Validate() error {
+	if this.Device == "" {
+		return gopi.ErrBadParameter.WithPrefix("device")
+	} else if this.Power == "" && this.Brightness == nil {
+		return gopi.ErrBadParameter.WithPrefix("power")
+	}
+	if this.Power != "" {
+		if power, err := mutablehome.ParsePower(this.Power); err != nil {
+			return err
+		} else {
+			this.power = power
+		}
+	}
+	if this.Brightness != nil && (*this.Brightness < 0 || *this.Brightness > 1) {
+		return gopi.ErrBadParameter.WithPrefix("brightness")
+	}
+	if this.Transition != "" {
+		if transition, err := time.ParseDuration(this.Transition); err != nil || transition < 0 {
+			return gopi.ErrBadParameter.WithPrefix("transition")
+		} else {
+			this.transition = transition
+		}
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// AT
+
+// parseAt returns a time of day as HH:MM or a solar event (sunrise,
+// sunset, dawn or dusk) with an optional offset, for example
+// "sunset-30m" or "07:30"
+func parseAt(spec string, location *location) (*at, error) {
+	this := &at{spec: spec, location: location}
+	value := strings.ToLower(strings.TrimSpace(spec))
+	if i := strings.IndexAny(value, "+-"); i >= 0 {
+		if offset, err := time.ParseDuration(value[i:]); err != nil {
+			return nil, gopi.ErrBadParameter.WithPrefix(strconv.Quote(spec))
+		} else {
+			this.offset, value = offset, value[:i]
+		}
+	}
+	switch value {
+	case "sunrise":
+		this.event = SOLAR_SUNRISE
+	case "sunset":
+		this.event = SOLAR_SUNSET
+	case "dawn":
+		this.event = SOLAR_DAWN
+	case "dusk":
+		this.event = SOLAR_DUSK
+	default:
+		if t, err := time.Parse(TIME_FORMAT, value); err != nil {
+			return nil, gopi.ErrBadParameter.WithPrefix(strconv.Quote(spec))
+		} else {
+			this.minutes = t.Hour()*60 + t.Minute()
+		}
+	}
+
+	// Solar events require a location
+	if this.event != SOLAR_NONE && location == nil {
+		return nil, gopi.ErrBadParameter.WithPrefix("latitude and longitude are required for " + strconv.Quote(spec))
+	}
+
+	// Success
+	return this, nil
+}
+
+func (this *at) String() string {
+	return "<at " + strconv.Quote(this.spec) + ">"
+}
+
+// Next returns the first time after t for the time of day or solar
+// event, or zero if the solar event does not occur within a year.
+// The previous day is also considered in case the offset moves the
+// time into the next day
+func (this *at) Next(t time.Time) time.Time {
+	year, month, day := t.Date()
+	for i := -1; i <= 366; i++ {
+		var next time.Time
+		if this.event == SOLAR_NONE {
+			next = time.Date(year, month, day+i, 0, this.minutes, 0, 0, t.Location())
+		} else if solar, ok := this.location.Time(time.Date(year, month, day+i, 12, 0, 0, 0, t.Location()), this.event); ok {
+			next = solar
+		} else {
+			continue
+		}
+		if next = next.Add(this.offset); next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *schedule) String() string {
+	str := "<schedule name=" + strconv.Quote(this.Name)
+	if this.when != nil {
+		str += " when=" + fmt.Sprint(this.when)
+	}
+	if this.next.IsZero() == false {
+		str += " next=" + this.next.Format(time.RFC3339)
+	}
+	return str + ">"
+}
+
+func (this *action) String() string {
+	str := "<action"
+	if this.Node != "" {
+		str += " node=" + strconv.Quote(this.Node)
+	}
+	str += " device=" + strconv.Quote(this.Device)
+	if this.Power != "" {
+		str += " power=" + fmt.Sprint(this.power)
+	}
+	if this.Brightness != nil {
+		str += " brightness=" + fmt.Sprint(*this.Brightness)
+	}
+	if this.transition > 0 {
+		str += " transition=" + fmt.Sprint(this.transition)
+	}
+	return str + ">"
+}
@@ -0,0 +1,321 @@
+/*
+	Mutablehome Automation: Scheduler
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type scheduler struct {
+	base.Unit
+	base.PubSub
+	sync.Mutex
+	sync.WaitGroup
+
+	path      string
+	location  *location
+	schedules []*schedule
+	nodes     map[string]mutablehome.Node
+	stop      chan struct{}
+}
+
+// due is a schedule and the time it was due to run
+type due struct {
+	schedule *schedule
+	ts       time.Time
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	// Maximum time to wait before checking schedules again, so that
+	// changes to the system clock are noticed
+	SCHEDULE_MAX_WAIT = time.Minute
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (this *scheduler) Init(config Scheduler) error {
+	// Set location for solar events, where zero latitude and
+	// longitude means no location is set
+	if config.Latitude < -90 || config.Latitude > 90 {
+		return gopi.ErrBadParameter.WithPrefix("Latitude")
+	} else if config.Longitude < -180 || config.Longitude > 180 {
+		return gopi.ErrBadParameter.WithPrefix("Longitude")
+	} else if config.Latitude != 0 || config.Longitude != 0 {
+		this.location = &location{config.Latitude, config.Longitude}
+	}
+
+	// Read schedules
+	this.path = config.Path
+	if this.path != "" {
+		if schedules, err := readSchedules(this.path, this.location); err != nil {
+			return err
+		} else {
+			this.schedules = schedules
+		}
+	}
+
+	// Calculate the next time for each schedule
+	now := time.Now()
+	for _, schedule := range this.schedules {
+		schedule.next = schedule.when.Next(now)
+		this.Log.Debug(schedule)
+	}
+
+	// Run schedules in the background
+	this.nodes = make(map[string]mutablehome.Node)
+	this.stop = make(chan struct{})
+	this.WaitGroup.Add(1)
+	go this.BackgroundProcess(this.stop)
+
+	// Success
+	return nil
+}
+
+func (this *scheduler) Close() error {
+	// Stop background process and wait for it to end
+	close(this.stop)
+	this.WaitGroup.Wait()
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Unsubscribe any listeners
+	if err := this.PubSub.Close(); err != nil {
+		return err
+	}
+
+	// Release resources
+	this.schedules = nil
+	this.nodes = nil
+	this.stop = nil
+
+	// Success
+	return this.Unit.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *scheduler) String() string {
+	str := "<" + this.Log.Name()
+	if this.path != "" {
+		str += " path=" + strconv.Quote(this.path)
+	}
+	if this.location != nil {
+		str += " location=" + fmt.Sprint(this.location)
+	}
+	str += " schedules=" + fmt.Sprint(this.Schedules())
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.Scheduler
+
+func (this *scheduler) AddNode(node mutablehome.Node) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if node == nil {
+		return gopi.ErrBadParameter.WithPrefix("node")
+	} else if _, exists := this.nodes[node.Id()]; exists {
+		return gopi.ErrDuplicateItem.WithPrefix(strconv.Quote(node.Id()))
+	} else {
+		this.nodes[node.Id()] = node
+	}
+
+	// Success
+	return nil
+}
+
+func (this *scheduler) Schedules() []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	names := make([]string, len(this.schedules))
+	for i, schedule := range this.schedules {
+		names[i] = schedule.Name
+	}
+	return names
+}
+
+func (this *scheduler) Next(name string) time.Time {
+	if schedule := this.schedule(name); schedule == nil {
+		return time.Time{}
+	} else {
+		this.Mutex.Lock()
+		defer this.Mutex.Unlock()
+		return schedule.next
+	}
+}
+
+func (this *scheduler) Run(name string) error {
+	if schedule := this.schedule(name); schedule == nil {
+		return gopi.ErrNotFound.WithPrefix(strconv.Quote(name))
+	} else {
+		return this.run(schedule, time.Now())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKGROUND PROCESS
+
+// BackgroundProcess runs schedules which are due and then waits
+// until the next schedule is due
+func (this *scheduler) BackgroundProcess(stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+
+	this.Log.Debug("Start of background process")
+	timer := time.NewTimer(this.wait(time.Now()))
+FOR_LOOP:
+	for {
+		select {
+		case <-timer.C:
+			now := time.Now()
+			for _, due := range this.due(now) {
+				if err := this.run(due.schedule, due.ts); err != nil {
+					this.Log.Error(err)
+				}
+			}
+			timer.Reset(this.wait(now))
+		case <-stop:
+			timer.Stop()
+			break FOR_LOOP
+		}
+	}
+	this.Log.Debug("End of background process")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PERFORM ACTIONS
+
+// Perform sets power and brightness for the device in an action
+func (this *scheduler) Perform(action *action) error {
+	device := this.lookup(action.Node, action.Device)
+	if device == nil {
+		return gopi.ErrNotFound.WithPrefix(strconv.Quote(action.Device))
+	}
+	if action.Power != "" {
+		if power, ok := device.(mutablehome.PowerTrait); ok == false {
+			return gopi.ErrNotImplemented.WithPrefix("SetPower")
+		} else if err := power.SetPower(action.power); err != nil {
+			return err
+		}
+	}
+	if action.Brightness != nil {
+		if light, ok := device.(mutablehome.LightTrait); ok == false {
+			return gopi.ErrNotImplemented.WithPrefix("SetBrightness")
+		} else if err := light.SetBrightness(*action.Brightness, action.transition); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// run performs the actions for a schedule and emits an event. All
+// actions are attempted and the last error is returned
+func (this *scheduler) run(schedule *schedule, ts time.Time) error {
+	var result error
+	for _, action := range schedule.Actions {
+		if err := this.Perform(action); err != nil {
+			result = fmt.Errorf("%v: %w", strconv.Quote(schedule.Name), err)
+		} else {
+			this.Log.Info(strconv.Quote(schedule.Name)+":", action)
+		}
+	}
+	this.Emit(this.NewScheduleEvent(schedule.Name, ts))
+	return result
+}
+
+// due returns schedules which are due to run at or before now with
+// the time they were due, and sets the next time for them
+func (this *scheduler) due(now time.Time) []due {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	result := []due{}
+	for _, schedule := range this.schedules {
+		if schedule.next.IsZero() || schedule.next.After(now) {
+			continue
+		}
+		result = append(result, due{schedule, schedule.next})
+		schedule.next = schedule.when.Next(now)
+		this.Log.Debug(schedule)
+	}
+	return result
+}
+
+// wait returns the duration until the next schedule is due
+func (this *scheduler) wait(now time.Time) time.Duration {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	wait := SCHEDULE_MAX_WAIT
+	for _, schedule := range this.schedules {
+		if schedule.next.IsZero() {
+			continue
+		} else if d := schedule.next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+func (this *scheduler) schedule(name string) *schedule {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	for _, schedule := range this.schedules {
+		if schedule.Name == name {
+			return schedule
+		}
+	}
+	return nil
+}
+
+// lookup returns a device from a node, or from any node when the
+// node is not set
+func (this *scheduler) lookup(node, device string) mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if node != "" {
+		if node, exists := this.nodes[node]; exists {
+			return node.Device(device)
+		}
+		return nil
+	}
+	for _, node := range this.nodes {
+		if device := node.Device(device); device != nil {
+			return device
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package scheduler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+	scheduler "github.com/djthorpe/mutablehome/unit/scheduler"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NODE AND DEVICES
+
+type node struct {
+	base.PubSub
+	devices map[string]*device
+}
+
+func (*node) Id() string                               { return "node" }
+func (*node) Name() string                             { return "Node" }
+func (this *node) Device(id string) mutablehome.Device { return this.devices[id] }
+func (this *node) Devices() []mutablehome.Device       { return nil }
+
+type device struct {
+	sync.Mutex
+	id         string
+	power      mutablehome.TraitType
+	brightness float32
+}
+
+func (this *device) Id() string   { return this.id }
+func (this *device) Name() string { return "Device " + this.id }
+func (this *device) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_LIGHT_BRIGHTNESS}
+}
+
+func (this *device) Power() mutablehome.TraitType {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.power
+}
+
+func (this *device) SetPower(power mutablehome.TraitType) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.power = power
+	return nil
+}
+
+func (this *device) Brightness() float32 {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.brightness
+}
+
+func (this *device) SetBrightness(value float32, _ time.Duration) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.brightness = value
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SCHEDULES
+
+const (
+	SCHEDULES = `{ "schedules": [{
+		"name": "porch-on",
+		"at": "dusk-15m",
+		"actions": [{ "device": "porch", "power": "ON", "brightness": 0.6 }]
+	},{
+		"name": "porch-off",
+		"cron": "30 23 * * mon-fri",
+		"actions": [{ "device": "porch", "power": "OFF" }]
+	}]}`
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Scheduler_000(t *testing.T) {
+	t.Log("Test_Scheduler_000")
+}
+
+func Test_Scheduler_001(t *testing.T) {
+	path := WriteSchedules(t, SCHEDULES)
+	defer os.Remove(path)
+	for i, config := range []scheduler.Scheduler{
+		scheduler.Scheduler{Latitude: 91},
+		scheduler.Scheduler{Longitude: -181},
+		scheduler.Scheduler{Path: path},
+		scheduler.Scheduler{Path: path + ".missing", Latitude: 51.5, Longitude: -0.1},
+	} {
+		if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+			if _, err := gopi.New(config, app.Log()); err == nil {
+				t.Error(i, "Expected error for", config)
+			} else {
+				t.Log(i, err)
+			}
+		}, nil); err != nil {
+			t.Error(err)
+		} else if returnCode := app.Run(); returnCode != 0 {
+			t.Error("Unexpected return code", returnCode)
+		}
+	}
+}
+
+func Test_Scheduler_002(t *testing.T) {
+	path := WriteSchedules(t, SCHEDULES)
+	defer os.Remove(path)
+	config := scheduler.Scheduler{Path: path, Latitude: 51.5074, Longitude: -0.1278}
+	RunWithScheduler(t, config, func(app gopi.App, scheduler mutablehome.Scheduler, t *testing.T) {
+		if names := scheduler.Schedules(); len(names) != 2 || names[0] != "porch-on" || names[1] != "porch-off" {
+			t.Error("Unexpected schedules", names)
+		}
+		now := time.Now()
+		for _, name := range scheduler.Schedules() {
+			if next := scheduler.Next(name); next.Before(now) || next.After(now.Add(8*24*time.Hour)) {
+				t.Error("Unexpected next time", name, next)
+			} else {
+				t.Log(name, next)
+			}
+		}
+		if next := scheduler.Next("missing"); next.IsZero() == false {
+			t.Error("Unexpected next time", next)
+		}
+		t.Log(scheduler)
+	})
+}
+
+func Test_Scheduler_003(t *testing.T) {
+	path := WriteSchedules(t, SCHEDULES)
+	defer os.Remove(path)
+	porch := &device{id: "porch", power: mutablehome.TRAIT_POWER_OFF}
+	config := scheduler.Scheduler{Path: path, Latitude: 51.5074, Longitude: -0.1278}
+	RunWithScheduler(t, config, func(app gopi.App, scheduler mutablehome.Scheduler, t *testing.T) {
+		// Actions fail when there is no device
+		if err := scheduler.Run("porch-on"); err == nil {
+			t.Error("Expected error running schedule without device")
+		} else if err := scheduler.Run("missing"); err == nil {
+			t.Error("Expected error running missing schedule")
+		} else if err := scheduler.AddNode(&node{devices: map[string]*device{"porch": porch}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Running a schedule performs actions and emits an event
+		evts := scheduler.Subscribe()
+		errs := make(chan error)
+		go func() {
+			errs <- scheduler.Run("porch-on")
+		}()
+		select {
+		case value := <-evts:
+			if evt, ok := value.(mutablehome.ScheduleEvent); ok == false {
+				t.Error("Unexpected event", value)
+			} else if evt.Schedule() != "porch-on" {
+				t.Error("Unexpected schedule", evt.Schedule())
+			} else if evt.Time().IsZero() {
+				t.Error("Unexpected time", evt.Time())
+			}
+		case <-time.After(time.Second):
+			t.Error("Timeout waiting for event")
+		}
+		if err := <-errs; err != nil {
+			t.Error(err)
+		} else if porch.Power() != mutablehome.TRAIT_POWER_ON || porch.Brightness() != 0.6 {
+			t.Error("Unexpected state", porch.Power(), porch.Brightness())
+		}
+		scheduler.Unsubscribe(evts)
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func RunWithScheduler(t *testing.T, config scheduler.Scheduler, main func(gopi.App, mutablehome.Scheduler, *testing.T)) {
+	t.Helper()
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(config, app.Log().Clone(config.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(app, unit.(mutablehome.Scheduler), t)
+	}, nil); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+// WriteSchedules writes schedules to a temporary file and returns the path
+func WriteSchedules(t *testing.T, data string) string {
+	t.Helper()
+	fh, err := ioutil.TempFile("", "schedules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	if _, err := fh.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	return fh.Name()
+}
@@ -0,0 +1,154 @@
+/*
+	Mutablehome Automation: Scheduler
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// solarEvent is sunrise, sunset, civil dawn or civil dusk
+type solarEvent uint
+
+// location is a latitude and longitude in degrees, where north and
+// east are positive
+type location struct {
+	lat, lng float64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	SOLAR_NONE solarEvent = iota
+	SOLAR_SUNRISE
+	SOLAR_SUNSET
+	SOLAR_DAWN
+	SOLAR_DUSK
+)
+
+const (
+	// Zenith in degrees for sunrise and sunset, allowing for
+	// refraction, and for civil twilight
+	ZENITH_OFFICIAL = 90.833
+	ZENITH_CIVIL    = 96.0
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Time returns the time of a solar event on the date of t in the
+// location of t, calculated locally using the sunrise equation from
+// the Almanac for Computers, which is accurate to within a couple of
+// minutes. Returns false when the event does not occur on the date,
+// for example during polar day or night
+func (this location) Time(t time.Time, event solarEvent) (time.Time, bool) {
+	var zenith float64
+	var rising bool
+	switch event {
+	case SOLAR_SUNRISE:
+		zenith, rising = ZENITH_OFFICIAL, true
+	case SOLAR_SUNSET:
+		zenith, rising = ZENITH_OFFICIAL, false
+	case SOLAR_DAWN:
+		zenith, rising = ZENITH_CIVIL, true
+	case SOLAR_DUSK:
+		zenith, rising = ZENITH_CIVIL, false
+	default:
+		return time.Time{}, false
+	}
+
+	// Approximate time of the event as day of year
+	lngHour := this.lng / 15
+	day := float64(t.YearDay())
+	if rising {
+		day += (6 - lngHour) / 24
+	} else {
+		day += (18 - lngHour) / 24
+	}
+
+	// Sun's mean anomaly and true longitude
+	m := 0.9856*day - 3.289
+	l := normalize(m+1.916*sin(m)+0.020*sin(2*m)+282.634, 360)
+
+	// Sun's right ascension in hours, in the same quadrant as l
+	ra := normalize(atan(0.91764*tan(l)), 360)
+	ra += math.Floor(l/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	// Sun's declination and local hour angle
+	sinDec := 0.39782 * sin(l)
+	cosDec := math.Cos(math.Asin(sinDec))
+	cosH := (cos(zenith) - sinDec*sin(this.lat)) / (cosDec * cos(this.lat))
+	if cosH > 1 || cosH < -1 {
+		return time.Time{}, false
+	}
+	h := acos(cosH)
+	if rising {
+		h = 360 - h
+	}
+	h /= 15
+
+	// Local mean time and UTC in hours
+	ut := normalize(h+ra-0.06571*day-6.622-lngHour, 24)
+
+	// Return the time on the same date in the location of t, which
+	// may be a day before or after the date in UTC
+	year, month, date := t.Date()
+	local := time.Date(year, month, date, 0, 0, 0, 0, time.UTC).Add(time.Duration(ut * float64(time.Hour))).In(t.Location())
+	if y, m, d := local.Date(); y != year || m != month || d != date {
+		local = local.Add(time.Date(year, month, date, 0, 0, 0, 0, time.UTC).Sub(time.Date(y, m, d, 0, 0, 0, 0, time.UTC)))
+	}
+	return local.Truncate(time.Second), true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this location) String() string {
+	return fmt.Sprintf("<location lat=%.4f lng=%.4f>", this.lat, this.lng)
+}
+
+func (e solarEvent) String() string {
+	switch e {
+	case SOLAR_NONE:
+		return "SOLAR_NONE"
+	case SOLAR_SUNRISE:
+		return "SOLAR_SUNRISE"
+	case SOLAR_SUNSET:
+		return "SOLAR_SUNSET"
+	case SOLAR_DAWN:
+		return "SOLAR_DAWN"
+	case SOLAR_DUSK:
+		return "SOLAR_DUSK"
+	default:
+		return "[?? Invalid solarEvent value]"
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func normalize(value, max float64) float64 {
+	value = math.Mod(value, max)
+	if value < 0 {
+		value += max
+	}
+	return value
+}
+
+// Trigonometric functions in degrees
+func sin(deg float64) float64 { return math.Sin(deg * math.Pi / 180) }
+func cos(deg float64) float64 { return math.Cos(deg * math.Pi / 180) }
+func tan(deg float64) float64 { return math.Tan(deg * math.Pi / 180) }
+func atan(x float64) float64  { return math.Atan(x) * 180 / math.Pi }
+func acos(x float64) float64  { return math.Acos(x) * 180 / math.Pi }
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_When_000(t *testing.T) {
+	t.Log("Test_When_000")
+}
+
+func Test_When_001(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * xxx *", "@never"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Error("Expected error for", spec)
+		}
+	}
+}
+
+func Test_When_002(t *testing.T) {
+	// Wednesday 15 January 2020 10:17
+	now := time.Date(2020, 1, 15, 10, 17, 30, 0, time.UTC)
+	for _, test := range []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2020, 1, 15, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 7 * * *", time.Date(2020, 1, 16, 7, 0, 0, 0, time.UTC)},
+		{"30 23 * * mon-fri", time.Date(2020, 1, 15, 23, 30, 0, 0, time.UTC)},
+		{"0 9 * * sat,sun", time.Date(2020, 1, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2020, 1, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * fri", time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{"5-10/5 8 * jun *", time.Date(2020, 6, 1, 8, 5, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 feb *", time.Time{}},
+	} {
+		if cron, err := parseCron(test.spec); err != nil {
+			t.Error(test.spec, err)
+		} else if next := cron.Next(now); next.Equal(test.next) == false {
+			t.Error(test.spec, "Expected", test.next, "got", next)
+		}
+	}
+}
+
+func Test_When_003(t *testing.T) {
+	london := location{51.5074, -0.1278}
+	sydney := location{-33.8688, 151.2093}
+	newyork := location{40.7128, -74.0060}
+	bst := time.FixedZone("BST", 60*60)
+	aedt := time.FixedZone("AEDT", 11*60*60)
+	edt := time.FixedZone("EDT", -4*60*60)
+	for _, test := range []struct {
+		location location
+		event    solarEvent
+		expected time.Time
+	}{
+		{london, SOLAR_SUNRISE, time.Date(2020, 6, 21, 4, 43, 0, 0, bst)},
+		{london, SOLAR_SUNSET, time.Date(2020, 6, 21, 21, 21, 0, 0, bst)},
+		{london, SOLAR_DAWN, time.Date(2020, 6, 21, 3, 57, 0, 0, bst)},
+		{london, SOLAR_DUSK, time.Date(2020, 6, 21, 22, 8, 0, 0, bst)},
+		{sydney, SOLAR_SUNRISE, time.Date(2020, 12, 21, 5, 41, 0, 0, aedt)},
+		{sydney, SOLAR_SUNSET, time.Date(2020, 12, 21, 20, 5, 0, 0, aedt)},
+		{newyork, SOLAR_SUNRISE, time.Date(2020, 3, 20, 7, 0, 0, 0, edt)},
+		{newyork, SOLAR_SUNSET, time.Date(2020, 3, 20, 19, 9, 0, 0, edt)},
+	} {
+		date := time.Date(test.expected.Year(), test.expected.Month(), test.expected.Day(), 12, 0, 0, 0, test.expected.Location())
+		if value, ok := test.location.Time(date, test.event); ok == false {
+			t.Error(test.location, test.event, "Expected a time")
+		} else if diff := value.Sub(test.expected); diff < -3*time.Minute || diff > 3*time.Minute {
+			t.Error(test.location, test.event, "Expected", test.expected, "got", value)
+		} else {
+			t.Log(test.location, test.event, value)
+		}
+	}
+
+	// Polar day
+	tromso := location{69.6492, 18.9553}
+	if value, ok := tromso.Time(time.Date(2020, 6, 21, 12, 0, 0, 0, time.UTC), SOLAR_SUNSET); ok {
+		t.Error("Unexpected sunset", value)
+	}
+}
+
+func Test_When_004(t *testing.T) {
+	london := &location{51.5074, -0.1278}
+	bst := time.FixedZone("BST", 60*60)
+	now := time.Date(2020, 6, 21, 12, 0, 0, 0, bst)
+	for _, test := range []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"07:30", time.Date(2020, 6, 22, 7, 30, 0, 0, bst)},
+		{"23:15", time.Date(2020, 6, 21, 23, 15, 0, 0, bst)},
+		{"12:00-1m", time.Date(2020, 6, 22, 11, 59, 0, 0, bst)},
+		{"sunset", time.Date(2020, 6, 21, 21, 21, 0, 0, bst)},
+		{"Sunset-30m", time.Date(2020, 6, 21, 20, 51, 0, 0, bst)},
+		{"sunrise+1h", time.Date(2020, 6, 22, 5, 43, 0, 0, bst)},
+		{"dusk+3h", time.Date(2020, 6, 22, 1, 8, 0, 0, bst)},
+	} {
+		if at, err := parseAt(test.spec, london); err != nil {
+			t.Error(test.spec, err)
+		} else if next := at.Next(now); next.Sub(test.expected) < -3*time.Minute || next.Sub(test.expected) > 3*time.Minute {
+			t.Error(test.spec, "Expected", test.expected, "got", next)
+		}
+	}
+	for _, spec := range []string{"", "25:00", "noon", "sunset+", "sunset+1x"} {
+		if _, err := parseAt(spec, london); err == nil {
+			t.Error("Expected error for", spec)
+		}
+	}
+	if _, err := parseAt("sunset", nil); err == nil {
+		t.Error("Expected error for sunset without location")
+	}
+}
@@ -0,0 +1,233 @@
+/*
+	Mutablehome Automation: State Store
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// device is the recorded state of a device, with a series of values
+// for each trait
+type device struct {
+	id      string
+	name    string
+	traits  []mutablehome.TraitType
+	updated time.Time
+	series  map[mutablehome.TraitType][]*value
+}
+
+// value is a value recorded for a trait
+type value struct {
+	ts    time.Time
+	trait mutablehome.TraitType
+	value float32
+}
+
+// state is a copy of the latest state for a device, which is
+// returned from the store
+type state struct {
+	id, name                      string
+	traits                        []mutablehome.TraitType
+	updated                       time.Time
+	power                         mutablehome.TraitType
+	brightness, position, battery float32
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func NewDevice(id string) *device {
+	return &device{id: id, series: make(map[mutablehome.TraitType][]*value)}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// DEVICE METHODS
+
+// SetMetadata sets name and traits, and returns true if they changed
+func (this *device) SetMetadata(name string, traits []mutablehome.TraitType, ts time.Time) bool {
+	this.updated = ts
+	if name == this.name && equalTraits(traits, this.traits) {
+		return false
+	}
+	this.name = name
+	this.traits = append([]mutablehome.TraitType{}, traits...)
+	return true
+}
+
+// Append adds a value to the series for a trait, and then removes
+// values which are older than the retention or beyond the size of
+// the series, always keeping the last value
+func (this *device) Append(v *value, size uint, retention time.Duration) {
+	key := seriesKey(v.trait)
+	series := append(this.series[key], v)
+	if v.ts.After(this.updated) {
+		this.updated = v.ts
+	}
+
+	// Remove values
+	drop := 0
+	if size > 0 && uint(len(series)) > size {
+		drop = len(series) - int(size)
+	}
+	if retention > 0 {
+		cutoff := v.ts.Add(-retention)
+		for drop < len(series)-1 && series[drop].ts.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop > 0 {
+		series = append([]*value{}, series[drop:]...)
+	}
+	this.series[key] = series
+}
+
+// Last returns the last value for a trait, or nil
+func (this *device) Last(trait mutablehome.TraitType) *value {
+	if series := this.series[seriesKey(trait)]; len(series) == 0 {
+		return nil
+	} else {
+		return series[len(series)-1]
+	}
+}
+
+// Between returns values for a trait between two times, where
+// a zero time is unbounded
+func (this *device) Between(trait mutablehome.TraitType, from, to time.Time) []*value {
+	series := this.series[seriesKey(trait)]
+	i := 0
+	if from.IsZero() == false {
+		i = sort.Search(len(series), func(i int) bool { return series[i].ts.Before(from) == false })
+	}
+	j := len(series)
+	if to.IsZero() == false {
+		j = sort.Search(len(series), func(i int) bool { return series[i].ts.After(to) })
+	}
+	if i >= j {
+		return nil
+	}
+	return append([]*value{}, series[i:j]...)
+}
+
+// Count returns the number of values for all traits
+func (this *device) Count() int {
+	count := 0
+	for _, series := range this.series {
+		count += len(series)
+	}
+	return count
+}
+
+// Values returns all values in time order
+func (this *device) Values() []*value {
+	values := make([]*value, 0, this.Count())
+	for _, series := range this.series {
+		values = append(values, series...)
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].ts.Before(values[j].ts)
+	})
+	return values
+}
+
+// State returns a copy of the latest state for the device
+func (this *device) State() *state {
+	state := &state{
+		id:      this.id,
+		name:    this.name,
+		traits:  append([]mutablehome.TraitType{}, this.traits...),
+		updated: this.updated,
+	}
+	if v := this.Last(mutablehome.TRAIT_POWER_ON); v != nil {
+		state.power = v.trait
+	}
+	if v := this.Last(mutablehome.TRAIT_LIGHT_BRIGHTNESS); v != nil {
+		state.brightness = v.value
+	}
+	if v := this.Last(mutablehome.TRAIT_COVER_POSITION); v != nil {
+		state.position = v.value
+	}
+	if v := this.Last(mutablehome.TRAIT_BATTERY_LEVEL); v != nil {
+		state.battery = v.value
+	}
+	return state
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.StoreDevice
+
+func (this *state) Id() string                      { return this.id }
+func (this *state) Name() string                    { return this.name }
+func (this *state) Traits() []mutablehome.TraitType { return this.traits }
+func (this *state) Updated() time.Time              { return this.updated }
+func (this *state) Power() mutablehome.TraitType    { return this.power }
+func (this *state) Brightness() float32             { return this.brightness }
+func (this *state) Position() float32               { return this.position }
+func (this *state) BatteryLevel() float32           { return this.battery }
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.StoreValue
+
+func (this *value) Time() time.Time              { return this.ts }
+func (this *value) Trait() mutablehome.TraitType { return this.trait }
+func (this *value) Value() float32               { return this.value }
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *state) String() string {
+	str := "<mutablehome.StoreDevice id=" + strconv.Quote(this.id)
+	str += " name=" + strconv.Quote(this.name)
+	str += " traits=" + fmt.Sprint(this.traits)
+	if this.power != mutablehome.TRAIT_NONE {
+		str += " power=" + fmt.Sprint(this.power)
+	}
+	str += " updated=" + this.updated.Format(time.RFC3339)
+	return str + ">"
+}
+
+func (this *value) String() string {
+	str := "<mutablehome.StoreValue trait=" + fmt.Sprint(this.trait)
+	str += " value=" + fmt.Sprint(this.value)
+	str += " ts=" + this.ts.Format(time.RFC3339)
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// seriesKey returns the key for a series, where all power traits
+// are recorded as a single series
+func seriesKey(trait mutablehome.TraitType) mutablehome.TraitType {
+	switch trait {
+	case mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_POWER_STANDBY, mutablehome.TRAIT_POWER_TOGGLE:
+		return mutablehome.TRAIT_POWER_ON
+	default:
+		return trait
+	}
+}
+
+func equalTraits(a, b []mutablehome.TraitType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
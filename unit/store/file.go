@@ -0,0 +1,140 @@
+/*
+	Mutablehome Automation: State Store
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// record is a line in the file, which is either device metadata
+// or a value for a trait
+type record struct {
+	Type   string                  `json:"type"`
+	Time   time.Time               `json:"ts"`
+	Device string                  `json:"device"`
+	Name   string                  `json:"name,omitempty"`
+	Traits []mutablehome.TraitType `json:"traits,omitempty"`
+	Trait  mutablehome.TraitType   `json:"trait,omitempty"`
+	Value  float32                 `json:"value,omitempty"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	RECORD_DEVICE = "device"
+	RECORD_VALUE  = "value"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func NewDeviceRecord(device *device) *record {
+	return &record{
+		Type:   RECORD_DEVICE,
+		Time:   device.updated,
+		Device: device.id,
+		Name:   device.name,
+		Traits: device.traits,
+	}
+}
+
+func NewValueRecord(device *device, v *value) *record {
+	return &record{
+		Type:   RECORD_VALUE,
+		Time:   v.ts,
+		Device: device.id,
+		Trait:  v.trait,
+		Value:  v.value,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// READ AND WRITE
+
+// readRecords calls a function for each record in a file until the end
+// of the file. A line which cannot be decoded, for example when the
+// last write was interrupted, ends reading and the error is returned
+// with the records which were read
+func readRecords(path string, fn func(*record)) (int, error) {
+	fh, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+
+	count := 0
+	dec := json.NewDecoder(bufio.NewReader(fh))
+	for {
+		var r record
+		if err := dec.Decode(&r); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		} else {
+			fn(&r)
+			count++
+		}
+	}
+}
+
+// writeRecords writes records to a temporary file and then replaces
+// the file, so that the file is not left incomplete
+func writeRecords(path string, records []*record) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	fh, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fh)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			fh.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fh.Close()
+		os.Remove(tmp)
+		return err
+	} else if err := fh.Sync(); err != nil {
+		fh.Close()
+		os.Remove(tmp)
+		return err
+	} else if err := fh.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// appendRecord appends a record to an open file
+func appendRecord(fh *os.File, r *record) error {
+	if data, err := json.Marshal(r); err != nil {
+		return err
+	} else if _, err := fh.Write(append(data, '\n')); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
@@ -0,0 +1,35 @@
+/*
+	Mutablehome Automation: State Store
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package store
+
+import (
+	// Frameworks
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	// State store
+	gopi.UnitRegister(gopi.UnitConfig{
+		Name: Store{}.Name(),
+		Config: func(app gopi.App) error {
+			app.Flags().FlagString("store.path", "", "State file")
+			app.Flags().FlagUint("store.size", DEFAULT_SIZE, "Maximum number of values kept for each trait")
+			app.Flags().FlagDuration("store.retention", DEFAULT_RETENTION, "Maximum age of values kept for each trait")
+			return nil
+		},
+		New: func(app gopi.App) (gopi.Unit, error) {
+			return gopi.New(Store{
+				Path:      app.Flags().GetString("store.path", gopi.FLAG_NS_DEFAULT),
+				Size:      app.Flags().GetUint("store.size", gopi.FLAG_NS_DEFAULT),
+				Retention: app.Flags().GetDuration("store.retention", gopi.FLAG_NS_DEFAULT),
+			}, app.Log().Clone(Store{}.Name()))
+		},
+	})
+}
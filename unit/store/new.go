@@ -0,0 +1,47 @@
+/*
+	Mutablehome Automation: State Store
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+// Package store records the latest metadata and trait values for
+// devices as nodes emit events, and a bounded history of values for
+// each trait. Records are appended to a file as lines of JSON, which
+// is compacted when it has grown to twice the size of the state it
+// contains. The last value for each trait is always kept, so the
+// latest known state is restored when the store is created. When no
+// path is set, state is only kept in memory.
+package store
+
+import (
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Store struct {
+	Path      string        // Path to the file, or empty for memory only
+	Size      uint          // Maximum number of values for each trait
+	Retention time.Duration // Maximum age of values for each trait
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (Store) Name() string { return "mutablehome/store" }
+
+func (config Store) New(log gopi.Logger) (gopi.Unit, error) {
+	this := new(store)
+	if err := this.Unit.Init(log); err != nil {
+		return nil, err
+	}
+	if err := this.Init(config); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
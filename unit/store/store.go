@@ -0,0 +1,380 @@
+/*
+	Mutablehome Automation: State Store
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package store
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type store struct {
+	base.Unit
+	sync.Mutex
+	sync.WaitGroup
+
+	path      string
+	size      uint
+	retention time.Duration
+	fh        *os.File
+	lines     int
+	devices   map[string]*device
+	nodes     map[string]bool
+	stop      chan struct{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	DEFAULT_SIZE      = 1000
+	DEFAULT_RETENTION = 7 * 24 * time.Hour
+
+	// Minimum number of lines before the file is compacted
+	COMPACT_MIN_LINES = 1000
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (this *store) Init(config Store) error {
+	this.path = config.Path
+	this.size = config.Size
+	this.retention = config.Retention
+	this.devices = make(map[string]*device)
+	this.nodes = make(map[string]bool)
+	this.stop = make(chan struct{})
+
+	// Read state from the file, compact and open for appending
+	if this.path != "" {
+		if err := this.Load(); err != nil {
+			return err
+		} else if err := this.Compact(); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+func (this *store) Close() error {
+	// Stop event processes and wait for them to end
+	close(this.stop)
+	this.WaitGroup.Wait()
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Close file
+	if this.fh != nil {
+		if err := this.fh.Close(); err != nil {
+			return err
+		}
+	}
+
+	// Release resources
+	this.fh = nil
+	this.devices = nil
+	this.nodes = nil
+	this.stop = nil
+
+	// Success
+	return this.Unit.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *store) String() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	str := "<" + this.Log.Name()
+	if this.path != "" {
+		str += " path=" + strconv.Quote(this.path)
+	}
+	if this.size > 0 {
+		str += " size=" + fmt.Sprint(this.size)
+	}
+	if this.retention > 0 {
+		str += " retention=" + fmt.Sprint(this.retention)
+	}
+	str += " devices=" + fmt.Sprint(len(this.devices))
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.Store
+
+func (this *store) AddNode(node mutablehome.Node) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if node == nil {
+		return gopi.ErrBadParameter.WithPrefix("node")
+	} else if _, exists := this.nodes[node.Id()]; exists {
+		return gopi.ErrDuplicateItem.WithPrefix(strconv.Quote(node.Id()))
+	} else {
+		this.nodes[node.Id()] = true
+	}
+
+	// Record state on node events
+	this.WaitGroup.Add(1)
+	go this.EventProcess(node, node.Subscribe(), this.stop)
+
+	// Success
+	return nil
+}
+
+func (this *store) Devices() []mutablehome.StoreDevice {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	devices := make([]mutablehome.StoreDevice, 0, len(this.devices))
+	for _, device := range this.devices {
+		devices = append(devices, device.State())
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Id() < devices[j].Id()
+	})
+	return devices
+}
+
+func (this *store) Device(id string) mutablehome.StoreDevice {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device, exists := this.devices[id]; exists == false {
+		return nil
+	} else {
+		return device.State()
+	}
+}
+
+func (this *store) Last(id string, trait mutablehome.TraitType) mutablehome.StoreValue {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device, exists := this.devices[id]; exists == false {
+		return nil
+	} else if value := device.Last(trait); value == nil {
+		return nil
+	} else {
+		return value
+	}
+}
+
+func (this *store) Between(id string, trait mutablehome.TraitType, from, to time.Time) []mutablehome.StoreValue {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device, exists := this.devices[id]; exists == false {
+		return nil
+	} else {
+		values := device.Between(trait, from, to)
+		result := make([]mutablehome.StoreValue, len(values))
+		for i, value := range values {
+			result[i] = value
+		}
+		return result
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EVENTS
+
+// EventProcess records state from node events until the store is
+// closed or the node stops emitting events
+func (this *store) EventProcess(node mutablehome.Node, evts <-chan interface{}, stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+	mutablehome.ProcessEvents(node, evts, stop, func(evt mutablehome.Event) {
+		if err := this.ProcessEvent(evt, time.Now()); err != nil {
+			this.Log.Error(err)
+		}
+	})
+}
+
+// ProcessEvent records device metadata and trait values which have
+// changed for device events
+func (this *store) ProcessEvent(evt mutablehome.Event, ts time.Time) error {
+	switch evt.Type() {
+	case mutablehome.EVENT_DEVICE_ADDED, mutablehome.EVENT_DEVICE_METADATA_CHANGED, mutablehome.EVENT_DEVICE_TRAIT_CHANGED:
+		if device := evt.Device(); device != nil {
+			return this.Update(device, evt.Traits(), ts)
+		}
+	}
+	return nil
+}
+
+// Update records metadata and trait values for a device when they
+// have changed. Activity is recorded when it is in the changed traits
+func (this *store) Update(d mutablehome.Device, changed []mutablehome.TraitType, ts time.Time) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	records := []*record{}
+	device, exists := this.devices[d.Id()]
+	if exists == false {
+		device = NewDevice(d.Id())
+		this.devices[d.Id()] = device
+	}
+	if device.SetMetadata(d.Name(), d.Traits(), ts) {
+		records = append(records, NewDeviceRecord(device))
+	}
+	for _, v := range values(d, changed, ts) {
+		if last := device.Last(v.trait); last != nil && last.trait == v.trait && last.value == v.value && v.trait != mutablehome.TRAIT_SENSOR_ACTIVITY {
+			continue
+		}
+		device.Append(v, this.size, this.retention)
+		records = append(records, NewValueRecord(device, v))
+	}
+
+	// Write records
+	return this.write(records)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// FILE
+
+// Load reads state from the file. When the end of the file cannot be
+// read, the state which was read is kept
+func (this *store) Load() error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	count, err := readRecords(this.path, func(r *record) {
+		device, exists := this.devices[r.Device]
+		if exists == false {
+			device = NewDevice(r.Device)
+			this.devices[r.Device] = device
+		}
+		switch r.Type {
+		case RECORD_DEVICE:
+			device.SetMetadata(r.Name, r.Traits, r.Time)
+		case RECORD_VALUE:
+			device.Append(&value{r.Time, r.Trait, r.Value}, this.size, this.retention)
+		}
+	})
+	if err != nil {
+		this.Log.Warn(strconv.Quote(this.path)+": Ignoring records after line", count+1, ":", err)
+	}
+	this.Log.Debug("Loaded", count, "records for", len(this.devices), "devices")
+
+	// Success
+	return nil
+}
+
+// Compact rewrites the file with the current state and opens it
+// for appending
+func (this *store) Compact() error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.compact()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *store) compact() error {
+	if this.fh != nil {
+		if err := this.fh.Close(); err != nil {
+			return err
+		}
+		this.fh = nil
+	}
+
+	// Write metadata and values for each device
+	records := []*record{}
+	for _, device := range this.devices {
+		records = append(records, NewDeviceRecord(device))
+		for _, v := range device.Values() {
+			records = append(records, NewValueRecord(device, v))
+		}
+	}
+	if err := writeRecords(this.path, records); err != nil {
+		return err
+	}
+
+	// Open the file for appending
+	if fh, err := os.OpenFile(this.path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	} else {
+		this.fh = fh
+		this.lines = len(records)
+	}
+
+	// Success
+	return nil
+}
+
+// write appends records to the file, and compacts the file when it
+// has grown to twice the number of records for the current state
+func (this *store) write(records []*record) error {
+	if this.fh == nil || len(records) == 0 {
+		return nil
+	}
+	for _, r := range records {
+		if err := appendRecord(this.fh, r); err != nil {
+			return err
+		}
+		this.lines++
+	}
+	if this.lines > COMPACT_MIN_LINES && this.lines > 2*this.count() {
+		return this.compact()
+	}
+	return nil
+}
+
+// count returns the number of records for the current state
+func (this *store) count() int {
+	count := 0
+	for _, device := range this.devices {
+		count += 1 + device.Count()
+	}
+	return count
+}
+
+// values returns the current trait values for a device
+func values(d mutablehome.Device, changed []mutablehome.TraitType, ts time.Time) []*value {
+	values := []*value{}
+	traits := d.Traits()
+	if power, ok := d.(mutablehome.PowerTrait); ok {
+		if p := power.Power(); p != mutablehome.TRAIT_NONE {
+			v := float32(0)
+			if p == mutablehome.TRAIT_POWER_ON {
+				v = 1
+			}
+			values = append(values, &value{ts, p, v})
+		}
+	}
+	if light, ok := d.(mutablehome.LightTrait); ok && mutablehome.HasTrait(traits, mutablehome.TRAIT_LIGHT_BRIGHTNESS) {
+		values = append(values, &value{ts, mutablehome.TRAIT_LIGHT_BRIGHTNESS, light.Brightness()})
+	}
+	if cover, ok := d.(mutablehome.CoverTrait); ok && mutablehome.HasTrait(traits, mutablehome.TRAIT_COVER_POSITION) {
+		values = append(values, &value{ts, mutablehome.TRAIT_COVER_POSITION, cover.Position()})
+	}
+	if battery, ok := d.(mutablehome.BatteryTrait); ok && mutablehome.HasTrait(traits, mutablehome.TRAIT_BATTERY_LEVEL) {
+		values = append(values, &value{ts, mutablehome.TRAIT_BATTERY_LEVEL, battery.BatteryLevel()})
+	}
+	if mutablehome.HasTrait(changed, mutablehome.TRAIT_SENSOR_ACTIVITY) {
+		values = append(values, &value{ts, mutablehome.TRAIT_SENSOR_ACTIVITY, 1})
+	}
+	return values
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	app "github.com/djthorpe/gopi/v2/app"
+	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NODE, DEVICES AND EVENTS
+
+type node struct {
+	base.PubSub
+}
+
+func (*node) Id() string                       { return "node" }
+func (*node) Name() string                     { return "Node" }
+func (*node) Device(string) mutablehome.Device { return nil }
+func (*node) Devices() []mutablehome.Device    { return nil }
+
+type light struct {
+	id         string
+	name       string
+	power      mutablehome.TraitType
+	brightness float32
+}
+
+func (this *light) Id() string                                 { return this.id }
+func (this *light) Name() string                               { return this.name }
+func (this *light) Power() mutablehome.TraitType               { return this.power }
+func (this *light) SetPower(mutablehome.TraitType) error       { return gopi.ErrNotImplemented }
+func (this *light) Brightness() float32                        { return this.brightness }
+func (this *light) SetBrightness(float32, time.Duration) error { return gopi.ErrNotImplemented }
+func (this *light) Traits() []mutablehome.TraitType {
+	return []mutablehome.TraitType{mutablehome.TRAIT_POWER_ON, mutablehome.TRAIT_POWER_OFF, mutablehome.TRAIT_LIGHT_BRIGHTNESS}
+}
+
+type event struct {
+	t      mutablehome.EventType
+	device mutablehome.Device
+	traits []mutablehome.TraitType
+}
+
+func (*event) Name() string                         { return "mutablehome.Event" }
+func (*event) NS() gopi.EventNS                     { return gopi.EVENT_NS_DEFAULT }
+func (*event) Source() gopi.Unit                    { return nil }
+func (this *event) Value() interface{}              { return this.device }
+func (this *event) Type() mutablehome.EventType     { return this.t }
+func (*event) Node() mutablehome.Node               { return nil }
+func (this *event) Device() mutablehome.Device      { return this.device }
+func (this *event) Traits() []mutablehome.TraitType { return this.traits }
+
+////////////////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Store_000(t *testing.T) {
+	t.Log("Test_Store_000")
+}
+
+func Test_Store_001(t *testing.T) {
+	// Values are recorded when they change, and queried between times
+	RunWithStore(t, Store{}, func(store *store, t *testing.T) {
+		ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		lamp := &light{id: "lamp", name: "Lamp", power: mutablehome.TRAIT_POWER_OFF}
+		for i := 0; i < 10; i++ {
+			lamp.brightness = float32(i) / 10
+			if err := store.Update(lamp, nil, ts.Add(time.Duration(i)*time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if device := store.Device("lamp"); device == nil {
+			t.Fatal("Expected device")
+		} else if device.Name() != "Lamp" || device.Power() != mutablehome.TRAIT_POWER_OFF || device.Brightness() != 0.9 {
+			t.Error("Unexpected device", device)
+		} else if device.Updated().Equal(ts.Add(9*time.Minute)) == false {
+			t.Error("Unexpected updated", device.Updated())
+		}
+		if values := store.Between("lamp", mutablehome.TRAIT_POWER_STANDBY, time.Time{}, time.Time{}); len(values) != 1 {
+			t.Error("Unexpected power values", values)
+		} else if values[0].Trait() != mutablehome.TRAIT_POWER_OFF || values[0].Value() != 0 {
+			t.Error("Unexpected power value", values[0])
+		}
+		if values := store.Between("lamp", mutablehome.TRAIT_LIGHT_BRIGHTNESS, ts.Add(2*time.Minute), ts.Add(4*time.Minute)); len(values) != 3 {
+			t.Error("Unexpected brightness values", values)
+		} else if values[0].Value() != 0.2 || values[2].Value() != 0.4 {
+			t.Error("Unexpected brightness values", values)
+		}
+		if value := store.Last("lamp", mutablehome.TRAIT_LIGHT_BRIGHTNESS); value == nil || value.Value() != 0.9 {
+			t.Error("Unexpected last value", value)
+		}
+		if value := store.Last("lamp", mutablehome.TRAIT_BATTERY_LEVEL); value != nil {
+			t.Error("Unexpected last value", value)
+		} else if value := store.Last("missing", mutablehome.TRAIT_LIGHT_BRIGHTNESS); value != nil {
+			t.Error("Unexpected last value", value)
+		}
+	})
+}
+
+func Test_Store_002(t *testing.T) {
+	// History is bounded by size and retention, keeping the last value
+	RunWithStore(t, Store{Size: 5, Retention: time.Hour}, func(store *store, t *testing.T) {
+		ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		lamp := &light{id: "lamp", power: mutablehome.TRAIT_POWER_ON}
+		for i := 0; i < 10; i++ {
+			lamp.brightness = float32(i) / 10
+			store.Update(lamp, nil, ts.Add(time.Duration(i)*time.Minute))
+		}
+		if values := store.Between("lamp", mutablehome.TRAIT_LIGHT_BRIGHTNESS, time.Time{}, time.Time{}); len(values) != 5 {
+			t.Error("Unexpected values", values)
+		}
+		lamp.brightness = 1
+		store.Update(lamp, nil, ts.Add(2*time.Hour))
+		if values := store.Between("lamp", mutablehome.TRAIT_LIGHT_BRIGHTNESS, time.Time{}, time.Time{}); len(values) != 1 || values[0].Value() != 1 {
+			t.Error("Unexpected values", values)
+		}
+		if values := store.Between("lamp", mutablehome.TRAIT_POWER_ON, time.Time{}, time.Time{}); len(values) != 1 {
+			t.Error("Unexpected power values", values)
+		}
+	})
+}
+
+func Test_Store_003(t *testing.T) {
+	// State is restored from the file
+	tmp, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "state.json")
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	RunWithStore(t, Store{Path: path}, func(store *store, t *testing.T) {
+		lamp := &light{id: "lamp", name: "Lamp", power: mutablehome.TRAIT_POWER_ON, brightness: 0.5}
+		store.Update(lamp, nil, ts)
+		lamp.power = mutablehome.TRAIT_POWER_OFF
+		store.Update(lamp, nil, ts.Add(time.Minute))
+	})
+
+	// Append a partial record
+	if fh, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		t.Fatal(err)
+	} else {
+		fh.WriteString(`{"type":"value","ts":`)
+		fh.Close()
+	}
+
+	RunWithStore(t, Store{Path: path}, func(store *store, t *testing.T) {
+		if device := store.Device("lamp"); device == nil {
+			t.Fatal("Expected device")
+		} else if device.Name() != "Lamp" || device.Power() != mutablehome.TRAIT_POWER_OFF || device.Brightness() != 0.5 {
+			t.Error("Unexpected device", device)
+		}
+		if values := store.Between("lamp", mutablehome.TRAIT_POWER_ON, ts, ts.Add(time.Minute)); len(values) != 2 {
+			t.Error("Unexpected values", values)
+		} else if values[0].Trait() != mutablehome.TRAIT_POWER_ON || values[1].Trait() != mutablehome.TRAIT_POWER_OFF {
+			t.Error("Unexpected values", values)
+		}
+	})
+}
+
+func Test_Store_004(t *testing.T) {
+	// Events from a node are recorded
+	RunWithStore(t, Store{}, func(store *store, t *testing.T) {
+		node := &node{}
+		if err := store.AddNode(node); err != nil {
+			t.Fatal(err)
+		} else if err := store.AddNode(node); err == nil {
+			t.Error("Expected error adding node twice")
+		}
+		sensor := &light{id: "sensor"}
+		node.Emit(&event{mutablehome.EVENT_DEVICE_TRAIT_CHANGED, sensor, []mutablehome.TraitType{mutablehome.TRAIT_SENSOR_ACTIVITY}})
+		node.Emit(&event{mutablehome.EVENT_DEVICE_TRAIT_CHANGED, sensor, []mutablehome.TraitType{mutablehome.TRAIT_SENSOR_ACTIVITY}})
+		node.Emit(&event{mutablehome.EVENT_NODE_ONLINE, nil, nil})
+		if values := store.Between("sensor", mutablehome.TRAIT_SENSOR_ACTIVITY, time.Time{}, time.Time{}); len(values) != 2 {
+			t.Error("Unexpected values", values)
+		}
+		t.Log(store)
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func RunWithStore(t *testing.T, config Store, main func(*store, *testing.T)) {
+	t.Helper()
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		unit, err := gopi.New(config, app.Log().Clone(config.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unit.Close()
+		main(unit.(*store), t)
+	}, nil); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
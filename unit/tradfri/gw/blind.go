@@ -0,0 +1,75 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package gateway
+
+import (
+	"fmt"
+
+	// Modules
+	"github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type blind struct {
+	deviceId_ uint
+	Position_ float32 `json:"5536"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	BLIND_POSITION_MAX = 100
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// GET PROPERTIES
+
+func (this blind) Position() uint8 {
+	if this.Position_ <= 0 {
+		return 0
+	} else if this.Position_ >= BLIND_POSITION_MAX {
+		return BLIND_POSITION_MAX
+	} else {
+		return uint8(this.Position_ + 0.5)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EQUALS
+
+func (this blind) Equals(other blind) bool {
+	return this.Position_ == other.Position_
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SET PROPERTIES
+
+func (this blind) SetPosition(value uint8) mutablehome.TradfriCommand {
+	if value > BLIND_POSITION_MAX {
+		value = BLIND_POSITION_MAX
+	}
+	return NewBlindState(this.deviceId_, map[string]interface{}{
+		ATTR_BLIND_CURRENT_POSITION: value,
+	})
+}
+
+func (this blind) Stop() mutablehome.TradfriCommand {
+	return NewBlindState(this.deviceId_, map[string]interface{}{
+		ATTR_BLIND_TRIGGER: 0,
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this blind) String() string {
+	return "<ikea.Blind position=" + fmt.Sprint(this.Position()) + ">"
+}
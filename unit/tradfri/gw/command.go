@@ -27,6 +27,10 @@ type Lightstate struct {
 	Lightbulbs []lightbulb `json:"3311"`
 }
 
+type Plugstate struct {
+	Plugs []plug `json:"3312"`
+}
+
 type command struct {
 	path []string
 	body interface{}
@@ -42,6 +46,43 @@ func NewLightState(device uint, state lightbulb) mutablehome.TradfriCommand {
 	}
 }
 
+func NewPlugState(device uint, state plug) mutablehome.TradfriCommand {
+	return &command{
+		path: []string{PATH_DEVICES, fmt.Sprint(device)},
+		body: Plugstate{[]plug{state}},
+	}
+}
+
+func NewBlindState(device uint, state map[string]interface{}) mutablehome.TradfriCommand {
+	return &command{
+		path: []string{PATH_DEVICES, fmt.Sprint(device)},
+		body: map[string]interface{}{
+			ATTR_START_BLINDS: []map[string]interface{}{state},
+		},
+	}
+}
+
+func NewDeviceState(device uint, state map[string]interface{}) mutablehome.TradfriCommand {
+	return &command{
+		path: []string{PATH_DEVICES, fmt.Sprint(device)},
+		body: state,
+	}
+}
+
+func NewGatewayState(state map[string]interface{}) mutablehome.TradfriCommand {
+	return &command{
+		path: []string{PATH_GATEWAY_INFO},
+		body: state,
+	}
+}
+
+func NewGroupState(group uint, state map[string]interface{}) mutablehome.TradfriCommand {
+	return &command{
+		path: []string{PATH_GROUPS, fmt.Sprint(group)},
+		body: state,
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // RETURN PATH AND BODY
 
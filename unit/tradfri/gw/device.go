@@ -37,9 +37,21 @@ type device struct {
 		BatteryLevel int    `json:"9"`
 	} `json:"3"`
 
-	Lights_ []lightbulb `json:"3311"` // IKEA_DEVICE_TYPE_LIGHTBULB
+	Lights_ []lightbulb `json:"3311"`  // IKEA_DEVICE_TYPE_LIGHT
+	Plugs_  []plug      `json:"3312"`  // IKEA_DEVICE_TYPE_PLUG
+	Blinds_ []blind     `json:"15015"` // IKEA_DEVICE_TYPE_BLIND
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+// Power sources, from the LWM2M device object
+const (
+	POWER_SOURCE_INTERNAL_BATTERY = 1
+	POWER_SOURCE_EXTERNAL_BATTERY = 2
+	POWER_SOURCE_BATTERY          = 3
+)
+
 ////////////////////////////////////////////////////////////////////////////////
 // IMPLEMENTATION
 
@@ -92,10 +104,65 @@ func (this *device) Lights() []mutablehome.TradfriLight {
 	return lights
 }
 
+func (this *device) Plugs() []mutablehome.TradfriPlug {
+	plugs := make([]mutablehome.TradfriPlug, len(this.Plugs_))
+	for i, plug := range this.Plugs_ {
+		plug.deviceId_ = this.Id()
+		plugs[i] = plug
+	}
+	return plugs
+}
+
+func (this *device) Blinds() []mutablehome.TradfriBlind {
+	blinds := make([]mutablehome.TradfriBlind, len(this.Blinds_))
+	for i, blind := range this.Blinds_ {
+		blind.deviceId_ = this.Id()
+		blinds[i] = blind
+	}
+	return blinds
+}
+
+func (this *device) HasBattery() bool {
+	// Lights and plugs are mains powered but can report a battery power source
+	switch this.Type() {
+	case mutablehome.IKEA_DEVICE_TYPE_LIGHT, mutablehome.IKEA_DEVICE_TYPE_PLUG:
+		return false
+	}
+	switch this.Metadata_.PowerSource {
+	case POWER_SOURCE_INTERNAL_BATTERY, POWER_SOURCE_EXTERNAL_BATTERY, POWER_SOURCE_BATTERY:
+		return true
+	default:
+		return false
+	}
+}
+
+func (this *device) BatteryLevel() uint {
+	if this.Metadata_.BatteryLevel <= 0 {
+		return 0
+	} else if this.Metadata_.BatteryLevel >= 100 {
+		return 100
+	} else {
+		return uint(this.Metadata_.BatteryLevel)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SET PROPERTIES
+
+func (this *device) SetName(name string) mutablehome.TradfriCommand {
+	return NewDeviceState(this.Id_, map[string]interface{}{
+		ATTR_NAME: name,
+	})
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // EQUALS
 
-func (this *device) Equals(other *device) bool {
+func (this *device) Equals(other_ mutablehome.TradfriDevice) bool {
+	other, ok := other_.(*device)
+	if ok == false || other == nil {
+		return false
+	}
 	if this.Name_ != other.Name_ {
 		return false
 	}
@@ -143,6 +210,22 @@ func (this *device) Equals(other *device) bool {
 			return false
 		}
 	}
+	if len(this.Plugs_) != len(other.Plugs_) {
+		return false
+	}
+	for i, plug := range this.Plugs_ {
+		if plug.Equals(other.Plugs_[i]) == false {
+			return false
+		}
+	}
+	if len(this.Blinds_) != len(other.Blinds_) {
+		return false
+	}
+	for i, blind := range this.Blinds_ {
+		if blind.Equals(other.Blinds_[i]) == false {
+			return false
+		}
+	}
 	// Otherwise, all equal
 	return true
 }
@@ -160,6 +243,10 @@ func (this *device) String() string {
 	switch this.Type() {
 	case mutablehome.IKEA_DEVICE_TYPE_LIGHT:
 		str += " lights=" + fmt.Sprint(this.Lights())
+	case mutablehome.IKEA_DEVICE_TYPE_PLUG:
+		str += " plugs=" + fmt.Sprint(this.Plugs())
+	case mutablehome.IKEA_DEVICE_TYPE_BLIND:
+		str += " blinds=" + fmt.Sprint(this.Blinds())
 	}
 
 	if this.Metadata_.BatteryLevel != 0 {
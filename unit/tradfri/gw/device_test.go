@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	DEVICE_BULB_WS = `{"3":{"0":"IKEA of Sweden","1":"TRADFRI bulb E27 WS opal 980lm","2":"","3":"2.3.050","6":1},"3311":[{"5850":1,"5851":254,"5706":"f5faf6","5709":24930,"5710":24694,"5711":250,"9003":0}],"5750":2,"9001":"Lamp","9002":1566402385,"9003":65537,"9019":1,"9020":1588512021,"9054":0}`
+	DEVICE_BULB    = `{"3":{"0":"IKEA of Sweden","1":"TRADFRI bulb E27 W opal 1000lm","6":1},"3311":[{"5850":0,"5851":10,"9003":0}],"5750":2,"9001":"Hallway","9003":65538,"9019":1}`
+	DEVICE_BLIND   = `{"3":{"0":"IKEA of Sweden","1":"FYRTUR block-out roller blind","6":3,"9":87},"15015":[{"5536":40.0,"9003":0}],"5750":7,"9001":"Blind","9003":65540,"9019":1}`
+	DEVICE_REMOTE  = `{"3":{"0":"IKEA of Sweden","1":"TRADFRI remote control","6":3,"9":12},"5750":0,"9001":"Remote","9003":65541,"9019":1,"9020":1588512021}`
+	DEVICE_PLUG    = `{"3":{"0":"IKEA of Sweden","1":"TRADFRI control outlet","6":1},"3312":[{"5850":1,"9003":0}],"5750":3,"9001":"Outlet","9003":65539,"9019":1}`
+)
+
+func Test_Device_000(t *testing.T) {
+	t.Log("Test_Device_000")
+}
+
+func Test_Device_001(t *testing.T) {
+	device := NewDevice()
+	if err := json.Unmarshal([]byte(DEVICE_BULB_WS), device); err != nil {
+		t.Fatal(err)
+	} else if device.Type() != mutablehome.IKEA_DEVICE_TYPE_LIGHT {
+		t.Error("Unexpected type", device.Type())
+	} else if lights := device.Lights(); len(lights) != 1 {
+		t.Error("Unexpected lights", lights)
+	} else if lights[0].HasTemperature() == false || lights[0].HasColor() == true {
+		t.Error("Unexpected capabilities", lights[0])
+	} else if lights[0].Power() == false || lights[0].Brightness() != 0xFE {
+		t.Error("Unexpected state", lights[0])
+	} else {
+		t.Log(device)
+	}
+}
+
+func Test_Device_002(t *testing.T) {
+	a, b := NewDevice(), NewDevice()
+	if err := json.Unmarshal([]byte(DEVICE_BULB), a); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal([]byte(DEVICE_BULB), b); err != nil {
+		t.Fatal(err)
+	} else if a.Equals(b) == false {
+		t.Error("Expected devices to be equal")
+	} else if lights := a.Lights(); lights[0].HasTemperature() || lights[0].HasColor() {
+		t.Error("Unexpected capabilities", lights[0])
+	}
+	b.Lights_[0].Brightness_ = 20
+	if a.Equals(b) {
+		t.Error("Expected devices to differ")
+	}
+}
+
+func Test_Device_003(t *testing.T) {
+	device := NewDevice()
+	if err := json.Unmarshal([]byte(DEVICE_PLUG), device); err != nil {
+		t.Fatal(err)
+	} else if plugs := device.Plugs(); len(plugs) != 1 {
+		t.Error("Unexpected plugs", plugs)
+	} else if plugs[0].Power() == false {
+		t.Error("Unexpected plug state", plugs[0])
+	} else if cmd := plugs[0].SetPower(false); cmd.Path() != "/15001/65539" {
+		t.Error("Unexpected path", cmd.Path())
+	} else {
+		t.Log(cmd)
+	}
+}
+
+func Test_Device_004(t *testing.T) {
+	device := NewDevice()
+	if err := json.Unmarshal([]byte(DEVICE_BLIND), device); err != nil {
+		t.Fatal(err)
+	} else if blinds := device.Blinds(); len(blinds) != 1 {
+		t.Error("Unexpected blinds", blinds)
+	} else if blinds[0].Position() != 40 {
+		t.Error("Unexpected position", blinds[0].Position())
+	} else if device.HasBattery() == false || device.BatteryLevel() != 87 {
+		t.Error("Unexpected battery", device.BatteryLevel())
+	} else if body, err := blinds[0].Stop().Body(); err != nil {
+		t.Error(err)
+	} else if data, err := ioutil.ReadAll(body); err != nil {
+		t.Error(err)
+	} else if string(data) != `{"15015":[{"5523":0}]}` {
+		t.Error("Unexpected body", string(data))
+	}
+}
+
+func Test_Device_005(t *testing.T) {
+	device := NewDevice()
+	if err := json.Unmarshal([]byte(DEVICE_REMOTE), device); err != nil {
+		t.Fatal(err)
+	} else if device.Type() != mutablehome.IKEA_DEVICE_TYPE_REMOTE {
+		t.Error("Unexpected type", device.Type())
+	} else if device.HasBattery() == false || device.BatteryLevel() != 12 {
+		t.Error("Unexpected battery", device.BatteryLevel())
+	} else if len(device.Lights()) != 0 || len(device.Plugs()) != 0 || len(device.Blinds()) != 0 {
+		t.Error("Unexpected accessories", device)
+	}
+}
+
+func Test_Device_006(t *testing.T) {
+	// Bulbs report an internal battery power source
+	device := NewDevice()
+	if err := json.Unmarshal([]byte(DEVICE_BULB), device); err != nil {
+		t.Fatal(err)
+	} else if device.HasBattery() {
+		t.Error("Unexpected battery for light")
+	}
+}
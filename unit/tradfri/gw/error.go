@@ -0,0 +1,72 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	"github.com/go-ocf/go-coap/codes"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Error is returned when the gateway responds with an unexpected
+// CoAP response code, and wraps the equivalent gopi.Error so that
+// callers can use errors.Is to test for gopi.ErrNotFound and so forth
+type Error struct {
+	Code codes.Code
+	Path string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+func NewError(code codes.Code, path string) error {
+	return &Error{code, path}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func (this *Error) Unwrap() error {
+	switch this.Code {
+	case codes.NotFound:
+		return gopi.ErrNotFound
+	case codes.BadRequest, codes.BadOption, codes.NotAcceptable, codes.RequestEntityIncomplete, codes.RequestEntityTooLarge, codes.UnsupportedMediaType:
+		return gopi.ErrBadParameter
+	case codes.MethodNotAllowed, codes.NotImplemented, codes.ProxyingNotSupported:
+		return gopi.ErrNotImplemented
+	default:
+		return gopi.ErrUnexpectedResponse
+	}
+}
+
+// Temporary returns true if the request could succeed when retried
+func (this *Error) Temporary() bool {
+	switch this.Code {
+	case codes.ServiceUnavailable, codes.GatewayTimeout, codes.InternalServerError:
+		return true
+	default:
+		return false
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *Error) Error() string {
+	str := fmt.Sprintf("%v: %v", this.Unwrap(), this.Code)
+	if this.Path != "" {
+		str += " (path: " + strconv.Quote(this.Path) + ")"
+	}
+	return str
+}
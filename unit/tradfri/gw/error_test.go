@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/djthorpe/gopi/v2"
+	"github.com/go-ocf/go-coap/codes"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Test_Error_000(t *testing.T) {
+	t.Log("Test_Error_000")
+}
+
+func Test_Error_001(t *testing.T) {
+	if err := NewError(codes.NotFound, "/15001/1"); errors.Is(err, gopi.ErrNotFound) == false {
+		t.Error("Expected ErrNotFound, got", err)
+	} else {
+		t.Log(err)
+	}
+	if err := NewError(codes.BadRequest, "/15001/1"); errors.Is(err, gopi.ErrBadParameter) == false {
+		t.Error("Expected ErrBadParameter, got", err)
+	}
+	if err := NewError(codes.MethodNotAllowed, "/15001/1"); errors.Is(err, gopi.ErrNotImplemented) == false {
+		t.Error("Expected ErrNotImplemented, got", err)
+	}
+	if err := NewError(codes.Unauthorized, ""); errors.Is(err, gopi.ErrUnexpectedResponse) == false {
+		t.Error("Expected ErrUnexpectedResponse, got", err)
+	}
+}
+
+func Test_Error_002(t *testing.T) {
+	var err_ *Error
+	if err := NewError(codes.ServiceUnavailable, ""); errors.As(err, &err_) == false {
+		t.Error("Expected *Error")
+	} else if err_.Temporary() == false {
+		t.Error("Expected temporary error")
+	} else if err_.Code != codes.ServiceUnavailable {
+		t.Error("Unexpected code", err_.Code)
+	}
+	if err := NewError(codes.NotFound, "").(*Error); err.Temporary() {
+		t.Error("Expected permanent error")
+	}
+}
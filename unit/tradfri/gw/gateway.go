@@ -8,17 +8,21 @@
 package gateway
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	// Modules
 	gopi "github.com/djthorpe/gopi/v2"
 	base "github.com/djthorpe/gopi/v2/base"
+	mutablehome "github.com/djthorpe/mutablehome"
 	coap "github.com/go-ocf/go-coap"
 	"github.com/go-ocf/go-coap/codes"
 )
@@ -27,16 +31,25 @@ import (
 // TYPES
 
 type gateway struct {
+	// Counters are first for alignment of atomic operations
+	reconnects uint64
+	coaperrors uint64
+
 	base.Unit
+	base.PubSub
 	sync.Mutex
+	sync.WaitGroup
 	token
 
-	key     string
-	path    string
-	addr    string
-	timeout time.Duration
-	conn    *coap.ClientConn
-	devices map[uint]*device
+	key       string
+	path      string
+	addr      string
+	name      string
+	timeout   time.Duration
+	keepalive time.Duration
+	conn      *coap.ClientConn
+	stop      chan struct{}
+	devices   map[uint]*device
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -44,10 +57,16 @@ type gateway struct {
 
 const (
 	CONN_TIMEOUT       = 5 * time.Second
+	OBSERVE_INTERVAL   = 15 * time.Second
+	KEEPALIVE_INTERVAL = 10 * time.Second
+	BACKOFF_MIN        = time.Second
+	BACKOFF_MAX        = time.Minute
 	PATH_AUTH_EXCHANGE = "/15011/9063"
 	PATH_DEVICES       = "/15001"
 	PATH_GROUPS        = "/15004"
 	PATH_SCENES        = "/15005"
+	PATH_GATEWAY_INFO  = "/15011/15012"
+	PATH_REBOOT        = "/15011/9030"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -64,6 +83,13 @@ func (this *gateway) Init(config Tradfri) error {
 		this.timeout = config.Timeout
 	}
 
+	// Set keepalive interval
+	if config.Keepalive == 0 {
+		this.keepalive = KEEPALIVE_INTERVAL
+	} else {
+		this.keepalive = config.Keepalive
+	}
+
 	// Create path if it doesn't exist, and read token file
 	if path, err := this.token.CreatePath(config.Path); err != nil {
 		return err
@@ -81,6 +107,9 @@ func (this *gateway) Init(config Tradfri) error {
 }
 
 func (this *gateway) Close() error {
+	// Stop supervising the connection
+	this.stopSupervisor()
+
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
@@ -91,6 +120,11 @@ func (this *gateway) Close() error {
 	//}
 	//}
 
+	// Unsubscribe any listeners
+	if err := this.PubSub.Close(); err != nil {
+		return err
+	}
+
 	// Release resources
 	this.conn = nil
 	this.devices = nil
@@ -116,6 +150,9 @@ func (this *gateway) String() string {
 	if this.timeout != 0 {
 		str += " timeout=" + fmt.Sprint(this.timeout)
 	}
+	if this.keepalive != 0 {
+		str += " keepalive=" + fmt.Sprint(this.keepalive)
+	}
 	return str + ">"
 }
 
@@ -126,64 +163,49 @@ func (this *gateway) Connect(service gopi.RPCServiceRecord, flags gopi.RPCFlag)
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	if this.conn != nil {
+	if this.conn != nil || this.stop != nil {
 		return gopi.ErrOutOfOrder
 	} else if addr, err := addrForService(service, flags); err != nil {
 		return err
 	} else {
-		// Authenticate and close connection
-		if this.token.Id == "" || this.token.Token == "" {
-			if id := strings.TrimSpace(service.Name); id == "" {
-				return gopi.ErrBadParameter.WithPrefix("id")
-			} else if conn, err := coapConnectWith(addr, "Client_identity", this.key, this.timeout); err != nil {
-				return err
-			} else if response, err := coapAuthenticate(conn, id, this.timeout); err != nil {
-				return err
-			} else if err := json.Unmarshal(response, &this.token); err != nil {
-				return err
-			} else {
-				this.token.Id = id
-				if err := this.token.Write(this.path); err != nil {
-					return err
-				} else if err := conn.Close(); err != nil {
-					return err
-				}
-			}
-		}
-
-		// Connect with existing token parameters
-		if conn, err := coapConnectWith(addr, this.token.Id, this.token.Token, this.timeout); err != nil {
+		token := this.token
+		conn, err := this.connect(addr, service.Name, &token)
+		this.token = token
+		if err != nil {
 			return err
-		} else {
-			this.conn = conn
-			this.addr = addr
 		}
+		this.conn = conn
+		this.addr = addr
+		this.name = service.Name
 	}
 
-	// Emit connected message
-	// TODO this.bus.Emit(NewEvent(this, mutablehome.IKEA_EVENT_GATEWAY_CONNECTED, nil))
+	// Supervise the connection in the background
+	this.stop = make(chan struct{})
+	this.WaitGroup.Add(1)
+	go this.supervise(this.stop)
 
 	// Success
 	return nil
 }
 
 func (this *gateway) Disconnect() error {
+	// Stop supervising the connection
+	this.stopSupervisor()
+
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	// Emit disconnected message
-	// TODO this.bus.Emit(NewEvent(this, mutablehome.IKEA_EVENT_GATEWAY_DISCONNECTED, nil))
-
 	// Close connection
 	if this.conn != nil {
 		if err := this.conn.Close(); err != nil {
-			return err
+			this.Log.Debug("Close:", err)
 		}
 	}
 
 	// Release resources
 	this.conn = nil
 	this.addr = ""
+	this.name = ""
 
 	// Return success
 	return nil
@@ -212,74 +234,80 @@ func (this *gateway) Version() string {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// DEVICES, GROUPS AND SCENES
-
-func (this *gateway) Devices() ([]uint, error) {
-	this.Mutex.Lock()
-	defer this.Mutex.Unlock()
+// GATEWAY ADMINISTRATION
 
-	return this.requestIdsForPath(PATH_DEVICES)
-}
-
-func (this *gateway) Groups() ([]uint, error) {
+func (this *gateway) Info() (mutablehome.TradfriGatewayInfo, error) {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	return this.requestIdsForPath(PATH_GROUPS)
+	info := NewInfo()
+	if err := this.requestObjForPath(PATH_GATEWAY_INFO, info); err != nil {
+		return nil, err
+	} else {
+		return info, nil
+	}
 }
 
-func (this *gateway) Scenes() ([]uint, error) {
+func (this *gateway) Reboot() error {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	return this.requestIdsForPath(PATH_SCENES)
-}
-
-////////////////////////////////////////////////////////////////////////////////
-// PRIVATE METHODS
-
-func (this *gateway) requestIdsForPath(path string) ([]uint, error) {
 	if this.conn == nil {
-		return nil, gopi.ErrOutOfOrder
+		return gopi.ErrOutOfOrder
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
 	defer cancel()
 
-	var ids []uint
-	if response, err := this.conn.GetWithContext(ctx, path); err != nil {
-		return nil, err
-	} else if response.Code() != codes.Content {
-		return nil, fmt.Errorf("%w: %v (path: %v)", gopi.ErrUnexpectedResponse, response.Code(), strconv.Quote(path))
-	} else if err := json.Unmarshal(response.Payload(), &ids); err != nil {
-		return nil, fmt.Errorf("%w: %v", err, string(response.Payload()))
+	if response, err := this.conn.PostWithContext(ctx, PATH_REBOOT, coap.AppJSON, strings.NewReader("{}")); err != nil {
+		return this.coapError(err)
+	} else if response.Code() != codes.Changed && response.Code() != codes.Created {
+		return this.coapError(NewError(response.Code(), PATH_REBOOT))
 	}
 
 	// Success
-	return ids, nil
+	return nil
 }
 
-func (this *gateway) requestObjForPathId(path string, id uint, obj interface{}) error {
+func (this *gateway) Pair(duration time.Duration) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
 	if this.conn == nil {
 		return gopi.ErrOutOfOrder
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
-	defer cancel()
-	if response, err := this.conn.GetWithContext(ctx, fmt.Sprintf("%v/%d", path, id)); err != nil {
-		return err
-	} else if response.Code() != codes.Content {
-		return fmt.Errorf("%w: %v (path: %v)", gopi.ErrUnexpectedResponse, response.Code(), response.Path())
-	} else if err := json.Unmarshal(response.Payload(), obj); err != nil {
-		return fmt.Errorf("%w: %v", err, string(response.Payload()))
+	} else if duration < 0 {
+		return gopi.ErrBadParameter.WithPrefix("duration")
 	} else {
-		fmt.Println(string(response.Payload()))
+		return this.sendCommand(NewGatewayState(map[string]interface{}{
+			ATTR_COMMISSIONING_MODE: uint(duration.Seconds()),
+		}))
 	}
+}
 
-	// Success
-	return nil
+////////////////////////////////////////////////////////////////////////////////
+// DEVICES, GROUPS AND SCENES
+
+func (this *gateway) Devices() ([]uint, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.requestIdsForPath(PATH_DEVICES)
 }
 
-/*
-func (this *tradfri) Device(id uint) (mutablehome.IkeaDevice, error) {
+func (this *gateway) Groups() ([]uint, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.requestIdsForPath(PATH_GROUPS)
+}
+
+func (this *gateway) Scenes() ([]uint, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.requestIdsForPath(PATH_SCENES)
+}
+
+func (this *gateway) Device(id uint) (mutablehome.TradfriDevice, error) {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
@@ -291,7 +319,7 @@ func (this *tradfri) Device(id uint) (mutablehome.IkeaDevice, error) {
 	}
 }
 
-func (this *tradfri) Group(id uint) (mutablehome.IkeaGroup, error) {
+func (this *gateway) Group(id uint) (mutablehome.TradfriGroup, error) {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
@@ -303,25 +331,42 @@ func (this *tradfri) Group(id uint) (mutablehome.IkeaGroup, error) {
 	}
 }
 
+func (this *gateway) GroupScenes(group uint) ([]uint, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.requestIdsForPath(fmt.Sprintf("%v/%d", PATH_SCENES, group))
+}
+
+func (this *gateway) Scene(group, id uint) (mutablehome.TradfriScene, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	scene := NewScene(group)
+	if err := this.requestObjForPathId(fmt.Sprintf("%v/%d", PATH_SCENES, group), id, scene); err != nil {
+		return nil, err
+	} else {
+		return scene, nil
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // SEND COMMANDS TO GATEWAY
 
-func (this *tradfri) Send(commands ...mutablehome.IkeaCommand) error {
+func (this *gateway) Send(commands ...mutablehome.TradfriCommand) error {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	if len(commands) == 0 {
-		return gopi.ErrBadParameter.WithPrefix("values")
+	if this.conn == nil {
+		return gopi.ErrOutOfOrder
+	} else if len(commands) == 0 {
+		return gopi.ErrBadParameter.WithPrefix("commands")
 	}
 	for _, command := range commands {
 		if command == nil {
 			return gopi.ErrBadParameter.WithPrefix("command")
-		} else if body, err := command.Body(); err != nil {
-			return gopi.ErrBadParameter.WithPrefix("command")
-		} else if message, err := this.conn.Put(command.Path(), coap.AppJSON, body); err != nil {
+		} else if err := this.sendCommand(command); err != nil {
 			return err
-		} else if message.Code() != codes.Changed {
-			return fmt.Errorf("%w: %v (path: %v)", gopi.ErrUnexpectedResponse, message.Code(), message.Path())
 		}
 	}
 
@@ -330,78 +375,391 @@ func (this *tradfri) Send(commands ...mutablehome.IkeaCommand) error {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// OBSERVE DEVICE CHANGES
+// METRICS
 
-func (this *tradfri) ObserveDevice(ctx context.Context, id uint) error {
-	path := strings.Join([]string{PATH_DEVICES, fmt.Sprint(id)}, "/")
-	ticker := time.NewTimer(100 * time.Millisecond)
-	var obs *coap.Observation
+// Metrics returns the number of times the connection to the gateway
+// has been re-established, and the number of CoAP requests which failed
+func (this *gateway) Metrics() []mutablehome.Metric {
+	this.Mutex.Lock()
+	labels := map[string]string{"gateway": this.name}
+	this.Mutex.Unlock()
+
+	return []mutablehome.Metric{
+		mutablehome.Metric{
+			Name:   "mutablehome_tradfri_reconnects_total",
+			Help:   "Number of times the connection to the gateway was re-established",
+			Type:   mutablehome.METRIC_COUNTER,
+			Labels: labels,
+			Value:  float64(atomic.LoadUint64(&this.reconnects)),
+		},
+		mutablehome.Metric{
+			Name:   "mutablehome_tradfri_coap_errors_total",
+			Help:   "Number of CoAP requests to the gateway which failed",
+			Type:   mutablehome.METRIC_COUNTER,
+			Labels: labels,
+			Value:  float64(atomic.LoadUint64(&this.coaperrors)),
+		},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// OBSERVE DEVICE AND GROUP CHANGES
+
+func (this *gateway) ObserveDevice(ctx context.Context, id uint) error {
+	path := fmt.Sprintf("%v/%d", PATH_DEVICES, id)
+	return this.observePath(ctx, path, func(payload []byte) (interface{}, error) {
+		device := NewDevice()
+		if err := json.Unmarshal(payload, device); err != nil {
+			return nil, err
+		} else {
+			return device, nil
+		}
+	})
+}
+
+func (this *gateway) ObserveGroup(ctx context.Context, id uint) error {
+	path := fmt.Sprintf("%v/%d", PATH_GROUPS, id)
+	return this.observePath(ctx, path, func(payload []byte) (interface{}, error) {
+		group := NewGroup()
+		if err := json.Unmarshal(payload, group); err != nil {
+			return nil, err
+		} else {
+			return group, nil
+		}
+	})
+}
 
+////////////////////////////////////////////////////////////////////////////////
+// SUPERVISE CONNECTION
+
+// connect authenticates with the security code when there is no token,
+// and then connects with the token. When the gateway rejects the token
+// during the handshake, the key exchange is repeated and the connection
+// retried. Any other error is returned, so that a gateway which is
+// unreachable does not issue a new identity on each attempt. The token
+// is updated with any new identity, even when an error is returned
+func (this *gateway) connect(addr, name string, token *token) (*coap.ClientConn, error) {
+	authenticated := false
+	if token.Id == "" || token.Token == "" {
+		if err := this.authenticate(addr, name, token); err != nil {
+			return nil, err
+		} else {
+			authenticated = true
+		}
+	}
+
+	// Connect with existing token parameters
+	conn, err := coapConnectWith(addr, token.Id, token.Token, this.timeout)
+	if err != nil && authenticated == false && this.key != "" && coapRejected(err) {
+		this.Log.Debug("Connect:", err, "(re-negotiating token)")
+		if err := this.authenticate(addr, name, token); err != nil {
+			return nil, err
+		}
+		conn, err = coapConnectWith(addr, token.Id, token.Token, this.timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Success
+	return conn, nil
+}
+
+// authenticate performs the key exchange with the security code and
+// writes the token. The response is decoded ignoring any trailing bytes
+// after the JSON object
+func (this *gateway) authenticate(addr, name string, token *token) error {
+	id := strings.TrimSpace(name)
+	if id == "" {
+		id = token.Id
+	}
+	if id == "" {
+		return gopi.ErrBadParameter.WithPrefix("id")
+	} else if conn, err := coapConnectWith(addr, "Client_identity", this.key, this.timeout); err != nil {
+		return err
+	} else {
+		// Closing a connection returns the error from the serving
+		// goroutine ending, which is expected
+		defer func() {
+			if err := conn.Close(); err != nil {
+				this.Log.Debug("Close:", err)
+			}
+		}()
+		if response, err := coapAuthenticate(conn, id, this.timeout); err != nil {
+			return err
+		} else if err := json.NewDecoder(bytes.NewReader(response)).Decode(token); err != nil {
+			return err
+		} else {
+			token.Id = id
+			if err := token.Write(this.path); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Success
+	return nil
+}
+
+// supervise pings the gateway regularly and when the gateway does not
+// respond, closes the connection and reconnects with exponential backoff.
+// IKEA_EVENT_GATEWAY_DISCONNECTED and IKEA_EVENT_GATEWAY_CONNECTED are
+// emitted as the connection state changes
+func (this *gateway) supervise(stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+
+	timer := time.NewTimer(this.keepalive)
+	backoff := BACKOFF_MIN
 FOR_LOOP:
 	for {
 		select {
-		case <-ticker.C:
-			// Stop
-			if obs != nil {
-				if err := obs.Cancel(); err != nil {
-					return err
+		case <-timer.C:
+			if this.online() {
+				if err := this.ping(); err != nil {
+					this.Log.Warn("Keepalive:", err)
+					this.reset()
+					this.Emit(mutablehome.IKEA_EVENT_GATEWAY_DISCONNECTED)
+					backoff = BACKOFF_MIN
+					timer.Reset(backoff)
+				} else {
+					timer.Reset(this.keepalive)
 				}
-			}
-			// Start
-			if obs_, err := this.conn.Observe(path, this.observeDeviceCallback); err != nil {
-				return err
-			} else {
-				obs = obs_
-			}
-			// Restart the ticker with some random additional interval
-			ticker.Reset(time.Second * (5 + time.Duration(rand.Int31n(15))))
-		case <-ctx.Done():
-			if err := obs.Cancel(); err != nil {
-				return err
+			} else if err := this.reconnect(); err != nil {
+				this.Log.Debug("Reconnect:", err)
+				if backoff = backoff * 2; backoff > BACKOFF_MAX {
+					backoff = BACKOFF_MAX
+				}
+				timer.Reset(backoff)
 			} else {
-				break FOR_LOOP
+				atomic.AddUint64(&this.reconnects, 1)
+				this.Emit(mutablehome.IKEA_EVENT_GATEWAY_CONNECTED)
+				timer.Reset(this.keepalive)
 			}
+		case <-stop:
+			timer.Stop()
+			break FOR_LOOP
 		}
 	}
+}
+
+// stopSupervisor ends the supervisor and waits for it to end, without
+// holding the lock since the supervisor may be emitting events
+func (this *gateway) stopSupervisor() {
+	this.Mutex.Lock()
+	stop := this.stop
+	this.stop = nil
+	this.Mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		this.WaitGroup.Wait()
+	}
+}
+
+func (this *gateway) online() bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	return this.conn != nil
+}
+
+func (this *gateway) ping() error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if this.conn == nil {
+		return gopi.ErrOutOfOrder
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	return this.coapError(this.conn.PingWithContext(ctx))
+}
+
+// reset closes the connection but retains the address for reconnecting
+func (this *gateway) reset() {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if this.conn != nil {
+		if err := this.conn.Close(); err != nil {
+			this.Log.Debug("Close:", err)
+		}
+	}
+	this.conn = nil
+}
+
+// reconnect connects to the gateway without holding the lock, since
+// the handshake and key exchange can take some time, and then sets the
+// connection unless another connection has been made in the meantime
+func (this *gateway) reconnect() error {
+	this.Mutex.Lock()
+	addr, name, token := this.addr, this.name, this.token
+	connected := this.conn != nil
+	this.Mutex.Unlock()
+
+	if connected {
+		return nil
+	} else if addr == "" {
+		return gopi.ErrOutOfOrder
+	}
+
+	conn, err := this.connect(addr, name, &token)
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	this.token = token
+	if err != nil {
+		return err
+	} else if this.conn != nil || this.addr != addr {
+		if err := conn.Close(); err != nil {
+			this.Log.Debug("Close:", err)
+		}
+		return gopi.ErrOutOfOrder
+	} else {
+		this.conn = conn
+	}
 
 	// Success
-	return ctx.Err()
+	return nil
 }
 
-func (this *tradfri) observeDeviceCallback(response *coap.Request) {
-	device := NewDevice()
-	if response.Msg.Code() != codes.Content {
-		this.Log.Error(fmt.Errorf("%w: %v", gopi.ErrUnexpectedResponse, response.Msg.Code()))
-		return
-	} else if err := json.Unmarshal(response.Msg.Payload(), &device); err != nil {
-		this.Log.Error(fmt.Errorf("%w: %v", gopi.ErrUnexpectedResponse, err))
-		return
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *gateway) requestIdsForPath(path string) ([]uint, error) {
+	if this.conn == nil {
+		return nil, gopi.ErrOutOfOrder
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+
+	var ids []uint
+	if response, err := this.conn.GetWithContext(ctx, path); err != nil {
+		return nil, this.coapError(err)
+	} else if response.Code() != codes.Content {
+		return nil, this.coapError(NewError(response.Code(), path))
+	} else if err := json.Unmarshal(response.Payload(), &ids); err != nil {
+		return nil, fmt.Errorf("%w: %v", err, string(response.Payload()))
+	}
+
+	// Success
+	return ids, nil
+}
+
+func (this *gateway) requestObjForPathId(path string, id uint, obj interface{}) error {
+	return this.requestObjForPath(fmt.Sprintf("%v/%d", path, id), obj)
+}
+
+func (this *gateway) requestObjForPath(path string, obj interface{}) error {
+	if this.conn == nil {
+		return gopi.ErrOutOfOrder
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+
+	if response, err := this.conn.GetWithContext(ctx, path); err != nil {
+		return this.coapError(err)
+	} else if response.Code() != codes.Content {
+		return this.coapError(NewError(response.Code(), path))
+	} else if err := json.Unmarshal(response.Payload(), obj); err != nil {
+		return fmt.Errorf("%w: %v", err, string(response.Payload()))
+	}
+
+	// Success
+	return nil
+}
+
+func (this *gateway) sendCommand(command mutablehome.TradfriCommand) error {
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+
+	if body, err := command.Body(); err != nil {
+		return fmt.Errorf("%w: %v", gopi.ErrBadParameter, err)
+	} else if response, err := this.conn.PutWithContext(ctx, command.Path(), coap.AppJSON, body); err != nil {
+		return this.coapError(err)
+	} else if response.Code() != codes.Changed {
+		return this.coapError(NewError(response.Code(), command.Path()))
+	}
+
+	// Success
+	return nil
+}
 
-	// Emit device event if there is a change
-	if event := this.observeDeviceEvent(device); event != mutablehome.IKEA_EVENT_NONE {
-		this.bus.Emit(NewEvent(this, event, device))
+// observePath keeps an observation on a path until the context is cancelled,
+// re-arming the observation regularly since the gateway silently drops them.
+// Each notification is decoded and emitted
+func (this *gateway) observePath(ctx context.Context, path string, decode func([]byte) (interface{}, error)) error {
+	callback := func(response *coap.Request) {
+		if response.Msg.Code() != codes.Content {
+			this.Log.Error(this.coapError(NewError(response.Msg.Code(), path)))
+		} else if value, err := decode(response.Msg.Payload()); err != nil {
+			this.Log.Error(fmt.Errorf("%w: %v", gopi.ErrUnexpectedResponse, err))
+		} else {
+			this.Emit(value)
+		}
 	}
+
+	timer := time.NewTimer(100 * time.Millisecond)
+	defer timer.Stop()
+
+	var obs *coap.Observation
+FOR_LOOP:
+	for {
+		select {
+		case <-timer.C:
+			if err := this.cancelObservation(obs); err != nil {
+				this.Log.Warn(path, err)
+			}
+			if obs_, err := this.observe(ctx, path, callback); err != nil {
+				// The connection may be re-established later
+				this.Log.Warn(path, err)
+				obs = nil
+			} else {
+				obs = obs_
+			}
+			// Re-arm with some random additional interval
+			timer.Reset(OBSERVE_INTERVAL + time.Duration(rand.Int63n(int64(OBSERVE_INTERVAL))))
+		case <-ctx.Done():
+			break FOR_LOOP
+		}
+	}
+
+	// Cancel observation, which fails when the connection has been closed
+	if err := this.cancelObservation(obs); err != nil {
+		this.Log.Debug(path, err)
+	}
+
+	// Return context error
+	return ctx.Err()
 }
 
-func (this *tradfri) observeDeviceEvent(device *device) mutablehome.IkeaEventType {
+func (this *gateway) observe(ctx context.Context, path string, callback func(*coap.Request)) (*coap.Observation, error) {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	if device == nil || device.Id() == 0 {
-		return mutablehome.IKEA_EVENT_NONE
+	if this.conn == nil {
+		return nil, gopi.ErrOutOfOrder
 	}
+	ctx, cancel := context.WithTimeout(ctx, this.timeout)
+	defer cancel()
+	obs, err := this.conn.ObserveWithContext(ctx, path, callback)
+	return obs, this.coapError(err)
+}
 
-	// Check for added devices
-	id := device.Id()
-	if other, exists := this.devices[id]; exists == false {
-		this.devices[id] = device
-		return mutablehome.IKEA_EVENT_DEVICE_ADDED
-	} else if device.Equals(other) == false {
-		this.devices[id] = device
-		return mutablehome.IKEA_EVENT_DEVICE_CHANGED
-	} else {
-		return mutablehome.IKEA_EVENT_NONE
+// coapError counts a failed request and returns the error
+func (this *gateway) coapError(err error) error {
+	if err != nil {
+		atomic.AddUint64(&this.coaperrors, 1)
 	}
+	return err
+}
+
+func (this *gateway) cancelObservation(obs *coap.Observation) error {
+	if obs == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+	return obs.CancelWithContext(ctx)
 }
-*/
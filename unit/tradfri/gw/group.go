@@ -0,0 +1,147 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type group struct {
+	Id_         uint   `json:"9003"`
+	Name_       string `json:"9001"`
+	Created_    int64  `json:"9002"`
+	Power_      uint   `json:"5850"`
+	Brightness_ uint8  `json:"5851"`
+	Mood_       uint   `json:"9039"`
+	Content     struct {
+		Devices struct {
+			Devices []uint `json:"9003"`
+		} `json:"15002"`
+	} `json:"9018"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func NewGroup() *group {
+	return new(group)
+}
+
+func (this *group) Id() uint {
+	return this.Id_
+}
+
+func (this *group) Name() string {
+	return this.Name_
+}
+
+func (this *group) Devices() []uint {
+	return this.Content.Devices.Devices
+}
+
+func (this *group) Power() bool {
+	return this.Power_ != 0
+}
+
+func (this *group) Brightness() uint8 {
+	return this.Brightness_
+}
+
+func (this *group) Scene() uint {
+	return this.Mood_
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SET PROPERTIES
+
+func (this *group) SetPower(state bool) mutablehome.TradfriCommand {
+	return NewGroupState(this.Id_, map[string]interface{}{
+		ATTR_DEVICE_STATE: boolToUint(state),
+	})
+}
+
+func (this *group) SetBrightness(value uint8, transition time.Duration) mutablehome.TradfriCommand {
+	return NewGroupState(this.Id_, map[string]interface{}{
+		ATTR_LIGHT_DIMMER:    value,
+		ATTR_TRANSITION_TIME: durationToTransition(transition),
+	})
+}
+
+func (this *group) SetScene(id uint) mutablehome.TradfriCommand {
+	return NewGroupState(this.Id_, map[string]interface{}{
+		ATTR_DEVICE_STATE: 1,
+		ATTR_MOOD:         id,
+	})
+}
+
+func (this *group) SetName(name string) mutablehome.TradfriCommand {
+	return NewGroupState(this.Id_, map[string]interface{}{
+		ATTR_NAME: name,
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EQUALS
+
+func (this *group) Equals(other_ mutablehome.TradfriGroup) bool {
+	other, ok := other_.(*group)
+	if ok == false || other == nil {
+		return false
+	}
+	if this.Id_ != other.Id_ {
+		return false
+	}
+	if this.Name_ != other.Name_ {
+		return false
+	}
+	if this.Created_ != other.Created_ {
+		return false
+	}
+	if this.Power_ != other.Power_ {
+		return false
+	}
+	if this.Brightness_ != other.Brightness_ {
+		return false
+	}
+	if this.Mood_ != other.Mood_ {
+		return false
+	}
+	if len(this.Devices()) != len(other.Devices()) {
+		return false
+	}
+	for i, device := range this.Devices() {
+		if device != other.Devices()[i] {
+			return false
+		}
+	}
+	// Otherwise, all equal
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *group) String() string {
+	str := "<tradfri.Group" +
+		" id=" + fmt.Sprint(this.Id()) +
+		" name=" + strconv.Quote(this.Name()) +
+		" power=" + fmt.Sprint(this.Power()) +
+		" brightness=" + fmt.Sprint(this.Brightness()) +
+		" scene=" + fmt.Sprint(this.Scene()) +
+		" devices=" + fmt.Sprint(this.Devices())
+
+	return str + ">"
+}
@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	GROUP = `{"5850":1,"5851":200,"9001":"Living Room","9002":1566402385,"9003":131073,"9018":{"15002":{"9003":[65537,65538]}},"9039":196608,"9108":0}`
+	SCENE = `{"9001":"EVERYDAY","9002":1566402385,"9003":196608,"9057":1,"9068":1,"15013":[{"5850":1,"5851":254,"9003":65537}]}`
+)
+
+func Test_Group_000(t *testing.T) {
+	t.Log("Test_Group_000")
+}
+
+func Test_Group_001(t *testing.T) {
+	group := NewGroup()
+	if err := json.Unmarshal([]byte(GROUP), group); err != nil {
+		t.Fatal(err)
+	} else if group.Id() != 131073 || group.Name() != "Living Room" {
+		t.Error("Unexpected group", group)
+	} else if len(group.Devices()) != 2 || group.Devices()[1] != 65538 {
+		t.Error("Unexpected devices", group.Devices())
+	} else if group.Power() == false || group.Brightness() != 200 || group.Scene() != 196608 {
+		t.Error("Unexpected state", group)
+	} else if group.Equals(group) == false {
+		t.Error("Expected group to be equal")
+	} else {
+		t.Log(group)
+	}
+}
+
+func Test_Group_002(t *testing.T) {
+	group := NewGroup()
+	if err := json.Unmarshal([]byte(GROUP), group); err != nil {
+		t.Fatal(err)
+	}
+	cmd := group.SetPower(false)
+	if cmd.Path() != "/15004/131073" {
+		t.Error("Unexpected path", cmd.Path())
+	} else if body, err := cmd.Body(); err != nil {
+		t.Error(err)
+	} else if data, err := ioutil.ReadAll(body); err != nil {
+		t.Error(err)
+	} else if string(data) != `{"5850":0}` {
+		t.Error("Unexpected body", string(data))
+	}
+}
+
+func Test_Group_003(t *testing.T) {
+	scene := NewScene(131073)
+	if err := json.Unmarshal([]byte(SCENE), scene); err != nil {
+		t.Fatal(err)
+	} else if scene.Id() != 196608 || scene.Name() != "EVERYDAY" || scene.Group() != 131073 {
+		t.Error("Unexpected scene", scene)
+	}
+	cmd := scene.Activate()
+	if cmd.Path() != "/15004/131073" {
+		t.Error("Unexpected path", cmd.Path())
+	} else if body, err := cmd.Body(); err != nil {
+		t.Error(err)
+	} else if data, err := ioutil.ReadAll(body); err != nil {
+		t.Error(err)
+	} else if string(data) != `{"5850":1,"9039":196608}` {
+		t.Error("Unexpected body", string(data))
+	}
+}
+
+func Test_Group_004(t *testing.T) {
+	group := NewGroup()
+	if err := json.Unmarshal([]byte(GROUP), group); err != nil {
+		t.Fatal(err)
+	} else if command := group.SetName("Kitchen"); command.Path() != "/15004/131073" {
+		t.Error("Unexpected path", command.Path())
+	} else if body, err := command.Body(); err != nil {
+		t.Error(err)
+	} else if data, err := ioutil.ReadAll(body); err != nil {
+		t.Error(err)
+	} else if string(data) != `{"9001":"Kitchen"}` {
+		t.Error("Unexpected body", string(data))
+	}
+}
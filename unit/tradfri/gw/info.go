@@ -0,0 +1,107 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type info struct {
+	Id_             string `json:"9081"`
+	Version_        string `json:"9029"`
+	NTP_            string `json:"9023"`
+	Time_           int64  `json:"9059"`
+	FirstSetup_     int64  `json:"9069"`
+	Commissioning_  uint   `json:"9061"`
+	UpdateState_    uint   `json:"9054"`
+	UpdateProgress_ uint   `json:"9055"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func NewInfo() *info {
+	return new(info)
+}
+
+func (this *info) Id() string {
+	return this.Id_
+}
+
+func (this *info) Version() string {
+	return this.Version_
+}
+
+func (this *info) NTP() string {
+	return this.NTP_
+}
+
+func (this *info) Time() time.Time {
+	if this.Time_ == 0 {
+		return time.Time{}
+	} else {
+		return time.Unix(this.Time_, 0)
+	}
+}
+
+func (this *info) FirstSetup() time.Time {
+	if this.FirstSetup_ == 0 {
+		return time.Time{}
+	} else {
+		return time.Unix(this.FirstSetup_, 0)
+	}
+}
+
+func (this *info) Pairing() bool {
+	return this.Commissioning_ != 0
+}
+
+func (this *info) UpdateState() uint {
+	return this.UpdateState_
+}
+
+func (this *info) UpdateProgress() uint {
+	if this.UpdateProgress_ > 100 {
+		return 100
+	} else {
+		return this.UpdateProgress_
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *info) String() string {
+	str := "<tradfri.Info"
+	if this.Id_ != "" {
+		str += " id=" + strconv.Quote(this.Id_)
+	}
+	if this.Version_ != "" {
+		str += " version=" + strconv.Quote(this.Version_)
+	}
+	if this.NTP_ != "" {
+		str += " ntp=" + strconv.Quote(this.NTP_)
+	}
+	if t := this.Time(); t.IsZero() == false {
+		str += " time=" + t.Format(time.RFC3339)
+	}
+	if t := this.FirstSetup(); t.IsZero() == false {
+		str += " first_setup=" + t.Format(time.RFC3339)
+	}
+	str += " pairing=" + fmt.Sprint(this.Pairing())
+	str += " update_state=" + fmt.Sprint(this.UpdateState())
+	if this.UpdateState_ != 0 {
+		str += " update_progress=" + fmt.Sprint(this.UpdateProgress())
+	}
+	return str + ">"
+}
@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	INFO = `{"9023":"xyz.pool.ntp.org","9029":"1.3.0014","9054":0,"9055":0,"9059":1509788799,"9060":"2017-11-04T09:46:39.046784Z","9061":0,"9062":0,"9066":5,"9069":1509474847,"9071":1,"9081":"7e0000000000000a","9082":true,"9083":"123-45-67"}`
+)
+
+func Test_Info_000(t *testing.T) {
+	t.Log("Test_Info_000")
+}
+
+func Test_Info_001(t *testing.T) {
+	info := NewInfo()
+	if err := json.Unmarshal([]byte(INFO), info); err != nil {
+		t.Fatal(err)
+	} else if info.Id() != "7e0000000000000a" || info.Version() != "1.3.0014" || info.NTP() != "xyz.pool.ntp.org" {
+		t.Error("Unexpected info", info)
+	} else if info.Time().Unix() != 1509788799 || info.FirstSetup().Unix() != 1509474847 {
+		t.Error("Unexpected times", info)
+	} else if info.Pairing() || info.UpdateState() != 0 {
+		t.Error("Unexpected state", info)
+	} else {
+		t.Log(info)
+	}
+}
+
+func Test_Info_002(t *testing.T) {
+	command := NewGatewayState(map[string]interface{}{ATTR_COMMISSIONING_MODE: 60})
+	if command.Path() != PATH_GATEWAY_INFO {
+		t.Error("Unexpected path", command.Path())
+	} else if body, err := command.Body(); err != nil {
+		t.Error(err)
+	} else if data, err := ioutil.ReadAll(body); err != nil {
+		t.Error(err)
+	} else if string(data) != `{"9061":60}` {
+		t.Error("Unexpected body", string(data))
+	}
+}
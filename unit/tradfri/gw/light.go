@@ -8,6 +8,7 @@
 package gateway
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
@@ -21,6 +22,8 @@ import (
 
 type lightbulb struct {
 	deviceId_       uint
+	hasTemperature_ bool
+	hasColor_       bool
 	Power_          uint    `json:"5850"`
 	ColorHex_       string  `json:"5706,omitempty"`
 	ColorX_         uint16  `json:"5709,omitempty"`
@@ -32,6 +35,24 @@ type lightbulb struct {
 	Saturation_     int     `json:"5708,omitempty"`
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// DECODE
+
+// UnmarshalJSON decodes a lightbulb and determines the capabilities
+// of the bulb from the attributes which are present
+func (this *lightbulb) UnmarshalJSON(data []byte) error {
+	type lightbulb_ lightbulb
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(data, (*lightbulb_)(this)); err != nil {
+		return err
+	} else if err := json.Unmarshal(data, &attrs); err != nil {
+		return err
+	}
+	_, this.hasTemperature_ = attrs[ATTR_LIGHT_MIREDS]
+	_, this.hasColor_ = attrs[ATTR_LIGHT_COLOR_SATURATION]
+	return nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // GET PROPERTIES
 
@@ -55,6 +76,14 @@ func (this lightbulb) Temperature() uint16 {
 	return this.Temperature_
 }
 
+func (this lightbulb) HasTemperature() bool {
+	return this.hasTemperature_
+}
+
+func (this lightbulb) HasColor() bool {
+	return this.hasColor_
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // EQUALS
 
@@ -18,10 +18,11 @@ import (
 // TYPES
 
 type Tradfri struct {
-	Id      string
-	Key     string
-	Path    string
-	Timeout time.Duration
+	Id        string
+	Key       string
+	Path      string
+	Timeout   time.Duration
+	Keepalive time.Duration
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,51 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package gateway
+
+import (
+	"fmt"
+
+	// Modules
+	"github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type plug struct {
+	deviceId_ uint
+	Power_    uint `json:"5850"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GET PROPERTIES
+
+func (this plug) Power() bool {
+	return this.Power_ != 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// EQUALS
+
+func (this plug) Equals(other plug) bool {
+	return this.Power_ == other.Power_
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SET PROPERTIES
+
+func (this plug) SetPower(state bool) mutablehome.TradfriCommand {
+	return NewPlugState(this.deviceId_, plug{Power_: boolToUint(state)})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this plug) String() string {
+	return "<ikea.Plug power=" + fmt.Sprint(this.Power()) + ">"
+}
@@ -0,0 +1,85 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package gateway
+
+import (
+	"fmt"
+	"strconv"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type scene struct {
+	group_   uint
+	Id_      uint   `json:"9003"`
+	Name_    string `json:"9001"`
+	Created_ int64  `json:"9002"`
+	Index_   uint   `json:"9057"`
+	Lights_  []struct {
+		Id_         uint  `json:"9003"`
+		Power_      uint  `json:"5850"`
+		Brightness_ uint8 `json:"5851"`
+	} `json:"15013"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION
+
+func NewScene(group uint) *scene {
+	this := new(scene)
+	this.group_ = group
+	return this
+}
+
+func (this *scene) Id() uint {
+	return this.Id_
+}
+
+func (this *scene) Name() string {
+	return this.Name_
+}
+
+func (this *scene) Group() uint {
+	return this.group_
+}
+
+func (this *scene) Devices() []uint {
+	devices := make([]uint, len(this.Lights_))
+	for i, light := range this.Lights_ {
+		devices[i] = light.Id_
+	}
+	return devices
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SET PROPERTIES
+
+// Activate returns the command to activate the scene on the group
+func (this *scene) Activate() mutablehome.TradfriCommand {
+	return NewGroupState(this.group_, map[string]interface{}{
+		ATTR_DEVICE_STATE: 1,
+		ATTR_MOOD:         this.Id_,
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *scene) String() string {
+	str := "<tradfri.Scene" +
+		" id=" + fmt.Sprint(this.Id()) +
+		" name=" + strconv.Quote(this.Name()) +
+		" group=" + fmt.Sprint(this.Group()) +
+		" devices=" + fmt.Sprint(this.Devices())
+
+	return str + ">"
+}
@@ -48,6 +48,7 @@ func coapConnectWith(addr, key, value string, timeout time.Duration) (*coap.Clie
 		},
 		PSKIdentityHint: []byte(key),
 		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		ConnectTimeout:  dtls.ConnectTimeoutOption(timeout),
 	}, timeout); err != nil {
 		return nil, fmt.Errorf("%w (addr: %s)", err, addr)
 	} else {
@@ -55,6 +56,23 @@ func coapConnectWith(addr, key, value string, timeout time.Duration) (*coap.Clie
 	}
 }
 
+// coapRejected returns true if the gateway rejected the pre-shared key
+// identity or key during the handshake, which is reported as a fatal
+// alert. Timeouts and unreachable hosts return false. The unknown PSK
+// identity alert is not named by the dtls package
+func coapRejected(err error) bool {
+	if err == nil {
+		return false
+	}
+	str := err.Error()
+	for _, alert := range []string{"HandshakeFailure", "DecryptError", "BadRecordMac", "InternalError", "Invalid alert description"} {
+		if strings.Contains(str, "alert: Alert LevelFatal: "+alert) {
+			return true
+		}
+	}
+	return false
+}
+
 // coapAuthenticate performs the gateway authentication and returns JSON response
 func coapAuthenticate(conn *coap.ClientConn, id string, timeout time.Duration) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -68,8 +86,7 @@ func coapAuthenticate(conn *coap.ClientConn, id string, timeout time.Duration) (
 		return nil, gopi.ErrUnexpectedResponse.WithPrefix(fmt.Sprint(response.Code()))
 	} else {
 		// Return success
-		payload := response.Payload()
-		return payload[0 : len(payload)-3], nil
+		return response.Payload(), nil
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/djthorpe/gopi/v2"
+	sim "github.com/djthorpe/mutablehome/unit/tradfri/sim"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -77,3 +78,30 @@ func Test_Util_003(t *testing.T) {
 		t.Error("Expected", fmt.Sprintf("127.0.0.1:%v", DEFAULT_PORT), "got", addr)
 	}
 }
+
+func Test_Util_004(t *testing.T) {
+	gw, err := sim.New("", "SecurityCode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gw.Close()
+
+	// An unknown identity is rejected by the gateway
+	if _, err := coapConnectWith(gw.Addr().String(), "unknown", "secret", 3*time.Second); err == nil {
+		t.Error("Expected error")
+	} else if coapRejected(err) == false {
+		t.Error("Expected rejected identity, got", err)
+	}
+
+	// A gateway which is not listening does not reject the identity
+	addr := gw.Addr().String()
+	gw.Close()
+	if _, err := coapConnectWith(addr, "unknown", "secret", time.Second); err == nil {
+		t.Error("Expected error")
+	} else if coapRejected(err) {
+		t.Error("Unexpected rejected identity for", err)
+	}
+	if coapRejected(nil) {
+		t.Error("Unexpected rejected identity for nil")
+	}
+}
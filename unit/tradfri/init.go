@@ -22,6 +22,9 @@ type Node interface {
 
 	// Connect to gateway
 	Connect(gopi.RPCServiceRecord, gopi.RPCFlag) error
+
+	// Disconnect from gateway
+	Disconnect() error
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -35,14 +38,16 @@ func init() {
 			app.Flags().FlagString("tradfri.key", "", "Security code")
 			app.Flags().FlagString("tradfri.state", ".tradfri", "State storage path")
 			app.Flags().FlagDuration("tradfri.timeout", 0, "Connection timeout")
+			app.Flags().FlagDuration("tradfri.keepalive", 0, "Connection keepalive interval")
 			return nil
 		},
 		New: func(app gopi.App) (gopi.Unit, error) {
 			return gopi.New(gateway.Tradfri{
-				Id:      app.Flags().GetString("tradfri.id", gopi.FLAG_NS_DEFAULT),
-				Key:     app.Flags().GetString("tradfri.key", gopi.FLAG_NS_DEFAULT),
-				Path:    app.Flags().GetString("tradfri.state", gopi.FLAG_NS_DEFAULT),
-				Timeout: app.Flags().GetDuration("tradfri.timeout", gopi.FLAG_NS_DEFAULT),
+				Id:        app.Flags().GetString("tradfri.id", gopi.FLAG_NS_DEFAULT),
+				Key:       app.Flags().GetString("tradfri.key", gopi.FLAG_NS_DEFAULT),
+				Path:      app.Flags().GetString("tradfri.state", gopi.FLAG_NS_DEFAULT),
+				Timeout:   app.Flags().GetDuration("tradfri.timeout", gopi.FLAG_NS_DEFAULT),
+				Keepalive: app.Flags().GetDuration("tradfri.keepalive", gopi.FLAG_NS_DEFAULT),
 			}, app.Log().Clone(gateway.Tradfri{}.Name()))
 		},
 	})
@@ -8,40 +8,381 @@
 package node
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
 	mutablehome "github.com/djthorpe/mutablehome"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 // TYPES
 
+// device represents either a tradfri device or a tradfri group, and
+// implements mutablehome.PowerTrait, mutablehome.LightTrait,
+// mutablehome.CoverTrait and mutablehome.BatteryTrait
 type device struct {
-	id   uint
-	seen bool
+	sync.Mutex
+
+	id      uint
+	seen    bool
+	gateway mutablehome.TradfriGateway
+	device  mutablehome.TradfriDevice
+	group   mutablehome.TradfriGroup
+	cancel  context.CancelFunc
+	observe func(context.Context, uint) error
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	BRIGHTNESS_MIN = 0x01
+	BRIGHTNESS_MAX = 0xFE
+	POSITION_MAX   = 100
+)
+
 ////////////////////////////////////////////////////////////////////////////////
 // NEW
 
-func NewDevice(id uint) *device {
+func NewDevice(gateway mutablehome.TradfriGateway, value mutablehome.TradfriDevice) *device {
+	this := new(device)
+	this.id = value.Id()
+	this.gateway = gateway
+	this.device = value
+	this.seen = true
+	return this
+}
+
+func NewGroup(gateway mutablehome.TradfriGateway, value mutablehome.TradfriGroup) *device {
 	this := new(device)
-	this.id = id
+	this.id = value.Id()
+	this.gateway = gateway
+	this.group = value
+	this.seen = true
 	return this
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// IMPLEMENTATION
+// IMPLEMENTATION mutablehome.Device
 
 func (this *device) Id() string {
 	return fmt.Sprint(this.id)
 }
 
 func (this *device) Name() string {
-	return "TODO"
+	device, group := this.get()
+	if device != nil {
+		return device.Name()
+	} else if group != nil {
+		return group.Name()
+	} else {
+		return ""
+	}
 }
 
 func (this *device) Traits() []mutablehome.TraitType {
 	caps := make([]mutablehome.TraitType, 0)
+	device, group := this.get()
+	power := []mutablehome.TraitType{
+		mutablehome.TRAIT_POWER_ON,
+		mutablehome.TRAIT_POWER_OFF,
+		mutablehome.TRAIT_POWER_TOGGLE,
+	}
+
+	// Groups can be switched and dimmed
+	if group != nil {
+		caps = append(caps, power...)
+		caps = append(caps, mutablehome.TRAIT_LIGHT_BRIGHTNESS, mutablehome.TRAIT_LIGHT_TRANSITION)
+		return caps
+	} else if device == nil {
+		return caps
+	}
+
+	// Plugs can be switched, lights can be switched and dimmed and
+	// some lights can have temperature and color set
+	if len(device.Plugs()) > 0 {
+		caps = append(caps, power...)
+	} else if lights := device.Lights(); len(lights) > 0 {
+		caps = append(caps, power...)
+		caps = append(caps, mutablehome.TRAIT_LIGHT_BRIGHTNESS)
+		if lights[0].HasTemperature() {
+			caps = append(caps, mutablehome.TRAIT_LIGHT_TEMPERATURE)
+		}
+		if lights[0].HasColor() {
+			caps = append(caps, mutablehome.TRAIT_LIGHT_COLOR)
+		}
+		caps = append(caps, mutablehome.TRAIT_LIGHT_TRANSITION)
+	} else if len(device.Blinds()) > 0 {
+		caps = append(caps, mutablehome.TRAIT_COVER_POSITION)
+	}
+
+	// Battery powered devices report battery level, and remotes
+	// and sensors report activity
+	if device.HasBattery() {
+		caps = append(caps, mutablehome.TRAIT_BATTERY_LEVEL)
+	}
+	switch device.Type() {
+	case mutablehome.IKEA_DEVICE_TYPE_REMOTE, mutablehome.IKEA_DEVICE_TYPE_SLAVE_REMOTE, mutablehome.IKEA_DEVICE_TYPE_MOTIONSENSOR:
+		caps = append(caps, mutablehome.TRAIT_SENSOR_ACTIVITY)
+	}
+
+	// Return capabilities
 	return caps
 }
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.PowerTrait
+
+func (this *device) Power() mutablehome.TraitType {
+	device, group := this.get()
+	if group != nil {
+		return powerTrait(group.Power())
+	} else if device == nil {
+		return mutablehome.TRAIT_NONE
+	}
+	for _, plug := range device.Plugs() {
+		if plug.Power() {
+			return mutablehome.TRAIT_POWER_ON
+		}
+	}
+	for _, light := range device.Lights() {
+		if light.Power() {
+			return mutablehome.TRAIT_POWER_ON
+		}
+	}
+	if len(device.Plugs()) > 0 || len(device.Lights()) > 0 {
+		return mutablehome.TRAIT_POWER_OFF
+	} else {
+		return mutablehome.TRAIT_NONE
+	}
+}
+
+func (this *device) SetPower(state mutablehome.TraitType) error {
+	var value bool
+	switch state {
+	case mutablehome.TRAIT_POWER_ON:
+		value = true
+	case mutablehome.TRAIT_POWER_OFF:
+		value = false
+	case mutablehome.TRAIT_POWER_TOGGLE:
+		switch this.Power() {
+		case mutablehome.TRAIT_POWER_ON:
+			value = false
+		case mutablehome.TRAIT_POWER_OFF:
+			value = true
+		default:
+			return gopi.ErrNotImplemented.WithPrefix("SetPower")
+		}
+	default:
+		return gopi.ErrBadParameter.WithPrefix("SetPower")
+	}
+
+	device, group := this.get()
+	if group != nil {
+		return this.gateway.Send(group.SetPower(value))
+	} else if device == nil {
+		return gopi.ErrNotImplemented.WithPrefix("SetPower")
+	}
+	commands := make([]mutablehome.TradfriCommand, 0)
+	for _, plug := range device.Plugs() {
+		commands = append(commands, plug.SetPower(value))
+	}
+	for _, light := range device.Lights() {
+		commands = append(commands, light.SetPower(value))
+	}
+	if len(commands) == 0 {
+		return gopi.ErrNotImplemented.WithPrefix("SetPower")
+	} else {
+		return this.gateway.Send(commands...)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.LightTrait
+
+func (this *device) Brightness() float32 {
+	device, group := this.get()
+	if group != nil {
+		return brightnessToFloat(group.Brightness())
+	} else if device == nil {
+		return 0
+	} else if lights := device.Lights(); len(lights) == 0 {
+		return 0
+	} else {
+		return brightnessToFloat(lights[0].Brightness())
+	}
+}
+
+func (this *device) SetBrightness(value float32, transition time.Duration) error {
+	if value < 0 || value > 1 {
+		return gopi.ErrBadParameter.WithPrefix("SetBrightness")
+	}
+	level := floatToBrightness(value)
+	device, group := this.get()
+	if group != nil {
+		return this.gateway.Send(group.SetBrightness(level, transition))
+	} else if device == nil {
+		return gopi.ErrNotImplemented.WithPrefix("SetBrightness")
+	}
+	commands := make([]mutablehome.TradfriCommand, 0)
+	for _, light := range device.Lights() {
+		commands = append(commands, light.SetBrightness(level, transition))
+	}
+	if len(commands) == 0 {
+		return gopi.ErrNotImplemented.WithPrefix("SetBrightness")
+	} else {
+		return this.gateway.Send(commands...)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.CoverTrait
+
+func (this *device) Position() float32 {
+	if device, _ := this.get(); device == nil {
+		return 0
+	} else if blinds := device.Blinds(); len(blinds) == 0 {
+		return 0
+	} else {
+		return positionToFloat(blinds[0].Position())
+	}
+}
+
+func (this *device) SetPosition(value float32) error {
+	if value < 0 || value > 1 {
+		return gopi.ErrBadParameter.WithPrefix("SetPosition")
+	}
+	return this.sendBlinds(func(blind mutablehome.TradfriBlind) mutablehome.TradfriCommand {
+		return blind.SetPosition(floatToPosition(value))
+	})
+}
+
+func (this *device) Stop() error {
+	return this.sendBlinds(func(blind mutablehome.TradfriBlind) mutablehome.TradfriCommand {
+		return blind.Stop()
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// IMPLEMENTATION mutablehome.BatteryTrait
+
+func (this *device) BatteryLevel() float32 {
+	if device, _ := this.get(); device == nil || device.HasBattery() == false {
+		return 0
+	} else {
+		return float32(device.BatteryLevel()) / 100
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *device) String() string {
+	device, group := this.get()
+	str := "<tradfri.NodeDevice id=" + strconv.Quote(this.Id())
+	if device != nil {
+		str += " device=" + fmt.Sprint(device)
+	}
+	if group != nil {
+		str += " group=" + fmt.Sprint(group)
+	}
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (this *device) get() (mutablehome.TradfriDevice, mutablehome.TradfriGroup) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.device, this.group
+}
+
+func (this *device) setDevice(value mutablehome.TradfriDevice) mutablehome.TradfriDevice {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	prev := this.device
+	this.device = value
+	return prev
+}
+
+func (this *device) setGroup(value mutablehome.TradfriGroup) mutablehome.TradfriGroup {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	prev := this.group
+	this.group = value
+	return prev
+}
+
+func (this *device) sendBlinds(fn func(mutablehome.TradfriBlind) mutablehome.TradfriCommand) error {
+	device, _ := this.get()
+	if device == nil {
+		return gopi.ErrNotImplemented.WithPrefix("Cover")
+	}
+	commands := make([]mutablehome.TradfriCommand, 0)
+	for _, blind := range device.Blinds() {
+		commands = append(commands, fn(blind))
+	}
+	if len(commands) == 0 {
+		return gopi.ErrNotImplemented.WithPrefix("Cover")
+	} else {
+		return this.gateway.Send(commands...)
+	}
+}
+
+func powerTrait(value bool) mutablehome.TraitType {
+	if value {
+		return mutablehome.TRAIT_POWER_ON
+	} else {
+		return mutablehome.TRAIT_POWER_OFF
+	}
+}
+
+// brightnessToFloat normalises brightness from 0x01-0xFE to 0.0-1.0
+func brightnessToFloat(value uint8) float32 {
+	if value <= BRIGHTNESS_MIN {
+		return 0
+	} else if value >= BRIGHTNESS_MAX {
+		return 1
+	} else {
+		return float32(value-BRIGHTNESS_MIN) / float32(BRIGHTNESS_MAX-BRIGHTNESS_MIN)
+	}
+}
+
+// floatToBrightness converts brightness from 0.0-1.0 to 0x01-0xFE
+func floatToBrightness(value float32) uint8 {
+	if value <= 0 {
+		return BRIGHTNESS_MIN
+	} else if value >= 1 {
+		return BRIGHTNESS_MAX
+	} else {
+		return BRIGHTNESS_MIN + uint8(value*float32(BRIGHTNESS_MAX-BRIGHTNESS_MIN)+0.5)
+	}
+}
+
+// positionToFloat converts blind position from 0 (open) to 100 (closed)
+// into 0.0 (closed) to 1.0 (open)
+func positionToFloat(value uint8) float32 {
+	if value >= POSITION_MAX {
+		return 0
+	} else {
+		return float32(POSITION_MAX-value) / float32(POSITION_MAX)
+	}
+}
+
+// floatToPosition converts 0.0 (closed) to 1.0 (open) into blind
+// position from 0 (open) to 100 (closed)
+func floatToPosition(value float32) uint8 {
+	if value <= 0 {
+		return POSITION_MAX
+	} else if value >= 1 {
+		return 0
+	} else {
+		return POSITION_MAX - uint8(value*float32(POSITION_MAX)+0.5)
+	}
+}
@@ -22,17 +22,18 @@ type event struct {
 	Type_   mutablehome.EventType
 	Source_ mutablehome.Node
 	Device_ mutablehome.Device
+	Traits_ []mutablehome.TraitType
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // NEW
 
 func (this *node) NewGatewayEvent(t mutablehome.EventType) mutablehome.Event {
-	return &event{t, this, nil}
+	return &event{t, this, nil, nil}
 }
 
-func (this *node) NewDeviceEvent(t mutablehome.EventType, d mutablehome.Device) mutablehome.Event {
-	return &event{t, this, d}
+func (this *node) NewDeviceEvent(t mutablehome.EventType, d mutablehome.Device, traits ...mutablehome.TraitType) mutablehome.Event {
+	return &event{t, this, d, traits}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -67,7 +68,7 @@ func (this *event) Device() mutablehome.Device {
 }
 
 func (this *event) Traits() []mutablehome.TraitType {
-	return nil
+	return this.Traits_
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -79,5 +80,8 @@ func (this *event) String() string {
 	if this.Device_ != nil {
 		str += " device=" + fmt.Sprint(this.Device_)
 	}
+	if len(this.Traits_) > 0 {
+		str += " traits=" + fmt.Sprint(this.Traits_)
+	}
 	return str + ">"
 }
@@ -8,7 +8,10 @@
 package node
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -28,27 +31,21 @@ type node struct {
 	sync.Mutex
 	sync.WaitGroup
 
-	gateway mutablehome.TradfriGateway
-	stop    chan struct{}
-	devices map[uint]*device
+	gateway   mutablehome.TradfriGateway
+	stop      chan struct{}
+	devices   map[uint]*device
+	connected bool
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // CONSTANTS
 
 const (
-	// Update devices, groups and scenes regularly
+	// Discover added and removed devices and groups regularly,
+	// changes to existing devices are observed
 	DELTA_INTERVAL = 15 * time.Second
 )
 
-/*
-
-type nodedevice struct {
-	gateway mutablehome.TradfriGateway
-	device  mutablehome.TradfriDevice
-}
-*/
-
 ////////////////////////////////////////////////////////////////////////////////
 // IMPLEMENTATION
 
@@ -69,12 +66,17 @@ func (this *node) Init(config Node) error {
 }
 
 func (this *node) Close() error {
+	// Close stop channel and wait for background processes to end
+	close(this.stop)
+	this.WaitGroup.Wait()
+
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	// Close stop channel and wait for background process to end
-	close(this.stop)
-	this.WaitGroup.Wait()
+	// Unsubscribe any listeners
+	if err := this.PubSub.Close(); err != nil {
+		return err
+	}
 
 	// Release resources
 	this.devices = nil
@@ -101,23 +103,32 @@ func (this *node) String() string {
 ////////////////////////////////////////////////////////////////////////////////
 // CONNECT AND DISCONNECT GATEWAY
 
+// Connect connects to the gateway and starts the background processes,
+// which run until the node is closed. It can only be called once
 func (this *node) Connect(service gopi.RPCServiceRecord, flags gopi.RPCFlag) error {
 	this.Mutex.Lock()
-	defer this.Mutex.Unlock()
-
-	if err := this.gateway.Connect(service, flags); err != nil {
+	if this.connected {
+		this.Mutex.Unlock()
+		return gopi.ErrOutOfOrder.WithPrefix("Connect")
+	} else if err := this.gateway.Connect(service, flags); err != nil {
+		this.Mutex.Unlock()
 		return err
 	} else {
+		this.connected = true
+		this.WaitGroup.Add(2)
+		go this.EventProcess(this.stop)
 		go this.BackgroundProcess(this.stop)
 	}
+	this.Mutex.Unlock()
+
+	// Emit the event without holding the lock
 	this.Emit(this.NewGatewayEvent(mutablehome.EVENT_NODE_ONLINE))
 	return nil
 }
 
 func (this *node) Disconnect() error {
-	this.Mutex.Lock()
-	defer this.Mutex.Unlock()
-
+	// The lock is not held, since the gateway waits for events
+	// to be processed before disconnecting
 	if err := this.gateway.Disconnect(); err != nil {
 		return err
 	}
@@ -154,11 +165,26 @@ func (this *node) Device(key string) mutablehome.Device {
 	}
 }
 
+func (this *node) Devices() []mutablehome.Device {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	devices := make([]mutablehome.Device, 0, len(this.devices))
+	for _, device := range this.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Id() < devices[j].Id()
+	})
+	return devices
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // BACKGROUND PROCESS
 
+// BackgroundProcess regularly discovers devices and groups which have
+// been added or removed from the gateway, and observes their changes
 func (this *node) BackgroundProcess(stop <-chan struct{}) {
-	this.WaitGroup.Add(1)
 	defer this.WaitGroup.Done()
 
 	this.Log.Debug("Start of background process")
@@ -176,97 +202,308 @@ FOR_LOOP:
 			break FOR_LOOP
 		}
 	}
+
+	// Cancel observations
+	this.Mutex.Lock()
+	for _, device := range this.devices {
+		if device.cancel != nil {
+			device.cancel()
+		}
+	}
+	this.Mutex.Unlock()
+
 	this.Log.Debug("End of background process")
 }
 
+// EventProcess receives devices and groups emitted by the gateway
+// and emits node events when they have changed
+func (this *node) EventProcess(stop <-chan struct{}) {
+	defer this.WaitGroup.Done()
+
+	evts := this.gateway.Subscribe()
+FOR_LOOP:
+	for {
+		select {
+		case value := <-evts:
+			for _, evt := range this.ProcessValue(value) {
+				this.Emit(evt)
+			}
+		case <-stop:
+			// Drain any pending values until unsubscribed
+			go this.gateway.Unsubscribe(evts)
+			for range evts {
+			}
+			break FOR_LOOP
+		}
+	}
+}
+
 func (this *node) BackgroundDiscoverDevices() error {
+	devices, err := this.gateway.Devices()
+	if err != nil {
+		return fmt.Errorf("DiscoverDevices: %w", err)
+	}
+	groups, err := this.gateway.Groups()
+	if err != nil {
+		return fmt.Errorf("DiscoverGroups: %w", err)
+	}
+
+	// Mark all devices as unseen
+	this.Mutex.Lock()
+	for _, device := range this.devices {
+		device.seen = false
+	}
+	this.Mutex.Unlock()
+
+	// Add devices and groups
+	evts := make([]mutablehome.Event, 0)
+	for _, id := range devices {
+		if this.markSeen(id) {
+			continue
+		} else if device, err := this.gateway.Device(id); err != nil {
+			this.Log.Warn("Device", id, err)
+		} else {
+			evts = append(evts, this.addDevice(NewDevice(this.gateway, device), this.gateway.ObserveDevice))
+		}
+	}
+	for _, id := range groups {
+		if this.markSeen(id) {
+			continue
+		} else if group, err := this.gateway.Group(id); err != nil {
+			this.Log.Warn("Group", id, err)
+		} else {
+			evts = append(evts, this.addDevice(NewGroup(this.gateway, group), this.gateway.ObserveGroup))
+		}
+	}
+
+	// Remove devices which have not been seen
+	this.Mutex.Lock()
+	for id, device := range this.devices {
+		if device.seen == false {
+			if device.cancel != nil {
+				device.cancel()
+			}
+			delete(this.devices, id)
+			evts = append(evts, this.NewDeviceEvent(mutablehome.EVENT_DEVICE_REMOVED, device))
+		}
+	}
+	this.Mutex.Unlock()
+
+	// Emit events
+	for _, evt := range evts {
+		this.Emit(evt)
+	}
+
+	// Return success
+	return nil
+}
+
+// ProcessValue compares an emitted device or group with the existing
+// state and returns events which should be emitted
+func (this *node) ProcessValue(value interface{}) []mutablehome.Event {
 	this.Mutex.Lock()
 	defer this.Mutex.Unlock()
 
-	if devices, err := this.gateway.Devices(); err != nil {
-		return fmt.Errorf("DiscoverDevices: %w", err)
-	} else {
-		for _, device := range this.devices {
-			device.seen = false
+	switch other := value.(type) {
+	case mutablehome.TradfriDevice:
+		device, exists := this.devices[other.Id()]
+		if exists == false {
+			return nil
+		} else if prev, _ := device.get(); prev == nil || prev.Equals(other) {
+			return nil
+		} else {
+			evts := make([]mutablehome.Event, 0, 2)
+			device.setDevice(other)
+			if metadataChanged(prev, other) {
+				evts = append(evts, this.NewDeviceEvent(mutablehome.EVENT_DEVICE_METADATA_CHANGED, device))
+			}
+			if traits := deviceTraitsChanged(prev, other); len(traits) > 0 {
+				evts = append(evts, this.NewDeviceEvent(mutablehome.EVENT_DEVICE_TRAIT_CHANGED, device, traits...))
+			} else if len(evts) == 0 {
+				evts = append(evts, this.NewDeviceEvent(mutablehome.EVENT_DEVICE_METADATA_CHANGED, device))
+			}
+			return evts
 		}
-		for _, id := range devices {
-			if device, exists := this.devices[id]; exists {
-				device.seen = true
+	case mutablehome.TradfriGroup:
+		group, exists := this.devices[other.Id()]
+		if exists == false {
+			return nil
+		} else if _, prev := group.get(); prev == nil || prev.Equals(other) {
+			return nil
+		} else {
+			group.setGroup(other)
+			if traits := groupTraitsChanged(prev, other); len(traits) > 0 {
+				return []mutablehome.Event{this.NewDeviceEvent(mutablehome.EVENT_DEVICE_TRAIT_CHANGED, group, traits...)}
 			} else {
-				fmt.Println("TODO: New Device", id)
+				return []mutablehome.Event{this.NewDeviceEvent(mutablehome.EVENT_DEVICE_METADATA_CHANGED, group)}
 			}
 		}
-		for _, device := range this.devices {
-			if device.seen == false {
-				fmt.Println("TODO: Remove Device", device.id)
+	case mutablehome.TradfriEventType:
+		switch other {
+		case mutablehome.IKEA_EVENT_GATEWAY_DISCONNECTED:
+			return []mutablehome.Event{this.NewGatewayEvent(mutablehome.EVENT_NODE_OFFLINE)}
+		case mutablehome.IKEA_EVENT_GATEWAY_CONNECTED:
+			// Observations are lost with the connection, so restart them
+			for _, device := range this.devices {
+				this.observeDevice(device)
 			}
+			return []mutablehome.Event{this.NewGatewayEvent(mutablehome.EVENT_NODE_ONLINE)}
+		default:
+			return nil
 		}
+	default:
+		return nil
 	}
+}
 
-	// Return success
-	return nil
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// markSeen returns true and marks a device as seen if it already exists
+func (this *node) markSeen(id uint) bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if device, exists := this.devices[id]; exists {
+		device.seen = true
+		return true
+	} else {
+		return false
+	}
 }
 
-/*
+// addDevice adds a device and starts observing it in the background,
+// and returns the event which should be emitted
+func (this *node) addDevice(device *device, observe func(context.Context, uint) error) mutablehome.Event {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	device.observe = observe
+	this.devices[device.id] = device
+	this.observeDevice(device)
+
+	return this.NewDeviceEvent(mutablehome.EVENT_DEVICE_ADDED, device)
+}
 
-func (this *nodedevice) Power() mutablehome.TraitType {
-	// If not a light, then return unknown
-	if this.device.Type() != mutablehome.IKEA_DEVICE_TYPE_LIGHT {
-		return mutablehome.TRAIT_NONE
+// observeDevice cancels any existing observation and observes a
+// device in the background. The lock should be held by the caller
+func (this *node) observeDevice(device *device) {
+	if device.cancel != nil {
+		device.cancel()
 	}
-	// If no lights, then return unknown
-	if len(this.device.Lights()) == 0 {
-		return mutablehome.TRAIT_NONE
+	ctx, cancel := context.WithCancel(context.Background())
+	device.cancel = cancel
+
+	this.WaitGroup.Add(1)
+	go func(observe func(context.Context, uint) error) {
+		defer this.WaitGroup.Done()
+		if err := observe(ctx, device.id); err != nil && errors.Is(err, context.Canceled) == false {
+			this.Log.Error(fmt.Errorf("Observe %v: %w", device.id, err))
+		}
+	}(device.observe)
+}
+
+// metadataChanged returns true if name, type or reachability changed
+func metadataChanged(a, b mutablehome.TradfriDevice) bool {
+	if a.Name() != b.Name() {
+		return true
 	}
-	// Take first light value
-	if light := this.device.Lights()[0]; light.Power() == true {
-		return mutablehome.TRAIT_POWER_ON
-	} else {
-		return mutablehome.TRAIT_POWER_OFF
+	if a.Type() != b.Type() {
+		return true
+	}
+	if a.Active() != b.Active() {
+		return true
+	}
+	if len(a.Lights()) != len(b.Lights()) {
+		return true
 	}
+	return false
 }
 
-func (this *nodedevice) SetPower(state mutablehome.TraitType) error {
-	// If not a light, then return error
-	if this.device.Type() != mutablehome.IKEA_DEVICE_TYPE_LIGHT {
-		return gopi.ErrNotImplemented.WithPrefix("Power")
-	}
-	// If no lights, then return error
-	if len(this.device.Lights()) == 0 {
-		return gopi.ErrNotImplemented.WithPrefix("Power")
-	}
-	// Set power value for all lights
-	for _, light := range this.device.Lights() {
-		switch state {
-		case mutablehome.TRAIT_POWER_ON:
-			return this.gateway.Send(light.SetPower(true))
-		case mutablehome.TRAIT_POWER_OFF:
-			return this.gateway.Send(light.SetPower(false))
-		default:
-			return gopi.ErrBadParameter.WithPrefix("Power")
+// deviceTraitsChanged returns the traits which differ between two devices
+func deviceTraitsChanged(a, b mutablehome.TradfriDevice) []mutablehome.TraitType {
+	traits := traitsChanged(a.Lights(), b.Lights())
+	traits = append(traits, plugTraitsChanged(a.Plugs(), b.Plugs())...)
+	traits = append(traits, blindTraitsChanged(a.Blinds(), b.Blinds())...)
+	if b.HasBattery() && a.BatteryLevel() != b.BatteryLevel() {
+		traits = append(traits, mutablehome.TRAIT_BATTERY_LEVEL)
+	}
+	switch b.Type() {
+	case mutablehome.IKEA_DEVICE_TYPE_REMOTE, mutablehome.IKEA_DEVICE_TYPE_SLAVE_REMOTE, mutablehome.IKEA_DEVICE_TYPE_MOTIONSENSOR:
+		if a.Updated().Equal(b.Updated()) == false {
+			traits = append(traits, mutablehome.TRAIT_SENSOR_ACTIVITY)
+		}
+	}
+	return traits
+}
+
+// blindTraitsChanged returns the traits which differ between two sets of blinds
+func blindTraitsChanged(a, b []mutablehome.TradfriBlind) []mutablehome.TraitType {
+	if len(a) != len(b) {
+		return nil
+	}
+	for i := range a {
+		if a[i].Position() != b[i].Position() {
+			return []mutablehome.TraitType{mutablehome.TRAIT_COVER_POSITION}
 		}
 	}
-	// Return success
 	return nil
 }
 
-////////////////////////////////////////////////////////////////////////////////
-// EVENT HANDLER
-
-func (this *node) EventHandlerFunc(_ context.Context, _ gopi.App, evt gopi.Event) {
-	evt_ := evt.(mutablehome.IkeaEvent)
-	device_ := &nodedevice{evt.Source().(mutablehome.Ikea), evt_.Device()}
-	switch evt_.Type() {
-	case mutablehome.IKEA_EVENT_GATEWAY_CONNECTED:
-		this.Emit(this.NewEvent(mutablehome.EVENT_NODE_ONLINE, nil))
-	case mutablehome.IKEA_EVENT_GATEWAY_DISCONNECTED:
-		this.Emit(this.NewEvent(mutablehome.EVENT_NODE_OFFLINE, nil))
-	case mutablehome.IKEA_EVENT_DEVICE_ADDED:
-		this.Emit(this.NewEvent(mutablehome.EVENT_DEVICE_ADDED, device_))
-	case mutablehome.IKEA_EVENT_DEVICE_CHANGED:
-		this.Emit(this.NewEvent(mutablehome.EVENT_DEVICE_METADATA_CHANGED, device_))
-	default:
-		this.Log.Warn("Ignoring:", evt_)
+// plugTraitsChanged returns the traits which differ between two sets of plugs
+func plugTraitsChanged(a, b []mutablehome.TradfriPlug) []mutablehome.TraitType {
+	if len(a) != len(b) {
+		return nil
 	}
+	for i := range a {
+		if a[i].Power() != b[i].Power() {
+			return []mutablehome.TraitType{powerTrait(b[i].Power())}
+		}
+	}
+	return nil
+}
+
+// groupTraitsChanged returns the traits which differ between two groups
+func groupTraitsChanged(a, b mutablehome.TradfriGroup) []mutablehome.TraitType {
+	traits := make([]mutablehome.TraitType, 0)
+	if a.Power() != b.Power() {
+		traits = append(traits, powerTrait(b.Power()))
+	}
+	if a.Brightness() != b.Brightness() {
+		traits = append(traits, mutablehome.TRAIT_LIGHT_BRIGHTNESS)
+	}
+	return traits
+}
+
+// traitsChanged returns the traits which differ between two sets of lights
+func traitsChanged(a, b []mutablehome.TradfriLight) []mutablehome.TraitType {
+	traits := make([]mutablehome.TraitType, 0)
+	if len(a) != len(b) {
+		return traits
+	}
+	add := func(trait mutablehome.TraitType) {
+		for _, other := range traits {
+			if other == trait {
+				return
+			}
+		}
+		traits = append(traits, trait)
+	}
+	for i := range a {
+		if a[i].Power() != b[i].Power() {
+			add(powerTrait(b[i].Power()))
+		}
+		if a[i].Brightness() != b[i].Brightness() {
+			add(mutablehome.TRAIT_LIGHT_BRIGHTNESS)
+		}
+		if a[i].Temperature() != b[i].Temperature() {
+			add(mutablehome.TRAIT_LIGHT_TEMPERATURE)
+		}
+		ax, ay := a[i].ColorXY()
+		bx, by := b[i].ColorXY()
+		if ax != bx || ay != by || a[i].ColorHex() != b[i].ColorHex() {
+			add(mutablehome.TRAIT_LIGHT_COLOR)
+		}
+	}
+	return traits
 }
-*/
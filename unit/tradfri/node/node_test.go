@@ -0,0 +1,92 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	// Modules
+	mutablehome "github.com/djthorpe/mutablehome"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+type light struct {
+	power      bool
+	brightness uint8
+	x, y       uint16
+}
+
+func (this light) Power() bool                                                    { return this.power }
+func (this light) Brightness() uint8                                              { return this.brightness }
+func (this light) ColorHex() string                                               { return "" }
+func (this light) ColorXY() (uint16, uint16)                                      { return this.x, this.y }
+func (this light) Temperature() uint16                                            { return 0 }
+func (this light) HasTemperature() bool                                           { return false }
+func (this light) HasColor() bool                                                 { return false }
+func (light) SetPower(bool) mutablehome.TradfriCommand                            { return nil }
+func (light) SetBrightness(uint8, time.Duration) mutablehome.TradfriCommand       { return nil }
+func (light) SetColorXY(uint16, uint16, time.Duration) mutablehome.TradfriCommand { return nil }
+func (light) SetTemperature(uint16, time.Duration) mutablehome.TradfriCommand     { return nil }
+func (light) SetColorHex(string, time.Duration) mutablehome.TradfriCommand        { return nil }
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Test_Node_000(t *testing.T) {
+	t.Log("Test_Node_000")
+}
+
+func Test_Node_001(t *testing.T) {
+	a := []mutablehome.TradfriLight{light{power: false, brightness: 10}}
+	b := []mutablehome.TradfriLight{light{power: true, brightness: 10}}
+	if traits := traitsChanged(a, a); len(traits) != 0 {
+		t.Error("Unexpected traits", traits)
+	}
+	if traits := traitsChanged(a, b); len(traits) != 1 || traits[0] != mutablehome.TRAIT_POWER_ON {
+		t.Error("Unexpected traits", traits)
+	}
+	if traits := traitsChanged(b, a); len(traits) != 1 || traits[0] != mutablehome.TRAIT_POWER_OFF {
+		t.Error("Unexpected traits", traits)
+	}
+}
+
+func Test_Node_002(t *testing.T) {
+	a := []mutablehome.TradfriLight{light{brightness: 10}, light{brightness: 10}}
+	b := []mutablehome.TradfriLight{light{brightness: 20, x: 1}, light{brightness: 30}}
+	if traits := traitsChanged(a, b); len(traits) != 2 {
+		t.Error("Unexpected traits", traits)
+	} else if traits[0] != mutablehome.TRAIT_LIGHT_BRIGHTNESS || traits[1] != mutablehome.TRAIT_LIGHT_COLOR {
+		t.Error("Unexpected traits", traits)
+	}
+	if traits := traitsChanged(a, b[0:1]); len(traits) != 0 {
+		t.Error("Unexpected traits", traits)
+	}
+}
+
+func Test_Node_003(t *testing.T) {
+	if brightnessToFloat(0x00) != 0 || brightnessToFloat(0x01) != 0 {
+		t.Error("Unexpected brightnessToFloat value")
+	}
+	if brightnessToFloat(0xFE) != 1 || brightnessToFloat(0xFF) != 1 {
+		t.Error("Unexpected brightnessToFloat value")
+	}
+	if floatToBrightness(0) != 0x01 || floatToBrightness(-1) != 0x01 {
+		t.Error("Unexpected floatToBrightness value")
+	}
+	if floatToBrightness(1) != 0xFE || floatToBrightness(2) != 0xFE {
+		t.Error("Unexpected floatToBrightness value")
+	}
+	for v := uint8(0x01); v <= 0xFE; v++ {
+		if floatToBrightness(brightnessToFloat(v)) != v {
+			t.Error("Unexpected round trip value for", v)
+		}
+	}
+}
+
+func Test_Node_004(t *testing.T) {
+	if positionToFloat(0) != 1 || positionToFloat(100) != 0 || positionToFloat(200) != 0 {
+		t.Error("Unexpected positionToFloat value")
+	}
+	if floatToPosition(0) != 100 || floatToPosition(1) != 0 || floatToPosition(0.25) != 75 {
+		t.Error("Unexpected floatToPosition value")
+	}
+}
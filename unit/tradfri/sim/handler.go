@@ -0,0 +1,455 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	// Modules
+	coap "github.com/go-ocf/go-coap"
+	"github.com/go-ocf/go-coap/codes"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type observer struct {
+	path   string
+	token  []byte
+	client *coap.ClientConn
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	ROOT_DEVICES = "15001"
+	ROOT_GROUPS  = "15004"
+	ROOT_MOODS   = "15005"
+	ROOT_GATEWAY = "15011"
+	ATTR_AUTH    = "9063"
+	ATTR_INFO    = "15012"
+	ATTR_REBOOT  = "9030"
+)
+
+const (
+	OBSERVE_REGISTER   = 0
+	OBSERVE_DEREGISTER = 1
+	NOTIFY_TIMEOUT     = time.Second
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// SERVE REQUESTS
+
+func (this *Gateway) serveCOAP(w coap.ResponseWriter, req *coap.Request) {
+	path := req.Msg.Path()
+	switch req.Msg.Code() {
+	case codes.GET:
+		this.serveGet(w, req, path)
+	case codes.PUT:
+		this.servePut(w, req, path)
+	case codes.POST:
+		this.servePost(w, req, path)
+	default:
+		writeResponse(w, codes.MethodNotAllowed, nil, nil)
+	}
+}
+
+func (this *Gateway) serveGet(w coap.ResponseWriter, req *coap.Request, path []string) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	value, code := this.get(path)
+	if code != codes.Content {
+		writeResponse(w, code, nil, nil)
+		return
+	}
+
+	// Register or deregister observers for devices and groups
+	var sequence *uint32
+	if option, ok := req.Msg.Option(coap.Observe).(uint32); ok && isObservable(path) {
+		key := "/" + strings.Join(path, "/")
+		switch option {
+		case OBSERVE_REGISTER:
+			this.observers[key] = append(this.observers[key], &observer{
+				path:   key,
+				token:  req.Msg.Token(),
+				client: req.Client,
+			})
+			this.sequence++
+			sequence = &this.sequence
+		case OBSERVE_DEREGISTER:
+			this.deregister(key, req.Msg.Token())
+		}
+	}
+
+	if data, err := json.Marshal(value); err != nil {
+		writeResponse(w, codes.InternalServerError, nil, nil)
+	} else {
+		writeResponse(w, codes.Content, data, sequence)
+	}
+}
+
+func (this *Gateway) servePut(w coap.ResponseWriter, req *coap.Request, path []string) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	body := make(object)
+	dec := json.NewDecoder(bytes.NewReader(req.Msg.Payload()))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		writeResponse(w, codes.BadRequest, nil, nil)
+		return
+	}
+
+	if len(path) != 2 {
+		writeResponse(w, codes.MethodNotAllowed, nil, nil)
+	} else if path[0] == ROOT_GATEWAY && path[1] == ATTR_INFO {
+		if seconds, ok := toUint(body[ATTR_COMMISSIONING_MODE]); ok {
+			this.pairing = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+		writeResponse(w, codes.Changed, nil, nil)
+	} else if id, err := strconv.ParseUint(path[1], 10, 32); err != nil {
+		writeResponse(w, codes.NotFound, nil, nil)
+	} else {
+		switch path[0] {
+		case ROOT_DEVICES:
+			if device, exists := this.devices[uint(id)]; exists == false {
+				writeResponse(w, codes.NotFound, nil, nil)
+			} else {
+				mergeDevice(device, body)
+				this.notify(pathForDevice(uint(id)), device)
+				writeResponse(w, codes.Changed, nil, nil)
+			}
+		case ROOT_GROUPS:
+			writeResponse(w, this.applyGroup(uint(id), body), nil, nil)
+		default:
+			writeResponse(w, codes.MethodNotAllowed, nil, nil)
+		}
+	}
+}
+
+func (this *Gateway) servePost(w coap.ResponseWriter, req *coap.Request, path []string) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// POST requests are the authentication exchange and reboot
+	if len(path) != 2 || path[0] != ROOT_GATEWAY {
+		writeResponse(w, codes.MethodNotAllowed, nil, nil)
+		return
+	} else if path[1] == ATTR_REBOOT {
+		this.reboots++
+		writeResponse(w, codes.Changed, nil, nil)
+		return
+	} else if path[1] != ATTR_AUTH {
+		writeResponse(w, codes.MethodNotAllowed, nil, nil)
+		return
+	}
+
+	var body struct {
+		Identity string `json:"9090"`
+	}
+	if err := json.Unmarshal(req.Msg.Payload(), &body); err != nil || body.Identity == "" {
+		writeResponse(w, codes.BadRequest, nil, nil)
+	} else if psk, err := generatePSK(); err != nil {
+		writeResponse(w, codes.InternalServerError, nil, nil)
+	} else if data, err := json.Marshal(object{ATTR_PSK: psk, ATTR_FIRMWARE: this.version}); err != nil {
+		writeResponse(w, codes.InternalServerError, nil, nil)
+	} else {
+		this.identities[body.Identity] = psk
+		writeResponse(w, codes.Created, data, nil)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// get returns the value for a path and a response code
+func (this *Gateway) get(path []string) (interface{}, codes.Code) {
+	if len(path) == 0 {
+		return nil, codes.NotFound
+	}
+	ids := make([]uint, 0, len(path))
+	for _, elem := range path[1:] {
+		if id, err := strconv.ParseUint(elem, 10, 32); err != nil {
+			return nil, codes.NotFound
+		} else {
+			ids = append(ids, uint(id))
+		}
+	}
+	switch {
+	case len(path) == 1 && path[0] == ROOT_DEVICES:
+		return sortedKeys(this.devices), codes.Content
+	case len(path) == 2 && path[0] == ROOT_DEVICES:
+		if device, exists := this.devices[ids[0]]; exists {
+			return device, codes.Content
+		}
+	case len(path) == 1 && path[0] == ROOT_GROUPS:
+		return sortedKeys(this.groups), codes.Content
+	case len(path) == 2 && path[0] == ROOT_GROUPS:
+		if group, exists := this.groups[ids[0]]; exists {
+			return group, codes.Content
+		}
+	case len(path) == 1 && path[0] == ROOT_MOODS:
+		groups := make(map[uint]object, len(this.scenes))
+		for group := range this.scenes {
+			groups[group] = nil
+		}
+		return sortedKeys(groups), codes.Content
+	case len(path) == 2 && path[0] == ROOT_MOODS:
+		if scenes, exists := this.scenes[ids[0]]; exists {
+			return sortedKeys(scenes), codes.Content
+		} else if _, exists := this.groups[ids[0]]; exists {
+			return []uint{}, codes.Content
+		}
+	case len(path) == 3 && path[0] == ROOT_MOODS:
+		if scene, exists := this.scenes[ids[0]][ids[1]]; exists {
+			return scene, codes.Content
+		}
+	case len(path) == 2 && path[0] == ROOT_GATEWAY && path[1] == ATTR_INFO:
+		return this.info(), codes.Content
+	}
+	return nil, codes.NotFound
+}
+
+// info returns the gateway information
+func (this *Gateway) info() object {
+	pairing := uint(0)
+	if remaining := time.Until(this.pairing); remaining > 0 {
+		pairing = uint(remaining.Seconds()) + 1
+	}
+	return object{
+		ATTR_GATEWAY_ID:         "sim" + strconv.FormatInt(this.created.UnixNano(), 16),
+		ATTR_FIRMWARE:           this.version,
+		ATTR_NTP:                DEFAULT_NTP,
+		ATTR_CURRENT_TIME:       time.Now().Unix(),
+		ATTR_FIRST_SETUP:        this.created.Unix(),
+		ATTR_COMMISSIONING_MODE: pairing,
+		ATTR_OTA_UPDATE_STATE:   0,
+		ATTR_UPDATE_PROGRESS:    0,
+	}
+}
+
+// applyGroup sets group state, activating a scene or propagating
+// power and brightness to member devices
+func (this *Gateway) applyGroup(id uint, body object) codes.Code {
+	group, exists := this.groups[id]
+	if exists == false {
+		return codes.NotFound
+	}
+
+	// Check scene exists before making any changes
+	var scene object
+	if mood, ok := toUint(body[ATTR_MOOD]); ok && mood != 0 {
+		if scene, exists = this.scenes[id][mood]; exists == false {
+			return codes.BadRequest
+		}
+	}
+
+	// Set group attributes and determine state for members
+	state := make(map[string]interface{})
+	for key, value := range body {
+		switch key {
+		case ATTR_TRANSITION_TIME:
+			continue
+		case ATTR_DEVICE_STATE, ATTR_LIGHT_DIMMER:
+			state[key] = value
+		}
+		group[key] = value
+	}
+
+	// Apply state to devices
+	changed := make(map[uint]bool)
+	if scene != nil {
+		lights, _ := scene[ATTR_LIGHT_SETTING].([]interface{})
+		for _, light := range lights {
+			if light, ok := light.(map[string]interface{}); ok {
+				if device, ok := toUint(light[ATTR_ID]); ok {
+					if this.applyState(device, light) {
+						changed[device] = true
+					}
+				}
+			}
+		}
+	} else if len(state) > 0 {
+		for _, device := range groupMembers(group) {
+			if this.applyState(device, state) {
+				changed[device] = true
+			}
+		}
+	}
+
+	// Notify observers
+	this.notify(pathForGroup(id), group)
+	for device := range changed {
+		this.notify(pathForDevice(device), this.devices[device])
+	}
+
+	// Return success
+	return codes.Changed
+}
+
+// applyState sets power and brightness on the lights and plugs
+// of a device, and returns true if the device exists
+func (this *Gateway) applyState(id uint, state map[string]interface{}) bool {
+	device, exists := this.devices[id]
+	if exists == false {
+		return false
+	}
+	if lights, ok := device[ATTR_LIGHT_CONTROL].([]interface{}); ok {
+		for _, light := range lights {
+			mergeState(light, state, ATTR_ID)
+		}
+	}
+	if plugs, ok := device[ATTR_SWITCH_PLUG].([]interface{}); ok && state[ATTR_DEVICE_STATE] != nil {
+		for _, plug := range plugs {
+			mergeState(plug, map[string]interface{}{ATTR_DEVICE_STATE: state[ATTR_DEVICE_STATE]}, ATTR_ID)
+		}
+	}
+	return true
+}
+
+// notify sends the value to any observers of a path, and removes
+// observers which can no longer be reached
+func (this *Gateway) notify(path string, value object) {
+	observers := this.observers[path]
+	if len(observers) == 0 {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	this.sequence++
+	for _, observer := range observers {
+		msg := observer.client.NewMessage(coap.MessageParams{
+			Type:      coap.NonConfirmable,
+			Code:      codes.Content,
+			MessageID: coap.GenerateMessageID(),
+			Token:     observer.token,
+		})
+		msg.SetOption(coap.ContentFormat, coap.AppJSON)
+		msg.SetObserve(this.sequence)
+		msg.SetPayload(data)
+		ctx, cancel := context.WithTimeout(context.Background(), NOTIFY_TIMEOUT)
+		if err := observer.client.WriteMsgWithContext(ctx, msg); err != nil {
+			this.deregister(path, observer.token)
+		}
+		cancel()
+	}
+}
+
+// deregister removes an observer of a path
+func (this *Gateway) deregister(path string, token []byte) {
+	observers := make([]*observer, 0, len(this.observers[path]))
+	for _, observer := range this.observers[path] {
+		if bytes.Equal(observer.token, token) == false {
+			observers = append(observers, observer)
+		}
+	}
+	if len(observers) == 0 {
+		delete(this.observers, path)
+	} else {
+		this.observers[path] = observers
+	}
+}
+
+// mergeDevice sets device attributes from a request body, where
+// light, plug and blind state is merged into existing state
+func mergeDevice(device, body object) {
+	for key, value := range body {
+		switch key {
+		case ATTR_LIGHT_CONTROL, ATTR_SWITCH_PLUG, ATTR_START_BLINDS:
+			states, _ := value.([]interface{})
+			existing, _ := device[key].([]interface{})
+			for i, state := range states {
+				if i < len(existing) {
+					if state, ok := state.(map[string]interface{}); ok {
+						mergeState(existing[i], state, ATTR_TRANSITION_TIME, ATTR_BLIND_TRIGGER)
+					}
+				}
+			}
+		default:
+			device[key] = value
+		}
+	}
+}
+
+// mergeState copies state into a decoded object, except for some keys
+func mergeState(dst interface{}, src map[string]interface{}, except ...string) {
+	obj, ok := dst.(map[string]interface{})
+	if ok == false {
+		return
+	}
+FOR_LOOP:
+	for key, value := range src {
+		for _, skip := range except {
+			if key == skip {
+				continue FOR_LOOP
+			}
+		}
+		obj[key] = value
+	}
+}
+
+// groupMembers returns the device identifiers for a group
+func groupMembers(group object) []uint {
+	members := []uint{}
+	if link, ok := group[ATTR_GROUP_MEMBERS].(map[string]interface{}); ok {
+		if devices, ok := link[ATTR_HS_LINK].(map[string]interface{}); ok {
+			if ids, ok := devices[ATTR_ID].([]interface{}); ok {
+				for _, id := range ids {
+					if id, ok := toUint(id); ok {
+						members = append(members, id)
+					}
+				}
+			}
+		}
+	}
+	return members
+}
+
+// isObservable returns true if a path refers to a device or group
+func isObservable(path []string) bool {
+	return len(path) == 2 && (path[0] == ROOT_DEVICES || path[0] == ROOT_GROUPS)
+}
+
+// writeResponse writes a response with an optional JSON payload
+// and observe sequence
+func writeResponse(w coap.ResponseWriter, code codes.Code, payload []byte, sequence *uint32) {
+	resp := w.NewResponse(code)
+	if payload != nil {
+		resp.SetOption(coap.ContentFormat, coap.AppJSON)
+		resp.SetPayload(payload)
+	}
+	if sequence != nil {
+		resp.SetObserve(*sequence)
+	}
+	w.WriteMsg(resp)
+}
+
+// generatePSK returns a random pre-shared key
+func generatePSK() (string, error) {
+	psk := make([]byte, PSK_LENGTH)
+	max := big.NewInt(int64(len(PSK_CHARACTERSET)))
+	for i := range psk {
+		if n, err := rand.Int(rand.Reader, max); err != nil {
+			return "", err
+		} else {
+			psk[i] = PSK_CHARACTERSET[n.Int64()]
+		}
+	}
+	return string(psk), nil
+}
@@ -0,0 +1,390 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// object is a decoded JSON object, which retains the gateway's
+// numeric attribute keys
+type object map[string]interface{}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	ATTR_ID                 = "9003"
+	ATTR_NAME               = "9001"
+	ATTR_CREATED_AT         = "9002"
+	ATTR_DEVICE_INFO        = "3"
+	ATTR_APPLICATION        = "5750"
+	ATTR_REACHABLE_STATE    = "9019"
+	ATTR_LAST_SEEN          = "9020"
+	ATTR_LIGHT_CONTROL      = "3311"
+	ATTR_SWITCH_PLUG        = "3312"
+	ATTR_START_BLINDS       = "15015"
+	ATTR_DEVICE_STATE       = "5850"
+	ATTR_LIGHT_DIMMER       = "5851"
+	ATTR_LIGHT_MIREDS       = "5711"
+	ATTR_TRANSITION_TIME    = "5712"
+	ATTR_BLIND_POSITION     = "5536"
+	ATTR_BLIND_TRIGGER      = "5523"
+	ATTR_MOOD               = "9039"
+	ATTR_GROUP_MEMBERS      = "9018"
+	ATTR_HS_LINK            = "15002"
+	ATTR_LIGHT_SETTING      = "15013"
+	ATTR_SCENE_INDEX        = "9057"
+	ATTR_IDENTITY           = "9090"
+	ATTR_PSK                = "9091"
+	ATTR_FIRMWARE           = "9029"
+	ATTR_GATEWAY_ID         = "9081"
+	ATTR_NTP                = "9023"
+	ATTR_CURRENT_TIME       = "9059"
+	ATTR_FIRST_SETUP        = "9069"
+	ATTR_OTA_UPDATE_STATE   = "9054"
+	ATTR_UPDATE_PROGRESS    = "9055"
+	ATTR_COMMISSIONING_MODE = "9061"
+)
+
+const (
+	APPLICATION_REMOTE = 0
+	APPLICATION_LIGHT  = 2
+	APPLICATION_PLUG   = 3
+	APPLICATION_SENSOR = 4
+	APPLICATION_BLIND  = 7
+)
+
+const (
+	POWER_SOURCE_BATTERY = 3
+	POWER_SOURCE_MAINS   = 6
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// DEVICES
+
+// SetDevice adds or replaces a device from its JSON representation,
+// which must include an identifier, and notifies any observers
+func (this *Gateway) SetDevice(value string) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if obj, id, err := decodeObject(value); err != nil {
+		return err
+	} else {
+		this.devices[id] = obj
+		this.notify(pathForDevice(id), obj)
+	}
+
+	// Success
+	return nil
+}
+
+// RemoveDevice removes a device and returns false if it didn't exist
+func (this *Gateway) RemoveDevice(id uint) bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if _, exists := this.devices[id]; exists == false {
+		return false
+	} else {
+		delete(this.devices, id)
+		return true
+	}
+}
+
+// Device returns the JSON representation of a device
+func (this *Gateway) Device(id uint) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if obj, exists := this.devices[id]; exists == false {
+		return "", gopi.ErrNotFound.WithPrefix("device")
+	} else {
+		return encodeObject(obj)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// GROUPS
+
+// SetGroup adds or replaces a group from its JSON representation,
+// which must include an identifier, and notifies any observers
+func (this *Gateway) SetGroup(value string) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if obj, id, err := decodeObject(value); err != nil {
+		return err
+	} else {
+		this.groups[id] = obj
+		this.notify(pathForGroup(id), obj)
+	}
+
+	// Success
+	return nil
+}
+
+// RemoveGroup removes a group and its scenes, and returns false
+// if it didn't exist
+func (this *Gateway) RemoveGroup(id uint) bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if _, exists := this.groups[id]; exists == false {
+		return false
+	} else {
+		delete(this.groups, id)
+		delete(this.scenes, id)
+		return true
+	}
+}
+
+// Group returns the JSON representation of a group
+func (this *Gateway) Group(id uint) (string, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if obj, exists := this.groups[id]; exists == false {
+		return "", gopi.ErrNotFound.WithPrefix("group")
+	} else {
+		return encodeObject(obj)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SCENES
+
+// SetScene adds or replaces a scene for a group from its JSON
+// representation, which must include an identifier
+func (this *Gateway) SetScene(group uint, value string) error {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if _, exists := this.groups[group]; exists == false {
+		return gopi.ErrNotFound.WithPrefix("group")
+	} else if obj, id, err := decodeObject(value); err != nil {
+		return err
+	} else {
+		if _, exists := this.scenes[group]; exists == false {
+			this.scenes[group] = make(map[uint]object)
+		}
+		this.scenes[group][id] = obj
+	}
+
+	// Success
+	return nil
+}
+
+// RemoveScene removes a scene and returns false if it didn't exist
+func (this *Gateway) RemoveScene(group, id uint) bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if _, exists := this.scenes[group][id]; exists == false {
+		return false
+	} else {
+		delete(this.scenes[group], id)
+		return true
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// INVENTORY
+
+// Light returns the JSON representation of a dimmable white spectrum light
+func Light(id uint, name string, power bool, brightness uint8) string {
+	return encodeDevice(id, name, "TRADFRI bulb E27 WS opal 980lm", APPLICATION_LIGHT, POWER_SOURCE_MAINS, 0, object{
+		ATTR_LIGHT_CONTROL: []interface{}{
+			object{ATTR_ID: 0, ATTR_DEVICE_STATE: boolToUint(power), ATTR_LIGHT_DIMMER: brightness, ATTR_LIGHT_MIREDS: 370},
+		},
+	})
+}
+
+// Plug returns the JSON representation of a control outlet
+func Plug(id uint, name string, power bool) string {
+	return encodeDevice(id, name, "TRADFRI control outlet", APPLICATION_PLUG, POWER_SOURCE_MAINS, 0, object{
+		ATTR_SWITCH_PLUG: []interface{}{
+			object{ATTR_ID: 0, ATTR_DEVICE_STATE: boolToUint(power), ATTR_LIGHT_DIMMER: 0},
+		},
+	})
+}
+
+// Blind returns the JSON representation of a battery powered roller blind,
+// where position 0 is open and 100 is closed
+func Blind(id uint, name string, position, battery uint8) string {
+	return encodeDevice(id, name, "FYRTUR block-out roller blind", APPLICATION_BLIND, POWER_SOURCE_BATTERY, battery, object{
+		ATTR_START_BLINDS: []interface{}{
+			object{ATTR_ID: 0, ATTR_BLIND_POSITION: float32(position)},
+		},
+	})
+}
+
+// Remote returns the JSON representation of a battery powered remote control
+func Remote(id uint, name string, battery uint8) string {
+	return encodeDevice(id, name, "TRADFRI remote control", APPLICATION_REMOTE, POWER_SOURCE_BATTERY, battery, nil)
+}
+
+// Sensor returns the JSON representation of a battery powered motion sensor
+func Sensor(id uint, name string, battery uint8) string {
+	return encodeDevice(id, name, "TRADFRI motion sensor", APPLICATION_SENSOR, POWER_SOURCE_BATTERY, battery, nil)
+}
+
+// Group returns the JSON representation of a group with member devices
+func Group(id uint, name string, devices ...uint) string {
+	if devices == nil {
+		devices = []uint{}
+	}
+	return mustEncode(object{
+		ATTR_ID:           id,
+		ATTR_NAME:         name,
+		ATTR_CREATED_AT:   time.Now().Unix(),
+		ATTR_DEVICE_STATE: 0,
+		ATTR_LIGHT_DIMMER: 0,
+		ATTR_MOOD:         0,
+		ATTR_GROUP_MEMBERS: object{
+			ATTR_HS_LINK: object{ATTR_ID: devices},
+		},
+	})
+}
+
+// Scene returns the JSON representation of a scene which switches
+// on the given lights with a brightness
+func Scene(id uint, name string, brightness uint8, devices ...uint) string {
+	lights := make([]interface{}, 0, len(devices))
+	for _, device := range devices {
+		lights = append(lights, object{
+			ATTR_ID:           device,
+			ATTR_DEVICE_STATE: 1,
+			ATTR_LIGHT_DIMMER: brightness,
+		})
+	}
+	return mustEncode(object{
+		ATTR_ID:            id,
+		ATTR_NAME:          name,
+		ATTR_CREATED_AT:    time.Now().Unix(),
+		ATTR_SCENE_INDEX:   0,
+		ATTR_LIGHT_SETTING: lights,
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func encodeDevice(id uint, name, model string, application, source uint, battery uint8, attrs object) string {
+	info := object{
+		"0": "IKEA of Sweden",
+		"1": model,
+		"2": "",
+		"3": "2.3.050",
+		"6": source,
+	}
+	if source == POWER_SOURCE_BATTERY {
+		info["9"] = battery
+	}
+	device := object{
+		ATTR_ID:              id,
+		ATTR_NAME:            name,
+		ATTR_CREATED_AT:      time.Now().Unix(),
+		ATTR_DEVICE_INFO:     info,
+		ATTR_APPLICATION:     application,
+		ATTR_REACHABLE_STATE: 1,
+		ATTR_LAST_SEEN:       time.Now().Unix(),
+	}
+	for k, v := range attrs {
+		device[k] = v
+	}
+	return mustEncode(device)
+}
+
+func mustEncode(obj object) string {
+	if data, err := json.Marshal(obj); err != nil {
+		panic(err)
+	} else {
+		return string(data)
+	}
+}
+
+func encodeObject(obj object) (string, error) {
+	if data, err := json.Marshal(obj); err != nil {
+		return "", err
+	} else {
+		return string(data), nil
+	}
+}
+
+// decodeObject returns an object from JSON and the identifier
+func decodeObject(value string) (object, uint, error) {
+	obj := make(object)
+	dec := json.NewDecoder(bytes.NewReader([]byte(value)))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", gopi.ErrBadParameter, err)
+	} else if id, ok := toUint(obj[ATTR_ID]); ok == false {
+		return nil, 0, gopi.ErrBadParameter.WithPrefix("id")
+	} else {
+		return obj, id, nil
+	}
+}
+
+// sortedKeys returns object identifiers in ascending order
+func sortedKeys(objs map[uint]object) []uint {
+	keys := make([]uint, 0, len(objs))
+	for key := range objs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func toUint(value interface{}) (uint, bool) {
+	switch value := value.(type) {
+	case json.Number:
+		if v, err := strconv.ParseUint(value.String(), 10, 32); err == nil {
+			return uint(v), true
+		}
+	case float64:
+		if value >= 0 {
+			return uint(value), true
+		}
+	case uint:
+		return value, true
+	case int:
+		if value >= 0 {
+			return uint(value), true
+		}
+	}
+	return 0, false
+}
+
+func boolToUint(value bool) uint {
+	if value {
+		return 1
+	} else {
+		return 0
+	}
+}
+
+func pathForDevice(id uint) string {
+	return fmt.Sprintf("/%v/%v", ROOT_DEVICES, id)
+}
+
+func pathForGroup(id uint) string {
+	return fmt.Sprintf("/%v/%v", ROOT_GROUPS, id)
+}
@@ -0,0 +1,153 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+package sim
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	// Modules
+	coap "github.com/go-ocf/go-coap"
+	coapNet "github.com/go-ocf/go-coap/net"
+	dtls "github.com/pion/dtls/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// peer implements net.Conn for datagrams from one remote address. The
+// datagrams are demultiplexed here rather than with the pion listener,
+// which accepts one handshake at a time and can stall when a handshake
+// fails while other clients are connecting
+type peer struct {
+	sync.Once
+
+	gateway *Gateway
+	addr    net.Addr
+	packets chan []byte
+	done    chan struct{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// SESSIONS
+
+// readLoop receives datagrams and passes them to the session for the
+// remote address, creating a new session for new remote addresses
+func (this *Gateway) readLoop() {
+	defer this.WaitGroup.Done()
+
+	buf := make([]byte, RECEIVE_MTU)
+	for {
+		n, addr, err := this.socket.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if peer := this.peerForAddr(addr); peer != nil {
+			peer.deliver(append([]byte(nil), buf[:n]...))
+		}
+	}
+}
+
+// peerForAddr returns the session for a remote address, or nil if
+// the gateway has been closed
+func (this *Gateway) peerForAddr(addr net.Addr) *peer {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if this.peers == nil {
+		return nil
+	} else if existing, exists := this.peers[addr.String()]; exists {
+		return existing
+	} else {
+		peer := &peer{
+			gateway: this,
+			addr:    addr,
+			packets: make(chan []byte, RECEIVE_QUEUE),
+			done:    make(chan struct{}),
+		}
+		this.peers[addr.String()] = peer
+		this.WaitGroup.Add(1)
+		go this.serve(peer)
+		return peer
+	}
+}
+
+// serve performs the handshake with a client and then handles
+// requests until the session is closed
+func (this *Gateway) serve(peer *peer) {
+	defer this.WaitGroup.Done()
+	defer peer.Close()
+
+	// A failed handshake closes the session
+	if conn, err := dtls.Server(peer, this.config); err == nil {
+		defer conn.Close()
+		server := &coap.Server{
+			Net:     "udp-dtls",
+			Conn:    coapNet.NewConnDTLS(conn),
+			Handler: coap.HandlerFunc(this.serveCOAP),
+		}
+		server.ActivateAndServe()
+	}
+}
+
+func (this *Gateway) removePeer(peer *peer) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if this.peers != nil && this.peers[peer.addr.String()] == peer {
+		delete(this.peers, peer.addr.String())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// NET.CONN IMPLEMENTATION
+
+// deliver queues a datagram, dropping it when the queue is full
+func (this *peer) deliver(packet []byte) {
+	select {
+	case this.packets <- packet:
+	case <-this.done:
+	default:
+	}
+}
+
+func (this *peer) Read(b []byte) (int, error) {
+	select {
+	case packet := <-this.packets:
+		return copy(b, packet), nil
+	case <-this.done:
+		return 0, io.EOF
+	}
+}
+
+func (this *peer) Write(b []byte) (int, error) {
+	return this.gateway.socket.WriteTo(b, this.addr)
+}
+
+func (this *peer) Close() error {
+	this.Once.Do(func() {
+		close(this.done)
+		this.gateway.removePeer(this)
+	})
+	return nil
+}
+
+func (this *peer) LocalAddr() net.Addr {
+	return this.gateway.socket.LocalAddr()
+}
+
+func (this *peer) RemoteAddr() net.Addr {
+	return this.addr
+}
+
+// Deadlines are implemented by the go-coap connection
+func (this *peer) SetDeadline(time.Time) error      { return nil }
+func (this *peer) SetReadDeadline(time.Time) error  { return nil }
+func (this *peer) SetWriteDeadline(time.Time) error { return nil }
@@ -0,0 +1,248 @@
+/*
+	Mutablehome Automation: Ikea Tradfri
+	(c) Copyright David Thorpe 2020
+	All Rights Reserved
+	For Licensing and Usage information, please see LICENSE file
+*/
+
+// Package sim implements an in-process Tradfri gateway which speaks
+// CoAP over DTLS-PSK, so that the gateway, node and service can be
+// exercised without any IKEA hardware
+package sim
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	// Modules
+	gopi "github.com/djthorpe/gopi/v2"
+	dtls "github.com/pion/dtls/v2"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type Gateway struct {
+	sync.Mutex
+	sync.WaitGroup
+
+	key        string
+	version    string
+	config     *dtls.Config
+	socket     *net.UDPConn
+	peers      map[string]*peer
+	identities map[string]string
+	devices    map[uint]object
+	groups     map[uint]object
+	scenes     map[uint]map[uint]object
+	observers  map[string][]*observer
+	sequence   uint32
+	created    time.Time
+	pairing    time.Time
+	reboots    uint
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	IDENTITY_CLIENT  = "Client_identity"
+	DEFAULT_VERSION  = "1.10.36"
+	DEFAULT_NTP      = "pool.ntp.org"
+	DEFAULT_ADDR     = "127.0.0.1:0"
+	PSK_LENGTH       = 16
+	PSK_CHARACTERSET = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+const (
+	HANDSHAKE_TIMEOUT = 5 * time.Second
+	RECEIVE_MTU       = 8192
+	RECEIVE_QUEUE     = 16
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// NEW
+
+// New returns a gateway listening on the given address, which accepts
+// the security code key for the authentication exchange. When addr is
+// empty, the gateway listens on a random port on the loopback interface
+func New(addr, key string) (*Gateway, error) {
+	this := new(Gateway)
+	if key == "" {
+		return nil, gopi.ErrBadParameter.WithPrefix("key")
+	} else if addr == "" {
+		addr = DEFAULT_ADDR
+	}
+
+	this.key = key
+	this.version = DEFAULT_VERSION
+	this.created = time.Now()
+	this.peers = make(map[string]*peer)
+	this.identities = make(map[string]string)
+	this.devices = make(map[uint]object)
+	this.groups = make(map[uint]object)
+	this.scenes = make(map[uint]map[uint]object)
+	this.observers = make(map[string][]*observer)
+
+	this.config = &dtls.Config{
+		PSK:            this.psk,
+		CipherSuites:   []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		ConnectTimeout: dtls.ConnectTimeoutOption(HANDSHAKE_TIMEOUT),
+	}
+
+	// Create socket
+	if udpAddr, err := net.ResolveUDPAddr("udp", addr); err != nil {
+		return nil, err
+	} else if socket, err := net.ListenUDP("udp", udpAddr); err != nil {
+		return nil, err
+	} else {
+		this.socket = socket
+	}
+
+	// Receive datagrams in the background
+	this.WaitGroup.Add(1)
+	go this.readLoop()
+
+	// Success
+	return this, nil
+}
+
+// Close closes the socket and any client sessions, and releases
+// resources. The address can then be re-used
+func (this *Gateway) Close() error {
+	this.Mutex.Lock()
+	if this.peers == nil {
+		this.Mutex.Unlock()
+		return gopi.ErrOutOfOrder
+	}
+	peers := this.peers
+	this.peers = nil
+	this.Mutex.Unlock()
+
+	// Close socket and sessions, and wait for them to end
+	err := this.socket.Close()
+	for _, peer := range peers {
+		peer.Close()
+	}
+	this.WaitGroup.Wait()
+
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	// Release resources
+	this.identities = nil
+	this.devices = nil
+	this.groups = nil
+	this.scenes = nil
+	this.observers = nil
+
+	// Return any socket error
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PROPERTIES
+
+// Addr returns the address the gateway is listening on
+func (this *Gateway) Addr() *net.UDPAddr {
+	if addr, ok := this.socket.LocalAddr().(*net.UDPAddr); ok {
+		return addr
+	} else {
+		return nil
+	}
+}
+
+// Service returns a service record which can be used to connect
+// to the gateway, with the given client identity
+func (this *Gateway) Service(id string) gopi.RPCServiceRecord {
+	addr := this.Addr()
+	return gopi.RPCServiceRecord{
+		Name:  id,
+		Port:  uint16(addr.Port),
+		Addrs: []net.IP{addr.IP},
+	}
+}
+
+// Version returns the firmware version reported to clients
+func (this *Gateway) Version() string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.version
+}
+
+// SetVersion sets the firmware version reported to clients
+func (this *Gateway) SetVersion(version string) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	this.version = version
+}
+
+// Pairing returns true if pairing (commissioning) mode is enabled
+func (this *Gateway) Pairing() bool {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return time.Now().Before(this.pairing)
+}
+
+// Reboots returns the number of times clients have rebooted the gateway
+func (this *Gateway) Reboots() uint {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	return this.reboots
+}
+
+// Identities returns the client identities which have been issued
+// a pre-shared key
+func (this *Gateway) Identities() []string {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	identities := make([]string, 0, len(this.identities))
+	for identity := range this.identities {
+		identities = append(identities, identity)
+	}
+	return identities
+}
+
+// Revoke removes a client identity, so that the client needs
+// to authenticate again with the security code
+func (this *Gateway) Revoke(identity string) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	delete(this.identities, identity)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (this *Gateway) String() string {
+	str := "<tradfri.Simulator"
+	if addr := this.Addr(); addr != nil {
+		str += " addr=" + strconv.Quote(addr.String())
+	}
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+	str += " version=" + strconv.Quote(this.version)
+	str += fmt.Sprintf(" devices=%v groups=%v", len(this.devices), len(this.groups))
+	return str + ">"
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// psk returns the pre-shared key for a client identity
+func (this *Gateway) psk(identity []byte) ([]byte, error) {
+	this.Mutex.Lock()
+	defer this.Mutex.Unlock()
+
+	if string(identity) == IDENTITY_CLIENT {
+		return []byte(this.key), nil
+	} else if psk, exists := this.identities[string(identity)]; exists {
+		return []byte(psk), nil
+	} else {
+		return nil, gopi.ErrNotFound.WithPrefix(strconv.Quote(string(identity)))
+	}
+}
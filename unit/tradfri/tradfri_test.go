@@ -2,6 +2,10 @@ package tradfri_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
@@ -9,6 +13,8 @@ import (
 	gopi "github.com/djthorpe/gopi/v2"
 	app "github.com/djthorpe/gopi/v2/app"
 	mutablehome "github.com/djthorpe/mutablehome"
+	tradfri "github.com/djthorpe/mutablehome/unit/tradfri"
+	sim "github.com/djthorpe/mutablehome/unit/tradfri/sim"
 
 	// Units
 	_ "github.com/djthorpe/gopi/v2/unit/bus"
@@ -94,3 +100,363 @@ func Main_Test_Tradfri_003(app gopi.App, t *testing.T) {
 		t.Log("Scenes=", scenes)
 	}
 }
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	SIM_KEY    = "SecurityCode"
+	SIM_ID     = "mutablehome_test"
+	SIM_LIGHT  = 65536
+	SIM_PLUG   = 65537
+	SIM_BLIND  = 65538
+	SIM_REMOTE = 65539
+	SIM_GROUP  = 131073
+	SIM_SCENE  = 196608
+)
+
+// NewSimulator returns a gateway simulator with a light, plug, blind
+// and remote, and a group containing the light and plug with one scene.
+// When addr is empty, a random port is used
+func NewSimulator(t *testing.T, addr string) *sim.Gateway {
+	gw, err := sim.New(addr, SIM_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, device := range []string{
+		sim.Light(SIM_LIGHT, "Light", false, 100),
+		sim.Plug(SIM_PLUG, "Plug", false),
+		sim.Blind(SIM_BLIND, "Blind", 0, 80),
+		sim.Remote(SIM_REMOTE, "Remote", 50),
+	} {
+		if err := gw.SetDevice(device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gw.SetGroup(sim.Group(SIM_GROUP, "Living Room", SIM_LIGHT, SIM_PLUG)); err != nil {
+		t.Fatal(err)
+	} else if err := gw.SetScene(SIM_GROUP, sim.Scene(SIM_SCENE, "Relax", 50, SIM_LIGHT)); err != nil {
+		t.Fatal(err)
+	}
+	return gw
+}
+
+// RunWithSimulator runs a test tool with arguments to connect to the
+// gateway simulator, with state stored in a temporary folder
+func RunWithSimulator(t *testing.T, main func(gopi.App, *testing.T, *sim.Gateway), units ...string) {
+	RunWithSimulatorArgs(t, nil, main, units...)
+}
+
+// RunWithSimulatorArgs runs a test tool with additional arguments
+func RunWithSimulatorArgs(t *testing.T, extra []string, main func(gopi.App, *testing.T, *sim.Gateway), units ...string) {
+	gw := NewSimulator(t, "")
+	defer gw.Close()
+
+	path, err := ioutil.TempDir("", "tradfri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	args := append([]string{"-tradfri.key", SIM_KEY, "-tradfri.state", path}, extra...)
+	if app, err := app.NewTestTool(t, func(app gopi.App, t *testing.T) {
+		main(app, t, gw)
+	}, args, units...); err != nil {
+		t.Error(err)
+	} else if returnCode := app.Run(); returnCode != 0 {
+		t.Error("Unexpected return code", returnCode)
+	}
+}
+
+// WaitForValue subscribes and calls start, then receives values until
+// fn returns true or the timeout expires. It then unsubscribes,
+// draining any pending values
+func WaitForValue(pubsub gopi.PubSub, timeout time.Duration, start func(), fn func(interface{}) bool) bool {
+	values := pubsub.Subscribe()
+	defer func() {
+		go pubsub.Unsubscribe(values)
+		for range values {
+		}
+	}()
+	if start != nil {
+		go start()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		select {
+		case value := <-values:
+			if fn(value) {
+				return true
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Test_Tradfri_004(t *testing.T) {
+	RunWithSimulator(t, Main_Test_Tradfri_004, "mutablehome/tradfri/gateway")
+}
+
+func Main_Test_Tradfri_004(app gopi.App, t *testing.T, gw *sim.Gateway) {
+	tradfri := app.UnitInstance("mutablehome/tradfri/gateway").(mutablehome.TradfriGateway)
+	if err := tradfri.Connect(gw.Service(SIM_ID), gopi.RPC_FLAG_INET_V4); err != nil {
+		t.Fatal(err)
+	} else if tradfri.Id() != SIM_ID {
+		t.Error("Unexpected id", tradfri.Id())
+	} else if tradfri.Version() != gw.Version() {
+		t.Error("Unexpected version", tradfri.Version())
+	} else if identities := gw.Identities(); len(identities) != 1 || identities[0] != SIM_ID {
+		t.Error("Unexpected identities", identities)
+	}
+
+	if devices, err := tradfri.Devices(); err != nil {
+		t.Error(err)
+	} else if len(devices) != 4 {
+		t.Error("Unexpected devices", devices)
+	} else if groups, err := tradfri.Groups(); err != nil {
+		t.Error(err)
+	} else if len(groups) != 1 || groups[0] != SIM_GROUP {
+		t.Error("Unexpected groups", groups)
+	} else if scenes, err := tradfri.GroupScenes(SIM_GROUP); err != nil {
+		t.Error(err)
+	} else if len(scenes) != 1 || scenes[0] != SIM_SCENE {
+		t.Error("Unexpected scenes", scenes)
+	} else if _, err := tradfri.Device(SIM_GROUP); err == nil {
+		t.Error("Expected device not found error")
+	}
+
+	// Switch on light
+	if device, err := tradfri.Device(SIM_LIGHT); err != nil {
+		t.Error(err)
+	} else if lights := device.Lights(); len(lights) != 1 || lights[0].Power() {
+		t.Error("Unexpected lights", lights)
+	} else if err := tradfri.Send(lights[0].SetPower(true)); err != nil {
+		t.Error(err)
+	} else if device, err := tradfri.Device(SIM_LIGHT); err != nil {
+		t.Error(err)
+	} else if device.Lights()[0].Power() == false {
+		t.Error("Expected light to be switched on")
+	}
+
+	// Activate scene changes light brightness
+	if scene, err := tradfri.Scene(SIM_GROUP, SIM_SCENE); err != nil {
+		t.Error(err)
+	} else if err := tradfri.Send(scene.Activate()); err != nil {
+		t.Error(err)
+	} else if device, err := tradfri.Device(SIM_LIGHT); err != nil {
+		t.Error(err)
+	} else if device.Lights()[0].Brightness() != 50 {
+		t.Error("Unexpected brightness", device.Lights()[0].Brightness())
+	}
+
+	// Observe device changes
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	if WaitForValue(tradfri, 5*time.Second, func() {
+		defer close(done)
+		tradfri.ObserveDevice(ctx, SIM_PLUG)
+	}, func(value interface{}) bool {
+		if device, ok := value.(mutablehome.TradfriDevice); ok && device.Id() == SIM_PLUG {
+			if device.Name() == "Plug" {
+				gw.SetDevice(sim.Plug(SIM_PLUG, "Renamed Plug", true))
+			} else if device.Name() == "Renamed Plug" && device.Plugs()[0].Power() {
+				return true
+			}
+		}
+		return false
+	}) == false {
+		t.Error("Timeout waiting for observed change")
+	}
+	cancel()
+	<-done
+
+	if err := tradfri.Disconnect(); err != nil {
+		t.Error(err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Test_Tradfri_005(t *testing.T) {
+	RunWithSimulator(t, Main_Test_Tradfri_005, "mutablehome/tradfri/node")
+}
+
+func Main_Test_Tradfri_005(app gopi.App, t *testing.T, gw *sim.Gateway) {
+	node := app.UnitInstance("mutablehome/tradfri/node").(tradfri.Node)
+
+	// Connect and wait for all devices and groups to be added
+	added := make(map[string]bool)
+	if WaitForValue(node, 5*time.Second, func() {
+		if err := node.Connect(gw.Service(SIM_ID), gopi.RPC_FLAG_INET_V4); err != nil {
+			t.Error(err)
+		}
+	}, func(value interface{}) bool {
+		if evt, ok := value.(mutablehome.Event); ok && evt.Type() == mutablehome.EVENT_DEVICE_ADDED {
+			added[evt.Device().Id()] = true
+		}
+		return len(added) == 5
+	}) == false {
+		t.Fatal("Timeout waiting for devices, added=", added)
+	}
+
+	// Switch on group, then close the blind once the group has changed
+	group := node.Device(fmt.Sprint(SIM_GROUP)).(mutablehome.PowerTrait)
+	blind := node.Device(fmt.Sprint(SIM_BLIND)).(mutablehome.CoverTrait)
+	if WaitForValue(node, 5*time.Second, func() {
+		if err := group.SetPower(mutablehome.TRAIT_POWER_ON); err != nil {
+			t.Error(err)
+		}
+	}, func(value interface{}) bool {
+		if evt, ok := value.(mutablehome.Event); ok == false || evt.Type() != mutablehome.EVENT_DEVICE_TRAIT_CHANGED {
+			return false
+		} else if evt.Device().Id() == group.Id() {
+			if err := blind.SetPosition(0); err != nil {
+				t.Error(err)
+			}
+		} else if evt.Device().Id() == blind.Id() {
+			for _, trait := range evt.Traits() {
+				if trait == mutablehome.TRAIT_COVER_POSITION {
+					return blind.Position() == 0
+				}
+			}
+		}
+		return false
+	}) == false {
+		t.Error("Timeout waiting for trait changes")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Test_Tradfri_006(t *testing.T) {
+	RunWithSimulator(t, Main_Test_Tradfri_006, "mutablehome/tradfri/gateway")
+}
+
+func Main_Test_Tradfri_006(app gopi.App, t *testing.T, gw *sim.Gateway) {
+	tradfri := app.UnitInstance("mutablehome/tradfri/gateway").(mutablehome.TradfriGateway)
+	if err := tradfri.Connect(gw.Service(SIM_ID), gopi.RPC_FLAG_INET_V4); err != nil {
+		t.Fatal(err)
+	}
+
+	// Gateway information, pairing and reboot
+	if info, err := tradfri.Info(); err != nil {
+		t.Error(err)
+	} else if info.Version() != gw.Version() || info.Pairing() {
+		t.Error("Unexpected info", info)
+	} else if err := tradfri.Pair(time.Minute); err != nil {
+		t.Error(err)
+	} else if gw.Pairing() == false {
+		t.Error("Expected pairing mode")
+	} else if info, err := tradfri.Info(); err != nil {
+		t.Error(err)
+	} else if info.Pairing() == false {
+		t.Error("Expected pairing mode", info)
+	} else if err := tradfri.Pair(0); err != nil {
+		t.Error(err)
+	} else if gw.Pairing() {
+		t.Error("Expected pairing mode to end")
+	} else if err := tradfri.Reboot(); err != nil {
+		t.Error(err)
+	} else if gw.Reboots() != 1 {
+		t.Error("Expected reboot")
+	}
+
+	// Rename device and group
+	if device, err := tradfri.Device(SIM_LIGHT); err != nil {
+		t.Error(err)
+	} else if err := tradfri.Send(device.SetName("Hallway")); err != nil {
+		t.Error(err)
+	} else if device, err := tradfri.Device(SIM_LIGHT); err != nil {
+		t.Error(err)
+	} else if device.Name() != "Hallway" {
+		t.Error("Unexpected name", device.Name())
+	}
+	if group, err := tradfri.Group(SIM_GROUP); err != nil {
+		t.Error(err)
+	} else if err := tradfri.Send(group.SetName("Kitchen")); err != nil {
+		t.Error(err)
+	} else if group, err := tradfri.Group(SIM_GROUP); err != nil {
+		t.Error(err)
+	} else if group.Name() != "Kitchen" {
+		t.Error("Unexpected name", group.Name())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func Test_Tradfri_007(t *testing.T) {
+	RunWithSimulatorArgs(t, []string{"-tradfri.keepalive", "200ms", "-tradfri.timeout", "2s"}, Main_Test_Tradfri_007, "mutablehome/tradfri/node")
+}
+
+func Main_Test_Tradfri_007(app gopi.App, t *testing.T, gw *sim.Gateway) {
+	node := app.UnitInstance("mutablehome/tradfri/node").(tradfri.Node)
+
+	// Connect and wait for all devices and groups to be added
+	added := 0
+	if WaitForValue(node, 5*time.Second, func() {
+		if err := node.Connect(gw.Service(SIM_ID), gopi.RPC_FLAG_INET_V4); err != nil {
+			t.Error(err)
+		}
+	}, func(value interface{}) bool {
+		if evt, ok := value.(mutablehome.Event); ok && evt.Type() == mutablehome.EVENT_DEVICE_ADDED {
+			added++
+		}
+		return added == 5
+	}) == false {
+		t.Fatal("Timeout waiting for devices")
+	}
+
+	// Connecting a second time is an error
+	if err := node.Connect(gw.Service(SIM_ID), gopi.RPC_FLAG_INET_V4); errors.Is(err, gopi.ErrOutOfOrder) == false {
+		t.Error("Unexpected error", err)
+	}
+
+	// Stop the gateway and wait for the node to go offline
+	addr := gw.Addr().String()
+	if WaitForValue(node, 5*time.Second, func() {
+		if err := gw.Close(); err != nil {
+			t.Error(err)
+		}
+	}, func(value interface{}) bool {
+		evt, ok := value.(mutablehome.Event)
+		return ok && evt.Type() == mutablehome.EVENT_NODE_OFFLINE
+	}) == false {
+		t.Fatal("Timeout waiting for node to go offline")
+	}
+
+	// Restart the gateway, which has forgotten the token so the
+	// pre-shared key needs to be re-negotiated
+	started := make(chan *sim.Gateway, 1)
+	online := WaitForValue(node, 10*time.Second, func() {
+		started <- NewSimulator(t, addr)
+	}, func(value interface{}) bool {
+		evt, ok := value.(mutablehome.Event)
+		return ok && evt.Type() == mutablehome.EVENT_NODE_ONLINE
+	})
+	restarted := <-started
+	defer restarted.Close()
+	if online == false {
+		t.Fatal("Timeout waiting for node to come online")
+	} else if identities := restarted.Identities(); len(identities) != 1 || identities[0] != SIM_ID {
+		t.Error("Unexpected identities", identities)
+	}
+
+	// Observations should be restarted
+	if WaitForValue(node, 5*time.Second, func() {
+		if err := restarted.SetDevice(sim.Plug(SIM_PLUG, "Plug", true)); err != nil {
+			t.Error(err)
+		}
+	}, func(value interface{}) bool {
+		evt, ok := value.(mutablehome.Event)
+		return ok && evt.Type() == mutablehome.EVENT_DEVICE_TRAIT_CHANGED && evt.Device().Id() == fmt.Sprint(SIM_PLUG)
+	}) == false {
+		t.Error("Timeout waiting for trait change")
+	}
+
+	if err := node.Disconnect(); err != nil {
+		t.Error(err)
+	}
+}